@@ -0,0 +1,405 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/ken/vector_database/internal/config"
+	"github.com/ken/vector_database/pkg/analysis"
+	"github.com/ken/vector_database/pkg/audit"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/embedding/pipeline"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/index/twostage"
+	"github.com/ken/vector_database/pkg/sql/cli"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// App holds what the subcommands share: the configuration, the store opened
+// from it, the search settings, the embedding models and where output goes.
+// It is built once in main and passed to every command handler, so commands
+// read and write the configured data_dir and can be tested against any store.
+type App struct {
+	cfg        *config.Config
+	configPath string
+	store      storage.VectorStore
+	metric     distance.Metric
+	metrics    map[string]distance.Metric // Metrics of collections, overriding metric
+	analyzers  *analysis.Set              // Keyword analyzers of collections
+	indexType  executor.IndexType
+	verbose    bool
+	models     *embedding.Registry
+	adapter    storage.VectorAdapter
+	truncation *matryoshka.Options
+	twoStage   *twostage.Options
+	hnsw       *hnsw.HNSWConfig           // Nil for the default HNSW parameters
+	tiering    *tiered.Options            // Options and shared access stats of tiered indexes
+	audit      *audit.Log                 // Nil when auditing is disabled
+	indexes    *executor.IndexCache       // Search indexes, persisted in the data directory
+	results    *executor.ResultCache      // Nil when query results are not cached
+	plans      *executor.PlanCache        // Parsed statements, shared by every executor; nil when disabled
+	memory     *executor.MemoryAccountant // Memory budgets of queries, shared by every executor; nil when unlimited
+	catalog    *executor.Catalog          // Views, persisted in the data directory
+	in         io.Reader                  // Input of the interactive SQL shell
+	out        io.Writer                  // Command output
+	progress   io.Writer                  // Progress bars of long jobs
+	logger     *log.Logger                // Warnings and diagnostics
+}
+
+// NewApp opens the store and builds the embedding models, metric and
+// index settings from the configuration
+func NewApp(cfg *config.Config, configPath, metricName, indexType string, verbose bool) (*App, error) {
+	metric, err := distance.GetMetric(distance.MetricType(metricName))
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance metric: %w", err)
+	}
+
+	idxType, err := parseIndexType(indexType)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err := collectionMetrics(cfg)
+	if err != nil {
+		return nil, err
+	}
+	analyzers, err := collectionAnalyzers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create data directory if it doesn't exist; read-only stores need one
+	if !cfg.Storage.ReadOnly {
+		if err := os.MkdirAll(cfg.Storage.DataDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create data directory: %w", err)
+		}
+	}
+
+	// Build the dimension adapters for vectors from other models
+	adapter, err := newVectorAdapter(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dimension adapters: %w", err)
+	}
+
+	models, err := newModelRegistry(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load embedding models: %w", err)
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		models.Close()
+		return nil, fmt.Errorf("failed to create vector store: %w", err)
+	}
+	if adapter != nil {
+		store = storage.NewAdaptedStore(store, adapter)
+	}
+
+	// The cached store also counts writes, which the result cache keys on
+	var results *executor.ResultCache
+	if cfg.Storage.VectorCacheSize > 0 || cfg.Storage.QueryCacheSize > 0 {
+		store = storage.NewCachedStore(store, cfg.Storage.VectorCacheSize)
+	}
+	// Centroids are maintained below the quotas, which evict through them
+	store = storage.NewCentroidStore(store)
+	if cfg.Storage.AccessSampleRate > 0 {
+		store = storage.NewAccessStore(store, cfg.Storage.AccessSampleRate)
+	}
+	if cfg.Storage.QueryCacheSize > 0 {
+		results = executor.NewResultCache(cfg.Storage.QueryCacheSize)
+	}
+	var plans *executor.PlanCache
+	if cfg.Storage.PlanCacheSize > 0 {
+		plans = executor.NewPlanCache(cfg.Storage.PlanCacheSize)
+	}
+	if store, err = withQuotas(store, cfg, storage.Quota{}, nil); err != nil {
+		store.Close()
+		models.Close()
+		return nil, err
+	}
+	if store, err = withSchemas(store, cfg); err != nil {
+		store.Close()
+		models.Close()
+		return nil, err
+	}
+	store = withDimensions(store, cfg)
+	if store, err = withFinite(store, cfg); err != nil {
+		store.Close()
+		models.Close()
+		return nil, err
+	}
+
+	catalog, err := executor.OpenCatalog(catalogPath(cfg))
+	if err != nil {
+		store.Close()
+		models.Close()
+		return nil, err
+	}
+
+	var auditLog *audit.Log
+	if cfg.Audit.Enabled {
+		auditLog, err = audit.Open(auditLogPath(cfg))
+		if err != nil {
+			store.Close()
+			models.Close()
+			return nil, err
+		}
+	}
+
+	// Replicas reuse the indexes the writer persisted but save none
+	indexes := executor.NewIndexCache(filepath.Join(cfg.Storage.DataDir, "indexes"))
+	indexes.SetReadOnly(cfg.Storage.ReadOnly)
+
+	return &App{
+		cfg:        cfg,
+		configPath: configPath,
+		store:      store,
+		metric:     metric,
+		metrics:    metrics,
+		analyzers:  analyzers,
+		indexType:  idxType,
+		verbose:    verbose,
+		models:     models,
+		adapter:    adapter,
+		truncation: searchTruncation(cfg),
+		twoStage:   searchTwoStage(cfg),
+		hnsw:       searchHNSW(cfg),
+		tiering:    searchTiering(cfg),
+		audit:      auditLog,
+		indexes:    indexes,
+		results:    results,
+		plans:      plans,
+		memory:     queryMemory(cfg),
+		catalog:    catalog,
+		in:         os.Stdin,
+		out:        os.Stdout,
+		progress:   os.Stderr,
+		logger:     log.New(os.Stderr, "", log.LstdFlags),
+	}, nil
+}
+
+// withQuotas wraps a store in the quotas of the storage configuration and
+// in quota, a store-wide quota whose bytes usage measures. Evictions go
+// through the caches below the quota store, so they never serve evicted
+// vectors.
+func withQuotas(store storage.VectorStore, cfg *config.Config, quota storage.Quota, usage func() (int64, error)) (storage.VectorStore, error) {
+	if quota.MaxVectors == 0 && quota.MaxBytes == 0 && len(cfg.Storage.Quotas) == 0 {
+		return store, nil
+	}
+	quotas := storage.NewQuotaStore(store, quota, usage)
+	for _, q := range cfg.Storage.Quotas {
+		policy, err := storage.ParseEvictionPolicy(q.Policy)
+		if err != nil {
+			return store, fmt.Errorf("invalid quota for %q: %w", q.Prefix, err)
+		}
+		quotas.AddQuota(q.Prefix, storage.Quota{MaxVectors: q.MaxVectors, MaxBytes: q.MaxMB << 20, Policy: policy})
+	}
+	return quotas, nil
+}
+
+// withSchemas wraps a store in the metadata schemas of the storage
+// configuration. It goes above the quotas, so invalid writes evict nothing.
+func withSchemas(store storage.VectorStore, cfg *config.Config) (storage.VectorStore, error) {
+	if len(cfg.Storage.Schemas) == 0 {
+		return store, nil
+	}
+	schemas := storage.NewSchemaStore(store)
+	for collection, sc := range cfg.Storage.Schemas {
+		schema := storage.Schema{Collection: collection, Prefix: sc.Prefix}
+		for _, f := range sc.Fields {
+			fieldType, err := storage.ParseFieldType(f.Type)
+			if err != nil {
+				return store, fmt.Errorf("invalid schema of %s: field %q: %w", collection, f.Name, err)
+			}
+			schema.Fields = append(schema.Fields, storage.SchemaField{Name: f.Name, Type: fieldType, Required: f.Required})
+		}
+		if err := schemas.AddSchema(schema); err != nil {
+			return store, fmt.Errorf("invalid schema: %w", err)
+		}
+	}
+	return schemas, nil
+}
+
+// withDimensions wraps a store in a check of the dimension of writes, per
+// collection of the metadata schemas. It goes above every other wrapper, so
+// a vector of the wrong dimension is rejected before it is validated.
+func withDimensions(store storage.VectorStore, cfg *config.Config) storage.VectorStore {
+	if !cfg.Storage.CheckDimensions {
+		return store
+	}
+	dimensions := storage.NewDimensionStore(store)
+	for collection, sc := range cfg.Storage.Schemas {
+		dimensions.AddCollection(collection, sc.Prefix)
+	}
+	return dimensions
+}
+
+// withFinite wraps a store in the policy for NaN and infinite values of the
+// vector configuration. Zeroed values are zeroed before their dimension is
+// checked.
+func withFinite(store storage.VectorStore, cfg *config.Config) (storage.VectorStore, error) {
+	policy, err := storage.ParseFinitePolicy(cfg.Vector.NonFinite)
+	if err != nil {
+		return store, fmt.Errorf("invalid vector configuration: %w", err)
+	}
+	if policy == storage.FiniteAllow {
+		return store, nil
+	}
+	return storage.NewFiniteStore(store, policy), nil
+}
+
+// printf writes formatted command output
+func (a *App) printf(format string, args ...interface{}) {
+	fmt.Fprintf(a.out, format, args...)
+}
+
+// println writes a line of command output
+func (a *App) println(args ...interface{}) {
+	fmt.Fprintln(a.out, args...)
+}
+
+// Close closes the store, the embedding models and the audit log
+func (a *App) Close() error {
+	a.models.Close()
+	if a.audit != nil {
+		a.audit.Close()
+	}
+	return a.store.Close()
+}
+
+// docsDir returns the directory of documents stored by the embed command,
+// next to the data directory
+func (a *App) docsDir() string {
+	return filepath.Join(filepath.Dir(a.cfg.Storage.DataDir), "docs")
+}
+
+// binaryProcessor returns what extracts the text of binary files for embed
+// and watch, or nil if extraction is disabled
+func (a *App) binaryProcessor() *pipeline.BinaryProcessor {
+	if !a.cfg.Extraction.Enabled {
+		return nil
+	}
+	return pipeline.NewBinaryProcessor(&pipeline.BinaryOptions{
+		TranscriptionEndpoint: a.cfg.Extraction.TranscriptionEndpoint,
+		OCREndpoint:           a.cfg.Extraction.OCREndpoint,
+		APIKey:                a.cfg.Extraction.APIKey,
+		Timeout:               a.cfg.Extraction.Timeout,
+	})
+}
+
+// snapshotDir returns where snapshots of the store are kept
+func (a *App) snapshotDir() string {
+	if a.cfg.Storage.SnapshotDir != "" {
+		return a.cfg.Storage.SnapshotDir
+	}
+	return filepath.Join(a.cfg.Storage.DataDir, "snapshots")
+}
+
+// sqlHistoryPath returns where the SQL shell keeps its history
+func (a *App) sqlHistoryPath() string {
+	return filepath.Join(a.cfg.Storage.DataDir, "sql_history")
+}
+
+// savedQueriesPath returns where the SQL shell keeps the queries saved with \save
+func (a *App) savedQueriesPath() string {
+	return filepath.Join(a.cfg.Storage.DataDir, "saved_queries.json")
+}
+
+// checkpointPath returns where a job over the given input keeps its checkpoint
+func (a *App) checkpointPath(job, source string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		source = abs
+	}
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(a.cfg.Storage.DataDir, "checkpoints", job+"-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+// newSQLService creates a SQL service over the store with the configured
+// index type, metric and search options
+func (a *App) newSQLService() *cli.SQLService {
+	service := cli.NewSQLService(a.store, a.indexType, a.metric)
+	service.SetVerbose(a.verbose)
+	service.SetModelRegistry(a.models)
+	service.SetVectorAdapter(a.adapter)
+	service.SetTruncation(a.truncation)
+	service.SetTwoStage(a.twoStage)
+	service.SetTiering(a.tiering)
+	service.SetHNSWConfig(a.hnsw)
+	service.SetDocsDir(a.docsDir())
+	service.SetCatalog(a.catalog)
+	for collection, metric := range a.metrics {
+		service.SetCollectionMetric(collection, metric)
+	}
+	if a.audit != nil {
+		service.SetAuditLog(a.audit, localActor())
+	}
+	if a.indexes != nil {
+		service.SetIndexCache(a.indexes)
+	}
+	if a.results != nil {
+		service.SetResultCache(a.results)
+	}
+	if a.plans != nil {
+		service.SetPlanCache(a.plans)
+	}
+	if a.memory != nil {
+		service.SetMemoryAccountant(a.memory)
+	}
+	return service
+}
+
+// queryMemory returns the accountant of the memory budgets of queries, or
+// nil if both are unlimited
+func queryMemory(cfg *config.Config) *executor.MemoryAccountant {
+	if cfg.Server.QueryMemoryMB <= 0 && cfg.Server.MemoryBudgetMB <= 0 {
+		return nil
+	}
+	return executor.NewMemoryAccountant(cfg.Server.QueryMemoryMB<<20, cfg.Server.MemoryBudgetMB<<20)
+}
+
+// catalogPath returns where the views, macros and rules created with
+// CREATE VIEW, MACRO and RULE are kept
+func catalogPath(cfg *config.Config) string {
+	return filepath.Join(cfg.Storage.DataDir, "catalog.json")
+}
+
+// auditLogPath returns the configured audit log, by default in the data directory
+func auditLogPath(cfg *config.Config) string {
+	if cfg.Audit.Path != "" {
+		return cfg.Audit.Path
+	}
+	return filepath.Join(cfg.Storage.DataDir, "audit.log")
+}
+
+// localActor names the local user in the audit log
+func localActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli:" + os.Getenv("USER")
+}
+
+// parseIndexType converts the -index flag to an executor index type
+func parseIndexType(indexType string) (executor.IndexType, error) {
+	switch strings.ToLower(indexType) {
+	case "flat":
+		return executor.IndexTypeFlat, nil
+	case "hnsw":
+		return executor.IndexTypeHNSW, nil
+	case "tiered":
+		return executor.IndexTypeTiered, nil
+	default:
+		return "", fmt.Errorf("unsupported index type: %s (supported: flat, hnsw, tiered)", indexType)
+	}
+}
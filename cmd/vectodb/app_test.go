@@ -0,0 +1,1063 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/internal/config"
+	"github.com/ken/vector_database/pkg/api"
+	"github.com/ken/vector_database/pkg/audit"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/progress"
+	"github.com/ken/vector_database/pkg/snapshot"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// newTestApp creates an App over a memory store that writes its output to a buffer
+func newTestApp(t *testing.T) (*App, *bytes.Buffer) {
+	cfg := config.DefaultConfig()
+	cfg.Storage.DataDir = filepath.Join(t.TempDir(), "data")
+
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	models := embedding.NewRegistry()
+	t.Cleanup(func() { models.Close() })
+
+	catalog, _ := executor.OpenCatalog(catalogPath(cfg))
+
+	out := &bytes.Buffer{}
+	return &App{
+		cfg:       cfg,
+		store:     storage.NewMemoryStore(),
+		metric:    metric,
+		indexType: executor.IndexTypeFlat,
+		models:    models,
+		out:       out,
+		progress:  io.Discard,
+		logger:    log.New(io.Discard, "", 0),
+		catalog:   catalog,
+	}, out
+}
+
+func TestVectorCommands(t *testing.T) {
+	app, out := newTestApp(t)
+
+	steps := []struct {
+		handler func([]string, *App) error
+		args    []string
+		want    string
+	}{
+		{HandleAddCommand, []string{"a", "1,2,3"}, "Added vector a with dimension 3"},
+		{HandleAddCommand, []string{"b", "1,2,4"}, "Added vector b"},
+		{HandleSetMetadataCommand, []string{"a", "lang", "fr"}, "Set metadata lang=fr for vector a"},
+		{HandleGetCommand, []string{"a"}, "  lang: fr\nValues:\n  [0]: 1.000000"},
+		{HandleListCommand, nil, "Found 2 vectors:"},
+		{HandleSearchCommand, []string{"flat", "a", "2"}, "b (distance: 1.000000)"},
+		{HandleSQLCommand, []string{"SELECT id FROM vectors WHERE metadata.lang = 'fr'"}, "1 row(s) returned"},
+		{HandleSQLCommand, []string{"-dry-run", "DROP COLLECTION vectors"}, "Would drop 'vectors' (2 vectors; dry run)"},
+		{HandleDeleteCommand, []string{"-dry-run", "b"}, "Would delete vector b (dry run)"},
+		{HandleDeleteCommand, []string{"b"}, "Vector b deleted"},
+	}
+	for _, step := range steps {
+		out.Reset()
+		if err := step.handler(step.args, app); err != nil {
+			t.Fatalf("%v failed: %v", step.args, err)
+		}
+		if !strings.Contains(out.String(), step.want) {
+			t.Errorf("%v: expected output containing %q, got %q", step.args, step.want, out.String())
+		}
+	}
+
+	if err := HandleGetCommand([]string{"b"}, app); err == nil || err.Error() != "vector b not found" {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if err := HandleAddCommand([]string{"a", "1,2,3"}, app); err == nil {
+		t.Error("Expected duplicate ID error")
+	}
+	if err := HandleAddCommand([]string{"c"}, app); err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+		t.Errorf("Expected usage error, got %v", err)
+	}
+}
+
+func TestSQLShell(t *testing.T) {
+	app, out := newTestApp(t)
+	app.in = strings.NewReader(strings.Join([]string{
+		"INSERT INTO vectors (id, vector)",
+		"  VALUES ('a', [1.0, 2.0]);",
+		"USE vectors;",
+		"SELECT id, dimension LIMIT 1;",
+		"SELECT id FROM;",
+		"\\session",
+		"\\q",
+		"DROP COLLECTION vectors;",
+	}, "\n"))
+
+	if err := HandleSQLCommand([]string{"-i"}, app); err != nil {
+		t.Fatalf("Shell failed: %v", err)
+	}
+	for _, want := range []string{"...> ", "vectodb:vectors> ", "dimension", "SQL error: ", "collection = vectors"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output containing %q, got %q", want, out.String())
+		}
+	}
+	if count, _ := app.store.Count(); count != 1 {
+		t.Errorf("Expected the shell to stop at \\q, got %d vectors", count)
+	}
+}
+
+func TestSQLViews(t *testing.T) {
+	app, out := newTestApp(t)
+	for id, kind := range map[string]string{"a": "doc", "b": "img"} {
+		vec := vector.NewVector(id, []float32{1, 2})
+		vec.Metadata["type"] = kind
+		if err := app.store.Insert(vec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.in = strings.NewReader(strings.Join([]string{
+		"CREATE VIEW docs_only AS SELECT id FROM vectors WHERE metadata.type = 'doc';",
+		"SELECT COUNT(*) FROM docs_only;",
+		"\\views",
+		"CREATE MACRO images AS metadata.type = 'img';",
+		"CREATE RULE cap ON * LIMIT 5;",
+		"\\rules",
+	}, "\n"))
+	if err := HandleSQLCommand([]string{"-i"}, app); err != nil {
+		t.Fatalf("Shell failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "docs_only: SELECT id FROM vectors WHERE metadata.type = 'doc'") {
+		t.Errorf("Expected the view to be listed, got %q", out.String())
+	}
+	for _, want := range []string{"macro images: metadata.type = 'img'", "rule cap on *: LIMIT 5"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q to be listed, got %q", want, out.String())
+		}
+	}
+
+	// Views are kept in the data directory
+	catalog, err := executor.OpenCatalog(catalogPath(app.cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := catalog.View("docs_only"); !ok {
+		t.Errorf("Expected docs_only in the catalog, got %v", catalog.Views())
+	}
+	if _, ok := catalog.Macro("images"); !ok || len(catalog.Rules()) != 1 {
+		t.Errorf("Expected the macro and rule in the catalog, got %v and %v", catalog.Macros(), catalog.Rules())
+	}
+}
+
+func TestSQLFileParams(t *testing.T) {
+	app, out := newTestApp(t)
+	dir := t.TempDir()
+	script := filepath.Join(dir, "query.sql")
+	if err := os.WriteFile(script, []byte(strings.Join([]string{
+		"-- :unused in a comment is left alone",
+		"INSERT INTO vectors (id, vector) VALUES (:id, [1.0, 2.0]);",
+		"INSERT INTO vectors (id, vector) VALUES ('b', [5.0, 5.0]);",
+		"SELECT id, distance FROM vectors NEAREST TO :vec LIMIT :k;",
+		"-- end",
+	}, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	embedding := filepath.Join(dir, "embedding.json")
+	if err := os.WriteFile(embedding, []byte(`{"embedding": [5, 5]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := HandleSQLCommand([]string{"-f", script, "-param", "k=1", "-param", "vec=@" + embedding, "-param", "id=it's"}, app)
+	if err != nil {
+		t.Fatalf("Script failed: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "1 row(s) returned") || !strings.Contains(got, "'b' | 0") {
+		t.Errorf("Expected the nearest vector b, got %q", got)
+	}
+	if count, _ := app.store.Count(); count != 2 {
+		t.Errorf("Expected 2 vectors, got %d", count)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"SELECT id FROM vectors LIMIT :k"}, "no value for :k"},
+		{[]string{"-param", "k=1", "-param", "n=2", "SELECT id FROM vectors LIMIT :k"}, "parameter n is not used"},
+		{[]string{"-param", "1k=1", "SELECT id FROM vectors"}, "parameter must be name=value"},
+		{[]string{"-param", "vec=@" + filepath.Join(dir, "missing.json"), "SELECT id FROM vectors NEAREST TO :vec"}, "missing.json"},
+	} {
+		if err := HandleSQLCommand(test.args, app); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: expected error containing %q, got %v", test.args, test.want, err)
+		}
+	}
+}
+
+func TestSQLShellHistory(t *testing.T) {
+	app, out := newTestApp(t)
+	shell := func(lines ...string) string {
+		out.Reset()
+		app.in = strings.NewReader(strings.Join(lines, "\n"))
+		if err := HandleSQLCommand([]string{"-i"}, app); err != nil {
+			t.Fatalf("Shell failed: %v", err)
+		}
+		return out.String()
+	}
+
+	shell(
+		"INSERT INTO vectors (id, vector) VALUES ('a', [1.0, 2.0]);",
+		"SELECT COUNT(*)",
+		"  FROM vectors;",
+		"\\save count",
+		"\\save dims SELECT id, dimension FROM vectors;",
+	)
+
+	// History and saved queries outlive the session
+	got := shell("\\history", "\\saved", "\\run count", "\\run missing", "\\forget dims", "\\saved")
+	for _, want := range []string{
+		"   2  SELECT COUNT(*) FROM vectors;",
+		"dims: SELECT id, dimension FROM vectors;",
+		"1 row(s) returned",
+		"No query saved as missing",
+		"Forgot dims",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected output containing %q, got %q", want, got)
+		}
+	}
+	if strings.Count(got, "dims: ") != 1 {
+		t.Errorf("Expected dims to be forgotten, got %q", got)
+	}
+}
+
+func TestEmbedAndSearchText(t *testing.T) {
+	app, out := newTestApp(t)
+
+	for _, doc := range [][]string{{"d1", "vector databases store embeddings"}, {"d2", "a recipe for bread"}} {
+		if err := HandleEmbedCommand([]string{"text", doc[0], doc[1]}, app); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	}
+
+	// Documents are stored next to the configured data directory
+	if _, err := embedding.LoadDocument(app.docsDir(), "d1"); err != nil {
+		t.Errorf("Expected the document in %s: %v", app.docsDir(), err)
+	}
+
+	// Embedding the same content again is skipped
+	out.Reset()
+	if err := HandleEmbedCommand([]string{"text", "d1", "vector databases store embeddings"}, app); err != nil {
+		t.Fatalf("Embed failed: %v", err)
+	}
+	if want := "Document 'd1' is unchanged (version 1)"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	out.Reset()
+	if err := HandleSearchTextCommand([]string{"-k", "1", "-format", "json", "vector databases store embeddings"}, app); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	var hits []searchHit
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", out.String(), err)
+	}
+	if len(hits) != 1 || hits[0].ID != "d1" {
+		t.Errorf("Unexpected hits: %+v", hits)
+	}
+
+	// Highlighting marks the query's terms in the document's text
+	out.Reset()
+	if err := HandleSearchTextCommand([]string{"-k", "1", "-highlight", "vector databases store embeddings"}, app); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if want := "**vector** **databases** **store** **embeddings**"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+}
+
+func TestLanguageRouting(t *testing.T) {
+	app, out := newTestApp(t)
+	app.cfg.Embedding.Models["multilingual"] = config.ModelConfig{Model: "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2"}
+	app.cfg.Embedding.Routes = map[string]map[string]string{defaultCollection: {"*": "multilingual", "en": "minilm"}}
+	models, err := newModelRegistry(app.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.models = models
+
+	docs := [][]string{
+		{"en", "The index is rebuilt at night"},
+		{"fr", "Le chat est sur la table"},
+		{"de", "Der Hund ist nicht im Haus"},
+	}
+	for _, doc := range docs {
+		if err := HandleEmbedCommand([]string{"text", doc[0], doc[1]}, app); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	}
+	if want := "Language: de (model sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2)"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+	v, err := app.store.Get("fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Metadata[embedding.MetadataKeyLanguage] != "fr" ||
+		v.Metadata[embedding.MetadataKeyModel] != "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2" {
+		t.Errorf("Unexpected metadata: %v", v.Metadata)
+	}
+
+	// Queries only find documents in their language
+	out.Reset()
+	if err := HandleSearchTextCommand([]string{"-format", "json", "Où est le chat ?"}, app); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var hits []searchHit
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", out.String(), err)
+	}
+	if len(hits) != 1 || hits[0].ID != "fr" {
+		t.Errorf("Unexpected hits: %+v", hits)
+	}
+
+	out.Reset()
+	if err := HandleModelsCommand(nil, app); err != nil {
+		t.Fatal(err)
+	}
+	if want := "vectors          *    multilingual"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+}
+
+func TestSearchTextModelOverride(t *testing.T) {
+	app, out := newTestApp(t)
+	app.cfg.Embedding.Models["l12"] = config.ModelConfig{Model: "sentence-transformers/all-MiniLM-L12-v2"}
+	app.cfg.Embedding.Models["clip"] = config.ModelConfig{Provider: "clip", Model: "clip-vit", Endpoint: "http://localhost", Dimension: 512}
+	models, err := newModelRegistry(app.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.models = models
+
+	for _, doc := range [][]string{{"a", "vector database"}, {"b", "cooking recipes"}} {
+		if err := HandleEmbedCommand([]string{"text", doc[0], doc[1]}, app); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	}
+
+	// Another model of the collection's dimension compares with every document
+	out.Reset()
+	if err := HandleSearchTextCommand([]string{"-model", "l12", "-format", "json", "vector database"}, app); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var hits []searchHit
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", out.String(), err)
+	}
+	if len(hits) != 2 {
+		t.Errorf("Unexpected hits: %+v", hits)
+	}
+
+	err = HandleSearchTextCommand([]string{"-model", "clip", "vector database"}, app)
+	if err == nil || !strings.Contains(err.Error(), "makes 512-dimensional vectors") {
+		t.Errorf("Expected dimension error, got %v", err)
+	}
+	if err := HandleSearchTextCommand([]string{"-model", "missing", "vector database"}, app); err == nil {
+		t.Error("Expected error for an unknown model")
+	}
+}
+
+func TestEmbedAndSearchImages(t *testing.T) {
+	app, out := newTestApp(t)
+
+	// A CLIP-style API embedding images as their size
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []struct{ Image string } `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string][]float32, len(req.Input))
+		for i, input := range req.Input {
+			raw, _ := base64.StdEncoding.DecodeString(input.Image)
+			size, _, _ := image.DecodeConfig(bytes.NewReader(raw))
+			data[i] = map[string][]float32{"embedding": {float32(size.Width), float32(size.Height)}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+	defer server.Close()
+	spec := embedding.ModelSpec{Provider: embedding.ProviderCLIP, Model: "clip", Endpoint: server.URL, Dimension: 2}
+	if err := app.models.Register("clip", spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.models.Bind(defaultCollection, "clip"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	writePNG := func(name string, width, height int) string {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	for _, img := range []struct {
+		id            string
+		width, height int
+	}{{"small", 2, 2}, {"wide", 40, 10}} {
+		if err := HandleEmbedCommand([]string{"image", img.id, writePNG(img.id+".png", img.width, img.height)}, app); err != nil {
+			t.Fatalf("Embed failed: %v", err)
+		}
+	}
+	if want := "Image: image/png, 40x10 pixels"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	out.Reset()
+	if err := HandleSearchTextCommand([]string{"-k", "1", "-format", "json", "-image", writePNG("query.png", 36, 12)}, app); err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	var hits []searchHit
+	if err := json.Unmarshal(out.Bytes(), &hits); err != nil {
+		t.Fatalf("Invalid JSON output %q: %v", out.String(), err)
+	}
+	if len(hits) != 1 || hits[0].ID != "wide" {
+		t.Errorf("Unexpected hits: %+v", hits)
+	}
+
+	// Text models cannot embed images
+	if err := app.models.Bind(defaultCollection, embedding.DefaultModelName); err != nil {
+		t.Fatal(err)
+	}
+	err := HandleEmbedCommand([]string{"image", "other", writePNG("other.png", 1, 1)}, app)
+	if err == nil || !strings.Contains(err.Error(), "does not embed images") {
+		t.Errorf("Expected an unsupported image error, got %v", err)
+	}
+}
+
+func TestImportResumesFromCheckpoint(t *testing.T) {
+	app, out := newTestApp(t)
+
+	path := filepath.Join(t.TempDir(), "items.copy")
+	if err := os.WriteFile(path, []byte("a\t[1,2]\t{}\nb\t[3,4]\t{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier run stopped after the first row
+	checkpoint, err := progress.NewCheckpoint("import", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.Position = 1
+	checkpointPath := app.checkpointPath("import", path)
+	if err := checkpoint.Save(checkpointPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := HandleImportCommand([]string{"-from", "pgvector", path}, app); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Resuming after row 1") || !strings.Contains(out.String(), "Imported 1 vectors") {
+		t.Errorf("Unexpected output: %q", out.String())
+	}
+	if ids, _ := app.store.List(); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("Expected only b to be imported, got %v", ids)
+	}
+	if _, err := os.Stat(checkpointPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
+
+func TestAuditCommand(t *testing.T) {
+	app, out := newTestApp(t)
+
+	auditLog, err := audit.Open(auditLogPath(app.cfg))
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	app.audit = auditLog
+	defer auditLog.Close()
+
+	queries := []string{
+		"INSERT INTO vectors (id, vector) VALUES ('a', [1.0, 2.0])",
+		"SELECT id FROM vectors WHERE id = 'a'",
+		"DELETE FROM vectors WHERE id = 'a'",
+	}
+	for _, query := range queries {
+		if err := HandleSQLCommand([]string{query}, app); err != nil {
+			t.Fatalf("sql %q failed: %v", query, err)
+		}
+	}
+
+	out.Reset()
+	if err := HandleAuditCommand([]string{"tail", "-n", "1"}, app); err != nil {
+		t.Fatalf("audit tail failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], "delete") || !strings.Contains(lines[0], "cli:") {
+		t.Errorf("Unexpected audit tail output: %q", out.String())
+	}
+
+	// Only the insert and the delete are recorded
+	out.Reset()
+	if err := HandleAuditCommand([]string{"tail", "-json"}, app); err != nil {
+		t.Fatalf("audit tail failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.Contains(lines[0], `"operation":"insert"`) {
+		t.Errorf("Unexpected audit entries: %q", out.String())
+	}
+}
+
+func TestSnapshotCommand(t *testing.T) {
+	app, out := newTestApp(t)
+
+	steps := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"list"}, "No snapshots"},
+		{[]string{"create"}, "Created snapshot 1 with 0 vectors"},
+		{[]string{"verify", "1"}, "Snapshot 1 is intact"},
+		{[]string{"list"}, "1 files"},
+	}
+	for _, step := range steps {
+		out.Reset()
+		if err := HandleSnapshotCommand(step.args, app); err != nil {
+			t.Fatalf("snapshot %v failed: %v", step.args, err)
+		}
+		if !strings.Contains(out.String(), step.want) {
+			t.Errorf("snapshot %v: expected %q in output, got %q", step.args, step.want, out.String())
+		}
+	}
+
+	if err := HandleAddCommand([]string{"a", "1,2"}, app); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	out.Reset()
+	if err := HandleSnapshotCommand([]string{"restore", "1"}, app); err != nil {
+		t.Fatalf("snapshot restore failed: %v", err)
+	}
+	if count, _ := app.store.Count(); count != 0 {
+		t.Errorf("Expected the restore to remove vector a, got %d vectors", count)
+	}
+	if err := HandleSnapshotCommand([]string{"verify", "2"}, app); err == nil {
+		t.Error("Expected verifying a missing snapshot to fail")
+	}
+}
+
+func TestServeReadOnly(t *testing.T) {
+	app, _ := newTestApp(t)
+	if err := HandleAddCommand([]string{"a", "1,2"}, app); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if err := HandleSnapshotCommand([]string{"create"}, app); err != nil {
+		t.Fatalf("snapshot create failed: %v", err)
+	}
+	HandleAddCommand([]string{"b", "3,4"}, app)
+
+	post := func(server *api.Server) int {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/vectors", strings.NewReader(`{"id": "c", "values": [5, 6]}`)))
+		return rec.Code
+	}
+
+	server, err := newServeServer(app, true, "", "")
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	if status := post(server); status != http.StatusForbidden {
+		t.Errorf("Expected a write to a read-only server to fail with 403, got %d", status)
+	}
+
+	server, err = newServeServer(app, false, snapshot.Dir(app.snapshotDir(), 1), "")
+	if err != nil {
+		t.Fatalf("Failed to serve snapshot: %v", err)
+	}
+	if status := post(server); status != http.StatusForbidden {
+		t.Errorf("Expected a write to a snapshot to fail with 403, got %d", status)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vectors/b", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the snapshot to hold only vector a, got %d for b", rec.Code)
+	}
+	if _, err := newServeServer(app, false, snapshot.Dir(app.snapshotDir(), 9), ""); err == nil {
+		t.Error("Expected serving a missing snapshot to fail")
+	}
+}
+
+func TestServeBundle(t *testing.T) {
+	app, out := newTestApp(t)
+	for i, id := range []string{"a", "b", "c"} {
+		if err := app.store.Insert(vector.NewVector(id, []float32{float32(i), 1})); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "docs.vdb")
+	if err := HandleIndexCommand([]string{"bundle", "-type", "hnsw", "-collection", "vectors", "-o", path}, app); err != nil {
+		t.Fatalf("index bundle failed: %v", err)
+	}
+	if want := "Bundled hnsw index of vectors (euclidean) with 3 vectors of dimension 2"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	// The server starts with the bundled index and serves only its vectors
+	app.store.Insert(vector.NewVector("d", []float32{9, 9}))
+	server, err := newServeServer(app, false, "", path)
+	if err != nil {
+		t.Fatalf("Failed to serve bundle: %v", err)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/indexes", nil))
+	if !strings.Contains(rec.Body.String(), `"type":"hnsw","vectors":3`) {
+		t.Errorf("Expected the bundled hnsw index to be in use, got %s", rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sql", strings.NewReader(`{"query": "SELECT id FROM vectors NEAREST TO [2.1, 1] LIMIT 1"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"c"`) {
+		t.Errorf("Expected c to be nearest, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/vectors", strings.NewReader(`{"id": "e", "values": [5, 6]}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a write to a bundle to fail with 403, got %d", rec.Code)
+	}
+
+	if _, err := newServeServer(app, false, "", filepath.Join(t.TempDir(), "missing.vdb")); err == nil {
+		t.Error("Expected serving a missing bundle to fail")
+	}
+}
+
+func TestIndexCommand(t *testing.T) {
+	app, out := newTestApp(t)
+	for _, id := range []string{"a", "b"} {
+		if err := HandleAddCommand([]string{id, "1,2"}, app); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+
+	out.Reset()
+	if err := HandleIndexCommand([]string{"rebuild", "-type", "hnsw", "-collection", "docs", "-m", "8"}, app); err != nil {
+		t.Fatalf("index rebuild failed: %v", err)
+	}
+	if want := "Rebuilt hnsw index of docs (euclidean) over 2 vectors"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	// With -server the running server rebuilds its own index
+	server := httptest.NewServer(api.NewServer(app.store, app.indexType, app.metric))
+	defer server.Close()
+	out.Reset()
+	if err := HandleIndexCommand([]string{"rebuild", "-collection", "docs", "-server", server.URL}, app); err != nil {
+		t.Fatalf("index rebuild -server failed: %v", err)
+	}
+	if want := "Rebuilt flat index of docs"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	if err := HandleIndexCommand([]string{"rebuild", "-type", "hnsw"}, app); err == nil {
+		t.Error("Expected a rebuild without a collection to fail")
+	}
+
+	for _, args := range [][]string{
+		{"stats", "-collection", "docs"},
+		{"stats", "-collection", "docs", "-server", server.URL},
+	} {
+		out.Reset()
+		if err := HandleIndexCommand(args, app); err != nil {
+			t.Fatalf("index %v failed: %v", args, err)
+		}
+		if want := "HNSW index of docs: 2 nodes (0 deleted)"; !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+		if want := "Connected components at level 0: 1"; !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+	}
+}
+
+func TestIndexFileCommands(t *testing.T) {
+	app, out := newTestApp(t)
+	path := filepath.Join(t.TempDir(), "docs.idx")
+
+	// A flat index saved before index files had a header
+	file, _ := os.Create(path)
+	gob.NewEncoder(file).Encode(struct {
+		Vectors map[string]*vector.Vector
+		Metric  string
+	}{map[string]*vector.Vector{"a": vector.NewVector("a", []float32{1, 2, 3})}, "cosine"})
+	file.Close()
+
+	if err := HandleIndexCommand([]string{"inspect", path}, app); err != nil {
+		t.Fatalf("index inspect failed: %v", err)
+	}
+	if want := "legacy index file"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+	if err := HandleIndexCommand([]string{"upgrade", path}, app); err == nil {
+		t.Error("Expected an upgrade of a legacy file without -type to fail")
+	}
+
+	out.Reset()
+	if err := HandleIndexCommand([]string{"upgrade", "-type", "flat", path}, app); err != nil {
+		t.Fatalf("index upgrade failed: %v", err)
+	}
+	if want := "Upgraded flat index " + path + " from format 0 to 2 (1 vectors)"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	out.Reset()
+	if err := HandleIndexCommand([]string{"inspect", path}, app); err != nil {
+		t.Fatalf("index inspect failed: %v", err)
+	}
+	for _, want := range []string{"Index type:      flat", "Metric:          cosine", "Dimension:       3", "(OK)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+	}
+	if err := HandleIndexCommand([]string{"upgrade", "-type", "hnsw", path}, app); err == nil {
+		t.Error("Expected an upgrade with the wrong -type to fail")
+	}
+}
+
+func TestModelsStatsCommand(t *testing.T) {
+	app, out := newTestApp(t)
+	if err := HandleModelsCommand([]string{"stats"}, app); err != nil {
+		t.Fatalf("models stats failed: %v", err)
+	}
+	if want := "No embedding calls made"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	if err := HandleEmbedCommand([]string{"text", "doc1", "hello world"}, app); err != nil {
+		t.Fatalf("embed failed: %v", err)
+	}
+
+	// A server sharing the registry reports the same calls
+	s := api.NewServer(app.store, app.indexType, app.metric)
+	s.SetModelRegistry(app.models)
+	server := httptest.NewServer(s)
+	defer server.Close()
+	for _, args := range [][]string{{"stats"}, {"stats", "-server", server.URL}} {
+		out.Reset()
+		if err := HandleModelsCommand(args, app); err != nil {
+			t.Fatalf("models %v failed: %v", args, err)
+		}
+		if want := "sentence-transformers/all-MiniLM-L6-v2"; !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+	}
+}
+
+func TestRandomBatchCommand(t *testing.T) {
+	first, out := newTestApp(t)
+	second, _ := newTestApp(t)
+
+	args := []string{"-dist", "sphere", "-seed", "42", "12", "4"}
+	for _, app := range []*App{first, second} {
+		if err := HandleRandomBatchCommand(args, app); err != nil {
+			t.Fatalf("random-batch failed: %v", err)
+		}
+	}
+	if want := "Created 12 random vectors with dimension 4 (seed 42)"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	// The same seed inserts the same vectors
+	a, err := first.store.Get("rand-07")
+	if err != nil {
+		t.Fatalf("Expected zero-padded IDs: %v", err)
+	}
+	b, _ := second.store.Get("rand-07")
+	for i := range a.Values {
+		if a.Values[i] != b.Values[i] {
+			t.Fatalf("Expected seeded runs to match, got %v and %v", a.Values, b.Values)
+		}
+	}
+
+	if err := HandleRandomCommand([]string{"-dist", "cauchy", "x", "4"}, first); err == nil {
+		t.Error("Expected an unknown distribution to fail")
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	app, out := newTestApp(t)
+	if err := HandleBenchCommand(nil, app); err == nil {
+		t.Error("Expected benchmarking an empty store to fail")
+	}
+	if err := HandleRandomBatchCommand([]string{"-seed", "3", "50", "8"}, app); err != nil {
+		t.Fatalf("random-batch failed: %v", err)
+	}
+
+	profile := filepath.Join(t.TempDir(), "cpu.out")
+	if err := HandleBenchCommand([]string{"-type", "hnsw", "-queries", "20", "-k", "5", "-profile", profile}, app); err != nil {
+		t.Fatalf("bench failed: %v", err)
+	}
+	for _, want := range []string{"Built hnsw index of 50 vectors", "Ran 20 searches for 5 neighbors", "Latency: p50", "CPU profile written to " + profile} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+	}
+	if info, err := os.Stat(profile); err != nil || info.Size() == 0 {
+		t.Errorf("Expected a CPU profile: %v", err)
+	}
+
+	if err := HandleBenchCommand([]string{"-type", "ivf"}, app); err == nil {
+		t.Error("Expected an unknown index type to fail")
+	}
+}
+
+func TestGenCommand(t *testing.T) {
+	app, out := newTestApp(t)
+	path := filepath.Join(t.TempDir(), "corpus.jsonl")
+
+	args := []string{"-count", "30", "-dim", "8", "-clusters", "3", "-seed", "5", "-out", path}
+	if err := HandleGenCommand(args, app); err != nil {
+		t.Fatalf("gen failed: %v", err)
+	}
+	if want := "Wrote 30 vectors with dimension 8 in 3 clusters"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	// The corpus loads as a Qdrant export, with the clusters as metadata
+	if err := HandleImportCommand([]string{"-from", "qdrant", path}, app); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if count, _ := app.store.Count(); count != 30 {
+		t.Errorf("Expected 30 vectors, got %d", count)
+	}
+	v, err := app.store.Get("gen-07")
+	if err != nil || v.Dimension != 8 || v.Metadata["label"] != "cluster-"+v.Metadata["cluster"] {
+		t.Errorf("Unexpected vector %+v (%v)", v, err)
+	}
+
+	for _, count := range []string{"0", "1.5M", "x"} {
+		if err := HandleGenCommand([]string{"-count", count, "-out", path}, app); err == nil {
+			t.Errorf("Expected count %q to fail", count)
+		}
+	}
+	if n, err := parseCount("2M"); err != nil || n != 2000000 {
+		t.Errorf("parseCount(2M) = %d, %v", n, err)
+	}
+}
+
+func TestEmbedDirCommand(t *testing.T) {
+	app, out := newTestApp(t)
+
+	root := t.TempDir()
+	files := map[string]string{
+		"a.md":         "vector db",
+		"sub/b.md":     "one two six ten\n\nfew red sky big",
+		"sub/skip.txt": "not markdown",
+		".git/c.md":    "hidden",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := HandleEmbedCommand([]string{"dir", root, "-glob", "*.md", "-chunk", "4"}, app); err != nil {
+		t.Fatalf("Embed dir failed: %v", err)
+	}
+	ids, _ := app.store.List()
+	if strings.Join(ids, ",") != "a.md,sub/b.md#0,sub/b.md#1" {
+		t.Errorf("Unexpected IDs %v", ids)
+	}
+	v, err := app.store.Get("sub/b.md#1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Metadata["path"] != "sub/b.md" || v.Metadata["parent_id"] != "sub/b.md" || v.Metadata["size"] != "32" || v.Metadata["mtime"] == "" {
+		t.Errorf("Unexpected metadata %v", v.Metadata)
+	}
+
+	// A second run skips unchanged files and removes stale chunks
+	if err := os.WriteFile(filepath.Join(root, "sub", "b.md"), []byte("one two"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := HandleEmbedCommand([]string{"dir", root, "-glob", "*.md", "-chunk", "4"}, app); err != nil {
+		t.Fatalf("Embed dir failed: %v", err)
+	}
+	if want := "2 chunks, 1 embedded, 1 unchanged, 2 stale removed"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+	ids, _ = app.store.List()
+	if strings.Join(ids, ",") != "a.md,sub/b.md" {
+		t.Errorf("Unexpected IDs %v", ids)
+	}
+}
+
+func TestEmbedBinaryFiles(t *testing.T) {
+	app, out := newTestApp(t)
+
+	var docx bytes.Buffer
+	zw := zip.NewWriter(&docx)
+	f, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`<w:document><w:body><w:p><w:r><w:t>vector db report</w:t></w:r></w:p></w:body></w:document>`))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	files := map[string][]byte{
+		"report.docx": docx.Bytes(),
+		"talk.wav":    append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), bytes.Repeat([]byte{0xff, 0x80}, 16)...),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a transcription endpoint the audio has no text and is skipped
+	if err := HandleEmbedCommand([]string{"dir", root}, app); err != nil {
+		t.Fatalf("Embed dir failed: %v", err)
+	}
+	if want := "1 chunks, 1 embedded, 0 unchanged, 0 stale removed, 1 skipped"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+	v, err := app.store.Get("report.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Metadata["extraction"] != "docx" || len(v.Metadata["file_hash"]) != 64 ||
+		!strings.Contains(v.Metadata["media_type"], "wordprocessingml") {
+		t.Errorf("Unexpected metadata %v", v.Metadata)
+	}
+
+	// An unchanged file is not extracted again
+	out.Reset()
+	if err := HandleEmbedCommand([]string{"dir", root}, app); err != nil {
+		t.Fatalf("Embed dir failed: %v", err)
+	}
+	if want := "1 chunks, 0 embedded, 1 unchanged"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+
+	out.Reset()
+	if err := HandleEmbedCommand([]string{"file", "report", filepath.Join(root, "report.docx")}, app); err != nil {
+		t.Fatalf("Embed file failed: %v", err)
+	}
+	if want := "Extracted: docx text from application/vnd.openxmlformats"; !strings.Contains(out.String(), want) {
+		t.Errorf("Expected %q in output, got %q", want, out.String())
+	}
+	if err := HandleEmbedCommand([]string{"file", "talk", filepath.Join(root, "talk.wav")}, app); err == nil ||
+		!strings.Contains(err.Error(), "no text") {
+		t.Errorf("Expected no text error for audio, got %v", err)
+	}
+}
+
+func TestDocumentCommands(t *testing.T) {
+	app, out := newTestApp(t)
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "b.md"), []byte("one two\n\nsix ten\n\nred sky"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := HandleEmbedCommand([]string{"dir", root, "-chunk", "2"}, app); err != nil {
+		t.Fatalf("Embed dir failed: %v", err)
+	}
+
+	out.Reset()
+	if err := HandleContextCommand([]string{"-after", "0", "b.md#1"}, app); err != nil {
+		t.Fatalf("Context failed: %v", err)
+	}
+	for _, want := range []string{"Document b.md, chunks 0-1", "> [1] b.md#1", "six ten"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output, got %q", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "red sky") {
+		t.Errorf("Expected the window to end at the hit, got %q", out.String())
+	}
+
+	// Deleting the document deletes all its chunks
+	out.Reset()
+	if err := HandleDeleteCommand([]string{"-dry-run", "b.md"}, app); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Would delete 3 vectors of document b.md") {
+		t.Errorf("Unexpected dry run output %q", out.String())
+	}
+	out.Reset()
+	if err := HandleDeleteCommand([]string{"b.md"}, app); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Deleted 3 vectors of document b.md") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+	if ids, _ := app.store.List(); len(ids) != 0 {
+		t.Errorf("Expected no vectors left, got %v", ids)
+	}
+	if _, err := embedding.LoadDocument(app.docsDir(), "b.md#0"); err == nil {
+		t.Error("Expected the chunk's document to be deleted")
+	}
+	if err := HandleDeleteCommand([]string{"b.md"}, app); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestAnalyzeCommand(t *testing.T) {
+	app, out := newTestApp(t)
+	app.cfg.Analysis.Collections = map[string]config.AnalyzerConfig{
+		"docs": {Language: "english", Stemming: true, Synonyms: []string{"car, automobile"}},
+	}
+	analyzers, err := collectionAnalyzers(app.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.analyzers = analyzers
+
+	if err := HandleAnalyzeCommand([]string{"-collection", "docs", "The Indexes"}, app); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if want := "index\t\"Indexes\"\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+
+	// Other collections use the default analyzer
+	out.Reset()
+	if err := HandleAnalyzeCommand([]string{"-query", "The cars"}, app); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if want := "the cars\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+	out.Reset()
+	if err := HandleAnalyzeCommand([]string{"-collection", "docs", "-query", "The cars"}, app); err != nil {
+		t.Fatalf("Analyze failed: %v", err)
+	}
+	if want := "car automobil\n"; out.String() != want {
+		t.Errorf("Expected %q, got %q", want, out.String())
+	}
+
+	app.cfg.Analysis.Default.Language = "klingon"
+	if _, err := collectionAnalyzers(app.cfg); err == nil {
+		t.Error("Expected an unsupported language to be rejected")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// HandleAnalyzeCommand shows the terms a collection's analyzer makes of a
+// text, to check its stopwords, stemming and synonyms
+// Usage:
+//   ./vectodb analyze [-collection vectors] [-query] <text>
+func HandleAnalyzeCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	collection := fs.String("collection", defaultCollection, "Collection whose analyzer to use")
+	query := fs.Bool("query", false, "Analyze the text as a query, adding the synonyms of its terms")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	text := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("usage: analyze [-collection vectors] [-query] <text>")
+	}
+
+	analyzer := app.analyzers.For(*collection)
+	if *query {
+		app.println(strings.Join(analyzer.QueryTerms(text), " "))
+		return nil
+	}
+	for _, token := range analyzer.Analyze(text) {
+		app.printf("%s\t%q\n", token.Term, text[token.Start:token.End])
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/rag"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/ken/vector_database/pkg/vectorstore"
+)
+
+// HandleAskCommand processes the ask command
+// Usage:
+//   ./vectodb ask [-k 4] [-max-context 4000] [-no-llm] [-show-context] "<question>"
+//
+// The question is embedded with the collection's model, the closest
+// documents are read from the doc store and, if llm.endpoint is configured,
+// an LLM answers from them. Without an endpoint the context is printed.
+func HandleAskCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("ask", flag.ContinueOnError)
+	k := fs.Int("k", 4, "Number of documents to retrieve")
+	maxContext := fs.Int("max-context", 4000, "Maximum characters of retrieved context (0 = unlimited)")
+	noLLM := fs.Bool("no-llm", false, "Only retrieve and print the context, even if an LLM is configured")
+	showContext := fs.Bool("show-context", false, "Print the retrieved context before the answer")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	question := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if question == "" {
+		return fmt.Errorf("usage: ask [-k 4] [-max-context 4000] [-no-llm] [-show-context] \"<question>\"")
+	}
+
+	var llm *rag.LLMClient
+	if app.cfg.LLM.Endpoint != "" && !*noLLM {
+		apiKey := app.cfg.LLM.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("OPENAI_API_KEY")
+		}
+
+		var err error
+		llm, err = rag.NewLLMClient(rag.LLMOptions{
+			Endpoint:    app.cfg.LLM.Endpoint,
+			Model:       app.cfg.LLM.Model,
+			APIKey:      apiKey,
+			MaxTokens:   app.cfg.LLM.MaxTokens,
+			Temperature: app.cfg.LLM.Temperature,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var embedder vectorstore.Embedder = vectorstore.NewRegistryEmbedder(app.models, defaultCollection)
+	if app.adapter != nil {
+		embedder = &adaptedEmbedder{Embedder: embedder, adapter: app.adapter}
+	}
+
+	pipeline := rag.NewPipeline(app.store, embedder, app.metric, llm, &rag.Options{
+		K:               *k,
+		MaxContextChars: *maxContext,
+		DocsDir:         app.docsDir(),
+	})
+
+	answer, err := pipeline.Ask(context.Background(), question)
+	if err != nil && answer == nil {
+		return err
+	}
+
+	app.println("Retrieved documents:")
+	for i, passage := range answer.Passages {
+		app.printf("  [%d] %s (distance: %.6f)\n", i+1, passage.ID, passage.Distance)
+	}
+	app.println()
+
+	if llm == nil || *showContext {
+		app.println("Context:")
+		app.println(answer.Context)
+		app.println()
+	}
+	if err != nil {
+		return err
+	}
+
+	if llm == nil {
+		app.println("No LLM configured (set llm.endpoint in config.yaml); showing the retrieved context only.")
+		return nil
+	}
+
+	app.println("Answer:")
+	app.println(answer.Text)
+	return nil
+}
+
+// adaptedEmbedder projects query embeddings into the collection's dimension
+type adaptedEmbedder struct {
+	vectorstore.Embedder
+	adapter storage.VectorAdapter
+}
+
+func (e *adaptedEmbedder) EmbedQuery(text string) ([]float32, error) {
+	values, err := e.Embedder.EmbedQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	adapted, err := e.adapter.Adapt(vector.NewVector("query", values))
+	if err != nil {
+		return nil, err
+	}
+	return adapted.Values, nil
+}
+
+// EmbedRouted keeps the language routing of the wrapped embedder
+func (e *adaptedEmbedder) EmbedRouted(texts []string) ([][]float32, []map[string]string, error) {
+	if router, ok := e.Embedder.(vectorstore.RoutingEmbedder); ok {
+		return router.EmbedRouted(texts)
+	}
+	embeddings, err := e.Embedder.EmbedDocuments(texts)
+	return embeddings, nil, err
+}
+
+// EmbedQueryRouted keeps the language routing of the wrapped embedder
+func (e *adaptedEmbedder) EmbedQueryRouted(text string) ([]float32, map[string]string, error) {
+	router, ok := e.Embedder.(vectorstore.RoutingEmbedder)
+	if !ok {
+		values, err := e.EmbedQuery(text)
+		return values, nil, err
+	}
+	values, filter, err := router.EmbedQueryRouted(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	adapted, err := e.adapter.Adapt(vector.NewVector("query", values))
+	if err != nil {
+		return nil, nil, err
+	}
+	return adapted.Values, filter, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ken/vector_database/pkg/audit"
+)
+
+// HandleAuditCommand shows the audit log of data-modifying operations
+// Usage:
+//   ./vectodb audit tail [-n 20] [-json]
+func HandleAuditCommand(args []string, app *App) error {
+	if len(args) == 0 || args[0] != "tail" {
+		return fmt.Errorf("usage: audit tail [-n 20] [-json]")
+	}
+
+	fs := flag.NewFlagSet("audit tail", flag.ContinueOnError)
+	n := fs.Int("n", 20, "Number of entries to show (0 for all)")
+	asJSON := fs.Bool("json", false, "Print entries as JSON lines")
+	if _, err := parseArgs(fs, args[1:], 0, "audit tail [-n 20] [-json]"); err != nil {
+		return err
+	}
+
+	path := auditLogPath(app.cfg)
+	entries, err := audit.Tail(path, *n)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 && !*asJSON {
+		app.printf("No audit entries in %s\n", path)
+		return nil
+	}
+
+	for _, e := range entries {
+		if *asJSON {
+			data, _ := json.Marshal(e)
+			app.println(string(data))
+			continue
+		}
+
+		app.printf("%s  %-20s %-7s %6d  %s", e.Time.Local().Format(time.RFC3339), e.Actor, e.Operation, e.Affected, e.Statement)
+		if e.Error != "" {
+			app.printf("  (error: %s)", e.Error)
+		}
+		app.println()
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/profiling"
+	"github.com/ken/vector_database/pkg/progress"
+	"github.com/ken/vector_database/pkg/sql/executor"
+)
+
+const benchUsage = "bench [-type flat|hnsw|tiered] [-queries 1000] [-k 10] [-seed N] [-profile cpu.out] [-memprofile heap.out]"
+
+// HandleBenchCommand measures building a search index over the stored
+// vectors and searching it
+// Usage:
+//   ./vectodb bench [-type flat|hnsw|tiered] [-queries 1000] [-k 10] [-seed N] [-profile cpu.out] [-memprofile heap.out]
+//
+// The queries are stored vectors picked at random. With -profile the CPU is
+// profiled while the index is built and searched, to find what slows the
+// distance kernels or the graph traversal down; -memprofile writes the heap
+// once the index is built.
+func HandleBenchCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	indexType := fs.String("type", string(app.indexType), "Index type (flat, hnsw, tiered)")
+	queries := fs.Int("queries", 1000, "Number of searches")
+	k := fs.Int("k", 10, "Nearest neighbors per search")
+	seed := fs.Int64("seed", 1, "Seed of the choice of query vectors")
+	cpuProfile := fs.String("profile", "", "Write a CPU profile of the build and the searches to this file")
+	memProfile := fs.String("memprofile", "", "Write a heap profile after the build to this file")
+	if _, err := parseArgs(fs, args, 0, benchUsage); err != nil {
+		return err
+	}
+	if *queries < 1 || *k < 1 {
+		return fmt.Errorf("-queries and -k must be greater than 0")
+	}
+
+	vectors, err := storeVectors(app.store)
+	if err != nil {
+		return err
+	}
+	if len(vectors) == 0 {
+		return fmt.Errorf("no vectors to benchmark; add some with random-batch or import")
+	}
+	idxType, err := parseIndexType(*indexType)
+	if err != nil {
+		return err
+	}
+
+	if *cpuProfile != "" {
+		stop, err := profiling.StartCPU(*cpuProfile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				app.logger.Printf("Failed to write CPU profile: %v", err)
+				return
+			}
+			app.printf("CPU profile written to %s; inspect it with: go tool pprof %s\n", *cpuProfile, *cpuProfile)
+		}()
+	}
+
+	// Create the index with the configured parameters
+	var idx index.Index
+	var bar *progress.Bar
+	if idxType == executor.IndexTypeHNSW {
+		graph := hnsw.NewHNSWIndex(app.metric, app.hnsw)
+		bar = progress.NewBar(app.progress, "build hnsw", len(vectors))
+		graph.SetBuildProgress(func(done, total int) { bar.Set(done) })
+		idx = graph
+	} else if idxType == executor.IndexTypeTiered {
+		idx = tiered.NewIndex(app.store, app.metric, app.tiering)
+	} else {
+		idx = flat.NewFlatIndex(app.metric)
+	}
+	start := time.Now()
+	err = idx.Build(vectors)
+	build := time.Since(start)
+	if bar != nil {
+		bar.Finish()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+	app.printf("Built %s index of %d vectors with dimension %d in %v (%.0f vectors/s)\n",
+		idx.Name(), len(vectors), vectors[0].Dimension, build.Round(time.Millisecond), float64(len(vectors))/build.Seconds())
+
+	if *memProfile != "" {
+		if err := profiling.WriteHeap(*memProfile); err != nil {
+			return err
+		}
+		app.printf("Heap profile written to %s\n", *memProfile)
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	latencies := make([]time.Duration, *queries)
+	var work index.SearchCounters
+	start = time.Now()
+	for i := range latencies {
+		query := vectors[rng.Intn(len(vectors))]
+		stats := &index.SearchStats{}
+		began := time.Now()
+		if _, err := index.SearchWithOptions(idx, query, *k, index.SearchOptions{OmitVectors: true, Stats: stats}); err != nil {
+			return fmt.Errorf("search failed: %w", err)
+		}
+		latencies[i] = time.Since(began)
+		work.DistanceComputations += stats.DistanceComputations
+		work.Hops += stats.Hops
+	}
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) time.Duration {
+		return latencies[int(p*float64(len(latencies)-1))]
+	}
+	app.printf("Ran %d searches for %d neighbors in %v (%.0f queries/s)\n", *queries, *k, elapsed.Round(time.Millisecond), float64(*queries)/elapsed.Seconds())
+	app.printf("Latency: p50 %v, p95 %v, p99 %v, max %v\n", percentile(0.5), percentile(0.95), percentile(0.99), latencies[len(latencies)-1])
+	app.printf("Work per search: %.1f distance computations, %.1f hops\n",
+		float64(work.DistanceComputations)/float64(*queries), float64(work.Hops)/float64(*queries))
+	return nil
+}
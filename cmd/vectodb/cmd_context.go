@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/ken/vector_database/pkg/embedding"
+)
+
+// HandleContextCommand prints a chunk found by a search with the chunks
+// around it in its document
+// Usage:
+//   ./vectodb context [-before 1] [-after 1] [-json] <chunk-id>
+func HandleContextCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("context", flag.ContinueOnError)
+	before := fs.Int("before", 1, "Number of chunks to show before the chunk")
+	after := fs.Int("after", 1, "Number of chunks to show after the chunk")
+	asJSON := fs.Bool("json", false, "Print the window as JSON")
+	args, err := parseArgs(fs, args, 1, "context [-before 1] [-after 1] [-json] <chunk-id>")
+	if err != nil {
+		return err
+	}
+	if *before < 0 || *after < 0 {
+		return fmt.Errorf("-before and -after must not be negative")
+	}
+
+	window, err := embedding.ContextWindow(app.store, app.docsDir(), args[0], *before, *after)
+	if err != nil {
+		return vectorError(args[0], err)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(window, "", "  ")
+		if err != nil {
+			return err
+		}
+		app.println(string(data))
+		return nil
+	}
+
+	app.printf("Document %s, chunks %d-%d:\n", window.Parent, window.Chunks[0].Index, window.Chunks[len(window.Chunks)-1].Index)
+	for _, chunk := range window.Chunks {
+		marker := " "
+		if chunk.ID == window.Hit {
+			marker = ">"
+		}
+		app.printf("\n%s [%d] %s\n", marker, chunk.Index, chunk.ID)
+		if chunk.Text == "" {
+			app.println("  (no stored text)")
+			continue
+		}
+		app.println(chunk.Text)
+	}
+	return nil
+}
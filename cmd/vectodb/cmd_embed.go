@@ -3,37 +3,43 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"flag"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
-	"github.com/ken/vector_database/pkg/core/vector"
 	"github.com/ken/vector_database/pkg/embedding"
-	"github.com/ken/vector_database/pkg/storage"
+	"github.com/ken/vector_database/pkg/progress"
 )
 
-// HandleEmbedCommand processes the embed command
+// HandleEmbedCommand processes the embed command. Embedding an ID again
+// with the same content does nothing unless -force is given; changed
+// content is stored as a new version of the document.
 // Usage:
 //   ./vectodb embed text <id> <text>
 //   ./vectodb embed file <id> <file_path>
 //   ./vectodb embed json <id> <json_string_or_file>
-func HandleEmbedCommand(args []string) error {
-	if len(args) < 3 {
-		return fmt.Errorf("usage: embed [text|file|json] <id> <content>")
+//   ./vectodb embed image <id> <image_path>
+//   ./vectodb embed -force text <id> <text>
+//   ./vectodb embed dir <path> [-glob '*.md'] [-chunk 512] [-force]
+func HandleEmbedCommand(args []string, app *App) error {
+	if len(args) > 0 && args[0] == "dir" {
+		return handleEmbedDir(args[1:], app)
+	}
+
+	fs := flag.NewFlagSet("embed", flag.ContinueOnError)
+	force := fs.Bool("force", false, "Re-embed even if the content did not change")
+	args, err := parseArgs(fs, args, 3, "embed [-force] [text|file|json|image|dir] <id> <content>")
+	if err != nil {
+		return err
 	}
 
 	embedType := args[0]
 	id := args[1]
 	contentArg := args[2]
 
-	// Create embedding service
-	service, err := embedding.NewService(nil)
-	if err != nil {
-		return fmt.Errorf("failed to create embedding service: %w", err)
-	}
-	defer service.Close()
-
 	var doc *embedding.Document
 
 	switch embedType {
@@ -46,7 +52,19 @@ func HandleEmbedCommand(args []string) error {
 		if err != nil {
 			return fmt.Errorf("failed to read file: %w", err)
 		}
-		doc = embedding.NewTextDocument(id, string(content))
+		binary := app.binaryProcessor()
+		if utf8.Valid(content) || binary == nil {
+			doc = embedding.NewTextDocument(id, string(content))
+			break
+		}
+		// Binary files are embedded by their text, recording where it came from
+		extracted, err := binary.Process(contentArg, content)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		doc = embedding.NewTextDocument(id, extracted.Text)
+		embedding.SetProvenance(doc, extracted)
+		doc.SetMetadata(embedding.MetadataKeyPath, contentArg)
 	case "json":
 		// Handle JSON content
 		var jsonContent map[string]interface{}
@@ -69,52 +87,153 @@ func HandleEmbedCommand(args []string) error {
 		}
 		
 		doc = embedding.NewJSONDocument(id, jsonContent)
+	case "image":
+		// Images are embedded by a model such as CLIP; the document keeps
+		// the file's absolute path so it can be re-embedded
+		path, err := filepath.Abs(contentArg)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+		doc = embedding.NewImageDocument(id, path, data)
+		doc.SetMetadata(embedding.MetadataKeyPath, path)
 	default:
-		return fmt.Errorf("unknown embed type: %s (use text, file, or json)", embedType)
-	}
-
-	// Process the document to generate embeddings
-	if err := service.ProcessDocument(doc); err != nil {
-		return fmt.Errorf("failed to process document: %w", err)
+		return fmt.Errorf("unknown embed type: %s (use text, file, json, or image)", embedType)
 	}
 
 	// Make sure we're using the specified ID, not any potential content-as-ID
 	if doc.ID != id {
-		fmt.Printf("Warning: Document ID (%s) was different from specified ID (%s). Using specified ID.\n", doc.ID, id)
+		app.logger.Printf("Warning: document ID (%s) was different from specified ID (%s); using specified ID", doc.ID, id)
 		doc.ID = id
 	}
 
-	// Store the document and its vector
-	store, err := storage.NewFileStore("data")
+	// Use the embedding model of the target collection, or the one it routes
+	// the document's language to; images have no language
+	var service *embedding.Service
+	var language string
+	if doc.ContentType == embedding.ContentTypeImage {
+		service, err = app.models.ServiceForCollection(defaultCollection, "")
+	} else {
+		service, language, err = app.models.ServiceForText(defaultCollection, doc.Text())
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create storage: %w", err)
+		return fmt.Errorf("failed to create embedding service: %w", err)
+	}
+	if language != "" {
+		doc.SetMetadata(embedding.MetadataKeyLanguage, language)
 	}
 
-	// Store as a vector - explicitly use the specified ID
-	v := vector.NewVector(id, doc.Vector)
-	if err := store.Insert(v); err != nil {
-		return fmt.Errorf("failed to store vector: %w", err)
+	// Embed and store the vector and the document, recording the model so the vector
+	// can be re-embedded when the model changes. The store projects it into
+	// the collection's dimension if the model's differs.
+	docsDir := app.docsDir()
+	result, err := service.StoreDocument(app.store, docsDir, doc, *force)
+	if err != nil {
+		return fmt.Errorf("failed to store document: %w", err)
+	}
+	if result == embedding.DocumentUnchanged {
+		app.printf("Document '%s' is unchanged (version %d); use -force to embed it again.\n", id, doc.Version)
+		return nil
 	}
 
-	// Store document metadata as a JSON file in the same directory
-	docJson, err := doc.ToJSON()
+	app.printf("Document '%s' embedded and stored successfully (%s, version %d).\n", id, result, doc.Version)
+	app.printf("Vector dimension: %d\n", len(doc.Vector))
+	app.printf("Content type: %s\n", doc.ContentType)
+	if method, ok := doc.GetMetadata(embedding.MetadataKeyExtraction); ok {
+		mediaType, _ := doc.GetMetadata(embedding.MetadataKeyMediaType)
+		app.printf("Extracted: %v text from %v\n", method, mediaType)
+	}
+	if language != "" {
+		app.printf("Language: %s (model %s)\n", language, service.ModelName())
+	}
+	if mediaType, ok := doc.GetMetadata(embedding.MetadataKeyMediaType); ok {
+		width, _ := doc.GetMetadata(embedding.MetadataKeyWidth)
+		height, _ := doc.GetMetadata(embedding.MetadataKeyHeight)
+		app.printf("Image: %v, %vx%v pixels\n", mediaType, width, height)
+	}
+	if tokens, ok := doc.GetMetadata(embedding.MetadataKeyTokens); ok {
+		if _, truncated := doc.GetMetadata(embedding.MetadataKeyTruncated); truncated {
+			app.printf("Tokens: %v (truncated to the model's maximum length)\n", tokens)
+		} else {
+			app.printf("Tokens: %v\n", tokens)
+		}
+	}
+	app.printf("Metadata stored at: %s\n", embedding.DocumentPath(docsDir, id))
+
+	return nil
+}
+
+// handleEmbedDir embeds every matching file below a directory, using the
+// relative paths as IDs. Flags may follow the path.
+func handleEmbedDir(args []string, app *App) error {
+	fs := flag.NewFlagSet("embed dir", flag.ContinueOnError)
+	glob := fs.String("glob", "", "Only embed files whose names match this pattern, e.g. '*.md'")
+	chunk := fs.Int("chunk", 0, "Split files into chunks of at most this many tokens; 0 embeds whole files")
+	concurrency := fs.Int("concurrency", embedding.DefaultConcurrency, "Number of files embedded at once")
+	force := fs.Bool("force", false, "Re-embed files even if they did not change")
+
+	usage := "embed dir <path> [-glob pattern] [-chunk tokens] [-concurrency N] [-force]"
+	root, rest, err := parsePathArgs(fs, args, usage)
 	if err != nil {
-		return fmt.Errorf("failed to convert document to JSON: %w", err)
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("usage: %s", usage)
 	}
 
-	// Get the data directory from the store
-	dataDir := filepath.Dir(store.BaseDir())
-	metadataPath := filepath.Join(dataDir, "docs", id+".json")
-	os.MkdirAll(filepath.Join(dataDir, "docs"), 0755)
-	
-	if err := ioutil.WriteFile(metadataPath, []byte(docJson), 0644); err != nil {
-		return fmt.Errorf("failed to write document metadata: %w", err)
+	service, err := app.models.ServiceForCollection(defaultCollection, "")
+	if err != nil {
+		return fmt.Errorf("failed to create embedding service: %w", err)
 	}
 
-	fmt.Printf("Document '%s' embedded and stored successfully.\n", id)
-	fmt.Printf("Vector dimension: %d\n", len(doc.Vector))
-	fmt.Printf("Content type: %s\n", doc.ContentType)
-	fmt.Printf("Metadata stored at: %s\n", metadataPath)
+	bar := progress.NewBar(app.progress, "embed", 0)
+	stats, err := service.EmbedDir(app.store, app.docsDir(), root, &embedding.DirOptions{
+		Glob:        *glob,
+		ChunkSize:   *chunk,
+		Concurrency: *concurrency,
+		Force:       *force,
+		Route:       app.models.Router(defaultCollection),
+		Binary:      app.binaryProcessor(),
+		Progress: func(stats *embedding.DirStats) {
+			bar.SetTotal(stats.Files)
+			bar.Set(stats.Done)
+		},
+	})
+	bar.Finish()
+	if err != nil {
+		return err
+	}
 
+	for _, err := range stats.Errors {
+		app.printf("Failed: %v\n", err)
+	}
+	app.printf("Processed %d files from %s: %d chunks, %d embedded, %d unchanged, %d stale removed, %d skipped, %d failed\n",
+		stats.Files, root, stats.Chunks, stats.Embedded, stats.Unchanged, stats.Removed, stats.Skipped, len(stats.Errors))
+	if len(stats.Errors) > 0 {
+		return fmt.Errorf("%d of %d files failed", len(stats.Errors), stats.Files)
+	}
 	return nil
-} 
\ No newline at end of file
+}
+
+// parsePathArgs parses the flags of a command that takes a path, which may
+// come before or after them, and returns the path and any further arguments
+func parsePathArgs(fs *flag.FlagSet, args []string, usage string) (string, []string, error) {
+	var root string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		root, args = args[0], args[1:]
+	}
+	rest, err := parseArgs(fs, args, 0, usage)
+	if err != nil {
+		return "", nil, err
+	}
+	if root == "" {
+		if len(rest) == 0 {
+			return "", nil, fmt.Errorf("usage: %s", usage)
+		}
+		root, rest = rest[0], rest[1:]
+	}
+	return root, rest, nil
+}
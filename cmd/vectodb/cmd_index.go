@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/bundle"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/quantized"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// indexRebuildUsage is the usage of the index rebuild subcommand
+	indexRebuildUsage = "index rebuild [-type hnsw] -collection <c> [-m 16] [-m0 32] [-ef-construction 200] [-ef-search 50] [-server URL]"
+
+	// indexStatsUsage is the usage of the index stats subcommand
+	indexStatsUsage = "index stats -collection <c> [-server URL]"
+
+	// indexBundleUsage is the usage of the index bundle subcommand
+	indexBundleUsage = "index bundle [-type hnsw] -collection <c> -o <file>"
+
+	// indexInspectUsage is the usage of the index inspect subcommand
+	indexInspectUsage = "index inspect <file>"
+
+	// indexUpgradeUsage is the usage of the index upgrade subcommand
+	indexUpgradeUsage = "index upgrade [-type flat|hnsw|quantized|tiered|matryoshka] <file>"
+)
+
+// HandleIndexCommand rebuilds search indexes and reports HNSW graph
+// statistics. With -server it works on the indexes of a running server. It
+// also examines saved index files, rewrites them in the current format and
+// packs an index with its vectors into a bundle for serve -bundle.
+// Usage:
+//   ./vectodb index rebuild -type hnsw -collection docs
+//   ./vectodb index rebuild -type hnsw -collection docs -m 32 -server http://localhost:8080
+//   ./vectodb index stats -collection docs
+//   ./vectodb index inspect data/indexes/docs-euclidean-hnsw.idx
+//   ./vectodb index upgrade -type hnsw data/indexes/docs-euclidean-hnsw.idx
+//   ./vectodb index bundle -type hnsw -collection docs -o docs.vdb
+func HandleIndexCommand(args []string, app *App) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "rebuild":
+			return indexRebuild(args[1:], app)
+		case "stats":
+			return indexStats(args[1:], app)
+		case "inspect":
+			return indexInspect(args[1:], app)
+		case "upgrade":
+			return indexUpgrade(args[1:], app)
+		case "bundle":
+			return indexBundle(args[1:], app)
+		}
+	}
+	return fmt.Errorf("usage: %s\n       %s\n       %s\n       %s\n       %s", indexRebuildUsage, indexStatsUsage, indexInspectUsage, indexUpgradeUsage, indexBundleUsage)
+}
+
+// indexRebuild rebuilds a search index. Queries keep using the current
+// index until the new one is built and swapped in. Without -server the index
+// is rebuilt from the local store and saved in the data directory for later
+// queries.
+func indexRebuild(args []string, app *App) error {
+	fs := flag.NewFlagSet("index rebuild", flag.ContinueOnError)
+	indexType := fs.String("type", string(app.indexType), "Index type (flat, hnsw, tiered)")
+	collection := fs.String("collection", "", "Collection whose index is rebuilt")
+	m := fs.Int("m", 0, "HNSW links per node (0 for the configured value)")
+	m0 := fs.Int("m0", 0, "HNSW links per node at level 0 (0 for twice -m)")
+	efConstruction := fs.Int("ef-construction", 0, "HNSW candidate list size while building (0 for the configured value)")
+	efSearch := fs.Int("ef-search", 0, "HNSW candidate list size while searching (0 for the default)")
+	server := fs.String("server", "", "Rebuild the index of a running server at this URL")
+	if _, err := parseArgs(fs, args, 0, indexRebuildUsage); err != nil {
+		return err
+	}
+	if *collection == "" {
+		return fmt.Errorf("usage: %s", indexRebuildUsage)
+	}
+
+	idxType, err := parseIndexType(*indexType)
+	if err != nil {
+		return err
+	}
+
+	if *server != "" {
+		return rebuildServerIndex(app, *server, map[string]interface{}{
+			"collection":      *collection,
+			"type":            idxType,
+			"m":               *m,
+			"m0":              *m0,
+			"ef_construction": *efConstruction,
+			"ef_search":       *efSearch,
+			"wait":            true,
+		})
+	}
+
+	opts := executor.RebuildOptions{Collection: *collection, IndexType: idxType, HNSW: app.hnsw}
+	if *m > 0 || *m0 > 0 || *efConstruction > 0 || *efSearch > 0 {
+		cfg := hnsw.DefaultHNSWConfig()
+		if app.hnsw != nil {
+			cfg = *app.hnsw
+		}
+		m0 := firstPositive(*m0, cfg.M0)
+		cfg = hnsw.NewHNSWConfig(firstPositive(*m, cfg.M), firstPositive(*efConstruction, cfg.EfConstruction), firstPositive(*efSearch, cfg.EfSearch))
+		cfg.M0 = m0
+		opts.HNSW = &cfg
+	}
+
+	info, err := app.newSQLService().RebuildIndex(opts)
+	if err != nil {
+		return err
+	}
+	printIndexInfo(app, info)
+	return nil
+}
+
+// rebuildServerIndex asks a running server to rebuild an index and waits
+// for the swap
+func rebuildServerIndex(app *App, server string, body map[string]interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(strings.TrimRight(server, "/")+"/indexes/rebuild", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("server rebuild failed (%s): %s", resp.Status, failure.Error)
+	}
+
+	var info executor.IndexInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return fmt.Errorf("failed to read server response: %w", err)
+	}
+	printIndexInfo(app, &info)
+	return nil
+}
+
+// indexStats prints the graph statistics of a collection's HNSW index
+func indexStats(args []string, app *App) error {
+	fs := flag.NewFlagSet("index stats", flag.ContinueOnError)
+	collection := fs.String("collection", "", "Collection whose HNSW index is examined")
+	server := fs.String("server", "", "Examine the index of a running server at this URL")
+	if _, err := parseArgs(fs, args, 0, indexStatsUsage); err != nil {
+		return err
+	}
+	if *collection == "" {
+		return fmt.Errorf("usage: %s", indexStatsUsage)
+	}
+
+	if *server == "" {
+		stats, err := app.newSQLService().IndexStats(*collection)
+		if err != nil {
+			return err
+		}
+		printGraphStats(app, *collection, stats)
+		return nil
+	}
+
+	resp, err := http.Get(strings.TrimRight(*server, "/") + "/indexes/stats?collection=" + url.QueryEscape(*collection))
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("server stats failed (%s): %s", resp.Status, failure.Error)
+	}
+
+	var stats hnsw.GraphStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return fmt.Errorf("failed to read server response: %w", err)
+	}
+	printGraphStats(app, *collection, &stats)
+	return nil
+}
+
+// indexInspect prints the header of an index file and whether its payload
+// matches the checksum
+func indexInspect(args []string, app *App) error {
+	fs := flag.NewFlagSet("index inspect", flag.ContinueOnError)
+	rest, err := parseArgs(fs, args, 1, indexInspectUsage)
+	if err != nil {
+		return err
+	}
+
+	header, err := index.InspectFile(rest[0])
+	if errors.Is(err, index.ErrNotIndexFile) {
+		app.printf("%s: legacy index file without a header (format 0)\n", rest[0])
+		app.printf("Rewrite it in the current format with: vectodb %s\n", indexUpgradeUsage)
+		return nil
+	}
+	if header == nil {
+		return err
+	}
+
+	app.printf("File:            %s\n", rest[0])
+	app.printf("Format version:  %d\n", header.Version)
+	app.printf("Index type:      %s\n", header.Kind)
+	app.printf("Payload version: %d\n", header.PayloadVersion)
+	app.printf("Metric:          %s\n", header.Metric)
+	app.printf("Vectors:         %d\n", header.Vectors)
+	app.printf("Dimension:       %d\n", header.Dimension)
+	app.printf("Payload size:    %d bytes\n", header.PayloadSize)
+	if err != nil {
+		app.printf("Checksum:        %08x (FAILED)\n", header.Checksum)
+		return err
+	}
+	app.printf("Checksum:        %08x (OK)\n", header.Checksum)
+	return nil
+}
+
+// indexUpgrade loads an index file of any supported version and saves it
+// again in the current format. Legacy files do not say what they hold, so
+// -type is required for them.
+func indexUpgrade(args []string, app *App) error {
+	fs := flag.NewFlagSet("index upgrade", flag.ContinueOnError)
+	kind := fs.String("type", "", "Index type of the file (read from the header of versioned files)")
+	rest, err := parseArgs(fs, args, 1, indexUpgradeUsage)
+	if err != nil {
+		return err
+	}
+	path := rest[0]
+
+	from := 0
+	header, err := index.InspectFile(path)
+	switch {
+	case errors.Is(err, index.ErrNotIndexFile):
+		if *kind == "" {
+			return fmt.Errorf("%s is a legacy index file; give its type with -type", path)
+		}
+	case err != nil:
+		return err
+	default:
+		from = int(header.Version)
+		if *kind != "" && *kind != header.Kind {
+			return fmt.Errorf("%w: %s holds a %s index, not %s", index.ErrFileKind, path, header.Kind, *kind)
+		}
+		*kind = header.Kind
+	}
+
+	// Indexes take their metric from the file, but legacy matryoshka files
+	// do not record it
+	var metric distance.Metric
+	if header == nil && *kind == "matryoshka" {
+		metric = app.metric
+	}
+	idx, err := newFileIndex(*kind, metric)
+	if err != nil {
+		return err
+	}
+	if err := idx.Load(path); err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if err := idx.Save(path); err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	app.printf("Upgraded %s index %s from format %d to %d (%d vectors)\n", *kind, path, from, index.FileVersion, idx.Size())
+	return nil
+}
+
+// newFileIndex returns an empty index of a kind saved in index files
+func newFileIndex(kind string, metric distance.Metric) (index.Index, error) {
+	switch kind {
+	case "flat":
+		return flat.NewFlatIndex(metric), nil
+	case "hnsw":
+		return hnsw.NewHNSWIndex(metric, nil), nil
+	case "quantized":
+		return quantized.NewQuantizedIndex(metric), nil
+	case "tiered":
+		return tiered.NewIndex(nil, metric, nil), nil
+	case "matryoshka":
+		return matryoshka.NewIndex(flat.NewFlatIndex(metric), metric, nil)
+	default:
+		return nil, fmt.Errorf("unknown index file type %q (flat, hnsw, quantized, tiered, matryoshka)", kind)
+	}
+}
+
+// indexBundle builds or loads a collection's search index and writes it to
+// a single file together with the vectors of the store, which serve -bundle
+// serves without rebuilding the index
+func indexBundle(args []string, app *App) error {
+	fs := flag.NewFlagSet("index bundle", flag.ContinueOnError)
+	indexType := fs.String("type", string(app.indexType), "Index type (flat, hnsw, tiered)")
+	collection := fs.String("collection", "", "Collection whose index is bundled")
+	output := fs.String("o", "", "Bundle file to write")
+	if _, err := parseArgs(fs, args, 0, indexBundleUsage); err != nil {
+		return err
+	}
+	if *collection == "" || *output == "" {
+		return fmt.Errorf("usage: %s", indexBundleUsage)
+	}
+	idxType, err := parseIndexType(*indexType)
+	if err != nil {
+		return err
+	}
+
+	idx, err := app.newSQLService().SearchIndex(executor.RebuildOptions{Collection: *collection, IndexType: idxType})
+	if err != nil {
+		return err
+	}
+	vectors, err := storeVectors(app.store)
+	if err != nil {
+		return err
+	}
+	manifest, err := bundle.Create(*output, *collection, string(idxType), idx, vectors)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+	app.printf("Bundled %s index of %s (%s) with %d vectors of dimension %d in %s\n",
+		manifest.IndexType, manifest.Collection, manifest.Metric, manifest.Vectors, manifest.Dimension, *output)
+	return nil
+}
+
+// storeVectors reads every vector of the store in ID order
+func storeVectors(store storage.VectorStore) ([]*vector.Vector, error) {
+	ids, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+
+	vectors := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		vec, err := store.Get(id)
+		if err != nil {
+			return nil, vectorError(id, err)
+		}
+		vectors = append(vectors, vec)
+	}
+	return vectors, nil
+}
+
+// printGraphStats prints graph statistics and flags signs of poor recall
+func printGraphStats(app *App, collection string, stats *hnsw.GraphStats) {
+	app.printf("HNSW index of %s: %d nodes (%d deleted), entry point %s at level %d\n",
+		collection, stats.Nodes, stats.Deleted, stats.EntryPoint, stats.MaxLevel)
+	app.printf("%-6s %8s %8s %10s %10s %10s\n", "Level", "Nodes", "Top", "Avg links", "Max links", "Limit")
+	for _, level := range stats.Levels {
+		app.printf("%-6d %8d %8d %10.2f %10d %10d\n", level.Level, level.Nodes, level.Top, level.AvgDegree, level.MaxDegree, level.MaxLinks)
+	}
+	app.printf("Connected components at level 0: %d\n", stats.Components)
+	app.printf("Nodes unreachable from the entry point: %d\n", stats.Unreachable)
+	if stats.Components > 1 || stats.Unreachable > 0 {
+		app.printf("Searches cannot find unreachable nodes; a rebuild with a higher -m, -m0 or -ef-construction may help\n")
+	}
+	if p := stats.Paging; p != nil {
+		app.printf("Level-0 links paged from disk: %d of %d blocks cached (limit %d), %d hits, %d reads\n", p.CachedBlocks, p.Blocks, p.CacheSize, p.Hits, p.Misses)
+	}
+}
+
+// printIndexInfo reports a rebuilt index
+func printIndexInfo(app *App, info *executor.IndexInfo) {
+	app.printf("Rebuilt %s index of %s (%s) over %d vectors\n", info.Type, info.Collection, info.Metric, info.Vectors)
+}
+
+// firstPositive returns a if it is positive and b otherwise
+func firstPositive(a, b int) int {
+	if a > 0 {
+		return a
+	}
+	return b
+}
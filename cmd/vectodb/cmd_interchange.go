@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/interchange"
+	"github.com/ken/vector_database/pkg/progress"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// HandleImportCommand processes the import command
+// Usage:
+//   ./vectodb import [-format arrow|parquet] [-on-conflict policy] [-restart] [-dry-run] <file>
+//   ./vectodb import -from qdrant|chroma|pgvector [-vector name] [-columns id,embedding,...] [-on-conflict policy] [-restart] [-dry-run] <file>
+//
+// The format is detected from the file extension unless given. Vectors whose
+// IDs already exist are overwritten, or with -on-conflict skipped, renamed
+// with a -N suffix, or reported as an error that stops the import. Progress is checkpointed after every
+// batch, so running an interrupted import again continues where it stopped.
+// A dry run only counts the vectors that would be inserted or updated.
+func HandleImportCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	formatName := fs.String("format", "", "File format (arrow, parquet); detected from the extension by default")
+	from := fs.String("from", "", "Import the export of another vector database (qdrant, chroma, pgvector)")
+	vectorName := fs.String("vector", "", "Named vector to import from Qdrant points")
+	columns := fs.String("columns", "", "Comma-separated columns of pgvector COPY output (default id,embedding,metadata)")
+	restart := fs.Bool("restart", false, "Ignore the checkpoint of an interrupted import and start over")
+	dryRun := fs.Bool("dry-run", false, "Report how many vectors would be imported without modifying the store")
+	onConflict := fs.String("on-conflict", "overwrite", "What to do with vectors whose ID exists: overwrite, skip, rename or fail")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: import [-format arrow|parquet] [-from qdrant|chroma|pgvector] [-on-conflict overwrite|skip|rename|fail] [-restart] [-dry-run] <file>")
+	}
+	path := fs.Arg(0)
+	policy, err := interchange.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	// Resume an interrupted import of the same, unchanged file
+	checkpointPath := app.checkpointPath("import", path)
+	checkpoint, err := progress.NewCheckpoint("import", path)
+	if err != nil {
+		return err
+	}
+	if !*restart {
+		saved, err := progress.Resume(checkpointPath, checkpoint)
+		switch {
+		case errors.Is(err, progress.ErrSourceChanged):
+			app.logger.Printf("Starting %s from the beginning: %v", path, err)
+		case err != nil:
+			return err
+		default:
+			checkpoint = saved
+		}
+	}
+	if checkpoint.Position > 0 {
+		app.printf("Resuming after row %d of %s (use -restart to start over)\n", checkpoint.Position, path)
+	}
+
+	bar := progress.NewBar(app.progress, "import", 0)
+	bar.Resume(checkpoint.Position)
+	importOpts := interchange.ImportOptions{
+		Skip:       checkpoint.Position,
+		DryRun:     *dryRun,
+		OnConflict: policy,
+		Progress: func(stats *interchange.ImportStats) {
+			bar.Set(stats.Rows())
+			if *dryRun {
+				return
+			}
+			checkpoint.Position = stats.Rows()
+			if err := checkpoint.Save(checkpointPath); err != nil {
+				app.logger.Printf("Failed to save checkpoint: %v", err)
+			}
+		},
+	}
+
+	var stats *interchange.ImportStats
+	if *from != "" {
+		var source interchange.Source
+		if source, err = interchange.ParseSource(*from); err != nil {
+			return err
+		}
+
+		opts := interchange.DefaultCompatOptions()
+		opts.ImportOptions = importOpts
+		opts.VectorName = *vectorName
+		if *columns != "" {
+			opts.Columns = strings.Split(*columns, ",")
+			for i := range opts.Columns {
+				opts.Columns[i] = strings.TrimSpace(opts.Columns[i])
+			}
+		}
+
+		app.printf("Importing %s export from %s...\n", source, path)
+		stats, err = interchange.ImportFrom(app.store, path, source, opts)
+	} else {
+		var format interchange.Format
+		if format, err = interchange.ParseFormat(*formatName, path); err != nil {
+			return err
+		}
+
+		app.printf("Importing vectors from %s (%s)...\n", path, format)
+		stats, err = interchange.Import(app.store, path, format, &importOpts)
+	}
+	bar.Finish()
+	if err != nil {
+		if checkpoint.Position > 0 && !*dryRun {
+			app.printf("Import stopped after row %d; run the command again to resume\n", checkpoint.Position)
+		}
+		return err
+	}
+
+	if *dryRun {
+		app.printf("Would import %d vectors (%d new, %d updated; dry run)\n", stats.Inserted+stats.Updated, stats.Inserted, stats.Updated)
+		printConflicts(app, stats)
+		return nil
+	}
+
+	if err := progress.RemoveCheckpoint(checkpointPath); err != nil {
+		return err
+	}
+
+	app.printf("Imported %d vectors (%d new, %d updated)\n", stats.Inserted+stats.Updated, stats.Inserted, stats.Updated)
+	printConflicts(app, stats)
+	if stats.Skipped > 0 {
+		app.printf("Skipped %d rows imported by the previous run\n", stats.Skipped)
+	}
+	return nil
+}
+
+// printConflicts reports the rows whose IDs were already in the store and
+// were not overwritten
+func printConflicts(app *App, stats *interchange.ImportStats) {
+	if stats.Duplicates > 0 {
+		app.printf("Skipped %d rows whose IDs already existed\n", stats.Duplicates)
+	}
+	if stats.Renamed > 0 {
+		app.printf("Renamed %d rows whose IDs already existed\n", stats.Renamed)
+	}
+}
+
+// HandleExportCommand processes the export command
+// Usage:
+//   ./vectodb export [-format arrow|parquet] [-since <time|token>] <file>
+func HandleExportCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := fs.String("format", "", "File format (arrow, parquet); detected from the extension by default")
+	since := fs.String("since", "", "Only export vectors written after this time or the token printed by the last export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("usage: export [-format arrow|parquet] [-since <time|token>] <file>")
+	}
+	path := fs.Arg(0)
+
+	format, err := interchange.ParseFormat(*formatName, path)
+	if err != nil {
+		return err
+	}
+
+	if *since == "" {
+		app.printf("Exporting vectors to %s (%s)...\n", path, format)
+		written, err := interchange.Export(app.store, path, format)
+		if err != nil {
+			return err
+		}
+
+		app.printf("Exported %d vectors\n", written)
+		return nil
+	}
+
+	cursor, err := storage.ParseChangeCursor(*since)
+	if err != nil {
+		return err
+	}
+	app.printf("Exporting vectors changed since %s to %s (%s)...\n", *since, path, format)
+	written, next, err := interchange.ExportChanges(app.store, path, format, cursor)
+	if err != nil {
+		return err
+	}
+
+	app.printf("Exported %d changed vectors\n", written)
+	app.printf("Next export: -since %s\n", next)
+	return nil
+}
+
+// HandleGenCommand processes the gen command
+// Usage:
+//   ./vectodb gen [-count 10k] [-dim 384] [-clusters 100] [-spread 0.5] [-seed N] [-prefix gen-] -out <file>
+//
+// The vectors are scattered around random cluster centers, like real
+// embeddings, and written one Qdrant point per line, so the corpus is loaded
+// with import -from qdrant. Each point's payload labels its cluster.
+func HandleGenCommand(args []string, app *App) error {
+	const usage = "gen [-count 10k] [-dim 384] [-clusters 100] [-spread 0.5] [-seed N] [-prefix gen-] -out <file>"
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	countFlag := fs.String("count", "10k", "Number of vectors, with an optional k or M suffix")
+	dim := fs.Int("dim", 384, "Dimension of the vectors")
+	clusters := fs.Int("clusters", 100, "Number of clusters")
+	spread := fs.Float64("spread", 0.5, "Standard deviation of the vectors around their cluster center")
+	seed := fs.Int64("seed", 0, "Seed for a reproducible corpus (default: random)")
+	prefix := fs.String("prefix", "gen-", "Prefix of the generated vector IDs")
+	out := fs.String("out", "", "File to write the corpus to, as JSON lines")
+	if _, err := parseArgs(fs, args, 0, usage); err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	count, err := parseCount(*countFlag)
+	if err != nil {
+		return err
+	}
+	seeded := false
+	fs.Visit(func(f *flag.Flag) { seeded = seeded || f.Name == "seed" })
+	if !seeded {
+		*seed = time.Now().UnixNano()
+	}
+	gen, err := vector.NewClusterGenerator(*dim, *clusters, *spread, *seed)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return fmt.Errorf("failed to create corpus file: %w", err)
+	}
+	w := bufio.NewWriterSize(f, 1<<20)
+
+	// Zero-padded IDs keep listings in generation order
+	format := fmt.Sprintf("%s%%0%dd", *prefix, len(strconv.Itoa(count-1)))
+	bar := progress.NewBar(app.progress, "gen", count)
+	var line []byte
+	for i := 0; i < count; i++ {
+		v, cluster := gen.Next(fmt.Sprintf(format, i))
+		line = appendPoint(line[:0], v, cluster)
+		if _, err := w.Write(line); err != nil {
+			bar.Finish()
+			f.Close()
+			return fmt.Errorf("failed to write corpus: %w", err)
+		}
+		bar.Add(1)
+	}
+	bar.Finish()
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write corpus: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write corpus: %w", err)
+	}
+
+	app.printf("Wrote %d vectors with dimension %d in %d clusters to %s (seed %d)\n", count, *dim, *clusters, *out, *seed)
+	app.printf("Load them with: vectodb import -from qdrant %s\n", *out)
+	return nil
+}
+
+// parseCount parses a positive count such as 5000, 10k or 1M
+func parseCount(s string) (int, error) {
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"), strings.HasSuffix(s, "K"):
+		multiplier = 1000
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		multiplier = 1000000
+	}
+	digits := s
+	if multiplier > 1 {
+		digits = s[:len(s)-1]
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count: %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// appendPoint appends v to buf as a line of a Qdrant JSON export, with the
+// cluster in the payload. The values are encoded without encoding/json,
+// which would make large corpora several times slower to write.
+func appendPoint(buf []byte, v *vector.Vector, cluster int) []byte {
+	id, _ := json.Marshal(v.ID)
+	buf = append(buf, `{"id":`...)
+	buf = append(buf, id...)
+	buf = append(buf, `,"vector":[`...)
+	for i, val := range v.Values {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendFloat(buf, float64(val), 'g', -1, 32)
+	}
+	buf = append(buf, `],"payload":{"cluster":`...)
+	buf = strconv.AppendInt(buf, int64(cluster), 10)
+	buf = append(buf, `,"label":"cluster-`...)
+	buf = strconv.AppendInt(buf, int64(cluster), 10)
+	buf = append(buf, "\"}}\n"...)
+	return buf
+}
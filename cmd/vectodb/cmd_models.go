@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ken/vector_database/internal/config"
+	"github.com/ken/vector_database/pkg/embedding"
+)
+
+// defaultCollection is the collection used by the embed and search-text commands
+const defaultCollection = "vectors"
+
+// modelsStatsUsage is the usage of the models stats subcommand
+const modelsStatsUsage = "models stats [-server URL]"
+
+// newModelRegistry builds the embedding model registry from the configuration
+func newModelRegistry(cfg *config.Config) (*embedding.Registry, error) {
+	registry := embedding.NewRegistry()
+
+	for name, model := range cfg.Embedding.Models {
+		err := registry.Register(name, embedding.ModelSpec{
+			Provider:  model.Provider,
+			Model:     model.Model,
+			MaxLength: model.MaxLength,
+			BatchSize: model.BatchSize,
+			Endpoint:  model.Endpoint,
+			APIKey:    model.APIKey,
+			Dimension: model.Dimension,
+
+			Concurrency:     model.Concurrency,
+			Truncation:      model.Truncation,
+			CostPer1KTokens: model.CostPer1KTokens,
+			Retry: embedding.RetryPolicy{
+				MaxRetries:       model.MaxRetries,
+				InitialBackoff:   model.RetryBackoff,
+				MaxBackoff:       model.MaxRetryBackoff,
+				Timeout:          model.Timeout,
+				BreakerThreshold: model.BreakerThreshold,
+				BreakerCooldown:  model.BreakerCooldown,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedding model %s: %w", name, err)
+		}
+	}
+
+	if cfg.Embedding.DefaultModel != "" {
+		if err := registry.SetDefault(cfg.Embedding.DefaultModel); err != nil {
+			return nil, fmt.Errorf("invalid default embedding model: %w", err)
+		}
+	}
+
+	for collection, model := range cfg.Embedding.Collections {
+		if err := registry.Bind(collection, model); err != nil {
+			return nil, fmt.Errorf("invalid model for collection %s: %w", collection, err)
+		}
+	}
+
+	for collection, routes := range cfg.Embedding.Routes {
+		for language, model := range routes {
+			if err := registry.Route(collection, language, model); err != nil {
+				return nil, fmt.Errorf("invalid %s route of collection %s: %w", language, collection, err)
+			}
+		}
+	}
+
+	return registry, nil
+}
+
+// bindCollectionModel sets a collection's model and persists it in the configuration file
+func bindCollectionModel(cfg *config.Config, configPath string, registry *embedding.Registry, collection, model string) error {
+	if err := registry.Bind(collection, model); err != nil {
+		return err
+	}
+
+	// Models registered on the fly must be saved too, or the binding would not load
+	if _, ok := cfg.Embedding.Models[model]; !ok {
+		spec, _ := registry.Spec(model)
+		if cfg.Embedding.Models == nil {
+			cfg.Embedding.Models = make(map[string]config.ModelConfig)
+		}
+		cfg.Embedding.Models[model] = config.ModelConfig{
+			Provider:  spec.Provider,
+			Model:     spec.Model,
+			MaxLength: spec.MaxLength,
+			BatchSize: spec.BatchSize,
+			Endpoint:  spec.Endpoint,
+			APIKey:    spec.APIKey,
+			Dimension: spec.Dimension,
+
+			Concurrency:      spec.Concurrency,
+			Truncation:       spec.Truncation,
+			CostPer1KTokens:  spec.CostPer1KTokens,
+			MaxRetries:       spec.Retry.MaxRetries,
+			RetryBackoff:     spec.Retry.InitialBackoff,
+			MaxRetryBackoff:  spec.Retry.MaxBackoff,
+			Timeout:          spec.Retry.Timeout,
+			BreakerThreshold: spec.Retry.BreakerThreshold,
+			BreakerCooldown:  spec.Retry.BreakerCooldown,
+		}
+	}
+
+	if cfg.Embedding.Collections == nil {
+		cfg.Embedding.Collections = make(map[string]string)
+	}
+	cfg.Embedding.Collections[collection] = model
+	return config.SaveConfig(cfg, configPath)
+}
+
+// HandleModelsCommand processes the models command
+// Usage:
+//   ./vectodb models
+//   ./vectodb models bind <collection> <model>
+//   ./vectodb models stats -server http://localhost:8080
+func HandleModelsCommand(args []string, app *App) error {
+	cfg, registry := app.cfg, app.models
+
+	if len(args) == 0 {
+		app.println("Embedding models:")
+		for _, name := range registry.Names() {
+			spec, _ := registry.Spec(name)
+			marker := " "
+			if name == registry.Default() {
+				marker = "*"
+			}
+			app.printf(" %s %-16s %s (%s)\n", marker, name, spec.Model, spec.Provider)
+		}
+
+		if len(cfg.Embedding.Collections) > 0 {
+			app.println("Collections:")
+			for collection, model := range cfg.Embedding.Collections {
+				app.printf("   %-16s %s\n", collection, model)
+			}
+		}
+
+		if len(cfg.Embedding.Routes) > 0 {
+			app.println("Language routes:")
+			for collection := range cfg.Embedding.Routes {
+				routes := registry.Routes(collection)
+				languages := make([]string, 0, len(routes))
+				for language := range routes {
+					languages = append(languages, language)
+				}
+				sort.Strings(languages)
+				for _, language := range languages {
+					app.printf("   %-16s %-4s %s\n", collection, language, routes[language])
+				}
+			}
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "bind":
+		if len(args) < 3 {
+			return fmt.Errorf("usage: models bind <collection> <model>")
+		}
+		if err := bindCollectionModel(cfg, app.configPath, registry, args[1], args[2]); err != nil {
+			return err
+		}
+
+		app.printf("Collection %s now uses model %s\n", args[1], args[2])
+		return nil
+	case "stats":
+		return modelStats(args[1:], app)
+	default:
+		return fmt.Errorf("unknown models subcommand: %s", args[0])
+	}
+}
+
+// modelStats prints the calls made to each embedding model by this process,
+// or by a running server with -server
+func modelStats(args []string, app *App) error {
+	fs := flag.NewFlagSet("models stats", flag.ContinueOnError)
+	server := fs.String("server", "", "Report the models of a running server at this URL")
+	if _, err := parseArgs(fs, args, 0, modelsStatsUsage); err != nil {
+		return err
+	}
+
+	if *server == "" {
+		printModelStats(app, app.models.Metrics().Snapshot())
+		return nil
+	}
+
+	resp, err := http.Get(strings.TrimRight(*server, "/") + "/models/stats")
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return fmt.Errorf("server stats failed (%s): %s", resp.Status, failure.Error)
+	}
+
+	var stats []embedding.ProviderStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return fmt.Errorf("failed to read server response: %w", err)
+	}
+	printModelStats(app, stats)
+	return nil
+}
+
+// printModelStats prints a table of embedding calls per model
+func printModelStats(app *App, stats []embedding.ProviderStats) {
+	if len(stats) == 0 {
+		app.println("No embedding calls made")
+		return
+	}
+	app.printf("%-12s %-40s %8s %8s %8s %10s %10s %12s\n", "Provider", "Model", "Calls", "Failed", "Retries", "Tokens", "Cost", "Avg latency")
+	for _, s := range stats {
+		app.printf("%-12s %-40s %8d %8d %8d %10d %10.4f %12s\n",
+			s.Provider, s.Model, s.Calls, s.Failures, s.Retries, s.Tokens, s.Cost, s.AvgLatency())
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/progress"
+)
+
+// HandleReembedCommand processes the reembed command
+// Usage:
+//   ./vectodb reembed -model <name> [-batch-size N] [-dry-run] [-every 1h]
+//
+// The model is a logical name from the registry or a provider model
+// identifier. After a successful run the collection is bound to the model.
+func HandleReembedCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("reembed", flag.ContinueOnError)
+	modelName := fs.String("model", "", "Target embedding model")
+	batchSize := fs.Int("batch-size", 64, "Number of vectors updated per batch")
+	dryRun := fs.Bool("dry-run", false, "Only report which vectors would be re-embedded")
+	every := fs.Duration("every", 0, "Repeat the job at this interval (e.g. 1h); 0 runs once")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *modelName == "" {
+		return fmt.Errorf("usage: reembed -model <name> [-batch-size N] [-dry-run] [-every 1h]")
+	}
+
+	// Unknown models are registered under their provider identifier
+	logical, err := app.models.Resolve(*modelName)
+	if err != nil {
+		if err := app.models.Register(*modelName, embedding.ModelSpec{Model: *modelName}); err != nil {
+			return err
+		}
+		logical = *modelName
+	}
+
+	service, err := app.models.Service(logical)
+	if err != nil {
+		return fmt.Errorf("failed to create embedding service: %w", err)
+	}
+
+	for {
+		app.printf("Re-embedding vectors with model %s...\n", service.ModelName())
+
+		// Vectors already embedded with the model are skipped, so an
+		// interrupted run resumes where it stopped when started again
+		bar := progress.NewBar(app.progress, "reembed", 0)
+		stats, err := service.Reembed(app.store, app.docsDir(), &embedding.ReembedOptions{
+			BatchSize: *batchSize,
+			DryRun:    *dryRun,
+			Progress: func(stats *embedding.ReembedStats) {
+				bar.SetTotal(stats.Total)
+				bar.Set(stats.Scanned)
+			},
+		})
+		bar.Finish()
+		if err != nil {
+			return err
+		}
+
+		verb := "Re-embedded"
+		if *dryRun {
+			verb = "Would re-embed"
+		}
+		app.printf("%s %d of %d vectors (%d already current, %d without source document)\n",
+			verb, stats.Reembedded, stats.Scanned, stats.Current, stats.Skipped)
+		printModelStats(app, app.models.Metrics().Snapshot())
+
+		// Queries against the collection must now use the new model
+		if !*dryRun && app.models.CollectionModel(defaultCollection) != logical {
+			if err := bindCollectionModel(app.cfg, app.configPath, app.models, defaultCollection, logical); err != nil {
+				return err
+			}
+			app.printf("Collection %s now uses model %s\n", defaultCollection, logical)
+		}
+
+		if *every <= 0 {
+			return nil
+		}
+		app.printf("Next run in %s\n", *every)
+		time.Sleep(*every)
+	}
+}
@@ -1,40 +1,165 @@
 package main
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
 	"github.com/ken/vector_database/pkg/embedding"
 	"github.com/ken/vector_database/pkg/sql/cli"
 	"github.com/ken/vector_database/pkg/sql/executor"
 	"github.com/ken/vector_database/pkg/storage"
+	"github.com/ken/vector_database/pkg/vectorstore"
 )
 
+// identifierPattern matches collection names and metadata keys that can be
+// used in generated SQL without quoting
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// metadataFilters collects repeated -filter key=value flags
+type metadataFilters map[string]string
+
+func (f metadataFilters) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f metadataFilters) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || !identifierPattern.MatchString(key) {
+		return fmt.Errorf("filter must be key=value with a simple key, got %q", s)
+	}
+	if strings.ContainsAny(value, `'\`) {
+		return fmt.Errorf("filter values cannot contain quotes or backslashes: %q", value)
+	}
+	f[key] = value
+	return nil
+}
+
+// searchHit is one search-text result
+type searchHit struct {
+	ID         string             `json:"id"`
+	Distance   float32            `json:"distance"`
+	Similarity float32            `json:"similarity"`
+	Highlight  *embedding.Snippet `json:"highlight,omitempty"`
+}
+
 // HandleSearchTextCommand processes the search-text command
-// This command embeds the provided text and searches for similar vectors
-func HandleSearchTextCommand(queryText string, metric distance.Metric, indexType string, verbose bool) error {
-	// Create embedding service
-	service, err := embedding.NewService(nil)
+// This command embeds the provided text, or image, and searches for similar vectors
+// Usage:
+//   ./vectodb search-text [-k 10] [-collection vectors] [-model name] [-filter key=value ...] [-min-similarity 0.5] [-group-by-parent] [-highlight] [-format table|json|csv] <text query>
+//   ./vectodb search-text [-k 10] [-collection vectors] [-model name] [-filter key=value ...] -image <image_path>
+func HandleSearchTextCommand(args []string, app *App) error {
+	filters := metadataFilters{}
+	fs := flag.NewFlagSet("search-text", flag.ContinueOnError)
+	k := fs.Int("k", 10, "Number of results")
+	collection := fs.String("collection", defaultCollection, "Collection to search; selects its embedding model")
+	model := fs.String("model", "", "Embed the query with this registered model instead of the collection's (must have its dimension)")
+	fs.Var(filters, "filter", "Metadata filter key=value (repeatable; all must match)")
+	minSimilarity := fs.Float64("min-similarity", 0, "Drop results below this similarity (cosine similarity, dot product, or 1/(1+distance))")
+	groupByParent := fs.Bool("group-by-parent", false, "Return only the nearest chunk of each document (by metadata."+embedding.MetadataKeyParent+")")
+	highlight := fs.Bool("highlight", false, "Show the snippet of each result's text that best matches the query")
+	snippetLength := fs.Int("snippet-length", embedding.DefaultSnippetLength, "Maximum length of the snippets shown by -highlight, in bytes")
+	format := fs.String("format", "table", "Output format: table, json or csv")
+	imagePath := fs.String("image", "", "Search with this image instead of a text (the collection's model must embed images)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	queryText := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if (queryText == "") == (*imagePath == "") {
+		return fmt.Errorf("usage: search-text [-k 10] [-collection vectors] [-model name] [-filter key=value] [-min-similarity 0.5] [-group-by-parent] [-highlight] [-format table|json|csv] <text query> | -image <path>")
+	}
+	if *imagePath != "" && *highlight {
+		return fmt.Errorf("-highlight needs a text query")
+	}
+	if *k <= 0 {
+		return fmt.Errorf("k must be positive, got %d", *k)
+	}
+	if !identifierPattern.MatchString(*collection) {
+		return fmt.Errorf("invalid collection name: %q", *collection)
+	}
+	switch *format {
+	case "table", "json", "csv":
+	default:
+		return fmt.Errorf("unsupported output format: %s (use table, json or csv)", *format)
+	}
+
+	// Only apply the similarity threshold when it was given explicitly
+	useMinSimilarity := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "min-similarity" {
+			useMinSimilarity = true
+		}
+	})
+
+	// Embed the query with the model the collection was built with, or the
+	// one it routes the query's language to, and only compare it with the
+	// documents embedded alike. Images have no language. A model given with
+	// -model is compared with all documents.
+	var service *embedding.Service
+	var language string
+	var override bool
+	var err error
+	switch {
+	case *model != "":
+		service, override, err = app.models.ServiceForQuery(*collection, *model)
+	case *imagePath != "":
+		service, err = app.models.ServiceForCollection(*collection, "")
+	default:
+		service, language, err = app.models.ServiceForText(*collection, queryText)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create embedding service: %w", err)
 	}
-	defer service.Close()
+	var routeFilter map[string]string
+	if !override {
+		routeFilter = app.models.RouteFilter(*collection, service, language)
+	}
+	for key, value := range routeFilter {
+		if _, ok := filters[key]; !ok {
+			filters[key] = value
+		}
+	}
 
 	// Create a temporary document to get the embedding
 	doc := embedding.NewTextDocument("_query_", queryText)
+	if *imagePath != "" {
+		data, err := os.ReadFile(*imagePath)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+		doc = embedding.NewImageDocument("_query_", *imagePath, data)
+	}
 	if err := service.ProcessDocument(doc); err != nil {
-		return fmt.Errorf("failed to embed query text: %w", err)
+		return fmt.Errorf("failed to embed query: %w", err)
 	}
 
 	// Check vector dimensions
 	if len(doc.Vector) == 0 {
 		return fmt.Errorf("failed to generate vector embedding: empty vector")
 	}
-	
-	if verbose {
-		fmt.Printf("Generated embedding with dimension: %d\n", len(doc.Vector))
+
+	if app.verbose {
+		app.printf("Generated embedding with dimension: %d\n", len(doc.Vector))
+		if language != "" {
+			app.printf("Query language: %s (model %s)\n", language, service.ModelName())
+		}
 	}
-	
+
 	// Convert the vector to a string representation for the SQL query
 	vectorStr := "["
 	for i, val := range doc.Vector {
@@ -45,74 +170,178 @@ func HandleSearchTextCommand(queryText string, metric distance.Metric, indexType
 	}
 	vectorStr += "]"
 
-	// Construct SQL query
-	sqlQuery := fmt.Sprintf("SELECT id, distance FROM vectors NEAREST TO %s USING %s LIMIT 10", 
-		vectorStr, metric.Name())
+	// Construct SQL query; filters are applied before the LIMIT
+	sqlQuery := fmt.Sprintf("SELECT id, distance FROM %s NEAREST TO %s USING %s", *collection, vectorStr, app.metric.Name())
+	if len(filters) > 0 {
+		keys := make([]string, 0, len(filters))
+		for key := range filters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
 
-	if verbose {
-		fmt.Printf("Generated SQL query:\n%s\n\n", sqlQuery)
+		conditions := make([]string, len(keys))
+		for i, key := range keys {
+			conditions[i] = fmt.Sprintf("metadata.%s = '%s'", key, filters[key])
+		}
+		sqlQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if *groupByParent {
+		sqlQuery += " GROUP BY metadata." + embedding.MetadataKeyParent
 	}
+	sqlQuery += fmt.Sprintf(" LIMIT %d", *k)
 
-	// Create storage
-	store, err := storage.NewFileStore("data")
-	if err != nil {
-		return fmt.Errorf("failed to create storage: %w", err)
+	if app.verbose {
+		app.printf("Generated SQL query:\n%s\n\n", sqlQuery)
 	}
 
 	// Check if the database has any vectors
-	count, err := store.Count()
+	count, err := app.store.Count()
 	if err != nil {
 		return fmt.Errorf("failed to count vectors: %w", err)
 	}
-	
+
 	if count == 0 {
 		return fmt.Errorf("no vectors found in the database")
 	}
-	
+
 	// Get any vector from the database to check dimensions
-	ids, err := store.List()
+	ids, err := app.store.List()
 	if err != nil {
 		return fmt.Errorf("failed to list vectors: %w", err)
 	}
-	
-	if len(ids) > 0 {
-		sampleVec, err := store.Get(ids[0])
-		if err == nil && sampleVec.Dimension != len(doc.Vector) {
-			return fmt.Errorf("dimension mismatch: query vector has dimension %d, but database vectors have dimension %d", 
-				len(doc.Vector), sampleVec.Dimension)
+
+	// The first vector may be from another route's model
+	if len(ids) > 0 && routeFilter == nil {
+		// Compare against the query as it will be projected by the adapter
+		queryVec := vector.NewVector("query", doc.Vector)
+		if app.adapter != nil {
+			if queryVec, err = app.adapter.Adapt(queryVec); err != nil {
+				return err
+			}
 		}
-	}
 
-	// Convert index type string to executor.IndexType
-	var idxType executor.IndexType
-	switch indexType {
-	case "flat":
-		idxType = executor.IndexTypeFlat
-	case "hnsw":
-		idxType = executor.IndexTypeHNSW
-	default:
-		return fmt.Errorf("unsupported index type: %s", indexType)
+		sampleVec, err := app.store.Get(ids[0])
+		if err == nil && sampleVec.Dimension != queryVec.Dimension {
+			return fmt.Errorf("dimension mismatch: query vector has dimension %d, but database vectors have dimension %d",
+				queryVec.Dimension, sampleVec.Dimension)
+		}
+		if err == nil && !override {
+			if err := app.models.CheckVector(*collection, sampleVec); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Create SQL service
-	sqlService := cli.NewSQLService(store, idxType, metric)
-	sqlService.SetVerbose(verbose)
-	
+	sqlService := app.newSQLService()
+
 	// Execute SQL query
-	result, err := sqlService.Execute(sqlQuery)
+	result, err := sqlService.Query(sqlQuery)
 	if err != nil {
 		return err
 	}
-	
-	if result == "0 row(s) returned" && verbose {
-		fmt.Println("No similar vectors found. This could be due to:")
-		fmt.Println("1. No semantically similar vectors in the database")
-		fmt.Println("2. Embedding model mismatch between stored vectors and query")
-		fmt.Println("3. Threshold settings filtering out potential matches")
-	}
-	
-	// Print result
-	fmt.Println(result)
-	
-	return nil
-} 
\ No newline at end of file
+
+	hits := make([]searchHit, 0, len(result.Rows))
+	for _, row := range result.Rows {
+		if len(row) < 2 {
+			continue
+		}
+		id, _ := row[0].(string)
+		dist, ok := row[1].(float32)
+		if !ok {
+			continue
+		}
+
+		similarity := distance.Similarity(app.metric.Name(), dist)
+		if useMinSimilarity && float64(similarity) < *minSimilarity {
+			continue
+		}
+		hit := searchHit{ID: id, Distance: dist, Similarity: similarity}
+		if *highlight {
+			if text := hitText(app, id); text != "" {
+				hit.Highlight = embedding.Highlight(text, queryText, *snippetLength, app.analyzers.For(*collection))
+			}
+		}
+		hits = append(hits, hit)
+	}
+
+	if len(hits) == 0 && app.verbose {
+		app.println("No similar vectors found. This could be due to:")
+		app.println("1. No semantically similar vectors in the database")
+		app.println("2. Embedding model mismatch between stored vectors and query")
+		app.println("3. Filters or the similarity threshold excluding potential matches")
+	}
+
+	return printSearchHits(app.out, hits, *format, *highlight)
+}
+
+// hitText returns the text a search result was embedded from: its document
+// in the doc store, or the text stored in its metadata through /texts
+func hitText(app *App, id string) string {
+	if doc, err := embedding.LoadDocument(app.docsDir(), id); err == nil {
+		return doc.Text()
+	}
+	if v, err := storage.GetMeta(app.store, id); err == nil {
+		return v.Metadata[vectorstore.DefaultTextKey]
+	}
+	return ""
+}
+
+// snippet returns the highlighted snippet of a hit for tables and CSV, with
+// its matches in **bold**
+func (h searchHit) snippet() string {
+	if h.Highlight == nil {
+		return ""
+	}
+	return strings.ReplaceAll(h.Highlight.Marked("**", "**"), "\n", " ")
+}
+
+// printSearchHits writes search-text results in the requested format
+func printSearchHits(w io.Writer, hits []searchHit, format string, highlight bool) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(hits)
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := []string{"id", "distance", "similarity"}
+		if highlight {
+			header = append(header, "snippet")
+		}
+		cw.Write(header)
+		for _, hit := range hits {
+			record := []string{
+				hit.ID,
+				strconv.FormatFloat(float64(hit.Distance), 'f', -1, 32),
+				strconv.FormatFloat(float64(hit.Similarity), 'f', -1, 32),
+			}
+			if highlight {
+				record = append(record, hit.snippet())
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		result := &executor.ResultSet{
+			Columns: []executor.Column{
+				{Name: "id", Type: "string"},
+				{Name: "distance", Type: "float"},
+				{Name: "similarity", Type: "float"},
+			},
+		}
+		if highlight {
+			result.Columns = append(result.Columns, executor.Column{Name: "snippet", Type: "string"})
+		}
+		for _, hit := range hits {
+			row := executor.Row{hit.ID, hit.Distance, hit.Similarity}
+			if highlight {
+				row = append(row, hit.snippet())
+			}
+			result.Rows = append(result.Rows, row)
+		}
+		fmt.Fprintln(w, cli.FormatResult(result))
+		return nil
+	}
+}
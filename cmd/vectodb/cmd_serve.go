@@ -0,0 +1,311 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/ken/vector_database/internal/concurrency"
+	"github.com/ken/vector_database/internal/config"
+	"github.com/ken/vector_database/pkg/api"
+	"github.com/ken/vector_database/pkg/bundle"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/drift"
+	"github.com/ken/vector_database/pkg/profiling"
+	"github.com/ken/vector_database/pkg/snapshot"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// HandleServeCommand starts the HTTP API server
+// Usage:
+//   ./vectodb serve [-read-only] [-snapshot <dir> | -bundle <file>]
+//
+// A read-only server rejects writes, as does one over a snapshot or an index
+// bundle, which are loaded into memory and never written to.
+func HandleServeCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	readOnly := fs.Bool("read-only", false, "Reject every write (implied by storage.read_only)")
+	snapshotDir := fs.String("snapshot", "", "Serve the snapshot in this directory, read-only, instead of the store")
+	bundlePath := fs.String("bundle", "", "Serve the index bundle in this file, read-only, instead of the store")
+	if _, err := parseArgs(fs, args, 0, "serve [-read-only] [-snapshot <dir> | -bundle <file>]"); err != nil {
+		return err
+	}
+	if *snapshotDir != "" && *bundlePath != "" {
+		return fmt.Errorf("serve takes -snapshot or -bundle, not both")
+	}
+	standalone := *snapshotDir != "" || *bundlePath != ""
+
+	server, err := newServeServer(app, *readOnly, *snapshotDir, *bundlePath)
+	if err != nil {
+		return err
+	}
+	var handler interface{ ListenAndServe(string) error } = server
+	if len(app.cfg.Server.Tenants) > 0 && !standalone {
+		router, err := newTenantRouter(app, server)
+		if err != nil {
+			return err
+		}
+		defer router.Close()
+		handler = router
+	}
+	addr := fmt.Sprintf("%s:%d", app.cfg.Server.Host, app.cfg.Server.Port)
+
+	if debug := app.cfg.Server.Debug; debug.ProfileDir != "" {
+		profiler, err := profiling.Start(profiling.Options{
+			Dir:      debug.ProfileDir,
+			Interval: debug.ProfileInterval,
+			Duration: debug.ProfileDuration,
+			Keep:     debug.ProfileKeep,
+		}, app.logger)
+		if err != nil {
+			return err
+		}
+		defer profiler.Stop()
+		app.printf("Writing CPU and heap profiles to %s\n", debug.ProfileDir)
+	}
+
+	app.printf("Starting VectoDB server on http://%s\n", addr)
+	app.printf("The admin UI is at http://%s/ui/\n", addr)
+	app.println("Change events are streamed at /events and changed vectors are listed at /changes")
+	app.println("Metrics are served at /metrics")
+	if app.cfg.Server.Drift.Enabled {
+		app.println("Written vectors are checked for embedding drift, reported at /metrics")
+	}
+	app.printf("Scans and index builds use up to %d goroutines\n", concurrency.MaxParallelism())
+	if app.cfg.Server.Debug.Pprof {
+		app.println("Profiles are served at /debug/pprof/")
+	}
+	app.println("Text retrieval for RAG frameworks is served at /texts and /texts/search")
+	if len(app.cfg.Server.Tenants) > 0 && !standalone {
+		app.printf("Serving %d tenants from %s\n", len(app.cfg.Server.Tenants), filepath.Join(app.cfg.Storage.DataDir, "tenants"))
+	}
+	if *snapshotDir != "" {
+		app.printf("Serving snapshot %s read-only\n", *snapshotDir)
+	} else if *bundlePath != "" {
+		app.printf("Serving bundle %s read-only\n", *bundlePath)
+	} else if *readOnly || app.cfg.Storage.ReadOnly {
+		app.println("Serving read-only: writes are rejected with 403")
+	}
+	if err := handler.ListenAndServe(addr); err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
+
+// newServeServer creates the server of the serve command: over the store of
+// the app, rejecting writes if readOnly, over the snapshot in snapshotDir or
+// over the bundle at bundlePath. A snapshot or bundle is served without
+// tenants, snapshots or persisted indexes, as nothing is written next to it.
+func newServeServer(app *App, readOnly bool, snapshotDir, bundlePath string) (*api.Server, error) {
+	if bundlePath != "" {
+		return newBundleServer(app, bundlePath)
+	}
+	if snapshotDir != "" {
+		store, manifest, err := snapshot.Load(snapshotDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load snapshot: %w", err)
+		}
+		app.printf("Loaded %d vectors of snapshot %d\n", manifest.Vectors, manifest.Epoch)
+		server := newAPIServer(app, store, "", executor.NewIndexCache(""), nil)
+		server.SetDocsDir(app.docsDir())
+		return server, nil
+	}
+
+	store := app.store
+	if readOnly {
+		store = storage.NewReadOnlyStore(store)
+		if app.indexes != nil {
+			app.indexes.SetReadOnly(true)
+		}
+	}
+	server := newAPIServer(app, store, app.snapshotDir(), app.indexes, app.results)
+	server.SetDocsDir(app.docsDir())
+	server.SetCatalog(app.catalog)
+	return server, nil
+}
+
+// newBundleServer creates a server over the vectors of a bundle whose
+// searches use the bundled index from the start
+func newBundleServer(app *App, path string) (*api.Server, error) {
+	b, err := bundle.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	store, err := b.Store()
+	if err != nil {
+		return nil, err
+	}
+	server := newAPIServer(app, store, "", executor.NewIndexCache(""), nil)
+	server.SetDocsDir(app.docsDir())
+
+	// Search the collection with the metric the index was built with
+	opts := executor.RebuildOptions{Collection: b.Collection, IndexType: executor.IndexType(b.IndexType)}
+	if b.Metric != "" {
+		if opts.Metric, err = distance.GetMetric(distance.MetricType(b.Metric)); err != nil {
+			return nil, err
+		}
+		server.SetCollectionMetric(b.Collection, opts.Metric)
+	}
+	info, err := server.InstallIndex(opts, b.LoadIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the index of bundle %s: %w", path, err)
+	}
+	app.printf("Loaded %s index of %s (%s) with %d vectors from bundle %s\n", info.Type, info.Collection, info.Metric, info.Vectors, path)
+	return server, nil
+}
+
+// newAPIServer creates an API server over store with the settings of the
+// configuration
+func newAPIServer(app *App, store storage.VectorStore, snapshotDir string, indexes *executor.IndexCache, results *executor.ResultCache) *api.Server {
+	server := api.NewServer(store, app.indexType, app.metric)
+	server.SetModelRegistry(app.models)
+	server.SetAnalyzers(app.analyzers)
+	server.SetVectorAdapter(app.adapter)
+	server.SetTruncation(app.truncation)
+	server.SetTwoStage(app.twoStage)
+	server.SetTiering(app.tiering)
+	server.SetHNSWConfig(app.hnsw)
+	for collection, metric := range app.metrics {
+		server.SetCollectionMetric(collection, metric)
+	}
+	server.SetAllowDestructive(app.cfg.Server.AllowDestructive)
+	server.SetLimits(api.Limits{
+		Rate:                 app.cfg.Server.RateLimit,
+		Burst:                app.cfg.Server.RateBurst,
+		KeyRate:              app.cfg.Server.KeyRateLimit,
+		KeyBurst:             app.cfg.Server.KeyRateBurst,
+		MaxConcurrentQueries: app.cfg.Server.MaxConcurrentQueries,
+	})
+	server.SetIngestQueue(app.cfg.Server.IngestQueueSize, app.cfg.Server.IngestWorkers)
+	server.SetPprof(app.cfg.Server.Debug.Pprof)
+	if app.audit != nil {
+		server.SetAuditLog(app.audit)
+	}
+	server.SetSnapshotDir(snapshotDir)
+	if indexes != nil {
+		server.SetIndexCache(indexes)
+	}
+	if results != nil {
+		server.SetResultCache(results)
+	}
+	if app.plans != nil {
+		server.SetPlanCache(app.plans)
+	}
+	if app.memory != nil {
+		server.SetMemoryAccountant(app.memory)
+	}
+	if cfg := app.cfg.Server.Drift; cfg.Enabled {
+		server.SetDriftMonitor(drift.Start(server.Store(), drift.Options{
+			Interval:   cfg.Interval,
+			MinVectors: cfg.MinVectors,
+			Sample:     cfg.Sample,
+			Threshold:  cfg.Threshold,
+		}, app.logger))
+	}
+	return server
+}
+
+// newTenantRouter routes requests to the servers of the configured tenants,
+// falling back to server for requests without a tenant
+func newTenantRouter(app *App, server *api.Server) (*api.TenantRouter, error) {
+	router := api.NewTenantRouter(server, func(tenant string) (*api.Server, error) {
+		return openTenantServer(app, tenant)
+	})
+	router.SetRequireTenant(app.cfg.Server.RequireTenant)
+
+	ids := make([]string, 0, len(app.cfg.Server.Tenants))
+	for id := range app.cfg.Server.Tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if _, err := storage.ParseEvictionPolicy(app.cfg.Server.Tenants[id].Policy); err != nil {
+			return nil, fmt.Errorf("invalid quota of tenant %s: %w", id, err)
+		}
+		tenant := api.Tenant{ID: id, APIKeys: app.cfg.Server.Tenants[id].APIKeys}
+		if err := router.AddTenant(tenant); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// tenantConfig returns the configuration of a tenant's store: the storage
+// of the deployment below <data_dir>/tenants/<id>, or below tenants/<id>/
+// of the bucket prefix
+func tenantConfig(cfg *config.Config, tenant string) *config.Config {
+	tc := *cfg
+	tc.Storage.DataDir = filepath.Join(cfg.Storage.DataDir, "tenants", tenant)
+	tc.Storage.SnapshotDir = filepath.Join(tc.Storage.DataDir, "snapshots")
+	tc.Storage.SQLite.Path = ""
+	tc.Storage.Bolt.Path = ""
+	tc.Storage.S3.CacheDir = ""
+	tc.Storage.S3.Prefix = path.Join(cfg.Storage.S3.Prefix, "tenants", tenant)
+	return &tc
+}
+
+// openTenantServer opens the store of a tenant, wrapped like the store of
+// the deployment and in the tenant's quota. Tenants get index and result
+// caches of their own, so nothing cached leaks between them.
+func openTenantServer(app *App, tenant string) (*api.Server, error) {
+	cfg := tenantConfig(app.cfg, tenant)
+	if err := os.MkdirAll(cfg.Storage.DataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory of tenant %s: %w", tenant, err)
+	}
+	store, err := openStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store of tenant %s: %w", tenant, err)
+	}
+	if app.adapter != nil {
+		store = storage.NewAdaptedStore(store, app.adapter)
+	}
+
+	var results *executor.ResultCache
+	if cfg.Storage.VectorCacheSize > 0 || cfg.Storage.QueryCacheSize > 0 {
+		store = storage.NewCachedStore(store, cfg.Storage.VectorCacheSize)
+	}
+	// Centroids are maintained below the quotas, which evict through them
+	store = storage.NewCentroidStore(store)
+	if cfg.Storage.AccessSampleRate > 0 {
+		store = storage.NewAccessStore(store, cfg.Storage.AccessSampleRate)
+	}
+	if cfg.Storage.QueryCacheSize > 0 {
+		results = executor.NewResultCache(cfg.Storage.QueryCacheSize)
+	}
+
+	limits := app.cfg.Server.Tenants[tenant]
+	policy, err := storage.ParseEvictionPolicy(limits.Policy)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("invalid quota of tenant %s: %w", tenant, err)
+	}
+	quota := storage.Quota{MaxVectors: limits.MaxVectors, MaxBytes: limits.MaxDiskMB << 20, Policy: policy}
+	dir := cfg.Storage.DataDir
+	store, err = withQuotas(store, cfg, quota, func() (int64, error) { return storage.DirSize(dir) })
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if store, err = withSchemas(store, cfg); err != nil {
+		store.Close()
+		return nil, err
+	}
+	store = withDimensions(store, cfg)
+	if store, err = withFinite(store, cfg); err != nil {
+		store.Close()
+		return nil, err
+	}
+	catalog, err := executor.OpenCatalog(catalogPath(cfg))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to open catalog of tenant %s: %w", tenant, err)
+	}
+	indexes := executor.NewIndexCache(filepath.Join(cfg.Storage.DataDir, "indexes"))
+	server := newAPIServer(app, store, cfg.Storage.SnapshotDir, indexes, results)
+	server.SetCatalog(catalog)
+	return server, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ken/vector_database/pkg/snapshot"
+)
+
+// HandleSnapshotCommand takes, lists, verifies and restores snapshots
+// Usage:
+//   ./vectodb snapshot create
+//   ./vectodb snapshot list
+//   ./vectodb snapshot verify <epoch>
+//   ./vectodb snapshot restore <epoch>
+func HandleSnapshotCommand(args []string, app *App) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: snapshot create|list|verify <epoch>|restore <epoch>")
+	}
+	root := app.snapshotDir()
+
+	switch args[0] {
+	case "create":
+		manifest, err := snapshot.Create(root, app.store, nil)
+		if err != nil {
+			return err
+		}
+		app.printf("Created snapshot %d with %d vectors in %s\n", manifest.Epoch, manifest.Vectors, manifest.Dir())
+		return nil
+	case "list":
+		manifests, err := snapshot.List(root)
+		if err != nil {
+			return err
+		}
+		if len(manifests) == 0 {
+			app.printf("No snapshots in %s\n", root)
+			return nil
+		}
+		for _, m := range manifests {
+			app.printf("%8d  %s  %d vectors, %d files\n", m.Epoch, m.CreatedAt.Local().Format(time.RFC3339), m.Vectors, len(m.Files))
+		}
+		return nil
+	case "verify", "restore":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: snapshot %s <epoch>", args[0])
+		}
+		epoch, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid epoch: %s", args[1])
+		}
+		dir := snapshot.Dir(root, epoch)
+
+		if args[0] == "verify" {
+			manifest, err := snapshot.Verify(dir)
+			if err != nil {
+				return err
+			}
+			app.printf("Snapshot %d is intact (%d vectors, %d files)\n", manifest.Epoch, manifest.Vectors, len(manifest.Files))
+			return nil
+		}
+
+		manifest, err := snapshot.Restore(dir, app.store, nil)
+		if err != nil {
+			return err
+		}
+		app.printf("Restored snapshot %d (%d vectors)\n", manifest.Epoch, manifest.Vectors)
+		return nil
+	default:
+		return fmt.Errorf("unknown snapshot subcommand: %s", args[0])
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/sql/cli"
+)
+
+// sqlExamples are printed when the sql command is run without a query
+var sqlExamples = []string{
+	"SELECT id, dimension FROM vectors LIMIT 5",
+	"SELECT id, dimension FROM vectors WHERE id LIKE 'test%'",
+	"SELECT id FROM vectors WHERE metadata.category = 'image'",
+	"SELECT id FROM vectors WHERE metadata.tags LIKE '%important%'",
+	"SELECT id, distance FROM vectors NEAREST TO [1.0,2.0,3.0] USING euclidean LIMIT 3",
+	"INSERT INTO vectors (id, vector) VALUES ('vec123', [1.0,2.0,3.0])",
+	"DELETE FROM vectors WHERE id = 'vec123'",
+	"DELETE FROM vectors WHERE metadata.category = 'draft' RETURNING COUNT",
+}
+
+// HandleSQLCommand executes a SQL query against the vector database
+// Usage:
+//   ./vectodb sql [-dry-run] [output flags] "<query>"
+//   ./vectodb sql -i [-dry-run] [output flags]
+//   ./vectodb sql -f <file> [-param name=value]... [-dry-run] [output flags]
+//
+// With -dry-run, INSERT, DELETE and DROP report what they would change
+// without modifying the store. With -i, statements are read from standard
+// input in one session, so USE and SET apply to the statements after them.
+// The shell keeps its history and saved queries in the data directory.
+// The output flags -format table|json, -precision N, -scientific and
+// -full-vectors control how results are printed. With -f, the statements of
+// a file are executed in order. Placeholders such as :k in the query are
+// replaced by the values of -param k=5; -param vec=@embedding.json reads a
+// vector from a JSON file.
+func HandleSQLCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("sql", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Report what INSERT, DELETE and DROP would change without modifying the store")
+	interactive := fs.Bool("i", false, "Start an interactive shell")
+	file := fs.String("f", "", "Execute the statements of a file")
+	params := cli.Params{}
+	fs.Var(params, "param", "Value of a :name placeholder as name=value or name=@file.json (repeatable)")
+	output := cli.DefaultFormatOptions()
+	fs.StringVar(&output.Format, "format", output.Format, "Output format: table or json")
+	fs.IntVar(&output.Precision, "precision", output.Precision, "Digits after the decimal point of floats (default: as few as read back the same)")
+	fs.BoolVar(&output.Scientific, "scientific", false, "Print floats in scientific notation")
+	fs.BoolVar(&output.FullVectors, "full-vectors", false, "Print every value of vectors instead of shortening them in tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	service := app.newSQLService()
+	service.SetDryRun(*dryRun)
+	if err := service.SetFormat(output); err != nil {
+		return err
+	}
+	if *interactive {
+		return runSQLShell(service, app)
+	}
+	if *file != "" {
+		return runSQLFile(service, app, *file, params)
+	}
+	if fs.NArg() < 1 {
+		var usage strings.Builder
+		usage.WriteString("usage: sql [-dry-run] [-format table|json] [-precision N] [-scientific] [-full-vectors] [-param name=value]... \"<query>\" | sql -f <file> [flags] | sql -i [-dry-run] [output flags]\nExamples:")
+		for _, example := range sqlExamples {
+			fmt.Fprintf(&usage, "\n  vectodb sql %q", example)
+		}
+		return fmt.Errorf("%s", usage.String())
+	}
+
+	query, err := cli.Substitute(fs.Arg(0), params)
+	if err != nil {
+		return err
+	}
+	result, err := service.Execute(query)
+	if err != nil {
+		return fmt.Errorf("SQL error: %w", err)
+	}
+
+	app.println(result)
+	return nil
+}
+
+// runSQLFile executes the statements of a file in one session, stopping at
+// the first that fails
+func runSQLFile(service *cli.SQLService, app *App, path string, params cli.Params) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	script, err := cli.Substitute(string(data), params)
+	if err != nil {
+		return err
+	}
+	for _, statement := range cli.SplitStatements(script) {
+		result, err := service.Execute(statement)
+		if err != nil {
+			return fmt.Errorf("SQL error in %q: %w", statement, err)
+		}
+		app.println(result)
+	}
+	return nil
+}
+
+// sqlShell reads statements and backslash commands from the user and
+// executes them in one session
+type sqlShell struct {
+	app     *App
+	service *cli.SQLService
+	history *cli.History
+	saved   *cli.SavedQueries
+}
+
+// runSQLShell executes the statements read from app.in until \q or the end
+// of input. A statement ends with a semicolon at the end of a line; lines
+// starting with a backslash are shell commands.
+func runSQLShell(service *cli.SQLService, app *App) error {
+	history, err := cli.LoadHistory(app.sqlHistoryPath())
+	if err != nil {
+		return err
+	}
+	saved, err := cli.LoadSavedQueries(app.savedQueriesPath())
+	if err != nil {
+		return err
+	}
+	shell := &sqlShell{app: app, service: service, history: history, saved: saved}
+
+	app.println("Enter SQL statements ending with ;. Type \\help for shell commands.")
+	scanner := bufio.NewScanner(app.in)
+	var statement strings.Builder
+	for {
+		if statement.Len() == 0 {
+			app.printf("%s> ", shell.prompt())
+		} else {
+			app.printf("...> ")
+		}
+		if !scanner.Scan() {
+			app.println()
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+
+		if statement.Len() == 0 && strings.HasPrefix(line, "\\") {
+			if quit := shell.command(line); quit {
+				return nil
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		if statement.Len() > 0 {
+			statement.WriteString(" ")
+		}
+		statement.WriteString(line)
+		if strings.HasSuffix(line, ";") {
+			shell.execute(statement.String())
+			statement.Reset()
+		}
+	}
+}
+
+// prompt names the collection chosen with USE, if any
+func (sh *sqlShell) prompt() string {
+	if collection := sh.service.Collection(); collection != "" {
+		return "vectodb:" + collection
+	}
+	return "vectodb"
+}
+
+// execute executes a statement, records it in the history and prints the
+// result or error
+func (sh *sqlShell) execute(statement string) {
+	if err := sh.history.Add(statement); err != nil {
+		sh.app.logger.Printf("Warning: %v", err)
+	}
+	result, err := sh.service.Execute(statement)
+	if err != nil {
+		sh.app.printf("SQL error: %v\n", err)
+		return
+	}
+	sh.app.println(result)
+}
+
+// command runs a backslash command and reports whether the shell should exit
+func (sh *sqlShell) command(line string) (quit bool) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case "\\q", "\\quit":
+		return true
+	case "\\session":
+		sh.printSession()
+	case "\\history":
+		n := 20
+		if len(fields) > 1 {
+			var err error
+			if n, err = strconv.Atoi(fields[1]); err != nil || n < 1 {
+				sh.app.println("usage: \\history [count]")
+				return false
+			}
+		}
+		entries := sh.history.Entries()
+		start := len(entries) - n
+		if start < 0 {
+			start = 0
+		}
+		for i := start; i < len(entries); i++ {
+			sh.app.printf("%4d  %s\n", i+1, entries[i])
+		}
+	case "\\save":
+		if len(fields) < 2 {
+			sh.app.println("usage: \\save name [statement]")
+			return false
+		}
+		// Without a statement, the latest one is saved
+		rest := strings.TrimSpace(strings.TrimPrefix(line, fields[0]))
+		query := strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+		if query == "" {
+			query = sh.history.Last()
+		}
+		if query == "" {
+			sh.app.println("Nothing to save: no statement has been executed yet")
+			return false
+		}
+		if err := sh.saved.Save(fields[1], query); err != nil {
+			sh.app.printf("Error: %v\n", err)
+			return false
+		}
+		sh.app.printf("Saved %s: %s\n", fields[1], query)
+	case "\\run":
+		if len(fields) != 2 {
+			sh.app.println("usage: \\run name")
+			return false
+		}
+		query, ok := sh.saved.Get(fields[1])
+		if !ok {
+			sh.app.printf("No query saved as %s. Type \\saved to list them.\n", fields[1])
+			return false
+		}
+		sh.app.println(query)
+		sh.execute(query)
+	case "\\saved":
+		names := sh.saved.Names()
+		if len(names) == 0 {
+			sh.app.println("No saved queries. Save the latest statement with \\save name.")
+		}
+		for _, name := range names {
+			query, _ := sh.saved.Get(name)
+			sh.app.printf("%s: %s\n", name, query)
+		}
+	case "\\forget":
+		if len(fields) != 2 {
+			sh.app.println("usage: \\forget name")
+			return false
+		}
+		if err := sh.saved.Delete(fields[1]); err != nil {
+			sh.app.printf("Error: %v\n", err)
+			return false
+		}
+		sh.app.printf("Forgot %s\n", fields[1])
+	case "\\views":
+		views := sh.app.catalog.Views()
+		if len(views) == 0 {
+			sh.app.println("No views. Create one with CREATE VIEW name AS SELECT ....")
+		}
+		for _, view := range views {
+			sh.app.printf("%s: %s\n", view.Name, view.Query)
+		}
+	case "\\rules":
+		macros, rules := sh.app.catalog.Macros(), sh.app.catalog.Rules()
+		if len(macros) == 0 && len(rules) == 0 {
+			sh.app.println("No macros or rules. Create them with CREATE MACRO name AS condition or CREATE RULE name ON table WHERE condition LIMIT n.")
+		}
+		for _, macro := range macros {
+			sh.app.printf("macro %s: %s\n", macro.Name, macro.Condition)
+		}
+		for _, rule := range rules {
+			sh.app.printf("rule %s on %s:", rule.Name, rule.Table)
+			if rule.Where != "" {
+				sh.app.printf(" WHERE %s", rule.Where)
+			}
+			if rule.Limit > 0 {
+				sh.app.printf(" LIMIT %d", rule.Limit)
+			}
+			sh.app.println("")
+		}
+	case "\\help":
+		sh.app.println("\\session           Show the settings changed with USE and SET")
+		sh.app.println("\\history [count]   Show the latest statements (default 20)")
+		sh.app.println("\\save name [stmt]  Save a statement, by default the latest one")
+		sh.app.println("\\run name          Execute a saved statement")
+		sh.app.println("\\saved             List the saved statements")
+		sh.app.println("\\forget name       Delete a saved statement")
+		sh.app.println("\\views             List the views created with CREATE VIEW")
+		sh.app.println("\\rules             List the macros and rules created with CREATE MACRO and RULE")
+		sh.app.println("\\q                 Quit")
+	default:
+		sh.app.printf("Unknown command %s. Type \\help for shell commands.\n", fields[0])
+	}
+	return false
+}
+
+// printSession prints the settings changed with USE and SET
+func (sh *sqlShell) printSession() {
+	settings := sh.service.Session()
+	if len(settings) == 0 {
+		sh.app.println("No session settings. Change them with USE and SET.")
+		return
+	}
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sh.app.printf("%s = %s\n", name, settings[name])
+	}
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/progress"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// parseArgs parses a command's flags and checks the number of positional
+// arguments
+func parseArgs(fs *flag.FlagSet, args []string, n int, usage string) ([]string, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() < n {
+		return nil, fmt.Errorf("usage: %s", usage)
+	}
+	return fs.Args(), nil
+}
+
+// vectorError reports a missing vector by its ID
+func vectorError(id string, err error) error {
+	if errors.Is(err, storage.ErrVectorNotFound) {
+		return fmt.Errorf("vector %s not found", id)
+	}
+	return err
+}
+
+// HandleAddCommand processes the add command
+// Usage:
+//   ./vectodb add <vector-id> <value1,value2,...>
+func HandleAddCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 2, "add <vector-id> <value1,value2,...>")
+	if err != nil {
+		return err
+	}
+
+	// Parse vector values
+	valueStrs := strings.Split(args[1], ",")
+	values := make([]float32, len(valueStrs))
+	for i, valStr := range valueStrs {
+		val, err := strconv.ParseFloat(strings.TrimSpace(valStr), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector value at index %d: %s", i, valStr)
+		}
+		values[i] = float32(val)
+	}
+
+	// Create and store vector
+	v := vector.NewVector(args[0], values)
+	if err := app.store.Insert(v); err != nil {
+		if errors.Is(err, storage.ErrVectorAlreadyExists) {
+			return fmt.Errorf("vector with ID %s already exists", v.ID)
+		}
+		return err
+	}
+
+	app.printf("Added vector %s with dimension %d\n", v.ID, v.Dimension)
+	return nil
+}
+
+// HandleGetCommand processes the get command
+// Usage:
+//   ./vectodb get <vector-id>
+func HandleGetCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 1, "get <vector-id>")
+	if err != nil {
+		return err
+	}
+
+	v, err := app.store.Get(args[0])
+	if err != nil {
+		return vectorError(args[0], err)
+	}
+
+	app.printf("Vector %s (dimension: %d):\n", v.ID, v.Dimension)
+
+	// Print metadata in a stable order
+	if len(v.Metadata) > 0 {
+		keys := make([]string, 0, len(v.Metadata))
+		for key := range v.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		app.println("Metadata:")
+		for _, key := range keys {
+			app.printf("  %s: %s\n", key, v.Metadata[key])
+		}
+	}
+
+	app.println("Values:")
+	for i, val := range v.Values {
+		app.printf("  [%d]: %f\n", i, val)
+	}
+	return nil
+}
+
+// HandleListCommand processes the list command. IDs are listed in order, so
+// -after with the last ID of a page lists the next one.
+// Usage:
+//   ./vectodb list [-prefix p] [-after id] [-limit N]
+func HandleListCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	prefix := fs.String("prefix", "", "Only list IDs starting with this prefix")
+	after := fs.String("after", "", "Start after this ID")
+	limit := fs.Int("limit", 0, "Maximum number of IDs to list (default: all)")
+	if _, err := parseArgs(fs, args, 0, "list [-prefix p] [-after id] [-limit N]"); err != nil {
+		return err
+	}
+	if *limit < 0 {
+		return fmt.Errorf("invalid limit: %d", *limit)
+	}
+
+	ids, err := storage.ListAfter(app.store, *prefix, *after, *limit)
+	if err != nil {
+		return err
+	}
+
+	app.printf("Found %d vectors:\n", len(ids))
+	for _, id := range ids {
+		app.println(id)
+	}
+	return nil
+}
+
+// HandleDeleteCommand processes the delete command. Deleting a document
+// embedded in chunks deletes the vectors and stored text of all its chunks.
+// Usage:
+//   ./vectodb delete [-dry-run] <vector-id>
+func HandleDeleteCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "List the vectors that would be deleted without deleting them")
+	args, err := parseArgs(fs, args, 1, "delete [-dry-run] <vector-id>")
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		ids, err := embedding.Children(app.store, args[0])
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			if _, err := storage.GetMeta(app.store, args[0]); err != nil {
+				return vectorError(args[0], err)
+			}
+			ids = []string{args[0]}
+		}
+		if len(ids) == 1 && ids[0] == args[0] {
+			app.printf("Would delete vector %s (dry run)\n", args[0])
+			return nil
+		}
+		app.printf("Would delete %d vectors of document %s (dry run):\n", len(ids), args[0])
+		for _, id := range ids {
+			app.println(id)
+		}
+		return nil
+	}
+
+	n, err := embedding.DeleteDocument(app.store, app.docsDir(), args[0])
+	if err != nil {
+		return vectorError(args[0], err)
+	}
+
+	if n == 1 {
+		app.printf("Vector %s deleted\n", args[0])
+	} else {
+		app.printf("Deleted %d vectors of document %s\n", n, args[0])
+	}
+	return nil
+}
+
+// randomFlags registers the distribution and seed flags of the random
+// commands and returns a function creating the generator they select
+func randomFlags(fs *flag.FlagSet) func() (*vector.Generator, int64, error) {
+	dist := fs.String("dist", "uniform", "Distribution of the values (uniform, gaussian, sphere)")
+	seed := fs.Int64("seed", 0, "Seed for reproducible vectors (default: random)")
+
+	return func() (*vector.Generator, int64, error) {
+		distribution, err := vector.ParseDistribution(*dist)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		seeded := false
+		fs.Visit(func(f *flag.Flag) { seeded = seeded || f.Name == "seed" })
+		if !seeded {
+			*seed = time.Now().UnixNano()
+		}
+
+		gen, err := vector.NewGenerator(distribution, *seed)
+		return gen, *seed, err
+	}
+}
+
+// HandleRandomCommand processes the random command
+// Usage:
+//   ./vectodb random [-dist uniform|gaussian|sphere] [-seed N] <vector-id> <dimension>
+func HandleRandomCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("random", flag.ContinueOnError)
+	generator := randomFlags(fs)
+	args, err := parseArgs(fs, args, 2, "random [-dist uniform|gaussian|sphere] [-seed N] <vector-id> <dimension>")
+	if err != nil {
+		return err
+	}
+
+	dim, err := strconv.Atoi(args[1])
+	if err != nil || dim < 1 {
+		return fmt.Errorf("invalid dimension: %s", args[1])
+	}
+	gen, _, err := generator()
+	if err != nil {
+		return err
+	}
+
+	v := gen.Next(args[0], dim)
+	if err := app.store.Insert(v); err != nil {
+		return err
+	}
+
+	app.printf("Created random vector %s with dimension %d\n", v.ID, v.Dimension)
+	return nil
+}
+
+// HandleRandomBatchCommand inserts many random vectors, e.g. to benchmark
+// indexes. The seed is printed so a run can be repeated.
+// Usage:
+//   ./vectodb random-batch [-dist uniform|gaussian|sphere] [-seed N] [-prefix rand-] <count> <dimension>
+func HandleRandomBatchCommand(args []string, app *App) error {
+	const usage = "random-batch [-dist uniform|gaussian|sphere] [-seed N] [-prefix rand-] <count> <dimension>"
+	fs := flag.NewFlagSet("random-batch", flag.ContinueOnError)
+	generator := randomFlags(fs)
+	prefix := fs.String("prefix", "rand-", "Prefix of the generated vector IDs")
+	args, err := parseArgs(fs, args, 2, usage)
+	if err != nil {
+		return err
+	}
+
+	count, err := strconv.Atoi(args[0])
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid count: %s", args[0])
+	}
+	dim, err := strconv.Atoi(args[1])
+	if err != nil || dim < 1 {
+		return fmt.Errorf("invalid dimension: %s", args[1])
+	}
+	gen, seed, err := generator()
+	if err != nil {
+		return err
+	}
+
+	// Zero-padded IDs keep listings in insertion order
+	format := fmt.Sprintf("%s%%0%dd", *prefix, len(strconv.Itoa(count-1)))
+	bar := progress.NewBar(app.progress, "random", count)
+	for i := 0; i < count; i++ {
+		if err := app.store.Insert(gen.Next(fmt.Sprintf(format, i), dim)); err != nil {
+			bar.Finish()
+			return fmt.Errorf("failed to insert vector %d: %w", i, err)
+		}
+		bar.Add(1)
+	}
+	bar.Finish()
+
+	app.printf("Created %d random vectors with dimension %d (seed %d)\n", count, dim, seed)
+	return nil
+}
+
+// HandleSetMetadataCommand processes the set-metadata command
+// Usage:
+//   ./vectodb set-metadata <vector-id> <key> <value>
+func HandleSetMetadataCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("set-metadata", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 3, "set-metadata <vector-id> <key> <value>")
+	if err != nil {
+		return err
+	}
+
+	v, err := app.store.Get(args[0])
+	if err != nil {
+		return vectorError(args[0], err)
+	}
+
+	key, value := args[1], args[2]
+	if v.Metadata == nil {
+		v.Metadata = make(map[string]string)
+	}
+	v.Metadata[key] = value
+
+	if err := app.store.Update(v); err != nil {
+		return err
+	}
+
+	app.printf("Set metadata %s=%s for vector %s\n", key, value, v.ID)
+	return nil
+}
+
+// HandleRenamePrefixCommand moves the vectors whose IDs start with a prefix
+// to another prefix
+// Usage:
+//   ./vectodb rename-prefix <from-prefix> <to-prefix>
+func HandleRenamePrefixCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("rename-prefix", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 2, "rename-prefix <from-prefix> <to-prefix>")
+	if err != nil {
+		return err
+	}
+
+	n, err := storage.RenamePrefix(app.store, args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	app.printf("Renamed %d vector(s) from %s to %s\n", n, args[0], args[1])
+	return nil
+}
+
+// HandleSearchCommand performs a k-nearest neighbor search for a stored vector
+// Usage:
+//   ./vectodb search <index-type> <vector-id> <k>
+func HandleSearchCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	args, err := parseArgs(fs, args, 3, "search <index-type> <vector-id> <k> (index-type: flat, hnsw, tiered)")
+	if err != nil {
+		return err
+	}
+
+	indexType, err := parseIndexType(args[0])
+	if err != nil {
+		return err
+	}
+
+	k, err := strconv.Atoi(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid value for k: %s", args[2])
+	}
+	if k < 1 {
+		return fmt.Errorf("k must be greater than 0")
+	}
+
+	queryVec, err := app.store.Get(args[1])
+	if err != nil {
+		return vectorError(args[1], err)
+	}
+
+	ids, err := app.store.List()
+	if err != nil {
+		return err
+	}
+
+	vectors := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		v, err := app.store.Get(id)
+		if err != nil {
+			app.logger.Printf("Error getting vector %s: %v", id, err)
+			continue
+		}
+		vectors = append(vectors, v)
+	}
+
+	// Create an appropriate index based on the specified type
+	var idx index.Index
+	var bar *progress.Bar
+	if indexType == executor.IndexTypeHNSW {
+		graph := hnsw.NewHNSWIndex(app.metric, nil)
+		bar = progress.NewBar(app.progress, "build hnsw", len(vectors))
+		graph.SetBuildProgress(func(done, total int) { bar.Set(done) })
+		idx = graph
+	} else if indexType == executor.IndexTypeTiered {
+		idx = tiered.NewIndex(app.store, app.metric, app.tiering)
+	} else {
+		idx = flat.NewFlatIndex(app.metric)
+	}
+	err = idx.Build(vectors)
+	if bar != nil {
+		bar.Finish()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+
+	app.printf("Searching for %d nearest neighbors to vector %s using %s index with %s metric...\n",
+		k, queryVec.ID, idx.Name(), app.metric.Name())
+
+	results, err := index.SearchWithOptions(idx, queryVec, k, index.SearchOptions{OmitVectors: true})
+	if err != nil {
+		return fmt.Errorf("search failed: %w", err)
+	}
+
+	app.printf("Found %d results:\n", len(results))
+	for i, result := range results {
+		// Skip the query vector itself
+		if result.ID == queryVec.ID {
+			continue
+		}
+		app.printf("%d. %s (distance: %.6f)\n", i+1, result.ID, result.Distance)
+	}
+	return nil
+}
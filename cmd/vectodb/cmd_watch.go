@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ken/vector_database/pkg/embedding"
+)
+
+// HandleWatchCommand keeps the collection in sync with a directory until
+// interrupted
+// Usage:
+//   ./vectodb watch <dir> [-glob '*.md'] [-chunk 512] [-debounce 500ms]
+func HandleWatchCommand(args []string, app *App) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	glob := fs.String("glob", "", "Only embed files whose names match this pattern, e.g. '*.md'")
+	chunk := fs.Int("chunk", 0, "Split files into chunks of at most this many tokens; 0 embeds whole files")
+	debounce := fs.Duration("debounce", embedding.DefaultWatchDebounce, "Wait this long after a file changes before embedding it")
+
+	usage := "watch <dir> [-glob pattern] [-chunk tokens] [-debounce 500ms]"
+	root, rest, err := parsePathArgs(fs, args, usage)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("usage: %s", usage)
+	}
+
+	service, err := app.models.ServiceForCollection(defaultCollection, "")
+	if err != nil {
+		return fmt.Errorf("failed to create embedding service: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	app.printf("Syncing %s...\n", root)
+	return service.Watch(ctx, app.store, app.docsDir(), root, &embedding.WatchOptions{
+		Glob:      *glob,
+		ChunkSize: *chunk,
+		Route:     app.models.Router(defaultCollection),
+		Binary:    app.binaryProcessor(),
+		Debounce:  *debounce,
+		Synced: func(stats *embedding.DirStats) {
+			for _, err := range stats.Errors {
+				app.printf("Failed: %v\n", err)
+			}
+			app.printf("Synced %d files: %d chunks embedded, %d unchanged. Watching for changes (Ctrl-C to stop)...\n",
+				stats.Files, stats.Embedded, stats.Unchanged)
+		},
+		Changed: func(event embedding.WatchEvent) {
+			switch {
+			case event.Err != nil:
+				app.printf("Failed: %s: %v\n", event.Path, event.Err)
+			case event.Embedded == 0 && event.Unchanged == 0:
+				app.printf("Removed %s (%d chunks)\n", event.Path, event.Removed)
+			default:
+				app.printf("Embedded %s (%d chunks embedded, %d unchanged, %d removed)\n",
+					event.Path, event.Embedded, event.Unchanged, event.Removed)
+			}
+		},
+	})
+}
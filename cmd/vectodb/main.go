@@ -5,17 +5,18 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
 	"strings"
 
+	"github.com/ken/vector_database/internal/concurrency"
 	"github.com/ken/vector_database/internal/config"
+	"github.com/ken/vector_database/pkg/analysis"
 	"github.com/ken/vector_database/pkg/core/distance"
-	"github.com/ken/vector_database/pkg/core/vector"
-	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/core/projection"
 	"github.com/ken/vector_database/pkg/index/hnsw"
-	"github.com/ken/vector_database/pkg/index"
-	"github.com/ken/vector_database/pkg/sql/cli"
-	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/index/twostage"
 	"github.com/ken/vector_database/pkg/storage"
 )
 
@@ -24,14 +25,45 @@ const (
 	appVersion = "0.1.0"
 )
 
+// commands maps each subcommand to its handler. migrate is handled
+// separately because it opens its own stores.
+var commands = map[string]func(args []string, app *App) error{
+	"serve":         HandleServeCommand,
+	"import":        HandleImportCommand,
+	"export":        HandleExportCommand,
+	"search":        HandleSearchCommand,
+	"sql":           HandleSQLCommand,
+	"add":           HandleAddCommand,
+	"get":           HandleGetCommand,
+	"list":          HandleListCommand,
+	"delete":        HandleDeleteCommand,
+	"random":        HandleRandomCommand,
+	"random-batch":  HandleRandomBatchCommand,
+	"gen":           HandleGenCommand,
+	"bench":         HandleBenchCommand,
+	"embed":         HandleEmbedCommand,
+	"watch":         HandleWatchCommand,
+	"search-text":   HandleSearchTextCommand,
+	"context":       HandleContextCommand,
+	"analyze":       HandleAnalyzeCommand,
+	"ask":           HandleAskCommand,
+	"reembed":       HandleReembedCommand,
+	"models":        HandleModelsCommand,
+	"set-metadata":  HandleSetMetadataCommand,
+	"rename-prefix": HandleRenamePrefixCommand,
+	"audit":         HandleAuditCommand,
+	"snapshot":      HandleSnapshotCommand,
+	"index":         HandleIndexCommand,
+}
+
 func main() {
 	// Define command-line flags
 	var (
 		showVersion = flag.Bool("version", false, "Display version information")
 		configFile  = flag.String("config", "config.yaml", "Path to configuration file")
-		metricName  = flag.String("metric", "euclidean", "Distance metric to use (euclidean, cosine, dotproduct, manhattan)")
+		metricName  = flag.String("metric", "euclidean", "Distance metric to use (euclidean, cosine, dotproduct, manhattan, haversine)")
 		verbose     = flag.Bool("verbose", false, "Enable verbose output")
-		indexType   = flag.String("index", "flat", "Index type to use (flat, hnsw)")
+		indexType   = flag.String("index", "flat", "Index type to use (flat, hnsw, tiered)")
 	)
 
 	// Parse command-line arguments
@@ -49,24 +81,19 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Create data directory if it doesn't exist
-	if err := os.MkdirAll(cfg.Storage.DataDir, 0755); err != nil {
-		log.Fatalf("Failed to create data directory: %v", err)
+	// Select the batch distance backend used by flat search and HNSW construction
+	if err := distance.SetDefaultBatchBackend(cfg.Indexing.DistanceBackend); err != nil {
+		log.Fatalf("Invalid distance backend: %v", err)
 	}
 
-	// Parse the metric type
-	metricType := distance.MetricType(*metricName)
-	metric, err := distance.GetMetric(metricType)
-	if err != nil {
-		log.Fatalf("Invalid distance metric: %v", err)
-	}
+	// Bound the goroutines of scans, index builds and imports
+	concurrency.SetMaxParallelism(cfg.Concurrency.MaxParallelism)
 
-	// Create vector store
-	store, err := storage.NewFileStore(cfg.Storage.DataDir)
-	if err != nil {
-		log.Fatalf("Failed to create vector store: %v", err)
+	// Migration opens the source and destination stores itself
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		handleMigrate(args, cfg)
+		return
 	}
-	defer store.Close()
 
 	// Get the subcommand
 	args := flag.Args()
@@ -75,357 +102,295 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Process subcommands
-	switch args[0] {
-	case "serve":
-		fmt.Println("Starting VectoDB server...")
-		// TODO: Implement server startup
-	case "import":
-		if len(args) < 2 {
-			fmt.Println("Error: Missing file path")
-			fmt.Println("Usage: vectodb import <file>")
-			os.Exit(1)
-		}
-		fmt.Printf("Importing vectors from %s...\n", args[1])
-		// TODO: Implement vector import
-	case "export":
-		if len(args) < 2 {
-			fmt.Println("Error: Missing file path")
-			fmt.Println("Usage: vectodb export <file>")
-			os.Exit(1)
-		}
-		fmt.Printf("Exporting vectors to %s...\n", args[1])
-		// TODO: Implement vector export
-	case "search":
-		handleSearch(args, store, metric)
-	case "add":
-		if len(args) < 3 {
-			fmt.Println("Error: Missing vector ID and values")
-			fmt.Println("Usage: vectodb add <vector-id> <value1,value2,...>")
-			os.Exit(1)
-		}
-		
-		// Parse vector values
-		valueStrs := strings.Split(args[2], ",")
-		values := make([]float32, len(valueStrs))
-		
-		for i, valStr := range valueStrs {
-			val, err := strconv.ParseFloat(valStr, 32)
-			if err != nil {
-				fmt.Printf("Error: Invalid vector value at index %d: %s\n", i, valStr)
-				os.Exit(1)
-			}
-			values[i] = float32(val)
-		}
-		
-		// Create and store vector
-		v := vector.NewVector(args[1], values)
-		if err := store.Insert(v); err != nil {
-			if err == storage.ErrVectorAlreadyExists {
-				fmt.Printf("Error: Vector with ID %s already exists\n", args[1])
-			} else {
-				fmt.Printf("Error: %v\n", err)
-			}
-			os.Exit(1)
-		}
-		
-		fmt.Printf("Added vector %s with dimension %d\n", v.ID, v.Dimension)
-	case "get":
-		if len(args) < 2 {
-			fmt.Println("Error: Missing vector ID")
-			fmt.Println("Usage: vectodb get <vector-id>")
-			os.Exit(1)
-		}
-		
-		// Get vector from store
-		v, err := store.Get(args[1])
-		if err != nil {
-			if err == storage.ErrVectorNotFound {
-				fmt.Printf("Vector %s not found\n", args[1])
-			} else {
-				fmt.Printf("Error: %v\n", err)
-			}
-			os.Exit(1)
-		}
-		
-		// Print vector
-		fmt.Printf("Vector %s (dimension: %d):\n", v.ID, v.Dimension)
-		
-		// Print metadata if available
-		if len(v.Metadata) > 0 {
-			fmt.Println("Metadata:")
-			for key, value := range v.Metadata {
-				fmt.Printf("  %s: %s\n", key, value)
-			}
-			fmt.Println("Values:")
-		} else {
-			fmt.Println("Values:")
-		}
-		
-		// Print vector values
-		for i, val := range v.Values {
-			fmt.Printf("  [%d]: %f\n", i, val)
-		}
-	case "list":
-		// List all vectors
-		ids, err := store.List()
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
-		}
-		
-		count, _ := store.Count()
-		fmt.Printf("Found %d vectors:\n", count)
-		for _, id := range ids {
-			fmt.Println(id)
-		}
-	case "delete":
-		if len(args) < 2 {
-			fmt.Println("Error: Missing vector ID")
-			fmt.Println("Usage: vectodb delete <vector-id>")
-			os.Exit(1)
-		}
-		
-		// Delete vector from store
-		err := store.Delete(args[1])
+	handler, ok := commands[args[0]]
+	if !ok {
+		fmt.Printf("Unknown command: %s\n", args[0])
+		printUsage()
+		os.Exit(1)
+	}
+
+	// Open the configured store and build the shared command context
+	app, err := NewApp(cfg, *configFile, *metricName, *indexType, *verbose)
+	if err != nil {
+		log.Fatalf("Failed to initialize: %v", err)
+	}
+	defer app.Close()
+
+	if err := handler(args[1:], app); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		app.Close()
+		os.Exit(1)
+	}
+}
+
+// openStore creates the vector store selected by the storage configuration
+func openStore(cfg *config.Config) (storage.VectorStore, error) {
+	if cfg.Storage.ReadOnly {
+		return openReadOnlyStore(cfg)
+	}
+	switch strings.ToLower(cfg.Storage.Type) {
+	case "", "file":
+		return storage.NewFileStore(cfg.Storage.DataDir)
+	case "s3":
+		bucket, err := storage.NewS3Bucket(storage.S3Config{
+			Endpoint:        cfg.Storage.S3.Endpoint,
+			Region:          cfg.Storage.S3.Region,
+			Bucket:          cfg.Storage.S3.Bucket,
+			Prefix:          cfg.Storage.S3.Prefix,
+			AccessKeyID:     cfg.Storage.S3.AccessKeyID,
+			SecretAccessKey: cfg.Storage.S3.SecretAccessKey,
+			PathStyle:       cfg.Storage.S3.PathStyle,
+		})
 		if err != nil {
-			if err == storage.ErrVectorNotFound {
-				fmt.Printf("Vector %s not found\n", args[1])
-			} else {
-				fmt.Printf("Error: %v\n", err)
-			}
-			os.Exit(1)
+			return nil, err
 		}
-		
-		fmt.Printf("Vector %s deleted\n", args[1])
-	case "random":
-		if len(args) < 3 {
-			fmt.Println("Error: Missing vector ID and dimension")
-			fmt.Println("Usage: vectodb random <vector-id> <dimension>")
-			os.Exit(1)
+
+		// Cache segments under the data directory unless configured otherwise
+		cacheDir := cfg.Storage.S3.CacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(cfg.Storage.DataDir, "segment-cache")
 		}
-		
-		// Parse dimension
-		dim, err := strconv.Atoi(args[2])
+
+		store, err := storage.NewObjectStore(bucket, &storage.ObjectStoreOptions{
+			CacheDir:       cacheDir,
+			FlushThreshold: cfg.Storage.S3.FlushThreshold,
+		})
 		if err != nil {
-			fmt.Printf("Error: Invalid dimension: %s\n", args[2])
-			os.Exit(1)
+			return nil, err
 		}
-		
-		// Create random vector
-		v := vector.Random(args[1], dim)
-		
-		// Store vector
-		if err := store.Insert(v); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+		if compaction := cfg.Storage.S3.Compaction; compaction.Enabled {
+			store.StartCompaction(storage.CompactionPolicy{
+				Interval:          compaction.Interval,
+				MinSegments:       compaction.MinSegments,
+				MaxGarbageRatio:   compaction.MaxGarbageRatio,
+				MaxBytesPerSecond: int64(compaction.MaxMBPerSecond * (1 << 20)),
+			})
 		}
-		
-		fmt.Printf("Created random vector %s with dimension %d\n", v.ID, v.Dimension)
-	case "sql":
-		handleSQL(args, store, metric, *indexType, *verbose)
-	case "embed":
-		if len(args) < 2 {
-			fmt.Println("Error: Missing embed type")
-			fmt.Println("Usage: vectodb embed [text|file|json] <id> <content>")
-			os.Exit(1)
+		return store, nil
+	case "sqlite":
+		path := cfg.Storage.SQLite.Path
+		if path == "" {
+			path = filepath.Join(cfg.Storage.DataDir, "vectodb.sqlite")
 		}
-		
-		// Pass the remaining arguments to the embed command handler
-		if err := HandleEmbedCommand(args[1:]); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+		return storage.NewSQLiteStore(path)
+	case "bolt", "bbolt":
+		path := cfg.Storage.Bolt.Path
+		if path == "" {
+			path = filepath.Join(cfg.Storage.DataDir, "vectodb.bolt")
 		}
-	case "search-text":
-		if len(args) < 1 {
-			fmt.Println("Error: Missing text query")
-			fmt.Println("Usage: vectodb search-text <text query>")
-			os.Exit(1)
-		}
-		textQuery := strings.Join(args, " ")
-		HandleSearchTextCommand(textQuery, metric, *indexType, *verbose)
-	case "set-metadata":
-		if len(args) < 4 {
-			fmt.Println("Error: Missing parameters")
-			fmt.Println("Usage: vectodb set-metadata <vector-id> <key> <value>")
-			os.Exit(1)
-		}
-		
-		// Get vector from store
-		v, err := store.Get(args[1])
-		if err != nil {
-			if err == storage.ErrVectorNotFound {
-				fmt.Printf("Vector %s not found\n", args[1])
-			} else {
-				fmt.Printf("Error: %v\n", err)
+		return storage.NewBoltStore(path)
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type)
+	}
+}
+
+// openReadOnlyStore opens the configured store for reading only. The file
+// backend writes nothing to the data directory, so replicas can share it;
+// other backends open their files as usual and reject writes.
+func openReadOnlyStore(cfg *config.Config) (storage.VectorStore, error) {
+	if t := strings.ToLower(cfg.Storage.Type); t == "" || t == "file" {
+		return storage.NewReadOnlyFileStore(cfg.Storage.DataDir)
+	}
+	writable := *cfg
+	writable.Storage.ReadOnly = false
+	writable.Storage.S3.Compaction.Enabled = false
+	store, err := openStore(&writable)
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewReadOnlyStore(store), nil
+}
+
+// newVectorAdapter builds the configured dimension adapters. It returns nil
+// when no adapters are configured.
+func newVectorAdapter(cfg *config.Config) (storage.VectorAdapter, error) {
+	if len(cfg.Vector.Adapters) == 0 {
+		return nil, nil
+	}
+
+	adapters := projection.NewAdapters(cfg.Vector.DefaultDimension)
+	for i, ac := range cfg.Vector.Adapters {
+		var p *projection.Projection
+		var err error
+
+		switch strings.ToLower(ac.Type) {
+		case "", "random":
+			p, err = projection.NewRandomProjection(ac.From, cfg.Vector.DefaultDimension, ac.Seed)
+		case "matrix":
+			if ac.Path == "" {
+				return nil, fmt.Errorf("adapter %d: matrix adapters require a path", i)
 			}
-			os.Exit(1)
+			p, err = projection.LoadMatrix(ac.Path)
+		default:
+			return nil, fmt.Errorf("adapter %d: unsupported adapter type: %s", i, ac.Type)
 		}
-		
-		// Set metadata
-		key := args[2]
-		value := args[3]
-		
-		// Initialize metadata map if nil
-		if v.Metadata == nil {
-			v.Metadata = make(map[string]string)
+		if err != nil {
+			return nil, fmt.Errorf("adapter %d: %w", i, err)
 		}
-		
-		v.Metadata[key] = value
-		
-		// Update vector in store
-		if err := store.Update(v); err != nil {
-			fmt.Printf("Error: %v\n", err)
-			os.Exit(1)
+
+		if err := adapters.Add(p); err != nil {
+			return nil, fmt.Errorf("adapter %d: %w", i, err)
 		}
-		
-		fmt.Printf("Set metadata %s=%s for vector %s\n", key, value, v.ID)
-	default:
-		fmt.Printf("Unknown command: %s\n", args[0])
-		printUsage()
-		os.Exit(1)
 	}
+
+	return adapters, nil
 }
 
-// handleSQL executes SQL queries against the vector database
-func handleSQL(args []string, store storage.VectorStore, metric distance.Metric, indexType string, verbose bool) {
-	if len(args) < 2 {
-		fmt.Println("Error: Missing SQL query")
-		fmt.Println("Usage: vectodb sql \"<query>\"")
-		fmt.Println("Examples:")
-		fmt.Println("  vectodb sql \"SELECT id, dimension FROM vectors LIMIT 5\"")
-		fmt.Println("  vectodb sql \"SELECT id, dimension FROM vectors WHERE id LIKE 'test%'\"")
-		fmt.Println("  vectodb sql \"SELECT id FROM vectors WHERE metadata.category = 'image'\"")
-		fmt.Println("  vectodb sql \"SELECT id FROM vectors WHERE metadata.tags LIKE '%important%'\"")
-		fmt.Println("  vectodb sql \"SELECT id, distance FROM vectors NEAREST TO [1.0,2.0,3.0] USING euclidean LIMIT 3\"")
-		fmt.Println("  vectodb sql \"INSERT INTO vectors (id, vector) VALUES ('vec123', [1.0,2.0,3.0])\"")
-		fmt.Println("  vectodb sql \"DELETE FROM vectors WHERE id = 'vec123'\"")
-		os.Exit(1)
+// searchTruncation returns the Matryoshka search options from the indexing
+// configuration, or nil to search on full vectors
+func searchTruncation(cfg *config.Config) *matryoshka.Options {
+	if cfg.Indexing.TruncateDimensions <= 0 {
+		return nil
 	}
-	
-	// Convert index type string to executor.IndexType
-	var idxType executor.IndexType
-	switch strings.ToLower(indexType) {
-	case "flat":
-		idxType = executor.IndexTypeFlat
-	case "hnsw":
-		idxType = executor.IndexTypeHNSW
-	default:
-		fmt.Printf("Error: Unsupported index type: %s\n", indexType)
-		fmt.Println("Supported index types: flat, hnsw")
-		os.Exit(1)
+	return &matryoshka.Options{
+		Dimensions: cfg.Indexing.TruncateDimensions,
+		Rescore:    cfg.Indexing.RescoreFactor,
 	}
-	
-	// Create SQL service
-	sqlService := cli.NewSQLService(store, idxType, metric)
-	sqlService.SetVerbose(verbose)
-	
-	// Execute SQL query
-	result, err := sqlService.Execute(args[1])
-	if err != nil {
-		fmt.Printf("SQL Error: %v\n", err)
-		os.Exit(1)
+}
+
+// searchHNSW returns the HNSW parameters from the indexing configuration,
+// or nil for the defaults
+func searchHNSW(cfg *config.Config) *hnsw.HNSWConfig {
+	ic := cfg.Indexing
+	if ic.HNSWMaxLinks <= 0 && ic.HNSWMaxLinks0 <= 0 && ic.HNSWEFConstruct <= 0 && ic.HNSWSeed == 0 && !ic.HNSWNearestNeighbors && !ic.HNSWExtendCandidates && !ic.HNSWKeepPruned && ic.HNSWPageCacheBlocks <= 0 {
+		return nil
 	}
-	
-	// Print result
-	fmt.Println(result)
+	hc := hnsw.NewHNSWConfig(ic.HNSWMaxLinks, ic.HNSWEFConstruct, 0)
+	hc.M0 = ic.HNSWMaxLinks0
+	if ic.HNSWSeed != 0 {
+		hc.Seed = ic.HNSWSeed
+		hc.Deterministic = true
+	}
+	hc.Heuristic = !ic.HNSWNearestNeighbors
+	hc.ExtendCandidates = ic.HNSWExtendCandidates
+	hc.KeepPruned = ic.HNSWKeepPruned
+	hc.PageCacheBlocks = ic.HNSWPageCacheBlocks
+	return &hc
 }
 
-// handleSearch performs a k-nearest neighbor search for a vector
-func handleSearch(args []string, store storage.VectorStore, metric distance.Metric) {
-	if len(args) < 4 {
-		fmt.Println("Error: Missing parameters")
-		fmt.Println("Usage: vectodb search <index-type> <vector-id> <k>")
-		fmt.Println("  index-type: The type of index to use (flat, hnsw)")
-		fmt.Println("  vector-id: The ID of the query vector")
-		fmt.Println("  k: The number of nearest neighbors to find")
-		os.Exit(1)
+// searchTiering returns the options of tiered indexes from the indexing
+// configuration. Its access stats are shared by every index the app builds,
+// so the hot vectors survive the rebuilds that follow writes.
+func searchTiering(cfg *config.Config) *tiered.Options {
+	tc := cfg.Indexing.Tiering
+	opts := tiered.DefaultOptions()
+	opts.Clusters = tc.Clusters
+	if tc.Probes > 0 {
+		opts.Probes = tc.Probes
 	}
-	
-	// Get the index type
-	indexType := args[1]
-	if indexType != "flat" && indexType != "hnsw" {
-		fmt.Printf("Error: Unsupported index type: %s\n", indexType)
-		fmt.Println("Supported index types: flat, hnsw")
-		os.Exit(1)
+	if tc.Candidates > 0 {
+		opts.Candidates = tc.Candidates
 	}
-	
-	// Parse k (number of nearest neighbors)
-	k, err := strconv.Atoi(args[3])
-	if err != nil {
-		fmt.Printf("Error: Invalid value for k: %s\n", args[3])
-		os.Exit(1)
+	if tc.HotSize > 0 {
+		opts.HotSize = tc.HotSize
+	}
+	if tc.MinHits > 0 {
+		opts.MinHits = tc.MinHits
 	}
+	if tc.RetierEvery > 0 {
+		opts.RetierEvery = tc.RetierEvery
+	}
+	opts.Access = tiered.NewAccessStats(tc.HalfLife)
+	return opts
+}
 
-	if k < 1 {
-		fmt.Println("Error: k must be greater than 0")
-		os.Exit(1)
+// collectionMetrics parses the per-collection metrics of the indexing
+// configuration
+func collectionMetrics(cfg *config.Config) (map[string]distance.Metric, error) {
+	metrics := make(map[string]distance.Metric, len(cfg.Indexing.CollectionMetrics))
+	for collection, name := range cfg.Indexing.CollectionMetrics {
+		metric, err := distance.GetMetric(distance.MetricType(name))
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric for collection %s: %w", collection, err)
+		}
+		metrics[collection] = metric
 	}
-	
-	// Get the query vector
-	queryVec, err := store.Get(args[2])
+	return metrics, nil
+}
+
+// collectionAnalyzers builds the keyword analyzers of the configured
+// collections
+func collectionAnalyzers(cfg *config.Config) (*analysis.Set, error) {
+	standard, err := newAnalyzer(cfg.Analysis.Default)
 	if err != nil {
-		if err == storage.ErrVectorNotFound {
-			fmt.Printf("Vector %s not found\n", args[2])
-		} else {
-			fmt.Printf("Error: %v\n", err)
+		return nil, fmt.Errorf("invalid default analyzer: %w", err)
+	}
+	analyzers := make(map[string]*analysis.Analyzer, len(cfg.Analysis.Collections))
+	for collection, ac := range cfg.Analysis.Collections {
+		if analyzers[collection], err = newAnalyzer(ac); err != nil {
+			return nil, fmt.Errorf("invalid analyzer for collection %s: %w", collection, err)
 		}
+	}
+	return analysis.NewSet(standard, analyzers), nil
+}
+
+// newAnalyzer creates an analyzer from its configuration
+func newAnalyzer(ac config.AnalyzerConfig) (*analysis.Analyzer, error) {
+	return analysis.New(analysis.Options{
+		Language:     ac.Language,
+		KeepCase:     ac.KeepCase,
+		Stopwords:    ac.Stopwords,
+		Stemming:     ac.Stemming,
+		Synonyms:     ac.Synonyms,
+		SynonymsFile: ac.SynonymsFile,
+	})
+}
+
+// searchTwoStage returns the two-stage search options from the indexing
+// configuration, or nil to scan full vectors
+func searchTwoStage(cfg *config.Config) *twostage.Options {
+	if cfg.Indexing.TwoStageCandidates <= 0 {
+		return nil
+	}
+	return &twostage.Options{
+		Candidates: cfg.Indexing.TwoStageCandidates,
+	}
+}
+
+// handleMigrate copies the file store in the data directory into another backend
+func handleMigrate(args []string, cfg *config.Config) {
+	if len(args) < 2 {
+		fmt.Println("Error: Missing target storage type")
+		fmt.Println("Usage: vectodb migrate <bolt|sqlite|s3>")
 		os.Exit(1)
 	}
-	
-	// List all vectors
-	ids, err := store.List()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+
+	targetType := strings.ToLower(args[1])
+	if targetType == "" || targetType == "file" {
+		fmt.Println("Error: Target storage type must differ from the file store")
 		os.Exit(1)
 	}
 
-	// Get all vectors
-	vectors := make([]*vector.Vector, 0, len(ids))
-	for _, id := range ids {
-		v, err := store.Get(id)
-		if err != nil {
-			fmt.Printf("Error getting vector %s: %v\n", id, err)
-			continue
-		}
-		vectors = append(vectors, v)
-	}
-	
-	// Create an appropriate index based on the specified type
-	var idx index.Index
-	switch indexType {
-	case "flat":
-		idx = flat.NewFlatIndex(metric)
-	case "hnsw":
-		// Create an HNSW index with default configuration
-		idx = hnsw.NewHNSWIndex(metric, nil)
-	}
-	
-	// Build the index
-	if err := idx.Build(vectors); err != nil {
-		fmt.Printf("Error building index: %v\n", err)
+	src, err := storage.NewFileStore(cfg.Storage.DataDir)
+	if err != nil {
+		fmt.Printf("Error opening file store: %v\n", err)
 		os.Exit(1)
 	}
-	
-	fmt.Printf("Searching for %d nearest neighbors to vector %s using %s index with %s metric...\n", 
-		k, queryVec.ID, idx.Name(), metric.Name())
-	
-	// Perform the search
-	results, err := idx.Search(queryVec, k)
+	defer src.Close()
+
+	// Open the destination with the same configuration but a different backend
+	targetCfg := *cfg
+	targetCfg.Storage.Type = targetType
+	dst, err := openStore(&targetCfg)
 	if err != nil {
-		fmt.Printf("Error during search: %v\n", err)
+		fmt.Printf("Error opening %s store: %v\n", targetType, err)
 		os.Exit(1)
 	}
-	
-	// Display results
-	fmt.Printf("Found %d results:\n", len(results))
-	for i, result := range results {
-		// Skip the query vector itself
-		if result.ID == queryVec.ID {
-			continue
+	defer dst.Close()
+
+	fmt.Printf("Migrating vectors from %s to %s...\n", cfg.Storage.DataDir, targetType)
+	stats, err := storage.Migrate(src, dst, func(done, total int) {
+		if done%1000 == 0 || done == total {
+			fmt.Printf("  %d/%d\n", done, total)
 		}
-		fmt.Printf("%d. %s (distance: %.6f)\n", i+1, result.ID, result.Distance)
+	})
+	if err != nil {
+		fmt.Printf("Error: migration failed: %v\n", err)
+		os.Exit(1)
 	}
+
+	fmt.Printf("Migrated %d vectors (%d new, %d overwritten, %d deleted during the migration)\n", stats.Copied+stats.Updated, stats.Copied, stats.Updated, stats.Deleted)
+	fmt.Printf("Set storage.type to %q in your configuration to use the new backend\n", targetType)
 }
 
 func printUsage() {
@@ -435,18 +400,48 @@ func printUsage() {
 	fmt.Println("\nFlags:")
 	flag.PrintDefaults()
 	fmt.Println("\nCommands:")
-	fmt.Println("  serve    Start the VectoDB server")
-	fmt.Println("  import   Import vectors from a file")
-	fmt.Println("  export   Export vectors to a file")
+	fmt.Println("  serve    Start the VectoDB HTTP server (Usage: vectodb serve [-read-only] [-snapshot <dir> | -bundle <file>])")
+	fmt.Println("  import   Import vectors from an Arrow or Parquet file (Usage: vectodb import [-format arrow|parquet] [-on-conflict overwrite|skip|rename|fail] [-restart] [-dry-run] <file>)")
+	fmt.Println("           or from another database's export: vectodb import -from qdrant|chroma|pgvector <file>")
+	fmt.Println("  export   Export vectors to an Arrow or Parquet file (Usage: vectodb export [-format arrow|parquet] <file>)")
 	fmt.Println("  search   Search for vectors (Usage: vectodb search <index-type> <vector-id> <k>)")
-	fmt.Println("           index-type: flat, hnsw")
-	fmt.Println("  sql      Execute SQL query (Usage: vectodb sql \"<query>\")")
+	fmt.Println("           index-type: flat, hnsw, tiered")
+	fmt.Println("  sql      Execute SQL query (Usage: vectodb sql [-dry-run] [-format table|json] [-precision N] [-scientific] [-full-vectors] \"<query>\", or vectodb sql -i for a shell)")
 	fmt.Println("  add      Add a vector")
 	fmt.Println("  get      Get a vector")
-	fmt.Println("  list     List all vectors")
-	fmt.Println("  delete   Delete a vector")
-	fmt.Println("  random   Create a random vector")
-	fmt.Println("  embed    Embed text or file content as a vector")
-	fmt.Println("  search-text <text query>  Search using text similarity")
+	fmt.Println("  list     List vector IDs in order (Usage: vectodb list [-prefix p] [-after id] [-limit N])")
+	fmt.Println("  delete   Delete a vector, or a document and all its chunks (Usage: vectodb delete [-dry-run] <vector-id>)")
+	fmt.Println("  random   Create a random vector (Usage: vectodb random [-dist uniform|gaussian|sphere] [-seed N] <vector-id> <dimension>)")
+	fmt.Println("  random-batch [-dist uniform|gaussian|sphere] [-seed N] [-prefix rand-] <count> <dimension>")
+	fmt.Println("           Insert many random vectors for benchmarking")
+	fmt.Println("  gen [-count 1M] [-dim 384] [-clusters 100] [-spread 0.5] [-seed N] -out <file>")
+	fmt.Println("           Write a clustered benchmark corpus to load with import -from qdrant")
+	fmt.Println("  bench [-type flat|hnsw|tiered] [-queries 1000] [-k 10] [-seed N] [-profile cpu.out] [-memprofile heap.out]")
+	fmt.Println("           Time building an index over the stored vectors and searching it, optionally under the CPU profiler")
+	fmt.Println("  embed [-force] text|file|json|image <id> <content>  Embed text, file content or an image as a vector, skipping unchanged documents")
+	fmt.Println("  embed dir <path> [-glob '*.md'] [-chunk 512]  Embed every matching file below a directory, in chunks of at most N tokens")
+	fmt.Println("  watch <dir> [-glob '*.md'] [-chunk 512]  Embed files as they change and remove deleted ones, until interrupted")
+	fmt.Println("  search-text [-k 10] [-collection c] [-model m] [-filter key=value] [-min-similarity s] [-group-by-parent] [-highlight] [-format table|json|csv] <text query> | -image <path>")
+	fmt.Println("           Search using text or image similarity, -highlight showing the snippet of each result that matches the query")
+	fmt.Println("           and -model embedding the query with another registered model of the collection's dimension")
+	fmt.Println("  analyze [-collection c] [-query] <text>  Show the terms the collection's keyword analyzer makes of a text")
+	fmt.Println("  context [-before 1] [-after 1] [-json] <chunk-id>  Show a chunk with the chunks around it in its document")
+	fmt.Println("  ask [-k 4] [-no-llm] \"<question>\"  Retrieve documents for a question and answer it with the configured LLM")
 	fmt.Println("  set-metadata <vector-id> <key> <value>  Set vector metadata")
+	fmt.Println("  rename-prefix <from-prefix> <to-prefix>  Move the vectors whose IDs start with a prefix to another prefix")
+	fmt.Println("  models [bind <collection> <model>]  List embedding models or set a collection's model")
+	fmt.Println("  models stats [-server URL]  Show calls, failures, tokens, cost and latency per embedding model")
+	fmt.Println("  reembed -model <name>  Re-embed documents embedded with a different model")
+	fmt.Println("  audit tail [-n 20] [-json]  Show the latest inserts, updates, deletes and drops made through SQL and the HTTP API")
+	fmt.Println("  snapshot create|list|verify <epoch>|restore <epoch>  Take, check or restore consistent snapshots of the store")
+	fmt.Println("  index rebuild [-type hnsw] -collection <c> [-m 16] [-m0 32] [-ef-construction 200] [-ef-search 50] [-server URL]")
+	fmt.Println("           Rebuild a search index and swap it in while queries keep using the current one")
+	fmt.Println("  index stats -collection <c> [-server URL]")
+	fmt.Println("           Show the levels, links and connectivity of the HNSW graph to diagnose poor recall")
+	fmt.Println("  index inspect <file>  Show the format version, type, metric, size and checksum of a saved index")
+	fmt.Println("  index upgrade [-type flat|hnsw|quantized|tiered|matryoshka] <file>")
+	fmt.Println("           Rewrite a saved index, including legacy ones, in the current file format")
+	fmt.Println("  index bundle [-type hnsw] -collection <c> -o <file>")
+	fmt.Println("           Pack a built index and its vectors into one file that serve -bundle serves without rebuilding")
+	fmt.Println("  migrate <bolt|sqlite|s3>  Copy vectors from the file store in data_dir to another backend")
 } 
\ No newline at end of file
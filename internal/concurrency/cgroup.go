@@ -0,0 +1,61 @@
+package concurrency
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Files limiting the CPU time of a Linux container, for cgroup v2 and v1
+const (
+	cgroupV2Max    = "/sys/fs/cgroup/cpu.max"
+	cgroupV1Quota  = "/sys/fs/cgroup/cpu/cpu.cfs_quota_us"
+	cgroupV1Period = "/sys/fs/cgroup/cpu/cpu.cfs_period_us"
+)
+
+var (
+	quotaOnce sync.Once
+	quota     int
+)
+
+// CPUQuota returns the CPUs the process may use under the CPU quota of its
+// cgroup, rounded up, or 0 without a quota. Go before 1.25 sets GOMAXPROCS
+// to every CPU of the host, even in a container limited to a few.
+func CPUQuota() int {
+	quotaOnce.Do(func() {
+		if data, err := os.ReadFile(cgroupV2Max); err == nil {
+			quota = parseCPUMax(string(data))
+			return
+		}
+		quotaData, err := os.ReadFile(cgroupV1Quota)
+		if err != nil {
+			return
+		}
+		periodData, err := os.ReadFile(cgroupV1Period)
+		if err != nil {
+			return
+		}
+		quota = parseCPUMax(strings.TrimSpace(string(quotaData)) + " " + strings.TrimSpace(string(periodData)))
+	})
+	return quota
+}
+
+// parseCPUMax parses the "<quota> <period>" of cpu.max into CPUs, rounded
+// up. A quota of "max" or -1 is no quota.
+func parseCPUMax(text string) int {
+	fields := strings.Fields(text)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	limit, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || limit <= 0 {
+		return 0
+	}
+	period, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0
+	}
+	return int(math.Ceil(limit / period))
+}
@@ -0,0 +1,112 @@
+// Package concurrency runs work in parallel on a bounded number of
+// goroutines. CPU-bound work is spread over at most MaxParallelism
+// goroutines: GOMAXPROCS, lowered to the CPU quota of the container the
+// process runs in and to the configured maximum, so that flat scans, index
+// builds and imports do not oversubscribe a shared host.
+package concurrency
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// maxParallelism is the configured maximum, 0 if unset
+var maxParallelism atomic.Int64
+
+// SetMaxParallelism caps the goroutines CPU-bound work is spread over. Zero
+// or less removes the cap, leaving GOMAXPROCS and the CPU quota.
+func SetMaxParallelism(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxParallelism.Store(int64(n))
+}
+
+// MaxParallelism returns the number of goroutines CPU-bound work is spread
+// over: GOMAXPROCS, at most the CPU quota and the configured maximum
+func MaxParallelism() int {
+	n := runtime.GOMAXPROCS(0)
+	if quota := CPUQuota(); quota > 0 && quota < n {
+		n = quota
+	}
+	if limit := int(maxParallelism.Load()); limit > 0 && limit < n {
+		n = limit
+	}
+	return max(n, 1)
+}
+
+// ForEach calls fn for every i in [0, n) on up to workers goroutines, or
+// MaxParallelism if workers is less than 1. The work of I/O-bound callers,
+// such as calls to a remote model, is not CPU-bound, so they pass their
+// own limit. No calls start once one fails, and the error of the lowest
+// failed i is returned.
+func ForEach(n, workers int, fn func(i int) error) error {
+	if workers < 1 {
+		workers = MaxParallelism()
+	}
+	workers = min(workers, n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Items are claimed in order, so every item before a failed one has
+	// been claimed and runs to completion
+	var next atomic.Int64
+	var failed atomic.Bool
+	var mu sync.Mutex
+	var firstErr error
+	firstFailed := n
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				if err := fn(i); err != nil {
+					failed.Store(true)
+					mu.Lock()
+					if i < firstFailed {
+						firstFailed, firstErr = i, err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// ForEachChunk splits [0, n) into up to MaxParallelism contiguous ranges of
+// at least minChunk items and calls fn for each range in parallel. Work
+// too small for two ranges runs on the calling goroutine. The error of the
+// earliest failed range is returned.
+func ForEachChunk(n, minChunk int, fn func(start, end int) error) error {
+	if n == 0 {
+		return nil
+	}
+	chunks := MaxParallelism()
+	if minChunk > 1 {
+		chunks = min(chunks, n/minChunk)
+	}
+	chunks = max(chunks, 1)
+
+	size := (n + chunks - 1) / chunks
+	return ForEach(chunks, chunks, func(c int) error {
+		start := c * size
+		if start >= n {
+			return nil
+		}
+		return fn(start, min(start+size, n))
+	})
+}
@@ -0,0 +1,118 @@
+package concurrency
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxParallelism(t *testing.T) {
+	defer SetMaxParallelism(0)
+
+	SetMaxParallelism(1)
+	if n := MaxParallelism(); n != 1 {
+		t.Errorf("Expected the configured maximum of 1, got %d", n)
+	}
+
+	// The maximum lowers GOMAXPROCS but never raises it
+	SetMaxParallelism(runtime.GOMAXPROCS(0) + 8)
+	if n := MaxParallelism(); n > runtime.GOMAXPROCS(0) {
+		t.Errorf("Expected at most GOMAXPROCS, got %d", n)
+	}
+}
+
+func TestParseCPUMax(t *testing.T) {
+	tests := map[string]int{
+		"max 100000":     0,
+		"200000 100000":  2,
+		"150000 100000":  2,
+		"50000 100000\n": 1,
+		"-1 100000":      0,
+		"":               0,
+	}
+	for text, want := range tests {
+		if got := parseCPUMax(text); got != want {
+			t.Errorf("parseCPUMax(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var running, peak int32
+	var mu sync.Mutex
+	seen := make([]bool, 20)
+	err := ForEach(len(seen), 3, func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		mu.Lock()
+		peak = max(peak, n)
+		seen[i] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEach failed: %v", err)
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("Expected item %d to be visited", i)
+		}
+	}
+	if peak > 3 {
+		t.Errorf("Expected at most 3 items at once, got %d", peak)
+	}
+
+	// The lowest failure is reported
+	err = ForEach(50, 4, func(i int) error {
+		if i == 7 || i == 9 {
+			return fmt.Errorf("item %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "item 7" {
+		t.Errorf("Expected the error of item 7, got %v", err)
+	}
+}
+
+func TestForEachChunk(t *testing.T) {
+	defer SetMaxParallelism(0)
+	SetMaxParallelism(4)
+
+	var mu sync.Mutex
+	covered := make([]int, 103)
+	var chunks int
+	err := ForEachChunk(len(covered), 10, func(start, end int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		chunks++
+		for i := start; i < end; i++ {
+			covered[i]++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachChunk failed: %v", err)
+	}
+	for i, n := range covered {
+		if n != 1 {
+			t.Fatalf("Expected item %d in exactly one range, got %d", i, n)
+		}
+	}
+	if chunks > MaxParallelism() {
+		t.Errorf("Expected at most %d ranges, got %d", MaxParallelism(), chunks)
+	}
+
+	// Too little work for two ranges of minChunk is not split
+	chunks = 0
+	ForEachChunk(15, 10, func(start, end int) error {
+		chunks++
+		return nil
+	})
+	if chunks != 1 {
+		t.Errorf("Expected 1 range, got %d", chunks)
+	}
+}
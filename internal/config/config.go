@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,23 +14,174 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Storage  StorageConfig  `yaml:"storage"`
 	Vector   VectorConfig   `yaml:"vector"`
-	Indexing IndexingConfig `yaml:"indexing"`
+	Indexing  IndexingConfig  `yaml:"indexing"`
+	Embedding EmbeddingConfig `yaml:"embedding"`
+	LLM       LLMConfig       `yaml:"llm"`
+	Audit     AuditConfig     `yaml:"audit"`
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+	Analysis    AnalysisConfig    `yaml:"analysis"`
+	Extraction  ExtractionConfig  `yaml:"extraction"`
 }
 
 // ServerConfig holds server-related configuration
 type ServerConfig struct {
 	Host string `yaml:"host"`
 	Port int    `yaml:"port"`
+
+	// AllowDestructive permits DROP COLLECTION through /sql
+	AllowDestructive bool `yaml:"allow_destructive"`
+
+	// Rate limits answered with 429 (0 = unlimited)
+	RateLimit            float64 `yaml:"rate_limit"`             // Requests per second across all callers
+	RateBurst            int     `yaml:"rate_burst"`             // Requests admitted at once (default: rate_limit)
+	KeyRateLimit         float64 `yaml:"key_rate_limit"`         // Requests per second per API key or anonymous address
+	KeyRateBurst         int     `yaml:"key_rate_burst"`         // Requests admitted at once per key (default: key_rate_limit)
+	MaxConcurrentQueries int     `yaml:"max_concurrent_queries"` // /sql and /texts/search requests executing at once
+
+	// Memory SELECTs may allocate for candidates, result rows and the
+	// indexes of filtered searches, also in the SQL shell (0 = unlimited)
+	QueryMemoryMB  int64 `yaml:"query_memory_mb"`  // Per query
+	MemoryBudgetMB int64 `yaml:"memory_budget_mb"` // All running queries together
+
+	// Ingestion queue of REST writes, answered with 503 when full (0 = no queue)
+	IngestQueueSize int `yaml:"ingest_queue_size"` // Writes waiting for the store
+	IngestWorkers   int `yaml:"ingest_workers"`    // Writes executed at once (default: 4)
+
+	// Tenants served from <data_dir>/tenants/<id>, keyed by tenant ID
+	Tenants       map[string]TenantConfig `yaml:"tenants"`
+	RequireTenant bool                    `yaml:"require_tenant"` // Reject requests without a tenant
+
+	Debug DebugConfig `yaml:"debug"` // Profiling of the running server
+	Drift DriftConfig `yaml:"drift"` // Monitoring of the vectors written through the server
+}
+
+// DriftConfig enables checks of the vectors written through the server
+// against the stored ones, which warn when a model or pipeline change
+// shifts their norms or their similarity to the centroid
+type DriftConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Interval   time.Duration `yaml:"interval"`    // How often written vectors are checked (default: 1m)
+	MinVectors int           `yaml:"min_vectors"` // Written vectors a check needs (default: 50)
+	Sample     int           `yaml:"sample"`      // Written and stored vectors read per check (default: 1000)
+	Threshold  float64       `yaml:"threshold"`   // Shift of a mean, in stored standard deviations, that warns (default: 1)
+}
+
+// DebugConfig enables the profiling of a running server, to diagnose slow
+// distance kernels or graph traversals in the field
+type DebugConfig struct {
+	Pprof bool `yaml:"pprof"` // Serve net/http/pprof at /debug/pprof/
+
+	// Continuous profiling, taking a CPU and a heap profile every interval
+	ProfileDir      string        `yaml:"profile_dir"`      // Directory of the profiles ("" = disabled)
+	ProfileInterval time.Duration `yaml:"profile_interval"` // How often profiles are taken (default: 5m)
+	ProfileDuration time.Duration `yaml:"profile_duration"` // CPU time sampled per profile (default: 30s)
+	ProfileKeep     int           `yaml:"profile_keep"`     // Profiles of each kind kept (default: 10)
+}
+
+// TenantConfig holds the configuration of one tenant
+type TenantConfig struct {
+	APIKeys    []string `yaml:"api_keys"`    // Keys that select the tenant; without any, the X-Tenant-ID header does
+	MaxVectors int      `yaml:"max_vectors"` // Vectors the tenant may store (0 = unlimited)
+	MaxDiskMB  int64    `yaml:"max_disk_mb"` // Megabytes its data directory may use (0 = unlimited)
+	Policy     string   `yaml:"policy"`      // reject, evict_oldest or evict_least_searched (default: reject)
+}
+
+// QuotaConfig limits the vectors of a collection, or of the IDs starting
+// with a prefix
+type QuotaConfig struct {
+	Prefix     string `yaml:"prefix"`      // ID prefix of the limited vectors ("" = all of them)
+	MaxVectors int    `yaml:"max_vectors"` // Vectors it may hold (0 = unlimited)
+	MaxMB      int64  `yaml:"max_mb"`      // Megabytes of encoded vectors it may hold (0 = unlimited)
+	Policy     string `yaml:"policy"`      // reject, evict_oldest or evict_least_searched (default: reject)
 }
 
 // StorageConfig holds storage-related configuration
 type StorageConfig struct {
-	DataDir string `yaml:"data_dir"`
+	Type    string       `yaml:"type"` // Storage backend: file, s3, sqlite or bolt
+	DataDir string       `yaml:"data_dir"`
+	S3      S3Config     `yaml:"s3"`
+	SQLite  SQLiteConfig `yaml:"sqlite"`
+	Bolt    BoltConfig   `yaml:"bolt"`
+
+	SnapshotDir string `yaml:"snapshot_dir"` // Snapshots of vectors and indexes (default: <data_dir>/snapshots)
+
+	VectorCacheSize int `yaml:"vector_cache_size"` // Decoded vectors kept in an LRU cache (0 = disabled)
+	QueryCacheSize  int `yaml:"query_cache_size"`  // SELECT results reused until the next write (0 = disabled)
+	PlanCacheSize   int `yaml:"plan_cache_size"`   // Parsed statements reused by statements differing only in literals (0 = disabled)
+
+	AccessSampleRate float64 `yaml:"access_sample_rate"` // Share of searches counted in the hits column (0 = disabled)
+
+	Quotas []QuotaConfig `yaml:"quotas"` // Limits on the vectors stored, also applied in every tenant
+
+	Schemas map[string]SchemaConfig `yaml:"schemas"` // Metadata schema of each collection, enforced on writes
+
+	CheckDimensions bool `yaml:"check_dimensions"` // Reject vectors whose dimension differs from their collection's (default: true)
+
+	ReadOnly bool `yaml:"read_only"` // Reject writes and write nothing to data_dir, e.g. for replicas sharing it
+}
+
+// SchemaConfig declares the metadata of the vectors of a collection
+type SchemaConfig struct {
+	Prefix string              `yaml:"prefix"` // ID prefix of the collection's vectors ("" = all of them)
+	Fields []SchemaFieldConfig `yaml:"fields"`
+}
+
+// SchemaFieldConfig declares a metadata key
+type SchemaFieldConfig struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`     // string, int, float, bool, time or geo
+	Required bool   `yaml:"required"` // Writes without a value are rejected
+}
+
+// SQLiteConfig holds configuration for the SQLite backend
+type SQLiteConfig struct {
+	Path string `yaml:"path"` // Database file (default: <data_dir>/vectodb.sqlite)
+}
+
+// BoltConfig holds configuration for the bbolt embedded KV backend
+type BoltConfig struct {
+	Path string `yaml:"path"` // Database file (default: <data_dir>/vectodb.bolt)
+}
+
+// S3Config holds configuration for the S3-compatible object-store backend
+type S3Config struct {
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	PathStyle       bool   `yaml:"path_style"`
+	CacheDir        string `yaml:"cache_dir"`
+	FlushThreshold  int    `yaml:"flush_threshold"`
+
+	Compaction CompactionConfig `yaml:"compaction"` // Background merging of segments
+}
+
+// CompactionConfig configures the background compaction of the segments of
+// the S3 backend, which gives the space of deleted and replaced vectors back
+type CompactionConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Interval        time.Duration `yaml:"interval"`          // How often the segments are checked (default: 1m)
+	MinSegments     int           `yaml:"min_segments"`      // Consecutive segments of similar size merged together (default: 4)
+	MaxGarbageRatio float64       `yaml:"max_garbage_ratio"` // Share of dead records that rewrites every segment (default: 0.5)
+	MaxMBPerSecond  float64       `yaml:"max_mb_per_second"` // Segment megabytes read and written per second (0 = unthrottled)
 }
 
 // VectorConfig holds vector-related configuration
 type VectorConfig struct {
-	DefaultDimension int `yaml:"default_dimension"`
+	DefaultDimension int             `yaml:"default_dimension"`
+	Adapters         []AdapterConfig `yaml:"adapters"` // Projections into default_dimension for other models
+	NonFinite        string          `yaml:"non_finite"` // NaN and infinite values written: reject, zero or allow (default: reject)
+}
+
+// AdapterConfig configures a projection from another dimension into the
+// collection's dimension
+type AdapterConfig struct {
+	Type string `yaml:"type"` // random or matrix
+	From int    `yaml:"from"` // Source dimension (random only; matrix files define their own)
+	Seed int64  `yaml:"seed"` // Seed of the random projection
+	Path string `yaml:"path"` // JSON matrix file with one row per output dimension (matrix only)
 }
 
 // IndexingConfig holds indexing-related configuration
@@ -37,6 +189,121 @@ type IndexingConfig struct {
 	Type           string `yaml:"type"`
 	HNSWMaxLinks   int    `yaml:"hnsw_max_links"`
 	HNSWEFConstruct int    `yaml:"hnsw_ef_construct"`
+	HNSWMaxLinks0   int    `yaml:"hnsw_max_links_level0"` // Links per node at level 0 (0 = twice hnsw_max_links)
+	HNSWSeed        int64  `yaml:"hnsw_seed"` // Build reproducible HNSW graphs from this seed (0 = random)
+	HNSWNearestNeighbors bool `yaml:"hnsw_nearest_neighbors"` // Link the M nearest candidates instead of selecting diverse ones
+	HNSWExtendCandidates bool `yaml:"hnsw_extend_candidates"` // Also consider the candidates' neighbors when selecting links
+	HNSWKeepPruned       bool `yaml:"hnsw_keep_pruned"`       // Fill up to M links with candidates the heuristic discarded
+	HNSWPageCacheBlocks  int  `yaml:"hnsw_page_cache_blocks"` // Read level-0 links of saved HNSW indexes from disk, caching this many blocks of 64 nodes (0 = load whole graphs)
+	TruncateDimensions int `yaml:"truncate_dimensions"` // Search on this many leading dimensions (0 = full vectors)
+	RescoreFactor      int `yaml:"rescore_factor"`      // Candidates per result rescored at full precision (0 = no rescoring)
+	TwoStageCandidates int `yaml:"two_stage_candidates"` // Quantized-scan candidates rescored exactly by flat search (0 = disabled)
+	DistanceBackend    string `yaml:"distance_backend"` // Batch distance backend: auto, cpu or a compiled-in accelerator such as cuda
+	CollectionMetrics  map[string]string `yaml:"collection_metrics"` // Collection -> metric its searches must use
+	Tiering            TieringConfig     `yaml:"tiering"`            // Options of the tiered index type
+}
+
+// TieringConfig configures tiered indexes, which keep the most searched
+// vectors uncompressed and the rest quantized behind centroids. Zero
+// fields take their default.
+type TieringConfig struct {
+	Clusters    int     `yaml:"clusters"`     // Centroids routing searches of cold vectors (default: square root of the vector count)
+	Probes      int     `yaml:"probes"`       // Clusters scanned per search (default: 8)
+	Candidates  int     `yaml:"candidates"`   // Cold candidates rescored from the store (default: 100)
+	HotSize     int     `yaml:"hot_size"`     // Most vectors kept uncompressed (default: 10000)
+	MinHits     float64 `yaml:"min_hits"`     // Search hits a vector needs to be hot (default: 2)
+	HalfLife    int     `yaml:"half_life"`    // Searches after which a hit counts half (default: 10000)
+	RetierEvery int     `yaml:"retier_every"` // Searches between moves of vectors between the tiers (default: 100)
+}
+
+// EmbeddingConfig holds the embedding model registry
+type EmbeddingConfig struct {
+	DefaultModel string                 `yaml:"default_model"` // Logical model used by unbound collections
+	Models       map[string]ModelConfig `yaml:"models"`        // Logical model name -> provider config
+	Collections  map[string]string      `yaml:"collections"`   // Collection -> logical model name
+
+	// Routes embed the texts of a collection in some languages with other
+	// models: collection -> ISO 639-1 language code, or "*" for any other
+	// detected language -> logical model name
+	Routes map[string]map[string]string `yaml:"routes"`
+}
+
+// ModelConfig holds the provider configuration of an embedding model
+type ModelConfig struct {
+	Provider  string `yaml:"provider"`
+	Model     string `yaml:"model"`
+	MaxLength int    `yaml:"max_length"`
+	BatchSize int    `yaml:"batch_size"` // Most inputs sent to the provider in one call
+	Endpoint  string `yaml:"endpoint"`   // API URL of a remote provider such as clip
+	APIKey    string `yaml:"api_key"`    // Sent to a remote provider as a bearer token when set
+	Dimension int    `yaml:"dimension"`  // Dimension of a remote model's vectors (clip default: 512)
+
+	Concurrency int    `yaml:"concurrency"` // Batches embedded at once (default: 4)
+	Truncation  string `yaml:"truncation"`  // Texts over max_length tokens are cut ("truncate", default) or embedded in pieces and averaged ("split")
+
+	// CostPer1KTokens is the price of 1000 input tokens, used to estimate
+	// embedding costs in the metrics
+	CostPer1KTokens float64 `yaml:"cost_per_1k_tokens"`
+
+	// Retries of failed calls (0 = default, negative = disabled)
+	MaxRetries       int           `yaml:"max_retries"`       // Retries after a failed call (default: 3)
+	RetryBackoff     time.Duration `yaml:"retry_backoff"`     // Wait before the first retry, doubled for every further one (default: 200ms)
+	MaxRetryBackoff  time.Duration `yaml:"max_retry_backoff"` // Longest wait between retries (default: 10s)
+	Timeout          time.Duration `yaml:"timeout"`           // Longest a single call may take (default: 1m)
+	BreakerThreshold int           `yaml:"breaker_threshold"` // Consecutive failures that stop calls to the model (default: 5)
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // How long calls are stopped before trying again (default: 30s)
+}
+
+// LLMConfig holds the OpenAI-compatible chat completions endpoint used by
+// the ask command
+type LLMConfig struct {
+	Endpoint    string  `yaml:"endpoint"`    // Chat completions URL; empty only retrieves
+	Model       string  `yaml:"model"`
+	APIKey      string  `yaml:"api_key"`     // Defaults to the OPENAI_API_KEY environment variable
+	MaxTokens   int     `yaml:"max_tokens"`
+	Temperature float64 `yaml:"temperature"`
+}
+
+// AuditConfig holds the audit log of data-modifying operations
+type AuditConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // Log file (default: <data_dir>/audit.log)
+}
+
+// ConcurrencyConfig bounds the goroutines of CPU-bound work: flat scans,
+// index builds and the decoding of imports
+type ConcurrencyConfig struct {
+	// Most goroutines CPU-bound work is spread over (0 = GOMAXPROCS, lowered
+	// to the CPU quota of the container)
+	MaxParallelism int `yaml:"max_parallelism"`
+}
+
+// AnalysisConfig holds the analyzers that turn text into the terms keyword
+// matching compares, such as the highlighting of text search results
+type AnalysisConfig struct {
+	Default     AnalyzerConfig            `yaml:"default"`     // Analyzer of collections without their own
+	Collections map[string]AnalyzerConfig `yaml:"collections"` // Collection -> analyzer
+}
+
+// AnalyzerConfig configures an analyzer
+type AnalyzerConfig struct {
+	Language     string   `yaml:"language"`      // Built-in stopwords and stemmer: english, or none (default)
+	KeepCase     bool     `yaml:"keep_case"`     // Match words case-sensitively
+	Stopwords    []string `yaml:"stopwords"`     // Words to ignore in addition to the language's
+	Stemming     bool     `yaml:"stemming"`      // Match words by their stem, e.g. "indexes" and "index"
+	Synonyms     []string `yaml:"synonyms"`      // Groups of equivalent words, e.g. "car, automobile, auto"
+	SynonymsFile string   `yaml:"synonyms_file"` // More groups, one per line
+}
+
+// ExtractionConfig holds how embed and watch get the text of binary files:
+// PDF, Word and OpenDocument files hold their text, while audio and images
+// need a transcription or OCR endpoint
+type ExtractionConfig struct {
+	Enabled               bool          `yaml:"enabled"`                // Extract the text of binary files instead of skipping them (default: true)
+	TranscriptionEndpoint string        `yaml:"transcription_endpoint"` // Receives audio files and returns {"text": ...}
+	OCREndpoint           string        `yaml:"ocr_endpoint"`           // Receives images and returns {"text": ...}
+	APIKey                string        `yaml:"api_key"`                // Sent to the endpoints as a bearer token when set
+	Timeout               time.Duration `yaml:"timeout"`                // Longest an endpoint may take (default: 2m)
 }
 
 // DefaultConfig returns the default configuration
@@ -47,7 +314,15 @@ func DefaultConfig() *Config {
 			Port: 8080,
 		},
 		Storage: StorageConfig{
+			Type:    "file",
 			DataDir: "./data",
+			CheckDimensions: true,
+			PlanCacheSize:   256,
+			AccessSampleRate: 1,
+			S3: S3Config{
+				Region:         "us-east-1",
+				FlushThreshold: 256,
+			},
 		},
 		Vector: VectorConfig{
 			DefaultDimension: 128,
@@ -57,6 +332,24 @@ func DefaultConfig() *Config {
 			HNSWMaxLinks:   16,
 			HNSWEFConstruct: 200,
 		},
+		Embedding: EmbeddingConfig{
+			DefaultModel: "minilm",
+			Models: map[string]ModelConfig{
+				"minilm": {
+					Provider:  "huggingface",
+					Model:     "sentence-transformers/all-MiniLM-L6-v2",
+					MaxLength: 256,
+					BatchSize: 32,
+				},
+			},
+			Collections: map[string]string{},
+		},
+		Audit: AuditConfig{
+			Enabled: true,
+		},
+		Extraction: ExtractionConfig{
+			Enabled: true,
+		},
 	}
 }
 
@@ -0,0 +1,236 @@
+// Package analysis turns text into the terms keyword matching compares:
+// words are lowercased, stopwords dropped and the rest reduced to their
+// stems, and query terms are expanded with their synonyms. Each collection
+// can have its own analyzer, so matching suits its language and domain.
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Token is a term of a text with the byte range of the word it came from
+type Token struct {
+	Term  string `json:"term"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// Options configures an Analyzer
+type Options struct {
+	// Language selects built-in stopwords and a stemmer: "english", or ""
+	// or "none" for neither
+	Language string
+
+	// KeepCase leaves words in their case instead of lowercasing them
+	KeepCase bool
+
+	// Stopwords are dropped in addition to the language's
+	Stopwords []string
+
+	// Stemming reduces words to their stem with the language's stemmer, so
+	// "indexes" matches "index"
+	Stemming bool
+
+	// Synonyms are groups of equivalent words, each separated by commas as
+	// in "car, automobile, auto". A query for one matches them all.
+	Synonyms []string
+
+	// SynonymsFile holds more groups, one per line. Empty lines and lines
+	// starting with # are skipped.
+	SynonymsFile string
+}
+
+// Analyzer turns text into terms. It is safe for concurrent use.
+type Analyzer struct {
+	lowercase bool
+	stopwords map[string]bool
+	stem      func(string) string
+	synonyms  map[string][]string // Term -> every term of its groups
+}
+
+// Standard returns the analyzer used when none is configured: it lowercases
+// words and keeps them all
+func Standard() *Analyzer {
+	return &Analyzer{lowercase: true, stopwords: map[string]bool{}}
+}
+
+// New creates an analyzer
+func New(opts Options) (*Analyzer, error) {
+	a := &Analyzer{lowercase: !opts.KeepCase, stopwords: make(map[string]bool)}
+
+	language := strings.ToLower(opts.Language)
+	switch language {
+	case "", "none":
+		if opts.Stemming {
+			return nil, fmt.Errorf("stemming needs a language")
+		}
+	case "english":
+		for _, word := range englishStopwords {
+			a.stopwords[word] = true
+		}
+		if opts.Stemming {
+			a.stem = stemEnglish
+		}
+	default:
+		return nil, fmt.Errorf("unsupported analyzer language: %s (use english or none)", opts.Language)
+	}
+	for _, word := range opts.Stopwords {
+		a.stopwords[a.normalize(strings.TrimSpace(word))] = true
+	}
+
+	groups := opts.Synonyms
+	if opts.SynonymsFile != "" {
+		lines, err := readLines(opts.SynonymsFile)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups[:len(groups):len(groups)], lines...)
+	}
+	for _, group := range groups {
+		a.addSynonyms(group)
+	}
+	return a, nil
+}
+
+// Analyze returns the terms of text in order
+func (a *Analyzer) Analyze(text string) []Token {
+	var tokens []Token
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		if term, ok := a.term(text[start:end]); ok {
+			tokens = append(tokens, Token{Term: term, Start: start, End: end})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// QueryTerms returns the distinct terms of a query with their synonyms
+func (a *Analyzer) QueryTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for _, token := range a.Analyze(query) {
+		add(token.Term)
+		for _, synonym := range a.synonyms[token.Term] {
+			add(synonym)
+		}
+	}
+	return terms
+}
+
+// Stemming reports whether the analyzer reduces words to their stems
+func (a *Analyzer) Stemming() bool {
+	return a.stem != nil
+}
+
+// term turns a word into its term, or reports that it is a stopword
+func (a *Analyzer) term(word string) (string, bool) {
+	word = a.normalize(word)
+	if a.stopwords[word] {
+		return "", false
+	}
+	if a.stem != nil {
+		word = a.stem(word)
+	}
+	return word, true
+}
+
+// normalize applies the analyzer's case folding
+func (a *Analyzer) normalize(word string) string {
+	if a.lowercase {
+		return strings.ToLower(word)
+	}
+	return word
+}
+
+// addSynonyms makes the words of a comma-separated group synonyms of each
+// other. Words are analyzed like text, so they match however they are
+// inflected if stemming is on.
+func (a *Analyzer) addSynonyms(group string) {
+	var terms []string
+	for _, word := range strings.Split(group, ",") {
+		if term, ok := a.term(strings.TrimSpace(word)); ok && term != "" {
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) < 2 {
+		return
+	}
+	if a.synonyms == nil {
+		a.synonyms = make(map[string][]string)
+	}
+	for _, term := range terms {
+		a.synonyms[term] = append(a.synonyms[term], terms...)
+	}
+}
+
+// readLines returns the lines of a file that are not empty or comments
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read synonyms: %w", err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read synonyms: %w", err)
+	}
+	return lines, nil
+}
+
+// Set holds the analyzers of collections
+type Set struct {
+	standard    *Analyzer
+	collections map[string]*Analyzer
+}
+
+// NewSet creates a set of analyzers using standard for collections without
+// their own, or Standard() if it is nil
+func NewSet(standard *Analyzer, collections map[string]*Analyzer) *Set {
+	if standard == nil {
+		standard = Standard()
+	}
+	return &Set{standard: standard, collections: collections}
+}
+
+// For returns the analyzer of a collection. A nil set returns Standard().
+func (s *Set) For(collection string) *Analyzer {
+	if s == nil {
+		return Standard()
+	}
+	if a, ok := s.collections[collection]; ok {
+		return a
+	}
+	return s.standard
+}
@@ -0,0 +1,70 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func terms(tokens []Token) []string {
+	out := make([]string, len(tokens))
+	for i, token := range tokens {
+		out[i] = token.Term
+	}
+	return out
+}
+
+func TestStandard(t *testing.T) {
+	tokens := Standard().Analyze("The HNSW index, v2!")
+	assert.Equal(t, []string{"the", "hnsw", "index", "v2"}, terms(tokens))
+	assert.Equal(t, Token{Term: "hnsw", Start: 4, End: 8}, tokens[1])
+}
+
+func TestEnglish(t *testing.T) {
+	a, err := New(Options{Language: "english", Stemming: true, Stopwords: []string{"Vector"}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index", "index", "index", "stor", "stor", "run", "query"},
+		terms(a.Analyze("the vector indexes indexed indexing: stored in a store, running queries")))
+	assert.True(t, a.Stemming())
+
+	_, err = New(Options{Stemming: true})
+	assert.Error(t, err)
+	_, err = New(Options{Language: "klingon"})
+	assert.Error(t, err)
+}
+
+func TestStemEnglish(t *testing.T) {
+	stems := map[string]string{
+		"indexes": "index", "databases": "databas", "database": "databas",
+		"stopped": "stop", "sing": "sing", "red": "red", "class": "class",
+		"status": "status", "analysis": "analysis", "bodies": "body",
+	}
+	for word, want := range stems {
+		assert.Equal(t, want, stemEnglish(word), word)
+	}
+}
+
+func TestSynonyms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "synonyms.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# vehicles\nbike, bicycle\n\n"), 0644))
+
+	a, err := New(Options{Language: "english", Stemming: true, Synonyms: []string{"car, automobile, auto"}, SynonymsFile: path})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"car", "automobil", "auto"}, a.QueryTerms("the cars"))
+	assert.Equal(t, []string{"bicycl", "bik"}, a.QueryTerms("bicycles"))
+
+	_, err = New(Options{SynonymsFile: filepath.Join(t.TempDir(), "missing.txt")})
+	assert.Error(t, err)
+}
+
+func TestSet(t *testing.T) {
+	english, _ := New(Options{Language: "english"})
+	set := NewSet(nil, map[string]*Analyzer{"docs": english})
+	assert.Empty(t, set.For("docs").Analyze("the"))
+	assert.Len(t, set.For("other").Analyze("the"), 1)
+
+	var unset *Set
+	assert.Len(t, unset.For("docs").Analyze("the"), 1)
+}
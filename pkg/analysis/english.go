@@ -0,0 +1,55 @@
+package analysis
+
+import "strings"
+
+// englishStopwords are the English words too common to tell texts apart
+var englishStopwords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "but", "by", "for", "if", "in",
+	"into", "is", "it", "no", "not", "of", "on", "or", "such", "that", "the",
+	"their", "then", "there", "these", "they", "this", "to", "was", "will",
+	"with",
+}
+
+// stemEnglish is a light English stemmer. It strips the plural and verb
+// endings -s, -es, -ies, -ed and -ing and a final e, so "index", "indexes",
+// "indexed" and "indexing", or "store" and "stored", share a stem. Unlike
+// Porter's stemmer it leaves derivations such as -ation and -ness alone.
+func stemEnglish(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies") && len(word) > 4:
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "zes"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ing") && len(word) > 5 && hasVowel(word[:len(word)-3]):
+		word = undouble(word[:len(word)-3])
+	case strings.HasSuffix(word, "ed") && len(word) > 4 && hasVowel(word[:len(word)-2]):
+		word = undouble(word[:len(word)-2])
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") &&
+		!strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+	if len(word) > 3 && strings.HasSuffix(word, "e") {
+		word = word[:len(word)-1]
+	}
+	return word
+}
+
+// undouble drops the second of a doubled final consonant left by removing
+// an ending, as in "running" and "stopped"
+func undouble(stem string) string {
+	n := len(stem)
+	if n >= 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeioulsz", rune(stem[n-1])) {
+		return stem[:n-1]
+	}
+	return stem
+}
+
+// hasVowel reports whether s contains a vowel, so "sing" and "red" keep
+// their endings
+func hasVowel(s string) bool {
+	return strings.ContainsAny(s, "aeiouy")
+}
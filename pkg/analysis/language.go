@@ -0,0 +1,173 @@
+package analysis
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Languages detected by DetectLanguage, as ISO 639-1 codes
+const (
+	LanguageEnglish    = "en"
+	LanguageFrench     = "fr"
+	LanguageGerman     = "de"
+	LanguageSpanish    = "es"
+	LanguageItalian    = "it"
+	LanguagePortuguese = "pt"
+	LanguageDutch      = "nl"
+	LanguageRussian    = "ru"
+	LanguageGreek      = "el"
+	LanguageArabic     = "ar"
+	LanguageHebrew     = "he"
+	LanguageHindi      = "hi"
+	LanguageThai       = "th"
+	LanguageChinese    = "zh"
+	LanguageJapanese   = "ja"
+	LanguageKorean     = "ko"
+)
+
+// scripts maps the writing systems that mostly belong to one language to
+// that language
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Cyrillic, LanguageRussian},
+	{unicode.Greek, LanguageGreek},
+	{unicode.Arabic, LanguageArabic},
+	{unicode.Hebrew, LanguageHebrew},
+	{unicode.Devanagari, LanguageHindi},
+	{unicode.Thai, LanguageThai},
+	{unicode.Hangul, LanguageKorean},
+	{unicode.Hiragana, LanguageJapanese},
+	{unicode.Katakana, LanguageJapanese},
+	{unicode.Han, LanguageChinese},
+}
+
+// commonWords are the most frequent words of the languages written in the
+// Latin alphabet, which tell them apart even in short texts
+var commonWords = map[string][]string{
+	LanguageEnglish: {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "as", "was", "on",
+		"are", "this", "be", "by", "not", "you", "have", "from", "or", "an", "which", "at", "how", "what"},
+	LanguageFrench: {"le", "la", "les", "de", "des", "et", "est", "un", "une", "du", "en", "que", "qui",
+		"dans", "pour", "pas", "sur", "au", "avec", "ce", "il", "elle", "sont", "par", "plus", "comment"},
+	LanguageGerman: {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von",
+		"sich", "des", "auf", "für", "im", "dem", "auch", "es", "sie", "werden", "wird", "sind", "oder", "wie"},
+	LanguageSpanish: {"el", "la", "los", "las", "de", "y", "que", "en", "un", "una", "es", "por", "con",
+		"para", "no", "del", "se", "lo", "al", "como", "más", "pero", "sus", "está", "son", "cómo"},
+	LanguageItalian: {"il", "lo", "la", "gli", "le", "di", "e", "che", "è", "un", "una", "per", "non",
+		"con", "del", "della", "sono", "si", "da", "in", "al", "come", "anche", "più", "questo", "nel"},
+	LanguagePortuguese: {"o", "a", "os", "as", "de", "e", "que", "em", "um", "uma", "é", "do", "da",
+		"para", "não", "com", "por", "se", "dos", "das", "mais", "como", "mas", "são", "no", "na"},
+	LanguageDutch: {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met",
+		"voor", "die", "in", "er", "aan", "ook", "als", "maar", "om", "bij", "wordt", "naar", "dan", "hoe"},
+}
+
+// letterHints are letters that only some Latin-alphabet languages use
+var letterHints = map[rune][]string{
+	'é': {LanguageFrench, LanguageSpanish, LanguagePortuguese, LanguageItalian},
+	'è': {LanguageFrench, LanguageItalian},
+	'ê': {LanguageFrench, LanguagePortuguese},
+	'à': {LanguageFrench, LanguageItalian, LanguagePortuguese},
+	'ç': {LanguageFrench, LanguagePortuguese},
+	'œ': {LanguageFrench},
+	'ù': {LanguageFrench, LanguageItalian},
+	'ä': {LanguageGerman},
+	'ö': {LanguageGerman},
+	'ü': {LanguageGerman},
+	'ß': {LanguageGerman},
+	'ñ': {LanguageSpanish},
+	'¿': {LanguageSpanish},
+	'¡': {LanguageSpanish},
+	'ã': {LanguagePortuguese},
+	'õ': {LanguagePortuguese},
+	'ì': {LanguageItalian},
+	'ò': {LanguageItalian},
+}
+
+// wordLanguages maps each common word to the languages it is common in
+var wordLanguages = func() map[string][]string {
+	m := make(map[string][]string)
+	for language, words := range commonWords {
+		for _, word := range words {
+			m[word] = append(m[word], language)
+		}
+	}
+	return m
+}()
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written
+// in, or "" if it cannot tell. Texts in a script used by mostly one language,
+// such as Cyrillic or Hangul, are identified by their script. Texts in the
+// Latin alphabet are identified by their most common words and accented
+// letters, as English, French, German, Spanish, Italian, Portuguese or
+// Dutch; short texts without common words, such as many search queries, are
+// undetermined.
+func DetectLanguage(text string) string {
+	counts := make([]int, len(scripts))
+	latin := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for i, script := range scripts {
+			if unicode.Is(script.table, r) {
+				counts[i]++
+				break
+			}
+		}
+	}
+
+	// Japanese mixes kana with Han characters, so any kana makes it Japanese
+	best, bestCount := "", latin
+	for i, script := range scripts {
+		count := counts[i]
+		if script.language == LanguageJapanese && count > 0 {
+			count += counts[len(scripts)-1]
+		}
+		if count > bestCount {
+			best, bestCount = script.language, count
+		}
+	}
+	if best != "" {
+		return best
+	}
+	if latin == 0 {
+		return ""
+	}
+	return detectLatin(text)
+}
+
+// detectLatin scores the languages written in the Latin alphabet by their
+// common words and letters in text, and returns the best unless it ties
+func detectLatin(text string) string {
+	scores := make(map[string]int)
+	lower := strings.ToLower(text)
+	for _, word := range strings.FieldsFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for _, language := range wordLanguages[word] {
+			scores[language] += 2
+		}
+	}
+	for _, r := range lower {
+		for _, language := range letterHints[r] {
+			scores[language]++
+		}
+	}
+
+	best, bestScore, tied := "", 0, false
+	for language, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = language, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if tied {
+		return ""
+	}
+	return best
+}
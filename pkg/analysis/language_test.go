@@ -0,0 +1,31 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"The quick brown fox jumps over the lazy dog": LanguageEnglish,
+		"how does it work":                    LanguageEnglish,
+		"Le chat est sur la table":            LanguageFrench,
+		"Der Hund ist nicht im Haus":          LanguageGerman,
+		"El perro está en la casa":            LanguageSpanish,
+		"¿Cómo funciona?":                     LanguageSpanish,
+		"Il gatto è sulla tavola con il cane": LanguageItalian,
+		"O gato está em casa com o cão":       LanguagePortuguese,
+		"De hond is in het huis":              LanguageDutch,
+		"Привет мир":                          LanguageRussian,
+		"你好世界":                                LanguageChinese,
+		"こんにちは世界":                             LanguageJapanese,
+		"안녕하세요":                               LanguageKorean,
+		"vector database":                     "",
+		"12345 !?":                            "",
+		"":                                    "",
+	}
+	for text, want := range cases {
+		assert.Equal(t, want, DetectLanguage(text), text)
+	}
+}
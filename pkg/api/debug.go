@@ -0,0 +1,35 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// SetPprof serves the profiles of net/http/pprof at /debug/pprof/, e.g.
+// /debug/pprof/profile?seconds=30 for the CPU. They reveal the internals of
+// the process, so they are disabled by default.
+func (s *Server) SetPprof(enabled bool) {
+	s.pprof = enabled
+}
+
+// handlePprof serves the index and profiles of net/http/pprof
+func (s *Server) handlePprof(w http.ResponseWriter, r *http.Request) {
+	if !s.pprof {
+		writeError(w, http.StatusNotFound, errors.New("pprof is disabled; set server.debug.pprof"))
+		return
+	}
+	switch strings.TrimPrefix(r.URL.Path, "/debug/pprof/") {
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Index(w, r)
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/audit"
+	"github.com/ken/vector_database/pkg/embedding"
+)
+
+// handleDocument lists the chunks of a document (GET) or deletes the
+// document with all its chunks (DELETE)
+func (s *Server) handleDocument(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/documents/")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing document id"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		chunks, err := embedding.DocumentChunks(s.store, s.docsDir, id)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"id": id, "chunks": chunks})
+	case http.MethodDelete:
+		var n int
+		err := s.ingest.do(func() (err error) {
+			n, err = embedding.DeleteDocument(s.store, s.docsDir, id)
+			return err
+		})
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpDelete, n, err)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"deleted": n})
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleContext returns a chunk with the chunks around it in its document,
+// ?before=1&after=1 by default
+func (s *Server) handleContext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/context/")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing chunk id"))
+		return
+	}
+
+	query := r.URL.Query()
+	span := map[string]int{"before": 1, "after": 1}
+	for name := range span {
+		if v := query.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %s", name, v))
+				return
+			}
+			span[name] = n
+		}
+	}
+
+	window, err := embedding.ContextWindow(s.store, s.docsDir, id, span["before"], span["after"])
+	if err != nil {
+		writeError(w, storeErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, window)
+}
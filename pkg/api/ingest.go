@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultIngestWorkers is the number of workers of an ingestion queue that
+// does not set its own
+const DefaultIngestWorkers = 4
+
+// errIngestQueueFull is returned when the ingestion queue has no room for
+// another write
+var errIngestQueueFull = errors.New("ingestion queue full")
+
+// ingestQueue hands the writes of the API to a fixed number of workers
+// through a bounded queue. Callers wait for their write to finish, so a
+// full queue means the store cannot keep up, and further writes are turned
+// away at once instead of piling up in memory.
+type ingestQueue struct {
+	jobs    chan ingestJob
+	workers int
+
+	writes   atomic.Uint64
+	rejected atomic.Uint64
+	latency  atomic.Int64 // Smoothed duration of a write in nanoseconds
+}
+
+// ingestJob is a queued write and where its outcome is sent
+type ingestJob struct {
+	write func() error
+	done  chan error
+}
+
+// newIngestQueue starts the workers of a queue holding up to size writes
+func newIngestQueue(size, workers int) *ingestQueue {
+	if workers < 1 {
+		workers = DefaultIngestWorkers
+	}
+	q := &ingestQueue{jobs: make(chan ingestJob, size), workers: workers}
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+	return q
+}
+
+// run executes queued writes until the queue is closed
+func (q *ingestQueue) run() {
+	for job := range q.jobs {
+		start := time.Now()
+		err := job.write()
+		elapsed := int64(time.Since(start))
+		q.latency.Store((q.latency.Load()*7 + elapsed) / 8)
+		q.writes.Add(1)
+		job.done <- err
+	}
+}
+
+// do runs write on a worker and returns its error, or errIngestQueueFull
+// without running it if the queue is full. Without a queue the write runs
+// on the caller's goroutine.
+func (q *ingestQueue) do(write func() error) error {
+	if q == nil {
+		return write()
+	}
+
+	job := ingestJob{write: write, done: make(chan error, 1)}
+	select {
+	case q.jobs <- job:
+	default:
+		q.rejected.Add(1)
+		return errIngestQueueFull
+	}
+	return <-job.done
+}
+
+// retryAfter estimates how long the queued writes take to drain
+func (q *ingestQueue) retryAfter() time.Duration {
+	return time.Duration(int64(len(q.jobs)) * q.latency.Load() / int64(q.workers))
+}
+
+// close stops the workers once the queued writes are done
+func (q *ingestQueue) close() {
+	if q != nil {
+		close(q.jobs)
+	}
+}
+
+// writeMetrics writes the queue's gauges and counters in the Prometheus
+// text format
+func (q *ingestQueue) writeMetrics(w io.Writer) {
+	if q == nil {
+		return
+	}
+	fmt.Fprintf(w, "# HELP vectodb_ingest_queue_depth Writes waiting in the ingestion queue.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_ingest_queue_depth gauge\n")
+	fmt.Fprintf(w, "vectodb_ingest_queue_depth %d\n", len(q.jobs))
+	fmt.Fprintf(w, "# HELP vectodb_ingest_queue_capacity Writes the ingestion queue holds.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_ingest_queue_capacity gauge\n")
+	fmt.Fprintf(w, "vectodb_ingest_queue_capacity %d\n", cap(q.jobs))
+	fmt.Fprintf(w, "# HELP vectodb_ingest_writes_total Writes executed by the ingestion queue.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_ingest_writes_total counter\n")
+	fmt.Fprintf(w, "vectodb_ingest_writes_total %d\n", q.writes.Load())
+	fmt.Fprintf(w, "# HELP vectodb_ingest_rejected_total Writes rejected with 503 because the ingestion queue was full.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_ingest_rejected_total counter\n")
+	fmt.Fprintf(w, "vectodb_ingest_rejected_total %d\n", q.rejected.Load())
+}
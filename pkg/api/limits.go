@@ -0,0 +1,194 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxKeyBuckets bounds the per-key buckets kept before idle ones are dropped
+const maxKeyBuckets = 10000
+
+var (
+	// errRateLimited is returned to callers over the global or their key's rate
+	errRateLimited = errors.New("rate limit exceeded")
+
+	// errTooManyQueries is returned when the concurrent query limit is reached
+	errTooManyQueries = errors.New("too many concurrent queries")
+)
+
+// Limits configures the server's rate and concurrency limits. Zero values
+// disable a limit.
+type Limits struct {
+	Rate     float64 // Requests per second across all callers
+	Burst    int     // Requests admitted at once (default: Rate rounded up)
+	KeyRate  float64 // Requests per second per API key, or per address for anonymous callers
+	KeyBurst int     // Requests admitted at once per key (default: KeyRate rounded up)
+
+	// MaxConcurrentQueries bounds the /sql and /texts/search requests
+	// executing at once
+	MaxConcurrentQueries int
+}
+
+// tokenBucket admits requests at a steady rate with bursts of up to its
+// capacity
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token if one is available. Otherwise it returns how long
+// until the next token.
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) (bool, time.Duration) {
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled to burst by now
+func (b *tokenBucket) full(now time.Time, rate float64, burst int) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*rate >= float64(burst)
+}
+
+// limiter enforces Limits and counts what it admitted and rejected
+type limiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	global  *tokenBucket
+	keys    map[string]*tokenBucket
+	queries int // Queries executing now
+	now     func() time.Time
+
+	requests       uint64
+	rateLimited    uint64 // By the global rate
+	keyRateLimited uint64
+	queryLimited   uint64
+}
+
+func newLimiter() *limiter {
+	return &limiter{keys: make(map[string]*tokenBucket), now: time.Now}
+}
+
+// burst returns the configured burst, or rate rounded up
+func burst(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Ceil(rate))
+}
+
+// set replaces the limits. Buckets start full.
+func (l *limiter) set(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limits.Burst = burst(limits.Rate, limits.Burst)
+	limits.KeyBurst = burst(limits.KeyRate, limits.KeyBurst)
+	l.limits = limits
+	l.global = &tokenBucket{tokens: float64(limits.Burst), last: l.now()}
+	l.keys = make(map[string]*tokenBucket)
+}
+
+// admit takes a token from key's bucket and from the global bucket
+func (l *limiter) admit(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.requests++
+	now := l.now()
+
+	// Callers over their own limit are turned away before they use up
+	// tokens everyone shares
+	if l.limits.KeyRate > 0 {
+		b, ok := l.keys[key]
+		if !ok {
+			if len(l.keys) >= maxKeyBuckets {
+				l.pruneKeys(now)
+			}
+			b = &tokenBucket{tokens: float64(l.limits.KeyBurst), last: now}
+			l.keys[key] = b
+		}
+		if ok, wait := b.take(now, l.limits.KeyRate, l.limits.KeyBurst); !ok {
+			l.keyRateLimited++
+			return false, wait
+		}
+	}
+	if l.limits.Rate > 0 {
+		if ok, wait := l.global.take(now, l.limits.Rate, l.limits.Burst); !ok {
+			l.rateLimited++
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// pruneKeys drops the buckets of keys that have been idle long enough to
+// refill, which behave the same as new buckets
+func (l *limiter) pruneKeys(now time.Time) {
+	for key, b := range l.keys {
+		if b.full(now, l.limits.KeyRate, l.limits.KeyBurst) {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// acquireQuery reserves a query slot. The returned function releases it.
+func (l *limiter) acquireQuery() (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if max := l.limits.MaxConcurrentQueries; max > 0 && l.queries >= max {
+		l.queryLimited++
+		return nil, false
+	}
+	l.queries++
+	return func() {
+		l.mu.Lock()
+		l.queries--
+		l.mu.Unlock()
+	}, true
+}
+
+// writeMetrics writes the limiter's counters in the Prometheus text format
+func (l *limiter) writeMetrics(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP vectodb_http_requests_total Requests received, including rejected ones.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_http_requests_total counter\n")
+	fmt.Fprintf(w, "vectodb_http_requests_total %d\n", l.requests)
+	fmt.Fprintf(w, "# HELP vectodb_http_rate_limited_total Requests rejected with 429 by a rate limit.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_http_rate_limited_total counter\n")
+	fmt.Fprintf(w, "vectodb_http_rate_limited_total{limit=\"global\"} %d\n", l.rateLimited)
+	fmt.Fprintf(w, "vectodb_http_rate_limited_total{limit=\"key\"} %d\n", l.keyRateLimited)
+	fmt.Fprintf(w, "vectodb_http_rate_limited_total{limit=\"concurrent_queries\"} %d\n", l.queryLimited)
+	fmt.Fprintf(w, "# HELP vectodb_queries_in_flight Queries executing now.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_queries_in_flight gauge\n")
+	fmt.Fprintf(w, "vectodb_queries_in_flight %d\n", l.queries)
+}
+
+// writeTooManyRequests rejects a request with 429, telling the caller when
+// to retry
+func writeTooManyRequests(w http.ResponseWriter, wait time.Duration, err error) {
+	writeRetryAfter(w, http.StatusTooManyRequests, wait, err)
+}
+
+// writeRetryAfter rejects a request with status and a Retry-After header of
+// at least a second
+func writeRetryAfter(w http.ResponseWriter, status int, wait time.Duration, err error) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, status, err)
+}
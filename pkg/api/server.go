@@ -0,0 +1,1064 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/analysis"
+	"github.com/ken/vector_database/pkg/audit"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/drift"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/index/twostage"
+	"github.com/ken/vector_database/pkg/snapshot"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/ken/vector_database/pkg/vectorstore"
+)
+
+const (
+	// textCollection is the collection whose embedding model /texts uses
+	textCollection = "vectors"
+
+	// eventBufferSize is the per-client buffer of the event stream
+	eventBufferSize = 256
+
+	// heartbeatInterval keeps idle event streams alive through proxies
+	heartbeatInterval = 15 * time.Second
+)
+
+// Server exposes a vector store over HTTP
+type Server struct {
+	store     *storage.ObservableStore
+	executor  *executor.QueryExecutor
+	metric    distance.Metric
+	texts     *vectorstore.VectorStore   // Set once an embedding registry is configured
+	models    *embedding.Registry        // Embedding models whose calls /metrics reports
+	analyzers *analysis.Set              // Keyword analyzers of collections, for highlighting
+	audit     *audit.Log                 // Records writes when set
+	snapshots string                     // Snapshot directory; empty disables /snapshots
+	docsDir   string                     // Text of embedded chunks, read by /documents and /context
+	indexes   *executor.IndexCache       // Indexes reused by /sql nearest-neighbor searches
+	results   *executor.ResultCache      // Results reused by /sql SELECTs; nil when disabled
+	plans     *executor.PlanCache        // Parses reused by /sql statements; nil when disabled
+	memory    *executor.MemoryAccountant // Memory budgets of /sql queries; nil when unlimited
+	drift     *drift.Monitor             // Drift of written vectors, reported by /metrics and /stats
+	limits    *limiter
+	ingest    *ingestQueue // Bounds the REST writes waiting for the store; nil runs them directly
+	readOnly  bool         // Writes are rejected with 403
+	pprof     bool         // /debug/pprof/ serves profiles
+	mux       *http.ServeMux
+
+	rebuildMu  sync.Mutex
+	rebuildErr error // Error of the last background index rebuild
+}
+
+// NewServer creates a new HTTP server for the given store. Writes made
+// through the server are published on the /events stream and can be held
+// back briefly while a snapshot is taken.
+func NewServer(store storage.VectorStore, indexType executor.IndexType, metric distance.Metric) *Server {
+	observable, ok := store.(*storage.ObservableStore)
+	if !ok {
+		observable = storage.NewObservableStore(storage.NewGatedStore(store))
+	}
+
+	s := &Server{
+		store:    observable,
+		executor: executor.NewQueryExecutor(observable, indexType, metric),
+		metric:   metric,
+		limits:   newLimiter(),
+		mux:      http.NewServeMux(),
+	}
+	s.executor.SetAllowDrop(false)
+	s.SetReadOnly(storage.IsReadOnly(store))
+	s.SetIndexCache(executor.NewIndexCache(""))
+	catalog, _ := executor.OpenCatalog("")
+	s.executor.SetCatalog(catalog)
+
+	// Writes from any endpoint make cached indexes stale
+	observable.Subscribe(func(storage.Event) {
+		s.indexes.Invalidate()
+	})
+
+	s.mux.HandleFunc("/health", s.handleHealth)
+	s.mux.HandleFunc("/stats", s.handleStats)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/vectors", s.handleVectors)
+	s.mux.HandleFunc("/vectors/", s.handleVector)
+	s.mux.HandleFunc("/documents/", s.handleDocument)
+	s.mux.HandleFunc("/context/", s.handleContext)
+	s.mux.HandleFunc("/sql", s.handleSQL)
+	s.mux.HandleFunc("/events", s.handleEvents)
+	s.mux.HandleFunc("/changes", s.handleChanges)
+	s.mux.HandleFunc("/texts", s.handleTexts)
+	s.mux.HandleFunc("/texts/search", s.handleTextSearch)
+	s.mux.HandleFunc("/snapshots", s.handleSnapshots)
+	s.mux.HandleFunc("/indexes", s.handleIndexes)
+	s.mux.HandleFunc("/indexes/rebuild", s.handleIndexRebuild)
+	s.mux.HandleFunc("/indexes/stats", s.handleIndexStats)
+	s.mux.HandleFunc("/models/stats", s.handleModelStats)
+	s.mux.HandleFunc("/debug/pprof/", s.handlePprof)
+	s.mux.Handle("/ui/", uiHandler())
+	s.mux.Handle("/ui", http.RedirectHandler("/ui/", http.StatusMovedPermanently))
+
+	return s
+}
+
+// Store returns the observable store used by the server, so other
+// components can subscribe to changes
+func (s *Server) Store() *storage.ObservableStore {
+	return s.store
+}
+
+// SetModelRegistry sets the embedding model registry used by EMBEDDING() in
+// /sql and enables the /texts endpoints for RAG frameworks
+func (s *Server) SetModelRegistry(models *embedding.Registry) {
+	s.executor.SetModelRegistry(models)
+	s.models = models
+	if models != nil {
+		s.texts = vectorstore.New(s.store, vectorstore.NewRegistryEmbedder(models, textCollection), s.metric, nil)
+	}
+}
+
+// SetAnalyzers sets the keyword analyzers that /texts/search highlights
+// matches with
+func (s *Server) SetAnalyzers(analyzers *analysis.Set) {
+	s.analyzers = analyzers
+}
+
+// SetVectorAdapter sets the adapter that maps /sql query vectors of other
+// dimensions into the collection's dimension
+func (s *Server) SetVectorAdapter(adapter storage.VectorAdapter) {
+	s.executor.SetVectorAdapter(adapter)
+}
+
+// SetTruncation enables /sql nearest-neighbor search on a truncated prefix of
+// the vector dimensions
+func (s *Server) SetTruncation(opts *matryoshka.Options) {
+	s.executor.SetTruncation(opts)
+}
+
+// SetTwoStage enables quantized scanning with exact rescoring for /sql
+// nearest-neighbor search on flat indexes
+func (s *Server) SetTwoStage(opts *twostage.Options) {
+	s.executor.SetTwoStage(opts)
+}
+
+// SetTiering sets the options of tiered indexes for /sql nearest-neighbor
+// search
+func (s *Server) SetTiering(opts *tiered.Options) {
+	s.executor.SetTiering(opts)
+}
+
+// SetAllowDestructive permits DROP COLLECTION through /sql. It is disabled
+// by default so a single request cannot wipe the store.
+func (s *Server) SetAllowDestructive(allow bool) {
+	s.executor.SetAllowDrop(allow)
+}
+
+// SetReadOnly rejects every request that would write to the store, the
+// catalog or the snapshot directory with 403, so several read replicas can
+// serve the same data. /sql still runs queries, and /texts/search searches.
+// Servers over a read-only store start read-only.
+func (s *Server) SetReadOnly(readOnly bool) {
+	s.readOnly = readOnly
+	s.executor.SetReadOnly(readOnly)
+}
+
+// readRequests are the paths whose POST requests only read
+var readRequests = map[string]bool{"/sql": true, "/texts/search": true, "/indexes/rebuild": true}
+
+// SetIndexCache sets the cache of indexes reused by /sql nearest-neighbor
+// searches. The server invalidates it on every write.
+func (s *Server) SetIndexCache(cache *executor.IndexCache) {
+	s.indexes = cache
+	s.executor.SetIndexCache(cache)
+}
+
+// InstallIndex fills the index selected by opts with load instead of
+// building it, e.g. from a bundle built elsewhere, and makes /sql searches
+// use it. The server needs an index cache.
+func (s *Server) InstallIndex(opts executor.RebuildOptions, load func(index.Index) error) (*executor.IndexInfo, error) {
+	return s.executor.InstallIndex(opts, load)
+}
+
+// SetResultCache reuses the results of /sql SELECT statements until the
+// store changes
+func (s *Server) SetResultCache(cache *executor.ResultCache) {
+	s.results = cache
+	s.executor.SetResultCache(cache)
+}
+
+// SetPlanCache reuses the parses of /sql statements that differ from
+// earlier ones only in their literals
+func (s *Server) SetPlanCache(cache *executor.PlanCache) {
+	s.plans = cache
+	s.executor.SetPlanCache(cache)
+}
+
+// SetMemoryAccountant aborts /sql queries that allocate more memory than
+// the budgets of accountant. Nil leaves queries unlimited.
+func (s *Server) SetMemoryAccountant(accountant *executor.MemoryAccountant) {
+	s.memory = accountant
+	s.executor.SetMemoryAccountant(accountant)
+}
+
+// SetDocsDir sets the directory of the documents stored by the embed
+// command, which /sql queries can JOIN as the docs table and /context reads
+// chunk text from
+func (s *Server) SetDocsDir(dir string) {
+	s.docsDir = dir
+	s.executor.SetDocsDir(dir)
+}
+
+// SetCatalog sets the catalog of the views created through /sql. Views
+// are kept in memory unless it is replaced with a persisted one.
+func (s *Server) SetCatalog(catalog *executor.Catalog) {
+	s.executor.SetCatalog(catalog)
+}
+
+// SetHNSWConfig sets the parameters of HNSW indexes built for /sql. Nil uses
+// the defaults.
+func (s *Server) SetHNSWConfig(cfg *hnsw.HNSWConfig) {
+	s.executor.SetHNSWConfig(cfg)
+}
+
+// SetCollectionMetric records the metric a collection is searched with, so
+// /sql rejects queries naming another metric for it
+func (s *Server) SetCollectionMetric(collection string, metric distance.Metric) {
+	s.executor.SetCollectionMetric(collection, metric)
+}
+
+// SetLimits sets the rate and concurrency limits. Requests over a limit are
+// rejected with 429 Too Many Requests; /health and /metrics are exempt.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits.set(limits)
+}
+
+// SetIngestQueue passes REST writes of vectors and texts through a queue of
+// up to size writes executed by workers. Writes arriving while it is full
+// are rejected with 503 Service Unavailable and a Retry-After estimate. A
+// size of 0 removes the queue. Set it before the server starts serving.
+func (s *Server) SetIngestQueue(size, workers int) {
+	s.ingest.close()
+	s.ingest = nil
+	if size > 0 {
+		s.ingest = newIngestQueue(size, workers)
+	}
+}
+
+// ingestRejected answers a write the ingestion queue had no room for
+func (s *Server) ingestRejected(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, errIngestQueueFull) {
+		return false
+	}
+	writeRetryAfter(w, http.StatusServiceUnavailable, s.ingest.retryAfter(), err)
+	return true
+}
+
+// SetSnapshotDir enables the /snapshots endpoint, which takes and lists
+// snapshots of the store in dir
+func (s *Server) SetSnapshotDir(dir string) {
+	s.snapshots = dir
+}
+
+// SetAuditLog records every write made through the server, attributed to
+// the caller's API key or address
+func (s *Server) SetAuditLog(log *audit.Log) {
+	s.audit = log
+	s.executor.SetAuditLog(log, "")
+}
+
+// SetDriftMonitor reports the drift checks of monitor on /metrics and
+// /stats
+func (s *Server) SetDriftMonitor(monitor *drift.Monitor) {
+	s.drift = monitor
+}
+
+// requestActor identifies the caller of a request for the audit log: a
+// fingerprint of the API key from the Authorization bearer token or the
+// X-API-Key header, or the remote address of anonymous callers
+func requestActor(r *http.Request) string {
+	if key := requestKey(r); key != "" {
+		return audit.KeyActor(key)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anonymous@" + host
+}
+
+// requestKey returns the API key of a request, from a bearer token or the
+// X-API-Key header
+func requestKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// record writes a REST write to the audit log
+func (s *Server) record(r *http.Request, operation string, affected int, err error) {
+	if s.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Actor:     requestActor(r),
+		Operation: operation,
+		Statement: r.Method + " " + r.URL.Path,
+		Affected:  affected,
+	}
+	if err != nil {
+		entry.Affected = 0
+		entry.Error = err.Error()
+	}
+	s.audit.Record(entry)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/health" && r.URL.Path != "/metrics" {
+		if ok, wait := s.limits.admit(requestActor(r)); !ok {
+			writeTooManyRequests(w, wait, errRateLimited)
+			return
+		}
+	}
+	if s.readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead && !readRequests[r.URL.Path] {
+		err := fmt.Errorf("%w: %s %s is not served by a read-only server", storage.ErrReadOnly, r.Method, r.URL.Path)
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe starts serving on the given address
+func (s *Server) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s)
+}
+
+// vectorJSON is the wire representation of a vector
+type vectorJSON struct {
+	ID       string            `json:"id"`
+	Values   []float32         `json:"values"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Set by the store; ignored in requests
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+func toVectorJSON(v *vector.Vector) *vectorJSON {
+	if v == nil {
+		return nil
+	}
+	body := &vectorJSON{ID: v.ID, Values: v.Values, Metadata: v.Metadata}
+	if !v.CreatedAt.IsZero() {
+		body.CreatedAt = &v.CreatedAt
+	}
+	if !v.UpdatedAt.IsZero() {
+		body.UpdatedAt = &v.UpdatedAt
+	}
+	return body
+}
+
+// eventJSON is the wire representation of a change event
+type eventJSON struct {
+	Seq    uint64      `json:"seq"`
+	Type   string      `json:"type"`
+	ID     string      `json:"id"`
+	Vector *vectorJSON `json:"vector,omitempty"`
+	Time   time.Time   `json:"time"`
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError writes a JSON error response. Errors with a code also
+// report it, such as "not_found".
+func writeError(w http.ResponseWriter, status int, err error) {
+	body := map[string]string{"error": err.Error()}
+	if code := errs.CodeOf(err); code != errs.Unknown {
+		body["code"] = code.String()
+	}
+	writeJSON(w, status, body)
+}
+
+// storeErrorStatus maps store errors to HTTP status codes by their code.
+// Schema violations are well-formed requests with invalid metadata.
+func storeErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrSchemaViolation) {
+		return http.StatusUnprocessableEntity
+	}
+	return errs.CodeOf(err).HTTPStatus()
+}
+
+// queryErrorStatus maps SQL errors to HTTP status codes by their code.
+// Errors without one are taken to be caused by the query.
+func queryErrorStatus(err error) int {
+	if errs.CodeOf(err) == errs.Unknown {
+		return http.StatusBadRequest
+	}
+	return storeErrorStatus(err)
+}
+
+// handleHealth reports liveness and the number of stored vectors
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	count, err := s.store.Count()
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "vectors": count})
+}
+
+// handleStats summarizes the collection: its size, the dimensions of its
+// vectors, how many vectors have each metadata key, the hit rates of the
+// enabled caches and the memory held by queries
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	ids, err := s.store.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	dimensions := make(map[int]int)
+	keys := make(map[string]int)
+	for _, id := range ids {
+		v, err := storage.GetMeta(s.store, id)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		dimensions[v.Dimension]++
+		for key := range v.Metadata {
+			keys[key]++
+		}
+	}
+
+	caches := map[string]interface{}{}
+	if s.results != nil {
+		caches["results"] = s.results.Stats()
+	}
+	if s.plans != nil {
+		caches["plans"] = s.plans.Stats()
+	}
+	stats := map[string]interface{}{
+		"collection":    textCollection,
+		"vectors":       len(ids),
+		"metric":        s.metric.Name(),
+		"dimensions":    dimensions,
+		"metadata_keys": keys,
+		"indexes":       s.indexes.Indexes(),
+		"caches":        caches,
+	}
+	if s.memory != nil {
+		stats["memory"] = s.memory.Stats()
+	}
+	if s.drift != nil {
+		stats["drift"] = s.drift.Last()
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleMetrics serves the server's metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.limits.writeMetrics(w)
+	s.ingest.writeMetrics(w)
+	if s.models != nil {
+		s.models.Metrics().WritePrometheus(w)
+	}
+	if s.drift != nil {
+		s.drift.WritePrometheus(w)
+	}
+	if stats, ok := storage.CompactionStatsOf(s.store); ok {
+		writeCompactionMetrics(w, stats)
+	}
+}
+
+// writeCompactionMetrics writes the compaction stats of the store's segments
+func writeCompactionMetrics(w io.Writer, stats storage.CompactionStats) {
+	fmt.Fprintf(w, "# HELP vectodb_segments Segments of the object store.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_segments gauge\n")
+	fmt.Fprintf(w, "vectodb_segments %d\n", stats.Segments)
+	fmt.Fprintf(w, "# HELP vectodb_segment_garbage_ratio Share of the records in segments that later writes replaced or deleted.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_segment_garbage_ratio gauge\n")
+	fmt.Fprintf(w, "vectodb_segment_garbage_ratio %g\n", stats.GarbageRatio)
+	fmt.Fprintf(w, "# HELP vectodb_compactions_total Merges of segments.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_compactions_total counter\n")
+	fmt.Fprintf(w, "vectodb_compactions_total %d\n", stats.Compactions)
+	fmt.Fprintf(w, "# HELP vectodb_compaction_segments_merged_total Segments replaced by merges.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_compaction_segments_merged_total counter\n")
+	fmt.Fprintf(w, "vectodb_compaction_segments_merged_total %d\n", stats.SegmentsMerged)
+	fmt.Fprintf(w, "# HELP vectodb_compaction_records_dropped_total Dead records left out of merged segments.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_compaction_records_dropped_total counter\n")
+	fmt.Fprintf(w, "vectodb_compaction_records_dropped_total %d\n", stats.RecordsDropped)
+	fmt.Fprintf(w, "# HELP vectodb_compaction_bytes_total Segment bytes read and written by compaction.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_compaction_bytes_total counter\n")
+	fmt.Fprintf(w, "vectodb_compaction_bytes_total{direction=\"read\"} %d\n", stats.BytesRead)
+	fmt.Fprintf(w, "vectodb_compaction_bytes_total{direction=\"written\"} %d\n", stats.BytesWritten)
+}
+
+// handleModelStats returns the call metrics of every embedding model
+func (s *Server) handleModelStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if s.models == nil {
+		writeJSON(w, http.StatusOK, []embedding.ProviderStats{})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.models.Metrics().Snapshot())
+}
+
+// handleVectors lists vector IDs (GET) or inserts a vector (POST)
+func (s *Server) handleVectors(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		// IDs are listed in order, a page at a time with ?limit=N&after=<last id>
+		query := r.URL.Query()
+		limit := 0
+		if l := query.Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", l))
+				return
+			}
+			limit = n
+		}
+		ids, err := s.store.ListCtx(r.Context(), storage.ListOptions{Prefix: query.Get("prefix"), After: query.Get("after"), Limit: limit})
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		body := map[string]interface{}{"ids": ids}
+		if limit > 0 && len(ids) == limit {
+			body["next"] = ids[len(ids)-1]
+		}
+		writeJSON(w, http.StatusOK, body)
+	case http.MethodPost:
+		var body vectorJSON
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if body.ID == "" || len(body.Values) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("id and values are required"))
+			return
+		}
+
+		v := vector.NewVectorWithMetadata(body.ID, body.Values, body.Metadata)
+		err := s.ingest.do(func() error { return s.store.InsertCtx(r.Context(), v) })
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpInsert, 1, err)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, toVectorJSON(v))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleVector reads (GET), replaces (PUT) or deletes (DELETE) a single vector
+func (s *Server) handleVector(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/vectors/")
+	if id == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing vector id"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		v, err := s.store.GetCtx(r.Context(), id, storage.GetOptions{})
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toVectorJSON(v))
+	case http.MethodPut:
+		var body vectorJSON
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		if len(body.Values) == 0 {
+			writeError(w, http.StatusBadRequest, errors.New("values are required"))
+			return
+		}
+
+		v := vector.NewVectorWithMetadata(id, body.Values, body.Metadata)
+		err := s.ingest.do(func() error { return s.store.UpdateCtx(r.Context(), v) })
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpUpdate, 1, err)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, toVectorJSON(v))
+	case http.MethodDelete:
+		err := s.ingest.do(func() error { return s.store.DeleteCtx(r.Context(), id) })
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpDelete, 1, err)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleSQL executes a SQL query from the JSON body {"query": "..."}. With
+// ?stream=ndjson or ?stream=sse, or a matching Accept header, rows are
+// streamed as they are produced.
+func (s *Server) handleSQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var body struct {
+		Query string `json:"query"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("request body must be {\"query\": \"...\"}"))
+		return
+	}
+	format, err := streamFormat(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	release, ok := s.limits.acquireQuery()
+	if !ok {
+		writeTooManyRequests(w, 0, errTooManyQueries)
+		return
+	}
+	defer release()
+
+	if format != "" {
+		s.streamSQL(w, r, body.Query, format)
+		return
+	}
+
+	result, err := s.executor.ExecuteQueryContext(r.Context(), requestActor(r), body.Query)
+	if err != nil {
+		writeError(w, queryErrorStatus(err), err)
+		return
+	}
+
+	columns := make([]string, len(result.Columns))
+	for i, col := range result.Columns {
+		columns[i] = col.Name
+	}
+	rows := result.Rows
+	if rows == nil {
+		rows = []executor.Row{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"columns": columns, "rows": rows})
+}
+
+// handleTexts embeds and stores texts (POST, the body mirrors LangChain's
+// add_texts) or deletes documents (DELETE with {"ids": [...]})
+func (s *Server) handleTexts(w http.ResponseWriter, r *http.Request) {
+	if s.texts == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("no embedding model configured"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		var body struct {
+			Texts     []string            `json:"texts"`
+			Metadatas []map[string]string `json:"metadatas"`
+			IDs       []string            `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+
+		var ids []string
+		err := s.ingest.do(func() (err error) {
+			ids, err = s.texts.AddTexts(body.Texts, body.Metadatas, body.IDs)
+			return err
+		})
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpInsert, len(ids), err)
+		if errors.Is(err, vectorstore.ErrLengthMismatch) {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"ids": ids})
+	case http.MethodDelete:
+		var body struct {
+			IDs []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+			return
+		}
+		err := s.ingest.do(func() error { return s.texts.Delete(body.IDs) })
+		if s.ingestRejected(w, err) {
+			return
+		}
+		s.record(r, audit.OpDelete, len(body.IDs), err)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleSnapshots lists snapshots (GET) or takes a new one (POST)
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if s.snapshots == "" {
+		writeError(w, http.StatusServiceUnavailable, errors.New("no snapshot directory configured"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		manifests, err := snapshot.List(s.snapshots)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if manifests == nil {
+			manifests = []*snapshot.Manifest{}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"snapshots": manifests})
+	case http.MethodPost:
+		manifest, err := snapshot.Create(s.snapshots, s.store, nil)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, manifest)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// handleIndexes lists the indexes built for /sql and those being rebuilt
+func (s *Server) handleIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	body := map[string]interface{}{"indexes": s.indexes.Indexes()}
+	s.rebuildMu.Lock()
+	if s.rebuildErr != nil {
+		body["last_error"] = s.rebuildErr.Error()
+	}
+	s.rebuildMu.Unlock()
+	writeJSON(w, http.StatusOK, body)
+}
+
+// handleIndexRebuild rebuilds the index of a collection from the JSON body
+// {"collection": "...", "type": "hnsw", "metric": "cosine", "m": 16, "m0": 32,
+// "ef_construction": 200, "ef_search": 50, "wait": false}. Queries keep
+// using the current index until the new one is swapped in. Without wait the
+// rebuild runs in the background and the request returns at once.
+func (s *Server) handleIndexRebuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	var body struct {
+		Collection     string `json:"collection"`
+		Type           string `json:"type"`
+		Metric         string `json:"metric"`
+		M              int    `json:"m"`
+		M0             int    `json:"m0"`
+		EfConstruction int    `json:"ef_construction"`
+		EfSearch       int    `json:"ef_search"`
+		Wait           bool   `json:"wait"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Collection == "" {
+		writeError(w, http.StatusBadRequest, errors.New("request body must name a collection"))
+		return
+	}
+
+	opts := executor.RebuildOptions{
+		Collection: body.Collection,
+		IndexType:  executor.IndexType(strings.ToLower(body.Type)),
+	}
+	if body.Metric != "" {
+		metric, err := distance.GetMetric(distance.MetricType(body.Metric))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		opts.Metric = metric
+	}
+	if body.M > 0 || body.M0 > 0 || body.EfConstruction > 0 || body.EfSearch > 0 {
+		cfg := hnsw.NewHNSWConfig(body.M, body.EfConstruction, body.EfSearch)
+		cfg.M0 = body.M0
+		opts.HNSW = &cfg
+	}
+
+	if body.Wait {
+		info, err := s.executor.RebuildIndex(opts)
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+		return
+	}
+
+	go func() {
+		_, err := s.executor.RebuildIndex(opts)
+		s.rebuildMu.Lock()
+		s.rebuildErr = err
+		s.rebuildMu.Unlock()
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "rebuilding", "collection": body.Collection})
+}
+
+// handleIndexStats returns the graph statistics of the HNSW index of the
+// collection named by the collection query parameter
+func (s *Server) handleIndexStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	stats, err := s.executor.IndexStats(r.URL.Query().Get("collection"), nil)
+	if err != nil {
+		writeError(w, storeErrorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleTextSearch returns the documents most similar to a text query, from
+// the JSON body {"query": "...", "k": 4, "filter": {...}}. With "highlight":
+// true each document carries the snippet of its text matching the query, of
+// at most "snippet_length" bytes.
+func (s *Server) handleTextSearch(w http.ResponseWriter, r *http.Request) {
+	if s.texts == nil {
+		writeError(w, http.StatusServiceUnavailable, errors.New("no embedding model configured"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	body := struct {
+		Query         string            `json:"query"`
+		K             int               `json:"k"`
+		Filter        map[string]string `json:"filter"`
+		Highlight     bool              `json:"highlight"`
+		SnippetLength int               `json:"snippet_length"`
+	}{K: 4}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("request body must be {\"query\": \"...\"}"))
+		return
+	}
+
+	release, ok := s.limits.acquireQuery()
+	if !ok {
+		writeTooManyRequests(w, 0, errTooManyQueries)
+		return
+	}
+	defer release()
+
+	docs, err := s.texts.SimilaritySearchWithScore(body.Query, body.K, body.Filter)
+	if errors.Is(err, vectorstore.ErrInvalidK) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if body.Highlight {
+		vectorstore.Highlight(docs, body.Query, body.SnippetLength, s.analyzers.For(textCollection))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"documents": docs})
+}
+
+// handleEvents streams store changes as server-sent events. The optional
+// "types" query parameter restricts the stream, e.g. ?types=insert,delete.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	// Parse the event type filter
+	wanted := make(map[storage.EventType]bool)
+	if types := r.URL.Query().Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			wanted[storage.EventType(strings.TrimSpace(strings.ToLower(t)))] = true
+		}
+	}
+
+	events, cancel := s.store.Events(eventBufferSize)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Tell the client the stream is live before the first change arrives
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if len(wanted) > 0 && !wanted[event.Type] {
+				continue
+			}
+
+			data, err := json.Marshal(eventJSON{
+				Seq:    event.Seq,
+				Type:   string(event.Type),
+				ID:     event.ID,
+				Vector: toVectorJSON(event.Vector),
+				Time:   event.Time,
+			})
+			if err != nil {
+				continue
+			}
+
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+// handleChanges lists the vectors written since a cursor, oldest first, so
+// downstream systems can sync without full dumps. ?since takes a time or the
+// "next" token of the previous response; deletions are not reported.
+func (s *Server) handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	query := r.URL.Query()
+	cursor, err := storage.ParseChangeCursor(query.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := 1000
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", l))
+			return
+		}
+		limit = n
+	}
+
+	// One more than the limit tells whether another page follows
+	changed, err := storage.Changes(s.store, cursor, limit+1)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	more := len(changed) > limit
+	if more {
+		changed = changed[:limit]
+	}
+
+	vectors := make([]*vectorJSON, 0, len(changed))
+	for _, meta := range changed {
+		v, err := s.store.Get(meta.ID)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue // Deleted since it was listed
+		}
+		if err != nil {
+			writeError(w, storeErrorStatus(err), err)
+			return
+		}
+		vectors = append(vectors, toVectorJSON(v))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vectors": vectors,
+		"next":    storage.CursorAfter(cursor, changed).String(),
+		"more":    more,
+	})
+}
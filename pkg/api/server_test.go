@@ -0,0 +1,1150 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/audit"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/drift"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	server := httptest.NewServer(NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVectorEndpoints(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Post(server.URL+"/vectors", "application/json",
+		strings.NewReader(`{"id": "v1", "values": [1, 2, 3], "metadata": {"k": "v"}}`))
+	if err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+	}
+
+	// Duplicate inserts conflict
+	resp, _ = http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1]}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(server.URL + "/vectors/v1")
+	var got vectorJSON
+	json.NewDecoder(resp.Body).Decode(&got)
+	resp.Body.Close()
+	if got.ID != "v1" || len(got.Values) != 3 || got.Metadata["k"] != "v" {
+		t.Errorf("Unexpected vector: %+v", got)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/vectors/v1", nil)
+	resp, _ = http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", resp.StatusCode)
+	}
+
+	resp, _ = http.Get(server.URL + "/vectors/v1")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestVectorListPages(t *testing.T) {
+	server := newTestServer(t)
+	for _, id := range []string{"s1:b", "s2:a", "s1:a", "s1:c"} {
+		resp, _ := http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "`+id+`", "values": [1]}`))
+		resp.Body.Close()
+	}
+
+	list := func(query string) (ids []string, next string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/vectors?" + query)
+		if err != nil {
+			t.Fatalf("Failed to list vectors: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			IDs  []string `json:"ids"`
+			Next string   `json:"next"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.IDs, body.Next
+	}
+
+	ids, next := list("prefix=s1:&limit=2")
+	if strings.Join(ids, ",") != "s1:a,s1:b" || next != "s1:b" {
+		t.Errorf("Unexpected first page %v, next %q", ids, next)
+	}
+	ids, next = list("prefix=s1:&limit=2&after=" + next)
+	if strings.Join(ids, ",") != "s1:c" || next != "" {
+		t.Errorf("Unexpected last page %v, next %q", ids, next)
+	}
+
+	resp, _ := http.Get(server.URL + "/vectors?limit=x")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	server := newTestServer(t)
+
+	resp, err := http.Get(server.URL + "/events?types=insert")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	// Wait for the stream to be established
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("Expected connected comment, got %q", line)
+	}
+	reader.ReadString('\n')
+
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 2]}`))
+	req, _ := http.NewRequest(http.MethodDelete, server.URL+"/vectors/v1", nil)
+	http.DefaultClient.Do(req)
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v2", "values": [3, 4]}`))
+
+	// The delete is filtered out, so the second event is the v2 insert
+	var events []eventJSON
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event stream: %v", err)
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event eventJSON
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("Invalid event payload: %v", err)
+			}
+			events = append(events, event)
+		}
+	}
+
+	if events[0].ID != "v1" || events[1].ID != "v2" || events[1].Type != "insert" {
+		t.Errorf("Unexpected events: %+v", events)
+	}
+	if events[1].Vector == nil || events[1].Vector.Values[0] != 3 {
+		t.Errorf("Expected event to carry the vector, got %+v", events[1].Vector)
+	}
+}
+
+func TestChangesEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	for _, id := range []string{"v1", "v2", "v3"} {
+		resp, _ := http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "`+id+`", "values": [1, 2]}`))
+		resp.Body.Close()
+	}
+
+	changes := func(query string) (ids []string, next string, more bool) {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/changes?" + query)
+		if err != nil {
+			t.Fatalf("Failed to get changes: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Vectors []vectorJSON `json:"vectors"`
+			Next    string       `json:"next"`
+			More    bool         `json:"more"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		for _, v := range body.Vectors {
+			if len(v.Values) != 2 || v.UpdatedAt == nil {
+				t.Errorf("Expected values and an update time, got %+v", v)
+			}
+			ids = append(ids, v.ID)
+		}
+		return ids, body.Next, body.More
+	}
+
+	ids, next, more := changes("limit=2")
+	if len(ids) != 2 || !more {
+		t.Fatalf("Expected a first page of 2 with more, got %v (more = %v)", ids, more)
+	}
+	rest, next, more := changes("since=" + next)
+	if len(rest) != 1 || more {
+		t.Fatalf("Expected the last change, got %v (more = %v)", rest, more)
+	}
+
+	// Only writes after the last sync are returned
+	req, _ := http.NewRequest(http.MethodPut, server.URL+"/vectors/"+ids[0], strings.NewReader(`{"values": [3, 4]}`))
+	resp, _ := http.DefaultClient.Do(req)
+	resp.Body.Close()
+	if updated, _, _ := changes("since=" + next); len(updated) != 1 || updated[0] != ids[0] {
+		t.Errorf("Expected only %s, got %v", ids[0], updated)
+	}
+
+	resp, _ = http.Get(server.URL + "/changes?since=yesterday")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid cursor, got %d", resp.StatusCode)
+	}
+}
+
+func TestSQLEndpoint(t *testing.T) {
+	server := newTestServer(t)
+
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 2]}`))
+
+	resp, err := http.Post(server.URL+"/sql", "application/json", strings.NewReader(`{"query": "SELECT * FROM vectors"}`))
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK || len(result.Rows) != 1 {
+		t.Errorf("Expected one row, got status %d and %+v", resp.StatusCode, result)
+	}
+
+	// Errors answer the status of their code and report the code
+	for _, test := range []struct {
+		query  string
+		status int
+		code   string
+	}{
+		{"DROP VIEW missing", http.StatusNotFound, "not_found"},
+		{"SELEC", http.StatusBadRequest, "invalid_argument"},
+	} {
+		body, _ := json.Marshal(map[string]string{"query": test.query})
+		resp, err := http.Post(server.URL+"/sql", "application/json", strings.NewReader(string(body)))
+		if err != nil {
+			t.Fatalf("Failed to run query: %v", err)
+		}
+		var failure struct{ Error, Code string }
+		json.NewDecoder(resp.Body).Decode(&failure)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || failure.Code != test.code {
+			t.Errorf("%s: expected %d %s, got %d %+v", test.query, test.status, test.code, resp.StatusCode, failure)
+		}
+	}
+}
+
+func TestSQLStreaming(t *testing.T) {
+	server := newTestServer(t)
+	for _, id := range []string{"a", "b", "c"} {
+		http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "`+id+`", "values": [1, 2]}`))
+	}
+
+	resp, err := http.Post(server.URL+"/sql?stream=ndjson", "application/json",
+		strings.NewReader(`{"query": "SELECT id, dimension FROM vectors WHERE id != 'b'"}`))
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `{"columns":["id","dimension"]}
+{"row":["a",2]}
+{"row":["c",2]}
+{"done":{"rows":2}}
+`
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" || string(body) != want {
+		t.Errorf("Unexpected stream %q", body)
+	}
+
+	// Server-sent events are chosen with the Accept header
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/sql", strings.NewReader(`{"query": "SELECT COUNT(*) FROM vectors"}`))
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want = "event: columns\ndata: [\"COUNT(*)\"]\n\nevent: row\ndata: [3]\n\nevent: done\ndata: {\"rows\":1}\n\n"
+	if string(body) != want {
+		t.Errorf("Unexpected events %q", body)
+	}
+
+	// Errors before the first row are plain JSON errors
+	resp, _ = http.Post(server.URL+"/sql?stream=ndjson", "application/json", strings.NewReader(`{"query": "SELEC"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", resp.StatusCode)
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+	store.Insert(vector.NewVector("v1", []float32{1, 2}))
+	srv := NewServer(store, executor.IndexTypeFlat, metric)
+
+	// Requests whose client has gone away stop at the store
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodGet, "/vectors", ""},
+		{http.MethodPost, "/vectors", `{"id": "v2", "values": [3, 4]}`},
+		{http.MethodGet, "/vectors/v1", ""},
+		{http.MethodDelete, "/vectors/v1", ""},
+		{http.MethodPost, "/sql", `{"query": "SELECT id FROM vectors"}`},
+		{http.MethodPost, "/sql", `{"query": "DELETE FROM vectors WHERE id = 'v1'"}`},
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)).WithContext(ctx)
+		srv.ServeHTTP(rec, req)
+		if rec.Code != 499 {
+			t.Errorf("%s %s: expected status 499, got %d: %s", tc.method, tc.path, rec.Code, rec.Body)
+		}
+	}
+	if ids, _ := store.List(); len(ids) != 1 || ids[0] != "v1" {
+		t.Errorf("Expected the store to be unchanged, got %v", ids)
+	}
+}
+
+func TestSQLDropDisabled(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	s := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	drop := func() int {
+		resp, err := http.Post(server.URL+"/sql", "application/json", strings.NewReader(`{"query": "DROP COLLECTION vectors CONFIRM"}`))
+		if err != nil {
+			t.Fatalf("Failed to run query: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := drop(); status != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", status)
+	}
+
+	s.SetAllowDestructive(true)
+	if status := drop(); status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	s := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer log.Close()
+	s.SetAuditLog(log)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/vectors", strings.NewReader(`{"id": "v1", "values": [1, 2]}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Post(server.URL+"/sql", "application/json", strings.NewReader(`{"query": "DELETE FROM vectors WHERE id = 'v1'"}`))
+	if err != nil {
+		t.Fatalf("Failed to run query: %v", err)
+	}
+	resp.Body.Close()
+
+	entries, err := audit.Tail(path, 0)
+	if err != nil {
+		t.Fatalf("Tail() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %+v", entries)
+	}
+	if entries[0].Actor != audit.KeyActor("secret") || entries[0].Operation != audit.OpInsert || entries[0].Statement != "POST /vectors" {
+		t.Errorf("Unexpected insert entry: %+v", entries[0])
+	}
+	if !strings.HasPrefix(entries[1].Actor, "anonymous@") || entries[1].Operation != audit.OpDelete || entries[1].Affected != 1 {
+		t.Errorf("Unexpected delete entry: %+v", entries[1])
+	}
+}
+
+func TestTextEndpoints(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Cosine)
+	s := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	// Without an embedding registry the endpoints are unavailable
+	resp, _ := http.Post(server.URL+"/texts", "application/json", strings.NewReader(`{"texts": ["a"]}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", resp.StatusCode)
+	}
+
+	s.SetModelRegistry(embedding.NewRegistry())
+
+	resp, err := http.Post(server.URL+"/texts", "application/json",
+		strings.NewReader(`{"texts": ["first doc", "second doc"], "metadatas": [{"k": "1"}, {"k": "2"}], "ids": ["t1", "t2"]}`))
+	if err != nil {
+		t.Fatalf("Failed to add texts: %v", err)
+	}
+	var added struct {
+		IDs []string `json:"ids"`
+	}
+	json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(added.IDs) != 2 {
+		t.Fatalf("Expected 2 ids, got status %d and %+v", resp.StatusCode, added)
+	}
+
+	resp, err = http.Post(server.URL+"/texts/search", "application/json",
+		strings.NewReader(`{"query": "second doc", "k": 1}`))
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	var found struct {
+		Documents []struct {
+			ID          string            `json:"id"`
+			PageContent string            `json:"page_content"`
+			Metadata    map[string]string `json:"metadata"`
+		} `json:"documents"`
+	}
+	json.NewDecoder(resp.Body).Decode(&found)
+	resp.Body.Close()
+	if len(found.Documents) != 1 || found.Documents[0].ID != "t2" || found.Documents[0].PageContent != "second doc" {
+		t.Errorf("Expected document t2, got %+v", found)
+	}
+
+	// Both texts are embedded in one batch call and the query in another
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("Failed to get metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want := `vectodb_embedding_calls_total{provider="huggingface",model="sentence-transformers/all-MiniLM-L6-v2"} 2`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("Expected %q in the metrics, got\n%s", want, body)
+	}
+
+	resp, err = http.Get(server.URL + "/models/stats")
+	if err != nil {
+		t.Fatalf("Failed to get model stats: %v", err)
+	}
+	var stats []embedding.ProviderStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if len(stats) != 1 || stats[0].Calls != 2 || stats[0].Tokens == 0 || stats[0].Failures != 0 {
+		t.Errorf("Expected 2 successful calls, got %+v", stats)
+	}
+
+	resp, err = http.Post(server.URL+"/texts/search", "application/json",
+		strings.NewReader(`{"query": "second doc", "k": 1, "highlight": true}`))
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	var highlighted struct {
+		Documents []struct {
+			Highlight embedding.Snippet `json:"highlight"`
+		} `json:"documents"`
+	}
+	json.NewDecoder(resp.Body).Decode(&highlighted)
+	resp.Body.Close()
+	if len(highlighted.Documents) != 1 || highlighted.Documents[0].Highlight.Marked("[", "]") != "[second] [doc]" {
+		t.Errorf("Unexpected highlight %+v", highlighted)
+	}
+}
+
+func TestSnapshotEndpoint(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	s := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	s.SetSnapshotDir(t.TempDir())
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 2]}`))
+
+	resp, err := http.Post(server.URL+"/snapshots", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+	var created struct {
+		Epoch   uint64 `json:"epoch"`
+		Vectors int    `json:"vectors"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Epoch != 1 || created.Vectors != 1 {
+		t.Fatalf("Unexpected snapshot: status %d, %+v", resp.StatusCode, created)
+	}
+
+	resp, err = http.Get(server.URL + "/snapshots")
+	if err != nil {
+		t.Fatalf("Failed to list snapshots: %v", err)
+	}
+	var listed struct {
+		Snapshots []struct {
+			Epoch uint64 `json:"epoch"`
+		} `json:"snapshots"`
+	}
+	json.NewDecoder(resp.Body).Decode(&listed)
+	resp.Body.Close()
+	if len(listed.Snapshots) != 1 || listed.Snapshots[0].Epoch != 1 {
+		t.Errorf("Unexpected snapshot list: %+v", listed)
+	}
+}
+
+func TestSQLIndexCacheInvalidation(t *testing.T) {
+	server := newTestServer(t)
+
+	nearest := func() interface{} {
+		resp, err := http.Post(server.URL+"/sql", "application/json",
+			strings.NewReader(`{"query": "SELECT id FROM vectors NEAREST TO [5.0, 5.0] LIMIT 1"}`))
+		if err != nil {
+			t.Fatalf("Failed to run query: %v", err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Rows [][]interface{} `json:"rows"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if len(result.Rows) != 1 {
+			t.Fatalf("Expected one row, got %+v", result)
+		}
+		return result.Rows[0][0]
+	}
+
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 1]}`))
+	if got := nearest(); got != "v1" {
+		t.Errorf("Expected v1, got %v", got)
+	}
+
+	// A REST write must not be hidden by the cached index
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v2", "values": [5, 5]}`))
+	if got := nearest(); got != "v2" {
+		t.Errorf("Expected v2 after the insert, got %v", got)
+	}
+}
+
+func TestIndexRebuildEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 1]}`))
+
+	resp, err := http.Post(server.URL+"/indexes/rebuild", "application/json",
+		strings.NewReader(`{"collection": "vectors", "type": "hnsw", "m": 8, "wait": true}`))
+	if err != nil {
+		t.Fatalf("Failed to rebuild index: %v", err)
+	}
+	var info executor.IndexInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || info.Type != executor.IndexTypeHNSW || info.Vectors != 1 {
+		t.Fatalf("Unexpected rebuild response: %d %+v", resp.StatusCode, info)
+	}
+
+	resp, err = http.Get(server.URL + "/indexes")
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	var list struct {
+		Indexes []executor.IndexInfo `json:"indexes"`
+	}
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Indexes) != 1 || list.Indexes[0].Collection != "vectors" {
+		t.Errorf("Expected the rebuilt index to be listed, got %+v", list.Indexes)
+	}
+
+	resp, _ = http.Post(server.URL+"/indexes/rebuild", "application/json", strings.NewReader(`{"type": "hnsw"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a collection, got %d", resp.StatusCode)
+	}
+
+	// Without wait the rebuild runs in the background
+	resp, _ = http.Post(server.URL+"/indexes/rebuild", "application/json", strings.NewReader(`{"collection": "vectors", "type": "flat"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected 202 for a background rebuild, got %d", resp.StatusCode)
+	}
+}
+
+func TestIndexStatsEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 1]}`))
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v2", "values": [1, 2]}`))
+
+	resp, err := http.Get(server.URL + "/indexes/stats?collection=vectors")
+	if err != nil {
+		t.Fatalf("Failed to get index stats: %v", err)
+	}
+	var stats hnsw.GraphStats
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || stats.Nodes != 2 || stats.Components != 1 {
+		t.Fatalf("Unexpected stats response: %d %+v", resp.StatusCode, stats)
+	}
+
+	resp, _ = http.Get(server.URL + "/indexes/stats")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a collection, got %d", resp.StatusCode)
+	}
+}
+
+func TestStatsAndUI(t *testing.T) {
+	server := newTestServer(t)
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v1", "values": [1, 1], "metadata": {"lang": "en"}}`))
+	http.Post(server.URL+"/vectors", "application/json", strings.NewReader(`{"id": "v2", "values": [1, 2, 3]}`))
+
+	resp, err := http.Get(server.URL + "/stats")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	var stats struct {
+		Vectors      int            `json:"vectors"`
+		Metric       string         `json:"metric"`
+		Dimensions   map[string]int `json:"dimensions"`
+		MetadataKeys map[string]int `json:"metadata_keys"`
+	}
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if stats.Vectors != 2 || stats.Metric != "euclidean" || stats.Dimensions["2"] != 1 || stats.Dimensions["3"] != 1 || stats.MetadataKeys["lang"] != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// The UI is served from the embedded assets
+	for path, want := range map[string]string{"/ui": "<title>VectoDB</title>", "/ui/app.js": "NEAREST TO", "/ui/style.css": "#vector-plot"} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("Expected %q in %s, got %d", want, path, resp.StatusCode)
+		}
+	}
+}
+
+func TestStatsCaches(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	api := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	api.SetPlanCache(executor.NewPlanCache(8))
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	// Statements differing only in literals share a plan
+	for _, id := range []string{"v1", "v2"} {
+		resp, err := http.Post(server.URL+"/sql", "application/json", strings.NewReader(`{"query": "SELECT id FROM vectors WHERE id = '`+id+`'"}`))
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	resp, err := http.Get(server.URL + "/stats")
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	var stats struct {
+		Caches map[string]executor.PlanCacheStats `json:"caches"`
+	}
+	json.NewDecoder(resp.Body).Decode(&stats)
+	resp.Body.Close()
+	if plans, ok := stats.Caches["plans"]; !ok || plans.Hits != 1 || plans.Misses != 1 || plans.HitRate != 0.5 {
+		t.Errorf("Unexpected plan cache stats: %+v", stats.Caches)
+	}
+	if _, ok := stats.Caches["results"]; ok {
+		t.Errorf("Expected no stats of the disabled result cache")
+	}
+}
+
+func TestPprof(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	srv := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// Profiles are not served unless enabled
+	if rec := get("/debug/pprof/"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with pprof disabled, got %d", rec.Code)
+	}
+
+	srv.SetPprof(true)
+	if rec := get("/debug/pprof/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "goroutine") {
+		t.Errorf("Expected the pprof index, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := get("/debug/pprof/heap"); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Errorf("Expected a heap profile, got %d", rec.Code)
+	}
+	if rec := get("/debug/pprof/cmdline"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the command line, got %d", rec.Code)
+	}
+}
+
+func TestDocumentEndpoints(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+	docsDir := t.TempDir()
+	for i, text := range []string{"one", "two", "three"} {
+		id := fmt.Sprintf("a.md#%d", i)
+		v := vector.NewVector(id, []float32{float32(i)})
+		v.Metadata[embedding.MetadataKeyParent] = "a.md"
+		v.Metadata[embedding.MetadataKeyChunk] = fmt.Sprint(i)
+		if err := store.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+		doc, _ := embedding.NewTextDocument(id, text).ToJSON()
+		if err := os.WriteFile(embedding.DocumentPath(docsDir, id), []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Insert(vector.NewVector("b", []float32{9}))
+	srv := NewServer(store, executor.IndexTypeFlat, metric)
+	srv.SetDocsDir(docsDir)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	var window embedding.Window
+	rec := do(http.MethodGet, "/context/a.md%230?after=1")
+	json.NewDecoder(rec.Body).Decode(&window)
+	if rec.Code != http.StatusOK || window.Parent != "a.md" || window.Text() != "one\n\ntwo" {
+		t.Errorf("Unexpected window %d: %+v", rec.Code, window)
+	}
+	if rec := do(http.MethodGet, "/context/a.md%230?before=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative span, got %d", rec.Code)
+	}
+
+	var doc struct {
+		Chunks []embedding.Chunk `json:"chunks"`
+	}
+	rec = do(http.MethodGet, "/documents/a.md")
+	json.NewDecoder(rec.Body).Decode(&doc)
+	if rec.Code != http.StatusOK || len(doc.Chunks) != 3 || doc.Chunks[2].Text != "three" {
+		t.Errorf("Unexpected document %d: %+v", rec.Code, doc)
+	}
+
+	// Deleting the document deletes its chunks and nothing else
+	rec = do(http.MethodDelete, "/documents/a.md")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"deleted":3`) {
+		t.Errorf("Unexpected delete response %d: %s", rec.Code, rec.Body.String())
+	}
+	if ids, _ := store.List(); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("Expected only b left, got %v", ids)
+	}
+	if rec := do(http.MethodDelete, "/documents/a.md"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 deleting again, got %d", rec.Code)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	srv := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	now := time.Unix(0, 0)
+	srv.limits.now = func() time.Time { return now }
+
+	get := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Each key gets its own burst and refills at its rate
+	srv.SetLimits(Limits{Rate: 100, KeyRate: 1, KeyBurst: 2})
+	for i := 0; i < 2; i++ {
+		if rec := get("/vectors", "a"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to be admitted, got %d", i, rec.Code)
+		}
+	}
+	rec := get("/vectors", "a")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected 429 with Retry-After 1, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/vectors", "b"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another key to be admitted, got %d", rec.Code)
+	}
+	if rec := get("/health", "a"); rec.Code != http.StatusOK {
+		t.Errorf("Expected /health to be exempt, got %d", rec.Code)
+	}
+	now = now.Add(time.Second)
+	if rec := get("/vectors", "a"); rec.Code != http.StatusOK {
+		t.Errorf("Expected the key to be admitted after refilling, got %d", rec.Code)
+	}
+
+	// The global rate applies across keys
+	srv.SetLimits(Limits{Rate: 1})
+	get("/vectors", "a")
+	if rec := get("/vectors", "b"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the global limit to reject the request, got %d", rec.Code)
+	}
+
+	// Queries over the concurrency limit are rejected while one runs
+	srv.SetLimits(Limits{MaxConcurrentQueries: 1})
+	release, _ := srv.limits.acquireQuery()
+	query := func() int {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sql", strings.NewReader(`{"query": "SELECT COUNT(*) FROM vectors"}`)))
+		return rec.Code
+	}
+	if code := query(); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 while a query runs, got %d", code)
+	}
+	release()
+	if code := query(); code != http.StatusOK {
+		t.Errorf("Expected the query to run, got %d", code)
+	}
+
+	metrics := get("/metrics", "").Body.String()
+	for _, want := range []string{
+		`vectodb_http_rate_limited_total{limit="global"} 1`,
+		`vectodb_http_rate_limited_total{limit="key"} 1`,
+		`vectodb_http_rate_limited_total{limit="concurrent_queries"} 1`,
+		"vectodb_queries_in_flight 0",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected %q in the metrics, got\n%s", want, metrics)
+		}
+	}
+}
+
+// blockingStore holds inserts until release is closed
+type blockingStore struct {
+	storage.VectorStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Insert(v *vector.Vector) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.VectorStore.Insert(v)
+}
+
+func TestIngestQueue(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := &blockingStore{VectorStore: storage.NewMemoryStore(), started: make(chan struct{}, 2), release: make(chan struct{})}
+	srv := NewServer(store, executor.IndexTypeFlat, metric)
+	srv.SetIngestQueue(1, 1)
+	t.Cleanup(func() { srv.SetIngestQueue(0, 0) })
+
+	insert := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/vectors", strings.NewReader(`{"id": "`+id+`", "values": [1]}`)))
+		return rec
+	}
+
+	// One write runs and one waits in the queue
+	codes := make(chan int, 2)
+	go func() { codes <- insert("a").Code }()
+	<-store.started
+	go func() { codes <- insert("b").Code }()
+	for deadline := time.Now().Add(5 * time.Second); len(srv.ingest.jobs) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Second write was not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A full queue rejects writes at once
+	rec := insert("c")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 503 with Retry-After, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	close(store.release)
+	for i := 0; i < 2; i++ {
+		if code := <-codes; code != http.StatusCreated {
+			t.Errorf("Expected queued writes to succeed, got %d", code)
+		}
+	}
+
+	metrics := httptest.NewRecorder()
+	srv.ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"vectodb_ingest_writes_total 2", "vectodb_ingest_rejected_total 1", "vectodb_ingest_queue_capacity 1"} {
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("Expected %q in metrics", want)
+		}
+	}
+}
+
+func TestCompactionMetrics(t *testing.T) {
+	bucket, _ := storage.NewDirBucket(t.TempDir())
+	store, err := storage.NewObjectStore(bucket, &storage.ObjectStoreOptions{FlushThreshold: 1})
+	if err != nil {
+		t.Fatalf("Failed to open object store: %v", err)
+	}
+	defer store.Close()
+	store.Insert(vector.NewVector("a", []float32{1, 2}))
+	store.Delete("a")
+	if _, err := store.Compact(storage.CompactionPolicy{}); err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	srv := NewServer(storage.NewCachedStore(store, 10), executor.IndexTypeFlat, metric)
+	metrics := httptest.NewRecorder()
+	srv.ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"vectodb_segments 0", "vectodb_compactions_total 1", "vectodb_compaction_records_dropped_total 2"} {
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("Expected %q in metrics, got %s", want, metrics.Body.String())
+		}
+	}
+}
+
+func TestDriftMetrics(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	srv := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	monitor := drift.Start(srv.Store(), drift.Options{MinVectors: 2}, log.New(io.Discard, "", 0))
+	defer monitor.Stop()
+	srv.SetDriftMonitor(monitor)
+
+	for i, values := range [][]float32{{1, 0}, {1.1, 0}, {1, 0.1}, {10, 0}, {11, 0}} {
+		srv.Store().Insert(vector.NewVector(fmt.Sprintf("v%d", i), values))
+		if i == 2 {
+			// The first vectors are the baseline of the next check
+			monitor.Check()
+		}
+	}
+	if report, err := monitor.Check(); err != nil || report == nil || !report.Drift {
+		t.Fatalf("Expected drift of the longer vectors, got %+v (err = %v)", report, err)
+	}
+
+	metrics := httptest.NewRecorder()
+	srv.ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{"vectodb_embedding_drift 1", "vectodb_embedding_drift_warnings_total 1"} {
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("Expected %q in metrics, got %s", want, metrics.Body.String())
+		}
+	}
+}
+
+func TestReadOnlyServer(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.Insert(vector.NewVector("a", []float32{1, 2}))
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	server := httptest.NewServer(NewServer(storage.NewReadOnlyStore(store), executor.IndexTypeFlat, metric))
+	defer server.Close()
+
+	post := func(path, body string) (int, string) {
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to post to %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if status, body := post("/vectors", `{"id": "b", "values": [3, 4]}`); status != http.StatusForbidden || !strings.Contains(body, "permission_denied") {
+		t.Errorf("Expected a write to be rejected with 403, got %d: %s", status, body)
+	}
+	if status, body := post("/sql", `{"query": "INSERT INTO vectors (id, vector) VALUES ('b', [3, 4])"}`); status != http.StatusForbidden {
+		t.Errorf("Expected INSERT to be rejected with 403, got %d: %s", status, body)
+	}
+	if status, body := post("/sql", `{"query": "SELECT * FROM vectors"}`); status != http.StatusOK || !strings.Contains(body, `"a"`) {
+		t.Errorf("Expected SELECT to be served, got %d: %s", status, body)
+	}
+	resp, err := http.Get(server.URL + "/vectors/a")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a read to be served, got %v (%v)", resp, err)
+	}
+	resp.Body.Close()
+}
+
+func TestTenantRouter(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	root := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	router := NewTenantRouter(root, func(tenant string) (*Server, error) {
+		store := storage.NewQuotaStore(storage.NewMemoryStore(), storage.Quota{MaxVectors: 1}, nil)
+		return NewServer(store, executor.IndexTypeFlat, metric), nil
+	})
+	if err := router.AddTenant(Tenant{ID: "acme", APIKeys: []string{"acme-key"}}); err != nil {
+		t.Fatalf("Failed to add tenant: %v", err)
+	}
+	if err := router.AddTenant(Tenant{ID: "open"}); err != nil {
+		t.Fatalf("Failed to add tenant: %v", err)
+	}
+	if err := router.AddTenant(Tenant{ID: "../etc"}); err == nil {
+		t.Errorf("Expected an invalid tenant ID to be rejected")
+	}
+
+	do := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	count := func(headers ...string) int {
+		rec := do(http.MethodGet, "/health", "", headers...)
+		var health struct{ Vectors int }
+		json.NewDecoder(rec.Body).Decode(&health)
+		return health.Vectors
+	}
+
+	insert := `{"id": "v1", "values": [1, 2]}`
+	if rec := do(http.MethodPost, "/vectors", insert, "X-API-Key", "acme-key"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected tenant insert to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/vectors", `{"id": "v2", "values": [1, 2]}`, "X-API-Key", "acme-key"); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected insert over the quota to get 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/vectors", insert, TenantHeader, "open"); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected insert by header to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// Every tenant only sees its own vectors
+	if n := count("Authorization", "Bearer acme-key"); n != 1 {
+		t.Errorf("Expected 1 vector for acme, got %d", n)
+	}
+	if n := count(TenantHeader, "open"); n != 1 {
+		t.Errorf("Expected 1 vector for open, got %d", n)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("Expected no vectors without a tenant, got %d", n)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		headers []string
+		status  int
+	}{
+		{"unknown tenant", []string{TenantHeader, "nobody"}, http.StatusForbidden},
+		{"header without key", []string{TenantHeader, "acme"}, http.StatusUnauthorized},
+		{"key of another tenant", []string{"X-API-Key", "acme-key", TenantHeader, "open"}, http.StatusForbidden},
+	} {
+		if rec := do(http.MethodGet, "/vectors", "", tc.headers...); rec.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.status, rec.Code)
+		}
+	}
+
+	router.SetRequireTenant(true)
+	if rec := do(http.MethodGet, "/vectors", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a tenant, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/health", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected /health to be served without a tenant, got %d", rec.Code)
+	}
+}
+
+func TestTenantRouterOpensStoresConcurrently(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	root := NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric)
+	started, unblock := make(chan struct{}, 2), make(chan struct{})
+	var opens sync.Map
+	router := NewTenantRouter(root, func(tenant string) (*Server, error) {
+		count, _ := opens.LoadOrStore(tenant, new(int32))
+		first := atomic.AddInt32(count.(*int32), 1) == 1
+		if first && tenant == "broken" {
+			return nil, errors.New("disk unavailable")
+		}
+		if first && tenant == "panicky" {
+			panic("driver bug")
+		}
+		if tenant == "slow" {
+			started <- struct{}{}
+			<-unblock
+		}
+		return NewServer(storage.NewMemoryStore(), executor.IndexTypeFlat, metric), nil
+	})
+	for _, id := range []string{"slow", "fast", "broken", "panicky", "late"} {
+		router.AddTenant(Tenant{ID: id})
+	}
+	get := func(tenant string) int {
+		req := httptest.NewRequest(http.MethodGet, "/vectors", nil)
+		req.Header.Set(TenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// A tenant whose store is slow to open holds up neither other tenants
+	// nor opens a second store for its own waiting requests
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := get("slow"); code != http.StatusOK {
+				t.Errorf("Expected the slow tenant to be served, got %d", code)
+			}
+		}()
+	}
+	<-started
+	if code := get("fast"); code != http.StatusOK {
+		t.Errorf("Expected another tenant to be served meanwhile, got %d", code)
+	}
+	close(unblock)
+	wg.Wait()
+	if count, _ := opens.Load("slow"); atomic.LoadInt32(count.(*int32)) != 1 {
+		t.Errorf("Expected the slow tenant's store to be opened once, got %d", *count.(*int32))
+	}
+
+	// A failed open is retried by the next request
+	if code := get("broken"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 for a store that fails to open, got %d", code)
+	}
+	if code := get("broken"); code != http.StatusOK {
+		t.Errorf("Expected the open to be retried, got %d", code)
+	}
+
+	// An open that panics neither blocks later requests nor keeps failing
+	func() {
+		defer func() { recover() }()
+		get("panicky")
+		t.Errorf("Expected the panic to reach the request")
+	}()
+	if code := get("panicky"); code != http.StatusOK {
+		t.Errorf("Expected the open to be retried after a panic, got %d", code)
+	}
+
+	// Once closed, no stores are opened that would never be closed
+	if err := router.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if code := get("late"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after Close, got %d", code)
+	}
+	if _, opened := opens.Load("late"); opened {
+		t.Errorf("Expected no store to be opened after Close")
+	}
+}
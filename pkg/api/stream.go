@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/sql/executor"
+)
+
+const (
+	// streamNDJSON writes one JSON object per line
+	streamNDJSON = "ndjson"
+
+	// streamSSE writes server-sent events
+	streamSSE = "sse"
+
+	// streamFlushRows and streamFlushInterval bound how long rows wait in
+	// the response buffer before they are sent to the client
+	streamFlushRows     = 64
+	streamFlushInterval = 100 * time.Millisecond
+)
+
+// streamFormat returns the streaming format a /sql request asks for with
+// ?stream=ndjson|sse or its Accept header, or "" for a plain JSON response
+func streamFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("stream"); format {
+	case streamNDJSON, streamSSE:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid stream format: %s (use ndjson or sse)", format)
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return streamNDJSON, nil
+	case strings.Contains(accept, "text/event-stream"):
+		return streamSSE, nil
+	}
+	return "", nil
+}
+
+// rowStream writes the result of a query as it is produced. Every NDJSON
+// line is an object with one key, the event: {"columns": [...]} first, then
+// {"row": [...]} per row and finally {"done": {"rows": N}} or
+// {"error": "..."}. SSE streams send the same events with the value as data.
+type rowStream struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	flusher http.Flusher
+	format  string
+	started bool
+	rows    int
+	pending int
+	flushed time.Time
+}
+
+// send writes one line or event
+func (s *rowStream) send(event string, data interface{}) error {
+	var err error
+	if s.format == streamSSE {
+		var payload []byte
+		if payload, err = json.Marshal(data); err == nil {
+			_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+		}
+	} else {
+		err = json.NewEncoder(s.w).Encode(map[string]interface{}{event: data})
+	}
+	return err
+}
+
+// flush sends buffered output to the client
+func (s *rowStream) flush() {
+	s.flusher.Flush()
+	s.pending = 0
+	s.flushed = time.Now()
+}
+
+func (s *rowStream) columns(columns []executor.Column) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.Name
+	}
+
+	if s.format == streamSSE {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+	if err := s.send("columns", names); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *rowStream) row(row executor.Row) error {
+	// A client that went away stops the query
+	if err := s.r.Context().Err(); err != nil {
+		return err
+	}
+	if err := s.send("row", row); err != nil {
+		return err
+	}
+	s.rows++
+	s.pending++
+	if s.pending >= streamFlushRows || time.Since(s.flushed) >= streamFlushInterval {
+		s.flush()
+	}
+	return nil
+}
+
+// finish ends the stream with the outcome of the query
+func (s *rowStream) finish(err error) {
+	if err != nil {
+		s.send("error", err.Error())
+	} else {
+		s.send("done", map[string]int{"rows": s.rows})
+	}
+	s.flush()
+}
+
+// streamSQL executes a query for /sql and streams its rows in format.
+// Errors before the first row are answered like unstreamed ones; later
+// errors end the stream with an error line or event.
+func (s *Server) streamSQL(w http.ResponseWriter, r *http.Request, query, format string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	stream := &rowStream{w: w, r: r, flusher: flusher, format: format}
+	err := s.executor.StreamQueryContext(r.Context(), requestActor(r), query, &executor.Stream{
+		Columns: stream.columns,
+		Row:     stream.row,
+	})
+	if stream.started {
+		stream.finish(err)
+		return
+	}
+	writeError(w, queryErrorStatus(err), err)
+}
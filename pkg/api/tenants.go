@@ -0,0 +1,242 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// TenantHeader names the tenant of a request whose API key does not
+// belong to one
+const TenantHeader = "X-Tenant-ID"
+
+// maxTenantID is the longest tenant ID, which also names a directory
+const maxTenantID = 64
+
+var (
+	errTenantRequired    = errors.New("tenant required: send an API key of a tenant or the " + TenantHeader + " header")
+	errUnknownTenant     = errors.New("unknown tenant")
+	errTenantKey         = errors.New("tenant requires one of its API keys")
+	errTenantMismatch    = errors.New("API key belongs to another tenant")
+	errTenantUnavailable = errors.New("tenant server unavailable")
+	errRouterClosed      = errors.New("tenant router closed")
+	errTenantPanic       = errors.New("opening the tenant store panicked")
+)
+
+// Tenant is an application served by a TenantRouter from its own store
+type Tenant struct {
+	ID      string   // Letters, digits, '-' and '_'
+	APIKeys []string // Keys that select the tenant; if set, the header alone does not
+}
+
+// TenantRouter serves every tenant from a Server of its own, so tenants
+// never see each other's vectors. The tenant of a request is the one its
+// API key belongs to, or else the one named by the X-Tenant-ID header.
+// Requests without a tenant go to the default server unless tenants are
+// required.
+type TenantRouter struct {
+	root    *Server
+	open    func(tenant string) (*Server, error)
+	require bool
+
+	mu      sync.Mutex
+	tenants map[string]Tenant
+	keys    map[string]string // API key to tenant ID
+	servers map[string]*tenantServer
+	closed  bool // Set by Close; no more servers are opened
+}
+
+// tenantServer is the server of a tenant, which may still be opening
+type tenantServer struct {
+	ready chan struct{} // Closed once srv or err is set
+	srv   *Server
+	err   error
+}
+
+// NewTenantRouter creates a router that serves requests without a tenant
+// from root and opens the server of a tenant on its first request
+func NewTenantRouter(root *Server, open func(tenant string) (*Server, error)) *TenantRouter {
+	return &TenantRouter{
+		root:    root,
+		open:    open,
+		tenants: make(map[string]Tenant),
+		keys:    make(map[string]string),
+		servers: make(map[string]*tenantServer),
+	}
+}
+
+// ValidTenantID reports whether id can name a tenant
+func ValidTenantID(id string) error {
+	if id == "" || len(id) > maxTenantID {
+		return fmt.Errorf("invalid tenant ID %q: must be 1 to %d characters", id, maxTenantID)
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("invalid tenant ID %q: only letters, digits, '-' and '_' are allowed", id)
+		}
+	}
+	return nil
+}
+
+// AddTenant registers a tenant. An API key can only belong to one tenant.
+func (t *TenantRouter) AddTenant(tenant Tenant) error {
+	if err := ValidTenantID(tenant.ID); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.tenants[tenant.ID]; ok {
+		return fmt.Errorf("tenant %s already exists", tenant.ID)
+	}
+	for _, key := range tenant.APIKeys {
+		if key == "" {
+			return fmt.Errorf("tenant %s has an empty API key", tenant.ID)
+		}
+		if other, ok := t.keys[key]; ok {
+			return fmt.Errorf("API key of tenant %s belongs to tenant %s already", tenant.ID, other)
+		}
+	}
+	for _, key := range tenant.APIKeys {
+		t.keys[key] = tenant.ID
+	}
+	t.tenants[tenant.ID] = tenant
+	return nil
+}
+
+// SetRequireTenant rejects requests without a tenant instead of serving
+// them from the default server
+func (t *TenantRouter) SetRequireTenant(require bool) {
+	t.require = require
+}
+
+// resolve returns the tenant of a request, "" for none, and the status to
+// reject it with if it may not be served
+func (t *TenantRouter) resolve(r *http.Request) (string, int, error) {
+	header := r.Header.Get(TenantHeader)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if id, ok := t.keys[requestKey(r)]; ok {
+		if header != "" && header != id {
+			return "", http.StatusForbidden, errTenantMismatch
+		}
+		return id, 0, nil
+	}
+
+	if header == "" {
+		if t.require {
+			return "", http.StatusUnauthorized, errTenantRequired
+		}
+		return "", 0, nil
+	}
+	tenant, ok := t.tenants[header]
+	if !ok {
+		return "", http.StatusForbidden, fmt.Errorf("%w: %s", errUnknownTenant, header)
+	}
+	if len(tenant.APIKeys) > 0 {
+		return "", http.StatusUnauthorized, fmt.Errorf("%w: %s", errTenantKey, header)
+	}
+	return header, 0, nil
+}
+
+// server returns the server of a tenant, opening it on first use. The
+// store is opened without holding the router's lock, so other tenants are
+// served meanwhile; requests of the same tenant wait for it. A failed open
+// is retried by the next request. No servers are opened once the router is
+// closed.
+func (t *TenantRouter) server(id string) (*Server, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, errRouterClosed
+	}
+	ts, ok := t.servers[id]
+	if !ok {
+		ts = &tenantServer{ready: make(chan struct{})}
+		t.servers[id] = ts
+	}
+	t.mu.Unlock()
+
+	if !ok {
+		t.openServer(id, ts)
+	}
+	<-ts.ready
+	if ts.err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errTenantUnavailable, id, ts.err)
+	}
+	return ts.srv, nil
+}
+
+// openServer opens the server of a tenant into ts. Its ready channel is
+// closed even if the open panics, so the requests waiting for it fail
+// rather than block forever.
+func (t *TenantRouter) openServer(id string, ts *tenantServer) {
+	ts.err = errTenantPanic
+	defer func() {
+		if ts.err != nil {
+			t.mu.Lock()
+			if t.servers[id] == ts {
+				delete(t.servers, id)
+			}
+			t.mu.Unlock()
+		}
+		close(ts.ready)
+	}()
+	ts.srv, ts.err = t.open(id)
+}
+
+// ServeHTTP routes a request to the server of its tenant
+func (t *TenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Liveness of the deployment does not depend on a tenant
+	if r.URL.Path == "/health" && r.Header.Get(TenantHeader) == "" && requestKey(r) == "" {
+		t.root.ServeHTTP(w, r)
+		return
+	}
+
+	id, status, err := t.resolve(r)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if id == "" {
+		t.root.ServeHTTP(w, r)
+		return
+	}
+
+	srv, err := t.server(id)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set(TenantHeader, id)
+	srv.ServeHTTP(w, r)
+}
+
+// ListenAndServe starts serving on the given address
+func (t *TenantRouter) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, t)
+}
+
+// Close closes the stores of the tenant servers opened so far, waiting
+// for those still opening. Requests of tenants are rejected afterwards.
+func (t *TenantRouter) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	servers := t.servers
+	t.servers = make(map[string]*tenantServer)
+	t.mu.Unlock()
+
+	var errs []error
+	for id, ts := range servers {
+		<-ts.ready
+		if ts.err != nil {
+			continue
+		}
+		if err := ts.srv.Store().Close(); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// uiFiles holds the static assets of the web admin UI
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiHandler serves the web admin UI at /ui/. The pages only call the
+// server's JSON endpoints, so the UI needs no handlers of its own.
+func uiHandler() http.Handler {
+	static, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/ui/", http.FileServer(http.FS(static)))
+}
@@ -0,0 +1,232 @@
+// VectoDB admin UI. Every page is rendered from the server's JSON endpoints.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+// api calls an endpoint and returns its JSON body, throwing its error message
+async function api(path, body) {
+  const options = body === undefined ? {} : {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify(body),
+  };
+  const resp = await fetch(path, options);
+  const data = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new Error(data.error || resp.statusText);
+  }
+  return data;
+}
+
+// fillTable renders rows of cells under a header row
+function fillTable(table, header, rows) {
+  table.replaceChildren();
+  const head = table.insertRow();
+  for (const name of header) {
+    const th = document.createElement("th");
+    th.textContent = name;
+    head.appendChild(th);
+  }
+  for (const row of rows) {
+    const tr = table.insertRow();
+    for (const cell of row) {
+      const td = tr.insertCell();
+      if (cell instanceof Node) {
+        td.appendChild(cell);
+      } else {
+        td.textContent = format(cell);
+      }
+    }
+  }
+}
+
+function format(value) {
+  if (value === null || value === undefined) {
+    return "";
+  }
+  if (Array.isArray(value)) {
+    return value.length > 8 ? `[${value.slice(0, 8).map(format).join(", ")}, … +${value.length - 8}]` : `[${value.map(format).join(", ")}]`;
+  }
+  if (typeof value === "number" && !Number.isInteger(value)) {
+    return value.toPrecision(6);
+  }
+  if (typeof value === "object") {
+    return JSON.stringify(value);
+  }
+  return String(value);
+}
+
+function vectorLink(id) {
+  const a = document.createElement("a");
+  a.href = "#vector/" + encodeURIComponent(id);
+  a.textContent = id;
+  return a;
+}
+
+function setStatus(el, text, error) {
+  el.textContent = text;
+  el.className = error ? "error" : "";
+}
+
+// Collection page
+
+async function showStats() {
+  const [stats, models] = await Promise.all([api("/stats"), api("/models/stats")]);
+  $("stats-collection").textContent = stats.collection;
+
+  const summary = $("stats-summary");
+  summary.replaceChildren();
+  for (const [name, value] of [["Vectors", stats.vectors], ["Metric", stats.metric]]) {
+    const dt = document.createElement("dt");
+    dt.textContent = name;
+    const dd = document.createElement("dd");
+    dd.textContent = value;
+    summary.append(dt, dd);
+  }
+
+  fillTable($("stats-dimensions"), ["Dimension", "Vectors"], Object.entries(stats.dimensions));
+  fillTable($("stats-keys"), ["Key", "Vectors"],
+    Object.entries(stats.metadata_keys).sort((a, b) => b[1] - a[1] || a[0].localeCompare(b[0])));
+  fillTable($("stats-indexes"), ["Collection", "Type", "Metric", "Vectors", "Built", "Rebuilding"],
+    stats.indexes.map((i) => [i.collection, i.type, i.metric, i.vectors, i.built_at, i.rebuilding]));
+  fillTable($("stats-models"), ["Provider", "Model", "Calls", "Failures", "Tokens", "Cost"],
+    models.map((m) => [m.provider, m.model, m.calls, m.failures, m.tokens, m.cost]));
+}
+
+// SQL page
+
+async function runSQL(event) {
+  event.preventDefault();
+  const status = $("sql-status");
+  setStatus(status, "Running…");
+  const started = performance.now();
+  try {
+    const result = await api("/sql", {query: $("sql-query").value});
+    const idColumn = result.columns.indexOf("id");
+    const rows = result.rows.map((row) => row.map((cell, i) => i === idColumn ? vectorLink(cell) : cell));
+    fillTable($("sql-result"), result.columns, rows);
+    setStatus(status, `${rows.length} rows in ${Math.round(performance.now() - started)} ms`);
+  } catch (err) {
+    $("sql-result").replaceChildren();
+    setStatus(status, err.message, true);
+  }
+}
+
+// Vector page
+
+async function loadIDs() {
+  const result = await api("/vectors?limit=1000");
+  $("vector-ids").replaceChildren(...result.ids.map((id) => {
+    const option = document.createElement("option");
+    option.value = id;
+    return option;
+  }));
+}
+
+async function showVector(id) {
+  const status = $("vector-status");
+  $("vector-id").value = id;
+  $("vector-detail").hidden = true;
+  if (!id) {
+    return;
+  }
+  setStatus(status, "Loading…");
+  try {
+    const v = await api("/vectors/" + encodeURIComponent(id));
+    $("vector-title").textContent = `${v.id} (${v.values.length} dimensions)`;
+    fillTable($("vector-metadata"), ["Key", "Value"], Object.entries(v.metadata || {}).sort());
+    $("vector-values").textContent = v.values.map((x) => x.toFixed(4)).join(", ");
+
+    // The vector itself is the nearest, so one more than k is requested
+    const k = Math.max(1, parseInt($("vector-k").value, 10) || 10);
+    const result = await api("/sql", {query: `SELECT id, distance FROM vectors NEAREST TO [${v.values.join(",")}] LIMIT ${k + 1}`});
+    const neighbors = result.rows.map(([nid, distance]) => ({id: nid, distance})).filter((n) => n.id !== v.id).slice(0, k);
+    fillTable($("vector-neighbors"), ["ID", "Distance"], neighbors.map((n) => [vectorLink(n.id), n.distance]));
+    plotNeighbors(v.id, neighbors);
+
+    $("vector-detail").hidden = false;
+    setStatus(status, "");
+  } catch (err) {
+    setStatus(status, err.message, true);
+  }
+}
+
+// plotNeighbors draws the neighbors around the vector, each at a radius
+// proportional to its distance
+function plotNeighbors(id, neighbors) {
+  const svg = $("vector-plot");
+  const ns = "http://www.w3.org/2000/svg";
+  const el = (name, attrs) => {
+    const node = document.createElementNS(ns, name);
+    for (const [key, value] of Object.entries(attrs)) {
+      node.setAttribute(key, value);
+    }
+    return node;
+  };
+  svg.replaceChildren();
+
+  const radius = 180;
+  const farthest = Math.max(...neighbors.map((n) => n.distance), 1e-9);
+  for (const ring of [0.25, 0.5, 0.75, 1]) {
+    svg.appendChild(el("circle", {class: "ring", r: radius * ring}));
+    const label = el("text", {x: 2, y: -radius * ring - 2});
+    label.textContent = format(farthest * ring);
+    svg.appendChild(label);
+  }
+
+  neighbors.forEach((n, i) => {
+    const angle = (2 * Math.PI * i) / neighbors.length - Math.PI / 2;
+    const r = radius * (n.distance / farthest);
+    const x = r * Math.cos(angle);
+    const y = r * Math.sin(angle);
+    svg.appendChild(el("line", {x1: 0, y1: 0, x2: x, y2: y, stroke: "#c8cfdf"}));
+    const dot = el("circle", {class: "neighbor", cx: x, cy: y, r: 5});
+    const title = el("title", {});
+    title.textContent = `${n.id}: ${format(n.distance)}`;
+    dot.appendChild(title);
+    dot.addEventListener("click", () => { location.hash = "#vector/" + encodeURIComponent(n.id); });
+    svg.appendChild(dot);
+    const label = el("text", {x: x + 7, y: y + 3});
+    label.textContent = n.id;
+    svg.appendChild(label);
+  });
+
+  svg.appendChild(el("circle", {class: "center", r: 6}));
+  const label = el("text", {x: 8, y: 14});
+  label.textContent = id;
+  svg.appendChild(label);
+}
+
+// Routing: #stats, #sql, #vector and #vector/<id>
+
+function route() {
+  const [page, ...rest] = location.hash.slice(1).split("/");
+  const name = ["stats", "sql", "vector"].includes(page) ? page : "stats";
+  for (const section of document.querySelectorAll(".page")) {
+    section.classList.toggle("active", section.id === name + "-page");
+  }
+  for (const link of document.querySelectorAll("nav a")) {
+    link.classList.toggle("active", link.getAttribute("href") === "#" + name);
+  }
+
+  const fail = (err) => console.error(err);
+  if (name === "stats") {
+    showStats().catch(fail);
+  } else if (name === "vector") {
+    loadIDs().catch(fail);
+    showVector(decodeURIComponent(rest.join("/"))).catch(fail);
+  }
+}
+
+$("sql-form").addEventListener("submit", runSQL);
+$("vector-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const target = "#vector/" + encodeURIComponent($("vector-id").value.trim());
+  if (location.hash === target) {
+    route();
+  } else {
+    location.hash = target;
+  }
+});
+window.addEventListener("hashchange", route);
+route();
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogAndTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "audit.log")
+
+	// A missing log has no entries
+	entries, err := Tail(path, 10)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("Tail() on a missing log = %v, %v", entries, err)
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Record(Entry{Actor: "cli:test", Operation: OpInsert, Statement: "INSERT", Affected: 1})
+		}()
+	}
+	wg.Wait()
+	log.Record(Entry{Actor: "cli:test", Operation: OpDrop, Statement: "DROP COLLECTION vectors CONFIRM", Affected: 10})
+	log.Close()
+
+	// Reopening appends rather than truncates
+	log, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	log.Record(Entry{Actor: "cli:test", Operation: OpDelete, Statement: "DELETE", Error: "boom"})
+	log.Close()
+
+	entries, err = Tail(path, 0)
+	if err != nil {
+		t.Fatalf("Tail() error = %v", err)
+	}
+	if len(entries) != 12 {
+		t.Fatalf("Expected 12 entries, got %d", len(entries))
+	}
+
+	entries, err = Tail(path, 2)
+	if err != nil {
+		t.Fatalf("Tail() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Operation != OpDrop || entries[1].Error != "boom" {
+		t.Errorf("Unexpected tail: %+v", entries)
+	}
+	if entries[0].Time.IsZero() {
+		t.Error("Expected entries to be timestamped")
+	}
+}
+
+func TestKeyActor(t *testing.T) {
+	actor := KeyActor("secret")
+	if !strings.HasPrefix(actor, "key:") || strings.Contains(actor, "secret") {
+		t.Errorf("KeyActor() = %q", actor)
+	}
+	if actor != KeyActor("secret") || actor == KeyActor("other") {
+		t.Error("Expected a stable fingerprint per key")
+	}
+}
@@ -0,0 +1,186 @@
+// Package bundle packs a built search index and the vectors it was built
+// from into a single file. An index built offline on a large machine can be
+// copied to small instances and served there without rebuilding it.
+//
+// A bundle is an index file (see package index) of the "bundle" type whose
+// payload holds the index file of the bundled index and the vectors.
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// fileKind names bundles in index files
+const fileKind = "bundle"
+
+// fileV1 is the payload of bundles of payload version 1
+type fileV1 struct {
+	Collection string
+	IndexType  string
+	CreatedAt  time.Time
+	Index      []byte // Index file of the bundled index
+	Vectors    []index.VectorRecord
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV1) EncodePayload(e *index.Encoder) {
+	e.String(f.Collection)
+	e.String(f.IndexType)
+	e.Time(f.CreatedAt)
+	e.ByteSlice(f.Index)
+	e.Uint32(uint32(len(f.Vectors)))
+	for _, record := range f.Vectors {
+		e.Vector(record)
+	}
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV1) DecodePayload(d *index.Decoder) {
+	f.Collection = d.String()
+	f.IndexType = d.String()
+	f.CreatedAt = d.Time()
+	f.Index = d.ByteSlice()
+	f.Vectors = make([]index.VectorRecord, d.Len(4))
+	for i := range f.Vectors {
+		f.Vectors[i] = d.Vector()
+	}
+}
+
+// Manifest describes a bundle
+type Manifest struct {
+	Collection string    `json:"collection"`
+	IndexType  string    `json:"index_type"` // Index type the executor builds, e.g. hnsw
+	Metric     string    `json:"metric"`
+	Vectors    int       `json:"vectors"`
+	Dimension  int       `json:"dimension"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Bundle is an opened bundle
+type Bundle struct {
+	Manifest
+	Vectors []*vector.Vector
+
+	index []byte
+}
+
+// Create writes a bundle of idx, an index of indexType for collection, and
+// the vectors it was built from to path
+func Create(path, collection, indexType string, idx index.Index, vectors []*vector.Vector) (*Manifest, error) {
+	if idx.Size() != len(vectors) {
+		return nil, fmt.Errorf("index holds %d vectors, but %d were given", idx.Size(), len(vectors))
+	}
+
+	// Indexes only save to files
+	dir, err := os.MkdirTemp("", "vectodb-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	indexPath := filepath.Join(dir, "index.idx")
+	if err := idx.Save(indexPath); err != nil {
+		return nil, fmt.Errorf("failed to save index: %w", err)
+	}
+	header, err := index.InspectFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+
+	file := fileV1{
+		Collection: collection,
+		IndexType:  indexType,
+		CreatedAt:  time.Now().UTC(),
+		Index:      data,
+		Vectors:    make([]index.VectorRecord, len(vectors)),
+	}
+	dimension := header.Dimension
+	for i, vec := range vectors {
+		file.Vectors[i] = index.NewVectorRecord(vec)
+		dimension = vec.Dimension
+	}
+	bundleHeader := index.FileHeader{Kind: fileKind, PayloadVersion: 1, Metric: header.Metric, Vectors: len(vectors), Dimension: dimension}
+	if err := index.WriteFile(path, bundleHeader, file); err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		Collection: collection,
+		IndexType:  indexType,
+		Metric:     header.Metric,
+		Vectors:    len(vectors),
+		Dimension:  dimension,
+		CreatedAt:  file.CreatedAt,
+	}, nil
+}
+
+// Open reads and verifies the bundle at path
+func Open(path string) (*Bundle, error) {
+	header, payload, err := index.ReadFile(path, fileKind)
+	if errors.Is(err, index.ErrNotIndexFile) {
+		return nil, fmt.Errorf("%w: %s is not a bundle", err, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if header.PayloadVersion != 1 {
+		return nil, fmt.Errorf("%w: bundle payload version %d", index.ErrFileVersion, header.PayloadVersion)
+	}
+
+	var file fileV1
+	if err := index.DecodePayload(header, payload, &file); err != nil {
+		return nil, err
+	}
+	b := &Bundle{
+		Manifest: Manifest{
+			Collection: file.Collection,
+			IndexType:  file.IndexType,
+			Metric:     header.Metric,
+			Vectors:    len(file.Vectors),
+			Dimension:  header.Dimension,
+			CreatedAt:  file.CreatedAt,
+		},
+		Vectors: make([]*vector.Vector, len(file.Vectors)),
+		index:   file.Index,
+	}
+	for i, record := range file.Vectors {
+		b.Vectors[i] = record.Vector()
+	}
+	return b, nil
+}
+
+// LoadIndex loads the bundled index into idx, which must be of the bundled
+// type
+func (b *Bundle) LoadIndex(idx index.Index) error {
+	dir, err := os.MkdirTemp("", "vectodb-bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.idx")
+	if err := os.WriteFile(path, b.index, 0644); err != nil {
+		return err
+	}
+	return idx.Load(path)
+}
+
+// Store returns the bundled vectors in a read-only memory store
+func (b *Bundle) Store() (storage.VectorStore, error) {
+	store := storage.NewMemoryStore()
+	for _, vec := range b.Vectors {
+		if err := store.Insert(vec); err != nil {
+			return nil, err
+		}
+	}
+	return storage.NewReadOnlyStore(store), nil
+}
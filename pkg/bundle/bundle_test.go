@@ -0,0 +1,81 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+func TestCreateAndOpen(t *testing.T) {
+	metric := &distance.CosineDistance{}
+	vectors := make([]*vector.Vector, 50)
+	for i := range vectors {
+		vectors[i] = vector.NewVectorWithMetadata(fmt.Sprintf("v%02d", i), []float32{float32(i), 1, 2}, map[string]string{"n": fmt.Sprint(i)})
+	}
+	idx := hnsw.NewHNSWIndex(metric, nil)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "docs.vdb")
+	manifest, err := Create(path, "docs", "hnsw", idx, vectors)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if manifest.Metric != "cosine" || manifest.Vectors != 50 || manifest.Dimension != 3 {
+		t.Errorf("Unexpected manifest %+v", manifest)
+	}
+	if _, err := Create(path, "docs", "hnsw", idx, vectors[:10]); err == nil {
+		t.Error("Expected a bundle of other vectors than the index holds to fail")
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if b.Collection != "docs" || b.IndexType != "hnsw" || b.Metric != "cosine" || len(b.Vectors) != 50 {
+		t.Errorf("Unexpected bundle %+v", b.Manifest)
+	}
+
+	// The bundled graph is loaded, not rebuilt
+	loaded := hnsw.NewHNSWIndex(nil, nil)
+	if err := b.LoadIndex(loaded); err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+	loadedStats, err := loaded.GraphStats()
+	if err != nil {
+		t.Fatalf("GraphStats failed: %v", err)
+	}
+	stats, _ := idx.GraphStats()
+	if loadedStats.EntryPoint != stats.EntryPoint {
+		t.Errorf("Expected the bundled graph")
+	}
+	results, err := loaded.Search(vectors[7], 1)
+	if err != nil || results[0].ID != "v07" {
+		t.Errorf("Expected v07, got %+v (%v)", results, err)
+	}
+
+	store, err := b.Store()
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+	if v, err := store.Get("v07"); err != nil || v.Metadata["n"] != "7" {
+		t.Errorf("Expected v07 with its metadata, got %v (%v)", v, err)
+	}
+	if err := store.Delete("v07"); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Expected the store to be read-only, got %v", err)
+	}
+
+	// Plain index files are not bundles
+	idx.Save(path)
+	if _, err := Open(path); !errors.Is(err, index.ErrFileKind) {
+		t.Errorf("Expected ErrFileKind, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package distance
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ken/vector_database/internal/concurrency"
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+const (
+	// BackendCPU is the portable backend that is always available
+	BackendCPU = "cpu"
+
+	// BackendAuto selects the first available accelerated backend, falling
+	// back to the CPU
+	BackendAuto = "auto"
+
+	// parallelThreshold is the batch size from which the CPU backend splits
+	// work across goroutines
+	parallelThreshold = 4096
+)
+
+var (
+	// ErrBackendUnavailable is returned when a batch backend was not compiled in
+	ErrBackendUnavailable = errors.New("distance backend not available")
+
+	// ErrBatchSize is returned when the output slice does not match the batch
+	ErrBatchSize = errors.New("output length does not match number of vectors")
+)
+
+// BatchDistance computes the distances from one query to many vectors in a
+// single call, so accelerated backends (cgo/CUDA, Metal, ...) can amortize
+// data transfer over a whole brute-force scan or construction step
+type BatchDistance interface {
+	// Backend returns the name of the implementation
+	Backend() string
+
+	// Distances writes the distance from query to vectors[i] into out[i]
+	Distances(query *vector.Vector, vectors []*vector.Vector, out []float32) error
+}
+
+// BatchFactory creates a batch implementation for a metric. Factories return
+// ErrBackendUnavailable when the backend cannot serve the metric or no
+// device is present.
+type BatchFactory func(metric Metric) (BatchDistance, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]BatchFactory{
+		BackendCPU: newCPUBatch,
+	}
+
+	// preferredBackends is the order in which BackendAuto tries accelerators
+	preferredBackends = []string{"cuda", "metal"}
+
+	// defaultBackend is used by indexes that do not choose a backend
+	defaultBackend = BackendAuto
+)
+
+// RegisterBatchBackend makes a backend available by name. Accelerated
+// backends call it from init() in files guarded by build tags, so they are
+// only compiled in when requested, e.g. go build -tags cuda.
+func RegisterBatchBackend(name string, factory BatchFactory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	backends[name] = factory
+}
+
+// BatchBackends returns the names of the compiled-in backends
+func BatchBackends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefaultBatchBackend sets the backend used by NewDefaultBatchDistance
+func SetDefaultBatchBackend(name string) error {
+	if name == "" {
+		name = BackendAuto
+	}
+	if name != BackendAuto {
+		backendsMu.RLock()
+		_, ok := backends[name]
+		backendsMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("%w: %s (available: %v)", ErrBackendUnavailable, name, BatchBackends())
+		}
+	}
+
+	backendsMu.Lock()
+	defaultBackend = name
+	backendsMu.Unlock()
+	return nil
+}
+
+// NewBatchDistance creates a batch implementation for a metric using the
+// named backend. BackendAuto (or "") tries the preferred accelerated
+// backends and falls back to the CPU.
+func NewBatchDistance(metric Metric, backend string) (BatchDistance, error) {
+	if metric == nil {
+		return nil, errors.New("distance metric is required")
+	}
+
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	if backend != "" && backend != BackendAuto {
+		factory, ok := backends[backend]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrBackendUnavailable, backend)
+		}
+		return factory(metric)
+	}
+
+	for _, name := range preferredBackends {
+		if factory, ok := backends[name]; ok {
+			if batch, err := factory(metric); err == nil {
+				return batch, nil
+			}
+		}
+	}
+	return newCPUBatch(metric)
+}
+
+// NewDefaultBatchDistance creates a batch implementation using the default
+// backend, falling back to the CPU if it cannot serve the metric
+func NewDefaultBatchDistance(metric Metric) (BatchDistance, error) {
+	backendsMu.RLock()
+	backend := defaultBackend
+	backendsMu.RUnlock()
+
+	batch, err := NewBatchDistance(metric, backend)
+	if errors.Is(err, ErrBackendUnavailable) {
+		return newCPUBatch(metric)
+	}
+	return batch, err
+}
+
+// cpuBatch computes batches with the scalar metric, in parallel for large batches
+type cpuBatch struct {
+	metric Metric
+}
+
+func newCPUBatch(metric Metric) (BatchDistance, error) {
+	return &cpuBatch{metric: metric}, nil
+}
+
+func (b *cpuBatch) Backend() string {
+	return BackendCPU
+}
+
+func (b *cpuBatch) Distances(query *vector.Vector, vectors []*vector.Vector, out []float32) error {
+	if len(out) != len(vectors) {
+		return ErrBatchSize
+	}
+
+	if len(vectors) < parallelThreshold {
+		return b.distances(query, vectors, out)
+	}
+
+	// Split the batch into one contiguous chunk per worker
+	return concurrency.ForEachChunk(len(vectors), 1, func(start, end int) error {
+		return b.distances(query, vectors[start:end], out[start:end])
+	})
+}
+
+// distances computes a chunk sequentially
+func (b *cpuBatch) distances(query *vector.Vector, vectors []*vector.Vector, out []float32) error {
+	for i, vec := range vectors {
+		dist, err := b.metric.Distance(query, vec)
+		if err != nil {
+			return err
+		}
+		out[i] = dist
+	}
+	return nil
+}
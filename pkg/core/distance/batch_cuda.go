@@ -0,0 +1,88 @@
+//go:build cuda && cgo
+
+package distance
+
+/*
+#cgo LDFLAGS: -lvectodb_cuda
+
+// Implemented by an external libvectodb_cuda library. vectors holds n
+// row-major vectors of dim components; metric is 0 (euclidean), 1 (cosine),
+// 2 (dot product) or 3 (manhattan). Both functions return 0 on success.
+int vectodb_cuda_available(void);
+int vectodb_cuda_distances(int metric, const float *query, const float *vectors, int n, int dim, float *out);
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func init() {
+	RegisterBatchBackend("cuda", newCUDABatch)
+}
+
+// cudaMetrics maps metrics to the codes understood by the CUDA library
+var cudaMetrics = map[MetricType]C.int{
+	Euclidean:  0,
+	Cosine:     1,
+	DotProduct: 2,
+	Manhattan:  3,
+}
+
+// cudaBatch offloads batches to a CUDA device
+type cudaBatch struct {
+	metric C.int
+}
+
+func newCUDABatch(metric Metric) (BatchDistance, error) {
+	code, ok := cudaMetrics[metric.Name()]
+	if !ok {
+		return nil, fmt.Errorf("%w: cuda does not support metric %s", ErrBackendUnavailable, metric.Name())
+	}
+	if C.vectodb_cuda_available() != 0 {
+		return nil, fmt.Errorf("%w: no cuda device", ErrBackendUnavailable)
+	}
+	return &cudaBatch{metric: code}, nil
+}
+
+func (b *cudaBatch) Backend() string {
+	return "cuda"
+}
+
+func (b *cudaBatch) Distances(query *vector.Vector, vectors []*vector.Vector, out []float32) error {
+	if len(out) != len(vectors) {
+		return ErrBatchSize
+	}
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	// Copy the batch into one contiguous buffer for the transfer
+	dim := query.Dimension
+	if dim == 0 {
+		return vector.ErrInvalidDimension
+	}
+	flat := make([]float32, 0, len(vectors)*dim)
+	for _, vec := range vectors {
+		if vec.Dimension != dim {
+			return vector.ErrInvalidDimension
+		}
+		flat = append(flat, vec.Values...)
+	}
+
+	rc := C.vectodb_cuda_distances(
+		b.metric,
+		(*C.float)(unsafe.Pointer(&query.Values[0])),
+		(*C.float)(unsafe.Pointer(&flat[0])),
+		C.int(len(vectors)),
+		C.int(dim),
+		(*C.float)(unsafe.Pointer(&out[0])),
+	)
+	if rc != 0 {
+		return fmt.Errorf("cuda distance computation failed with code %d", int(rc))
+	}
+	return nil
+}
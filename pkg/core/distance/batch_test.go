@@ -0,0 +1,101 @@
+package distance
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// fakeBatch is a registered test backend that can refuse metrics
+type fakeBatch struct {
+	cpuBatch
+}
+
+func (b *fakeBatch) Backend() string {
+	return "fake"
+}
+
+func TestCPUBatchDistance(t *testing.T) {
+	metric := &EuclideanDistance{}
+	batch, err := NewBatchDistance(metric, BackendCPU)
+	if err != nil {
+		t.Fatalf("Failed to create batch: %v", err)
+	}
+	if batch.Backend() != BackendCPU {
+		t.Errorf("Expected cpu backend, got %s", batch.Backend())
+	}
+
+	// Large enough to exercise the parallel path
+	query := vector.NewVector("query", []float32{0.5, 0.5, 0.5})
+	vectors := make([]*vector.Vector, parallelThreshold+7)
+	for i := range vectors {
+		vectors[i] = vector.NewVector("v", []float32{float32(i), 0.0, 1.0})
+	}
+
+	out := make([]float32, len(vectors))
+	if err := batch.Distances(query, vectors, out); err != nil {
+		t.Fatalf("Failed to compute distances: %v", err)
+	}
+	for i, vec := range vectors {
+		expected, _ := metric.Distance(query, vec)
+		if out[i] != expected {
+			t.Fatalf("Distance %d: expected %f, got %f", i, expected, out[i])
+		}
+	}
+
+	if err := batch.Distances(query, vectors, out[:1]); !errors.Is(err, ErrBatchSize) {
+		t.Errorf("Expected ErrBatchSize, got %v", err)
+	}
+
+	vectors[len(vectors)-1] = vector.NewVector("bad", []float32{1.0})
+	if err := batch.Distances(query, vectors, out); !errors.Is(err, vector.ErrInvalidDimension) {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+}
+
+func TestBatchBackendSelection(t *testing.T) {
+	saved := preferredBackends
+	defer func() {
+		preferredBackends = saved
+		backendsMu.Lock()
+		delete(backends, "fake")
+		backendsMu.Unlock()
+		SetDefaultBatchBackend(BackendAuto)
+	}()
+
+	if _, err := NewBatchDistance(&CosineDistance{}, "fake"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected ErrBackendUnavailable before registration, got %v", err)
+	}
+	if err := SetDefaultBatchBackend("fake"); !errors.Is(err, ErrBackendUnavailable) {
+		t.Errorf("Expected ErrBackendUnavailable for default, got %v", err)
+	}
+
+	// The fake accelerator only supports euclidean distance
+	RegisterBatchBackend("fake", func(metric Metric) (BatchDistance, error) {
+		if metric.Name() != Euclidean {
+			return nil, ErrBackendUnavailable
+		}
+		return &fakeBatch{cpuBatch{metric: metric}}, nil
+	})
+	preferredBackends = []string{"fake"}
+
+	batch, err := NewBatchDistance(&EuclideanDistance{}, BackendAuto)
+	if err != nil || batch.Backend() != "fake" {
+		t.Errorf("Expected auto to pick the fake backend, got %v (err = %v)", batch, err)
+	}
+
+	// Unsupported metrics fall back to the CPU
+	batch, err = NewBatchDistance(&CosineDistance{}, "")
+	if err != nil || batch.Backend() != BackendCPU {
+		t.Errorf("Expected cpu fallback, got %v (err = %v)", batch, err)
+	}
+
+	if err := SetDefaultBatchBackend("fake"); err != nil {
+		t.Fatalf("Failed to set default backend: %v", err)
+	}
+	batch, err = NewDefaultBatchDistance(&ManhattanDistance{})
+	if err != nil || batch.Backend() != BackendCPU {
+		t.Errorf("Expected cpu fallback for the default backend, got %v (err = %v)", batch, err)
+	}
+}
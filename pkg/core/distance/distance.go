@@ -44,11 +44,27 @@ func GetMetric(metric MetricType) (Metric, error) {
 		return &DotProductDistance{}, nil
 	case Manhattan:
 		return &ManhattanDistance{}, nil
+	case Haversine:
+		return &HaversineDistance{}, nil
 	default:
 		return nil, errors.New("unknown distance metric")
 	}
 }
 
+// Similarity converts a distance under the given metric to a similarity
+// where larger is more similar: the cosine similarity for cosine, the dot
+// product for dot product, and 1/(1+d) in (0, 1] for Euclidean and Manhattan
+func Similarity(metric MetricType, d float32) float32 {
+	switch metric {
+	case Cosine:
+		return 1 - d
+	case DotProduct:
+		return -d
+	default:
+		return 1 / (1 + d)
+	}
+}
+
 // EuclideanDistance implements the Euclidean (L2) distance metric
 type EuclideanDistance struct{}
 
@@ -1,6 +1,7 @@
 package distance
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/ken/vector_database/pkg/core/vector"
@@ -94,6 +95,31 @@ func TestManhattanDistance(t *testing.T) {
 	}
 }
 
+func TestHaversineDistance(t *testing.T) {
+	amsterdam := vector.NewVector("ams", []float32{52.3676, 4.9041})
+	paris := vector.NewVector("par", []float32{48.8566, 2.3522})
+
+	dist, err := (&HaversineDistance{}).Distance(amsterdam, paris)
+	if err != nil {
+		t.Fatalf("Failed to calculate distance: %v", err)
+	}
+	if dist < 425 || dist > 435 {
+		t.Errorf("Expected about 430 km from Amsterdam to Paris, got %f", dist)
+	}
+
+	if _, err := (&HaversineDistance{}).Distance(amsterdam, vector.NewVector("x", []float32{1, 2, 3})); err != vector.ErrInvalidDimension {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+	if _, _, err := ParseGeoPoint("52.37, 4.89"); err != nil {
+		t.Errorf("Failed to parse point: %v", err)
+	}
+	for _, s := range []string{"52.37", "91,0", "0,east"} {
+		if _, _, err := ParseGeoPoint(s); !errors.Is(err, ErrInvalidGeoPoint) {
+			t.Errorf("%q: expected ErrInvalidGeoPoint, got %v", s, err)
+		}
+	}
+}
+
 func TestGetMetric(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -150,4 +176,22 @@ func TestInvalidDimension(t *testing.T) {
 			}
 		})
 	}
-} 
\ No newline at end of file
+} 
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		metric   MetricType
+		distance float32
+		want     float32
+	}{
+		{Cosine, 0.25, 0.75},
+		{DotProduct, -3, 3},
+		{Euclidean, 0, 1},
+		{Manhattan, 1, 0.5},
+	}
+
+	for _, tt := range tests {
+		if got := Similarity(tt.metric, tt.distance); got != tt.want {
+			t.Errorf("Similarity(%s, %f) = %f, want %f", tt.metric, tt.distance, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package distance
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// Haversine distance metric between [latitude, longitude] vectors in
+// degrees, in kilometers along the Earth's surface
+const Haversine MetricType = "haversine"
+
+// EarthRadiusKm is the mean radius of the Earth
+const EarthRadiusKm = 6371.0088
+
+// ErrInvalidGeoPoint is returned for coordinates that are not a latitude in
+// [-90, 90] and a longitude in [-180, 180]
+var ErrInvalidGeoPoint = errors.New("invalid geo point")
+
+// HaversineKm returns the great-circle distance in kilometers between two
+// points given in degrees
+func HaversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// ValidGeoPoint reports whether lat and lon are coordinates in degrees
+func ValidGeoPoint(lat, lon float64) error {
+	if math.IsNaN(lat) || math.IsNaN(lon) || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return fmt.Errorf("%w: %g, %g", ErrInvalidGeoPoint, lat, lon)
+	}
+	return nil
+}
+
+// ParseGeoPoint parses "latitude,longitude" in degrees, e.g. "52.37,4.89"
+func ParseGeoPoint(s string) (lat, lon float64, err error) {
+	latText, lonText, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %q is not latitude,longitude", ErrInvalidGeoPoint, s)
+	}
+	lat, err = strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q is not latitude,longitude", ErrInvalidGeoPoint, s)
+	}
+	lon, err = strconv.ParseFloat(strings.TrimSpace(lonText), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %q is not latitude,longitude", ErrInvalidGeoPoint, s)
+	}
+	return lat, lon, ValidGeoPoint(lat, lon)
+}
+
+// HaversineDistance implements the haversine metric over two-dimensional
+// [latitude, longitude] vectors
+type HaversineDistance struct{}
+
+func (d *HaversineDistance) Distance(a, b *vector.Vector) (float32, error) {
+	if a.Dimension != 2 || b.Dimension != 2 {
+		return 0, vector.ErrInvalidDimension
+	}
+	return float32(HaversineKm(float64(a.Values[0]), float64(a.Values[1]), float64(b.Values[0]), float64(b.Values[1]))), nil
+}
+
+func (d *HaversineDistance) Name() MetricType {
+	return Haversine
+}
@@ -0,0 +1,207 @@
+package projection
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/fileutil"
+)
+
+const (
+	// MetadataKeySourceDimension is the metadata key recording the dimension
+	// a vector had before it was projected
+	MetadataKeySourceDimension = "source_dimension"
+)
+
+var (
+	// ErrInvalidMatrix is returned when a projection matrix is empty or ragged
+	ErrInvalidMatrix = errors.New("invalid projection matrix")
+
+	// ErrAdapterMismatch is returned when an adapter does not produce the
+	// collection's dimension
+	ErrAdapterMismatch = errors.New("adapter output dimension does not match collection")
+)
+
+// Projection is a linear map from one vector dimension to another
+type Projection struct {
+	in      int       // Input dimension
+	out     int       // Output dimension
+	weights []float32 // Row-major out x in matrix
+}
+
+// NewRandomProjection creates a Gaussian random projection from in to out
+// dimensions. Entries are drawn from N(0, 1/out), which approximately
+// preserves distances (Johnson-Lindenstrauss). The same seed always yields
+// the same matrix, so stored and query vectors are projected consistently.
+func NewRandomProjection(in, out int, seed int64) (*Projection, error) {
+	if in < 1 || out < 1 {
+		return nil, fmt.Errorf("%w: dimensions must be positive, got %dx%d", ErrInvalidMatrix, out, in)
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	scale := 1 / math.Sqrt(float64(out))
+
+	weights := make([]float32, in*out)
+	for i := range weights {
+		weights[i] = float32(r.NormFloat64() * scale)
+	}
+
+	return &Projection{in: in, out: out, weights: weights}, nil
+}
+
+// NewMatrixProjection creates a projection from a matrix with one row per
+// output dimension
+func NewMatrixProjection(rows [][]float32) (*Projection, error) {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return nil, fmt.Errorf("%w: matrix is empty", ErrInvalidMatrix)
+	}
+
+	in := len(rows[0])
+	weights := make([]float32, 0, len(rows)*in)
+	for i, row := range rows {
+		if len(row) != in {
+			return nil, fmt.Errorf("%w: row %d has %d columns, expected %d", ErrInvalidMatrix, i, len(row), in)
+		}
+		weights = append(weights, row...)
+	}
+
+	return &Projection{in: in, out: len(rows), weights: weights}, nil
+}
+
+// LoadMatrix loads a learned projection from a JSON file containing a matrix
+// with one row per output dimension, e.g. [[0.1, 0.2, ...], ...]
+func LoadMatrix(path string) (*Projection, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read projection matrix: %w", err)
+	}
+
+	var rows [][]float32
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, fmt.Errorf("failed to parse projection matrix %s: %w", path, err)
+	}
+
+	return NewMatrixProjection(rows)
+}
+
+// Save writes the projection matrix to a JSON file readable by LoadMatrix
+func (p *Projection) Save(path string) error {
+	rows := make([][]float32, p.out)
+	for i := range rows {
+		rows[i] = p.weights[i*p.in : (i+1)*p.in]
+	}
+
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return fmt.Errorf("failed to marshal projection matrix: %w", err)
+	}
+	if err := fileutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write projection matrix: %w", err)
+	}
+	return nil
+}
+
+// InputDimension returns the dimension of vectors the projection accepts
+func (p *Projection) InputDimension() int {
+	return p.in
+}
+
+// OutputDimension returns the dimension of projected vectors
+func (p *Projection) OutputDimension() int {
+	return p.out
+}
+
+// Project maps a vector into the output dimension. The result keeps the ID
+// and metadata of the input and records the original dimension.
+func (p *Projection) Project(v *vector.Vector) (*vector.Vector, error) {
+	if v.Dimension != p.in {
+		return nil, fmt.Errorf("%w: projection expects %d, got %d", vector.ErrInvalidDimension, p.in, v.Dimension)
+	}
+
+	values := make([]float32, p.out)
+	for i := 0; i < p.out; i++ {
+		row := p.weights[i*p.in : (i+1)*p.in]
+		var sum float32
+		for j, w := range row {
+			sum += w * v.Values[j]
+		}
+		values[i] = sum
+	}
+
+	projected := vector.NewVector(v.ID, values)
+	for key, value := range v.Metadata {
+		projected.Metadata[key] = value
+	}
+	projected.Metadata[MetadataKeySourceDimension] = strconv.Itoa(v.Dimension)
+
+	return projected, nil
+}
+
+// Adapters maps vectors of other dimensions into a collection's dimension
+// using one projection per source dimension
+type Adapters struct {
+	mu          sync.RWMutex
+	dimension   int
+	projections map[int]*Projection
+}
+
+// NewAdapters creates an empty adapter set for a collection dimension
+func NewAdapters(dimension int) *Adapters {
+	return &Adapters{
+		dimension:   dimension,
+		projections: make(map[int]*Projection),
+	}
+}
+
+// Dimension returns the collection dimension adapters project into
+func (a *Adapters) Dimension() int {
+	return a.dimension
+}
+
+// Add registers a projection for its input dimension, replacing any
+// existing one
+func (a *Adapters) Add(p *Projection) error {
+	if p.OutputDimension() != a.dimension {
+		return fmt.Errorf("%w: %d -> %d, collection has %d",
+			ErrAdapterMismatch, p.InputDimension(), p.OutputDimension(), a.dimension)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.projections[p.InputDimension()] = p
+	return nil
+}
+
+// Len returns the number of registered projections
+func (a *Adapters) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return len(a.projections)
+}
+
+// Adapt projects a vector into the collection dimension. Vectors that already
+// have that dimension, or for which no adapter is registered, are returned
+// unchanged.
+func (a *Adapters) Adapt(v *vector.Vector) (*vector.Vector, error) {
+	if v == nil || v.Dimension == a.dimension {
+		return v, nil
+	}
+
+	a.mu.RLock()
+	p, ok := a.projections[v.Dimension]
+	a.mu.RUnlock()
+
+	if !ok {
+		return v, nil
+	}
+	return p.Project(v)
+}
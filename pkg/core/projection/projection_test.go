@@ -0,0 +1,114 @@
+package projection
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestRandomProjection(t *testing.T) {
+	p, err := NewRandomProjection(8, 4, 42)
+	if err != nil {
+		t.Fatalf("Failed to create projection: %v", err)
+	}
+
+	v := vector.NewVector("v1", []float32{1, 2, 3, 4, 5, 6, 7, 8})
+	v.Metadata["category"] = "text"
+
+	projected, err := p.Project(v)
+	if err != nil {
+		t.Fatalf("Failed to project vector: %v", err)
+	}
+	if projected.ID != "v1" || projected.Dimension != 4 {
+		t.Errorf("Expected v1 with dimension 4, got %s with dimension %d", projected.ID, projected.Dimension)
+	}
+	if projected.Metadata["category"] != "text" || projected.Metadata[MetadataKeySourceDimension] != "8" {
+		t.Errorf("Unexpected metadata: %v", projected.Metadata)
+	}
+
+	// The same seed must give the same projection
+	again, _ := NewRandomProjection(8, 4, 42)
+	other, err := again.Project(v)
+	if err != nil {
+		t.Fatalf("Failed to project vector: %v", err)
+	}
+	for i := range projected.Values {
+		if projected.Values[i] != other.Values[i] {
+			t.Fatalf("Expected deterministic projection, got %v and %v", projected.Values, other.Values)
+		}
+	}
+
+	// Vectors of the wrong dimension are rejected
+	if _, err := p.Project(vector.NewVector("v2", []float32{1, 2})); !errors.Is(err, vector.ErrInvalidDimension) {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+}
+
+func TestMatrixProjection(t *testing.T) {
+	if _, err := NewMatrixProjection([][]float32{{1, 0}, {0}}); !errors.Is(err, ErrInvalidMatrix) {
+		t.Errorf("Expected ErrInvalidMatrix for a ragged matrix, got %v", err)
+	}
+
+	// Keep the first and the sum of the last two components
+	p, err := NewMatrixProjection([][]float32{{1, 0, 0}, {0, 1, 1}})
+	if err != nil {
+		t.Fatalf("Failed to create projection: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "matrix.json")
+	if err := p.Save(path); err != nil {
+		t.Fatalf("Failed to save matrix: %v", err)
+	}
+	loaded, err := LoadMatrix(path)
+	if err != nil {
+		t.Fatalf("Failed to load matrix: %v", err)
+	}
+	if loaded.InputDimension() != 3 || loaded.OutputDimension() != 2 {
+		t.Fatalf("Expected a 3 -> 2 projection, got %d -> %d", loaded.InputDimension(), loaded.OutputDimension())
+	}
+
+	projected, err := loaded.Project(vector.NewVector("v1", []float32{1, 2, 3}))
+	if err != nil {
+		t.Fatalf("Failed to project vector: %v", err)
+	}
+	if projected.Values[0] != 1 || projected.Values[1] != 5 {
+		t.Errorf("Expected [1 5], got %v", projected.Values)
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	adapters := NewAdapters(2)
+
+	wrong, _ := NewRandomProjection(3, 4, 1)
+	if err := adapters.Add(wrong); !errors.Is(err, ErrAdapterMismatch) {
+		t.Errorf("Expected ErrAdapterMismatch, got %v", err)
+	}
+
+	p, _ := NewMatrixProjection([][]float32{{1, 0, 0}, {0, 1, 1}})
+	if err := adapters.Add(p); err != nil {
+		t.Fatalf("Failed to add adapter: %v", err)
+	}
+
+	// Vectors in the collection dimension pass through untouched
+	native := vector.NewVector("native", []float32{1, 2})
+	if adapted, _ := adapters.Adapt(native); adapted != native {
+		t.Errorf("Expected native vector to pass through")
+	}
+
+	// Vectors with a registered adapter are projected
+	adapted, err := adapters.Adapt(vector.NewVector("other", []float32{1, 2, 3}))
+	if err != nil {
+		t.Fatalf("Failed to adapt vector: %v", err)
+	}
+	if adapted.Dimension != 2 {
+		t.Errorf("Expected dimension 2, got %d", adapted.Dimension)
+	}
+
+	// Vectors without an adapter are left for the store to validate
+	unknown := vector.NewVector("unknown", []float32{1, 2, 3, 4})
+	if adapted, _ := adapters.Adapt(unknown); adapted != unknown {
+		t.Errorf("Expected vector without adapter to pass through")
+	}
+}
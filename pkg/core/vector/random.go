@@ -0,0 +1,123 @@
+package vector
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+// Distribution selects how random vector components are drawn
+type Distribution string
+
+const (
+	// Uniform draws each component uniformly from [0, 1)
+	Uniform Distribution = "uniform"
+
+	// Gaussian draws each component from the standard normal distribution
+	Gaussian Distribution = "gaussian"
+
+	// UnitSphere draws vectors uniformly from the surface of the unit sphere
+	UnitSphere Distribution = "sphere"
+)
+
+// ErrUnknownDistribution is returned for an unsupported distribution name
+var ErrUnknownDistribution = errors.New("unknown distribution")
+
+// ParseDistribution converts a distribution name to a Distribution
+func ParseDistribution(name string) (Distribution, error) {
+	switch dist := Distribution(strings.ToLower(name)); dist {
+	case Uniform, Gaussian, UnitSphere:
+		return dist, nil
+	default:
+		return "", fmt.Errorf("%w: %s (supported: uniform, gaussian, sphere)", ErrUnknownDistribution, name)
+	}
+}
+
+// Generator creates random vectors from a distribution. Generators with the
+// same seed and distribution produce the same vectors. A Generator is not
+// safe for concurrent use.
+type Generator struct {
+	rng  *rand.Rand
+	dist Distribution
+}
+
+// NewGenerator creates a generator seeded with seed
+func NewGenerator(dist Distribution, seed int64) (*Generator, error) {
+	if _, err := ParseDistribution(string(dist)); err != nil {
+		return nil, err
+	}
+	return &Generator{rng: rand.New(rand.NewSource(seed)), dist: dist}, nil
+}
+
+// Next creates the next random vector
+func (g *Generator) Next(id string, dimension int) *Vector {
+	values := make([]float32, dimension)
+	switch g.dist {
+	case Uniform:
+		for i := range values {
+			values[i] = float32(g.rng.Float64())
+		}
+	case Gaussian, UnitSphere:
+		for i := range values {
+			values[i] = float32(g.rng.NormFloat64())
+		}
+	}
+
+	// Normalized Gaussian vectors are uniform on the sphere
+	if g.dist == UnitSphere {
+		var norm float64
+		for _, v := range values {
+			norm += float64(v) * float64(v)
+		}
+		if norm = math.Sqrt(norm); norm > 0 {
+			for i := range values {
+				values[i] = float32(float64(values[i]) / norm)
+			}
+		}
+	}
+	return NewVector(id, values)
+}
+
+// ClusterGenerator creates vectors scattered around random cluster centers,
+// so that, as with real embeddings, a vector's nearest neighbors are much
+// closer than the rest. It is not safe for concurrent use.
+type ClusterGenerator struct {
+	rng     *rand.Rand
+	centers [][]float32
+	spread  float64
+}
+
+// NewClusterGenerator creates a generator of vectors around clusters centers
+// whose components are drawn from the standard normal distribution. The
+// components of each vector differ from its center's by a Gaussian with
+// standard deviation spread.
+func NewClusterGenerator(dimension, clusters int, spread float64, seed int64) (*ClusterGenerator, error) {
+	if dimension < 1 || clusters < 1 {
+		return nil, fmt.Errorf("invalid clusters: %d clusters of dimension %d", clusters, dimension)
+	}
+	if spread < 0 || math.IsNaN(spread) || math.IsInf(spread, 0) {
+		return nil, fmt.Errorf("invalid cluster spread: %v", spread)
+	}
+	g := &ClusterGenerator{rng: rand.New(rand.NewSource(seed)), spread: spread}
+	g.centers = make([][]float32, clusters)
+	for c := range g.centers {
+		g.centers[c] = make([]float32, dimension)
+		for i := range g.centers[c] {
+			g.centers[c][i] = float32(g.rng.NormFloat64())
+		}
+	}
+	return g, nil
+}
+
+// Next creates the next vector and returns it with the index of its cluster
+func (g *ClusterGenerator) Next(id string) (*Vector, int) {
+	cluster := g.rng.Intn(len(g.centers))
+	center := g.centers[cluster]
+	values := make([]float32, len(center))
+	for i := range values {
+		values[i] = center[i] + float32(g.rng.NormFloat64()*g.spread)
+	}
+	return NewVector(id, values), cluster
+}
@@ -2,24 +2,56 @@ package vector
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
+	"hash/crc32"
 	"math"
 	"math/rand"
 	"strings"
 	"time"
+
+	"github.com/ken/vector_database/pkg/errs"
 )
 
 var (
 	// ErrInvalidDimension is returned when vector dimensions don't match
-	ErrInvalidDimension = errors.New("invalid vector dimension")
+	ErrInvalidDimension = errs.New(errs.DimensionMismatch, "invalid vector dimension")
+
+	// ErrCorrupt is returned when an encoded vector is truncated or fails
+	// its checksum
+	ErrCorrupt = errs.New(errs.DataLoss, "corrupt vector")
+
+	// ErrNonFinite is returned when a vector has a NaN or infinite value
+	ErrNonFinite = errs.New(errs.InvalidArgument, "non-finite vector value")
 )
 
+// checksumSize is the length of the CRC32 that ends an encoded vector
+const checksumSize = 4
+
+// timestampsSize is the length of the creation and update times that
+// follow the metadata of an encoded vector
+const timestampsSize = 16
+
+// encodingMagic starts encoded vectors, followed by encodingVersion. Read as
+// the ID length that starts encodings written before it was added, it would
+// exceed 4 GB, so those cannot start with it and a truncated encoding is
+// never mistaken for one of them.
+const encodingMagic = "VEC\xff"
+
+// encodingVersion is the version of the layout Encode writes
+const encodingVersion = 1
+
+// headerSize is the length of the magic and version that start an encoded
+// vector
+const headerSize = len(encodingMagic) + 1
+
 // Vector represents a real-valued vector in n-dimensional space
 type Vector struct {
 	ID        string            // Unique identifier for the vector
 	Values    []float32         // Vector components
 	Dimension int               // Number of dimensions
 	Metadata  map[string]string // Additional metadata for the vector
+	CreatedAt time.Time         // When the vector was inserted; zero if unknown
+	UpdatedAt time.Time         // When the vector was last written; zero if unknown
 }
 
 // NewVector creates a new vector with the specified ID and values
@@ -52,15 +84,12 @@ func Zero(dimension int) *Vector {
 	}
 }
 
-// Random creates a random vector with values uniformly distributed in [0, 1)
+// Random creates a random vector with values uniformly distributed in [0, 1).
+// Use a Generator for other distributions or reproducible vectors.
 func Random(id string, dimension int) *Vector {
-	// Initialize rand with time seed if not already initialized
-	source := rand.NewSource(time.Now().UnixNano())
-	r := rand.New(source)
-	
 	values := make([]float32, dimension)
 	for i := 0; i < dimension; i++ {
-		values[i] = float32(r.Float64())
+		values[i] = float32(rand.Float64())
 	}
 	return &Vector{
 		ID:        id,
@@ -83,20 +112,45 @@ func (v *Vector) Copy() *Vector {
 		Values:    valuesCopy,
 		Dimension: v.Dimension,
 		Metadata:  metadataCopy,
+		CreatedAt: v.CreatedAt,
+		UpdatedAt: v.UpdatedAt,
+	}
+}
+
+// Meta returns a copy of the vector without its values, as read by
+// DecodeMeta
+func (v *Vector) Meta() *Vector {
+	metadata := make(map[string]string, len(v.Metadata))
+	for key, value := range v.Metadata {
+		metadata[key] = value
+	}
+	return &Vector{
+		ID:        v.ID,
+		Dimension: v.Dimension,
+		Metadata:  metadata,
+		CreatedAt: v.CreatedAt,
+		UpdatedAt: v.UpdatedAt,
 	}
 }
 
-// Encode serializes the vector to a byte slice
+// Encode serializes the vector to a byte slice that starts with the
+// encoding's magic and version and ends in its timestamps and a CRC32 of
+// the preceding bytes
 func (v *Vector) Encode() []byte {
 	// Convert metadata to a string representation
 	metadataStr := encodeMetadata(v.Metadata)
 	metadataBytes := []byte(metadataStr)
 	
 	// Calculate buffer size: 
-	// ID length (4 bytes) + ID + dimension (4 bytes) + values (4 bytes each) + metadata length (4 bytes) + metadata
+	// magic and version (5 bytes) + ID length (4 bytes) + ID + dimension (4 bytes) + values (4 bytes each) + metadata length (4 bytes) + metadata + timestamps (16 bytes) + checksum (4 bytes)
 	idBytes := []byte(v.ID)
-	bufSize := 4 + len(idBytes) + 4 + 4*v.Dimension + 4 + len(metadataBytes)
-	buf := make([]byte, bufSize)
+	bufSize := 4 + len(idBytes) + 4 + 4*v.Dimension + 4 + len(metadataBytes) + timestampsSize + checksumSize
+	encoded := make([]byte, headerSize+bufSize)
+	
+	// Write magic and version
+	copy(encoded, encodingMagic)
+	encoded[len(encodingMagic)] = encodingVersion
+	buf := encoded[headerSize:]
 	
 	// Write ID length
 	binary.LittleEndian.PutUint32(buf[0:], uint32(len(idBytes)))
@@ -120,60 +174,129 @@ func (v *Vector) Encode() []byte {
 	// Write metadata
 	copy(buf[metadataLenOffset+4:], metadataBytes)
 	
-	return buf
+	// Write timestamps as nanoseconds since the epoch, 0 if unknown
+	timesOffset := metadataLenOffset + 4 + len(metadataBytes)
+	binary.LittleEndian.PutUint64(buf[timesOffset:], uint64(unixNano(v.CreatedAt)))
+	binary.LittleEndian.PutUint64(buf[timesOffset+8:], uint64(unixNano(v.UpdatedAt)))
+	
+	// Write checksum over the header too
+	end := len(encoded) - checksumSize
+	binary.LittleEndian.PutUint32(encoded[end:], crc32.ChecksumIEEE(encoded[:end]))
+	
+	return encoded
 }
 
-// Decode deserializes a vector from a byte slice
+// Decode deserializes a vector from a byte slice. Truncated or damaged
+// encodings return ErrCorrupt; encodings written before the version,
+// timestamps or checksums were added are accepted if their length is exact.
 func Decode(buf []byte) (*Vector, error) {
+	return decode(buf, true)
+}
+
+// DecodeMeta decodes the ID, dimension and metadata of an encoded vector
+// without reading its values. The returned vector has nil Values
+func DecodeMeta(buf []byte) (*Vector, error) {
+	return decode(buf, false)
+}
+
+// decode decodes an encoded vector, skipping its values unless withValues
+// is set
+func decode(encoded []byte, withValues bool) (*Vector, error) {
+	// Encodings without the magic were written before it was added
+	buf := encoded
+	versioned := len(encoded) >= headerSize && string(encoded[:len(encodingMagic)]) == encodingMagic
+	if versioned {
+		if version := encoded[len(encodingMagic)]; version != encodingVersion {
+			return nil, fmt.Errorf("%w: unknown encoding version %d", ErrCorrupt, version)
+		}
+		buf = encoded[headerSize:]
+	}
+	
 	if len(buf) < 8 {
-		return nil, errors.New("buffer too small to decode vector")
+		return nil, fmt.Errorf("%w: buffer too small to decode vector", ErrCorrupt)
 	}
 	
 	// Read ID length
-	idLen := binary.LittleEndian.Uint32(buf[0:4])
+	idLen := uint64(binary.LittleEndian.Uint32(buf[0:4]))
 	
-	if len(buf) < int(4+idLen+4) {
-		return nil, errors.New("buffer too small to decode vector")
+	if uint64(len(buf)) < 4+idLen+4 {
+		return nil, fmt.Errorf("%w: buffer too small to decode vector", ErrCorrupt)
 	}
 	
 	// Read ID
 	id := string(buf[4 : 4+idLen])
 	
 	// Read dimension
-	dim := binary.LittleEndian.Uint32(buf[4+idLen : 4+idLen+4])
+	dim := uint64(binary.LittleEndian.Uint32(buf[4+idLen : 4+idLen+4]))
 	
-	if len(buf) < int(4+idLen+4+dim*4) {
-		return nil, errors.New("buffer too small to decode vector values")
+	// Read metadata length
+	metadataLenOffset := 4 + idLen + 4 + dim*4
+	if uint64(len(buf)) < metadataLenOffset+4 {
+		return nil, fmt.Errorf("%w: buffer too small to decode vector values", ErrCorrupt)
+	}
+	metadataLen := uint64(binary.LittleEndian.Uint32(buf[metadataLenOffset : metadataLenOffset+4]))
+	
+	// Verify the checksum, which covers the magic and version too
+	metadataEnd := metadataLenOffset + 4 + metadataLen
+	end := metadataEnd
+	length := uint64(len(buf))
+	var created, updated time.Time
+	switch {
+	case length == metadataEnd+timestampsSize+checksumSize:
+		end += timestampsSize
+		created = fromUnixNano(int64(binary.LittleEndian.Uint64(buf[metadataEnd:])))
+		updated = fromUnixNano(int64(binary.LittleEndian.Uint64(buf[metadataEnd+8:])))
+	case !versioned && length == metadataEnd+checksumSize:
+		// Written before timestamps were added
+	case !versioned && length == metadataEnd:
+		// Written before checksums were added
+	default:
+		return nil, fmt.Errorf("%w: %d bytes for %q, expected %d", ErrCorrupt, len(buf), id, metadataEnd+timestampsSize+checksumSize)
+	}
+	if end < length {
+		checked := encoded[:uint64(len(encoded)-len(buf))+end]
+		if crc32.ChecksumIEEE(checked) != binary.LittleEndian.Uint32(buf[end:]) {
+			return nil, fmt.Errorf("%w: checksum mismatch for %q", ErrCorrupt, id)
+		}
 	}
 	
 	// Read values
-	values := make([]float32, dim)
-	for i := 0; i < int(dim); i++ {
-		offset := 4 + idLen + 4 + uint32(i)*4
-		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[offset : offset+4]))
+	var values []float32
+	if withValues {
+		values = make([]float32, dim)
+		for i := uint64(0); i < dim; i++ {
+			offset := 4 + idLen + 4 + i*4
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[offset : offset+4]))
+		}
 	}
 	
-	// Create vector
-	v := &Vector{
+	// Read metadata
+	metadataBytes := buf[metadataLenOffset+4 : metadataEnd]
+	
+	return &Vector{
 		ID:        id,
 		Values:    values,
 		Dimension: int(dim),
-		Metadata:  make(map[string]string),
+		Metadata:  decodeMetadata(string(metadataBytes)),
+		CreatedAt: created,
+		UpdatedAt: updated,
+	}, nil
+}
+
+// unixNano returns t in nanoseconds since the epoch, or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
 	}
-	
-	// Read metadata if available
-	metadataLenOffset := 4 + idLen + 4 + dim*4
-	if len(buf) > int(metadataLenOffset+4) {
-		metadataLen := binary.LittleEndian.Uint32(buf[metadataLenOffset : metadataLenOffset+4])
-		
-		if len(buf) >= int(metadataLenOffset+4+metadataLen) {
-			metadataBytes := buf[metadataLenOffset+4 : metadataLenOffset+4+metadataLen]
-			metadata := decodeMetadata(string(metadataBytes))
-			v.Metadata = metadata
-		}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano, returning times in UTC
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
 	}
-	
-	return v, nil
+	return time.Unix(0, n).UTC()
 }
 
 // encodeMetadata converts a metadata map to a string representation
@@ -254,6 +377,31 @@ func splitRespectingEscapes(s string, delimiter byte) []string {
 	return result
 }
 
+// CheckFinite returns an error wrapping ErrNonFinite if a value of the
+// vector is NaN or infinite. A single one makes every distance to the vector
+// NaN or infinite, which breaks the ordering of results and HNSW graphs.
+func (v *Vector) CheckFinite() error {
+	for i, val := range v.Values {
+		if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+			return fmt.Errorf("%w: vector %s has %v at index %d", ErrNonFinite, v.ID, val, i)
+		}
+	}
+	return nil
+}
+
+// ZeroNonFinite replaces the NaN and infinite values of the vector with 0
+// and returns how many it replaced
+func (v *Vector) ZeroNonFinite() int {
+	zeroed := 0
+	for i, val := range v.Values {
+		if math.IsNaN(float64(val)) || math.IsInf(float64(val), 0) {
+			v.Values[i] = 0
+			zeroed++
+		}
+	}
+	return zeroed
+}
+
 // Normalize converts the vector to a unit vector (same direction, length 1)
 func (v *Vector) Normalize() {
 	magnitude := 0.0
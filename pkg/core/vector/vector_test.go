@@ -1,7 +1,12 @@
 package vector
 
 import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestNewVector(t *testing.T) {
@@ -61,6 +66,93 @@ func TestRandom(t *testing.T) {
 	}
 }
 
+func TestRandomDoesNotRepeat(t *testing.T) {
+	a, b := Random("a", 8), Random("b", 8)
+	for i := range a.Values {
+		if a.Values[i] != b.Values[i] {
+			return
+		}
+	}
+	t.Error("Expected consecutive random vectors to differ")
+}
+
+func TestGenerator(t *testing.T) {
+	for _, dist := range []Distribution{Uniform, Gaussian, UnitSphere} {
+		first, err := NewGenerator(dist, 42)
+		if err != nil {
+			t.Fatalf("NewGenerator(%s) error = %v", dist, err)
+		}
+		second, _ := NewGenerator(dist, 42)
+		other, _ := NewGenerator(dist, 43)
+
+		a, b, c := first.Next("a", 16), second.Next("a", 16), other.Next("a", 16)
+		same, differs := true, false
+		var norm float64
+		for i := range a.Values {
+			same = same && a.Values[i] == b.Values[i]
+			differs = differs || a.Values[i] != c.Values[i]
+			norm += float64(a.Values[i]) * float64(a.Values[i])
+			if dist == Uniform && (a.Values[i] < 0 || a.Values[i] >= 1) {
+				t.Errorf("%s: value %f out of [0, 1)", dist, a.Values[i])
+			}
+		}
+		if !same {
+			t.Errorf("%s: expected the same seed to give the same vector", dist)
+		}
+		if !differs {
+			t.Errorf("%s: expected another seed to give another vector", dist)
+		}
+		if dist == UnitSphere && math.Abs(norm-1) > 1e-5 {
+			t.Errorf("%s: expected a unit vector, got squared norm %f", dist, norm)
+		}
+	}
+
+	if _, err := ParseDistribution("cauchy"); !errors.Is(err, ErrUnknownDistribution) {
+		t.Errorf("Expected ErrUnknownDistribution, got %v", err)
+	}
+	if dist, err := ParseDistribution("Gaussian"); err != nil || dist != Gaussian {
+		t.Errorf("ParseDistribution(Gaussian) = %v, %v", dist, err)
+	}
+}
+
+func TestClusterGenerator(t *testing.T) {
+	first, err := NewClusterGenerator(32, 4, 0.1, 7)
+	if err != nil {
+		t.Fatalf("NewClusterGenerator error = %v", err)
+	}
+	second, _ := NewClusterGenerator(32, 4, 0.1, 7)
+
+	// Vectors of a cluster are much closer to each other than to the others
+	byCluster := map[int][]*Vector{}
+	for i := 0; i < 40; i++ {
+		a, cluster := first.Next("a")
+		b, _ := second.Next("a")
+		if a.Dimension != 32 || a.Values[0] != b.Values[0] {
+			t.Fatalf("Expected seeded generators to match, got %v and %v", a.Values, b.Values)
+		}
+		byCluster[cluster] = append(byCluster[cluster], a)
+	}
+	dist := func(a, b *Vector) float64 {
+		var sum float64
+		for i := range a.Values {
+			d := float64(a.Values[i] - b.Values[i])
+			sum += d * d
+		}
+		return math.Sqrt(sum)
+	}
+	for cluster, vectors := range byCluster {
+		for other, others := range byCluster {
+			if other != cluster && len(vectors) > 1 && dist(vectors[0], vectors[1]) >= dist(vectors[0], others[0]) {
+				t.Errorf("Expected cluster %d to be tighter than its distance to cluster %d", cluster, other)
+			}
+		}
+	}
+
+	if _, err := NewClusterGenerator(8, 0, 0.1, 1); err == nil {
+		t.Error("Expected zero clusters to fail")
+	}
+}
+
 func TestCopy(t *testing.T) {
 	id := "test-vector"
 	values := []float32{1.0, 2.0, 3.0, 4.0, 5.0}
@@ -119,6 +211,79 @@ func TestEncodeDecode(t *testing.T) {
 	}
 }
 
+func TestDecodeMeta(t *testing.T) {
+	original := NewVector("test-vector", []float32{1.0, 2.0, 3.0})
+	original.Metadata["lang"] = "en"
+	
+	decoded, err := DecodeMeta(original.Encode())
+	if err != nil {
+		t.Fatalf("Failed to decode vector metadata: %v", err)
+	}
+	
+	if decoded.ID != original.ID || decoded.Dimension != original.Dimension {
+		t.Errorf("Expected %s with dimension %d, got %s with dimension %d", original.ID, original.Dimension, decoded.ID, decoded.Dimension)
+	}
+	if decoded.Values != nil {
+		t.Errorf("Expected no values, got %v", decoded.Values)
+	}
+	if decoded.Metadata["lang"] != "en" {
+		t.Errorf("Expected metadata lang=en, got %v", decoded.Metadata)
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	original := NewVector("test-vector", []float32{1.0, 2.0, 3.0})
+	original.Metadata["lang"] = "en"
+	encoded := original.Encode()
+	
+	// Every truncation and a flipped bit are reported as corruption
+	for n := 0; n < len(encoded); n++ {
+		if _, err := Decode(encoded[:n]); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Decode of %d/%d bytes: expected ErrCorrupt, got %v", n, len(encoded), err)
+		}
+	}
+	damaged := append([]byte(nil), encoded...)
+	damaged[10] ^= 1
+	if _, err := Decode(damaged); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a flipped bit, got %v", err)
+	}
+	
+	unknown := append([]byte(nil), encoded...)
+	unknown[len(encodingMagic)] = encodingVersion + 1
+	if _, err := Decode(unknown); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for an unknown version, got %v", err)
+	}
+	
+	// Encodings without a version, checksum or timestamps are still read
+	body := encoded[headerSize : len(encoded)-checksumSize]
+	unversioned := binary.LittleEndian.AppendUint32(append([]byte(nil), body...), crc32.ChecksumIEEE(body))
+	unchecked := body[:len(body)-timestampsSize]
+	untimed := binary.LittleEndian.AppendUint32(append([]byte(nil), unchecked...), crc32.ChecksumIEEE(unchecked))
+	for _, buf := range [][]byte{unversioned, unchecked, untimed} {
+		legacy, err := Decode(buf)
+		if err != nil {
+			t.Fatalf("Failed to decode legacy encoding: %v", err)
+		}
+		if legacy.ID != original.ID || legacy.Metadata["lang"] != "en" || !legacy.CreatedAt.IsZero() {
+			t.Errorf("Expected %s with lang=en and no timestamps, got %s with %v", original.ID, legacy.ID, legacy.Metadata)
+		}
+	}
+}
+
+func TestEncodeTimestamps(t *testing.T) {
+	original := NewVector("test-vector", []float32{1.0, 2.0})
+	original.CreatedAt = time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	original.UpdatedAt = original.CreatedAt.Add(time.Hour)
+	
+	decoded, err := DecodeMeta(original.Encode())
+	if err != nil {
+		t.Fatalf("Failed to decode vector: %v", err)
+	}
+	if !decoded.CreatedAt.Equal(original.CreatedAt) || !decoded.UpdatedAt.Equal(original.UpdatedAt) {
+		t.Errorf("Expected timestamps %v and %v, got %v and %v", original.CreatedAt, original.UpdatedAt, decoded.CreatedAt, decoded.UpdatedAt)
+	}
+}
+
 func TestNormalize(t *testing.T) {
 	values := []float32{3.0, 4.0} // 3-4-5 triangle
 	v := NewVector("test", values)
@@ -143,4 +308,20 @@ func TestNormalize(t *testing.T) {
 			t.Errorf("Expected value at index %d to be %f, got %f", i, expected[i], val)
 		}
 	}
-} 
\ No newline at end of file
+} 
+func TestCheckFinite(t *testing.T) {
+	if err := NewVector("ok", []float32{1, -2, 0}).CheckFinite(); err != nil {
+		t.Errorf("Expected finite values to pass, got %v", err)
+	}
+
+	v := NewVector("bad", []float32{1, float32(math.NaN()), float32(math.Inf(-1))})
+	if err := v.CheckFinite(); !errors.Is(err, ErrNonFinite) {
+		t.Errorf("Expected ErrNonFinite, got %v", err)
+	}
+	if zeroed := v.ZeroNonFinite(); zeroed != 2 {
+		t.Errorf("Expected 2 values zeroed, got %d", zeroed)
+	}
+	if v.Values[0] != 1 || v.Values[1] != 0 || v.Values[2] != 0 || v.CheckFinite() != nil {
+		t.Errorf("Expected [1 0 0], got %v", v.Values)
+	}
+}
@@ -0,0 +1,325 @@
+// Package drift watches the vectors written to a store for a change in
+// their distribution, such as a new embedding model or a broken
+// preprocessing step. New vectors are compared with the vectors already
+// stored by their norm and by their cosine similarity to the store's
+// centroid; a shift of either raises a warning.
+package drift
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// Options configure drift monitoring
+type Options struct {
+	Interval   time.Duration // How often new vectors are checked (default: 1m)
+	MinVectors int           // New vectors a check needs; fewer wait for the next (default: 50)
+	Sample     int           // Most new and stored vectors read per check (default: 1000)
+
+	// Threshold is how far the mean norm or centroid similarity of the new
+	// vectors may be from the stored vectors', in standard deviations of
+	// the stored vectors, before it counts as drift (default: 1)
+	Threshold float64
+}
+
+// Stat summarizes a quantity over a set of vectors
+type Stat struct {
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+}
+
+// Stats summarizes a set of vectors
+type Stats struct {
+	Vectors int  `json:"vectors"`
+	Norm    Stat `json:"norm"`   // Euclidean length
+	Cosine  Stat `json:"cosine"` // Cosine similarity to the store's centroid
+}
+
+// Report is the result of a check
+type Report struct {
+	Time       time.Time `json:"time"`
+	New        Stats     `json:"new"`        // Vectors written since the last check
+	Stored     Stats     `json:"stored"`     // Vectors stored before them
+	NormShift  float64   `json:"norm_shift"` // Difference of the mean norms in stored standard deviations
+	CosShift   float64   `json:"cosine_shift"`
+	Mismatched int       `json:"mismatched"` // New vectors whose dimension differs from the centroid's
+	Drift      bool      `json:"drift"`
+}
+
+// Monitor checks the vectors written to a store at an interval
+type Monitor struct {
+	store  storage.VectorStore
+	opts   Options
+	logger *log.Logger
+	stop   chan struct{}
+	done   sync.WaitGroup
+
+	mu       sync.Mutex
+	pending  map[string]bool // Vectors written since the last check
+	last     *Report
+	warnings int
+}
+
+// New creates a monitor of store, which is told about writes with Observe
+func New(store storage.VectorStore, opts Options, logger *log.Logger) *Monitor {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Minute
+	}
+	if opts.MinVectors <= 0 {
+		opts.MinVectors = 50
+	}
+	if opts.Sample <= 0 {
+		opts.Sample = 1000
+	}
+	if opts.Sample < opts.MinVectors {
+		opts.Sample = opts.MinVectors
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 1
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Monitor{store: store, opts: opts, logger: logger, pending: make(map[string]bool)}
+}
+
+// Start watches the inserts and updates of an observable store and checks
+// them every interval in the background, until Stop is called
+func Start(store *storage.ObservableStore, opts Options, logger *log.Logger) *Monitor {
+	m := New(store, opts, logger)
+	unsubscribe := store.Subscribe(func(e storage.Event) {
+		if e.Type == storage.EventInsert || e.Type == storage.EventUpdate {
+			m.Observe(e.ID)
+		}
+	})
+	m.stop = make(chan struct{})
+	m.done.Add(1)
+	go func() {
+		defer m.done.Done()
+		defer unsubscribe()
+		ticker := time.NewTicker(m.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if _, err := m.Check(); err != nil {
+					m.logger.Printf("Drift check: %v", err)
+				}
+			}
+		}
+	}()
+	return m
+}
+
+// Stop stops the checks of a monitor created with Start
+func (m *Monitor) Stop() {
+	close(m.stop)
+	m.done.Wait()
+}
+
+// Observe notes that the vector with the given ID was written. Up to
+// Sample vectors are remembered until the next check.
+func (m *Monitor) Observe(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.pending) < m.opts.Sample {
+		m.pending[id] = true
+	}
+}
+
+// Last returns the report of the last check, or nil before the first
+func (m *Monitor) Last() *Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// Check compares the vectors written since the last check with the other
+// stored vectors. It returns nil without checking while fewer than
+// MinVectors were written, or while fewer are stored before them; the
+// first vectors written to an empty store become the baseline of later
+// checks.
+func (m *Monitor) Check() (*Report, error) {
+	m.mu.Lock()
+	if len(m.pending) < m.opts.MinVectors {
+		m.mu.Unlock()
+		return nil, nil
+	}
+	pending := m.pending
+	m.pending = make(map[string]bool)
+	m.mu.Unlock()
+
+	centroid, err := storage.GroupCentroid(m.store, storage.CentroidGroup{})
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Time: time.Now().UTC()}
+
+	fresh := make([]string, 0, len(pending))
+	for id := range pending {
+		fresh = append(fresh, id)
+	}
+	var mismatched int
+	report.New, mismatched, err = m.stats(fresh, centroid.Values)
+	if err != nil {
+		return nil, err
+	}
+	report.Mismatched = mismatched
+
+	// Stored vectors are sampled evenly across their IDs
+	ids, err := m.store.List()
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]string, 0, m.opts.Sample)
+	step := max(1, (len(ids)-len(pending))/m.opts.Sample)
+	for i := 0; i < len(ids) && len(stored) < m.opts.Sample; i += step {
+		if !pending[ids[i]] {
+			stored = append(stored, ids[i])
+		}
+	}
+	report.Stored, _, err = m.stats(stored, centroid.Values)
+	if err != nil {
+		return nil, err
+	}
+	if report.Stored.Vectors < m.opts.MinVectors {
+		return nil, nil
+	}
+
+	report.NormShift = shift(report.New.Norm, report.Stored.Norm)
+	report.CosShift = shift(report.New.Cosine, report.Stored.Cosine)
+	report.Drift = report.Mismatched > 0 || report.NormShift > m.opts.Threshold || report.CosShift > m.opts.Threshold
+
+	m.mu.Lock()
+	m.last = report
+	if report.Drift {
+		m.warnings++
+	}
+	m.mu.Unlock()
+	if report.Drift {
+		m.logger.Printf("Warning: embedding drift in %d new vectors: mean norm %.3g (stored %.3g, shift %.2f), mean centroid similarity %.3g (stored %.3g, shift %.2f), %d of another dimension",
+			report.New.Vectors, report.New.Norm.Mean, report.Stored.Norm.Mean, report.NormShift,
+			report.New.Cosine.Mean, report.Stored.Cosine.Mean, report.CosShift, report.Mismatched)
+	}
+	return report, nil
+}
+
+// stats reads the vectors with the given IDs and summarizes them. Vectors
+// of another dimension than the centroid are counted, not summarized.
+func (m *Monitor) stats(ids []string, centroid []float32) (Stats, int, error) {
+	var norms, cosines running
+	mismatched := 0
+	for _, id := range ids {
+		v, err := m.store.Get(id)
+		if err != nil {
+			// Deleted since it was written
+			continue
+		}
+		if len(v.Values) != len(centroid) {
+			mismatched++
+			continue
+		}
+		norm := norm(v.Values)
+		norms.add(norm)
+		cosines.add(cosine(v.Values, centroid, norm))
+	}
+	return Stats{Vectors: norms.n, Norm: norms.stat(), Cosine: cosines.stat()}, mismatched, nil
+}
+
+// WritePrometheus writes the result of the last check in the Prometheus
+// text format
+func (m *Monitor) WritePrometheus(w io.Writer) {
+	m.mu.Lock()
+	last, warnings := m.last, m.warnings
+	m.mu.Unlock()
+
+	drifted, normShift, cosShift := 0, 0.0, 0.0
+	if last != nil {
+		normShift, cosShift = last.NormShift, last.CosShift
+		if last.Drift {
+			drifted = 1
+		}
+	}
+	fmt.Fprintf(w, "# HELP vectodb_embedding_drift Whether the vectors of the last drift check drifted from the stored ones.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_embedding_drift gauge\n")
+	fmt.Fprintf(w, "vectodb_embedding_drift %d\n", drifted)
+	fmt.Fprintf(w, "# HELP vectodb_embedding_drift_shift Difference of the mean of new and stored vectors, in stored standard deviations.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_embedding_drift_shift gauge\n")
+	fmt.Fprintf(w, "vectodb_embedding_drift_shift{stat=\"norm\"} %g\n", normShift)
+	fmt.Fprintf(w, "vectodb_embedding_drift_shift{stat=\"cosine\"} %g\n", cosShift)
+	fmt.Fprintf(w, "# HELP vectodb_embedding_drift_warnings_total Drift checks that found drift.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_embedding_drift_warnings_total counter\n")
+	fmt.Fprintf(w, "vectodb_embedding_drift_warnings_total %d\n", warnings)
+	if last == nil {
+		return
+	}
+	fmt.Fprintf(w, "# HELP vectodb_embedding_drift_norm_mean Mean norm of the vectors of the last drift check.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_embedding_drift_norm_mean gauge\n")
+	fmt.Fprintf(w, "vectodb_embedding_drift_norm_mean{set=\"new\"} %g\n", last.New.Norm.Mean)
+	fmt.Fprintf(w, "vectodb_embedding_drift_norm_mean{set=\"stored\"} %g\n", last.Stored.Norm.Mean)
+	fmt.Fprintf(w, "# HELP vectodb_embedding_drift_cosine_mean Mean cosine similarity to the centroid of the vectors of the last drift check.\n")
+	fmt.Fprintf(w, "# TYPE vectodb_embedding_drift_cosine_mean gauge\n")
+	fmt.Fprintf(w, "vectodb_embedding_drift_cosine_mean{set=\"new\"} %g\n", last.New.Cosine.Mean)
+	fmt.Fprintf(w, "vectodb_embedding_drift_cosine_mean{set=\"stored\"} %g\n", last.Stored.Cosine.Mean)
+}
+
+// running computes a mean and standard deviation in one pass, by
+// Welford's method
+type running struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (r *running) add(x float64) {
+	r.n++
+	delta := x - r.mean
+	r.mean += delta / float64(r.n)
+	r.m2 += delta * (x - r.mean)
+}
+
+func (r *running) stat() Stat {
+	if r.n == 0 {
+		return Stat{}
+	}
+	return Stat{Mean: r.mean, StdDev: math.Sqrt(r.m2 / float64(r.n))}
+}
+
+// shift returns how far the mean of a is from the mean of b in standard
+// deviations of b. Identical stored vectors, whose deviation is 0, count a
+// difference of a millionth of their mean as one deviation.
+func shift(a, b Stat) float64 {
+	scale := math.Max(b.StdDev, 1e-6*math.Max(1, math.Abs(b.Mean)))
+	return math.Abs(a.Mean-b.Mean) / scale
+}
+
+// norm returns the Euclidean length of values
+func norm(values []float32) float64 {
+	sum := 0.0
+	for _, x := range values {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// cosine returns the cosine similarity of values, whose norm is given, and
+// the centroid, or 0 if either is zero
+func cosine(values, centroid []float32, valuesNorm float64) float64 {
+	dot := 0.0
+	for i, x := range values {
+		dot += float64(x) * float64(centroid[i])
+	}
+	denom := valuesNorm * norm(centroid)
+	if denom == 0 {
+		return 0
+	}
+	return dot / denom
+}
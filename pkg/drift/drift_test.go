@@ -0,0 +1,110 @@
+package drift
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// insert writes n vectors near direction, scaled to about scale, and tells
+// the monitor about them
+func insert(t *testing.T, store storage.VectorStore, m *Monitor, rng *rand.Rand, prefix string, n int, direction []float32, scale float32) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		values := make([]float32, len(direction))
+		for j, x := range direction {
+			values[j] = scale * (x + 0.1*float32(rng.NormFloat64()))
+		}
+		id := fmt.Sprintf("%s%d", prefix, i)
+		if err := store.Insert(vector.NewVector(id, values)); err != nil {
+			t.Fatal(err)
+		}
+		m.Observe(id)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	store := storage.NewCentroidStore(storage.NewMemoryStore())
+	var logs bytes.Buffer
+	m := New(store, Options{MinVectors: 20, Sample: 100}, log.New(&logs, "", 0))
+	direction := []float32{1, 1, 0, 0}
+
+	// The first vectors become the baseline
+	insert(t, store, m, rng, "base", 100, direction, 1)
+	if report, err := m.Check(); err != nil || report != nil {
+		t.Fatalf("Expected no report without stored vectors, got %+v (err = %v)", report, err)
+	}
+
+	// Too few written vectors wait for the next check
+	insert(t, store, m, rng, "few", 10, direction, 1)
+	if report, err := m.Check(); err != nil || report != nil {
+		t.Fatalf("Expected no report for 10 vectors, got %+v (err = %v)", report, err)
+	}
+
+	insert(t, store, m, rng, "same", 20, direction, 1)
+	report, err := m.Check()
+	if err != nil || report == nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if report.Drift || report.New.Vectors != 30 {
+		t.Errorf("Expected 30 vectors without drift, got %+v", report)
+	}
+
+	// Vectors of another length drift in norm
+	insert(t, store, m, rng, "long", 20, direction, 3)
+	if report, err = m.Check(); err != nil || report == nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.Drift || report.NormShift <= 1 {
+		t.Errorf("Expected norm drift, got %+v", report)
+	}
+
+	// Vectors pointing elsewhere drift in centroid similarity
+	insert(t, store, m, rng, "turned", 20, []float32{0, 0, 1, 1}, 1)
+	if report, err = m.Check(); err != nil || report == nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if !report.Drift || report.CosShift <= 1 {
+		t.Errorf("Expected centroid similarity drift, got %+v", report)
+	}
+	if !strings.Contains(logs.String(), "Warning: embedding drift in 20 new vectors") {
+		t.Errorf("Expected a drift warning in the log, got %q", logs.String())
+	}
+
+	var metrics bytes.Buffer
+	m.WritePrometheus(&metrics)
+	for _, want := range []string{
+		"vectodb_embedding_drift 1\n",
+		"vectodb_embedding_drift_warnings_total 2\n",
+		`vectodb_embedding_drift_norm_mean{set="new"}`,
+	} {
+		if !strings.Contains(metrics.String(), want) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", want, metrics.String())
+		}
+	}
+}
+
+func TestStartObservesWrites(t *testing.T) {
+	store := storage.NewObservableStore(storage.NewMemoryStore())
+	m := Start(store, Options{MinVectors: 5}, log.New(io.Discard, "", 0))
+	defer m.Stop()
+
+	for i := 0; i < 5; i++ {
+		store.Insert(vector.NewVector(fmt.Sprintf("v%d", i), []float32{1, float32(i)}))
+	}
+	store.Delete("v0")
+	m.mu.Lock()
+	pending := len(m.pending)
+	m.mu.Unlock()
+	if pending != 5 {
+		t.Errorf("Expected 5 written vectors to be pending, got %d", pending)
+	}
+}
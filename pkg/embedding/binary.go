@@ -0,0 +1,44 @@
+package embedding
+
+import (
+	"github.com/ken/vector_database/pkg/embedding/pipeline"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// MetadataKeyFileHash is the metadata key holding the SHA-256 of the
+	// binary file a document's text was extracted from
+	MetadataKeyFileHash = "file_hash"
+
+	// MetadataKeyExtraction is the metadata key holding how the text of a
+	// binary file was extracted, e.g. "pdf" or "transcription"
+	MetadataKeyExtraction = "extraction"
+)
+
+// SetProvenance records on doc the binary file its text was extracted from
+func SetProvenance(doc *Document, extracted *pipeline.Extracted) {
+	doc.SetMetadata(MetadataKeyFileHash, extracted.Hash)
+	doc.SetMetadata(MetadataKeyMediaType, extracted.MediaType)
+	doc.SetMetadata(MetadataKeyExtraction, extracted.Method)
+}
+
+// extractedCurrent reports whether every chunk stored for the file rel was
+// extracted from a file with the given hash, and embedded by the service's
+// model unless checkModel is false, so the file need not be extracted again.
+// It returns the number of chunks.
+func (s *Service) extractedCurrent(store storage.VectorStore, rel, hash string, checkModel bool) (int, bool) {
+	ids, err := Children(store, rel)
+	if err != nil || len(ids) == 0 {
+		return 0, false
+	}
+	for _, id := range ids {
+		v, err := storage.GetMeta(store, id)
+		if err != nil || v.Metadata[MetadataKeyFileHash] != hash {
+			return 0, false
+		}
+		if checkModel && v.Metadata[MetadataKeyModel] != s.ModelName() {
+			return 0, false
+		}
+	}
+	return len(ids), true
+}
@@ -0,0 +1,52 @@
+package embedding
+
+import (
+	"strings"
+
+	"github.com/ken/vector_database/pkg/embedding/models"
+)
+
+// ChunkText splits text into pieces of at most size tokens. Pieces end at
+// the last paragraph or line break in their second half if there is one,
+// so chunks follow the structure of the text. A size of 0 or less returns
+// the text as one chunk.
+func ChunkText(text string, size int, tokenizer models.Tokenizer) []string {
+	spans := tokenizer.Tokenize(text)
+	if size <= 0 || len(spans) <= size {
+		if strings.TrimSpace(text) == "" {
+			return nil
+		}
+		return []string{text}
+	}
+
+	var chunks []string
+	for first := 0; first < len(spans); {
+		last := min(first+size, len(spans)) - 1
+		if last < len(spans)-1 {
+			last = breakBefore(text, spans, first, last)
+		}
+		chunks = append(chunks, text[spans[first].Start:spans[last].End])
+		first = last + 1
+	}
+	return chunks
+}
+
+// breakBefore returns the token a chunk from first to last should end with:
+// the last one before a paragraph break, or else a line break, in the second
+// half of the chunk, or last if there is none
+func breakBefore(text string, spans []models.Span, first, last int) int {
+	for _, sep := range []string{"\n\n", "\n"} {
+		for i := last; i > first+(last-first)/2; i-- {
+			if strings.Contains(text[spans[i].End:spans[i+1].Start], sep) {
+				return i
+			}
+		}
+	}
+	return last
+}
+
+// ChunkText splits text into pieces of at most size tokens of the service's
+// model
+func (s *Service) ChunkText(text string, size int) []string {
+	return ChunkText(text, size, s.engine.Tokenizer())
+}
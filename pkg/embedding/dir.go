@@ -0,0 +1,296 @@
+package embedding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ken/vector_database/internal/concurrency"
+	"github.com/ken/vector_database/pkg/embedding/pipeline"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// MetadataKeyPath is the metadata key holding the path of an embedded
+	// file relative to the directory it was found in
+	MetadataKeyPath = "path"
+
+	// MetadataKeyMtime is the metadata key holding the modification time of
+	// an embedded file in RFC 3339 format
+	MetadataKeyMtime = "mtime"
+
+	// MetadataKeySize is the metadata key holding the size of an embedded
+	// file in bytes
+	MetadataKeySize = "size"
+
+	// MetadataKeyChunk is the metadata key holding the position of a chunk
+	// in its file, starting at 0
+	MetadataKeyChunk = "chunk"
+
+	// MetadataKeyParent is the metadata key holding the ID of the document a
+	// chunk belongs to, which searches with GROUP BY metadata.parent_id
+	// collapse to the nearest chunk per document
+	MetadataKeyParent = "parent_id"
+)
+
+// DirOptions controls how EmbedDir embeds a directory
+type DirOptions struct {
+	Glob        string                    // Pattern file names must match, e.g. "*.md" (default: all files)
+	ChunkSize   int                       // Maximum tokens per chunk; 0 embeds whole files
+	Concurrency int                       // Files embedded at once (default: DefaultConcurrency)
+	Force       bool                      // Re-embed unchanged files
+	Route       Router                    // Picks the model of every chunk by its language (default: the service's)
+	Binary      *pipeline.BinaryProcessor // Extracts the text of files that are not UTF-8 (default: they are skipped)
+	Progress    func(stats *DirStats)     // Called after every file (optional)
+}
+
+// DirStats summarizes an EmbedDir run
+type DirStats struct {
+	Files     int     // Files matching the pattern
+	Chunks    int     // Chunks embedded or found unchanged
+	Embedded  int     // Chunks embedded
+	Unchanged int     // Chunks whose content and vector were current
+	Removed   int     // Stale chunks of files that got shorter
+	Skipped   int     // Files that are not UTF-8 text and have no text to extract
+	Done      int     // Files processed
+	Errors    []error // Files that failed, in path order
+}
+
+// EmbedDir embeds the files below root whose names match the glob pattern,
+// storing their vectors in store and documents in docsDir. Files are split
+// into chunks of at most ChunkSize tokens and embedded concurrently. The ID
+// of a file is its slash-separated path relative to root, followed by
+// "#<n>" for every chunk if it has more than one.
+//
+// A file that fails does not stop the run; its error is recorded in the
+// stats. Hidden directories such as .git are not entered.
+func (s *Service) EmbedDir(store storage.VectorStore, docsDir, root string, options *DirOptions) (*DirStats, error) {
+	opts := DirOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = DefaultConcurrency
+	}
+
+	paths, err := findFiles(root, opts.Glob)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &DirStats{Files: len(paths)}
+	errs := make([]error, len(paths))
+	var mu sync.Mutex
+	// A failed file is recorded, so every file is tried
+	concurrency.ForEach(len(paths), opts.Concurrency, func(i int) error {
+		file, err := s.embedFile(store, docsDir, root, paths[i], &opts)
+		errs[i] = err
+
+		mu.Lock()
+		defer mu.Unlock()
+		stats.Done++
+		stats.Chunks += file.Embedded + file.Unchanged
+		stats.Embedded += file.Embedded
+		stats.Unchanged += file.Unchanged
+		stats.Removed += file.Removed
+		stats.Skipped += file.Skipped
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+		return nil
+	})
+
+	for _, err := range errs {
+		if err != nil {
+			stats.Errors = append(stats.Errors, err)
+		}
+	}
+	return stats, nil
+}
+
+// findFiles returns the slash-separated paths relative to root of the files
+// whose names match glob, in order
+func findFiles(root, glob string) ([]string, error) {
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", glob, err)
+		}
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if p != root && hidden(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if !matchGlob(glob, entry.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// matchGlob reports whether a file name matches glob; an empty glob matches
+// every name
+func matchGlob(glob, name string) bool {
+	if glob == "" {
+		return true
+	}
+	ok, _ := path.Match(glob, name)
+	return ok
+}
+
+// hidden reports whether a file or directory name is hidden
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// embedFile embeds the chunks of one file and removes chunks left over from
+// a longer version of it
+func (s *Service) embedFile(store storage.VectorStore, docsDir, root, rel string, opts *DirOptions) (DirStats, error) {
+	var stats DirStats
+	name := filepath.Join(root, filepath.FromSlash(rel))
+	info, err := os.Stat(name)
+	if err != nil {
+		return stats, err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return stats, err
+	}
+	text := string(data)
+	var extracted *pipeline.Extracted
+	if !utf8.Valid(data) {
+		if opts.Binary == nil {
+			stats.Skipped++
+			return stats, nil
+		}
+		// Extraction may call a transcription or OCR endpoint, so files
+		// that did not change are not extracted again
+		sum := sha256.Sum256(data)
+		if n, ok := s.extractedCurrent(store, rel, hex.EncodeToString(sum[:]), opts.Route == nil); ok && !opts.Force {
+			stats.Unchanged = n
+			return stats, nil
+		}
+		extracted, err = opts.Binary.Process(rel, data)
+		if errors.Is(err, pipeline.ErrNoText) {
+			stats.Skipped++
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", rel, err)
+		}
+		text = extracted.Text
+	}
+
+	chunks := s.ChunkText(text, opts.ChunkSize)
+	ids := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		ids[i] = rel
+		if len(chunks) > 1 {
+			ids[i] = rel + "#" + strconv.Itoa(i)
+		}
+
+		doc := NewTextDocument(ids[i], chunk)
+		doc.SetMetadata(MetadataKeyPath, rel)
+		doc.SetMetadata(MetadataKeyParent, rel)
+		doc.SetMetadata(MetadataKeyMtime, info.ModTime().UTC().Format(time.RFC3339))
+		doc.SetMetadata(MetadataKeySize, strconv.FormatInt(info.Size(), 10))
+		if len(chunks) > 1 {
+			doc.SetMetadata(MetadataKeyChunk, strconv.Itoa(i))
+		}
+		if extracted != nil {
+			SetProvenance(doc, extracted)
+		}
+
+		service := s
+		if opts.Route != nil {
+			var language string
+			if service, language, err = opts.Route(chunk); err != nil {
+				return stats, fmt.Errorf("%s: %w", rel, err)
+			}
+			if language != "" {
+				doc.SetMetadata(MetadataKeyLanguage, language)
+			}
+		}
+
+		result, err := service.StoreDocument(store, docsDir, doc, opts.Force)
+		if err != nil {
+			return stats, fmt.Errorf("%s: %w", rel, err)
+		}
+		if result == DocumentUnchanged {
+			stats.Unchanged++
+		} else {
+			stats.Embedded++
+		}
+	}
+
+	removed, err := removeStaleChunks(store, docsDir, rel, ids)
+	stats.Removed = removed
+	if err != nil {
+		return stats, fmt.Errorf("%s: %w", rel, err)
+	}
+	return stats, nil
+}
+
+// removeStaleChunks deletes the vectors and documents of a file that are not
+// among its current chunk IDs
+func removeStaleChunks(store storage.VectorStore, docsDir, rel string, current []string) (int, error) {
+	stale, err := Children(store, rel)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := make(map[string]bool, len(current))
+	for _, id := range current {
+		keep[id] = true
+	}
+
+	removed := 0
+	for _, id := range stale {
+		if keep[id] {
+			continue
+		}
+		err := store.Delete(id)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return removed, fmt.Errorf("failed to remove stale chunk %s: %w", id, err)
+		}
+		if err := os.Remove(DocumentPath(docsDir, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return removed, fmt.Errorf("failed to remove stale chunk %s: %w", id, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
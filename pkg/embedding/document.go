@@ -12,6 +12,9 @@ type ContentType string
 const (
 	ContentTypeText ContentType = "text"
 	ContentTypeJSON ContentType = "json"
+
+	// ContentTypeImage documents hold the path of an image file
+	ContentTypeImage ContentType = "image"
 )
 
 // Document represents a document with content and its vector embedding
@@ -23,6 +26,11 @@ type Document struct {
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
+	Hash        string                 `json:"content_hash,omitempty"` // ContentHash of the embedded content
+	Version     int                    `json:"version,omitempty"`      // Incremented whenever the content changes
+	History     []DocumentVersion      `json:"history,omitempty"`      // Earlier versions, oldest first
+
+	image []byte // Encoded image of an image document, if read already
 }
 
 // NewDocument creates a new document with the specified content
@@ -66,6 +74,18 @@ func (d *Document) GetMetadata(key string) (interface{}, bool) {
 	return value, ok
 }
 
+// Text returns the content as text. JSON content is returned as JSON.
+func (d *Document) Text() string {
+	if text, ok := d.Content.(string); ok {
+		return text
+	}
+	bytes, err := json.Marshal(d.Content)
+	if err != nil {
+		return fmt.Sprint(d.Content)
+	}
+	return string(bytes)
+}
+
 // ToJSON converts the document to a JSON string
 func (d *Document) ToJSON() (string, error) {
 	bytes, err := json.Marshal(d)
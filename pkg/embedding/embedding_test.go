@@ -48,4 +48,65 @@ func TestEmbeddingEngine(t *testing.T) {
 	for _, v := range vectors {
 		assert.Equal(t, 384, len(v))
 	}
-} 
\ No newline at end of file
+} 
+func TestApproxTokenizer(t *testing.T) {
+	text := "Hello, internationalization!  ok"
+	var tokens []string
+	for _, span := range models.NewApproxTokenizer().Tokenize(text) {
+		tokens = append(tokens, text[span.Start:span.End])
+	}
+	assert.Equal(t, []string{"Hell", "o", ",", "inte", "rnat", "iona", "liza", "tion", "!", "ok"}, tokens)
+	assert.Empty(t, models.NewApproxTokenizer().Tokenize("  "))
+}
+
+func TestTruncation(t *testing.T) {
+	long := "one two six ten red big cat"
+
+	cut, err := NewService(&Config{ModelName: "cut", ModelMaxLength: 3})
+	assert.NoError(t, err)
+	doc := NewTextDocument("a", long)
+	assert.NoError(t, cut.ProcessDocument(doc))
+	assert.Equal(t, 7, doc.Metadata[MetadataKeyTokens])
+	assert.Equal(t, true, doc.Metadata[MetadataKeyTruncated])
+
+	// A cut text embeds like its first tokens
+	first := NewTextDocument("b", "one two six")
+	assert.NoError(t, cut.ProcessDocument(first))
+	assert.Equal(t, first.Vector, doc.Vector)
+	assert.NotContains(t, first.Metadata, MetadataKeyTruncated)
+
+	split, err := NewService(&Config{ModelName: "split", ModelMaxLength: 3, Truncation: TruncationSplit})
+	assert.NoError(t, err)
+	whole := NewTextDocument("c", long)
+	assert.NoError(t, split.ProcessDocument(whole))
+	assert.Equal(t, 7, whole.Metadata[MetadataKeyTokens])
+	assert.NotContains(t, whole.Metadata, MetadataKeyTruncated)
+	assert.NotEqual(t, first.Vector, whole.Vector)
+
+	// Batches handle long texts the same way
+	vectors, err := split.EmbedTexts([]string{"ok", long})
+	assert.NoError(t, err)
+	assert.Equal(t, whole.Vector, vectors[1])
+	docs := []*Document{NewTextDocument("d", long), NewTextDocument("e", "ok")}
+	assert.NoError(t, cut.ProcessDocuments(docs))
+	assert.Equal(t, doc.Vector, docs[0].Vector)
+	assert.Equal(t, 1, docs[1].Metadata[MetadataKeyTokens])
+
+	// Metrics count the tokens sent
+	stats := cut.Metrics().Snapshot()
+	assert.Equal(t, int64(3+3+3+1), stats[0].Tokens)
+}
+
+func TestChunkText(t *testing.T) {
+	tokenizer := models.NewApproxTokenizer()
+
+	assert.Equal(t, []string{"one two"}, ChunkText("one two", 0, tokenizer))
+	assert.Nil(t, ChunkText(" \n", 4, tokenizer))
+
+	// Chunks end at a paragraph break in their second half
+	chunks := ChunkText("a b c\n\nd e f g h", 4, tokenizer)
+	assert.Equal(t, []string{"a b c", "d e f g", "h"}, chunks)
+
+	// Without a break they are cut at the limit
+	assert.Equal(t, []string{"a b", "c d", "e"}, ChunkText("a b c d e", 2, tokenizer))
+}
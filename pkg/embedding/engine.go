@@ -19,8 +19,30 @@ type Config struct {
 	ModelName     string
 	ModelMaxLength int
 	ModelBatchSize int
+	Provider       string  // Provider of the model, for metrics (default: huggingface)
+	CostPer1KTokens float64 // Price of 1000 input tokens, for cost estimates
+	Retry           RetryPolicy // Retries, timeout and circuit breaker of model calls
+	Concurrency     int         // Batches embedded at once (default: DefaultConcurrency)
+	Truncation      string      // What happens to texts over ModelMaxLength tokens: TruncationCut (default) or TruncationSplit
+	Endpoint        string      // API URL of a remote model, e.g. of ProviderCLIP
+	APIKey          string      // Sent to a remote model as a bearer token when set
+	Dimension       int         // Dimension of a remote model's vectors
 }
 
+// Truncation strategies for texts longer than the model's maximum length
+const (
+	// TruncationCut embeds only the first ModelMaxLength tokens
+	TruncationCut = "truncate"
+
+	// TruncationSplit embeds every ModelMaxLength tokens separately and
+	// averages the vectors
+	TruncationSplit = "split"
+)
+
+// DefaultConcurrency is the number of batches a Service embeds at once
+// unless configured otherwise
+const DefaultConcurrency = 4
+
 // DefaultConfig returns a default configuration for the embedding engine
 func DefaultConfig() *Config {
 	return &Config{
@@ -41,18 +63,30 @@ func NewEngine(config *Config) (*Engine, error) {
 		ModelName: config.ModelName,
 		MaxLength: config.ModelMaxLength,
 		BatchSize: config.ModelBatchSize,
+		Endpoint:  config.Endpoint,
+		APIKey:    config.APIKey,
+		Dimension: config.Dimension,
 	}
 
 	// Create model
-	model, err := models.NewHuggingFaceModel(modelConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Hugging Face model: %w", err)
+	var model models.EmbeddingModel
+	var err error
+	switch config.Provider {
+	case ProviderCLIP:
+		if model, err = models.NewCLIPModel(modelConfig); err != nil {
+			return nil, fmt.Errorf("failed to create CLIP model: %w", err)
+		}
+	default:
+		if model, err = models.NewHuggingFaceModel(modelConfig); err != nil {
+			return nil, fmt.Errorf("failed to create Hugging Face model: %w", err)
+		}
 	}
 
 	// Create pipeline
 	p := pipeline.NewPipeline(model)
 	p.AddProcessor(pipeline.NewTextProcessor())
 	p.AddProcessor(pipeline.NewJSONProcessor())
+	p.SetImageProcessor(pipeline.NewImageProcessor())
 
 	return &Engine{
 		model:    model,
@@ -77,6 +111,20 @@ func (e *Engine) EmbedJSON(jsonContent map[string]interface{}) ([]float32, error
 	return e.pipeline.ProcessAndEmbed(jsonContent, "json")
 }
 
+// EmbedImage embeds an encoded image into a vector and returns its format
+// and size. The model must embed images.
+func (e *Engine) EmbedImage(data []byte) ([]float32, *pipeline.Image, error) {
+	if !e.initialized {
+		return nil, nil, fmt.Errorf("embedding engine not initialized")
+	}
+	return e.pipeline.ProcessAndEmbedImage(data)
+}
+
+// SupportsImages reports whether the model embeds images
+func (e *Engine) SupportsImages() bool {
+	return e.pipeline.SupportsImages()
+}
+
 // EmbedBatch embeds multiple texts into vectors
 func (e *Engine) EmbedBatch(texts []string) ([][]float32, error) {
 	if !e.initialized {
@@ -91,6 +139,20 @@ func (e *Engine) EmbedBatch(texts []string) ([][]float32, error) {
 	return e.pipeline.ProcessAndEmbedBatch(contents, "text")
 }
 
+// Prepare converts text or JSON content into the text the model embeds
+func (e *Engine) Prepare(content interface{}, contentType string) (string, error) {
+	return e.pipeline.Process(content, contentType)
+}
+
+// Tokenizer returns the model's tokenizer, or an approximation if the model
+// does not provide one
+func (e *Engine) Tokenizer() models.Tokenizer {
+	if model, ok := e.model.(models.TokenizingModel); ok {
+		return model.Tokenizer()
+	}
+	return models.NewApproxTokenizer()
+}
+
 // ModelDimension returns the dimension of the vectors produced by the model
 func (e *Engine) ModelDimension() int {
 	return e.model.Dimension()
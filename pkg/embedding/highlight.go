@@ -0,0 +1,195 @@
+package embedding
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ken/vector_database/pkg/analysis"
+	"github.com/ken/vector_database/pkg/embedding/models"
+)
+
+// DefaultSnippetLength is the length in bytes of the snippets Highlight
+// returns when no length is given
+const DefaultSnippetLength = 200
+
+// minStemLength is the shortest query term that also matches longer words
+// starting with it, so "index" matches "indexes"
+const minStemLength = 4
+
+// Snippet is the passage of a text most relevant to a query
+type Snippet struct {
+	Text    string        `json:"text"`
+	Start   int           `json:"start"`   // Byte offset of the snippet in the text
+	End     int           `json:"end"`     // Byte offset of the end of the snippet
+	Matches []models.Span `json:"matches"` // Query terms in Text, as byte ranges of Text
+
+	cut bool // The text goes on after the snippet
+}
+
+// Marked returns the snippet's text with each match between open and close,
+// with "…" where the text was cut
+func (s *Snippet) Marked(open, close string) string {
+	var b strings.Builder
+	if s.Start > 0 {
+		b.WriteString("…")
+	}
+	last := 0
+	for _, m := range s.Matches {
+		b.WriteString(s.Text[last:m.Start])
+		b.WriteString(open)
+		b.WriteString(s.Text[m.Start:m.End])
+		b.WriteString(close)
+		last = m.End
+	}
+	b.WriteString(s.Text[last:])
+	if s.cut {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// Highlight returns the passage of at most maxLen bytes of text with the
+// most distinct query terms, then the most occurrences of them, e.g. for a
+// search result list to show why a chunk matched. Words are compared as the
+// analyzer's terms, Standard() if nil, so case, stopwords, stems and
+// synonyms follow the collection's configuration. Terms of four or more
+// letters also match the words they start. Without any match the snippet is
+// the start of the text.
+func Highlight(text, query string, maxLen int, analyzer *analysis.Analyzer) *Snippet {
+	if maxLen <= 0 {
+		maxLen = DefaultSnippetLength
+	}
+	if analyzer == nil {
+		analyzer = analysis.Standard()
+	}
+	termSet := make(map[string]bool)
+	for _, term := range analyzer.QueryTerms(query) {
+		// Single letters such as "a" match too much to show anything
+		if utf8.RuneCountInString(term) > 1 {
+			termSet[term] = true
+		}
+	}
+
+	// Find the words of text matching a term
+	type match struct {
+		models.Span
+		term string
+	}
+	var matches []match
+	for _, token := range analyzer.Analyze(text) {
+		if term, ok := matchTerm(token.Term, termSet); ok {
+			matches = append(matches, match{models.Span{Start: token.Start, End: token.End}, term})
+		}
+	}
+
+	// Slide a window over the matches, scoring distinct terms first
+	bestFirst, bestLast, bestScore := -1, -1, 0
+	for first := range matches {
+		seen := make(map[string]bool)
+		for last := first; last < len(matches) && matches[last].End-matches[first].Start <= maxLen; last++ {
+			seen[matches[last].term] = true
+			if score := len(seen)*len(matches) + last - first + 1; score > bestScore {
+				bestFirst, bestLast, bestScore = first, last, score
+			}
+		}
+	}
+
+	start, end := 0, min(len(text), maxLen)
+	if bestFirst >= 0 {
+		start, end = expand(text, matches[bestFirst].Start, matches[bestLast].End, maxLen)
+	}
+	start, end = trimToWords(text, start, end)
+
+	snippet := &Snippet{Text: text[start:end], Start: start, End: end, Matches: []models.Span{}, cut: end < len(text)}
+	for _, m := range matches {
+		if m.Start >= start && m.End <= end {
+			snippet.Matches = append(snippet.Matches, models.Span{Start: m.Start - start, End: m.End - start})
+		}
+	}
+	return snippet
+}
+
+// isWordRune reports whether r is part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// matchTerm returns the query term a word matches
+func matchTerm(w string, terms map[string]bool) (string, bool) {
+	if terms[w] {
+		return w, true
+	}
+	for term := range terms {
+		if utf8.RuneCountInString(term) >= minStemLength && strings.HasPrefix(w, term) {
+			return term, true
+		}
+	}
+	return "", false
+}
+
+// expand widens the byte range [start, end) to maxLen bytes of text, moving
+// its start back to the beginning of the sentence if that fits and sharing
+// the rest of the room between both sides otherwise
+func expand(text string, start, end, maxLen int) (int, int) {
+	room := maxLen - (end - start)
+	if room <= 0 {
+		return start, end
+	}
+	sentence := strings.LastIndexAny(text[:start], ".!?\n") + 1
+	if start-sentence <= room {
+		start = sentence
+	} else {
+		start = max(0, start-room/2)
+	}
+	end = min(len(text), start+maxLen)
+	start = max(0, end-maxLen)
+	return start, end
+}
+
+// trimToWords moves the ends of [start, end) inside text so neither cuts a
+// word or character in half, and past surrounding spaces
+func trimToWords(text string, start, end int) (int, int) {
+	for start < end && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	for end < len(text) && end > start && !utf8.RuneStart(text[end]) {
+		end--
+	}
+	if inWord(text, start) {
+		if i := strings.IndexFunc(text[start:end], func(r rune) bool { return !isWordRune(r) }); i >= 0 {
+			start += i
+		}
+	}
+	if inWord(text, end) {
+		if i := strings.LastIndexFunc(text[start:end], func(r rune) bool { return !isWordRune(r) }); i >= 0 {
+			end = start + i
+		}
+	}
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		end -= size
+	}
+	return start, end
+}
+
+// inWord reports whether byte i of text is inside a word, not at its start
+// or end
+func inWord(text string, i int) bool {
+	if i <= 0 || i >= len(text) {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[i:])
+	return isWordRune(before) && isWordRune(after)
+}
@@ -0,0 +1,42 @@
+package embedding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/analysis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlight(t *testing.T) {
+	text := "Vector databases store embeddings. They are fast. An HNSW index finds the nearest " +
+		"neighbours of a query quickly, and indexes can be rebuilt online. Filters narrow the search."
+
+	// The window with the most distinct terms wins, from its sentence's start
+	snippet := Highlight(text, "Nearest neighbours INDEX", 80, nil)
+	assert.LessOrEqual(t, len(snippet.Text), 80)
+	assert.True(t, strings.HasPrefix(snippet.Text, "An HNSW index"), snippet.Text)
+	assert.Equal(t, "…An HNSW [index] finds the [nearest] [neighbours] of a query quickly, and [indexes] can…",
+		snippet.Marked("[", "]"))
+	assert.Equal(t, text[snippet.Start:snippet.End], snippet.Text)
+
+	// Single letters are not highlighted
+	snippet = Highlight(text, "a filters", 40, nil)
+	assert.Equal(t, "online. Filters narrow the search.", snippet.Text)
+	assert.Len(t, snippet.Matches, 1)
+
+	// Without a match the snippet is the start of the text, cut between words
+	snippet = Highlight(text, "zebra", 20, nil)
+	assert.Equal(t, "Vector databases", snippet.Text)
+	assert.Empty(t, snippet.Matches)
+
+	// Stems and synonyms of the analyzer match too
+	analyzer, err := analysis.New(analysis.Options{Language: "english", Stemming: true, Synonyms: []string{"quick, fast"}})
+	assert.NoError(t, err)
+	snippet = Highlight(text, "quick stores", 40, analyzer)
+	assert.Equal(t, "…[store] embeddings. They are [fast]. An…", snippet.Marked("[", "]"))
+
+	// Snippets never cut a character in half
+	snippet = Highlight("héllo wörld", "", 9, nil)
+	assert.Equal(t, "héllo", snippet.Text)
+}
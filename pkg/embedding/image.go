@@ -0,0 +1,95 @@
+package embedding
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/ken/vector_database/pkg/embedding/models"
+	"github.com/ken/vector_database/pkg/embedding/pipeline"
+)
+
+const (
+	// MetadataKeyMediaType is the metadata key holding the MIME type of an
+	// embedded image, e.g. "image/png"
+	MetadataKeyMediaType = "media_type"
+
+	// MetadataKeyWidth is the metadata key holding the width of an embedded
+	// image in pixels
+	MetadataKeyWidth = "width"
+
+	// MetadataKeyHeight is the metadata key holding the height of an
+	// embedded image in pixels
+	MetadataKeyHeight = "height"
+)
+
+// NewImageDocument creates a document for the image file at path. data is
+// its content, or nil to read the file when the document is embedded.
+func NewImageDocument(id, path string, data []byte) *Document {
+	doc := NewDocument(id, path, ContentTypeImage)
+	doc.image = data
+	return doc
+}
+
+// SupportsImages reports whether the service's model embeds images
+func (s *Service) SupportsImages() bool {
+	return s.engine.SupportsImages()
+}
+
+// EmbedImage embeds an encoded image, e.g. to search for similar images
+func (s *Service) EmbedImage(data []byte) ([]float32, error) {
+	vector, _, err := s.embedImage(data)
+	return vector, err
+}
+
+// embedImage checks an encoded image and embeds it with the service's retry
+// policy. Images are not counted as tokens in the metrics.
+func (s *Service) embedImage(data []byte) ([]float32, *pipeline.Image, error) {
+	if !s.SupportsImages() {
+		return nil, nil, fmt.Errorf("%w: %s", models.ErrImagesUnsupported, s.ModelName())
+	}
+	// Reject what is not an image before calling the model, so it is not retried
+	if _, err := pipeline.NewImageProcessor().Process(data); err != nil {
+		return nil, nil, err
+	}
+
+	var img *pipeline.Image
+	vector, err := embedCall(s, 0, func() ([]float32, error) {
+		vector, processed, err := s.engine.EmbedImage(data)
+		img = processed
+		return vector, err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return vector, img, nil
+}
+
+// processImage embeds an image document, reading its file unless the
+// document holds the image already, and records the image's type and size
+func (s *Service) processImage(doc *Document) error {
+	data := doc.image
+	if data == nil {
+		path, ok := doc.Content.(string)
+		if !ok {
+			return fmt.Errorf("content is not a path for image document")
+		}
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+	}
+
+	vector, img, err := s.embedImage(data)
+	if err != nil {
+		return fmt.Errorf("failed to embed image: %w", err)
+	}
+	doc.Vector = vector
+	doc.SetMetadata(MetadataKeyModel, s.engine.ModelName())
+	doc.SetMetadata("vector_dimension", s.engine.ModelDimension())
+	doc.SetMetadata(MetadataKeyMediaType, img.MediaType())
+	doc.SetMetadata(MetadataKeyWidth, strconv.Itoa(img.Width))
+	doc.SetMetadata(MetadataKeyHeight, strconv.Itoa(img.Height))
+	doc.SetMetadata(MetadataKeySize, strconv.Itoa(len(data)))
+	return nil
+}
@@ -0,0 +1,128 @@
+package embedding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/embedding/models"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCLIPServer serves a CLIP-style API that embeds images as their
+// average color and texts as a fixed vector
+func newCLIPServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []struct{ Text, Image string } `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp struct {
+			Data []map[string][]float32 `json:"data"`
+		}
+		for _, input := range req.Input {
+			embedding := []float32{0, 0, 0, 1}
+			if input.Image != "" {
+				data, _ := base64.StdEncoding.DecodeString(input.Image)
+				img, _, err := image.Decode(bytes.NewReader(data))
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				r, g, b, _ := img.At(0, 0).RGBA()
+				embedding = []float32{float32(r), float32(g), float32(b), 0}
+			}
+			resp.Data = append(resp.Data, map[string][]float32{"embedding": embedding})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// encodePNG returns a PNG of the given size filled with c
+func encodePNG(t *testing.T, width, height int, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestImageDocuments(t *testing.T) {
+	server := newCLIPServer(t)
+	registry := NewRegistry()
+	defer registry.Close()
+	assert.Error(t, registry.Register("clip", ModelSpec{Provider: ProviderCLIP, Model: "openai/clip-vit-base-patch32"}))
+	assert.NoError(t, registry.Register("clip", ModelSpec{Provider: ProviderCLIP, Model: "openai/clip-vit-base-patch32", Endpoint: server.URL, Dimension: 4}))
+
+	service, err := registry.Service("clip")
+	assert.NoError(t, err)
+	assert.True(t, service.SupportsImages())
+
+	dir := t.TempDir()
+	docsDir := filepath.Join(dir, "docs")
+	store := storage.NewMemoryStore()
+	path := filepath.Join(dir, "red.png")
+	red := encodePNG(t, 3, 2, color.RGBA{255, 0, 0, 255})
+	assert.NoError(t, os.WriteFile(path, red, 0644))
+
+	// The image's type and size are recorded on the vector
+	doc := NewImageDocument("red", path, red)
+	result, err := service.StoreDocument(store, docsDir, doc, false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentCreated, result)
+	v, err := store.Get("red")
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{65535, 0, 0, 0}, v.Values)
+	assert.Equal(t, "image/png", v.Metadata[MetadataKeyMediaType])
+	assert.Equal(t, "3", v.Metadata[MetadataKeyWidth])
+	assert.Equal(t, "2", v.Metadata[MetadataKeyHeight])
+	assert.Equal(t, "openai/clip-vit-base-patch32", v.Metadata[MetadataKeyModel])
+
+	// The same image is unchanged, a changed file is a new version
+	result, err = service.StoreDocument(store, docsDir, NewImageDocument("red", path, red), false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentUnchanged, result)
+	blue := encodePNG(t, 3, 2, color.RGBA{0, 0, 255, 255})
+	assert.NoError(t, os.WriteFile(path, blue, 0644))
+	result, err = service.StoreDocument(store, docsDir, NewImageDocument("red", path, blue), false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentUpdated, result)
+
+	// Stored image documents are embedded again from their file
+	stored, err := LoadDocument(docsDir, "red")
+	assert.NoError(t, err)
+	assert.NoError(t, service.ProcessDocuments([]*Document{stored, NewTextDocument("t", "a red square")}))
+	assert.Equal(t, []float32{0, 0, 65535, 0}, stored.Vector)
+
+	vector, err := service.EmbedImage(red)
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{65535, 0, 0, 0}, vector)
+	_, err = service.EmbedImage([]byte("not an image"))
+	assert.Error(t, err)
+
+	// Text models do not embed images
+	text, err := registry.Service(DefaultModelName)
+	assert.NoError(t, err)
+	assert.False(t, text.SupportsImages())
+	_, err = text.EmbedImage(red)
+	assert.True(t, errors.Is(err, models.ErrImagesUnsupported))
+}
@@ -0,0 +1,125 @@
+package embedding
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/embedding/models"
+)
+
+// ProviderStats are the counters of the calls made to one embedding model
+type ProviderStats struct {
+	Provider string        `json:"provider"`
+	Model    string        `json:"model"`
+	Calls    int64         `json:"calls"`
+	Failures int64         `json:"failures"`
+	Retries  int64         `json:"retries"`
+	Tokens   int64         `json:"tokens"`     // Estimated input tokens
+	Cost     float64       `json:"cost"`       // Estimated from the model's cost per 1K tokens
+	Latency  time.Duration `json:"latency_ns"` // Total time spent in calls
+}
+
+// AvgLatency returns the mean latency of a call
+func (p ProviderStats) AvgLatency() time.Duration {
+	if p.Calls == 0 {
+		return 0
+	}
+	return p.Latency / time.Duration(p.Calls)
+}
+
+// Metrics collects ProviderStats for every model a registry or service calls
+type Metrics struct {
+	mu    sync.Mutex
+	stats map[string]*ProviderStats
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{stats: make(map[string]*ProviderStats)}
+}
+
+// get returns the stats of a model, creating them on first use (caller must
+// hold m.mu)
+func (m *Metrics) get(provider, model string) *ProviderStats {
+	key := provider + "\x00" + model
+	stats, ok := m.stats[key]
+	if !ok {
+		stats = &ProviderStats{Provider: provider, Model: model}
+		m.stats[key] = stats
+	}
+	return stats
+}
+
+// record adds a finished call
+func (m *Metrics) record(provider, model string, latency time.Duration, tokens int, cost float64, retries int, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.get(provider, model)
+	stats.Calls++
+	stats.Retries += int64(retries)
+	stats.Latency += latency
+	if err != nil {
+		stats.Failures++
+		return
+	}
+	stats.Tokens += int64(tokens)
+	stats.Cost += cost
+}
+
+// Snapshot returns a copy of the stats, ordered by provider and model
+func (m *Metrics) Snapshot() []ProviderStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make([]ProviderStats, 0, len(m.stats))
+	for _, stats := range m.stats {
+		snapshot = append(snapshot, *stats)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].Provider != snapshot[j].Provider {
+			return snapshot[i].Provider < snapshot[j].Provider
+		}
+		return snapshot[i].Model < snapshot[j].Model
+	})
+	return snapshot
+}
+
+// WritePrometheus writes the stats in the Prometheus text format
+func (m *Metrics) WritePrometheus(w io.Writer) {
+	snapshot := m.Snapshot()
+	metrics := []struct {
+		name, kind, help string
+		value            func(ProviderStats) string
+	}{
+		{"vectodb_embedding_calls_total", "counter", "Embedding calls made to a model.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Calls) }},
+		{"vectodb_embedding_failures_total", "counter", "Embedding calls that failed.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Failures) }},
+		{"vectodb_embedding_retries_total", "counter", "Embedding calls retried after a failure.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Retries) }},
+		{"vectodb_embedding_tokens_total", "counter", "Estimated input tokens embedded.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Tokens) }},
+		{"vectodb_embedding_cost_total", "counter", "Estimated cost of the embedded tokens.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Cost) }},
+		{"vectodb_embedding_latency_seconds_total", "counter", "Time spent in embedding calls.",
+			func(p ProviderStats) string { return fmt.Sprint(p.Latency.Seconds()) }},
+	}
+
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", metric.name, metric.kind)
+		for _, stats := range snapshot {
+			fmt.Fprintf(w, "%s{provider=%q,model=%q} %s\n", metric.name, stats.Provider, stats.Model, metric.value(stats))
+		}
+	}
+}
+
+// EstimateTokens estimates the number of tokens a model splits text into
+// with an approximate tokenizer
+func EstimateTokens(text string) int {
+	return len(models.NewApproxTokenizer().Tokenize(text))
+}
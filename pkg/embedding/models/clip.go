@@ -0,0 +1,162 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultCLIPDimension is the dimension of CLIP ViT-B/32 embeddings, used
+// when a CLIP model is configured without one
+const DefaultCLIPDimension = 512
+
+// CLIPModel embeds texts and images with a remote CLIP-style API. Each call
+// POSTs the inputs to the endpoint as
+//
+//	{"model": "...", "input": [{"text": "..."}, {"image": "<base64>"}]}
+//
+// and reads one embedding per input from the response, as in OpenAI's
+// embeddings API:
+//
+//	{"data": [{"embedding": [0.1, ...]}, ...]}
+type CLIPModel struct {
+	config *ModelConfig
+	client *http.Client
+}
+
+// clipInput is one text or base64-encoded image sent to the API
+type clipInput struct {
+	Text  string `json:"text,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+type clipRequest struct {
+	Model string      `json:"model"`
+	Input []clipInput `json:"input"`
+}
+
+type clipResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewCLIPModel creates a client for the CLIP API at config.Endpoint
+func NewCLIPModel(config *ModelConfig) (*CLIPModel, error) {
+	if config == nil || config.Endpoint == "" {
+		return nil, fmt.Errorf("clip model needs an endpoint")
+	}
+	if config.Dimension <= 0 {
+		copied := *config
+		copied.Dimension = DefaultCLIPDimension
+		config = &copied
+	}
+	return &CLIPModel{config: config, client: &http.Client{Timeout: 60 * time.Second}}, nil
+}
+
+// Embed converts input text into a vector embedding
+func (m *CLIPModel) Embed(text string) ([]float32, error) {
+	vectors, err := m.call([]clipInput{{Text: text}})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// EmbedBatch converts multiple texts into vector embeddings
+func (m *CLIPModel) EmbedBatch(texts []string) ([][]float32, error) {
+	inputs := make([]clipInput, len(texts))
+	for i, text := range texts {
+		inputs[i] = clipInput{Text: text}
+	}
+	return m.call(inputs)
+}
+
+// EmbedImage implements ImageModel
+func (m *CLIPModel) EmbedImage(image []byte) ([]float32, error) {
+	vectors, err := m.call([]clipInput{{Image: base64.StdEncoding.EncodeToString(image)}})
+	if err != nil {
+		return nil, err
+	}
+	return vectors[0], nil
+}
+
+// call sends inputs to the API and returns their embeddings in order
+func (m *CLIPModel) call(inputs []clipInput) ([][]float32, error) {
+	if len(inputs) == 0 {
+		return [][]float32{}, nil
+	}
+	body, err := json.Marshal(clipRequest{Model: m.config.ModelName, Input: inputs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode clip request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clip request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.config.APIKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call clip model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clip response: %w", err)
+	}
+
+	var parsed clipResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("clip model returned status %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to parse clip response: %w", err)
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("clip model error: %s", parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("clip model returned status %d", resp.StatusCode)
+	}
+	if len(parsed.Data) != len(inputs) {
+		return nil, fmt.Errorf("clip model returned %d embeddings for %d inputs", len(parsed.Data), len(inputs))
+	}
+
+	vectors := make([][]float32, len(inputs))
+	for i, item := range parsed.Data {
+		if len(item.Embedding) != m.config.Dimension {
+			return nil, fmt.Errorf("clip model returned a %d-dimensional embedding, expected %d", len(item.Embedding), m.config.Dimension)
+		}
+		vectors[i] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// Dimension returns the dimension of the vectors produced by this model
+func (m *CLIPModel) Dimension() int {
+	return m.config.Dimension
+}
+
+// Name returns the name of the model
+func (m *CLIPModel) Name() string {
+	return m.config.ModelName
+}
+
+// Close releases resources used by the model
+func (m *CLIPModel) Close() error {
+	m.client.CloseIdleConnections()
+	return nil
+}
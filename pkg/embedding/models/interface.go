@@ -1,5 +1,7 @@
 package models
 
+import "errors"
+
 // EmbeddingModel defines the interface for all embedding models
 type EmbeddingModel interface {
 	// Embed converts input text into a vector embedding
@@ -23,6 +25,9 @@ type ModelConfig struct {
 	ModelName string
 	MaxLength int
 	BatchSize int
+	Endpoint  string // URL of a remote model's API
+	APIKey    string // Sent to a remote model as a bearer token when set
+	Dimension int    // Dimension of a remote model's vectors
 }
 
 // NewModelConfig creates a new model configuration with default values
@@ -32,4 +37,16 @@ func NewModelConfig(modelName string) *ModelConfig {
 		MaxLength: 256,
 		BatchSize: 32,
 	}
-} 
\ No newline at end of file
+}
+
+// ErrImagesUnsupported is returned when a model that only embeds text is
+// given an image
+var ErrImagesUnsupported = errors.New("model does not embed images")
+
+// ImageModel is implemented by models that embed images into the same
+// vector space as texts, such as CLIP, so texts find images and images find
+// similar images
+type ImageModel interface {
+	// EmbedImage converts an encoded image (PNG, JPEG or GIF) into a vector
+	EmbedImage(image []byte) ([]float32, error)
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Span is the byte range of a token in the text it was taken from
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Tokenizer splits text into the tokens a model reads
+type Tokenizer interface {
+	// Tokenize returns the spans of the tokens of text in order
+	Tokenize(text string) []Span
+}
+
+// TokenizingModel is implemented by models that know their exact tokenizer.
+// Other models are measured with an ApproxTokenizer.
+type TokenizingModel interface {
+	Tokenizer() Tokenizer
+}
+
+// approxPieceLength is the number of characters an ApproxTokenizer puts in
+// one token of a long word, about what BPE vocabularies average
+const approxPieceLength = 4
+
+// ApproxTokenizer approximates subword tokenizers such as BPE and WordPiece:
+// every punctuation character is a token, and words are split into pieces
+// of up to four characters
+type ApproxTokenizer struct{}
+
+// NewApproxTokenizer creates an approximate tokenizer
+func NewApproxTokenizer() *ApproxTokenizer {
+	return &ApproxTokenizer{}
+}
+
+// Tokenize implements Tokenizer
+func (ApproxTokenizer) Tokenize(text string) []Span {
+	var spans []Span
+	start, runes := -1, 0
+	flush := func(end int) {
+		if start >= 0 {
+			spans = append(spans, Span{start, end})
+		}
+		start, runes = -1, 0
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush(i)
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush(i)
+			spans = append(spans, Span{i, i + utf8.RuneLen(r)})
+		default:
+			if runes == approxPieceLength {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+			runes++
+		}
+	}
+	flush(len(text))
+	return spans
+}
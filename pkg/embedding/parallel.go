@@ -0,0 +1,25 @@
+package embedding
+
+import (
+	"github.com/ken/vector_database/internal/concurrency"
+)
+
+// forEachBatch calls fn for consecutive ranges of at most size of n items,
+// with up to concurrent calls running at once. No new batches are started
+// once one fails, and the error of the earliest failed batch is returned.
+func forEachBatch(n, size, concurrent int, fn func(start, end int) error) error {
+	if size < 1 {
+		size = 1
+	}
+	// Calls to the model wait on the network, so they are bounded by the
+	// model's concurrency rather than the CPUs
+	if concurrent < 1 {
+		concurrent = 1
+	}
+
+	batches := (n + size - 1) / size
+	return concurrency.ForEach(batches, concurrent, func(b int) error {
+		start := b * size
+		return fn(start, min(start+size, n))
+	})
+}
@@ -0,0 +1,81 @@
+package embedding
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachBatch(t *testing.T) {
+	var mu sync.Mutex
+	var running, peak int32
+	var ranges [][2]int
+	err := forEachBatch(10, 3, 2, func(start, end int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		mu.Lock()
+		peak = max(peak, n)
+		ranges = append(ranges, [2]int{start, end})
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][2]int{{0, 3}, {3, 6}, {6, 9}, {9, 10}}, ranges)
+	assert.LessOrEqual(t, peak, int32(2))
+
+	// The earliest failure is reported
+	err = forEachBatch(10, 1, 4, func(start, end int) error {
+		if start == 2 || start == 3 {
+			return fmt.Errorf("batch %d", start)
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "batch 2")
+}
+
+func TestEmbedTextsParallel(t *testing.T) {
+	service, err := NewService(&Config{ModelName: "parallel", ModelBatchSize: 4, Concurrency: 3})
+	assert.NoError(t, err)
+
+	texts := make([]string, 50)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("text %d", i)
+	}
+	vectors, err := service.EmbedTexts(texts)
+	assert.NoError(t, err)
+
+	// Results keep the order of the texts and match single embeddings
+	if assert.Len(t, vectors, len(texts)) {
+		for _, i := range []int{0, 17, 49} {
+			doc := NewTextDocument("", texts[i])
+			assert.NoError(t, service.ProcessDocument(doc))
+			assert.Equal(t, doc.Vector, vectors[i])
+		}
+	}
+
+	// One call per batch of four
+	stats := service.Metrics().Snapshot()
+	assert.Equal(t, int64(13+3), stats[0].Calls)
+
+	docs := []*Document{
+		NewTextDocument("a", "first"),
+		NewJSONDocument("b", map[string]interface{}{"k": "v"}),
+		NewTextDocument("c", "third"),
+	}
+	assert.NoError(t, service.ProcessDocuments(docs))
+	for _, doc := range docs {
+		assert.Len(t, doc.Vector, 384, doc.ID)
+		assert.Equal(t, "parallel", doc.Metadata[MetadataKeyModel], doc.ID)
+	}
+
+	bad := []*Document{NewTextDocument("a", "ok"), {ID: "b", ContentType: "image"}}
+	err = service.ProcessDocuments(bad)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "index 1")
+	}
+}
@@ -0,0 +1,205 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// Chunk is a stored chunk of a document with its text
+type Chunk struct {
+	ID    string `json:"id"`
+	Index int    `json:"chunk"` // Position in the document, starting at 0
+	Text  string `json:"text"`  // Empty if the chunk's document is not in docsDir
+}
+
+// Window is a chunk found by a search with the chunks around it, giving
+// the context of the hit within its document
+type Window struct {
+	Parent string  `json:"parent"` // ID of the document
+	Hit    string  `json:"hit"`    // ID of the chunk the window is around
+	Chunks []Chunk `json:"chunks"` // In document order, including the hit
+}
+
+// Text returns the text of the window's chunks, one per paragraph
+func (w *Window) Text() string {
+	texts := make([]string, len(w.Chunks))
+	for i, chunk := range w.Chunks {
+		texts[i] = chunk.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// ParentID returns the ID of the document a vector's metadata says it is a
+// chunk of, or id for vectors stored whole
+func ParentID(id string, metadata map[string]string) string {
+	if parent := metadata[MetadataKeyParent]; parent != "" {
+		return parent
+	}
+	return id
+}
+
+// Children returns the IDs of the vectors of the document parent in order:
+// its chunks, or its own vector if it was stored whole. Chunks are the
+// vectors whose parent_id is parent. Chunks embedded before parent IDs were
+// recorded are found by their IDs, parent#<n>.
+func Children(store storage.VectorStore, parent string) ([]string, error) {
+	candidates, err := storage.ListPrefix(store, parent+"#")
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, parent)
+
+	type child struct {
+		id    string
+		index int
+	}
+	var children []child
+	for _, id := range candidates {
+		v, err := storage.GetMeta(store, id)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if recorded, ok := v.Metadata[MetadataKeyParent]; ok {
+			if recorded != parent {
+				continue
+			}
+		} else if id != parent {
+			// Only chunk IDs of this document, not documents named like "a.md#notes"
+			if _, err := strconv.Atoi(strings.TrimPrefix(id, parent+"#")); err != nil {
+				continue
+			}
+		}
+		index, _ := strconv.Atoi(v.Metadata[MetadataKeyChunk])
+		children = append(children, child{id: id, index: index})
+	}
+
+	sort.SliceStable(children, func(a, b int) bool { return children[a].index < children[b].index })
+	ids := make([]string, len(children))
+	for i, c := range children {
+		ids[i] = c.id
+	}
+	return ids, nil
+}
+
+// DeleteDocument deletes the vector with the given ID and, if it names a
+// document, the vectors of all its chunks, along with their stored
+// documents in docsDir, if set. It returns the number of vectors deleted, or
+// storage.ErrVectorNotFound if there were none.
+func DeleteDocument(store storage.VectorStore, docsDir, id string) (int, error) {
+	ids, err := Children(store, id)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 || ids[len(ids)-1] != id {
+		ids = append(ids, id)
+	}
+
+	deleted := 0
+	for _, child := range ids {
+		err := store.Delete(child)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete vector %s: %w", child, err)
+		}
+		if docsDir != "" {
+			if err := os.Remove(DocumentPath(docsDir, child)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return deleted, fmt.Errorf("failed to delete document %s: %w", child, err)
+			}
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return 0, storage.ErrVectorNotFound
+	}
+	return deleted, nil
+}
+
+// ContextWindow returns the chunk with the given ID with up to before
+// chunks preceding and after chunks following it in its document. The
+// text of the chunks is read from their documents in docsDir.
+func ContextWindow(store storage.VectorStore, docsDir, id string, before, after int) (*Window, error) {
+	v, err := storage.GetMeta(store, id)
+	if err != nil {
+		return nil, err
+	}
+	parent := ParentID(id, v.Metadata)
+	siblings, err := Children(store, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	// The hit is in its own window even if its parent is not recorded
+	hit := -1
+	for i, sibling := range siblings {
+		if sibling == id {
+			hit = i
+		}
+	}
+	if hit < 0 {
+		siblings, hit = []string{id}, 0
+	}
+
+	first := max(hit-max(before, 0), 0)
+	last := min(hit+max(after, 0), len(siblings)-1)
+	window := &Window{Parent: parent, Hit: id}
+	for _, sibling := range siblings[first : last+1] {
+		chunk, err := loadChunk(store, docsDir, sibling)
+		if err != nil {
+			return nil, err
+		}
+		window.Chunks = append(window.Chunks, chunk)
+	}
+	return window, nil
+}
+
+// DocumentChunks returns every chunk of the document parent in order, or
+// storage.ErrVectorNotFound if it has none
+func DocumentChunks(store storage.VectorStore, docsDir, parent string) ([]Chunk, error) {
+	ids, err := Children(store, parent)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, storage.ErrVectorNotFound
+	}
+	chunks := make([]Chunk, len(ids))
+	for i, id := range ids {
+		if chunks[i], err = loadChunk(store, docsDir, id); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// loadChunk reads the position and text of a chunk
+func loadChunk(store storage.VectorStore, docsDir, id string) (Chunk, error) {
+	v, err := storage.GetMeta(store, id)
+	if err != nil {
+		return Chunk{}, err
+	}
+	chunk := Chunk{ID: id}
+	chunk.Index, _ = strconv.Atoi(v.Metadata[MetadataKeyChunk])
+	if docsDir == "" {
+		return chunk, nil
+	}
+
+	doc, err := LoadDocument(docsDir, id)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Chunk{}, err
+	}
+	if doc != nil {
+		chunk.Text = doc.Text()
+	}
+	return chunk, nil
+}
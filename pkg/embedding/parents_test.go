@@ -0,0 +1,110 @@
+package embedding
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// storeChunks stores the chunks of a document as EmbedDir does
+func storeChunks(t *testing.T, store storage.VectorStore, docsDir, parent string, texts ...string) {
+	t.Helper()
+	for i, text := range texts {
+		id := parent + "#" + strconv.Itoa(i)
+		v := vector.NewVector(id, []float32{float32(i), 1})
+		v.Metadata[MetadataKeyParent] = parent
+		v.Metadata[MetadataKeyChunk] = strconv.Itoa(i)
+		assert.NoError(t, store.Insert(v))
+		assert.NoError(t, saveDocument(docsDir, NewTextDocument(id, text)))
+	}
+}
+
+func TestChildren(t *testing.T) {
+	docsDir := t.TempDir()
+	store := storage.NewMemoryStore()
+	texts := make([]string, 12)
+	for i := range texts {
+		texts[i] = "part " + strconv.Itoa(i)
+	}
+	storeChunks(t, store, docsDir, "a.md", texts...)
+	// A document named like a chunk of a.md is not one of its chunks
+	assert.NoError(t, store.Insert(vector.NewVector("a.md#notes", []float32{1, 1})))
+	// Chunks embedded before parent IDs were recorded
+	for _, id := range []string{"old.md#1", "old.md#0"} {
+		v := vector.NewVector(id, []float32{1, 1})
+		v.Metadata[MetadataKeyChunk] = id[len(id)-1:]
+		assert.NoError(t, store.Insert(v))
+	}
+
+	children, err := Children(store, "a.md")
+	assert.NoError(t, err)
+	assert.Len(t, children, 12)
+	assert.Equal(t, "a.md#2", children[2])
+	assert.Equal(t, "a.md#11", children[11])
+
+	children, err = Children(store, "old.md")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"old.md#0", "old.md#1"}, children)
+
+	children, err = Children(store, "a.md#notes")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.md#notes"}, children)
+}
+
+func TestContextWindow(t *testing.T) {
+	docsDir := t.TempDir()
+	store := storage.NewMemoryStore()
+	storeChunks(t, store, docsDir, "a.md", "one", "two", "three", "four")
+
+	window, err := ContextWindow(store, docsDir, "a.md#2", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "a.md", window.Parent)
+	assert.Equal(t, "a.md#2", window.Hit)
+	assert.Equal(t, "two\n\nthree\n\nfour", window.Text())
+
+	// The window stops at the start of the document
+	window, err = ContextWindow(store, docsDir, "a.md#0", 2, 0)
+	assert.NoError(t, err)
+	assert.Len(t, window.Chunks, 1)
+	assert.Equal(t, 0, window.Chunks[0].Index)
+
+	// A vector stored whole is its own window
+	assert.NoError(t, store.Insert(vector.NewVector("raw", []float32{1, 1})))
+	window, err = ContextWindow(store, docsDir, "raw", 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "raw", window.Parent)
+	assert.Len(t, window.Chunks, 1)
+	assert.Empty(t, window.Chunks[0].Text)
+
+	_, err = ContextWindow(store, docsDir, "missing", 1, 1)
+	assert.True(t, errors.Is(err, storage.ErrVectorNotFound))
+}
+
+func TestDeleteDocument(t *testing.T) {
+	docsDir := t.TempDir()
+	store := storage.NewMemoryStore()
+	storeChunks(t, store, docsDir, "a.md", "one", "two", "three")
+	storeChunks(t, store, docsDir, "b.md", "other")
+
+	// Deleting a single chunk leaves the rest of its document
+	n, err := DeleteDocument(store, docsDir, "a.md#1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = LoadDocument(docsDir, "a.md#1")
+	assert.Error(t, err)
+
+	n, err = DeleteDocument(store, docsDir, "a.md")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	ids, _ := store.List()
+	assert.Equal(t, []string{"b.md#0"}, ids)
+	_, err = LoadDocument(docsDir, "a.md#2")
+	assert.Error(t, err)
+
+	_, err = DeleteDocument(store, docsDir, "a.md")
+	assert.True(t, errors.Is(err, storage.ErrVectorNotFound))
+}
@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extraction methods, recorded in Extracted.Method
+const (
+	ExtractText          = "text"          // Plain text in a legacy 8-bit encoding
+	ExtractDOCX          = "docx"          // Paragraphs of a Word document
+	ExtractODT           = "odt"           // Paragraphs of an OpenDocument text
+	ExtractPDF           = "pdf"           // Text operators of a PDF's content streams
+	ExtractTranscription = "transcription" // Audio sent to the transcription endpoint
+	ExtractOCR           = "ocr"           // Image sent to the OCR endpoint
+)
+
+// ErrNoText is returned for binary files no text can be extracted from, such
+// as audio without a transcription endpoint
+var ErrNoText = errors.New("no text could be extracted")
+
+// maxExtracted is the most bytes read from an archive member or response
+const maxExtracted = 64 << 20
+
+// BinaryOptions configures a BinaryProcessor
+type BinaryOptions struct {
+	TranscriptionEndpoint string        // Receives audio files and returns their text (optional)
+	OCREndpoint           string        // Receives images and returns their text (optional)
+	APIKey                string        // Sent to the endpoints as a bearer token when set
+	Timeout               time.Duration // Longest an endpoint may take (default: 2m)
+}
+
+// Extracted is the text of a binary file with its provenance
+type Extracted struct {
+	Text      string
+	Hash      string // SHA-256 of the file, hex encoded
+	MediaType string // MIME type of the file, e.g. "application/pdf"
+	Method    string // How the text was obtained, e.g. ExtractPDF
+}
+
+// BinaryProcessor extracts the text of binary files: documents that embed
+// text, such as PDF, Word and OpenDocument files, directly, and audio and
+// images through transcription and OCR endpoints if configured. Each
+// endpoint receives the file as the request body, with its media type as
+// Content-Type, and returns {"text": "..."}.
+type BinaryProcessor struct {
+	opts   BinaryOptions
+	client *http.Client
+}
+
+// NewBinaryProcessor creates a binary processor
+func NewBinaryProcessor(options *BinaryOptions) *BinaryProcessor {
+	opts := BinaryOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	return &BinaryProcessor{opts: opts, client: &http.Client{Timeout: opts.Timeout}}
+}
+
+// Process returns the text of the file name with content data. It returns
+// ErrNoText, wrapped with the file's media type, if the file holds none or
+// its kind needs an endpoint that is not configured.
+func (p *BinaryProcessor) Process(name string, data []byte) (*Extracted, error) {
+	sum := sha256.Sum256(data)
+	extracted := &Extracted{Hash: hex.EncodeToString(sum[:]), MediaType: MediaType(name, data)}
+
+	var text string
+	var err error
+	switch mediaType := extracted.MediaType; {
+	case mediaType == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		extracted.Method = ExtractDOCX
+		text, err = zipXMLText(data, "word/document.xml")
+	case mediaType == "application/vnd.oasis.opendocument.text":
+		extracted.Method = ExtractODT
+		text, err = zipXMLText(data, "content.xml")
+	case mediaType == "application/pdf":
+		extracted.Method = ExtractPDF
+		text = pdfText(data)
+	case strings.HasPrefix(mediaType, "text/"):
+		extracted.Method = ExtractText
+		text = latin1(data)
+	case strings.HasPrefix(mediaType, "audio/") && p.opts.TranscriptionEndpoint != "":
+		extracted.Method = ExtractTranscription
+		text, err = p.callEndpoint(p.opts.TranscriptionEndpoint, mediaType, data)
+	case strings.HasPrefix(mediaType, "image/") && p.opts.OCREndpoint != "":
+		extracted.Method = ExtractOCR
+		text, err = p.callEndpoint(p.opts.OCREndpoint, mediaType, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text (%s): %w", extracted.Method, err)
+	}
+
+	extracted.Text = strings.TrimSpace(text)
+	if extracted.Text == "" {
+		return nil, fmt.Errorf("%w from %s", ErrNoText, extracted.MediaType)
+	}
+	return extracted, nil
+}
+
+// MediaType returns the MIME type of a file by its extension, or by its
+// content if the extension is unknown
+func MediaType(name string, data []byte) string {
+	if byExtension := mime.TypeByExtension(strings.ToLower(path.Ext(name))); byExtension != "" {
+		mediaType, _, _ := mime.ParseMediaType(byExtension)
+		if mediaType != "" {
+			return mediaType
+		}
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+// init registers the document formats Go's MIME table may lack
+func init() {
+	mime.AddExtensionType(".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
+	mime.AddExtensionType(".odt", "application/vnd.oasis.opendocument.text")
+}
+
+// zipXMLText returns the paragraphs of the XML member of a zip archive, such
+// as the body of a Word or OpenDocument file
+func zipXMLText(data []byte, member string) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range archive.File {
+		if file.Name != member {
+			continue
+		}
+		r, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		return xmlText(io.LimitReader(r, maxExtracted))
+	}
+	return "", fmt.Errorf("%s not found", member)
+}
+
+// xmlText returns the character data of an XML document, ending a line at
+// the end of every paragraph or heading ("p" or "h" element, in any
+// namespace) and turning tabs and breaks into whitespace
+func xmlText(r io.Reader) (string, error) {
+	var b strings.Builder
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			b.Write(t)
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "tab":
+				b.WriteByte('\t')
+			case "br", "line-break":
+				b.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Local == "p" || t.Name.Local == "h" {
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+var (
+	// pdfStream matches a PDF stream with the dictionary before it
+	pdfStream = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n(.*?)\r?\nendstream`)
+
+	// pdfTextOperator matches the strings shown by the Tj, TJ, ' and "
+	// operators and the T* and ET operators that end a line
+	pdfTextOperator = regexp.MustCompile(`(?s)\[((?:\((?:\\.|[^\\)])*\)|[^\]])*)\]\s*TJ|\(((?:\\.|[^\\)])*)\)\s*(?:Tj|'|")|\bT\*|\bET\b`)
+
+	// pdfString matches a literal string inside a TJ array
+	pdfString = regexp.MustCompile(`\(((?:\\.|[^\\)])*)\)`)
+)
+
+// pdfText returns the literal strings shown by the content streams of a
+// PDF, inflating Flate-compressed streams. Text in hex strings or fonts
+// with custom encodings is not recovered, and scanned pages have none.
+func pdfText(data []byte) string {
+	var b strings.Builder
+	for _, match := range pdfStream.FindAllSubmatch(data, -1) {
+		content := match[2]
+		if bytes.Contains(match[1], []byte("/FlateDecode")) {
+			r, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			content, err = io.ReadAll(io.LimitReader(r, maxExtracted))
+			if err != nil && len(content) == 0 {
+				continue
+			}
+		}
+		for _, op := range pdfTextOperator.FindAllSubmatch(content, -1) {
+			switch {
+			case op[1] != nil:
+				for _, s := range pdfString.FindAllSubmatch(op[1], -1) {
+					b.WriteString(pdfUnescape(s[1]))
+				}
+			case op[2] != nil:
+				b.WriteString(pdfUnescape(op[2]))
+			default:
+				b.WriteByte('\n')
+			}
+		}
+	}
+	return latin1([]byte(b.String()))
+}
+
+// pdfUnescape decodes the escape sequences of a PDF literal string
+func pdfUnescape(s []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch c := s[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b', 'f':
+		case '\r', '\n':
+			// A line continuation
+		default:
+			if c >= '0' && c <= '7' {
+				code, j := 0, i
+				for ; j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7'; j++ {
+					code = code*8 + int(s[j]-'0')
+				}
+				b.WriteByte(byte(code))
+				i = j - 1
+				continue
+			}
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// latin1 decodes text in ISO 8859-1 unless it is UTF-8 already, and drops
+// control characters other than whitespace
+func latin1(data []byte) string {
+	text := string(data)
+	if !utf8.Valid(data) {
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// callEndpoint sends a file to a transcription or OCR endpoint and returns
+// the text it found
+func (p *BinaryProcessor) callEndpoint(endpoint, mediaType string, data []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", mediaType)
+	if p.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.opts.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxExtracted))
+	if err != nil {
+		return "", err
+	}
+	var parsed struct {
+		Text  string `json:"text"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("invalid endpoint response: %w", err)
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("endpoint error: %s", parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return parsed.Text, nil
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// zipFile returns a zip archive holding one member
+func zipFile(t *testing.T, name, content string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// pdfFile returns a minimal PDF with one content stream, Flate-compressed if
+// compress is set
+func pdfFile(t *testing.T, content string, compress bool) []byte {
+	stream, filter := []byte(content), ""
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write(stream)
+		assert.NoError(t, w.Close())
+		stream, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+	return []byte(fmt.Sprintf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n4 0 obj\n<< /Length %d%s >>\nstream\n%s\nendstream\nendobj\n%%%%EOF\n",
+		len(stream), filter, stream))
+}
+
+func TestBinaryProcessor(t *testing.T) {
+	p := NewBinaryProcessor(nil)
+
+	docx := zipFile(t, "word/document.xml", `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`+
+		`<w:p><w:r><w:t>Quarterly</w:t></w:r><w:r><w:t xml:space="preserve"> report</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>Revenue grew</w:t></w:r></w:p></w:body></w:document>`)
+	odt := zipFile(t, "content.xml", `<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" `+
+		`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0"><office:body><office:text>`+
+		`<text:h>Minutes</text:h><text:p>All present</text:p></office:text></office:body></office:document-content>`)
+	pdfContent := "BT /F1 12 Tf (Hello, \\(PDF\\) world) Tj T* [(Sec) -20 (ond line)] TJ ET"
+
+	cases := []struct {
+		name      string
+		data      []byte
+		text      string
+		mediaType string
+		method    string
+	}{
+		{"report.docx", docx, "Quarterly report\nRevenue grew", "application/vnd.openxmlformats-officedocument.wordprocessingml.document", ExtractDOCX},
+		{"minutes.odt", odt, "Minutes\nAll present", "application/vnd.oasis.opendocument.text", ExtractODT},
+		{"plain.pdf", pdfFile(t, pdfContent, false), "Hello, (PDF) world\nSecond line", "application/pdf", ExtractPDF},
+		{"flate.pdf", pdfFile(t, pdfContent, true), "Hello, (PDF) world\nSecond line", "application/pdf", ExtractPDF},
+		{"notes.txt", []byte("caf\xe9 cr\xe8me"), "café crème", "text/plain", ExtractText},
+	}
+	for _, c := range cases {
+		extracted, err := p.Process(c.name, c.data)
+		if !assert.NoError(t, err, c.name) {
+			continue
+		}
+		assert.Equal(t, c.text, extracted.Text, c.name)
+		assert.Equal(t, c.mediaType, extracted.MediaType, c.name)
+		assert.Equal(t, c.method, extracted.Method, c.name)
+		assert.Len(t, extracted.Hash, 64, c.name)
+	}
+
+	// Audio needs a transcription endpoint
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 32)...)
+	_, err := p.Process("talk.wav", wav)
+	assert.True(t, errors.Is(err, ErrNoText))
+	_, err = p.Process("blob.bin", []byte{0, 1, 2, 3})
+	assert.True(t, errors.Is(err, ErrNoText))
+}
+
+func TestBinaryProcessorEndpoints(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "bad key"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"text": "%d bytes of %s at %s"}`, len(body), r.Header.Get("Content-Type"), r.URL.Path)
+	}))
+	defer server.Close()
+
+	p := NewBinaryProcessor(&BinaryOptions{
+		TranscriptionEndpoint: server.URL + "/transcribe",
+		OCREndpoint:           server.URL + "/ocr",
+		APIKey:                "secret",
+	})
+	wav := append([]byte("RIFF\x24\x00\x00\x00WAVEfmt "), make([]byte, 32)...)
+	extracted, err := p.Process("talk.wav", wav)
+	assert.NoError(t, err)
+	assert.Equal(t, ExtractTranscription, extracted.Method)
+	assert.Equal(t, "48 bytes of audio/wav at /transcribe", extracted.Text)
+
+	extracted, err = p.Process("scan.png", []byte("\x89PNG\r\n\x1a\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, ExtractOCR, extracted.Method)
+	assert.Equal(t, "8 bytes of image/png at /ocr", extracted.Text)
+
+	p = NewBinaryProcessor(&BinaryOptions{OCREndpoint: server.URL})
+	_, err = p.Process("scan.png", []byte("\x89PNG\r\n\x1a\n"))
+	assert.ErrorContains(t, err, "bad key")
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif" // Register the decoders of the supported formats
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/ken/vector_database/pkg/embedding/models"
+)
+
+// MaxImagePixels is the largest image, in pixels, the image processor
+// accepts, so a corrupt or hostile header cannot make a model decode
+// gigabytes
+const MaxImagePixels = 64 << 20
+
+// Image is an encoded image checked by an ImageProcessor
+type Image struct {
+	Data   []byte
+	Format string // Encoding: "png", "jpeg" or "gif"
+	Width  int
+	Height int
+}
+
+// MediaType returns the MIME type of the image, e.g. "image/png"
+func (img *Image) MediaType() string {
+	return "image/" + img.Format
+}
+
+// ImageProcessor checks that content is an image in a supported format and
+// reads its size, without decoding its pixels
+type ImageProcessor struct{}
+
+// NewImageProcessor creates an image processor
+func NewImageProcessor() *ImageProcessor {
+	return &ImageProcessor{}
+}
+
+// Process returns the format and size of an encoded image
+func (p *ImageProcessor) Process(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image (use PNG, JPEG or GIF): %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxImagePixels {
+		return nil, fmt.Errorf("unsupported image size %dx%d", config.Width, config.Height)
+	}
+	return &Image{Data: data, Format: format, Width: config.Width, Height: config.Height}, nil
+}
+
+// SetImageProcessor makes the pipeline accept images. They are embedded by
+// the pipeline's model if it is a models.ImageModel.
+func (p *Pipeline) SetImageProcessor(processor *ImageProcessor) {
+	p.images = processor
+}
+
+// ProcessAndEmbedImage checks an encoded image and embeds it
+func (p *Pipeline) ProcessAndEmbedImage(data []byte) ([]float32, *Image, error) {
+	if p.images == nil {
+		return nil, nil, fmt.Errorf("no processor found for content type: image")
+	}
+	img, err := p.images.Process(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	model, ok := p.model.(models.ImageModel)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", models.ErrImagesUnsupported, p.model.Name())
+	}
+	vector, err := model.EmbedImage(img.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return vector, img, nil
+}
+
+// SupportsImages reports whether the pipeline can embed images
+func (p *Pipeline) SupportsImages() bool {
+	_, ok := p.model.(models.ImageModel)
+	return p.images != nil && ok
+}
@@ -80,6 +80,7 @@ func (p *JSONProcessor) Type() string {
 // Pipeline manages content processors and embedding models
 type Pipeline struct {
 	processors map[string]ContentProcessor
+	images     *ImageProcessor // Set by SetImageProcessor
 	model      models.EmbeddingModel
 }
 
@@ -96,16 +97,25 @@ func (p *Pipeline) AddProcessor(processor ContentProcessor) {
 	p.processors[processor.Type()] = processor
 }
 
-// ProcessAndEmbed processes content and generates embeddings
-func (p *Pipeline) ProcessAndEmbed(content interface{}, contentType string) ([]float32, error) {
+// Process converts content into the text the model embeds
+func (p *Pipeline) Process(content interface{}, contentType string) (string, error) {
 	processor, ok := p.processors[contentType]
 	if !ok {
-		return nil, fmt.Errorf("no processor found for content type: %s", contentType)
+		return "", fmt.Errorf("no processor found for content type: %s", contentType)
 	}
 
 	processed, err := processor.Process(content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to process content: %w", err)
+		return "", fmt.Errorf("failed to process content: %w", err)
+	}
+	return processed, nil
+}
+
+// ProcessAndEmbed processes content and generates embeddings
+func (p *Pipeline) ProcessAndEmbed(content interface{}, contentType string) ([]float32, error) {
+	processed, err := p.Process(content, contentType)
+	if err != nil {
+		return nil, err
 	}
 
 	return p.model.Embed(processed)
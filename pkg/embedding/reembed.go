@@ -0,0 +1,201 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/fileutil"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// MetadataKeyModel is the vector/document metadata key holding the name
+	// of the model that produced the embedding
+	MetadataKeyModel = "embedding_model"
+
+	// MetadataKeyTokens is the document metadata key holding the number of
+	// tokens of the embedded text
+	MetadataKeyTokens = "token_count"
+
+	// MetadataKeyTruncated is set on documents whose text was cut at the
+	// model's maximum length
+	MetadataKeyTruncated = "truncated"
+)
+
+// ReembedOptions controls a re-embedding run
+type ReembedOptions struct {
+	BatchSize int                       // Number of vectors updated per batch (default: 64)
+	DryRun    bool                      // Only report what would be re-embedded
+	Progress  func(stats *ReembedStats) // Called after every batch (optional)
+}
+
+// DefaultReembedOptions returns the default re-embedding options
+func DefaultReembedOptions() *ReembedOptions {
+	return &ReembedOptions{
+		BatchSize: 64,
+	}
+}
+
+// ReembedStats summarizes a re-embedding run
+type ReembedStats struct {
+	Total      int // Vectors in the store when the run started
+	Scanned    int // Vectors inspected
+	Current    int // Vectors already embedded with the target model
+	Reembedded int // Vectors re-embedded (or that would be, in a dry run)
+	Skipped    int // Vectors without a stored source document
+}
+
+// Reembed finds vectors embedded with a model other than the service's model,
+// re-embeds their stored source documents from docsDir and updates both the
+// vectors and the documents in batches
+func (s *Service) Reembed(store storage.VectorStore, docsDir string, options *ReembedOptions) (*ReembedStats, error) {
+	opts := DefaultReembedOptions()
+	if options != nil {
+		opts = options
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = 1
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	stats := &ReembedStats{Total: len(ids)}
+	targetModel := s.engine.ModelName()
+	batch := make([]*Document, 0, opts.BatchSize)
+
+	for _, id := range ids {
+		v, err := store.Get(id)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			// Deleted while we were scanning
+			continue
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		stats.Scanned++
+
+		if v.Metadata[MetadataKeyModel] == targetModel {
+			stats.Current++
+			continue
+		}
+
+		// Only vectors with a stored source document can be re-embedded
+		doc, err := LoadDocument(docsDir, id)
+		if errors.Is(err, os.ErrNotExist) {
+			stats.Skipped++
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		// Older vectors carry no model metadata; trust the document instead
+		if model, _ := doc.GetMetadata(MetadataKeyModel); model == targetModel && v.Metadata[MetadataKeyModel] == "" {
+			stats.Current++
+			continue
+		}
+
+		batch = append(batch, doc)
+		if len(batch) >= opts.BatchSize {
+			if err := s.reembedBatch(store, docsDir, batch, opts, stats); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		if err := s.reembedBatch(store, docsDir, batch, opts, stats); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// reembedBatch embeds a batch of documents and writes the results back
+func (s *Service) reembedBatch(store storage.VectorStore, docsDir string, batch []*Document, opts *ReembedOptions, stats *ReembedStats) error {
+	if opts.DryRun {
+		stats.Reembedded += len(batch)
+		if opts.Progress != nil {
+			opts.Progress(stats)
+		}
+		return nil
+	}
+
+	// Embed the whole batch before touching the store
+	if err := s.ProcessDocuments(batch); err != nil {
+		return err
+	}
+
+	for _, doc := range batch {
+		v, err := store.Get(doc.ID)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read vector %s: %w", doc.ID, err)
+		}
+
+		// Keep user metadata and record the new model
+		updated := vector.NewVector(doc.ID, doc.Vector)
+		for key, value := range v.Metadata {
+			updated.Metadata[key] = value
+		}
+		updated.Metadata[MetadataKeyModel] = s.engine.ModelName()
+		if err := store.Update(updated); err != nil {
+			return fmt.Errorf("failed to update vector %s: %w", doc.ID, err)
+		}
+
+		if err := saveDocument(docsDir, doc); err != nil {
+			return err
+		}
+		stats.Reembedded++
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	return nil
+}
+
+// DocumentPath returns the file the document with the given ID is stored
+// in. The name is encoded with storage.IDFileName, so any ID stays inside
+// docsDir.
+func DocumentPath(docsDir, id string) string {
+	return filepath.Join(docsDir, storage.IDFileName(id)+".json")
+}
+
+// LoadDocument reads a stored document from docsDir
+func LoadDocument(docsDir, id string) (*Document, error) {
+	data, err := os.ReadFile(DocumentPath(docsDir, id))
+	if errors.Is(err, os.ErrNotExist) && filepath.IsLocal(id) && filepath.Base(id) == id {
+		// Documents stored before names were encoded are named after the ID
+		data, err = os.ReadFile(filepath.Join(docsDir, id+".json"))
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read document %s: %w", id, err)
+	}
+	return DocumentFromJSON(string(data))
+}
+
+// saveDocument writes a document to docsDir
+func saveDocument(docsDir string, doc *Document) error {
+	docJSON, err := doc.ToJSON()
+	if err != nil {
+		return err
+	}
+	if err := fileutil.WriteFile(DocumentPath(docsDir, doc.ID), []byte(docJSON), 0644); err != nil {
+		return fmt.Errorf("failed to write document %s: %w", doc.ID, err)
+	}
+	return nil
+}
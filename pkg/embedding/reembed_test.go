@@ -0,0 +1,122 @@
+package embedding
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReembed(t *testing.T) {
+	docsDir := t.TempDir()
+	store := storage.NewMemoryStore()
+
+	// Embed two documents with the old model
+	oldService, err := NewService(nil)
+	assert.NoError(t, err)
+	for _, id := range []string{"doc1", "doc2"} {
+		doc := NewTextDocument(id, "content of "+id)
+		assert.NoError(t, oldService.ProcessDocument(doc))
+		assert.NoError(t, saveDocument(docsDir, doc))
+
+		v := vector.NewVector(id, doc.Vector)
+		v.Metadata[MetadataKeyModel] = oldService.ModelName()
+		v.Metadata["category"] = "test"
+		assert.NoError(t, store.Insert(v))
+	}
+	// A vector without a source document cannot be re-embedded
+	assert.NoError(t, store.Insert(vector.NewVector("raw", []float32{1, 2, 3})))
+
+	newService, err := NewService(&Config{ModelName: "new-model@v2", ModelMaxLength: 256, ModelBatchSize: 32})
+	assert.NoError(t, err)
+
+	// Dry runs report without changing anything
+	stats, err := newService.Reembed(store, docsDir, &ReembedOptions{BatchSize: 1, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Reembedded)
+	v, _ := store.Get("doc1")
+	assert.Equal(t, oldService.ModelName(), v.Metadata[MetadataKeyModel])
+
+	batches := 0
+	stats, err = newService.Reembed(store, docsDir, &ReembedOptions{
+		BatchSize: 1,
+		Progress:  func(*ReembedStats) { batches++ },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Scanned)
+	assert.Equal(t, 2, stats.Reembedded)
+	assert.Equal(t, 1, stats.Skipped)
+	assert.Equal(t, 2, batches)
+
+	v, _ = store.Get("doc1")
+	assert.Equal(t, "new-model@v2", v.Metadata[MetadataKeyModel])
+	assert.Equal(t, "test", v.Metadata["category"])
+
+	data, err := os.ReadFile(filepath.Join(docsDir, "doc1.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "new-model@v2")
+
+	// A second run finds nothing left to do
+	stats, err = newService.Reembed(store, docsDir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.Reembedded)
+	assert.Equal(t, 2, stats.Current)
+}
+
+func TestStoreDocumentVersions(t *testing.T) {
+	service, err := NewService(nil)
+	assert.NoError(t, err)
+	store := storage.NewMemoryStore()
+	docsDir := t.TempDir()
+
+	result, err := service.StoreDocument(store, docsDir, NewTextDocument("d1", "first"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentCreated, result)
+
+	// The same content is not embedded again
+	calls := service.Metrics().Snapshot()[0].Calls
+	doc := NewTextDocument("d1", "first")
+	result, err = service.StoreDocument(store, docsDir, doc, false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentUnchanged, result)
+	assert.Equal(t, 1, doc.Version)
+	assert.Equal(t, calls, service.Metrics().Snapshot()[0].Calls)
+
+	result, err = service.StoreDocument(store, docsDir, NewTextDocument("d1", "first"), true)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentReembedded, result)
+
+	// Changed content is a new version, consistent in both stores
+	result, err = service.StoreDocument(store, docsDir, NewTextDocument("d1", "second"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentUpdated, result)
+
+	stored, err := LoadDocument(docsDir, "d1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stored.Version)
+	assert.Equal(t, "second", stored.Content)
+	if assert.Len(t, stored.History, 1) {
+		assert.Equal(t, 1, stored.History[0].Version)
+		assert.NotEqual(t, stored.Hash, stored.History[0].ContentHash)
+	}
+	v, err := store.Get("d1")
+	assert.NoError(t, err)
+	assert.Equal(t, stored.Hash, v.Metadata[MetadataKeyContentHash])
+	assert.Equal(t, "2", v.Metadata[MetadataKeyVersion])
+
+	// A missing vector is embedded again without a new version
+	assert.NoError(t, store.Delete("d1"))
+	doc = NewTextDocument("d1", "second")
+	result, err = service.StoreDocument(store, docsDir, doc, false)
+	assert.NoError(t, err)
+	assert.Equal(t, DocumentReembedded, result)
+	assert.Equal(t, 2, doc.Version)
+
+	// JSON content hashes the same whatever the key order
+	a, _ := NewJSONDocument("j", map[string]interface{}{"a": 1, "b": 2}).ContentHash()
+	b, _ := NewJSONDocument("j", map[string]interface{}{"b": 2, "a": 1}).ContentHash()
+	assert.Equal(t, a, b)
+}
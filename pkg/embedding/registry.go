@@ -0,0 +1,358 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+const (
+	// ProviderHuggingFace is the built-in sentence-transformers provider
+	ProviderHuggingFace = "huggingface"
+
+	// ProviderCLIP is a remote CLIP-style API embedding texts and images
+	// into one vector space
+	ProviderCLIP = "clip"
+
+	// DefaultModelName is the logical name of the built-in default model
+	DefaultModelName = "minilm"
+)
+
+var (
+	// ErrModelNotFound is returned when a logical model name is not registered
+	ErrModelNotFound = errors.New("embedding model not found")
+
+	// ErrModelMismatch is returned when a query uses a different model than
+	// the one a collection was built with
+	ErrModelMismatch = errors.New("embedding model mismatch")
+)
+
+// ModelSpec describes how to instantiate a registered model
+type ModelSpec struct {
+	Provider  string // Model provider (default: huggingface)
+	Model     string // Provider-specific model identifier
+	MaxLength int    // Maximum input length in tokens
+	BatchSize int    // Most inputs sent to the provider in one call
+	Endpoint  string // API URL of remote providers such as ProviderCLIP
+	APIKey    string // Sent to remote providers as a bearer token when set
+	Dimension int    // Dimension of a remote model's vectors (default: models.DefaultCLIPDimension)
+
+	// Concurrency is the number of batches embedded at once (default:
+	// DefaultConcurrency)
+	Concurrency int
+
+	// Truncation is what happens to texts over MaxLength tokens:
+	// TruncationCut (default) or TruncationSplit
+	Truncation string
+
+	// CostPer1KTokens is the price of 1000 input tokens, used to estimate
+	// what embedding costs. Local models cost nothing.
+	CostPer1KTokens float64
+
+	// Retry controls the retries, timeout and circuit breaker of calls to
+	// the model
+	Retry RetryPolicy
+}
+
+// Registry maps logical model names to provider configurations and keeps
+// track of the default model of every collection
+type Registry struct {
+	mu           sync.Mutex
+	specs        map[string]ModelSpec
+	collections  map[string]string
+	routes       map[string]map[string]string // Collection -> language -> logical model
+	defaultModel string
+	services     map[string]*Service
+	metrics      *Metrics
+}
+
+// NewRegistry creates a registry containing the built-in default model
+func NewRegistry() *Registry {
+	defaults := DefaultConfig()
+	return &Registry{
+		specs: map[string]ModelSpec{
+			DefaultModelName: {
+				Provider:  ProviderHuggingFace,
+				Model:     defaults.ModelName,
+				MaxLength: defaults.ModelMaxLength,
+				BatchSize: defaults.ModelBatchSize,
+			},
+		},
+		collections:  make(map[string]string),
+		routes:       make(map[string]map[string]string),
+		defaultModel: DefaultModelName,
+		services:     make(map[string]*Service),
+		metrics:      NewMetrics(),
+	}
+}
+
+// Metrics returns the call metrics of all models of the registry
+func (r *Registry) Metrics() *Metrics {
+	return r.metrics
+}
+
+// Register adds or replaces a logical model
+func (r *Registry) Register(name string, spec ModelSpec) error {
+	if name == "" || spec.Model == "" {
+		return fmt.Errorf("model name and provider model are required")
+	}
+	if spec.Provider == "" {
+		spec.Provider = ProviderHuggingFace
+	}
+	switch spec.Provider {
+	case ProviderHuggingFace:
+	case ProviderCLIP:
+		if spec.Endpoint == "" {
+			return fmt.Errorf("%s models need an endpoint", ProviderCLIP)
+		}
+	default:
+		return fmt.Errorf("unsupported embedding provider: %s (use %s or %s)", spec.Provider, ProviderHuggingFace, ProviderCLIP)
+	}
+	if spec.Truncation != "" && spec.Truncation != TruncationCut && spec.Truncation != TruncationSplit {
+		return fmt.Errorf("unsupported truncation: %s (use %s or %s)", spec.Truncation, TruncationCut, TruncationSplit)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Drop a cached service built from an older spec
+	if service, ok := r.services[name]; ok {
+		service.Close()
+		delete(r.services, name)
+	}
+	r.specs[name] = spec
+	return nil
+}
+
+// SetDefault sets the model used by collections without an explicit binding
+func (r *Registry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.specs[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	r.defaultModel = name
+	return nil
+}
+
+// Default returns the logical name of the default model
+func (r *Registry) Default() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.defaultModel
+}
+
+// Bind sets the default model of a collection
+func (r *Registry) Bind(collection, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.specs[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	r.collections[collection] = name
+	return nil
+}
+
+// CollectionModel returns the logical model of a collection, falling back to
+// the registry default
+func (r *Registry) CollectionModel(collection string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if name, ok := r.collections[collection]; ok {
+		return name
+	}
+	return r.defaultModel
+}
+
+// Names returns the registered logical model names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Spec returns the configuration of a logical model
+func (r *Registry) Spec(name string) (ModelSpec, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spec, ok := r.specs[name]
+	return spec, ok
+}
+
+// resolveLocked maps a logical name or provider model identifier to a
+// logical name (caller must hold r.mu)
+func (r *Registry) resolveLocked(name string) (string, bool) {
+	if _, ok := r.specs[name]; ok {
+		return name, true
+	}
+	for logical, spec := range r.specs {
+		if strings.EqualFold(spec.Model, name) {
+			return logical, true
+		}
+	}
+	return "", false
+}
+
+// Resolve maps a logical name or provider model identifier to a logical name
+func (r *Registry) Resolve(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logical, ok := r.resolveLocked(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	return logical, nil
+}
+
+// Service returns the (cached) embedding service of a logical model
+func (r *Registry) Service(name string) (*Service, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logical, ok := r.resolveLocked(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+
+	if service, ok := r.services[logical]; ok {
+		return service, nil
+	}
+
+	spec := r.specs[logical]
+	service, err := NewService(&Config{
+		ModelName:       spec.Model,
+		ModelMaxLength:  spec.MaxLength,
+		ModelBatchSize:  spec.BatchSize,
+		Provider:        spec.Provider,
+		CostPer1KTokens: spec.CostPer1KTokens,
+		Retry:           spec.Retry,
+		Concurrency:     spec.Concurrency,
+		Truncation:      spec.Truncation,
+		Endpoint:        spec.Endpoint,
+		APIKey:          spec.APIKey,
+		Dimension:       spec.Dimension,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create model %s: %w", logical, err)
+	}
+	service.metrics = r.metrics
+
+	r.services[logical] = service
+	return service, nil
+}
+
+// ServiceForCollection returns the service of the collection's model. If a
+// model is requested explicitly it must be the collection's model or one of
+// its language routes.
+func (r *Registry) ServiceForCollection(collection, requested string) (*Service, error) {
+	model := r.CollectionModel(collection)
+
+	if requested != "" {
+		logical, err := r.Resolve(requested)
+		if err != nil {
+			return nil, err
+		}
+		routed := false
+		for _, name := range r.collectionModels(collection) {
+			routed = routed || name == logical
+		}
+		if !routed {
+			return nil, fmt.Errorf("%w: collection %s uses %s, not %s", ErrModelMismatch, collection, model, requested)
+		}
+		model = logical
+	}
+
+	return r.Service(model)
+}
+
+// ServiceForQuery returns the service that embeds a query of the collection:
+// the collection's model, or any registered model if one is requested. A
+// model other than the collection's and its language routes must make
+// vectors of the same dimension as the collection's model; the returned flag
+// reports that the query overrides the collection's model, so stored vectors
+// were embedded with another one.
+func (r *Registry) ServiceForQuery(collection, requested string) (*Service, bool, error) {
+	if requested == "" {
+		service, err := r.ServiceForCollection(collection, "")
+		return service, false, err
+	}
+	logical, err := r.Resolve(requested)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, name := range r.collectionModels(collection) {
+		if name == logical {
+			service, err := r.Service(logical)
+			return service, false, err
+		}
+	}
+
+	service, err := r.Service(logical)
+	if err != nil {
+		return nil, false, err
+	}
+	own, err := r.ServiceForCollection(collection, "")
+	if err != nil {
+		return nil, false, err
+	}
+	if service.Dimension() != own.Dimension() {
+		return nil, false, fmt.Errorf("%w: model %s makes %d-dimensional vectors, but collection %s uses %s with %d",
+			vector.ErrInvalidDimension, logical, service.Dimension(), collection, r.CollectionModel(collection), own.Dimension())
+	}
+	return service, true, nil
+}
+
+// CheckVector verifies that a stored vector was embedded with the
+// collection's model or one of its language routes. Vectors without model
+// metadata are accepted.
+func (r *Registry) CheckVector(collection string, v *vector.Vector) error {
+	recorded := v.Metadata[MetadataKeyModel]
+	if recorded == "" {
+		return nil
+	}
+
+	model := r.CollectionModel(collection)
+	spec, ok := r.Spec(model)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, model)
+	}
+	for _, name := range r.collectionModels(collection) {
+		if routed, ok := r.Spec(name); ok && strings.EqualFold(routed.Model, recorded) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: collection %s was built with %s, but its model is %s (%s)",
+		ErrModelMismatch, collection, recorded, model, spec.Model)
+}
+
+// Close releases all cached services
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for name, service := range r.services {
+		if err := service.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.services, name)
+	}
+	return firstErr
+}
@@ -0,0 +1,157 @@
+package embedding
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Close()
+
+	assert.NoError(t, registry.Register("mpnet", ModelSpec{Model: "sentence-transformers/all-mpnet-base-v2"}))
+	assert.Error(t, registry.Register("remote", ModelSpec{Provider: "unknown", Model: "x"}))
+	assert.Equal(t, []string{DefaultModelName, "mpnet"}, registry.Names())
+
+	// Unbound collections use the default model
+	assert.Equal(t, DefaultModelName, registry.CollectionModel("docs"))
+	assert.NoError(t, registry.Bind("docs", "mpnet"))
+	assert.Equal(t, "mpnet", registry.CollectionModel("docs"))
+	assert.True(t, errors.Is(registry.Bind("docs", "missing"), ErrModelNotFound))
+
+	// Logical names and provider identifiers both resolve
+	logical, err := registry.Resolve("sentence-transformers/all-mpnet-base-v2")
+	assert.NoError(t, err)
+	assert.Equal(t, "mpnet", logical)
+
+	// Services are cached per model
+	first, err := registry.ServiceForCollection("docs", "")
+	assert.NoError(t, err)
+	second, err := registry.Service("mpnet")
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Equal(t, "sentence-transformers/all-mpnet-base-v2", first.ModelName())
+
+	// Asking for another model than the collection's is an error
+	_, err = registry.ServiceForCollection("docs", DefaultModelName)
+	assert.True(t, errors.Is(err, ErrModelMismatch))
+
+	// Stored vectors are checked against the collection's model
+	v := vector.NewVector("v1", []float32{1, 2})
+	assert.NoError(t, registry.CheckVector("docs", v))
+	v.Metadata[MetadataKeyModel] = "sentence-transformers/all-mpnet-base-v2"
+	assert.NoError(t, registry.CheckVector("docs", v))
+	assert.True(t, errors.Is(registry.CheckVector("other", v), ErrModelMismatch))
+}
+
+func TestMetrics(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Close()
+	assert.NoError(t, registry.Register("paid", ModelSpec{Model: "paid-model", CostPer1KTokens: 0.5}))
+
+	service, err := registry.Service("paid")
+	assert.NoError(t, err)
+	assert.Same(t, registry.Metrics(), service.Metrics())
+
+	assert.NoError(t, service.ProcessDocument(NewTextDocument("a", "one two three four")))
+	assert.NoError(t, service.ProcessDocument(NewJSONDocument("b", map[string]interface{}{"k": "v"})))
+	assert.Error(t, service.ProcessDocument(&Document{ID: "c", ContentType: ContentTypeText, Content: 1}))
+
+	stats := registry.Metrics().Snapshot()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, ProviderHuggingFace, stats[0].Provider)
+		assert.Equal(t, "paid-model", stats[0].Model)
+		assert.Equal(t, int64(2), stats[0].Calls)
+		tokens := int64(EstimateTokens("one two three four") + EstimateTokens("k: v"))
+		assert.Equal(t, tokens, stats[0].Tokens)
+		assert.InDelta(t, float64(tokens)/1000*0.5, stats[0].Cost, 1e-9)
+	}
+
+	var sb strings.Builder
+	registry.Metrics().WritePrometheus(&sb)
+	assert.Contains(t, sb.String(), `vectodb_embedding_calls_total{provider="huggingface",model="paid-model"} 2`)
+	assert.Contains(t, sb.String(), `vectodb_embedding_failures_total{provider="huggingface",model="paid-model"} 0`)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens(""))
+	assert.Equal(t, 3, EstimateTokens("a b c"))
+	assert.Equal(t, 5, EstimateTokens("internationalization"))
+	assert.Equal(t, 3, EstimateTokens("don't"))
+}
+
+func TestRegistryRoutes(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Close()
+
+	assert.NoError(t, registry.Register("english", ModelSpec{Model: "sentence-transformers/all-MiniLM-L12-v2"}))
+	assert.NoError(t, registry.Register("multilingual", ModelSpec{Model: "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2"}))
+	assert.True(t, errors.Is(registry.Route("docs", "en", "missing"), ErrModelNotFound))
+	assert.Error(t, registry.Route("docs", "", "english"))
+
+	// Collections without routes detect no language
+	service, language, err := registry.ServiceForText("docs", "The index is rebuilt at night")
+	assert.NoError(t, err)
+	assert.Equal(t, "", language)
+	assert.Equal(t, "sentence-transformers/all-MiniLM-L6-v2", service.ModelName())
+
+	assert.NoError(t, registry.Route("docs", "EN", "english"))
+	assert.NoError(t, registry.Route("docs", AnyLanguage, "multilingual"))
+	assert.Equal(t, map[string]string{"en": "english", "*": "multilingual"}, registry.Routes("docs"))
+
+	cases := []struct{ text, language, model string }{
+		{"The index is rebuilt at night", "en", "sentence-transformers/all-MiniLM-L12-v2"},
+		{"L'index est reconstruit la nuit", "fr", "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2"},
+		{"vector database", "", "sentence-transformers/all-MiniLM-L6-v2"},
+	}
+	for _, c := range cases {
+		service, language, err := registry.ServiceForText("docs", c.text)
+		assert.NoError(t, err)
+		assert.Equal(t, c.language, language, c.text)
+		assert.Equal(t, c.model, service.ModelName(), c.text)
+	}
+
+	// Routed models may be requested and their vectors belong to the collection
+	_, err = registry.ServiceForCollection("docs", "multilingual")
+	assert.NoError(t, err)
+	v := vector.NewVector("v", []float32{1})
+	v.Metadata[MetadataKeyModel] = "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2"
+	assert.NoError(t, registry.CheckVector("docs", v))
+	assert.True(t, errors.Is(registry.CheckVector("other", v), ErrModelMismatch))
+}
+
+func TestRegistryQueryOverride(t *testing.T) {
+	registry := NewRegistry()
+	defer registry.Close()
+
+	assert.NoError(t, registry.Register("l12", ModelSpec{Model: "sentence-transformers/all-MiniLM-L12-v2"}))
+	assert.NoError(t, registry.Register("mpnet", ModelSpec{Model: "sentence-transformers/all-mpnet-base-v2"}))
+	assert.NoError(t, registry.Register("clip", ModelSpec{Provider: ProviderCLIP, Model: "clip-vit", Endpoint: "http://localhost", Dimension: 512}))
+
+	// Without a model the collection's is used
+	service, override, err := registry.ServiceForQuery("docs", "")
+	assert.NoError(t, err)
+	assert.False(t, override)
+	assert.Equal(t, "sentence-transformers/all-MiniLM-L6-v2", service.ModelName())
+
+	// Any model of the collection's dimension may embed its queries
+	service, override, err = registry.ServiceForQuery("docs", "l12")
+	assert.NoError(t, err)
+	assert.True(t, override)
+	assert.Equal(t, "sentence-transformers/all-MiniLM-L12-v2", service.ModelName())
+
+	_, _, err = registry.ServiceForQuery("docs", "clip")
+	assert.True(t, errors.Is(err, vector.ErrInvalidDimension))
+	_, _, err = registry.ServiceForQuery("docs", "missing")
+	assert.True(t, errors.Is(err, ErrModelNotFound))
+
+	// The collection's own model is no override
+	assert.NoError(t, registry.Bind("docs", "mpnet"))
+	_, override, err = registry.ServiceForQuery("docs", "sentence-transformers/all-mpnet-base-v2")
+	assert.NoError(t, err)
+	assert.False(t, override)
+}
@@ -0,0 +1,172 @@
+package embedding
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when a model call takes longer than the
+	// timeout of its retry policy
+	ErrTimeout = errors.New("embedding call timed out")
+
+	// ErrCircuitOpen is returned without calling the model while its
+	// circuit breaker is open after repeated failures
+	ErrCircuitOpen = errors.New("embedding circuit breaker open")
+)
+
+// RetryPolicy controls how a Service retries failed model calls. Zero fields
+// use the defaults of DefaultRetryPolicy; negative ones disable the feature.
+type RetryPolicy struct {
+	MaxRetries       int           // Retries after a failed attempt
+	InitialBackoff   time.Duration // Wait before the first retry, doubled for every further one
+	MaxBackoff       time.Duration // Longest wait between attempts
+	Timeout          time.Duration // Longest a single attempt may take
+	BreakerThreshold int           // Consecutive failed attempts that open the circuit
+	BreakerCooldown  time.Duration // How long an open circuit rejects calls before trying again
+}
+
+// DefaultRetryPolicy returns the policy used for unset fields
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:       3,
+		InitialBackoff:   200 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		Timeout:          time.Minute,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// withDefaults fills in the zero fields of p
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxRetries == 0 {
+		p.MaxRetries = defaults.MaxRetries
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = defaults.InitialBackoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = defaults.MaxBackoff
+	}
+	if p.Timeout == 0 {
+		p.Timeout = defaults.Timeout
+	}
+	if p.BreakerThreshold == 0 {
+		p.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if p.BreakerCooldown == 0 {
+		p.BreakerCooldown = defaults.BreakerCooldown
+	}
+	return p
+}
+
+// backoff returns the wait before the given retry, starting at 1
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := max(p.InitialBackoff, 0)
+	for i := 1; i < retry && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// breaker stops calling a model that keeps failing. After BreakerThreshold
+// consecutive failures calls are rejected for BreakerCooldown, then a single
+// call is let through: if it succeeds the circuit closes again, otherwise it
+// stays open for another cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow reports whether a call may be made now
+func (b *breaker) allow(policy RetryPolicy, now time.Time) error {
+	if policy.BreakerThreshold < 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < policy.BreakerThreshold {
+		return nil
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return fmt.Errorf("%w after %d failures", ErrCircuitOpen, b.failures)
+	}
+	b.probing = true
+	return nil
+}
+
+// done records the outcome of an allowed call
+func (b *breaker) done(policy RetryPolicy, now time.Time, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if policy.BreakerThreshold > 0 && b.failures >= policy.BreakerThreshold {
+		b.openUntil = now.Add(policy.BreakerCooldown)
+	}
+}
+
+// callWithRetry calls the model until it succeeds, the retries are used up or
+// the circuit opens, and returns the number of retries made
+func callWithRetry[T any](policy RetryPolicy, b *breaker, call func() (T, error)) (T, int, error) {
+	retries := 0
+	for {
+		if err := b.allow(policy, time.Now()); err != nil {
+			var zero T
+			return zero, retries, err
+		}
+		result, err := callWithTimeout(policy.Timeout, call)
+		b.done(policy, time.Now(), err)
+		if err == nil || retries >= policy.MaxRetries {
+			return result, retries, err
+		}
+
+		retries++
+		time.Sleep(policy.backoff(retries))
+	}
+}
+
+// callWithTimeout returns ErrTimeout if call does not return within timeout.
+// The model cannot be interrupted, so a call that timed out keeps running in
+// the background until it returns.
+func callWithTimeout[T any](timeout time.Duration, call func() (T, error)) (T, error) {
+	if timeout <= 0 {
+		return call()
+	}
+
+	type outcome struct {
+		result T
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := call()
+		done <- outcome{result, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-timer.C:
+		var zero T
+		return zero, fmt.Errorf("%w after %s", ErrTimeout, timeout)
+	}
+}
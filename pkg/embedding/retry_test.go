@@ -0,0 +1,104 @@
+package embedding
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyCall fails the first n calls and counts all of them
+func flakyCall(n int, calls *int) func() ([]float32, error) {
+	return func() ([]float32, error) {
+		*calls++
+		if *calls <= n {
+			return nil, errors.New("service unavailable")
+		}
+		return []float32{1}, nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	service, err := NewService(&Config{
+		ModelName: "flaky",
+		Retry:     RetryPolicy{MaxRetries: 2, InitialBackoff: time.Millisecond, BreakerThreshold: -1},
+	})
+	assert.NoError(t, err)
+
+	// Two failures are retried
+	calls := 0
+	vector, err := service.embed("text", flakyCall(2, &calls))
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1}, vector)
+	assert.Equal(t, 3, calls)
+
+	// Three are not
+	calls = 0
+	_, err = service.embed("text", flakyCall(3, &calls))
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+
+	stats := service.Metrics().Snapshot()
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, int64(2), stats[0].Calls)
+		assert.Equal(t, int64(1), stats[0].Failures)
+		assert.Equal(t, int64(4), stats[0].Retries)
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	service, err := NewService(&Config{
+		ModelName: "slow",
+		Retry:     RetryPolicy{MaxRetries: -1, Timeout: 10 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	release := make(chan struct{})
+	defer close(release)
+	_, err = service.embed("text", func() ([]float32, error) {
+		<-release
+		return []float32{1}, nil
+	})
+	assert.True(t, errors.Is(err, ErrTimeout), "got %v", err)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	service, err := NewService(&Config{
+		ModelName: "down",
+		Retry:     RetryPolicy{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: 20 * time.Millisecond},
+	})
+	assert.NoError(t, err)
+
+	// Two failures open the circuit, so the model is not called again
+	calls := 0
+	for i := 0; i < 2; i++ {
+		_, err := service.embed("text", flakyCall(10, &calls))
+		assert.Error(t, err)
+	}
+	_, err = service.embed("text", flakyCall(10, &calls))
+	assert.True(t, errors.Is(err, ErrCircuitOpen), "got %v", err)
+	assert.Equal(t, 2, calls)
+
+	// After the cooldown one call gets through and closes it again
+	time.Sleep(30 * time.Millisecond)
+	calls = 0
+	_, err = service.embed("text", flakyCall(0, &calls))
+	assert.NoError(t, err)
+	_, err = service.embed("text", flakyCall(0, &calls))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, want := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		50: time.Second,
+	} {
+		assert.Equal(t, want, policy.backoff(retry), "retry %d", retry)
+	}
+}
@@ -0,0 +1,111 @@
+package embedding
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/analysis"
+)
+
+const (
+	// MetadataKeyLanguage is the metadata key holding the language detected
+	// in the text of a document of a collection with language routes, as an
+	// ISO 639-1 code
+	MetadataKeyLanguage = "language"
+
+	// AnyLanguage is the language of a route taken by every detected
+	// language without a route of its own
+	AnyLanguage = "*"
+)
+
+// Route makes a collection embed texts in a language, an ISO 639-1 code such
+// as "en" or AnyLanguage, with a model. Texts whose language is not routed
+// or cannot be detected use the collection's model. Routed models should
+// have the collection's dimension, or the store adapt theirs.
+func (r *Registry) Route(collection, language, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.specs[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+	language = strings.ToLower(language)
+	if language == "" {
+		return fmt.Errorf("route of collection %s needs a language", collection)
+	}
+	if r.routes[collection] == nil {
+		r.routes[collection] = make(map[string]string)
+	}
+	r.routes[collection][language] = name
+	return nil
+}
+
+// Routes returns a copy of the language routes of a collection
+func (r *Registry) Routes(collection string) map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := make(map[string]string, len(r.routes[collection]))
+	for language, name := range r.routes[collection] {
+		routes[language] = name
+	}
+	return routes
+}
+
+// ServiceForText returns the service of the model a collection embeds text
+// with, and the language detected in text. Collections without routes use
+// their model and detect no language.
+func (r *Registry) ServiceForText(collection, text string) (*Service, string, error) {
+	routes := r.Routes(collection)
+	if len(routes) == 0 {
+		service, err := r.Service(r.CollectionModel(collection))
+		return service, "", err
+	}
+
+	language := analysis.DetectLanguage(text)
+	model, ok := routes[language]
+	if !ok && language != "" {
+		model, ok = routes[AnyLanguage]
+	}
+	if !ok {
+		model = r.CollectionModel(collection)
+	}
+	service, err := r.Service(model)
+	return service, language, err
+}
+
+// RouteFilter returns the metadata filter limiting a search of a collection
+// with language routes to the documents comparable with a query embedded by
+// service in language: those in the same language, or those of the same
+// model if the language is unknown. Collections without routes need none.
+func (r *Registry) RouteFilter(collection string, service *Service, language string) map[string]string {
+	switch {
+	case len(r.Routes(collection)) == 0:
+		return nil
+	case language != "":
+		return map[string]string{MetadataKeyLanguage: language}
+	default:
+		return map[string]string{MetadataKeyModel: service.ModelName()}
+	}
+}
+
+// Router picks the service a text is embedded with and returns the language
+// detected in it, if any
+type Router func(text string) (*Service, string, error)
+
+// Router returns the router of a collection, for EmbedDir and Watch
+func (r *Registry) Router(collection string) Router {
+	return func(text string) (*Service, string, error) {
+		return r.ServiceForText(collection, text)
+	}
+}
+
+// collectionModels returns the logical models a collection embeds with: its
+// own and those of its routes
+func (r *Registry) collectionModels(collection string) []string {
+	models := []string{r.CollectionModel(collection)}
+	for _, name := range r.Routes(collection) {
+		models = append(models, name)
+	}
+	return models
+}
@@ -3,7 +3,9 @@ package embedding
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 )
 
 // Service provides high-level embedding functionality for documents
@@ -11,6 +13,9 @@ type Service struct {
 	engine      *Engine
 	cacheMutex  sync.RWMutex
 	modelConfig *Config
+	metrics     *Metrics
+	retry       RetryPolicy
+	breaker     breaker
 }
 
 // NewService creates a new embedding service with the specified configuration
@@ -27,25 +32,227 @@ func NewService(config *Config) (*Service, error) {
 	return &Service{
 		engine:      engine,
 		modelConfig: config,
+		metrics:     NewMetrics(),
+		retry:       config.Retry.withDefaults(),
 	}, nil
 }
 
-// ProcessDocument generates vector embedding for a document
+// Metrics returns the call metrics of the service. Services of a registry
+// share the registry's metrics.
+func (s *Service) Metrics() *Metrics {
+	return s.metrics
+}
+
+// provider returns the provider of the service's model
+func (s *Service) provider() string {
+	if s.modelConfig.Provider == "" {
+		return ProviderHuggingFace
+	}
+	return s.modelConfig.Provider
+}
+
+// embed calls the model with the service's retry policy and records the
+// call in the service's metrics
+func (s *Service) embed(text string, call func() ([]float32, error)) ([]float32, error) {
+	return embedCall(s, s.countTokens(text), call)
+}
+
+// embedCall calls the model for a single input or a whole batch of the given
+// number of tokens with the service's retry policy and records the call
+func embedCall[T any](s *Service, tokens int, call func() (T, error)) (T, error) {
+	start := time.Now()
+	result, retries, err := callWithRetry(s.retry, &s.breaker, call)
+	cost := float64(tokens) / 1000 * s.modelConfig.CostPer1KTokens
+	s.metrics.record(s.provider(), s.engine.ModelName(), time.Since(start), tokens, cost, retries, err)
+	return result, err
+}
+
+// batchSize returns the most inputs sent to the model in one call
+func (s *Service) batchSize() int {
+	if s.modelConfig.ModelBatchSize > 0 {
+		return s.modelConfig.ModelBatchSize
+	}
+	return DefaultConfig().ModelBatchSize
+}
+
+// concurrency returns the most calls made to the model at once
+func (s *Service) concurrency() int {
+	if s.modelConfig.Concurrency > 0 {
+		return s.modelConfig.Concurrency
+	}
+	return DefaultConcurrency
+}
+
+// CountTokens returns the number of tokens the model reads for text
+func (s *Service) CountTokens(text string) int {
+	return s.countTokens(text)
+}
+
+// countTokens counts the tokens of text with the model's tokenizer
+func (s *Service) countTokens(text string) int {
+	return len(s.engine.Tokenizer().Tokenize(text))
+}
+
+// fitted is a text prepared for the model's maximum length
+type fitted struct {
+	pieces    []string // Inputs sent to the model; more than one if the text was split
+	tokens    int      // Tokens of the whole text
+	truncated bool     // Tokens past the maximum length were dropped
+}
+
+// fit applies the model's maximum length to text, cutting it or splitting
+// it into pieces that fit depending on the truncation strategy
+func (s *Service) fit(text string) fitted {
+	spans := s.engine.Tokenizer().Tokenize(text)
+	limit := s.modelConfig.ModelMaxLength
+	if limit <= 0 || len(spans) <= limit {
+		return fitted{pieces: []string{text}, tokens: len(spans)}
+	}
+
+	if s.modelConfig.Truncation != TruncationSplit {
+		return fitted{pieces: []string{text[:spans[limit-1].End]}, tokens: len(spans), truncated: true}
+	}
+	var pieces []string
+	for i := 0; i < len(spans); i += limit {
+		last := min(i+limit, len(spans)) - 1
+		pieces = append(pieces, text[spans[i].Start:spans[last].End])
+	}
+	return fitted{pieces: pieces, tokens: len(spans)}
+}
+
+// sentTokens returns the number of tokens sent to the model for f
+func (s *Service) sentTokens(f fitted) int {
+	if f.truncated {
+		return s.modelConfig.ModelMaxLength
+	}
+	return f.tokens
+}
+
+// embedFitted embeds a text prepared by fit. The vectors of split texts are
+// averaged.
+func (s *Service) embedFitted(f fitted) ([]float32, error) {
+	if len(f.pieces) == 1 {
+		return embedCall(s, s.sentTokens(f), func() ([]float32, error) { return s.engine.EmbedText(f.pieces[0]) })
+	}
+
+	vectors, err := embedCall(s, f.tokens, func() ([][]float32, error) { return s.engine.EmbedBatch(f.pieces) })
+	if err != nil {
+		return nil, err
+	}
+	return meanVector(vectors), nil
+}
+
+// embedGroup embeds texts with one call for all that fit the model as they
+// are or cut, and separate calls for texts that are split
+func (s *Service) embedGroup(texts []string) ([][]float32, []fitted, error) {
+	vectors := make([][]float32, len(texts))
+	fits := make([]fitted, len(texts))
+	var batch []string
+	var batchIndex []int
+	tokens := 0
+	for i, text := range texts {
+		fits[i] = s.fit(text)
+		if len(fits[i].pieces) > 1 {
+			vector, err := s.embedFitted(fits[i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to embed text %d: %w", i, err)
+			}
+			vectors[i] = vector
+			continue
+		}
+		batch = append(batch, fits[i].pieces[0])
+		batchIndex = append(batchIndex, i)
+		tokens += s.sentTokens(fits[i])
+	}
+	if len(batch) == 0 {
+		return vectors, fits, nil
+	}
+
+	embedded, err := embedCall(s, tokens, func() ([][]float32, error) { return s.engine.EmbedBatch(batch) })
+	if err != nil {
+		return nil, nil, err
+	}
+	for j, i := range batchIndex {
+		vectors[i] = embedded[j]
+	}
+	return vectors, fits, nil
+}
+
+// meanVector returns the normalized mean of vectors
+func meanVector(vectors [][]float32) []float32 {
+	mean := make([]float32, len(vectors[0]))
+	for _, v := range vectors {
+		for i, x := range v {
+			mean[i] += x
+		}
+	}
+	var norm float64
+	for _, x := range mean {
+		norm += float64(x) * float64(x)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range mean {
+			mean[i] *= scale
+		}
+	}
+	return mean
+}
+
+// EmbedTexts embeds texts in batches of the model's batch size, running
+// several batches at once. Texts over the model's maximum length are cut or
+// split. The vectors are returned in the order of texts.
+func (s *Service) EmbedTexts(texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	err := forEachBatch(len(texts), s.batchSize(), s.concurrency(), func(start, end int) error {
+		embedded, _, err := s.embedGroup(texts[start:end])
+		if err != nil {
+			return fmt.Errorf("failed to embed texts %d to %d: %w", start, end-1, err)
+		}
+		copy(vectors[start:end], embedded)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
+
+// ProcessDocument generates vector embedding for a document. Texts over the
+// model's maximum length are cut or split, and the document's metadata
+// records its token count.
 func (s *Service) ProcessDocument(doc *Document) error {
 	if doc == nil {
 		return fmt.Errorf("document is nil")
 	}
+	if doc.ContentType == ContentTypeImage {
+		return s.processImage(doc)
+	}
 
-	var vector []float32
-	var err error
+	text, err := s.documentText(doc)
+	if err != nil {
+		return err
+	}
 
+	f := s.fit(text)
+	vector, err := s.embedFitted(f)
+	if err != nil {
+		return fmt.Errorf("failed to embed document content: %w", err)
+	}
+
+	s.setVector(doc, vector, f)
+	return nil
+}
+
+// documentText returns the text the model embeds for a document
+func (s *Service) documentText(doc *Document) (string, error) {
 	switch doc.ContentType {
 	case ContentTypeText:
 		content, ok := doc.Content.(string)
 		if !ok {
-			return fmt.Errorf("content is not a string for text document")
+			return "", fmt.Errorf("content is not a string for text document")
 		}
-		vector, err = s.engine.EmbedText(content)
+		return s.engine.Prepare(content, "text")
 	case ContentTypeJSON:
 		content, ok := doc.Content.(map[string]interface{})
 		if !ok {
@@ -53,39 +260,78 @@ func (s *Service) ProcessDocument(doc *Document) error {
 			if jsonStr, ok := doc.Content.(string); ok {
 				var jsonMap map[string]interface{}
 				if err := json.Unmarshal([]byte(jsonStr), &jsonMap); err != nil {
-					return fmt.Errorf("failed to parse JSON content: %w", err)
+					return "", fmt.Errorf("failed to parse JSON content: %w", err)
 				}
 				doc.Content = jsonMap
 				content = jsonMap
 			} else {
-				return fmt.Errorf("content is not a JSON object for JSON document")
+				return "", fmt.Errorf("content is not a JSON object for JSON document")
 			}
 		}
-		vector, err = s.engine.EmbedJSON(content)
+		return s.engine.Prepare(content, "json")
+	case ContentTypeImage:
+		return "", fmt.Errorf("image documents have no text")
 	default:
-		return fmt.Errorf("unsupported content type: %s", doc.ContentType)
-	}
-
-	if err != nil {
-		return fmt.Errorf("failed to embed document content: %w", err)
+		return "", fmt.Errorf("unsupported content type: %s", doc.ContentType)
 	}
+}
 
+// setVector stores an embedding, the model that produced it and the token
+// count of the text on doc
+func (s *Service) setVector(doc *Document, vector []float32, f fitted) {
 	doc.Vector = vector
-	doc.SetMetadata("embedding_model", s.engine.ModelName())
+	doc.SetMetadata(MetadataKeyModel, s.engine.ModelName())
 	doc.SetMetadata("vector_dimension", s.engine.ModelDimension())
-
-	return nil
+	doc.SetMetadata(MetadataKeyTokens, f.tokens)
+	if f.truncated {
+		doc.SetMetadata(MetadataKeyTruncated, true)
+	}
 }
 
-// ProcessDocuments generates vector embeddings for multiple documents
+// ProcessDocuments generates vector embeddings for multiple documents.
+// Documents are embedded in batches like EmbedTexts, with several batches
+// running at once. Images are embedded one at a time.
 func (s *Service) ProcessDocuments(docs []*Document) error {
-	for i, doc := range docs {
-		err := s.ProcessDocument(doc)
+	return forEachBatch(len(docs), s.batchSize(), s.concurrency(), func(start, end int) error {
+		texts := make([]string, 0, end-start)
+		textDocs := make([]*Document, 0, end-start)
+		for i := start; i < end; i++ {
+			if docs[i] == nil {
+				return fmt.Errorf("failed to process document at index %d: document is nil", i)
+			}
+			if docs[i].ContentType == ContentTypeImage {
+				if err := s.processImage(docs[i]); err != nil {
+					return fmt.Errorf("failed to process document at index %d: %w", i, err)
+				}
+				continue
+			}
+			text, err := s.documentText(docs[i])
+			if err != nil {
+				return fmt.Errorf("failed to process document at index %d: %w", i, err)
+			}
+			texts = append(texts, text)
+			textDocs = append(textDocs, docs[i])
+		}
+
+		vectors, fits, err := s.embedGroup(texts)
 		if err != nil {
-			return fmt.Errorf("failed to process document at index %d: %w", i, err)
+			return fmt.Errorf("failed to process documents %d to %d: %w", start, end-1, err)
 		}
-	}
-	return nil
+		for i, doc := range textDocs {
+			s.setVector(doc, vectors[i], fits[i])
+		}
+		return nil
+	})
+}
+
+// ModelName returns the name of the model used by the service
+func (s *Service) ModelName() string {
+	return s.engine.ModelName()
+}
+
+// Dimension returns the dimension of the vectors the service's model makes
+func (s *Service) Dimension() int {
+	return s.engine.ModelDimension()
 }
 
 // Close releases resources used by the service
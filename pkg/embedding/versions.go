@@ -0,0 +1,161 @@
+package embedding
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// MetadataKeyContentHash is the vector metadata key holding the content
+	// hash of the document the vector was embedded from
+	MetadataKeyContentHash = "content_hash"
+
+	// MetadataKeyVersion is the vector metadata key holding the version of
+	// the document the vector was embedded from
+	MetadataKeyVersion = "doc_version"
+)
+
+// DocumentVersion records an earlier version of a document
+type DocumentVersion struct {
+	Version     int       `json:"version"`
+	ContentHash string    `json:"content_hash"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// StoreResult says what StoreDocument did
+type StoreResult string
+
+const (
+	// DocumentCreated means the document was embedded for the first time
+	DocumentCreated StoreResult = "created"
+
+	// DocumentUpdated means the content changed and a new version was stored
+	DocumentUpdated StoreResult = "updated"
+
+	// DocumentReembedded means the content did not change but the vector was
+	// missing, from another model or re-embedding was forced
+	DocumentReembedded StoreResult = "reembedded"
+
+	// DocumentUnchanged means the content and its vector were current, so
+	// nothing was embedded
+	DocumentUnchanged StoreResult = "unchanged"
+)
+
+// ContentHash returns a hash of the document's content type and content.
+// JSON objects hash the same whatever the order of their keys, and image
+// documents hash their image too, so a changed file is a new version.
+func (d *Document) ContentHash() (string, error) {
+	content, err := json.Marshal(d.Content)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash document %s: %w", d.ID, err)
+	}
+	sum := sha256.New()
+	sum.Write([]byte(d.ContentType))
+	sum.Write([]byte{0})
+	sum.Write(content)
+	if d.image != nil {
+		sum.Write([]byte{0})
+		sum.Write(d.image)
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// StoreDocument embeds a document and stores its vector in store and the
+// document in docsDir. If a document with the same ID and content is
+// stored already and its vector is current, nothing is embedded unless
+// force is set. Changed content becomes a new version of the document, and
+// the versions it replaces are listed in its history.
+//
+// The vector is written before the document, and records the content hash,
+// so a document write that fails is detected as a change and redone by the
+// next call.
+func (s *Service) StoreDocument(store storage.VectorStore, docsDir string, doc *Document, force bool) (StoreResult, error) {
+	hash, err := doc.ContentHash()
+	if err != nil {
+		return "", err
+	}
+
+	prev, err := LoadDocument(docsDir, doc.ID)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	result := DocumentCreated
+	doc.Hash, doc.Version = hash, 1
+	if prev != nil {
+		doc.CreatedAt = prev.CreatedAt
+		doc.History = prev.History
+		doc.Version = max(prev.Version, 1)
+
+		// Documents stored before hashes were recorded are hashed now
+		prevHash := prev.Hash
+		if prevHash == "" {
+			if prevHash, err = prev.ContentHash(); err != nil {
+				return "", err
+			}
+		}
+
+		switch {
+		case prevHash != hash:
+			result = DocumentUpdated
+			doc.History = append(doc.History, DocumentVersion{Version: doc.Version, ContentHash: prevHash, UpdatedAt: prev.UpdatedAt})
+			doc.Version++
+		case !force && s.vectorCurrent(store, doc.ID, hash):
+			*doc = *prev
+			doc.Hash = hash
+			return DocumentUnchanged, nil
+		default:
+			result = DocumentReembedded
+		}
+	}
+
+	if err := s.ProcessDocument(doc); err != nil {
+		return "", err
+	}
+
+	// String metadata of the document is copied so it can be filtered on
+	v := vector.NewVector(doc.ID, doc.Vector)
+	for key, value := range doc.Metadata {
+		if text, ok := value.(string); ok {
+			v.Metadata[key] = text
+		}
+	}
+	v.Metadata[MetadataKeyModel] = s.ModelName()
+	v.Metadata[MetadataKeyContentHash] = hash
+	v.Metadata[MetadataKeyVersion] = strconv.Itoa(doc.Version)
+	err = store.Insert(v)
+	if errors.Is(err, storage.ErrVectorAlreadyExists) {
+		err = store.Update(v)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to store vector %s: %w", doc.ID, err)
+	}
+
+	if err := saveDocument(docsDir, doc); err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+// vectorCurrent reports whether the stored vector of a document was
+// embedded from content with the given hash by the service's model
+func (s *Service) vectorCurrent(store storage.VectorStore, id, hash string) bool {
+	v, err := storage.GetMeta(store, id)
+	if err != nil {
+		return false
+	}
+	// Vectors from before content hashes were recorded only match by model
+	if recorded, ok := v.Metadata[MetadataKeyContentHash]; ok && recorded != hash {
+		return false
+	}
+	return v.Metadata[MetadataKeyModel] == s.ModelName()
+}
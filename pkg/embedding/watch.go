@@ -0,0 +1,225 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ken/vector_database/pkg/embedding/pipeline"
+	"github.com/ken/vector_database/pkg/fileutil"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// DefaultWatchDebounce is how long Watch waits after the last change to a
+// file before embedding it, so a file saved in several writes is embedded once
+const DefaultWatchDebounce = 500 * time.Millisecond
+
+// WatchOptions controls how Watch keeps a collection in sync with a directory
+type WatchOptions struct {
+	Glob      string                    // Pattern file names must match, e.g. "*.md" (default: all files)
+	ChunkSize int                       // Maximum tokens per chunk; 0 embeds whole files
+	Route     Router                    // Picks the model of every chunk by its language (default: the service's)
+	Binary    *pipeline.BinaryProcessor // Extracts the text of files that are not UTF-8 (default: they are skipped)
+	Debounce  time.Duration             // Quiet time before changes are applied (default: DefaultWatchDebounce)
+	Synced    func(stats *DirStats)     // Called after the initial sync (optional)
+	Changed   func(event WatchEvent)    // Called for every file changed or removed (optional)
+}
+
+// WatchEvent describes what Watch did about a changed file
+type WatchEvent struct {
+	Path      string // Path relative to the watched directory
+	Embedded  int    // Chunks embedded
+	Unchanged int    // Chunks whose content and vector were current
+	Removed   int    // Chunks removed, all of them if the file was deleted
+	Err       error  // Why the file could not be synced
+}
+
+// Watch keeps the vectors and documents of the files below root in sync
+// with the directory until ctx is done. It embeds the directory like
+// EmbedDir, then embeds files as they are created or modified and removes
+// the vectors of files that are deleted or renamed away.
+//
+// Files deleted while Watch is not running keep their vectors, since the
+// collection may hold files of other directories too.
+func (s *Service) Watch(ctx context.Context, store storage.VectorStore, docsDir, root string, options *WatchOptions) error {
+	opts := WatchOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = DefaultWatchDebounce
+	}
+	dirOpts := &DirOptions{Glob: opts.Glob, ChunkSize: opts.ChunkSize, Route: opts.Route, Binary: opts.Binary}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch %s: %w", root, err)
+	}
+	defer watcher.Close()
+
+	// Directories are watched before the initial sync, so no change made
+	// during it is missed
+	if err := watchTree(watcher, root); err != nil {
+		return err
+	}
+	stats, err := s.EmbedDir(store, docsDir, root, dirOpts)
+	if err != nil {
+		return err
+	}
+	if opts.Synced != nil {
+		opts.Synced(stats)
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(opts.Debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			if opts.Changed != nil {
+				opts.Changed(WatchEvent{Err: err})
+			}
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			rel, err := filepath.Rel(root, event.Name)
+			if err != nil || rel == "." || hiddenPath(rel) || fileutil.IsTemp(filepath.Base(rel)) {
+				continue
+			}
+
+			// Files created in a new directory before it was watched are
+			// found by walking it
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if event.Has(fsnotify.Create) {
+					if err := watchTree(watcher, event.Name); err != nil && opts.Changed != nil {
+						opts.Changed(WatchEvent{Path: filepath.ToSlash(rel), Err: err})
+					}
+					files, _ := findFiles(event.Name, opts.Glob)
+					for _, file := range files {
+						pending[filepath.ToSlash(rel)+"/"+file] = true
+					}
+				}
+			} else {
+				pending[filepath.ToSlash(rel)] = true
+			}
+			timer.Reset(opts.Debounce)
+
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for rel := range pending {
+				paths = append(paths, rel)
+			}
+			sort.Strings(paths)
+			for _, rel := range paths {
+				delete(pending, rel)
+				event, ok := s.syncPath(store, docsDir, root, rel, dirOpts)
+				if ok && opts.Changed != nil {
+					opts.Changed(event)
+				}
+			}
+		}
+	}
+}
+
+// watchTree adds dir and the directories below it to watcher, skipping
+// hidden ones
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if p != dir && hidden(entry.Name()) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+		return nil
+	})
+}
+
+// syncPath embeds the file at rel, or removes its vectors if it is gone. A
+// removed directory takes the vectors of all files below it along. It
+// returns false if there was nothing to do.
+func (s *Service) syncPath(store storage.VectorStore, docsDir, root, rel string, opts *DirOptions) (WatchEvent, bool) {
+	event := WatchEvent{Path: rel}
+	info, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+	switch {
+	case err == nil && info.Mode().IsRegular():
+		if !matchGlob(opts.Glob, filepath.Base(rel)) {
+			return event, false
+		}
+		stats, err := s.embedFile(store, docsDir, root, rel, opts)
+		event.Embedded, event.Unchanged, event.Removed, event.Err = stats.Embedded, stats.Unchanged, stats.Removed, err
+		return event, stats.Skipped == 0 || err != nil
+	case err == nil:
+		return event, false
+	case !errors.Is(err, os.ErrNotExist):
+		event.Err = err
+		return event, true
+	}
+
+	event.Removed, event.Err = removeFiles(store, docsDir, rel)
+	return event, event.Removed > 0 || event.Err != nil
+}
+
+// removeFiles deletes the vectors and documents of the file at rel, or of
+// the files below it if it was a directory
+func removeFiles(store storage.VectorStore, docsDir, rel string) (int, error) {
+	removed, err := removeStaleChunks(store, docsDir, rel, nil)
+	if err != nil {
+		return removed, err
+	}
+
+	ids, err := storage.ListPrefix(store, rel+"/")
+	if err != nil {
+		return removed, err
+	}
+	files := make(map[string]bool)
+	for _, id := range ids {
+		// Only vectors embedded from files, not IDs that look like paths
+		if v, err := storage.GetMeta(store, id); err == nil && strings.HasPrefix(v.Metadata[MetadataKeyPath], rel+"/") {
+			files[v.Metadata[MetadataKeyPath]] = true
+		}
+	}
+	for file := range files {
+		n, err := removeStaleChunks(store, docsDir, file, nil)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// hiddenPath reports whether a slash- or separator-separated relative path
+// is inside a hidden directory or names a hidden file
+func hiddenPath(rel string) bool {
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if hidden(name) {
+			return true
+		}
+	}
+	return false
+}
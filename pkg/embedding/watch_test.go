@@ -0,0 +1,74 @@
+package embedding
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatch(t *testing.T) {
+	service, err := NewService(nil)
+	assert.NoError(t, err)
+	store := storage.NewMemoryStore()
+	root := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.md"), []byte("old"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	synced := make(chan struct{})
+	events := make(chan WatchEvent, 16)
+	done := make(chan error)
+	go func() {
+		done <- service.Watch(ctx, store, t.TempDir(), root, &WatchOptions{
+			Glob:     "*.md",
+			Debounce: 10 * time.Millisecond,
+			Synced:   func(*DirStats) { close(synced) },
+			Changed:  func(event WatchEvent) { events <- event },
+		})
+	}()
+	<-synced
+
+	next := func() WatchEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no change seen")
+			return WatchEvent{}
+		}
+	}
+	ids := func() []string {
+		ids, _ := store.List()
+		return ids
+	}
+	assert.Equal(t, []string{"a.md"}, ids())
+
+	// Files created in new directories are embedded
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "sub", "b.md"), []byte("new"), 0644))
+	event := next()
+	assert.Equal(t, "sub/b.md", event.Path)
+	assert.Equal(t, 1, event.Embedded)
+	assert.ElementsMatch(t, []string{"a.md", "sub/b.md"}, ids())
+
+	// Modified files are embedded again, removed ones deleted
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "a.md"), []byte("changed"), 0644))
+	event = next()
+	assert.Equal(t, "a.md", event.Path)
+	assert.Equal(t, 1, event.Embedded)
+	v, err := store.Get("a.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", v.Metadata[MetadataKeyVersion])
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(root, "sub")))
+	event = next()
+	assert.Equal(t, 1, event.Removed)
+	assert.Equal(t, []string{"a.md"}, ids())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
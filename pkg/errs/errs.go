@@ -0,0 +1,213 @@
+// Package errs classifies VectoDB errors by code, so callers can tell a
+// missing vector from a bad argument without matching messages, and servers
+// can answer with the matching HTTP or gRPC status. Packages keep their
+// sentinel errors, but create them with New, and wrap them with %w as
+// before:
+//
+//	var ErrVectorNotFound = errs.New(errs.NotFound, "vector not found")
+//
+//	if errors.Is(err, errs.NotFound) { ... } // Any error with the code
+//	status := errs.CodeOf(err).HTTPStatus()
+package errs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Code classifies an error. Codes are errors themselves, so errors.Is(err,
+// errs.NotFound) reports whether err has the code.
+type Code int
+
+// Error codes
+const (
+	// OK is the code of a nil error
+	OK Code = iota
+
+	// Unknown is the code of errors without one
+	Unknown
+
+	// NotFound means a vector, collection or other named thing does not exist
+	NotFound
+
+	// AlreadyExists means a write would replace something that exists
+	AlreadyExists
+
+	// InvalidArgument means the request is malformed, whatever the state
+	InvalidArgument
+
+	// DimensionMismatch means vectors of different dimensions were combined
+	DimensionMismatch
+
+	// FailedPrecondition means the request is valid but the state forbids it,
+	// e.g. a DROP without CONFIRM or an index built with another metric
+	FailedPrecondition
+
+	// PermissionDenied means the configuration forbids the operation
+	PermissionDenied
+
+	// ResourceExhausted means a quota was reached
+	ResourceExhausted
+
+	// Unimplemented means the operation is not supported
+	Unimplemented
+
+	// Aborted means a concurrent change interrupted the operation, which can
+	// be retried
+	Aborted
+
+	// DataLoss means stored data is corrupt
+	DataLoss
+
+	// Canceled means the caller canceled the operation
+	Canceled
+
+	// DeadlineExceeded means the operation's deadline passed
+	DeadlineExceeded
+)
+
+// codeNames are the names of the codes, as in JSON error responses
+var codeNames = map[Code]string{
+	OK:                 "ok",
+	Unknown:            "unknown",
+	NotFound:           "not_found",
+	AlreadyExists:      "already_exists",
+	InvalidArgument:    "invalid_argument",
+	DimensionMismatch:  "dimension_mismatch",
+	FailedPrecondition: "failed_precondition",
+	PermissionDenied:   "permission_denied",
+	ResourceExhausted:  "resource_exhausted",
+	Unimplemented:      "unimplemented",
+	Aborted:            "aborted",
+	DataLoss:           "data_loss",
+	Canceled:           "canceled",
+	DeadlineExceeded:   "deadline_exceeded",
+}
+
+// String returns the name of the code, such as not_found
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return codeNames[Unknown]
+}
+
+// Error implements error, so codes can be the target of errors.Is
+func (c Code) Error() string {
+	return c.String()
+}
+
+// HTTPStatus returns the HTTP status of errors with the code. Quotas answer
+// 403 rather than 429: retrying does not help until data is deleted.
+func (c Code) HTTPStatus() int {
+	switch c {
+	case OK:
+		return http.StatusOK
+	case NotFound:
+		return http.StatusNotFound
+	case AlreadyExists, Aborted:
+		return http.StatusConflict
+	case InvalidArgument, DimensionMismatch, FailedPrecondition:
+		return http.StatusBadRequest
+	case PermissionDenied, ResourceExhausted:
+		return http.StatusForbidden
+	case Unimplemented:
+		return http.StatusNotImplemented
+	case Canceled:
+		return 499 // Client Closed Request, as used by nginx and gRPC gateways
+	case DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GRPCCode returns the gRPC status code of errors with the code, as the
+// value of google.golang.org/grpc/codes.Code
+func (c Code) GRPCCode() uint32 {
+	switch c {
+	case OK:
+		return 0
+	case Canceled:
+		return 1
+	case InvalidArgument, DimensionMismatch:
+		return 3
+	case DeadlineExceeded:
+		return 4
+	case NotFound:
+		return 5
+	case AlreadyExists:
+		return 6
+	case PermissionDenied:
+		return 7
+	case ResourceExhausted:
+		return 8
+	case FailedPrecondition:
+		return 9
+	case Aborted:
+		return 10
+	case Unimplemented:
+		return 12
+	case DataLoss:
+		return 15
+	default:
+		return 2
+	}
+}
+
+// Error is an error with a code
+type Error struct {
+	code Code
+	msg  string
+}
+
+// New returns an *Error with a code and message, for use as a sentinel
+func New(code Code, msg string) error {
+	return &Error{code: code, msg: msg}
+}
+
+// Error returns the message
+func (e *Error) Error() string {
+	return e.msg
+}
+
+// Code returns the code of the error
+func (e *Error) Code() Code {
+	return e.code
+}
+
+// Is reports whether target is the error's code
+func (e *Error) Is(target error) bool {
+	code, ok := target.(Code)
+	return ok && code == e.code
+}
+
+// CodeOf returns the code of the first error with one in err's chain. Context
+// errors are Canceled and DeadlineExceeded, errors without a code Unknown.
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	}
+	return Unknown
+}
+
+// Errors shared by the stores and indexes, which export them under their
+// own names
+var (
+	// ErrVectorNotFound is returned when a vector with the specified ID is not found
+	ErrVectorNotFound = New(NotFound, "vector not found")
+
+	// ErrVectorAlreadyExists is returned when inserting a vector with an ID that already exists
+	ErrVectorAlreadyExists = New(AlreadyExists, "vector already exists")
+)
@@ -0,0 +1,68 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCodeOf(t *testing.T) {
+	errMissing := New(NotFound, "thing not found")
+	wrapped := fmt.Errorf("loading config: %w", fmt.Errorf("%w: a", errMissing))
+
+	for _, test := range []struct {
+		err  error
+		want Code
+	}{
+		{nil, OK},
+		{errors.New("plain"), Unknown},
+		{errMissing, NotFound},
+		{wrapped, NotFound},
+		{fmt.Errorf("%w: 3 != 4", ErrVectorAlreadyExists), AlreadyExists},
+		{fmt.Errorf("query: %w", context.Canceled), Canceled},
+		{context.DeadlineExceeded, DeadlineExceeded},
+	} {
+		if got := CodeOf(test.err); got != test.want {
+			t.Errorf("CodeOf(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+
+	if !errors.Is(wrapped, NotFound) || errors.Is(wrapped, AlreadyExists) {
+		t.Error("Expected errors.Is to match the code of the error only")
+	}
+	if !errors.Is(wrapped, errMissing) {
+		t.Error("Expected errors.Is to still match the sentinel")
+	}
+	if wrapped.Error() != "loading config: thing not found: a" {
+		t.Errorf("Expected the message to be unchanged, got %q", wrapped.Error())
+	}
+}
+
+func TestStatusCodes(t *testing.T) {
+	for _, test := range []struct {
+		code Code
+		http int
+		grpc uint32
+	}{
+		{OK, http.StatusOK, 0},
+		{Unknown, http.StatusInternalServerError, 2},
+		{NotFound, http.StatusNotFound, 5},
+		{AlreadyExists, http.StatusConflict, 6},
+		{InvalidArgument, http.StatusBadRequest, 3},
+		{DimensionMismatch, http.StatusBadRequest, 3},
+		{ResourceExhausted, http.StatusForbidden, 8},
+		{DataLoss, http.StatusInternalServerError, 15},
+	} {
+		if got := test.code.HTTPStatus(); got != test.http {
+			t.Errorf("%s: HTTP status %d, want %d", test.code, got, test.http)
+		}
+		if got := test.code.GRPCCode(); got != test.grpc {
+			t.Errorf("%s: gRPC code %d, want %d", test.code, got, test.grpc)
+		}
+	}
+	if Code(99).String() != "unknown" {
+		t.Errorf("Expected undefined codes to be unknown, got %s", Code(99))
+	}
+}
@@ -0,0 +1,87 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "v1.vec")
+
+	if err := WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := WriteFile(path, []byte("new"), 0600); err != nil {
+		t.Fatalf("Failed to replace file: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(data) != "new" {
+		t.Errorf("Expected %q, got %q", "new", data)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected 1 file, got %v", entries)
+	}
+
+	// Windows only knows read-only files
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+		}
+	}
+}
+
+func TestWriteFileFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "v1.vec")
+	if err := WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// A directory in the way fails the rename and keeps it in place
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := WriteFile(blocked, []byte("new"), 0644); err == nil {
+		t.Error("Expected an error when replacing a directory")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if IsTemp(entry.Name()) {
+			t.Errorf("Temporary file %s was left behind", entry.Name())
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "old" {
+		t.Errorf("Expected the existing file to be untouched, got %q", data)
+	}
+}
+
+func TestIsTemp(t *testing.T) {
+	tests := map[string]bool{
+		".v1.vec.123.tmp":                     true,
+		filepath.Join("dir", ".v1.vec.1.tmp"): true,
+		"v1.vec":                              false,
+		"v1.tmp":                              false,
+		".hidden":                             false,
+	}
+	for name, want := range tests {
+		if got := IsTemp(name); got != want {
+			t.Errorf("IsTemp(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package index
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Payloads of index files of format version 2 are written with Encoder:
+// fields follow each other in the order the record writes them, with no
+// names or type information. Integers are little-endian and fixed-size, so
+// files are the same on every architecture; strings, byte slices and
+// slices are prefixed with their length as a uint32; maps are written as a
+// count and their entries in key order, so the same index always gives the
+// same bytes.
+
+// PayloadEncoder is implemented by payload records that WriteFile can write
+type PayloadEncoder interface {
+	// EncodePayload writes the record's fields
+	EncodePayload(e *Encoder)
+}
+
+// PayloadDecoder is implemented by payload records that DecodePayload can
+// read from files of format version 2
+type PayloadDecoder interface {
+	// DecodePayload reads the fields EncodePayload writes. Errors are kept
+	// by the decoder.
+	DecodePayload(d *Decoder)
+}
+
+// Encoder writes the fields of a payload
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded payload
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+// Len returns the number of bytes written
+func (e *Encoder) Len() int {
+	return len(e.buf)
+}
+
+// Raw writes bytes as they are, such as a section encoded separately
+func (e *Encoder) Raw(b []byte) {
+	e.buf = append(e.buf, b...)
+}
+
+// Bool writes a bool as one byte
+func (e *Encoder) Bool(v bool) {
+	if v {
+		e.buf = append(e.buf, 1)
+	} else {
+		e.buf = append(e.buf, 0)
+	}
+}
+
+// Uint32 writes a uint32
+func (e *Encoder) Uint32(v uint32) {
+	e.buf = binary.LittleEndian.AppendUint32(e.buf, v)
+}
+
+// Uint64 writes a uint64
+func (e *Encoder) Uint64(v uint64) {
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, v)
+}
+
+// Int writes an int as an int64
+func (e *Encoder) Int(v int) {
+	e.Uint64(uint64(int64(v)))
+}
+
+// Int64 writes an int64
+func (e *Encoder) Int64(v int64) {
+	e.Uint64(uint64(v))
+}
+
+// Float32 writes a float32
+func (e *Encoder) Float32(v float32) {
+	e.Uint32(math.Float32bits(v))
+}
+
+// Float64 writes a float64
+func (e *Encoder) Float64(v float64) {
+	e.Uint64(math.Float64bits(v))
+}
+
+// String writes a string
+func (e *Encoder) String(s string) {
+	e.Uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// ByteSlice writes a byte slice
+func (e *Encoder) ByteSlice(b []byte) {
+	e.Uint32(uint32(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// Float32s writes a float32 slice
+func (e *Encoder) Float32s(values []float32) {
+	e.Uint32(uint32(len(values)))
+	for _, v := range values {
+		e.Float32(v)
+	}
+}
+
+// Time writes a time as its Unix seconds and nanoseconds. The zero time is
+// kept zero, but locations are not kept.
+func (e *Encoder) Time(t time.Time) {
+	e.Bool(t.IsZero())
+	if !t.IsZero() {
+		e.Int64(t.Unix())
+		e.Uint32(uint32(t.Nanosecond()))
+	}
+}
+
+// StringMap writes a string map in key order
+func (e *Encoder) StringMap(m map[string]string) {
+	e.Uint32(uint32(len(m)))
+	for _, key := range SortedKeys(m) {
+		e.String(key)
+		e.String(m[key])
+	}
+}
+
+// Vector writes a vector record
+func (e *Encoder) Vector(r VectorRecord) {
+	e.String(r.ID)
+	e.Float32s(r.Values)
+	e.StringMap(r.Metadata)
+	e.Time(r.CreatedAt)
+	e.Time(r.UpdatedAt)
+}
+
+// SortedKeys returns the keys of a map in order, for encoding maps
+// deterministically
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Decoder reads the fields of a payload. The first error is kept: later
+// reads return zero values, and Err reports it.
+type Decoder struct {
+	buf  []byte
+	off  int
+	size int
+	err  error
+	r    io.Reader // Source of streamed payloads, read into buf field by field
+}
+
+// NewDecoder returns a decoder of payload
+func NewDecoder(payload []byte) *Decoder {
+	return &Decoder{buf: payload, size: len(payload)}
+}
+
+// NewReaderDecoder returns a decoder of a payload of size bytes that reads
+// it from r as fields are decoded, for readers that keep part of a payload
+// out of memory
+func NewReaderDecoder(r io.Reader, size int64) *Decoder {
+	return &Decoder{size: int(size), r: r}
+}
+
+// Err returns the first error of the decoder
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Fail records an error found by the record, such as an invalid value
+func (d *Decoder) Fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrFileChecksum, fmt.Sprintf(format, args...))
+	}
+}
+
+// Offset returns the number of bytes read
+func (d *Decoder) Offset() int {
+	return d.off
+}
+
+// Remaining returns the number of bytes left
+func (d *Decoder) Remaining() int {
+	return d.size - d.off
+}
+
+// next returns the next n bytes, or nil past the end of the payload. The
+// bytes of streamed payloads are only valid until the next read.
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > d.Remaining() {
+		d.Fail("payload ends at byte %d", d.size)
+		return nil
+	}
+	if d.r != nil {
+		if cap(d.buf) < n {
+			d.buf = make([]byte, n)
+		}
+		if _, err := io.ReadFull(d.r, d.buf[:n]); err != nil {
+			d.Fail("payload ends at byte %d", d.off)
+			return nil
+		}
+		d.off += n
+		return d.buf[:n]
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b
+}
+
+// Bool reads a bool
+func (d *Decoder) Bool() bool {
+	b := d.next(1)
+	return b != nil && b[0] != 0
+}
+
+// Uint32 reads a uint32
+func (d *Decoder) Uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// Uint64 reads a uint64
+func (d *Decoder) Uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Int reads an int written by Encoder.Int
+func (d *Decoder) Int() int {
+	return int(int64(d.Uint64()))
+}
+
+// Int64 reads an int64
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+// Float32 reads a float32
+func (d *Decoder) Float32() float32 {
+	return math.Float32frombits(d.Uint32())
+}
+
+// Float64 reads a float64
+func (d *Decoder) Float64() float64 {
+	return math.Float64frombits(d.Uint64())
+}
+
+// Len reads the length of a slice or map whose elements take at least size
+// bytes each. A corrupt length fails rather than allocating more than the
+// payload holds.
+func (d *Decoder) Len(size int) int {
+	n := int(d.Uint32())
+	if d.err == nil && n*size > d.Remaining() {
+		d.Fail("length %d exceeds the payload", n)
+		return 0
+	}
+	return n
+}
+
+// String reads a string
+func (d *Decoder) String() string {
+	return string(d.next(d.Len(1)))
+}
+
+// ByteSlice reads a byte slice; it is a copy of the payload's bytes
+func (d *Decoder) ByteSlice() []byte {
+	n := d.Len(1)
+	b := d.next(n)
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, n), b...)
+}
+
+// Float32s reads a float32 slice
+func (d *Decoder) Float32s() []float32 {
+	n := d.Len(4)
+	b := d.next(4 * n)
+	if b == nil {
+		return nil
+	}
+	values := make([]float32, n)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return values
+}
+
+// Time reads a time, in UTC
+func (d *Decoder) Time() time.Time {
+	if d.Bool() || d.err != nil {
+		return time.Time{}
+	}
+	sec := d.Int64()
+	nsec := d.Uint32()
+	return time.Unix(sec, int64(nsec)).UTC()
+}
+
+// StringMap reads a string map; it is nil if empty
+func (d *Decoder) StringMap() map[string]string {
+	n := d.Len(8)
+	if n == 0 {
+		return nil
+	}
+	m := make(map[string]string, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		key := d.String()
+		m[key] = d.String()
+	}
+	return m
+}
+
+// Vector reads a vector record
+func (d *Decoder) Vector() VectorRecord {
+	return VectorRecord{
+		ID:        d.String(),
+		Values:    d.Float32s(),
+		Metadata:  d.StringMap(),
+		CreatedAt: d.Time(),
+		UpdatedAt: d.Time(),
+	}
+}
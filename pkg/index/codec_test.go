@@ -0,0 +1,55 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCodec(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 42, time.UTC)
+	record := VectorRecord{ID: "v1", Values: []float32{1.5, -2}, Metadata: map[string]string{"b": "2", "a": "1"}, CreatedAt: created}
+
+	var e Encoder
+	e.Vector(record)
+	e.Int(-7)
+	e.Float64(0.25)
+	e.ByteSlice([]byte{1, 2, 3})
+	e.Bool(true)
+
+	d := NewDecoder(e.Bytes())
+	v := d.Vector()
+	if v.ID != "v1" || len(v.Values) != 2 || v.Values[0] != 1.5 || v.Metadata["a"] != "1" || v.Metadata["b"] != "2" {
+		t.Errorf("Unexpected vector %+v", v)
+	}
+	if !v.CreatedAt.Equal(created) || !v.UpdatedAt.IsZero() {
+		t.Errorf("Expected the times to be kept, got %v and %v", v.CreatedAt, v.UpdatedAt)
+	}
+	if d.Int() != -7 || d.Float64() != 0.25 || !bytes.Equal(d.ByteSlice(), []byte{1, 2, 3}) || !d.Bool() {
+		t.Error("Unexpected fields after the vector")
+	}
+	if d.Err() != nil || d.Remaining() != 0 {
+		t.Errorf("Expected the payload to be read to the end, %d bytes left (%v)", d.Remaining(), d.Err())
+	}
+
+	// Maps are written in key order, so encoding is deterministic
+	for i := 0; i < 10; i++ {
+		var again Encoder
+		again.Vector(record)
+		if !bytes.Equal(again.Bytes(), e.Bytes()[:again.Len()]) {
+			t.Fatal("Expected the same record to encode to the same bytes")
+		}
+	}
+
+	// A corrupt length fails instead of allocating
+	var corrupt Encoder
+	corrupt.Uint32(1 << 30)
+	d = NewDecoder(corrupt.Bytes())
+	if values := d.Float32s(); values != nil || !errors.Is(d.Err(), ErrFileChecksum) {
+		t.Errorf("Expected ErrFileChecksum, got %v (%v)", values, d.Err())
+	}
+	if d.Int() != 0 || d.String() != "" {
+		t.Error("Expected reads after an error to return zero values")
+	}
+}
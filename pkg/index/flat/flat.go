@@ -1,45 +1,55 @@
 package flat
 
 import (
+	"container/heap"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
 	"github.com/ken/vector_database/pkg/index"
 )
 
 var (
 	// ErrVectorNotFound is returned when a vector with the specified ID is not found
-	ErrVectorNotFound = errors.New("vector not found")
+	ErrVectorNotFound = errs.ErrVectorNotFound
 
 	// ErrVectorAlreadyExists is returned when attempting to add a vector with an ID that already exists
-	ErrVectorAlreadyExists = errors.New("vector already exists")
+	ErrVectorAlreadyExists = errs.ErrVectorAlreadyExists
 
 	// ErrInvalidK is returned when k is less than 1
-	ErrInvalidK = errors.New("k must be greater than 0")
+	ErrInvalidK = errs.New(errs.InvalidArgument, "k must be greater than 0")
 
 	// ErrNoVectors is returned when the index is empty
-	ErrNoVectors = errors.New("index contains no vectors")
+	ErrNoVectors = errs.New(errs.FailedPrecondition, "index contains no vectors")
 
 	// ErrMetricRequired is returned when a distance metric is required but not set
-	ErrMetricRequired = errors.New("distance metric is required")
+	ErrMetricRequired = errs.New(errs.InvalidArgument, "distance metric is required")
 )
 
-// FlatIndex implements a brute-force nearest neighbor search index
+// FlatIndex implements a brute-force nearest neighbor search index. The
+// values of all vectors are stored back to back in one slab, so a search
+// scans contiguous memory instead of chasing a pointer per vector.
 type FlatIndex struct {
-	vectors map[string]*vector.Vector // Map of vector ID to vector
-	metric  distance.Metric           // Distance metric to use
-	mu      sync.RWMutex              // Mutex for thread safety
+	slab      []float32           // Values of row i at slab[i*dimension:(i+1)*dimension]
+	dimension int                 // Dimension of every vector (0 while empty)
+	ids       []string            // Vector ID of each row
+	metadata  []map[string]string // Metadata of each row
+	rows      map[string]int      // Row of each vector ID
+	metric    distance.Metric     // Distance metric to use
+	mu        sync.RWMutex        // Mutex for thread safety
 }
 
 // NewFlatIndex creates a new flat index with the specified distance metric
 func NewFlatIndex(metric distance.Metric) *FlatIndex {
 	return &FlatIndex{
-		vectors: make(map[string]*vector.Vector),
-		metric:  metric,
+		rows:   make(map[string]int),
+		metric: metric,
 	}
 }
 
@@ -54,30 +64,95 @@ func (idx *FlatIndex) Build(vectors []*vector.Vector) error {
 	defer idx.mu.Unlock()
 
 	// Reset the index
-	idx.vectors = make(map[string]*vector.Vector)
+	idx.reset()
+	if len(vectors) > 0 {
+		idx.slab = make([]float32, 0, len(vectors)*vectors[0].Dimension)
+		idx.ids = make([]string, 0, len(vectors))
+		idx.metadata = make([]map[string]string, 0, len(vectors))
+	}
 
 	// Add each vector to the index
 	for _, vec := range vectors {
-		idx.vectors[vec.ID] = vec.Copy() // Store a copy of the vector
+		if err := idx.append(vec); err != nil {
+			idx.reset()
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reset empties the index
+func (idx *FlatIndex) reset() {
+	idx.slab = nil
+	idx.dimension = 0
+	idx.ids = nil
+	idx.metadata = nil
+	idx.rows = make(map[string]int)
+}
+
+// append copies a vector into a new row. Vectors replace earlier ones with
+// the same ID, and all must have the dimension of the first.
+func (idx *FlatIndex) append(vec *vector.Vector) error {
+	if len(idx.ids) == 0 {
+		idx.dimension = len(vec.Values)
+	}
+	if len(vec.Values) != idx.dimension {
+		return fmt.Errorf("%w: %s has dimension %d, index has %d", vector.ErrInvalidDimension, vec.ID, len(vec.Values), idx.dimension)
+	}
+
+	metadata := make(map[string]string, len(vec.Metadata))
+	for key, value := range vec.Metadata {
+		metadata[key] = value
+	}
+	if row, exists := idx.rows[vec.ID]; exists {
+		copy(idx.row(row), vec.Values)
+		idx.metadata[row] = metadata
+		return nil
 	}
 
+	idx.rows[vec.ID] = len(idx.ids)
+	idx.slab = append(idx.slab, vec.Values...)
+	idx.ids = append(idx.ids, vec.ID)
+	idx.metadata = append(idx.metadata, metadata)
 	return nil
 }
 
+// row returns the values of a row, aliasing the slab
+func (idx *FlatIndex) row(i int) []float32 {
+	return idx.slab[i*idx.dimension : (i+1)*idx.dimension : (i+1)*idx.dimension]
+}
+
+// view returns a vector that aliases a row instead of copying it
+func (idx *FlatIndex) view(i int) vector.Vector {
+	return vector.Vector{ID: idx.ids[i], Values: idx.row(i), Dimension: idx.dimension, Metadata: idx.metadata[i]}
+}
+
+// get returns a copy of the vector with the given ID
+func (idx *FlatIndex) get(id string) (*vector.Vector, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	row, exists := idx.rows[id]
+	if !exists {
+		return nil, false
+	}
+	view := idx.view(row)
+	return view.Copy(), true
+}
+
 // Add adds a vector to the index
 func (idx *FlatIndex) Add(vec *vector.Vector) error {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
 	// Check if the vector already exists
-	if _, exists := idx.vectors[vec.ID]; exists {
+	if _, exists := idx.rows[vec.ID]; exists {
 		return ErrVectorAlreadyExists
 	}
 
-	// Add the vector to the index
-	idx.vectors[vec.ID] = vec.Copy() // Store a copy of the vector
-
-	return nil
+	// Copy the vector into the slab
+	return idx.append(vec)
 }
 
 // Delete removes a vector from the index
@@ -86,23 +161,40 @@ func (idx *FlatIndex) Delete(id string) error {
 	defer idx.mu.Unlock()
 
 	// Check if the vector exists
-	if _, exists := idx.vectors[id]; !exists {
+	row, exists := idx.rows[id]
+	if !exists {
 		return ErrVectorNotFound
 	}
 
-	// Delete the vector
-	delete(idx.vectors, id)
+	// Move the last row into the gap so the slab stays contiguous
+	last := len(idx.ids) - 1
+	if row != last {
+		copy(idx.row(row), idx.row(last))
+		idx.ids[row] = idx.ids[last]
+		idx.metadata[row] = idx.metadata[last]
+		idx.rows[idx.ids[row]] = row
+	}
+	idx.slab = idx.slab[:last*idx.dimension]
+	idx.ids = idx.ids[:last]
+	idx.metadata[last] = nil
+	idx.metadata = idx.metadata[:last]
+	delete(idx.rows, id)
 
 	return nil
 }
 
 // Search performs a k-nearest neighbor search
 func (idx *FlatIndex) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a k-nearest neighbor search tuned by opts
+func (idx *FlatIndex) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
 	// Check if the index is empty
-	if len(idx.vectors) == 0 {
+	if len(idx.ids) == 0 {
 		return nil, ErrNoVectors
 	}
 
@@ -116,31 +208,90 @@ func (idx *FlatIndex) Search(query *vector.Vector, k int) (index.SearchResults,
 		return nil, ErrMetricRequired
 	}
 
-	// Calculate distances to all vectors
-	results := make(index.SearchResults, 0, len(idx.vectors))
-	for id, vec := range idx.vectors {
-		// Calculate distance
-		dist, err := idx.metric.Distance(query, vec)
-		if err != nil {
-			return nil, err
+	views, distances, err := idx.scan(query)
+	if err != nil {
+		return nil, err
+	}
+	if stats := opts.Stats; stats != nil {
+		for _, id := range idx.ids {
+			stats.DistanceComputations++
+			stats.Visited++
+			stats.Reached(id)
 		}
+	}
 
-		// Add to results
-		results = append(results, index.SearchResult{
-			ID:       id,
-			Vector:   vec.Copy(), // Return a copy to prevent modification
-			Distance: dist,
-		})
+	// Only the k nearest rows are copied into results, if at all
+	nearest := idx.nearest(distances, k)
+	results := make(index.SearchResults, len(nearest))
+	for i, row := range nearest {
+		results[i] = index.SearchResult{ID: idx.ids[row], Distance: distances[row]}
+		if !opts.OmitVectors {
+			results[i].Vector = views[row].Copy() // Return a copy to prevent modification
+		}
 	}
+	return results, nil
+}
 
-	// Sort results by distance
-	results.Sort()
+// scan computes the distance of every row to the query in one batch over
+// views of the slab rows
+func (idx *FlatIndex) scan(query *vector.Vector) ([]vector.Vector, []float32, error) {
+	views := make([]vector.Vector, len(idx.ids))
+	vectors := make([]*vector.Vector, len(idx.ids))
+	for i := range views {
+		views[i] = idx.view(i)
+		vectors[i] = &views[i]
+	}
 
-	// Return top k results
-	if k > len(results) {
-		k = len(results)
+	batch, err := distance.NewDefaultBatchDistance(idx.metric)
+	if err != nil {
+		return nil, nil, err
+	}
+	distances := make([]float32, len(vectors))
+	if err := batch.Distances(query, vectors, distances); err != nil {
+		return nil, nil, err
 	}
-	return results[:k], nil
+	return views, distances, nil
+}
+
+// nearest returns the k rows with the smallest distances, nearest first.
+// Equally distant rows are ordered by ID.
+func (idx *FlatIndex) nearest(distances []float32, k int) []int {
+	closer := func(a, b int) bool {
+		if distances[a] != distances[b] {
+			return distances[a] < distances[b]
+		}
+		return idx.ids[a] < idx.ids[b]
+	}
+
+	// Keep the k nearest in a max-heap whose root is the furthest
+	h := &rowHeap{less: func(a, b int) bool { return closer(b, a) }}
+	for row := range distances {
+		if h.Len() < k {
+			heap.Push(h, row)
+		} else if closer(row, h.rows[0]) {
+			h.rows[0] = row
+			heap.Fix(h, 0)
+		}
+	}
+
+	sort.Slice(h.rows, func(i, j int) bool { return closer(h.rows[i], h.rows[j]) })
+	return h.rows
+}
+
+// rowHeap is a heap of rows ordered by less
+type rowHeap struct {
+	rows []int
+	less func(a, b int) bool
+}
+
+func (h *rowHeap) Len() int           { return len(h.rows) }
+func (h *rowHeap) Less(i, j int) bool { return h.less(h.rows[i], h.rows[j]) }
+func (h *rowHeap) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *rowHeap) Push(x interface{}) { h.rows = append(h.rows, x.(int)) }
+func (h *rowHeap) Pop() interface{} {
+	row := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return row
 }
 
 // Size returns the number of vectors in the index
@@ -148,7 +299,7 @@ func (idx *FlatIndex) Size() int {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	return len(idx.vectors)
+	return len(idx.ids)
 }
 
 // GetIDs returns all vector IDs in the index
@@ -156,93 +307,124 @@ func (idx *FlatIndex) GetIDs() []string {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	ids := make([]string, 0, len(idx.vectors))
-	for id := range idx.vectors {
-		ids = append(ids, id)
+	return append([]string(nil), idx.ids...)
+}
+
+// fileKind names flat indexes in index files
+const fileKind = "flat"
+
+// fileV1 is the payload of flat index files of payload version 1
+type fileV1 struct {
+	Vectors []index.VectorRecord // In ID order
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV1) EncodePayload(e *index.Encoder) {
+	e.Uint32(uint32(len(f.Vectors)))
+	for _, record := range f.Vectors {
+		e.Vector(record)
 	}
+}
 
-	return ids
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV1) DecodePayload(d *index.Decoder) {
+	f.Vectors = make([]index.VectorRecord, d.Len(4))
+	for i := range f.Vectors {
+		f.Vectors[i] = d.Vector()
+	}
 }
 
-// Save persists the index to the specified path
+// Save persists the index to the specified path in the index file format
 func (idx *FlatIndex) Save(path string) error {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	// Create the file
-	file, err := os.Create(path)
-	if err != nil {
-		return err
+	data := fileV1{Vectors: make([]index.VectorRecord, len(idx.ids))}
+	for row := range idx.ids {
+		view := idx.view(row)
+		data.Vectors[row] = index.NewVectorRecord(&view)
 	}
-	defer file.Close()
-
-	// Create a gob encoder
-	encoder := gob.NewEncoder(file)
 
-	// Create a serializable version of the index
-	type indexData struct {
-		Vectors map[string]*vector.Vector
-		Metric  string
+	header := index.FileHeader{Kind: fileKind, PayloadVersion: 1, Vectors: len(idx.ids), Dimension: idx.dimension}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
 	}
+	return index.WriteFile(path, header, data)
+}
 
-	// Get the metric name
+// Load loads the index from the specified path. Files saved before the
+// index file format existed are read as well.
+func (idx *FlatIndex) Load(path string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var vectors []*vector.Vector
 	var metricName string
-	if idx.metric != nil {
-		metricName = string(idx.metric.Name())
+	header, payload, err := index.ReadFile(path, fileKind)
+	switch {
+	case errors.Is(err, index.ErrNotIndexFile):
+		if vectors, metricName, err = loadV0(path); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case header.PayloadVersion == 1:
+		var data fileV1
+		if err := index.DecodePayload(header, payload, &data); err != nil {
+			return err
+		}
+		for _, record := range data.Vectors {
+			vectors = append(vectors, record.Vector())
+		}
+		metricName = header.Metric
+	default:
+		return fmt.Errorf("%w: flat payload version %d", index.ErrFileVersion, header.PayloadVersion)
 	}
 
-	// Encode the index
-	data := indexData{
-		Vectors: idx.vectors,
-		Metric:  metricName,
+	// Copy the vectors into the slab in ID order
+	sort.Slice(vectors, func(i, j int) bool { return vectors[i].ID < vectors[j].ID })
+	idx.reset()
+	for _, vec := range vectors {
+		if err := idx.append(vec); err != nil {
+			idx.reset()
+			return err
+		}
 	}
-	if err := encoder.Encode(data); err != nil {
-		return err
+
+	// Set the metric if it's not already set
+	if idx.metric == nil && metricName != "" {
+		metric, err := distance.GetMetric(distance.MetricType(metricName))
+		if err != nil {
+			return err
+		}
+		idx.metric = metric
 	}
 
 	return nil
 }
 
-// Load loads the index from the specified path
-func (idx *FlatIndex) Load(path string) error {
-	idx.mu.Lock()
-	defer idx.mu.Unlock()
-
-	// Open the file
+// loadV0 reads the vectors and metric of a file saved as plain gob, before
+// the index file format existed
+func loadV0(path string) ([]*vector.Vector, string, error) {
 	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
 	defer file.Close()
 
-	// Create a gob decoder
-	decoder := gob.NewDecoder(file)
-
-	// Define the serializable version of the index
-	type indexData struct {
+	var data struct {
 		Vectors map[string]*vector.Vector
 		Metric  string
 	}
-
-	// Decode the index
-	var data indexData
-	if err := decoder.Decode(&data); err != nil {
-		return err
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return nil, "", err
 	}
 
-	// Update the index
-	idx.vectors = data.Vectors
-
-	// Set the metric if it's not already set
-	if idx.metric == nil && data.Metric != "" {
-		metric, err := distance.GetMetric(distance.MetricType(data.Metric))
-		if err != nil {
-			return err
-		}
-		idx.metric = metric
+	vectors := make([]*vector.Vector, 0, len(data.Vectors))
+	for _, vec := range data.Vectors {
+		vectors = append(vectors, vec)
 	}
-
-	return nil
+	return vectors, data.Metric, nil
 }
 
 // SetMetric sets the distance metric used by the index
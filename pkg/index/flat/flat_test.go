@@ -1,12 +1,15 @@
 package flat
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
 )
 
 func TestNewFlatIndex(t *testing.T) {
@@ -21,8 +24,8 @@ func TestNewFlatIndex(t *testing.T) {
 		t.Errorf("Expected metric to be set correctly")
 	}
 
-	if len(idx.vectors) != 0 {
-		t.Errorf("Expected empty vectors map, got %d items", len(idx.vectors))
+	if len(idx.ids) != 0 || len(idx.slab) != 0 {
+		t.Errorf("Expected an empty slab, got %d rows", len(idx.ids))
 	}
 }
 
@@ -49,7 +52,7 @@ func TestBuild(t *testing.T) {
 
 	// Check that each vector is retrievable and is a copy
 	for _, v := range vectors {
-		idxVec, exists := idx.vectors[v.ID]
+		idxVec, exists := idx.get(v.ID)
 		if !exists {
 			t.Errorf("Vector %s not found in index", v.ID)
 			continue
@@ -82,11 +85,11 @@ func TestBuild(t *testing.T) {
 		t.Errorf("Expected 1 vector after rebuild, got %d", idx.Size())
 	}
 
-	if _, exists := idx.vectors["v1"]; exists {
+	if _, exists := idx.get("v1"); exists {
 		t.Errorf("Vector v1 should have been removed after rebuild")
 	}
 
-	if _, exists := idx.vectors["v4"]; !exists {
+	if _, exists := idx.get("v4"); !exists {
 		t.Errorf("Vector v4 should exist after rebuild")
 	}
 }
@@ -153,7 +156,7 @@ func TestDelete(t *testing.T) {
 		t.Errorf("Expected 1 vector after delete, got %d", idx.Size())
 	}
 
-	if _, exists := idx.vectors["v1"]; exists {
+	if _, exists := idx.get("v1"); exists {
 		t.Errorf("Vector v1 should have been deleted")
 	}
 
@@ -230,10 +233,7 @@ func TestSearch(t *testing.T) {
 	}
 
 	// Test with no metric
-	noMetricIdx := &FlatIndex{
-		vectors: make(map[string]*vector.Vector),
-		metric:  nil,
-	}
+	noMetricIdx := NewFlatIndex(nil)
 	noMetricIdx.Add(vector.NewVector("v1", []float32{1.0, 2.0, 3.0}))
 	_, err = noMetricIdx.Search(query, 1)
 	if err != ErrMetricRequired {
@@ -286,8 +286,9 @@ func TestSaveLoad(t *testing.T) {
 	}
 
 	// Check that all vectors from the original index are in the new index
-	for id, vec := range originalIndex.vectors {
-		newVec, exists := newIndex.vectors[id]
+	for _, id := range originalIndex.GetIDs() {
+		vec, _ := originalIndex.get(id)
+		newVec, exists := newIndex.get(id)
 		if !exists {
 			t.Errorf("Vector %s not found in loaded index", id)
 			continue
@@ -335,4 +336,119 @@ func TestSetMetric(t *testing.T) {
 	if euclideanResults[0].Distance == cosineResults[0].Distance {
 		t.Errorf("Expected different distances with different metrics, got %.6f for both", euclideanResults[0].Distance)
 	}
-} 
\ No newline at end of file
+} 
+func TestSearchOmitVectors(t *testing.T) {
+	idx := NewFlatIndex(&distance.EuclideanDistance{})
+	idx.Build([]*vector.Vector{
+		vector.NewVector("v1", []float32{1, 0}),
+		vector.NewVector("v2", []float32{2, 0}),
+	})
+	query := vector.NewVector("q", []float32{2, 0})
+
+	full, _ := idx.Search(query, 2)
+	bare, err := index.SearchWithOptions(idx, query, 2, index.SearchOptions{OmitVectors: true})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	for i := range bare {
+		if bare[i].Vector != nil || bare[i].ID != full[i].ID || bare[i].Distance != full[i].Distance {
+			t.Errorf("Expected %s at %f without a vector, got %+v", full[i].ID, full[i].Distance, bare[i])
+		}
+	}
+}
+
+func TestDeleteMovesLastRow(t *testing.T) {
+	idx := NewFlatIndex(&distance.EuclideanDistance{})
+	idx.Build([]*vector.Vector{
+		vector.NewVector("v1", []float32{1, 0}),
+		vector.NewVector("v2", []float32{2, 0}),
+		vector.NewVector("v3", []float32{3, 0}),
+	})
+
+	if err := idx.Delete("v1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if len(idx.slab) != 2*idx.dimension || idx.ids[0] != "v3" || idx.rows["v3"] != 0 {
+		t.Fatalf("Expected v3 to fill the gap, got ids %v and slab %v", idx.ids, idx.slab)
+	}
+
+	results, err := idx.Search(vector.NewVector("q", []float32{3, 0}), 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "v3" || results[0].Vector.Values[0] != 3 || results[1].ID != "v2" {
+		t.Errorf("Unexpected results after delete: %+v", results)
+	}
+
+	// Every vector must have the dimension of the first
+	err = idx.Add(vector.NewVector("v4", []float32{1, 2, 3}))
+	if !errors.Is(err, vector.ErrInvalidDimension) {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+}
+
+// benchmarkVectors creates n random vectors, each allocated on its own like
+// vectors read from a store
+func benchmarkVectors(n, dim int) []*vector.Vector {
+	gen, _ := vector.NewGenerator(vector.Gaussian, 1)
+	vectors := make([]*vector.Vector, n)
+	for i := range vectors {
+		vectors[i] = gen.Next(fmt.Sprintf("v%06d", i), dim)
+	}
+	return vectors
+}
+
+func BenchmarkSearch(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000} {
+		vectors := benchmarkVectors(n, 128)
+		idx := NewFlatIndex(&distance.EuclideanDistance{})
+		if err := idx.Build(vectors); err != nil {
+			b.Fatalf("Build failed: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("n=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := idx.Search(vectors[i%n], 10); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkScan compares computing every distance over the slab with the
+// previous layout, a map of separately allocated vectors
+func BenchmarkScan(b *testing.B) {
+	vectors := benchmarkVectors(50000, 128)
+	metric := &distance.EuclideanDistance{}
+	idx := NewFlatIndex(metric)
+	if err := idx.Build(vectors); err != nil {
+		b.Fatalf("Build failed: %v", err)
+	}
+	pointers := make(map[string]*vector.Vector, len(vectors))
+	for _, vec := range vectors {
+		pointers[vec.ID] = vec.Copy()
+	}
+
+	b.Run("slab", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := idx.scan(vectors[i%len(vectors)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pointers", func(b *testing.B) {
+		batch, _ := distance.NewDefaultBatchDistance(metric)
+		for i := 0; i < b.N; i++ {
+			gathered := make([]*vector.Vector, 0, len(pointers))
+			for _, vec := range pointers {
+				gathered = append(gathered, vec)
+			}
+			distances := make([]float32, len(gathered))
+			if err := batch.Distances(vectors[i%len(vectors)], gathered, distances); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/fileutil"
+)
+
+// Index files start with a header that says what they hold, followed by the
+// payload of the index kind. Integers are little-endian.
+//
+//	size  field
+//	8     magic "VDBINDEX"
+//	2     file format version (FileVersion)
+//	2     payload version of the index kind
+//	1+n   index kind, e.g. "hnsw", as a length and the name
+//	1+n   metric name, empty if none
+//	8     number of vectors
+//	4     dimension
+//	8     payload length in bytes
+//	4     CRC-32C (Castagnoli) of the payload
+//	...   payload
+//
+// A payload is one record of the kind's payload version, written with the
+// binary codec of codec.go; files of format version 1 hold gob-encoded
+// records instead and are still read. The records are declared for the file
+// only, so the index types can change freely; a new payload version adds a
+// record and its reader converts the older ones. Files written before the
+// header existed are plain gob and load as payload version 0.
+const (
+	// FileMagic starts every versioned index file
+	FileMagic = "VDBINDEX"
+
+	// FileVersion is the version of the format written by WriteFile.
+	// Version 1 payloads are gob-encoded.
+	FileVersion = 2
+)
+
+var (
+	// ErrNotIndexFile is returned for files without the index file header,
+	// such as indexes saved before it existed
+	ErrNotIndexFile = errs.New(errs.InvalidArgument, "not a versioned index file")
+
+	// ErrFileVersion is returned for files of a newer format or payload
+	// version than this build reads
+	ErrFileVersion = errs.New(errs.FailedPrecondition, "unsupported index file version")
+
+	// ErrFileKind is returned when a file holds another kind of index
+	ErrFileKind = errs.New(errs.FailedPrecondition, "index file holds another index type")
+
+	// ErrFileChecksum is returned when the payload does not match its checksum
+	ErrFileChecksum = errs.New(errs.DataLoss, "index file is corrupt")
+)
+
+// castagnoli is the CRC-32C table of payload checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// FileHeader describes an index file
+type FileHeader struct {
+	Version        uint16 // File format version; payloads of version 1 are gob
+	Kind           string // Index type, e.g. hnsw
+	PayloadVersion uint16 // Version of the kind's payload record
+	Metric         string // Distance metric the index was built with
+	Vectors        int
+	Dimension      int
+	PayloadSize    int64
+	Checksum       uint32 // CRC-32C of the payload
+}
+
+// VectorRecord is the file form of a vector
+type VectorRecord struct {
+	ID        string
+	Values    []float32
+	Metadata  map[string]string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NewVectorRecord returns the file form of v
+func NewVectorRecord(v *vector.Vector) VectorRecord {
+	return VectorRecord{ID: v.ID, Values: v.Values, Metadata: v.Metadata, CreatedAt: v.CreatedAt, UpdatedAt: v.UpdatedAt}
+}
+
+// Vector returns the vector the record holds
+func (r VectorRecord) Vector() *vector.Vector {
+	v := vector.NewVectorWithMetadata(r.ID, r.Values, r.Metadata)
+	v.CreatedAt, v.UpdatedAt = r.CreatedAt, r.UpdatedAt
+	return v
+}
+
+// WriteFile replaces the file at path with an index file holding payload
+// under header. The version, payload size and checksum of the header are
+// filled in.
+func WriteFile(path string, header FileHeader, payload PayloadEncoder) error {
+	var body Encoder
+	payload.EncodePayload(&body)
+	if len(header.Kind) > 255 || len(header.Metric) > 255 {
+		return fmt.Errorf("index kind or metric name too long")
+	}
+	header.Version = FileVersion
+	header.PayloadSize = int64(body.Len())
+	header.Checksum = crc32.Checksum(body.Bytes(), castagnoli)
+
+	var buf bytes.Buffer
+	buf.WriteString(FileMagic)
+	binary.Write(&buf, binary.LittleEndian, header.Version)
+	binary.Write(&buf, binary.LittleEndian, header.PayloadVersion)
+	buf.WriteByte(byte(len(header.Kind)))
+	buf.WriteString(header.Kind)
+	buf.WriteByte(byte(len(header.Metric)))
+	buf.WriteString(header.Metric)
+	binary.Write(&buf, binary.LittleEndian, uint64(header.Vectors))
+	binary.Write(&buf, binary.LittleEndian, uint32(header.Dimension))
+	binary.Write(&buf, binary.LittleEndian, uint64(header.PayloadSize))
+	binary.Write(&buf, binary.LittleEndian, header.Checksum)
+	buf.Write(body.Bytes())
+	return fileutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// ReadFile reads the index file at path, which must hold an index of kind,
+// and returns its header and verified payload. Files without a header fail
+// with ErrNotIndexFile, so callers can fall back to the unversioned format.
+func ReadFile(path, kind string) (*FileHeader, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if header.Kind != kind {
+		return nil, nil, fmt.Errorf("%w: %s holds a %s index, not %s", ErrFileKind, path, header.Kind, kind)
+	}
+	payload, err := readPayload(r, header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return header, payload, nil
+}
+
+// DecodePayload decodes a payload returned by ReadFile with header into
+// record. Payloads of format version 2 need a PayloadDecoder and must be
+// read to the end; version 1 payloads are gob.
+func DecodePayload(header *FileHeader, payload []byte, record interface{}) error {
+	if header.Version < 2 {
+		return gob.NewDecoder(bytes.NewReader(payload)).Decode(record)
+	}
+	decoder, ok := record.(PayloadDecoder)
+	if !ok {
+		return fmt.Errorf("%w: %s payload version %d of format %d", ErrFileVersion, header.Kind, header.PayloadVersion, header.Version)
+	}
+	d := NewDecoder(payload)
+	decoder.DecodePayload(d)
+	if d.Err() != nil {
+		return d.Err()
+	}
+	if d.Remaining() > 0 {
+		return fmt.Errorf("%w: %d bytes follow the %s payload", ErrFileChecksum, d.Remaining(), header.Kind)
+	}
+	return nil
+}
+
+// InspectFile returns the header of the index file at path after verifying
+// the checksum of its payload
+func InspectFile(path string) (*FileHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	header, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readPayload(r, header); err != nil {
+		return header, err
+	}
+	return header, nil
+}
+
+// PayloadFile is an index file opened to decode its payload as it is read,
+// for readers that keep part of it on disk and read it with ReadAt later
+type PayloadFile struct {
+	*os.File
+	Header *FileHeader
+	Start  int64 // File offset of the payload
+
+	checksum hash.Hash32
+	payload  io.Reader
+}
+
+// OpenPayload opens the index file at path, which must hold an index of
+// kind, to decode its payload with Decoder. Files without a header fail with
+// ErrNotIndexFile.
+func OpenPayload(path, kind string) (*PayloadFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header, err := readHeader(bufio.NewReader(file))
+	if err == nil && header.Kind != kind {
+		err = fmt.Errorf("%w: %s holds a %s index, not %s", ErrFileKind, path, header.Kind, kind)
+	}
+	var info os.FileInfo
+	if err == nil {
+		info, err = file.Stat()
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	start := int64(len(FileMagic) + 2 + 2 + 1 + len(header.Kind) + 1 + len(header.Metric) + 8 + 4 + 8 + 4)
+	if header.PayloadSize > info.Size()-start {
+		file.Close()
+		return nil, fmt.Errorf("%w: %s: payload is shorter than %d bytes", ErrFileChecksum, path, header.PayloadSize)
+	}
+	checksum := crc32.New(castagnoli)
+	payload := io.TeeReader(bufio.NewReader(io.NewSectionReader(file, start, header.PayloadSize)), checksum)
+	return &PayloadFile{File: file, Header: header, Start: start, checksum: checksum, payload: payload}, nil
+}
+
+// Decoder returns a decoder reading the payload from the start. It is only
+// called once.
+func (f *PayloadFile) Decoder() *Decoder {
+	return NewReaderDecoder(f.payload, f.Header.PayloadSize)
+}
+
+// Verify reads what Decoder has not of the payload and verifies its checksum
+func (f *PayloadFile) Verify() error {
+	if _, err := io.Copy(io.Discard, f.payload); err != nil {
+		return err
+	}
+	if sum := f.checksum.Sum32(); sum != f.Header.Checksum {
+		return fmt.Errorf("%w: payload checksum %08x, header says %08x", ErrFileChecksum, sum, f.Header.Checksum)
+	}
+	return nil
+}
+
+// readHeader reads the header of an index file
+func readHeader(r *bufio.Reader) (*FileHeader, error) {
+	magic := make([]byte, len(FileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != FileMagic {
+		return nil, ErrNotIndexFile
+	}
+
+	header := &FileHeader{}
+	var vectors, size uint64
+	var dimension uint32
+	for _, field := range []interface{}{&header.Version, &header.PayloadVersion} {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", ErrFileChecksum)
+		}
+	}
+	if header.Version > FileVersion {
+		return nil, fmt.Errorf("%w: file format %d, newest supported is %d", ErrFileVersion, header.Version, FileVersion)
+	}
+
+	var err error
+	if header.Kind, err = readName(r); err != nil {
+		return nil, err
+	}
+	if header.Metric, err = readName(r); err != nil {
+		return nil, err
+	}
+	for _, field := range []interface{}{&vectors, &dimension, &size, &header.Checksum} {
+		if err := binary.Read(r, binary.LittleEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: truncated header", ErrFileChecksum)
+		}
+	}
+	header.Vectors, header.Dimension, header.PayloadSize = int(vectors), int(dimension), int64(size)
+	return header, nil
+}
+
+// readName reads a length-prefixed name of the header
+func readName(r *bufio.Reader) (string, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return "", fmt.Errorf("%w: truncated header", ErrFileChecksum)
+	}
+	name := make([]byte, n)
+	if _, err := io.ReadFull(r, name); err != nil {
+		return "", fmt.Errorf("%w: truncated header", ErrFileChecksum)
+	}
+	return string(name), nil
+}
+
+// readPayload reads the payload that follows header and verifies it
+func readPayload(r io.Reader, header *FileHeader) ([]byte, error) {
+	// A corrupt length must not allocate more than the file holds
+	payload, err := io.ReadAll(io.LimitReader(r, header.PayloadSize))
+	if err != nil || int64(len(payload)) != header.PayloadSize {
+		return nil, fmt.Errorf("%w: payload is shorter than %d bytes", ErrFileChecksum, header.PayloadSize)
+	}
+	if sum := crc32.Checksum(payload, castagnoli); sum != header.Checksum {
+		return nil, fmt.Errorf("%w: payload checksum %08x, header says %08x", ErrFileChecksum, sum, header.Checksum)
+	}
+	return payload, nil
+}
@@ -0,0 +1,105 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// testRecords is a payload of vector records
+type testRecords []VectorRecord
+
+func (r testRecords) EncodePayload(e *Encoder) {
+	e.Uint32(uint32(len(r)))
+	for _, record := range r {
+		e.Vector(record)
+	}
+}
+
+func (r *testRecords) DecodePayload(d *Decoder) {
+	*r = make(testRecords, d.Len(4))
+	for i := range *r {
+		(*r)[i] = d.Vector()
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.idx")
+	record := NewVectorRecord(vector.NewVectorWithMetadata("v1", []float32{1, 2}, map[string]string{"k": "v"}))
+	header := FileHeader{Kind: "test", PayloadVersion: 3, Metric: "cosine", Vectors: 1, Dimension: 2}
+	if err := WriteFile(path, header, testRecords{record}); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	read, payload, err := ReadFile(path, "test")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if read.Version != FileVersion || read.PayloadVersion != 3 || read.Metric != "cosine" || read.Vectors != 1 || read.Dimension != 2 || read.PayloadSize != int64(len(payload)) {
+		t.Errorf("Unexpected header %+v", read)
+	}
+	var records testRecords
+	if err := DecodePayload(read, payload, &records); err != nil {
+		t.Fatalf("DecodePayload failed: %v", err)
+	}
+	if v := records[0].Vector(); v.ID != "v1" || v.Dimension != 2 || v.Metadata["k"] != "v" {
+		t.Errorf("Unexpected vector %+v", v)
+	}
+
+	if _, _, err := ReadFile(path, "hnsw"); !errors.Is(err, ErrFileKind) {
+		t.Errorf("Expected ErrFileKind, got %v", err)
+	}
+
+	// A flipped payload byte fails the checksum, but the header is still shown
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if header, err := InspectFile(path); !errors.Is(err, ErrFileChecksum) || header == nil || header.Kind != "test" {
+		t.Errorf("Expected ErrFileChecksum with the header, got %+v (%v)", header, err)
+	}
+
+	// Files of a newer format are refused rather than misread
+	data[len(FileMagic)] = FileVersion + 1
+	os.WriteFile(path, data, 0644)
+	if _, _, err := ReadFile(path, "test"); !errors.Is(err, ErrFileVersion) {
+		t.Errorf("Expected ErrFileVersion, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("plain gob"), 0644)
+	if _, err := InspectFile(path); err != ErrNotIndexFile {
+		t.Errorf("Expected ErrNotIndexFile, got %v", err)
+	}
+}
+
+func TestReadGobPayload(t *testing.T) {
+	// Files of format version 1 hold gob-encoded payloads
+	var body bytes.Buffer
+	gob.NewEncoder(&body).Encode([]VectorRecord{NewVectorRecord(vector.NewVector("v1", []float32{1, 2}))})
+	var file bytes.Buffer
+	file.WriteString(FileMagic)
+	binary.Write(&file, binary.LittleEndian, []uint16{1, 1})
+	file.Write([]byte{4, 't', 'e', 's', 't', 0})
+	binary.Write(&file, binary.LittleEndian, uint64(1))
+	binary.Write(&file, binary.LittleEndian, uint32(2))
+	binary.Write(&file, binary.LittleEndian, uint64(body.Len()))
+	binary.Write(&file, binary.LittleEndian, crc32.Checksum(body.Bytes(), castagnoli))
+	file.Write(body.Bytes())
+	path := filepath.Join(t.TempDir(), "v1.idx")
+	os.WriteFile(path, file.Bytes(), 0644)
+
+	header, payload, err := ReadFile(path, "test")
+	if err != nil || header.Version != 1 {
+		t.Fatalf("ReadFile failed: %+v (%v)", header, err)
+	}
+	var records []VectorRecord
+	if err := DecodePayload(header, payload, &records); err != nil || len(records) != 1 || records[0].ID != "v1" {
+		t.Errorf("Expected the gob payload to decode, got %+v (%v)", records, err)
+	}
+}
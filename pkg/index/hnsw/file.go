@@ -0,0 +1,436 @@
+package hnsw
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/index"
+)
+
+// fileKind names HNSW indexes in index files
+const fileKind = "hnsw"
+
+// fileV1 is the payload of HNSW index files of payload version 1
+type fileV1 struct {
+	Nodes      []nodeRecord
+	EntryPoint string
+	MaxLevel   int
+	Config     configRecord
+}
+
+// fileV2 is the payload of HNSW index files of payload version 2. Nodes are
+// written in ID order and neighbors as their position in it. The level-0
+// neighbor lists, most of the graph, come last after a table of their
+// offsets, so a reader can load the upper layers and pick lists out of the
+// rest.
+//
+//	config, entry point, max level
+//	nodes:    count, then per node its vector, level and deleted flag
+//	upper:    per node, the lists of levels 1 to its level
+//	offsets:  count+1 uint64 offsets of the level-0 lists, from the first
+//	level 0:  per node, its level-0 list
+//
+// A list is a count followed by the neighbors' positions (uint32) and
+// distances (float32), in position order.
+type fileV2 struct {
+	Config     configRecord
+	EntryPoint string
+	MaxLevel   int
+	Nodes      []nodeRecord
+}
+
+// nodeRecord is the file form of a node
+type nodeRecord struct {
+	Vector  index.VectorRecord
+	Level   int
+	Deleted bool
+	Edges   []map[string]float32 // Edges[level][neighborID] = distance
+}
+
+// configRecord is the file form of an HNSWConfig
+type configRecord struct {
+	M                int
+	M0               int
+	EfConstruction   int
+	EfSearch         int
+	MaxLevel         int
+	LevelMult        float64
+	Seed             int64
+	Deterministic    bool
+	Heuristic        bool
+	ExtendCandidates bool
+	KeepPruned       bool
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV2) EncodePayload(e *index.Encoder) {
+	f.Config.encode(e)
+	e.String(f.EntryPoint)
+	e.Int(f.MaxLevel)
+
+	positions := make(map[string]uint32, len(f.Nodes))
+	e.Uint32(uint32(len(f.Nodes)))
+	for i, node := range f.Nodes {
+		positions[node.Vector.ID] = uint32(i)
+		e.Vector(node.Vector)
+		e.Int(node.Level)
+		e.Bool(node.Deleted)
+	}
+	for _, node := range f.Nodes {
+		for level := 1; level <= node.Level; level++ {
+			encodeNeighbors(e, node.edges(level), positions)
+		}
+	}
+
+	var level0 index.Encoder
+	for _, node := range f.Nodes {
+		e.Uint64(uint64(level0.Len()))
+		encodeNeighbors(&level0, node.edges(0), positions)
+	}
+	e.Uint64(uint64(level0.Len()))
+	e.Raw(level0.Bytes())
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV2) DecodePayload(d *index.Decoder) {
+	ids, offsets := f.decodeHead(d)
+	start := d.Offset()
+	for i := range f.Nodes {
+		if d.Err() != nil {
+			return
+		}
+		if uint64(d.Offset()-start) != offsets[i] {
+			d.Fail("level-0 list of node %s is not at offset %d", ids[i], offsets[i])
+			return
+		}
+		f.Nodes[i].Edges[0] = decodeNeighbors(d, ids)
+	}
+}
+
+// decodeHead reads the payload up to the level-0 lists, leaving Edges[0] of
+// the nodes nil. It returns the IDs of the nodes by position and the
+// offsets of their level-0 lists, which are checked to be in order and end
+// with the payload.
+func (f *fileV2) decodeHead(d *index.Decoder) (ids []string, offsets []uint64) {
+	f.Config.decode(d)
+	f.EntryPoint = d.String()
+	f.MaxLevel = d.Int()
+
+	f.Nodes = make([]nodeRecord, d.Len(4))
+	ids = make([]string, len(f.Nodes))
+	for i := range f.Nodes {
+		node := &f.Nodes[i]
+		node.Vector = d.Vector()
+		node.Level = d.Int()
+		node.Deleted = d.Bool()
+		if node.Level < 0 || node.Level > d.Remaining() {
+			d.Fail("node %s has level %d", node.Vector.ID, node.Level)
+			return nil, nil
+		}
+		node.Edges = make([]map[string]float32, node.Level+1)
+		ids[i] = node.Vector.ID
+	}
+	for i := range f.Nodes {
+		for level := 1; level <= f.Nodes[i].Level; level++ {
+			f.Nodes[i].Edges[level] = decodeNeighbors(d, ids)
+		}
+	}
+
+	if d.Err() != nil || 8*(len(f.Nodes)+1) > d.Remaining() {
+		d.Fail("payload ends before the level-0 offsets")
+		return nil, nil
+	}
+	offsets = make([]uint64, len(f.Nodes)+1)
+	for i := range offsets {
+		offsets[i] = d.Uint64()
+		if i > 0 && offsets[i] < offsets[i-1] {
+			d.Fail("level-0 offsets out of order")
+		}
+	}
+	if d.Err() == nil && offsets[len(offsets)-1] != uint64(d.Remaining()) {
+		d.Fail("level-0 lists take %d bytes, not %d", d.Remaining(), offsets[len(offsets)-1])
+	}
+	if d.Err() != nil {
+		return nil, nil
+	}
+	return ids, offsets
+}
+
+// edges returns the neighbors of the node at level
+func (r nodeRecord) edges(level int) map[string]float32 {
+	if level < len(r.Edges) {
+		return r.Edges[level]
+	}
+	return nil
+}
+
+// encodeNeighbors writes a neighbor list. Neighbors missing from the graph
+// are left out.
+func encodeNeighbors(e *index.Encoder, neighbors map[string]float32, positions map[string]uint32) {
+	type link struct {
+		position uint32
+		distance float32
+	}
+	links := make([]link, 0, len(neighbors))
+	for id, dist := range neighbors {
+		if position, ok := positions[id]; ok {
+			links = append(links, link{position, dist})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].position < links[j].position })
+
+	e.Uint32(uint32(len(links)))
+	for _, l := range links {
+		e.Uint32(l.position)
+		e.Float32(l.distance)
+	}
+}
+
+// decodeNeighbors reads a neighbor list of the nodes with the given IDs
+func decodeNeighbors(d *index.Decoder, ids []string) map[string]float32 {
+	n := d.Len(8)
+	neighbors := make(map[string]float32, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		position := d.Uint32()
+		dist := d.Float32()
+		if int(position) >= len(ids) {
+			d.Fail("neighbor %d of %d nodes", position, len(ids))
+			break
+		}
+		neighbors[ids[position]] = dist
+	}
+	return neighbors
+}
+
+// encode writes the configuration
+func (c configRecord) encode(e *index.Encoder) {
+	e.Int(c.M)
+	e.Int(c.M0)
+	e.Int(c.EfConstruction)
+	e.Int(c.EfSearch)
+	e.Int(c.MaxLevel)
+	e.Float64(c.LevelMult)
+	e.Int64(c.Seed)
+	e.Bool(c.Deterministic)
+	e.Bool(c.Heuristic)
+	e.Bool(c.ExtendCandidates)
+	e.Bool(c.KeepPruned)
+}
+
+// decode reads the configuration written by encode
+func (c *configRecord) decode(d *index.Decoder) {
+	c.M = d.Int()
+	c.M0 = d.Int()
+	c.EfConstruction = d.Int()
+	c.EfSearch = d.Int()
+	c.MaxLevel = d.Int()
+	c.LevelMult = d.Float64()
+	c.Seed = d.Int64()
+	c.Deterministic = d.Bool()
+	c.Heuristic = d.Bool()
+	c.ExtendCandidates = d.Bool()
+	c.KeepPruned = d.Bool()
+}
+
+// graphData is a loaded graph, whatever the version of its file
+type graphData struct {
+	nodes      map[string]*Node
+	entryPoint string
+	maxLevel   int
+	config     HNSWConfig
+	metric     string
+	pager      *pager // Reads the level-0 lists of a paged graph
+}
+
+// Save persists the index to the specified path in the index file format.
+// A paged index whose lists cannot all be read is not saved.
+func (idx *HNSWIndex) Save(path string) error {
+	// Snapshot the graph so inserts can continue while it is written
+	idx.mu.RLock()
+	data := fileV2{Nodes: make([]nodeRecord, 0, len(idx.nodes)), EntryPoint: idx.entryPoint, MaxLevel: idx.currentMaxLevel}
+	live, dimension := 0, 0
+	for _, node := range idx.nodes {
+		node, err := node.snapshot()
+		if err != nil {
+			idx.mu.RUnlock()
+			return fmt.Errorf("failed to save paged index: %w", err)
+		}
+		data.Nodes = append(data.Nodes, nodeRecord{Vector: index.NewVectorRecord(node.Vector), Level: node.Level, Deleted: node.Deleted, Edges: node.Edges})
+		if !node.Deleted {
+			live++
+		}
+		dimension = node.Vector.Dimension
+	}
+	c := idx.config
+	data.Config = configRecord{
+		M: c.M, M0: c.M0, EfConstruction: c.EfConstruction, EfSearch: c.EfSearch, MaxLevel: c.MaxLevel, LevelMult: c.LevelMult,
+		Seed: c.Seed, Deterministic: c.Deterministic, Heuristic: c.Heuristic, ExtendCandidates: c.ExtendCandidates, KeepPruned: c.KeepPruned,
+	}
+	header := index.FileHeader{Kind: fileKind, PayloadVersion: 2, Vectors: live, Dimension: dimension}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
+	}
+	idx.mu.RUnlock()
+
+	sort.Slice(data.Nodes, func(i, j int) bool { return data.Nodes[i].Vector.ID < data.Nodes[j].Vector.ID })
+	return index.WriteFile(path, header, data)
+}
+
+// Load loads the index from the specified path. Files saved before the
+// index file format existed are read as well. With PageCacheBlocks set, the
+// level-0 neighbor lists of current files stay on disk and are read as
+// searches reach them.
+func (idx *HNSWIndex) Load(path string) error {
+	idx.mu.RLock()
+	blocks := idx.config.PageCacheBlocks
+	idx.mu.RUnlock()
+
+	data, err := readPagedGraph(path, blocks)
+	if err != nil {
+		return err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// The graph's neighbors are only nearest under the metric it was built with
+	if idx.metric != nil && data.metric != "" && idx.metric.Name() != distance.MetricType(data.metric) {
+		data.pager.retire()
+		return fmt.Errorf("%w: built with %s, loaded for %s", ErrMetricMismatch, data.metric, idx.metric.Name())
+	}
+
+	// Searches of the graph being replaced keep reading its file until done
+	idx.pager.retire()
+	idx.pager = data.pager
+	idx.nodes = data.nodes
+	idx.entryPoint = data.entryPoint
+	idx.currentMaxLevel = data.maxLevel
+	idx.config = data.config
+	idx.config.PageCacheBlocks = blocks
+
+	// Set the metric if it's not already set
+	if idx.metric == nil && data.metric != "" {
+		metric, err := distance.GetMetric(distance.MetricType(data.metric))
+		if err != nil {
+			return err
+		}
+		idx.metric = metric
+	}
+
+	// Reseed from the loaded configuration
+	idx.rng = newRNG(idx.config)
+	return nil
+}
+
+// readGraph reads the graph in the file at path
+func readGraph(path string) (*graphData, error) {
+	header, payload, err := index.ReadFile(path, fileKind)
+	if errors.Is(err, index.ErrNotIndexFile) {
+		return readGraphV0(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file fileV2
+	switch header.PayloadVersion {
+	case 1:
+		var v1 fileV1
+		if err := index.DecodePayload(header, payload, &v1); err != nil {
+			return nil, err
+		}
+		file = fileV2{Config: v1.Config, EntryPoint: v1.EntryPoint, MaxLevel: v1.MaxLevel, Nodes: v1.Nodes}
+	case 2:
+		if err := index.DecodePayload(header, payload, &file); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: hnsw payload version %d", index.ErrFileVersion, header.PayloadVersion)
+	}
+	return newGraphData(&file, header.Metric), nil
+}
+
+// readPagedGraph reads the graph in the file at path but its level-0 lists,
+// which a pager caching the given number of blocks reads. Without blocks,
+// and for files of older versions, the whole graph is read.
+func readPagedGraph(path string, blocks int) (*graphData, error) {
+	if blocks <= 0 {
+		return readGraph(path)
+	}
+	file, err := index.OpenPayload(path, fileKind)
+	if err != nil {
+		if errors.Is(err, index.ErrNotIndexFile) {
+			return readGraph(path)
+		}
+		return nil, err
+	}
+	if file.Header.Version < 2 || file.Header.PayloadVersion != 2 {
+		file.Close()
+		return readGraph(path)
+	}
+
+	var head fileV2
+	d := file.Decoder()
+	ids, offsets := head.decodeHead(d)
+	if err := d.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := file.Verify(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	data := newGraphData(&head, file.Header.Metric)
+	data.pager = newPager(file.File, file.Start+int64(d.Offset()), offsets, ids, blocks)
+	for i, id := range ids {
+		node := data.nodes[id]
+		node.paged, node.position = data.pager, i
+	}
+	return data, nil
+}
+
+// newGraphData returns the graph a payload holds
+func newGraphData(file *fileV2, metric string) *graphData {
+	c := file.Config
+	data := &graphData{
+		nodes:      make(map[string]*Node, len(file.Nodes)),
+		entryPoint: file.EntryPoint,
+		maxLevel:   file.MaxLevel,
+		metric:     metric,
+		config: HNSWConfig{
+			M: c.M, M0: c.M0, EfConstruction: c.EfConstruction, EfSearch: c.EfSearch, MaxLevel: c.MaxLevel, LevelMult: c.LevelMult,
+			Seed: c.Seed, Deterministic: c.Deterministic, Heuristic: c.Heuristic, ExtendCandidates: c.ExtendCandidates, KeepPruned: c.KeepPruned,
+		},
+	}
+	for _, record := range file.Nodes {
+		data.nodes[record.Vector.ID] = &Node{Vector: record.Vector.Vector(), Edges: record.Edges, Level: record.Level, Deleted: record.Deleted}
+	}
+	return data
+}
+
+// readGraphV0 reads a graph saved as plain gob of the index's own types,
+// before the index file format existed
+func readGraphV0(path string) (*graphData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data struct {
+		Nodes           map[string]*Node
+		EntryPoint      string
+		CurrentMaxLevel int
+		Config          HNSWConfig
+		Metric          string
+	}
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return nil, err
+	}
+	return &graphData{nodes: data.Nodes, entryPoint: data.EntryPoint, maxLevel: data.CurrentMaxLevel, config: data.Config, metric: data.Metric}, nil
+}
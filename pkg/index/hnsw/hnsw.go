@@ -1,43 +1,51 @@
 package hnsw
 
 import (
-	"encoding/gob"
-	"errors"
 	"math"
 	"math/rand"
-	"os"
 	"sort"
 	"sync"
 
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
 	"github.com/ken/vector_database/pkg/index"
 )
 
 var (
 	// ErrVectorNotFound is returned when a vector with the specified ID is not found
-	ErrVectorNotFound = errors.New("vector not found")
+	ErrVectorNotFound = errs.ErrVectorNotFound
 
 	// ErrVectorAlreadyExists is returned when attempting to add a vector with an ID that already exists
-	ErrVectorAlreadyExists = errors.New("vector already exists")
+	ErrVectorAlreadyExists = errs.ErrVectorAlreadyExists
 
 	// ErrInvalidK is returned when k is less than 1
-	ErrInvalidK = errors.New("k must be greater than 0")
+	ErrInvalidK = errs.New(errs.InvalidArgument, "k must be greater than 0")
 
 	// ErrNoVectors is returned when the index is empty
-	ErrNoVectors = errors.New("index contains no vectors")
+	ErrNoVectors = errs.New(errs.FailedPrecondition, "index contains no vectors")
 
 	// ErrMetricRequired is returned when a distance metric is required but not set
-	ErrMetricRequired = errors.New("distance metric is required")
+	ErrMetricRequired = errs.New(errs.InvalidArgument, "distance metric is required")
+
+	// ErrMetricMismatch is returned when loading a graph built with another metric
+	ErrMetricMismatch = errs.New(errs.FailedPrecondition, "index was built with a different distance metric")
 )
 
 // HNSWConfig holds the configuration parameters for the HNSW index
 type HNSWConfig struct {
 	M              int     // Maximum number of connections per node (default: 16)
+	M0             int     // Maximum number of connections per node at level 0 (default: 2*M)
 	EfConstruction int     // Size of the dynamic candidate list for construction (default: 200)
 	EfSearch       int     // Size of the dynamic candidate list for search (default: 50)
 	MaxLevel       int     // Maximum level in the graph (default: calculated based on size)
 	LevelMult      float64 // Level probability multiplier (default: 1/ln(M))
+	Seed           int64   // Seed of the level assignment (default: random unless Deterministic)
+	Deterministic  bool    // Seed with Seed and visit neighbors in ID order, so the same vectors build the same graph
+	Heuristic      bool    // Select diverse neighbors instead of the M nearest (default: true)
+	ExtendCandidates bool  // Heuristic: also consider the neighbors of the candidates (default: false)
+	KeepPruned     bool    // Heuristic: fill up to M links with discarded candidates (default: false)
+	PageCacheBlocks int    // Load: keep level-0 neighbor lists on disk and cache this many blocks of them (default: 0, load the whole graph)
 }
 
 // DefaultHNSWConfig returns the default configuration for HNSW
@@ -49,7 +57,42 @@ func DefaultHNSWConfig() HNSWConfig {
 		EfSearch:       50,
 		MaxLevel:       0, // Will be calculated based on data size
 		LevelMult:      1.0 / math.Log(float64(m)),
+		Heuristic:      true,
+	}
+}
+
+// maxLinks returns the maximum number of connections per node at level
+func (c HNSWConfig) maxLinks(level int) int {
+	if level > 0 {
+		return c.M
+	}
+	if c.M0 > 0 {
+		return c.M0
+	}
+	return 2 * c.M
+}
+
+// NewHNSWConfig returns the default configuration with the given
+// parameters. Zero keeps the default of a parameter.
+func NewHNSWConfig(m, efConstruction, efSearch int) HNSWConfig {
+	cfg := DefaultHNSWConfig()
+	if m > 0 {
+		cfg.M = m
+		cfg.LevelMult = 1.0 / math.Log(float64(m))
 	}
+	if efConstruction > 0 {
+		cfg.EfConstruction = efConstruction
+	}
+	if efSearch > 0 {
+		cfg.EfSearch = efSearch
+	}
+	return cfg
+}
+
+// neighbor is a candidate or linked node and its distance
+type neighbor = struct {
+	ID       string
+	Distance float32
 }
 
 // Node represents a node in the HNSW graph
@@ -58,17 +101,29 @@ type Node struct {
 	Edges    []map[string]float32     // Edges[level][neighborID] = distance
 	Level    int                      // The level of this node in the graph
 	Deleted  bool                     // Whether this node has been marked as deleted
+	mu       sync.RWMutex             // Guards Edges and Deleted
+	paged    *pager                   // Reads Edges[0] while it is nil, for paged indexes
+	position int                      // Position of the node in the paged file
 }
 
-// HNSWIndex implements an HNSW (Hierarchical Navigable Small World) index
+// HNSWIndex implements an HNSW (Hierarchical Navigable Small World) index.
+//
+// Locking is striped: mu guards the node map, the entry point and the
+// configuration and is only held for short bookkeeping, while each node's
+// edges have their own lock. Searches and inserts therefore run concurrently,
+// including during Build; an insert only blocks the readers of the one
+// neighbor list it is updating. Locks are always taken in the order mu, then
+// a node, and never two nodes at once.
 type HNSWIndex struct {
 	nodes         map[string]*Node    // Map of vector ID to node
 	entryPoint    string              // ID of the entry point node (highest level)
 	currentMaxLevel int               // Current maximum level in the graph
 	metric        distance.Metric     // Distance metric to use
 	config        HNSWConfig          // Configuration parameters
-	mu            sync.RWMutex        // Mutex for thread safety
+	mu            sync.RWMutex        // Guards the fields above and rng
 	rng           *rand.Rand          // Random number generator for level assignment
+	progress      func(done, total int) // Called while Build adds vectors (optional)
+	pager         *pager              // Level-0 lists of a paged index (nil if in memory)
 }
 
 // NewHNSWIndex creates a new HNSW index with the specified distance metric and configuration
@@ -84,8 +139,25 @@ func NewHNSWIndex(metric distance.Metric, config *HNSWConfig) *HNSWIndex {
 		currentMaxLevel: 0,
 		metric:         metric,
 		config:         cfg,
-		rng:            rand.New(rand.NewSource(rand.Int63())),
+		rng:            newRNG(cfg),
+	}
+}
+
+// newRNG creates the level assignment source of cfg
+func newRNG(cfg HNSWConfig) *rand.Rand {
+	seed := cfg.Seed
+	if seed == 0 && !cfg.Deterministic {
+		seed = rand.Int63()
 	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// closer orders neighbors by distance and equally distant ones by ID
+func closer(aID string, aDist float32, bID string, bDist float32) bool {
+	if aDist != bDist {
+		return aDist < bDist
+	}
+	return aID < bID
 }
 
 // Name returns the name of the index
@@ -93,7 +165,7 @@ func (idx *HNSWIndex) Name() string {
 	return "hnsw"
 }
 
-// randomLevel generates a random level for a new node
+// randomLevel generates a random level for a new node (mu must be held)
 func (idx *HNSWIndex) randomLevel() int {
 	level := 0
 	for level < idx.config.MaxLevel && idx.rng.Float64() < idx.config.LevelMult {
@@ -102,20 +174,178 @@ func (idx *HNSWIndex) randomLevel() int {
 	return level
 }
 
-// distance calculates the distance between two vectors
-func (idx *HNSWIndex) distance(a, b *vector.Vector) (float32, error) {
-	if idx.metric == nil {
-		return 0, ErrMetricRequired
+// settings returns the metric and configuration in use
+func (idx *HNSWIndex) settings() (distance.Metric, HNSWConfig) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.metric, idx.config
+}
+
+// lookup returns the nodes with the given IDs, nil for unknown ones
+func (idx *HNSWIndex) lookup(ids ...string) []*Node {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	nodes := make([]*Node, len(ids))
+	for i, id := range ids {
+		nodes[i] = idx.nodes[id]
+	}
+	return nodes
+}
+
+// anyNode returns a node that is not deleted, or nil if there is none
+func (idx *HNSWIndex) anyNode() (string, *Node) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for id, node := range idx.nodes {
+		if !node.isDeleted() {
+			return id, node
+		}
+	}
+	return "", nil
+}
+
+// newNode creates an unlinked node for vec
+func newNode(vec *vector.Vector, level int) *Node {
+	node := &Node{
+		Vector: vec,
+		Edges:  make([]map[string]float32, level+1),
+		Level:  level,
+	}
+	for i := range node.Edges {
+		node.Edges[i] = make(map[string]float32)
+	}
+	return node
+}
+
+// isDeleted reports whether the node has been marked as deleted
+func (n *Node) isDeleted() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.Deleted
+}
+
+// edgesAt returns the node's edges at level, reading level 0 of a paged
+// node from its file (caller must hold n.mu)
+func (n *Node) edgesAt(level int) (map[string]float32, error) {
+	if level == 0 && n.Edges[0] == nil && n.paged != nil {
+		return n.paged.list(n.position)
+	}
+	return n.Edges[level], nil
+}
+
+// pin reads the level-0 edges of a paged node into memory for good, so they
+// can be changed. Edges that cannot be read are left on disk. (Caller must
+// hold n.mu for writing.)
+func (n *Node) pin() error {
+	if n.Edges[0] != nil || n.paged == nil {
+		return nil
+	}
+	edges, err := n.paged.list(n.position)
+	if err != nil {
+		return err
+	}
+	n.Edges[0] = make(map[string]float32, len(edges))
+	for id, dist := range edges {
+		n.Edges[0][id] = dist
+	}
+	return nil
+}
+
+// neighbors returns the IDs of the node's neighbors at level
+func (n *Node) neighbors(level int) ([]string, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if level >= len(n.Edges) {
+		return nil, nil
+	}
+	edges, err := n.edgesAt(level)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(edges))
+	for id := range edges {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// link adds an edge at level. If the level then has more than m edges it
+// is pruned to the m closest, or with heuristic its edges are returned
+// sorted by distance for the caller to select from.
+func (n *Node) link(level int, id string, dist float32, m int, heuristic bool) ([]neighbor, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if level >= len(n.Edges) {
+		return nil, nil
+	}
+	if err := n.pin(); err != nil {
+		return nil, err
+	}
+	n.Edges[level][id] = dist
+	if len(n.Edges[level]) <= m {
+		return nil, nil
+	}
+	if !heuristic {
+		pruneConnections(n, level, m)
+		return nil, nil
+	}
+
+	edges := make([]neighbor, 0, len(n.Edges[level]))
+	for id, dist := range n.Edges[level] {
+		edges = append(edges, neighbor{id, dist})
+	}
+	sortNeighbors(edges)
+	return edges, nil
+}
+
+// unlink removes the edges at level that are not kept. Edges added since
+// edges was read are left in place.
+func (n *Node) unlink(level int, edges, kept []neighbor) error {
+	keep := make(map[string]bool, len(kept))
+	for _, nbr := range kept {
+		keep[nbr.ID] = true
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.pin(); err != nil {
+		return err
+	}
+	for _, nbr := range edges {
+		if !keep[nbr.ID] {
+			delete(n.Edges[level], nbr.ID)
+		}
+	}
+	return nil
+}
+
+// snapshot returns a copy of the node whose edges are safe to read without
+// its lock
+func (n *Node) snapshot() (*Node, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	edges := make([]map[string]float32, len(n.Edges))
+	for level := range n.Edges {
+		neighbors, err := n.edgesAt(level)
+		if err != nil {
+			return nil, err
+		}
+		edges[level] = make(map[string]float32, len(neighbors))
+		for id, dist := range neighbors {
+			edges[level][id] = dist
+		}
 	}
-	return idx.metric.Distance(a, b)
+	return &Node{Vector: n.Vector, Edges: edges, Level: n.Level, Deleted: n.Deleted}, nil
 }
 
-// Build constructs the index from a set of vectors
+// Build constructs the index from a set of vectors. Searches keep running
+// while it adds the vectors and see the graph as it grows.
 func (idx *HNSWIndex) Build(vectors []*vector.Vector) error {
 	idx.mu.Lock()
-	defer idx.mu.Unlock()
 
 	// Reset the index
+	idx.pager.retire()
+	idx.pager = nil
 	idx.nodes = make(map[string]*Node)
 	idx.entryPoint = ""
 	idx.currentMaxLevel = 0
@@ -129,120 +359,266 @@ func (idx *HNSWIndex) Build(vectors []*vector.Vector) error {
 			idx.config.MaxLevel = 1 // Default for empty dataset
 		}
 	}
+	progress := idx.progress
+	idx.mu.Unlock()
 
 	// Add each vector to the index
-	for _, vec := range vectors {
-		err := idx.addInternal(vec.Copy()) // Store a copy of the vector
+	for i, vec := range vectors {
+		err := idx.insert(vec.Copy()) // Store a copy of the vector
 		if err != nil {
 			return err
 		}
+		if progress != nil {
+			progress(i+1, len(vectors))
+		}
 	}
 
 	return nil
 }
 
-// Add adds a vector to the index
-func (idx *HNSWIndex) Add(vec *vector.Vector) error {
+// SetBuildProgress sets a function called after each vector Build adds,
+// e.g. to draw a progress bar for large builds
+func (idx *HNSWIndex) SetBuildProgress(progress func(done, total int)) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
+	idx.progress = progress
+}
+
+// Add adds a vector to the index. It may be called concurrently with other
+// Adds and with searches.
+func (idx *HNSWIndex) Add(vec *vector.Vector) error {
+	return idx.insert(vec.Copy())
+}
+
+// insert adds a node to the index and links it into the graph. On a paged
+// index it fails if a neighbor list it would change cannot be read.
+func (idx *HNSWIndex) insert(vec *vector.Vector) (err error) {
+	defer idx.acquirePager()()
+	idx.mu.Lock()
 
 	// Check if the vector already exists
 	if _, exists := idx.nodes[vec.ID]; exists {
+		idx.mu.Unlock()
 		return ErrVectorAlreadyExists
 	}
 
-	return idx.addInternal(vec.Copy())
-}
-
-// addInternal adds a vector to the index (without locking)
-func (idx *HNSWIndex) addInternal(vec *vector.Vector) error {
-	// Generate a random level for the new node
+	// Register the node before linking it so concurrent inserts of the same
+	// ID fail; searches cannot reach it until a neighbor links to it
 	nodeLevel := idx.randomLevel()
-
-	// Create a new node with the given level
-	node := &Node{
-		Vector:  vec,
-		Edges:   make([]map[string]float32, nodeLevel+1),
-		Level:   nodeLevel,
-		Deleted: false,
-	}
-
-	// Initialize edge maps at each level
-	for i := 0; i <= nodeLevel; i++ {
-		node.Edges[i] = make(map[string]float32)
-	}
-
-	// Add the node to the index
+	node := newNode(vec, nodeLevel)
 	idx.nodes[vec.ID] = node
 
 	// If this is the first node, set it as the entry point and return
 	if idx.entryPoint == "" {
 		idx.entryPoint = vec.ID
 		idx.currentMaxLevel = nodeLevel
+		idx.mu.Unlock()
 		return nil
 	}
+	ep, maxLevel, cfg := idx.entryPoint, idx.currentMaxLevel, idx.config
+	idx.mu.Unlock()
 
-	// Get the entry point
-	ep := idx.entryPoint
-	
-	// Update max level if needed
-	if nodeLevel > idx.currentMaxLevel {
-		idx.currentMaxLevel = nodeLevel
-		idx.entryPoint = vec.ID
-	}
+	// A node that could not be linked is removed again, so the insert can be
+	// retried; links already made to it are skipped like deleted ones
+	defer func() {
+		if err != nil {
+			idx.mu.Lock()
+			if idx.nodes[vec.ID] == node {
+				delete(idx.nodes, vec.ID)
+			}
+			idx.mu.Unlock()
+		}
+	}()
 
 	// Connect the new node to the graph
-	for level := min(nodeLevel, idx.currentMaxLevel); level >= 0; level-- {
+	for level := min(nodeLevel, maxLevel); level >= 0; level-- {
 		// Search for nearest neighbors at current level
-		neighbors := idx.searchLayerInternal(vec, ep, idx.config.EfConstruction, level)
-		
-		// Connect to M nearest neighbors at this level
-		m := idx.config.M
-		if level == 0 {
-			// Allow more connections at the bottom level
-			m = 2 * idx.config.M
+		neighbors, err := idx.searchLayerInternal(vec, ep, cfg.EfConstruction, level, nil)
+		if err != nil {
+			return err
+		}
+
+		// Connect to M neighbors at this level, M0 at the bottom level
+		m := cfg.maxLinks(level)
+
+		// A concurrent insert may already have linked to this node
+		linked := neighbors[:0]
+		for _, nbr := range neighbors {
+			if nbr.ID != vec.ID {
+				linked = append(linked, nbr)
+			}
 		}
+		neighbors = linked
 
-		// Cap number of neighbors to avoid too many connections
-		if len(neighbors) > m {
-			neighbors = neighbors[:m]
+		// Keep at most m of the candidates
+		if neighbors, err = idx.selectNeighbors(vec, neighbors, m, level, true); err != nil {
+			return err
 		}
 
-		// Create bidirectional connections
+		// Connect new node to its neighbors
+		node.mu.Lock()
 		for _, nbr := range neighbors {
-			// Connect new node to neighbor
 			node.Edges[level][nbr.ID] = nbr.Distance
-			
-			// Connect neighbor to new node
-			neighborNode := idx.nodes[nbr.ID]
-			
-			// Skip deleted nodes
-			if neighborNode.Deleted {
+		}
+		node.mu.Unlock()
+
+		// Connect neighbors to new node, pruning those with too many connections
+		for i, neighborNode := range idx.lookup(ids(neighbors)...) {
+			if neighborNode == nil || neighborNode.isDeleted() {
 				continue
 			}
-			
-			// Ensure the neighbor has a map for this level
-			if level <= neighborNode.Level {
-				neighborNode.Edges[level][vec.ID] = nbr.Distance
-				
-				// Prune edges if neighbor has too many connections
-				if len(neighborNode.Edges[level]) > m {
-					idx.pruneConnections(neighborNode, level, m)
-				}
+			edges, err := neighborNode.link(level, vec.ID, neighbors[i].Distance, m, cfg.Heuristic)
+			if err != nil {
+				return err
+			}
+			if edges == nil {
+				continue
+			}
+			kept, err := idx.selectNeighbors(neighborNode.Vector, edges, m, level, false)
+			if err != nil {
+				return err
+			}
+			if err := neighborNode.unlink(level, edges, kept); err != nil {
+				return err
 			}
 		}
-		
+
 		// Update entry point for next level
 		if len(neighbors) > 0 {
 			ep = neighbors[0].ID
 		}
 	}
 
+	// A node above the current top level becomes the entry point once linked
+	if nodeLevel > maxLevel {
+		idx.mu.Lock()
+		if nodeLevel > idx.currentMaxLevel {
+			idx.currentMaxLevel = nodeLevel
+			idx.entryPoint = vec.ID
+		}
+		idx.mu.Unlock()
+	}
+
 	return nil
 }
 
-// pruneConnections reduces the number of connections at a specific level to m
-func (idx *HNSWIndex) pruneConnections(node *Node, level, m int) {
+// ids returns the IDs of neighbors
+func ids(neighbors []neighbor) []string {
+	ids := make([]string, len(neighbors))
+	for i, nbr := range neighbors {
+		ids[i] = nbr.ID
+	}
+	return ids
+}
+
+// sortNeighbors sorts neighbors by distance
+func sortNeighbors(neighbors []neighbor) {
+	sort.Slice(neighbors, func(i, j int) bool {
+		return closer(neighbors[i].ID, neighbors[i].Distance, neighbors[j].ID, neighbors[j].Distance)
+	})
+}
+
+// selectNeighbors picks up to m of the candidates, sorted by distance to
+// base, to link base to at level. Without the heuristic these are the m
+// nearest. With it (Malkov & Yashunin, Algorithm 4) a candidate is only
+// kept if it is closer to base than to every neighbor kept so far, which
+// spreads the links over clusters instead of spending them all on the
+// nearest one. Like hnswlib, m or fewer candidates are all kept.
+func (idx *HNSWIndex) selectNeighbors(base *vector.Vector, candidates []neighbor, m, level int, extend bool) ([]neighbor, error) {
+	metric, cfg := idx.settings()
+	if cfg.Heuristic && extend && cfg.ExtendCandidates && metric != nil {
+		var err error
+		if candidates, err = idx.extendCandidates(base, candidates, level, metric); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Heuristic || metric == nil || len(candidates) <= m {
+		if len(candidates) > m {
+			candidates = candidates[:m]
+		}
+		return candidates, nil
+	}
+
+	selected := make([]neighbor, 0, m)
+	selectedVecs := make([]*vector.Vector, 0, m)
+	var pruned []neighbor
+	for i, node := range idx.lookup(ids(candidates)...) {
+		if len(selected) >= m {
+			break
+		}
+		if node == nil {
+			continue
+		}
+
+		candidate := candidates[i]
+		diverse := true
+		for _, kept := range selectedVecs {
+			if dist, err := metric.Distance(node.Vector, kept); err == nil && dist < candidate.Distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate)
+			selectedVecs = append(selectedVecs, node.Vector)
+		} else {
+			pruned = append(pruned, candidate)
+		}
+	}
+
+	// Optionally fill the remaining links with the closest discarded candidates
+	if cfg.KeepPruned {
+		for _, candidate := range pruned {
+			if len(selected) >= m {
+				break
+			}
+			selected = append(selected, candidate)
+		}
+	}
+	return selected, nil
+}
+
+// extendCandidates adds the neighbors of the candidates at level to the
+// candidates, sorted by distance to base
+func (idx *HNSWIndex) extendCandidates(base *vector.Vector, candidates []neighbor, level int, metric distance.Metric) ([]neighbor, error) {
+	seen := map[string]bool{base.ID: true}
+	for _, candidate := range candidates {
+		seen[candidate.ID] = true
+	}
+
+	var extra []string
+	for _, node := range idx.lookup(ids(candidates)...) {
+		if node == nil {
+			continue
+		}
+		neighborIDs, err := node.neighbors(level)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range neighborIDs {
+			if !seen[id] {
+				seen[id] = true
+				extra = append(extra, id)
+			}
+		}
+	}
+
+	extended := append([]neighbor(nil), candidates...)
+	for i, node := range idx.lookup(extra...) {
+		if node == nil || node.isDeleted() {
+			continue
+		}
+		if dist, err := metric.Distance(base, node.Vector); err == nil {
+			extended = append(extended, neighbor{extra[i], dist})
+		}
+	}
+	sortNeighbors(extended)
+	return extended, nil
+}
+
+// pruneConnections reduces the number of connections at a specific level to
+// m (the node's lock must be held)
+func pruneConnections(node *Node, level, m int) {
 	// If we already have fewer than m connections, do nothing
 	if len(node.Edges[level]) <= m {
 		return
@@ -263,7 +639,7 @@ func (idx *HNSWIndex) pruneConnections(node *Node, level, m int) {
 
 	// Sort by distance
 	sort.Slice(neighbors, func(i, j int) bool {
-		return neighbors[i].Distance < neighbors[j].Distance
+		return closer(neighbors[i].ID, neighbors[i].Distance, neighbors[j].ID, neighbors[j].Distance)
 	})
 
 	// Create a new edge map with only the m closest neighbors
@@ -276,38 +652,49 @@ func (idx *HNSWIndex) pruneConnections(node *Node, level, m int) {
 	node.Edges[level] = newEdges
 }
 
-// searchLayerInternal performs a search within a single layer of the HNSW graph
-func (idx *HNSWIndex) searchLayerInternal(query *vector.Vector, entryID string, ef int, level int) []struct {
+// searchLayerInternal performs a search within a single layer of the HNSW
+// graph. It holds no lock across the search; each node is locked only while
+// its neighbors are read. The work done is added to stats if it is not nil.
+// It fails if the neighbors of a paged node cannot be read.
+func (idx *HNSWIndex) searchLayerInternal(query *vector.Vector, entryID string, ef int, level int, stats *index.SearchStats) ([]struct {
 	ID       string
 	Distance float32
-} {
-	// Check if the index is empty
-	if len(idx.nodes) == 0 {
-		return nil
+}, error) {
+	metric, cfg := idx.settings()
+	if metric == nil {
+		return nil, nil
 	}
 
 	// Get the entry point
-	entryNode, exists := idx.nodes[entryID]
-	if !exists || entryNode.Deleted {
+	entryNode := idx.lookup(entryID)[0]
+	if entryNode == nil || entryNode.isDeleted() {
 		// If the entry point is invalid, find any non-deleted node
-		for id, node := range idx.nodes {
-			if !node.Deleted {
-				entryID = id
-				entryNode = node
-				break
-			}
-		}
+		entryID, entryNode = idx.anyNode()
 		// If no valid nodes found, return empty result
-		if entryNode == nil || entryNode.Deleted {
-			return nil
+		if entryNode == nil {
+			return nil, nil
 		}
 	}
 
 	// Calculate distance to entry point
-	entryDist, err := idx.distance(query, entryNode.Vector)
+	entryDist, err := metric.Distance(query, entryNode.Vector)
 	if err != nil {
-		return nil
+		return nil, nil
+	}
+	if stats != nil {
+		stats.DistanceComputations++
+		stats.Visited++
+		stats.Reached(entryID)
+	}
+
+	// Neighbor distances are computed in batches per expanded node
+	batch, err := distance.NewDefaultBatchDistance(metric)
+	if err != nil {
+		return nil, err
 	}
+	var neighborIDs []string
+	var neighborVecs []*vector.Vector
+	var neighborDists []float32
 
 	// Initialize visited set to avoid revisiting nodes
 	visited := make(map[string]bool)
@@ -332,30 +719,71 @@ func (idx *HNSWIndex) searchLayerInternal(query *vector.Vector, entryID string,
 		}
 
 		// Get the current node
-		currentNode := idx.nodes[current.id]
-		if currentNode.Deleted || level > currentNode.Level {
+		currentNode := idx.lookup(current.id)[0]
+		if currentNode == nil || level > currentNode.Level || currentNode.isDeleted() {
 			continue
 		}
+		if stats != nil {
+			stats.Hops++
+		}
 
-		// Check all neighbors at this level
-		for neighborID, _ := range currentNode.Edges[level] {
+		// Collect the unvisited neighbors at this level
+		linked, err := currentNode.neighbors(level)
+		if err != nil {
+			return nil, err
+		}
+		neighborIDs = neighborIDs[:0]
+		for _, neighborID := range linked {
 			// Skip already visited nodes
 			if visited[neighborID] {
 				continue
 			}
 			visited[neighborID] = true
+			neighborIDs = append(neighborIDs, neighborID)
+		}
+		if cfg.Deterministic {
+			sort.Strings(neighborIDs)
+		}
 
-			// Get the neighbor node
-			neighborNode := idx.nodes[neighborID]
-			if neighborNode.Deleted {
+		// Skip deleted neighbors
+		neighborVecs = neighborVecs[:0]
+		kept := neighborIDs[:0]
+		for i, neighborNode := range idx.lookup(neighborIDs...) {
+			if neighborNode == nil || neighborNode.isDeleted() {
 				continue
 			}
+			kept = append(kept, neighborIDs[i])
+			neighborVecs = append(neighborVecs, neighborNode.Vector)
+		}
+		neighborIDs = kept
 
-			// Calculate distance to the neighbor
-			neighborDist, err := idx.distance(query, neighborNode.Vector)
-			if err != nil {
-				continue
+		// Calculate the distances to all neighbors in one batch
+		if cap(neighborDists) < len(neighborVecs) {
+			neighborDists = make([]float32, len(neighborVecs))
+		}
+		neighborDists = neighborDists[:len(neighborVecs)]
+		if err := batch.Distances(query, neighborVecs, neighborDists); err != nil {
+			// Fall back to one distance at a time, so a vector the batch
+			// cannot compute skips only itself rather than every neighbor
+			kept = neighborIDs[:0]
+			for i, neighborVec := range neighborVecs {
+				if dist, err := metric.Distance(query, neighborVec); err == nil {
+					neighborDists[len(kept)] = dist
+					kept = append(kept, neighborIDs[i])
+				}
+			}
+			neighborIDs = kept
+		}
+		if stats != nil {
+			stats.DistanceComputations += len(neighborIDs)
+			stats.Visited += len(neighborIDs)
+			for _, neighborID := range neighborIDs {
+				stats.Reached(neighborID)
 			}
+		}
+
+		for i, neighborID := range neighborIDs {
+			neighborDist := neighborDists[i]
 
 			// If the neighbor is closer than the furthest result or we haven't filled the results yet
 			if results.size() < ef || neighborDist < results.maxDist() {
@@ -380,11 +808,9 @@ func (idx *HNSWIndex) searchLayerInternal(query *vector.Vector, entryID string,
 	}
 
 	// Sort results by distance
-	sort.Slice(resultSlice, func(i, j int) bool {
-		return resultSlice[i].Distance < resultSlice[j].Distance
-	})
+	sortNeighbors(resultSlice)
 
-	return resultSlice
+	return resultSlice, nil
 }
 
 // Delete removes a vector from the index
@@ -399,7 +825,9 @@ func (idx *HNSWIndex) Delete(id string) error {
 	}
 
 	// Mark the node as deleted
+	node.mu.Lock()
 	node.Deleted = true
+	node.mu.Unlock()
 
 	// If the deleted node was the entry point, find a new entry point
 	if idx.entryPoint == id {
@@ -410,6 +838,7 @@ func (idx *HNSWIndex) Delete(id string) error {
 }
 
 // updateEntryPoint finds a new entry point after the current one is deleted
+// (mu must be held for writing)
 func (idx *HNSWIndex) updateEntryPoint() {
 	// Reset the entry point and max level
 	idx.entryPoint = ""
@@ -417,7 +846,11 @@ func (idx *HNSWIndex) updateEntryPoint() {
 
 	// Find the node with the highest level that isn't deleted
 	for id, node := range idx.nodes {
-		if !node.Deleted && node.Level > idx.currentMaxLevel {
+		if node.Level < idx.currentMaxLevel || node.Level == 0 || node.isDeleted() {
+			continue
+		}
+		// Ties go to the lowest ID, so the choice does not depend on map order
+		if node.Level > idx.currentMaxLevel || id < idx.entryPoint {
 			idx.entryPoint = id
 			idx.currentMaxLevel = node.Level
 		}
@@ -426,22 +859,46 @@ func (idx *HNSWIndex) updateEntryPoint() {
 	// If no entry point was found (all nodes are deleted), try to find any non-deleted node
 	if idx.entryPoint == "" {
 		for id, node := range idx.nodes {
-			if !node.Deleted {
+			if (idx.entryPoint == "" || id < idx.entryPoint) && !node.isDeleted() {
 				idx.entryPoint = id
 				idx.currentMaxLevel = node.Level
-				break
 			}
 		}
 	}
 }
 
-// Search performs a k-nearest neighbor search
+// entry returns the current entry point and top level, choosing a new entry
+// point if the current one was deleted
+func (idx *HNSWIndex) entry() (string, int) {
+	idx.mu.RLock()
+	ep, level := idx.entryPoint, idx.currentMaxLevel
+	node := idx.nodes[ep]
+	idx.mu.RUnlock()
+	if node != nil && !node.isDeleted() {
+		return ep, level
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.updateEntryPoint()
+	return idx.entryPoint, idx.currentMaxLevel
+}
+
+// Search performs a k-nearest neighbor search. It runs concurrently with
+// Add, Delete and Build.
 func (idx *HNSWIndex) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a k-nearest neighbor search tuned by opts
+func (idx *HNSWIndex) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
 	idx.mu.RLock()
-	defer idx.mu.RUnlock()
+	empty := len(idx.nodes) == 0
+	metric, cfg := idx.metric, idx.config
+	idx.mu.RUnlock()
 
 	// Check if the index is empty
-	if len(idx.nodes) == 0 {
+	if empty {
 		return nil, ErrNoVectors
 	}
 
@@ -451,70 +908,56 @@ func (idx *HNSWIndex) Search(query *vector.Vector, k int) (index.SearchResults,
 	}
 
 	// Check if a metric is set
-	if idx.metric == nil {
+	if metric == nil {
 		return nil, ErrMetricRequired
 	}
 
-	// If no valid entry point exists, try to find one
-	if idx.entryPoint == "" || idx.nodes[idx.entryPoint].Deleted {
-		// Count non-deleted nodes
-		validNodeCount := 0
-		for _, node := range idx.nodes {
-			if !node.Deleted {
-				validNodeCount++
-			}
-		}
-
-		// If no valid nodes, return error
-		if validNodeCount == 0 {
-			return nil, ErrNoVectors
-		}
+	// Reads of a paged index's file finish before a Load closes it
+	defer idx.acquirePager()()
 
-		// Release read lock and acquire write lock to update entry point
-		idx.mu.RUnlock()
-		idx.mu.Lock()
-		idx.updateEntryPoint()
-		idx.mu.Unlock()
-		idx.mu.RLock()
-		
-		// If still no entry point, the index is effectively empty
-		if idx.entryPoint == "" {
-			return nil, ErrNoVectors
-		}
+	// If no valid entry point exists, the index is effectively empty
+	ep, maxLevel := idx.entry()
+	if ep == "" {
+		return nil, ErrNoVectors
 	}
 
-	// Start from the top level and descend to level 0
-	ep := idx.entryPoint
-	
 	// Search from top level to level 1
-	for level := idx.currentMaxLevel; level > 0; level-- {
+	for level := maxLevel; level > 0; level-- {
 		// Find closest node at this level
-		neighbors := idx.searchLayerInternal(query, ep, 1, level)
+		neighbors, err := idx.searchLayerInternal(query, ep, 1, level, opts.Stats)
+		if err != nil {
+			return nil, err
+		}
 		if len(neighbors) > 0 {
 			ep = neighbors[0].ID
 		}
 	}
 
 	// Perform the final search at level 0 with ef=k
-	neighbors := idx.searchLayerInternal(query, ep, max(k, idx.config.EfSearch), 0)
+	ef := cfg.EfSearch
+	if opts.EfSearch > 0 {
+		ef = opts.EfSearch
+	}
+	neighbors, err := idx.searchLayerInternal(query, ep, max(k, ef), 0, opts.Stats)
+	if err != nil {
+		return nil, err
+	}
+	if len(neighbors) > k {
+		neighbors = neighbors[:k]
+	}
 
 	// Convert to SearchResults
-	results := make(index.SearchResults, 0, min(k, len(neighbors)))
-	for i, neighbor := range neighbors {
-		if i >= k {
-			break
-		}
-		
-		node := idx.nodes[neighbor.ID]
-		if node.Deleted {
+	results := make(index.SearchResults, 0, len(neighbors))
+	for i, node := range idx.lookup(ids(neighbors)...) {
+		if node == nil || node.isDeleted() {
 			continue
 		}
 		
-		results = append(results, index.SearchResult{
-			ID:       neighbor.ID,
-			Vector:   node.Vector.Copy(), // Return a copy to prevent modification
-			Distance: neighbor.Distance,
-		})
+		result := index.SearchResult{ID: neighbors[i].ID, Distance: neighbors[i].Distance}
+		if !opts.OmitVectors {
+			result.Vector = node.Vector.Copy() // Return a copy to prevent modification
+		}
+		results = append(results, result)
 	}
 
 	return results, nil
@@ -528,7 +971,7 @@ func (idx *HNSWIndex) Size() int {
 	// Count non-deleted nodes
 	count := 0
 	for _, node := range idx.nodes {
-		if !node.Deleted {
+		if !node.isDeleted() {
 			count++
 		}
 	}
@@ -544,7 +987,7 @@ func (idx *HNSWIndex) GetIDs() []string {
 	// Collect IDs of non-deleted nodes
 	ids := make([]string, 0, len(idx.nodes))
 	for id, node := range idx.nodes {
-		if !node.Deleted {
+		if !node.isDeleted() {
 			ids = append(ids, id)
 		}
 	}
@@ -552,105 +995,6 @@ func (idx *HNSWIndex) GetIDs() []string {
 	return ids
 }
 
-// Save persists the index to the specified path
-func (idx *HNSWIndex) Save(path string) error {
-	idx.mu.RLock()
-	defer idx.mu.RUnlock()
-
-	// Create the file
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Create a gob encoder
-	encoder := gob.NewEncoder(file)
-
-	// Create a serializable version of the index
-	type indexData struct {
-		Nodes           map[string]*Node
-		EntryPoint      string
-		CurrentMaxLevel int
-		Config          HNSWConfig
-		Metric          string
-	}
-
-	// Get the metric name
-	var metricName string
-	if idx.metric != nil {
-		metricName = string(idx.metric.Name())
-	}
-
-	// Encode the index
-	data := indexData{
-		Nodes:           idx.nodes,
-		EntryPoint:      idx.entryPoint,
-		CurrentMaxLevel: idx.currentMaxLevel,
-		Config:          idx.config,
-		Metric:          metricName,
-	}
-	
-	if err := encoder.Encode(data); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Load loads the index from the specified path
-func (idx *HNSWIndex) Load(path string) error {
-	idx.mu.Lock()
-	defer idx.mu.Unlock()
-
-	// Open the file
-	file, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Create a gob decoder
-	decoder := gob.NewDecoder(file)
-
-	// Define the serializable version of the index
-	type indexData struct {
-		Nodes           map[string]*Node
-		EntryPoint      string
-		CurrentMaxLevel int
-		Config          HNSWConfig
-		Metric          string
-	}
-
-	// Decode the index
-	var data indexData
-	if err := decoder.Decode(&data); err != nil {
-		return err
-	}
-
-	// Update the index
-	idx.nodes = data.Nodes
-	idx.entryPoint = data.EntryPoint
-	idx.currentMaxLevel = data.CurrentMaxLevel
-	idx.config = data.Config
-
-	// Set the metric if it's not already set
-	if idx.metric == nil && data.Metric != "" {
-		metric, err := distance.GetMetric(distance.MetricType(data.Metric))
-		if err != nil {
-			return err
-		}
-		idx.metric = metric
-	}
-
-	// Initialize RNG if not already initialized
-	if idx.rng == nil {
-		idx.rng = rand.New(rand.NewSource(rand.Int63()))
-	}
-
-	return nil
-}
-
 // SetMetric sets the distance metric used by the index
 func (idx *HNSWIndex) SetMetric(metric distance.Metric) {
 	idx.mu.Lock()
@@ -1,12 +1,21 @@
 package hnsw
 
 import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
 
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
 )
 
 func TestNewHNSWIndex(t *testing.T) {
@@ -478,6 +487,493 @@ func TestSaveLoad(t *testing.T) {
 	}
 }
 
+func TestLoadRejectsOtherMetric(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.gob")
+
+	original := NewHNSWIndex(&distance.EuclideanDistance{}, nil)
+	original.Add(vector.NewVector("v1", []float32{1.0, 2.0}))
+	if err := original.Save(indexPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	cosine := NewHNSWIndex(&distance.CosineDistance{}, nil)
+	if err := cosine.Load(indexPath); !errors.Is(err, ErrMetricMismatch) {
+		t.Fatalf("Expected ErrMetricMismatch, got %v", err)
+	}
+	if cosine.Size() != 0 {
+		t.Errorf("Expected a rejected load to leave the index empty, got %d vectors", cosine.Size())
+	}
+}
+
+func TestLoadLegacyFile(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.gob")
+
+	// Indexes used to be saved as plain gob of the index's own types
+	original := NewHNSWIndex(&distance.EuclideanDistance{}, nil)
+	for i := 0; i < 20; i++ {
+		original.Add(vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 1.0}))
+	}
+	file, err := os.Create(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	err = gob.NewEncoder(file).Encode(struct {
+		Nodes           map[string]*Node
+		EntryPoint      string
+		CurrentMaxLevel int
+		Config          HNSWConfig
+		Metric          string
+	}{original.nodes, original.entryPoint, original.currentMaxLevel, original.config, "euclidean"})
+	file.Close()
+	if err != nil {
+		t.Fatalf("Failed to encode legacy index: %v", err)
+	}
+
+	loaded := NewHNSWIndex(nil, nil)
+	if err := loaded.Load(indexPath); err != nil {
+		t.Fatalf("Load of a legacy file failed: %v", err)
+	}
+	if loaded.Size() != 20 || loaded.entryPoint != original.entryPoint || loaded.metric == nil {
+		t.Fatalf("Unexpected legacy index: %d nodes, entry point %s", loaded.Size(), loaded.entryPoint)
+	}
+
+	// Saving it again writes the versioned format
+	if err := loaded.Save(indexPath); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	header, err := index.InspectFile(indexPath)
+	if err != nil || header.Kind != "hnsw" || header.Vectors != 20 || header.Dimension != 2 || header.Metric != "euclidean" {
+		t.Errorf("Unexpected header %+v (%v)", header, err)
+	}
+	results, err := loaded.Search(vector.NewVector("q", []float32{7, 1}), 1)
+	if err != nil || len(results) != 1 || results[0].ID != "v7" {
+		t.Errorf("Expected v7, got %+v (%v)", results, err)
+	}
+}
+
+func TestSaveIsDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	original := NewHNSWIndex(&distance.CosineDistance{}, nil)
+	for i := 0; i < 200; i++ {
+		original.Add(vector.NewVectorWithMetadata(fmt.Sprintf("v%d", i), []float32{float32(i), float32(i % 7), 1}, map[string]string{"a": "1", "b": fmt.Sprint(i)}))
+	}
+	original.Delete("v3")
+
+	// Saving twice, or saving what was loaded, gives the same bytes
+	first, second := filepath.Join(dir, "first.idx"), filepath.Join(dir, "second.idx")
+	if err := original.Save(first); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	loaded := NewHNSWIndex(nil, nil)
+	if err := loaded.Load(first); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := loaded.Save(second); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	a, _ := os.ReadFile(first)
+	b, _ := os.ReadFile(second)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("Expected a loaded index to save to the same bytes")
+	}
+	for id, node := range original.nodes {
+		if !reflect.DeepEqual(loaded.nodes[id].Edges, node.Edges) || loaded.nodes[id].Deleted != node.Deleted {
+			t.Fatalf("Node %s was not kept: %+v", id, loaded.nodes[id])
+		}
+	}
+
+	// Files whose payload is gob still load
+	v1 := fileV1{EntryPoint: original.entryPoint, MaxLevel: original.currentMaxLevel, Config: configRecord{M: 16, M0: 32, EfSearch: 50}}
+	for _, node := range original.nodes {
+		v1.Nodes = append(v1.Nodes, nodeRecord{Vector: index.NewVectorRecord(node.Vector), Level: node.Level, Deleted: node.Deleted, Edges: node.Edges})
+	}
+	var payload bytes.Buffer
+	gob.NewEncoder(&payload).Encode(v1)
+	header := &index.FileHeader{Version: 1, Kind: fileKind, PayloadVersion: 1}
+	var file fileV1
+	if err := index.DecodePayload(header, payload.Bytes(), &file); err != nil || len(file.Nodes) != 200 {
+		t.Fatalf("Expected the gob payload to decode, got %d nodes (%v)", len(file.Nodes), err)
+	}
+}
+
+func TestPagedLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.idx")
+	gen, _ := vector.NewGenerator(vector.Gaussian, 1)
+	vectors := make([]*vector.Vector, 500)
+	for i := range vectors {
+		vectors[i] = gen.Next(fmt.Sprintf("v%03d", i), 8)
+	}
+	original := NewHNSWIndex(&distance.EuclideanDistance{}, &HNSWConfig{M: 8, EfConstruction: 64, EfSearch: 32, LevelMult: 0.5, Seed: 1, Deterministic: true})
+	if err := original.Build(vectors); err != nil {
+		t.Fatal(err)
+	}
+	if err := original.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	paged := NewHNSWIndex(nil, &HNSWConfig{PageCacheBlocks: 2})
+	if err := paged.Load(path); err != nil {
+		t.Fatalf("Paged load failed: %v", err)
+	}
+	defer paged.Close()
+	for _, node := range paged.nodes {
+		if node.Edges[0] != nil {
+			t.Fatalf("Expected level 0 of %s to stay on disk", node.Vector.ID)
+		}
+	}
+
+	// Searches page lists in and find what the whole graph finds
+	for i := 0; i < 20; i++ {
+		query := gen.Next("q", 8)
+		want, _ := original.Search(query, 5)
+		got, err := paged.Search(query, 5)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("Expected %v, got %v (%v)", want, got, err)
+		}
+	}
+	stats, ok := paged.PagingStats()
+	if !ok || stats.Blocks != 8 || stats.CachedBlocks > 2 || stats.CacheSize != 2 || stats.Misses == 0 || stats.Hits == 0 {
+		t.Errorf("Unexpected paging stats %+v", stats)
+	}
+	if paged.config.M != 8 || paged.config.PageCacheBlocks != 2 {
+		t.Errorf("Expected the file's configuration with paging kept, got %+v", paged.config)
+	}
+
+	// Inserts keep the lists they change in memory, and saving writes them all
+	if err := paged.Add(vector.NewVector("new", vectors[0].Values)); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	resaved := filepath.Join(t.TempDir(), "resaved.idx")
+	if err := paged.Save(resaved); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	whole := NewHNSWIndex(nil, nil)
+	if err := whole.Load(resaved); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if whole.Size() != 501 || len(whole.nodes["new"].Edges[0]) == 0 {
+		t.Fatalf("Expected the inserted node to be saved with its links, got %d nodes", whole.Size())
+	}
+	if _, ok := whole.PagingStats(); ok {
+		t.Error("Expected an index loaded without PageCacheBlocks to be in memory")
+	}
+
+	// A load keeps the replaced file open for the searches still using it
+	release := paged.acquirePager()
+	replaced := paged.pager
+	if err := paged.Load(resaved); err != nil {
+		t.Fatalf("Paged load failed: %v", err)
+	}
+	if _, err := replaced.list(0); err != nil {
+		t.Errorf("Expected the replaced file to stay open for its reader, got %v", err)
+	}
+	release()
+	if _, err := replaced.list(0); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Expected the replaced file to be closed after its last reader, got %v", err)
+	}
+
+	// A corrupt file is refused before anything is paged
+	data, _ := os.ReadFile(path)
+	data[len(data)-3] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	if err := NewHNSWIndex(nil, &HNSWConfig{PageCacheBlocks: 2}).Load(path); !errors.Is(err, index.ErrFileChecksum) {
+		t.Errorf("Expected ErrFileChecksum, got %v", err)
+	}
+
+	// Lists that cannot be read fail searches rather than go missing
+	paged.Close()
+	if _, err := paged.Search(gen.Next("q", 8), 5); err == nil {
+		t.Error("Expected searches of a closed paged index to fail")
+	}
+	if err := paged.Add(vector.NewVector("late", vectors[1].Values)); err == nil {
+		t.Error("Expected inserts into a closed paged index to fail")
+	}
+	if _, ok := paged.nodes["late"]; ok {
+		t.Error("Expected a failed insert to leave no node")
+	}
+	unsaved := filepath.Join(t.TempDir(), "unsaved.idx")
+	if err := paged.Save(unsaved); err == nil {
+		t.Error("Expected saving a closed paged index to fail")
+	}
+	if _, err := os.Stat(unsaved); !os.IsNotExist(err) {
+		t.Error("Expected no file from a failed save")
+	}
+}
+
+func TestDeterministicBuild(t *testing.T) {
+	gen, _ := vector.NewGenerator(vector.Gaussian, 1)
+	vectors := make([]*vector.Vector, 300)
+	for i := range vectors {
+		vectors[i] = gen.Next(fmt.Sprintf("v%03d", i), 8)
+	}
+	// Equally distant neighbors must not make the graph depend on map order
+	vectors = append(vectors, vector.NewVector("tie-a", []float32{1, 0, 0, 0, 0, 0, 0, 0}), vector.NewVector("tie-b", []float32{0, 1, 0, 0, 0, 0, 0, 0}))
+
+	build := func(seed int64) *HNSWIndex {
+		cfg := NewHNSWConfig(8, 64, 32)
+		cfg.Seed = seed
+		cfg.Deterministic = true
+		idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+		if err := idx.Build(vectors); err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		return idx
+	}
+
+	first, second := build(7), build(7)
+	if first.entryPoint != second.entryPoint {
+		t.Errorf("Expected the same entry point, got %s and %s", first.entryPoint, second.entryPoint)
+	}
+	for id, node := range first.nodes {
+		other := second.nodes[id]
+		if node.Level != other.Level || !reflect.DeepEqual(node.Edges, other.Edges) {
+			t.Fatalf("Node %s differs between builds with the same seed", id)
+		}
+	}
+
+	query := vector.NewVector("q", []float32{0.5, 0.5, 0, 0, 0, 0, 0, 0})
+	a, _ := first.Search(query, 10)
+	b, _ := second.Search(query, 10)
+	if !reflect.DeepEqual(a, b) {
+		t.Errorf("Expected identical results, got %v and %v", a, b)
+	}
+
+	other := build(8)
+	sameLevels := true
+	for id, node := range first.nodes {
+		sameLevels = sameLevels && node.Level == other.nodes[id].Level
+	}
+	if sameLevels {
+		t.Error("Expected another seed to assign other levels")
+	}
+}
+
+func TestConcurrentAddAndSearch(t *testing.T) {
+	gen, _ := vector.NewGenerator(vector.Gaussian, 3)
+	vectors := make([]*vector.Vector, 500)
+	for i := range vectors {
+		vectors[i] = gen.Next(fmt.Sprintf("v%03d", i), 8)
+	}
+
+	idx := NewHNSWIndex(&distance.EuclideanDistance{}, nil)
+	if err := idx.Build(vectors[:100]); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// Searches keep returning results while writers stream inserts in
+	done := make(chan struct{})
+	var searches sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		searches.Add(1)
+		go func() {
+			defer searches.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				results, err := idx.Search(vectors[0], 5)
+				if err != nil || len(results) == 0 {
+					t.Errorf("Search during inserts returned %v, %v", results, err)
+					return
+				}
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for i := 100 + w; i < len(vectors); i += 4 {
+				if err := idx.Add(vectors[i]); err != nil {
+					t.Errorf("Add(%s) failed: %v", vectors[i].ID, err)
+				}
+			}
+		}(w)
+	}
+	writers.Wait()
+	close(done)
+	searches.Wait()
+
+	if idx.Size() != len(vectors) {
+		t.Fatalf("Expected %d vectors, got %d", len(vectors), idx.Size())
+	}
+	if err := idx.Add(vectors[5]); !errors.Is(err, ErrVectorAlreadyExists) {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	// Vectors inserted concurrently are linked into the graph
+	found := 0
+	for _, vec := range vectors[100:] {
+		results, err := idx.Search(vec, 1)
+		if err == nil && len(results) > 0 && results[0].ID == vec.ID {
+			found++
+		}
+	}
+	if recall := float64(found) / float64(len(vectors)-100); recall < 0.95 {
+		t.Errorf("Expected concurrently added vectors to find themselves, recall %.2f", recall)
+	}
+}
+
+// clusteredVectors creates tight clusters far apart, where linking only the
+// nearest candidates leaves the clusters disconnected
+func clusteredVectors(clusters, size, dim int) []*vector.Vector {
+	rng := rand.New(rand.NewSource(1))
+	var vectors []*vector.Vector
+	for c := 0; c < clusters; c++ {
+		center := make([]float32, dim)
+		for d := range center {
+			center[d] = float32(rng.NormFloat64() * 10)
+		}
+		for i := 0; i < size; i++ {
+			values := make([]float32, dim)
+			for d := range values {
+				values[d] = center[d] + float32(rng.NormFloat64()*0.1)
+			}
+			vectors = append(vectors, vector.NewVector(fmt.Sprintf("c%02d-%02d", c, i), values))
+		}
+	}
+	return vectors
+}
+
+// recallAt10 returns the share of the exact 10 nearest neighbors idx finds
+func recallAt10(t *testing.T, idx *HNSWIndex, vectors []*vector.Vector) float64 {
+	return recallAt10With(t, idx, vectors, index.SearchOptions{})
+}
+
+// recallAt10With returns the recall of searches tuned by opts
+func recallAt10With(t *testing.T, idx *HNSWIndex, vectors []*vector.Vector, opts index.SearchOptions) float64 {
+	metric := &distance.EuclideanDistance{}
+	found, total := 0, 0
+	for q := 0; q < len(vectors); q += 7 {
+		query := vectors[q]
+		exact := append([]*vector.Vector(nil), vectors...)
+		sort.Slice(exact, func(i, j int) bool {
+			a, _ := metric.Distance(query, exact[i])
+			b, _ := metric.Distance(query, exact[j])
+			return a < b
+		})
+		truth := make(map[string]bool)
+		for _, vec := range exact[:10] {
+			truth[vec.ID] = true
+		}
+
+		results, err := idx.SearchWithOptions(query, 10, opts)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		for _, result := range results {
+			if truth[result.ID] {
+				found++
+			}
+		}
+		total += 10
+	}
+	return float64(found) / float64(total)
+}
+
+func TestHeuristicNeighborSelection(t *testing.T) {
+	vectors := clusteredVectors(30, 20, 8)
+	recall := func(heuristic, extend, keepPruned bool) float64 {
+		cfg := NewHNSWConfig(4, 16, 10)
+		cfg.Seed = 1
+		cfg.Deterministic = true
+		cfg.Heuristic, cfg.ExtendCandidates, cfg.KeepPruned = heuristic, extend, keepPruned
+		idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+		if err := idx.Build(vectors); err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		return recallAt10(t, idx, vectors)
+	}
+
+	if !DefaultHNSWConfig().Heuristic {
+		t.Error("Expected the heuristic to be the default")
+	}
+
+	nearest := recall(false, false, false)
+	for _, tc := range []struct {
+		name               string
+		extend, keepPruned bool
+	}{
+		{"heuristic", false, false},
+		{"extendCandidates", true, false},
+		{"keepPruned", false, true},
+	} {
+		if got := recall(true, tc.extend, tc.keepPruned); got < nearest+0.2 {
+			t.Errorf("%s: expected recall well above %.2f with the M nearest, got %.2f", tc.name, nearest, got)
+		}
+	}
+}
+
+func TestGraphStats(t *testing.T) {
+	gen, _ := vector.NewGenerator(vector.Gaussian, 5)
+	vectors := make([]*vector.Vector, 200)
+	for i := range vectors {
+		vectors[i] = gen.Next(fmt.Sprintf("v%03d", i), 8)
+	}
+
+	cfg := NewHNSWConfig(4, 32, 16)
+	cfg.M0 = 5
+	cfg.Seed = 1
+	cfg.Deterministic = true
+	idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if err := idx.Delete("v000"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	stats, err := idx.GraphStats()
+	if err != nil {
+		t.Fatalf("GraphStats failed: %v", err)
+	}
+	if stats.Nodes != 199 || stats.Deleted != 1 {
+		t.Errorf("Expected 199 nodes and 1 deleted, got %d and %d", stats.Nodes, stats.Deleted)
+	}
+	// Pruning may leave a few nodes without incoming edges
+	if stats.Components != 1 || stats.Unreachable > stats.Nodes/10 {
+		t.Errorf("Expected one connected component, got %d with %d unreachable nodes", stats.Components, stats.Unreachable)
+	}
+
+	top := 0
+	for _, level := range stats.Levels {
+		top += level.Top
+		if level.MaxDegree > level.MaxLinks {
+			t.Errorf("Level %d: %d edges exceed the limit of %d", level.Level, level.MaxDegree, level.MaxLinks)
+		}
+	}
+	if top != stats.Nodes || stats.Levels[0].Nodes != stats.Nodes {
+		t.Errorf("Expected the level histogram to cover all %d nodes, got %+v", stats.Nodes, stats.Levels)
+	}
+	if stats.Levels[0].MaxLinks != 5 || len(stats.Levels) > 1 && stats.Levels[1].MaxLinks != 4 {
+		t.Errorf("Expected M0 at level 0 and M above, got %+v", stats.Levels)
+	}
+
+	// Cutting a node off splits the graph
+	id := "v001"
+	if id == stats.EntryPoint {
+		id = "v002"
+	}
+	isolated := idx.nodes[id]
+	for _, node := range idx.nodes {
+		for _, edges := range node.Edges {
+			delete(edges, id)
+		}
+	}
+	for _, edges := range isolated.Edges {
+		for id := range edges {
+			delete(edges, id)
+		}
+	}
+	if after, _ := idx.GraphStats(); after.Components != 2 || after.Unreachable != stats.Unreachable+1 {
+		t.Errorf("Expected an isolated node, got %d components and %d unreachable nodes", after.Components, after.Unreachable)
+	}
+}
+
 func TestSetMetric(t *testing.T) {
 	// Create an index with one metric
 	idx := NewHNSWIndex(&distance.EuclideanDistance{}, nil)
@@ -543,4 +1039,85 @@ func TestEmptyIndex(t *testing.T) {
 	if err != ErrNoVectors {
 		t.Errorf("Expected ErrNoVectors, got %v", err)
 	}
-} 
\ No newline at end of file
+} 
+
+func TestSearchEfSearchOverride(t *testing.T) {
+	vectors := clusteredVectors(30, 20, 8)
+	cfg := NewHNSWConfig(4, 16, 10)
+	cfg.Seed = 1
+	cfg.Deterministic = true
+	idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// A larger candidate list per search finds more true neighbors without
+	// rebuilding the graph
+	base := recallAt10(t, idx, vectors)
+	wide := recallAt10With(t, idx, vectors, index.SearchOptions{EfSearch: 200})
+	if wide <= base {
+		t.Errorf("Expected ef_search 200 to beat the built-in ef 10, got %.2f vs %.2f", wide, base)
+	}
+}
+
+func TestSearchStats(t *testing.T) {
+	vectors := clusteredVectors(30, 20, 8)
+	cfg := NewHNSWConfig(4, 16, 10)
+	cfg.Seed = 1
+	cfg.Deterministic = true
+	idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	count := func(ef int) index.SearchStats {
+		stats := index.SearchStats{}
+		results, err := idx.SearchWithOptions(vectors[0], 5, index.SearchOptions{EfSearch: ef, Stats: &stats})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		for _, result := range results {
+			found, ok := stats.Found[result.ID]
+			if !ok {
+				t.Fatalf("Expected stats for result %s", result.ID)
+			}
+			if found.DistanceComputations > stats.DistanceComputations || found.Hops > stats.Hops {
+				t.Errorf("Result %s was found after more work than the whole search: %+v > %+v", result.ID, found, stats.SearchCounters)
+			}
+		}
+		return stats
+	}
+
+	// The graph is explored instead of scanned, and wider searches do more work
+	narrow := count(10)
+	if narrow.Hops == 0 || narrow.DistanceComputations >= len(vectors) {
+		t.Errorf("Expected a partial graph search, got %+v", narrow.SearchCounters)
+	}
+	if wide := count(200); wide.DistanceComputations <= narrow.DistanceComputations {
+		t.Errorf("Expected ef_search 200 to compute more distances, got %d vs %d", wide.DistanceComputations, narrow.DistanceComputations)
+	}
+}
+
+func TestSearchSkipsUncomputableNeighbors(t *testing.T) {
+	vectors := clusteredVectors(5, 20, 8)
+	cfg := NewHNSWConfig(4, 16, 10)
+	cfg.Seed = 1
+	cfg.Deterministic = true
+	idx := NewHNSWIndex(&distance.EuclideanDistance{}, &cfg)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	// A neighbor of another dimension fails its batch, but not the others
+	idx.nodes["odd"] = newNode(vector.NewVector("odd", []float32{1, 2, 3}), 0)
+	for _, node := range idx.nodes {
+		node.Edges[0]["odd"] = 0
+	}
+	results, err := idx.Search(vectors[0], 5)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 5 || results[0].ID != vectors[0].ID {
+		t.Errorf("Expected 5 results led by %s, got %v", vectors[0].ID, results)
+	}
+}
@@ -0,0 +1,198 @@
+package hnsw
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/index"
+)
+
+// blockNodes is the number of consecutive level-0 lists read and cached
+// together
+const blockNodes = 64
+
+// PagingStats describe the level-0 neighbor lists of a paged index
+type PagingStats struct {
+	Blocks       int    `json:"blocks"`        // Blocks of lists in the file
+	CachedBlocks int    `json:"cached_blocks"` // Blocks held in memory
+	CacheSize    int    `json:"cache_size"`    // Blocks the cache holds at most
+	Hits         uint64 `json:"hits"`          // Block reads served from the cache
+	Misses       uint64 `json:"misses"`        // Block reads from the file
+}
+
+// pager reads the level-0 neighbor lists of a graph from its index file as
+// searches reach them. Lists are read in blocks of consecutive nodes, and
+// the most recently used blocks are cached, so memory stays bounded by the
+// vectors, the upper layers and the cache.
+type pager struct {
+	file    *os.File
+	start   int64    // File offset of the level-0 lists
+	offsets []uint64 // Offset of each node's list from start, then their end
+	ids     []string // Node IDs by position
+
+	mu      sync.Mutex
+	size    int
+	blocks  map[int]*list.Element // Cached blocks by number
+	lru     *list.List            // Of *pagedBlock, most recently used first
+	hits    uint64
+	misses  uint64
+	readers int  // Operations using the graph, which keep the file open
+	retired bool // The index no longer uses the graph; the last reader closes the file
+	closed  bool
+}
+
+// pagedBlock is a cached block of level-0 lists
+type pagedBlock struct {
+	number int
+	lists  []map[string]float32
+}
+
+// newPager creates a pager of the lists at start of file that caches size
+// blocks
+func newPager(file *os.File, start int64, offsets []uint64, ids []string, size int) *pager {
+	return &pager{file: file, start: start, offsets: offsets, ids: ids, size: size, blocks: make(map[int]*list.Element), lru: list.New()}
+}
+
+// list returns the level-0 list of the node at position. The list is shared
+// and must not be changed.
+func (p *pager) list(position int) (map[string]float32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, fmt.Errorf("%w: level-0 lists of %s", os.ErrClosed, p.file.Name())
+	}
+
+	number := position / blockNodes
+	if element, ok := p.blocks[number]; ok {
+		p.hits++
+		p.lru.MoveToFront(element)
+		return element.Value.(*pagedBlock).lists[position%blockNodes], nil
+	}
+
+	p.misses++
+	block, err := p.read(number)
+	if err != nil {
+		return nil, err
+	}
+	p.blocks[number] = p.lru.PushFront(block)
+	for p.lru.Len() > p.size {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		delete(p.blocks, oldest.Value.(*pagedBlock).number)
+	}
+	return block.lists[position%blockNodes], nil
+}
+
+// read reads a block from the file
+func (p *pager) read(number int) (*pagedBlock, error) {
+	first := number * blockNodes
+	last := min(first+blockNodes, len(p.ids))
+	buf := make([]byte, p.offsets[last]-p.offsets[first])
+	if _, err := p.file.ReadAt(buf, p.start+int64(p.offsets[first])); err != nil {
+		return nil, fmt.Errorf("failed to read level-0 lists of %s: %w", p.file.Name(), err)
+	}
+
+	block := &pagedBlock{number: number, lists: make([]map[string]float32, last-first)}
+	d := index.NewDecoder(buf)
+	for i := range block.lists {
+		block.lists[i] = decodeNeighbors(d, p.ids)
+	}
+	if d.Err() == nil && d.Remaining() > 0 {
+		d.Fail("level-0 block %d has %d trailing bytes", number, d.Remaining())
+	}
+	if d.Err() != nil {
+		return nil, fmt.Errorf("%s: %w", p.file.Name(), d.Err())
+	}
+	return block, nil
+}
+
+// acquire registers a reader of the graph, which keeps the file open until
+// it calls release
+func (p *pager) acquire() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers++
+}
+
+// release unregisters a reader, closing the file after the last reader of
+// a retired pager
+func (p *pager) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.readers--
+	if p.retired && p.readers == 0 {
+		p.closeFile()
+	}
+}
+
+// retire closes the file once the readers of the graph are done. Reads
+// after that fail.
+func (p *pager) retire() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.retired = true
+	if p.readers == 0 {
+		p.closeFile()
+	}
+}
+
+// closeFile closes the file (caller must hold p.mu)
+func (p *pager) closeFile() {
+	if !p.closed {
+		p.closed = true
+		p.file.Close()
+	}
+}
+
+// stats returns the paging stats
+func (p *pager) stats() PagingStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return PagingStats{
+		Blocks:       (len(p.ids) + blockNodes - 1) / blockNodes,
+		CachedBlocks: p.lru.Len(),
+		CacheSize:    p.size,
+		Hits:         p.hits,
+		Misses:       p.misses,
+	}
+}
+
+// acquirePager registers the caller as a reader of a paged index's file,
+// so a concurrent Load or Close does not close it under the caller. The
+// returned function releases it.
+func (idx *HNSWIndex) acquirePager() func() {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	p := idx.pager
+	if p == nil {
+		return func() {}
+	}
+	p.acquire()
+	return p.release
+}
+
+// PagingStats returns the paging stats of an index loaded with
+// PageCacheBlocks, and false if its graph is fully in memory
+func (idx *HNSWIndex) PagingStats() (PagingStats, bool) {
+	idx.mu.RLock()
+	p := idx.pager
+	idx.mu.RUnlock()
+	if p == nil {
+		return PagingStats{}, false
+	}
+	return p.stats(), true
+}
+
+// Close closes the index file of a paged index once the searches running
+// are done. Searches, inserts and saves that need its lists fail afterwards.
+func (idx *HNSWIndex) Close() error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	idx.pager.retire()
+	return nil
+}
@@ -0,0 +1,144 @@
+package hnsw
+
+// LevelStats describes one level of an HNSW graph
+type LevelStats struct {
+	Level     int     `json:"level"`
+	Nodes     int     `json:"nodes"`      // Nodes present at this level
+	Top       int     `json:"top"`        // Nodes whose highest level is this one
+	MaxLinks  int     `json:"max_links"`  // Connection limit per node
+	AvgDegree float64 `json:"avg_degree"` // Average number of outgoing edges
+	MaxDegree int     `json:"max_degree"`
+}
+
+// GraphStats describes the shape of an HNSW graph, to help diagnose poor
+// recall. Deleted nodes are not counted except in Deleted.
+type GraphStats struct {
+	Nodes       int          `json:"nodes"`
+	Deleted     int          `json:"deleted"`
+	EntryPoint  string       `json:"entry_point"`
+	MaxLevel    int          `json:"max_level"`
+	Levels      []LevelStats `json:"levels"`
+	Components  int          `json:"components"`       // Connected components of level 0, ignoring edge direction
+	Unreachable int          `json:"unreachable"`      // Nodes searches cannot reach from the entry point
+	Paging      *PagingStats `json:"paging,omitempty"` // Level-0 links read from disk, for paged indexes
+}
+
+// GraphStats computes statistics of the graph. It works on a snapshot, so
+// inserts may continue meanwhile. It fails if the lists of a paged index
+// cannot be read.
+func (idx *HNSWIndex) GraphStats() (GraphStats, error) {
+	// Taken first, as the snapshot reads every level-0 list
+	paging, paged := idx.PagingStats()
+
+	idx.mu.RLock()
+	nodes := make(map[string]*Node, len(idx.nodes))
+	deleted := 0
+	for id, node := range idx.nodes {
+		snapshot, err := node.snapshot()
+		if err != nil {
+			idx.mu.RUnlock()
+			return GraphStats{}, err
+		}
+		if snapshot.Deleted {
+			deleted++
+		} else {
+			nodes[id] = snapshot
+		}
+	}
+	stats := GraphStats{
+		Nodes:      len(nodes),
+		Deleted:    deleted,
+		EntryPoint: idx.entryPoint,
+		MaxLevel:   idx.currentMaxLevel,
+	}
+	if paged {
+		stats.Paging = &paging
+	}
+	cfg := idx.config
+	idx.mu.RUnlock()
+
+	// Level histogram and out-degrees
+	top := 0
+	for _, node := range nodes {
+		if node.Level > top {
+			top = node.Level
+		}
+	}
+	if len(nodes) > 0 {
+		stats.Levels = make([]LevelStats, top+1)
+	}
+	for level := range stats.Levels {
+		stats.Levels[level] = LevelStats{Level: level, MaxLinks: cfg.maxLinks(level)}
+	}
+	for _, node := range nodes {
+		stats.Levels[node.Level].Top++
+		for level := 0; level <= node.Level; level++ {
+			degree := len(node.Edges[level])
+			ls := &stats.Levels[level]
+			ls.Nodes++
+			ls.AvgDegree += float64(degree)
+			if degree > ls.MaxDegree {
+				ls.MaxDegree = degree
+			}
+		}
+	}
+	for level := range stats.Levels {
+		if ls := &stats.Levels[level]; ls.Nodes > 0 {
+			ls.AvgDegree /= float64(ls.Nodes)
+		}
+	}
+
+	stats.Components = components(nodes)
+	stats.Unreachable = len(nodes) - reachable(nodes, stats.EntryPoint)
+	return stats, nil
+}
+
+// components counts the connected components of level 0
+func components(nodes map[string]*Node) int {
+	parent := make(map[string]string, len(nodes))
+	find := func(id string) string {
+		for parent[id] != id {
+			parent[id] = parent[parent[id]]
+			id = parent[id]
+		}
+		return id
+	}
+	for id := range nodes {
+		parent[id] = id
+	}
+
+	count := len(nodes)
+	for id, node := range nodes {
+		for neighborID := range node.Edges[0] {
+			if _, ok := nodes[neighborID]; !ok {
+				continue
+			}
+			if a, b := find(id), find(neighborID); a != b {
+				parent[a] = b
+				count--
+			}
+		}
+	}
+	return count
+}
+
+// reachable counts the nodes reachable from the entry point along level 0
+// edges, which bounds what a search can find
+func reachable(nodes map[string]*Node, entryPoint string) int {
+	if _, ok := nodes[entryPoint]; !ok {
+		return 0
+	}
+	visited := map[string]bool{entryPoint: true}
+	queue := []string{entryPoint}
+	for len(queue) > 0 {
+		node := nodes[queue[0]]
+		queue = queue[1:]
+		for neighborID := range node.Edges[0] {
+			if _, ok := nodes[neighborID]; ok && !visited[neighborID] {
+				visited[neighborID] = true
+				queue = append(queue, neighborID)
+			}
+		}
+	}
+	return len(visited)
+}
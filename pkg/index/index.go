@@ -1,6 +1,8 @@
 package index
 
 import (
+	"sort"
+
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
 )
@@ -15,6 +17,59 @@ type SearchResult struct {
 // SearchResults is a slice of SearchResult
 type SearchResults []SearchResult
 
+// SearchOptions tunes a search
+type SearchOptions struct {
+	OmitVectors bool         // Leave SearchResult.Vector nil when only IDs and distances are needed
+	EfSearch    int          // HNSW candidate list size overriding the index's setting (0 = the index's); ignored by other indexes
+	Stats       *SearchStats // If set, indexes that support it record the work of the search in it
+}
+
+// SearchCounters count the work of a search
+type SearchCounters struct {
+	DistanceComputations int // Distances computed between the query and indexed vectors
+	Hops                 int // Graph nodes whose neighbors were expanded (HNSW)
+	Visited              int // Vectors reached, scanned or through the graph
+}
+
+// SearchStats record the work of a search, in total and up to each vector
+// it reached, e.g. for EXPLAIN ANALYZE
+type SearchStats struct {
+	SearchCounters                           // Work of the whole search
+	Found          map[string]SearchCounters // Work done when each vector was first reached, by ID
+}
+
+// Reached records the work done so far for id, unless id was reached before
+func (s *SearchStats) Reached(id string) {
+	if s.Found == nil {
+		s.Found = make(map[string]SearchCounters)
+	}
+	if _, ok := s.Found[id]; !ok {
+		s.Found[id] = s.SearchCounters
+	}
+}
+
+// OptionSearcher is implemented by indexes that can search with options
+type OptionSearcher interface {
+	// SearchWithOptions performs a k-nearest neighbor search tuned by opts
+	SearchWithOptions(query *vector.Vector, k int, opts SearchOptions) (SearchResults, error)
+}
+
+// SearchWithOptions searches idx with opts. Indexes that do not implement
+// OptionSearcher are searched normally and their vectors dropped afterwards.
+func SearchWithOptions(idx Index, query *vector.Vector, k int, opts SearchOptions) (SearchResults, error) {
+	if searcher, ok := idx.(OptionSearcher); ok {
+		return searcher.SearchWithOptions(query, k, opts)
+	}
+
+	results, err := idx.Search(query, k)
+	if err == nil && opts.OmitVectors {
+		for i := range results {
+			results[i].Vector = nil
+		}
+	}
+	return results, err
+}
+
 // Index is the interface that all index implementations must satisfy
 type Index interface {
 	// Name returns the name of the index
@@ -48,15 +103,13 @@ type Index interface {
 	SetMetric(metric distance.Metric)
 }
 
-// SortSearchResults sorts search results by distance (ascending)
+// Sort sorts search results by distance (ascending). Equally distant
+// results are ordered by ID, so results do not depend on insertion order.
 func (r SearchResults) Sort() {
-	// Simple bubble sort implementation
-	n := len(r)
-	for i := 0; i < n-1; i++ {
-		for j := 0; j < n-i-1; j++ {
-			if r[j].Distance > r[j+1].Distance {
-				r[j], r[j+1] = r[j+1], r[j]
-			}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Distance != r[j].Distance {
+			return r[i].Distance < r[j].Distance
 		}
-	}
+		return r[i].ID < r[j].ID
+	})
 } 
\ No newline at end of file
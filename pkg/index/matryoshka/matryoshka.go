@@ -0,0 +1,325 @@
+package matryoshka
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/index"
+)
+
+var (
+	// ErrInvalidDimensions is returned when the truncation length is not positive
+	ErrInvalidDimensions = errs.New(errs.InvalidArgument, "truncation dimensions must be greater than 0")
+
+	// ErrVectorNotFound is returned when a vector with the specified ID is not found
+	ErrVectorNotFound = errs.ErrVectorNotFound
+)
+
+// Options controls truncated-prefix search
+type Options struct {
+	Dimensions int // Number of leading dimensions searched by the inner index
+	Rescore    int // Candidates fetched per result and rescored at full precision (0 disables rescoring)
+}
+
+// DefaultOptions returns options that search on the first 64 dimensions and
+// rescore 4 candidates per result
+func DefaultOptions() *Options {
+	return &Options{
+		Dimensions: 64,
+		Rescore:    4,
+	}
+}
+
+// Index searches Matryoshka (MRL) embeddings on a truncated prefix of their
+// dimensions. The inner index only holds the prefixes; full-length vectors
+// are kept aside and only read to rescore the top candidates.
+type Index struct {
+	inner   index.Index
+	metric  distance.Metric
+	opts    Options
+	vectors map[string]*vector.Vector // Full-length vectors by ID
+	mu      sync.RWMutex
+}
+
+// NewIndex wraps an index so it is built and searched on truncated vectors
+func NewIndex(inner index.Index, metric distance.Metric, options *Options) (*Index, error) {
+	opts := DefaultOptions()
+	if options != nil {
+		opts = options
+	}
+	if opts.Dimensions < 1 {
+		return nil, ErrInvalidDimensions
+	}
+
+	return &Index{
+		inner:   inner,
+		metric:  metric,
+		opts:    *opts,
+		vectors: make(map[string]*vector.Vector),
+	}, nil
+}
+
+// Truncate returns a copy of the vector reduced to its first n dimensions.
+// Vectors that are not longer than n are copied unchanged.
+func Truncate(v *vector.Vector, n int) *vector.Vector {
+	if v.Dimension <= n {
+		return v.Copy()
+	}
+
+	values := make([]float32, n)
+	copy(values, v.Values[:n])
+	truncated := vector.NewVector(v.ID, values)
+	for key, value := range v.Metadata {
+		truncated.Metadata[key] = value
+	}
+	return truncated
+}
+
+// Name returns the name of the index
+func (idx *Index) Name() string {
+	return fmt.Sprintf("matryoshka(%s)", idx.inner.Name())
+}
+
+// Unwrap returns the inner index
+func (idx *Index) Unwrap() index.Index {
+	return idx.inner
+}
+
+// Build constructs the index from a set of vectors
+func (idx *Index) Build(vectors []*vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.vectors = make(map[string]*vector.Vector, len(vectors))
+	truncated := make([]*vector.Vector, len(vectors))
+	for i, vec := range vectors {
+		idx.vectors[vec.ID] = vec.Copy()
+		truncated[i] = Truncate(vec, idx.opts.Dimensions)
+	}
+
+	return idx.inner.Build(truncated)
+}
+
+// Add adds a vector to the index
+func (idx *Index) Add(vec *vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.inner.Add(Truncate(vec, idx.opts.Dimensions)); err != nil {
+		return err
+	}
+	idx.vectors[vec.ID] = vec.Copy()
+	return nil
+}
+
+// Delete removes a vector from the index
+func (idx *Index) Delete(id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.inner.Delete(id); err != nil {
+		return err
+	}
+	delete(idx.vectors, id)
+	return nil
+}
+
+// Search finds candidates on the truncated prefix and, if enabled, reorders
+// them by their full-precision distance to the query
+func (idx *Index) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a search tuned by opts
+func (idx *Index) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	// Fetch extra candidates when they are going to be rescored
+	candidates := k
+	if idx.opts.Rescore > 0 {
+		candidates = k * idx.opts.Rescore
+	}
+
+	// Results carry the full vectors, never the truncated ones
+	results, err := index.SearchWithOptions(idx.inner, Truncate(query, idx.opts.Dimensions), candidates, index.SearchOptions{OmitVectors: true, EfSearch: opts.EfSearch, Stats: opts.Stats})
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.opts.Rescore <= 0 || idx.metric == nil {
+		// Return the full vectors with the approximate distances
+		for i := range results {
+			if full, ok := idx.vectors[results[i].ID]; ok && !opts.OmitVectors {
+				results[i].Vector = full.Copy()
+			}
+		}
+		if k < len(results) {
+			results = results[:k]
+		}
+		return results, nil
+	}
+
+	// Rescore the candidates against the full-length vectors
+	for i := range results {
+		full, ok := idx.vectors[results[i].ID]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrVectorNotFound, results[i].ID)
+		}
+
+		dist, err := idx.metric.Distance(query, full)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Stats != nil {
+			opts.Stats.DistanceComputations++
+		}
+		if !opts.OmitVectors {
+			results[i].Vector = full.Copy()
+		}
+		results[i].Distance = dist
+	}
+
+	results.Sort()
+	if k < len(results) {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// Size returns the number of vectors in the index
+func (idx *Index) Size() int {
+	return idx.inner.Size()
+}
+
+// GetIDs returns all vector IDs in the index
+func (idx *Index) GetIDs() []string {
+	return idx.inner.GetIDs()
+}
+
+// fileKind names matryoshka indexes in index files
+const fileKind = "matryoshka"
+
+// fileV1 is the payload of matryoshka index files of payload version 1
+type fileV1 struct {
+	Vectors    []index.VectorRecord
+	Dimensions int
+	Rescore    int
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV1) EncodePayload(e *index.Encoder) {
+	e.Uint32(uint32(len(f.Vectors)))
+	for _, record := range f.Vectors {
+		e.Vector(record)
+	}
+	e.Int(f.Dimensions)
+	e.Int(f.Rescore)
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV1) DecodePayload(d *index.Decoder) {
+	f.Vectors = make([]index.VectorRecord, d.Len(4))
+	for i := range f.Vectors {
+		f.Vectors[i] = d.Vector()
+	}
+	f.Dimensions = d.Int()
+	f.Rescore = d.Int()
+}
+
+// Save persists the full-length vectors to the specified path. The inner
+// index is rebuilt from them on Load.
+func (idx *Index) Save(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	data := fileV1{Vectors: make([]index.VectorRecord, 0, len(idx.vectors)), Dimensions: idx.opts.Dimensions, Rescore: idx.opts.Rescore}
+	header := index.FileHeader{Kind: fileKind, PayloadVersion: 1, Vectors: len(idx.vectors)}
+	for _, vec := range idx.vectors {
+		data.Vectors = append(data.Vectors, index.NewVectorRecord(vec))
+		header.Dimension = vec.Dimension
+	}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
+	}
+	return index.WriteFile(path, header, data)
+}
+
+// Load loads the index from the specified path. Files saved before the
+// index file format existed are read as well.
+func (idx *Index) Load(path string) error {
+	var data fileV1
+	header, payload, err := index.ReadFile(path, fileKind)
+	switch {
+	case errors.Is(err, index.ErrNotIndexFile):
+		if data, err = loadV0(path); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case header.PayloadVersion == 1:
+		if err := index.DecodePayload(header, payload, &data); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: matryoshka payload version %d", index.ErrFileVersion, header.PayloadVersion)
+	}
+
+	idx.mu.Lock()
+	idx.opts = Options{Dimensions: data.Dimensions, Rescore: data.Rescore}
+	// Set the metric if it's not already set
+	if idx.metric == nil && header != nil && header.Metric != "" {
+		metric, err := distance.GetMetric(distance.MetricType(header.Metric))
+		if err != nil {
+			idx.mu.Unlock()
+			return err
+		}
+		idx.metric = metric
+		idx.inner.SetMetric(metric)
+	}
+	idx.mu.Unlock()
+
+	vectors := make([]*vector.Vector, len(data.Vectors))
+	for i, record := range data.Vectors {
+		vectors[i] = record.Vector()
+	}
+	return idx.Build(vectors)
+}
+
+// loadV0 reads a file saved as plain gob, before the index file format
+// existed
+func loadV0(path string) (fileV1, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fileV1{}, err
+	}
+	defer file.Close()
+
+	var data struct {
+		Vectors map[string]*vector.Vector
+		Options Options
+	}
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return fileV1{}, err
+	}
+	v1 := fileV1{Vectors: make([]index.VectorRecord, 0, len(data.Vectors)), Dimensions: data.Options.Dimensions, Rescore: data.Options.Rescore}
+	for _, vec := range data.Vectors {
+		v1.Vectors = append(v1.Vectors, index.NewVectorRecord(vec))
+	}
+	return v1, nil
+}
+
+// SetMetric sets the distance metric used by the index
+func (idx *Index) SetMetric(metric distance.Metric) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.metric = metric
+	idx.inner.SetMetric(metric)
+}
@@ -0,0 +1,114 @@
+package matryoshka
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+)
+
+// testVectors returns vectors whose 2-dimensional prefixes rank differently
+// from their full 4-dimensional values
+func testVectors() []*vector.Vector {
+	return []*vector.Vector{
+		vector.NewVector("prefix-match", []float32{1.0, 0.0, 9.0, 9.0}),
+		vector.NewVector("full-match", []float32{1.2, 0.0, 0.0, 0.0}),
+		vector.NewVector("far", []float32{5.0, 5.0, 5.0, 5.0}),
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	v := vector.NewVector("v1", []float32{1.0, 2.0, 3.0})
+	v.Metadata["category"] = "text"
+
+	truncated := Truncate(v, 2)
+	if truncated.Dimension != 2 || truncated.Values[1] != 2.0 || truncated.Metadata["category"] != "text" {
+		t.Errorf("Unexpected truncated vector: %v %v", truncated.Values, truncated.Metadata)
+	}
+
+	// Short vectors are copied unchanged
+	if short := Truncate(v, 5); short.Dimension != 3 {
+		t.Errorf("Expected dimension 3, got %d", short.Dimension)
+	}
+
+	if _, err := NewIndex(flat.NewFlatIndex(nil), nil, &Options{Dimensions: 0}); err != ErrInvalidDimensions {
+		t.Errorf("Expected ErrInvalidDimensions, got %v", err)
+	}
+}
+
+func TestSearchWithoutRescoring(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	idx, err := NewIndex(flat.NewFlatIndex(metric), metric, &Options{Dimensions: 2})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := idx.Build(testVectors()); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+
+	query := vector.NewVector("query", []float32{1.0, 0.0, 0.0, 0.0})
+	results, err := idx.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Only the prefix is compared, but full vectors are returned
+	if len(results) != 1 || results[0].ID != "prefix-match" {
+		t.Fatalf("Expected prefix-match, got %v", results)
+	}
+	if results[0].Distance != 0 || results[0].Vector.Dimension != 4 {
+		t.Errorf("Expected prefix distance 0 and a full vector, got %f and dimension %d",
+			results[0].Distance, results[0].Vector.Dimension)
+	}
+}
+
+func TestSearchWithRescoring(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	idx, err := NewIndex(flat.NewFlatIndex(metric), metric, &Options{Dimensions: 2, Rescore: 2})
+	if err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := idx.Build(testVectors()); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+
+	query := vector.NewVector("query", []float32{1.0, 0.0, 0.0, 0.0})
+	results, err := idx.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// Rescoring the two prefix candidates at full precision reorders them
+	if len(results) != 1 || results[0].ID != "full-match" {
+		t.Fatalf("Expected full-match, got %v", results)
+	}
+	if results[0].Distance < 0.19 || results[0].Distance > 0.21 {
+		t.Errorf("Expected full-precision distance 0.2, got %f", results[0].Distance)
+	}
+
+	// Rescoring does not need the payload of the results
+	bare, err := idx.SearchWithOptions(query, 1, index.SearchOptions{OmitVectors: true})
+	if err != nil || len(bare) != 1 || bare[0].ID != "full-match" || bare[0].Vector != nil {
+		t.Errorf("Expected full-match without a vector, got %v, %v", bare, err)
+	}
+
+	// The index survives a save/load round trip
+	path := filepath.Join(t.TempDir(), "matryoshka.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	loaded, _ := NewIndex(flat.NewFlatIndex(metric), metric, nil)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if loaded.Size() != 3 {
+		t.Errorf("Expected 3 vectors after load, got %d", loaded.Size())
+	}
+	results, err = loaded.Search(query, 1)
+	if err != nil || results[0].ID != "full-match" {
+		t.Errorf("Expected full-match after load, got %v (err = %v)", results, err)
+	}
+}
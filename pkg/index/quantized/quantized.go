@@ -0,0 +1,436 @@
+package quantized
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/index"
+)
+
+var (
+	// ErrVectorNotFound is returned when a vector with the specified ID is not found
+	ErrVectorNotFound = errs.ErrVectorNotFound
+
+	// ErrVectorAlreadyExists is returned when attempting to add a vector with an ID that already exists
+	ErrVectorAlreadyExists = errs.ErrVectorAlreadyExists
+
+	// ErrInvalidK is returned when k is less than 1
+	ErrInvalidK = errs.New(errs.InvalidArgument, "k must be greater than 0")
+
+	// ErrNoVectors is returned when the index is empty
+	ErrNoVectors = errs.New(errs.FailedPrecondition, "index contains no vectors")
+
+	// ErrMetricRequired is returned when a distance metric is required but not set
+	ErrMetricRequired = errs.New(errs.InvalidArgument, "distance metric is required")
+)
+
+// ScalarQuantizer compresses float32 vectors to one byte per dimension using
+// per-dimension min/max ranges learned from the data
+type ScalarQuantizer struct {
+	Min   []float32 // Minimum value of each dimension
+	Scale []float32 // Width of one quantization step for each dimension
+}
+
+// TrainScalarQuantizer learns the value range of every dimension
+func TrainScalarQuantizer(vectors []*vector.Vector) *ScalarQuantizer {
+	if len(vectors) == 0 {
+		return &ScalarQuantizer{}
+	}
+
+	dim := vectors[0].Dimension
+	min := make([]float32, dim)
+	max := make([]float32, dim)
+	for i := range min {
+		min[i] = float32(math.Inf(1))
+		max[i] = float32(math.Inf(-1))
+	}
+
+	for _, vec := range vectors {
+		for i := 0; i < dim && i < vec.Dimension; i++ {
+			if vec.Values[i] < min[i] {
+				min[i] = vec.Values[i]
+			}
+			if vec.Values[i] > max[i] {
+				max[i] = vec.Values[i]
+			}
+		}
+	}
+
+	scale := make([]float32, dim)
+	for i := range scale {
+		scale[i] = (max[i] - min[i]) / 255
+	}
+
+	return &ScalarQuantizer{Min: min, Scale: scale}
+}
+
+// Dimension returns the dimension the quantizer was trained on
+func (q *ScalarQuantizer) Dimension() int {
+	return len(q.Min)
+}
+
+// Encode quantizes a vector. Values outside the trained range are clamped.
+func (q *ScalarQuantizer) Encode(v *vector.Vector) ([]byte, error) {
+	if v.Dimension != q.Dimension() {
+		return nil, vector.ErrInvalidDimension
+	}
+
+	code := make([]byte, v.Dimension)
+	for i, val := range v.Values {
+		if q.Scale[i] == 0 {
+			continue
+		}
+		level := math.Round(float64((val - q.Min[i]) / q.Scale[i]))
+		code[i] = byte(math.Max(0, math.Min(255, level)))
+	}
+	return code, nil
+}
+
+// Decode reconstructs an approximate vector from its code into values
+func (q *ScalarQuantizer) Decode(code []byte, values []float32) {
+	for i, c := range code {
+		values[i] = q.Min[i] + float32(c)*q.Scale[i]
+	}
+}
+
+// covers reports whether every value of v encodes without clamping
+func (q *ScalarQuantizer) covers(v *vector.Vector) bool {
+	for i, val := range v.Values {
+		if q.Scale[i] == 0 {
+			if val != q.Min[i] {
+				return false
+			}
+			continue
+		}
+		level := (val - q.Min[i]) / q.Scale[i]
+		if level < -0.5 || level > 255.5 {
+			return false
+		}
+	}
+	return true
+}
+
+// Extend returns a quantizer whose ranges also cover v, for indexes grown by
+// adding vectors. If the ranges grow, codes are re-encoded in place with the
+// returned quantizer. An empty quantizer is trained on v. A range that grows
+// at least doubles, so vectors added one at a time re-encode the codes a
+// logarithmic number of times rather than once each.
+func (q *ScalarQuantizer) Extend(v *vector.Vector, codes map[string][]byte) (*ScalarQuantizer, error) {
+	if q.Dimension() == 0 {
+		return TrainScalarQuantizer([]*vector.Vector{v}), nil
+	}
+	if v.Dimension != q.Dimension() {
+		return nil, vector.ErrInvalidDimension
+	}
+	if q.covers(v) {
+		return q, nil
+	}
+
+	extended := &ScalarQuantizer{Min: make([]float32, len(q.Min)), Scale: make([]float32, len(q.Scale))}
+	for i, val := range v.Values {
+		low, high := q.Min[i], q.Min[i]+255*q.Scale[i]
+		width := high - low
+		if val < low {
+			low = min(val, high-2*width)
+		}
+		if val > high {
+			high = max(val, low+2*width)
+		}
+		extended.Min[i] = low
+		extended.Scale[i] = (high - low) / 255
+	}
+
+	scratch := vector.NewVector("", make([]float32, q.Dimension()))
+	for id, code := range codes {
+		q.Decode(code, scratch.Values)
+		recoded, err := extended.Encode(scratch)
+		if err != nil {
+			return nil, err
+		}
+		codes[id] = recoded
+	}
+	return extended, nil
+}
+
+// QuantizedIndex is a brute-force index over scalar-quantized vectors. It
+// keeps only one byte per dimension in memory, so its distances are
+// approximate; use it as the coarse stage of a two-stage search.
+type QuantizedIndex struct {
+	codes     map[string][]byte // Map of vector ID to quantized code
+	quantizer *ScalarQuantizer  // Learned value ranges
+	metric    distance.Metric   // Distance metric to use
+	mu        sync.RWMutex      // Mutex for thread safety
+}
+
+// NewQuantizedIndex creates a new quantized index with the specified distance metric
+func NewQuantizedIndex(metric distance.Metric) *QuantizedIndex {
+	return &QuantizedIndex{
+		codes:     make(map[string][]byte),
+		quantizer: &ScalarQuantizer{},
+		metric:    metric,
+	}
+}
+
+// Name returns the name of the index
+func (idx *QuantizedIndex) Name() string {
+	return "quantized"
+}
+
+// Build trains the quantizer and encodes a set of vectors
+func (idx *QuantizedIndex) Build(vectors []*vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	quantizer := TrainScalarQuantizer(vectors)
+	codes := make(map[string][]byte, len(vectors))
+	for _, vec := range vectors {
+		code, err := quantizer.Encode(vec)
+		if err != nil {
+			return err
+		}
+		codes[vec.ID] = code
+	}
+
+	idx.quantizer = quantizer
+	idx.codes = codes
+	return nil
+}
+
+// Add encodes a vector with the current quantizer, first extending its
+// ranges to the vector's values if they fall outside them
+func (idx *QuantizedIndex) Add(vec *vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, exists := idx.codes[vec.ID]; exists {
+		return ErrVectorAlreadyExists
+	}
+	quantizer, err := idx.quantizer.Extend(vec, idx.codes)
+	if err != nil {
+		return err
+	}
+	idx.quantizer = quantizer
+
+	code, err := idx.quantizer.Encode(vec)
+	if err != nil {
+		return err
+	}
+	idx.codes[vec.ID] = code
+	return nil
+}
+
+// Delete removes a vector from the index
+func (idx *QuantizedIndex) Delete(id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if _, exists := idx.codes[id]; !exists {
+		return ErrVectorNotFound
+	}
+	delete(idx.codes, id)
+	return nil
+}
+
+// Search performs an approximate k-nearest neighbor search on the quantized
+// codes. Result vectors are the decoded approximations.
+func (idx *QuantizedIndex) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a search tuned by opts
+func (idx *QuantizedIndex) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if len(idx.codes) == 0 {
+		return nil, ErrNoVectors
+	}
+	if k < 1 {
+		return nil, ErrInvalidK
+	}
+	if idx.metric == nil {
+		return nil, ErrMetricRequired
+	}
+	if query.Dimension != idx.quantizer.Dimension() {
+		return nil, vector.ErrInvalidDimension
+	}
+
+	// Decode each code into a scratch vector instead of allocating per candidate
+	scratch := vector.NewVector("", make([]float32, idx.quantizer.Dimension()))
+
+	results := make(index.SearchResults, 0, len(idx.codes))
+	for id, code := range idx.codes {
+		idx.quantizer.Decode(code, scratch.Values)
+		dist, err := idx.metric.Distance(query, scratch)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, index.SearchResult{ID: id, Distance: dist})
+		if opts.Stats != nil {
+			opts.Stats.DistanceComputations++
+			opts.Stats.Visited++
+			opts.Stats.Reached(id)
+		}
+	}
+
+	results.Sort()
+	if k > len(results) {
+		k = len(results)
+	}
+	results = results[:k]
+
+	// Only materialize the returned approximations
+	if opts.OmitVectors {
+		return results, nil
+	}
+	for i := range results {
+		values := make([]float32, idx.quantizer.Dimension())
+		idx.quantizer.Decode(idx.codes[results[i].ID], values)
+		results[i].Vector = vector.NewVector(results[i].ID, values)
+	}
+
+	return results, nil
+}
+
+// Size returns the number of vectors in the index
+func (idx *QuantizedIndex) Size() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.codes)
+}
+
+// GetIDs returns all vector IDs in the index
+func (idx *QuantizedIndex) GetIDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make([]string, 0, len(idx.codes))
+	for id := range idx.codes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// fileKind names quantized indexes in index files
+const fileKind = "quantized"
+
+// fileV1 is the payload of quantized index files of payload version 1
+type fileV1 struct {
+	Codes map[string][]byte
+	Min   []float32
+	Scale []float32
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV1) EncodePayload(e *index.Encoder) {
+	e.Uint32(uint32(len(f.Codes)))
+	for _, id := range index.SortedKeys(f.Codes) {
+		e.String(id)
+		e.ByteSlice(f.Codes[id])
+	}
+	e.Float32s(f.Min)
+	e.Float32s(f.Scale)
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV1) DecodePayload(d *index.Decoder) {
+	n := d.Len(8)
+	f.Codes = make(map[string][]byte, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		id := d.String()
+		f.Codes[id] = d.ByteSlice()
+	}
+	f.Min = d.Float32s()
+	f.Scale = d.Float32s()
+}
+
+// Save persists the index to the specified path in the index file format
+func (idx *QuantizedIndex) Save(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	header := index.FileHeader{Kind: fileKind, PayloadVersion: 1, Vectors: len(idx.codes), Dimension: idx.quantizer.Dimension()}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
+	}
+	return index.WriteFile(path, header, fileV1{Codes: idx.codes, Min: idx.quantizer.Min, Scale: idx.quantizer.Scale})
+}
+
+// Load loads the index from the specified path. Files saved before the
+// index file format existed are read as well.
+func (idx *QuantizedIndex) Load(path string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var data fileV1
+	var metricName string
+	header, payload, err := index.ReadFile(path, fileKind)
+	switch {
+	case errors.Is(err, index.ErrNotIndexFile):
+		if data, metricName, err = loadV0(path); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case header.PayloadVersion == 1:
+		if err := index.DecodePayload(header, payload, &data); err != nil {
+			return err
+		}
+		metricName = header.Metric
+	default:
+		return fmt.Errorf("%w: quantized payload version %d", index.ErrFileVersion, header.PayloadVersion)
+	}
+
+	idx.codes = data.Codes
+	if idx.codes == nil {
+		idx.codes = make(map[string][]byte)
+	}
+	idx.quantizer = &ScalarQuantizer{Min: data.Min, Scale: data.Scale}
+
+	// Set the metric if it's not already set
+	if idx.metric == nil && metricName != "" {
+		metric, err := distance.GetMetric(distance.MetricType(metricName))
+		if err != nil {
+			return err
+		}
+		idx.metric = metric
+	}
+
+	return nil
+}
+
+// loadV0 reads a file saved as plain gob, before the index file format
+// existed
+func loadV0(path string) (fileV1, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fileV1{}, "", err
+	}
+	defer file.Close()
+
+	var data struct {
+		Codes     map[string][]byte
+		Quantizer ScalarQuantizer
+		Metric    string
+	}
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return fileV1{}, "", err
+	}
+	return fileV1{Codes: data.Codes, Min: data.Quantizer.Min, Scale: data.Quantizer.Scale}, data.Metric, nil
+}
+
+// SetMetric sets the distance metric used by the index
+func (idx *QuantizedIndex) SetMetric(metric distance.Metric) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.metric = metric
+}
@@ -0,0 +1,110 @@
+package quantized
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestScalarQuantizer(t *testing.T) {
+	vectors := []*vector.Vector{
+		vector.NewVector("a", []float32{0.0, -1.0, 5.0}),
+		vector.NewVector("b", []float32{1.0, 1.0, 5.0}),
+	}
+	q := TrainScalarQuantizer(vectors)
+
+	code, err := q.Encode(vector.NewVector("c", []float32{0.5, 2.0, 5.0}))
+	if err != nil {
+		t.Fatalf("Failed to encode vector: %v", err)
+	}
+
+	// Values above the trained range are clamped; constant dimensions encode to 0
+	if code[1] != 255 || code[2] != 0 {
+		t.Errorf("Unexpected code: %v", code)
+	}
+
+	values := make([]float32, 3)
+	q.Decode(code, values)
+	if values[0] < 0.49 || values[0] > 0.51 || values[1] != 1.0 || values[2] != 5.0 {
+		t.Errorf("Unexpected decoded values: %v", values)
+	}
+
+	if _, err := q.Encode(vector.NewVector("d", []float32{1.0})); err != vector.ErrInvalidDimension {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+}
+
+func TestQuantizedIndex(t *testing.T) {
+	idx := NewQuantizedIndex(&distance.EuclideanDistance{})
+	vectors := []*vector.Vector{
+		vector.NewVector("vec1", []float32{1.0, 0.0, 0.0}),
+		vector.NewVector("vec2", []float32{0.0, 1.0, 0.0}),
+		vector.NewVector("vec3", []float32{0.0, 0.0, 1.0}),
+	}
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	if err := idx.Add(vectors[0]); err != ErrVectorAlreadyExists {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	results, err := idx.Search(vector.NewVector("query", []float32{0.9, 0.1, 0.0}), 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "vec1" {
+		t.Errorf("Expected vec1 first, got %v", results)
+	}
+
+	// Round trip through Save/Load
+	path := filepath.Join(t.TempDir(), "quantized.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	loaded := NewQuantizedIndex(nil)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if loaded.Size() != 3 {
+		t.Errorf("Expected 3 vectors, got %d", loaded.Size())
+	}
+
+	if err := loaded.Delete("vec1"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	results, err = loaded.Search(vector.NewVector("query", []float32{0.9, 0.1, 0.0}), 1)
+	if err != nil || results[0].ID != "vec2" {
+		t.Errorf("Expected vec2 after deleting vec1, got %v (err = %v)", results, err)
+	}
+}
+
+func TestQuantizedIndexAdd(t *testing.T) {
+	idx := NewQuantizedIndex(&distance.EuclideanDistance{})
+	for _, vec := range []*vector.Vector{
+		vector.NewVector("a", []float32{0, 0}),
+		vector.NewVector("b", []float32{10, 10}),
+		vector.NewVector("c", []float32{-5, 3}),
+	} {
+		if err := idx.Add(vec); err != nil {
+			t.Fatalf("Failed to add %s: %v", vec.ID, err)
+		}
+	}
+
+	// Values outside the ranges learned so far widen them instead of clamping
+	results, err := idx.Search(vector.NewVector("query", []float32{10, 10}), 3)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 3 || results[0].ID != "b" || results[1].ID != "a" || results[2].ID != "c" {
+		t.Errorf("Expected b, a, c, got %v", results)
+	}
+	if results[0].Distance > 0.1 {
+		t.Errorf("Expected b at about distance 0, got %f", results[0].Distance)
+	}
+
+	if err := idx.Add(vector.NewVector("d", []float32{1})); err != vector.ErrInvalidDimension {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+}
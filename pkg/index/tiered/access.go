@@ -0,0 +1,135 @@
+package tiered
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultHalfLife is the number of searches after which a hit counts half
+const DefaultHalfLife = 10000
+
+// minTrackedHits is the decayed hit count below which a vector is forgotten
+const minTrackedHits = 0.01
+
+// AccessStats counts how often vectors are returned by searches. Hits decay
+// with a half-life counted in searches, so vectors that stop being found
+// cool down. The stats outlive indexes: the executor rebuilds its indexes
+// after writes, and a rebuilt index picks its hot vectors from them.
+type AccessStats struct {
+	mu       sync.Mutex
+	halfLife float64
+	searches int64
+	hits     map[string]accessCount
+}
+
+// accessCount is the hit count of a vector as of a search
+type accessCount struct {
+	hits float64
+	at   int64
+}
+
+// NewAccessStats creates access stats whose hits halve every halfLife
+// searches (0 = DefaultHalfLife)
+func NewAccessStats(halfLife int) *AccessStats {
+	if halfLife <= 0 {
+		halfLife = DefaultHalfLife
+	}
+	return &AccessStats{halfLife: float64(halfLife), hits: make(map[string]accessCount)}
+}
+
+// Record counts a search that returned ids
+func (a *AccessStats) Record(ids []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.searches++
+	for _, id := range ids {
+		a.hits[id] = accessCount{hits: a.decayed(a.hits[id]) + 1, at: a.searches}
+	}
+}
+
+// Hits returns the decayed hit count of id
+func (a *AccessStats) Hits(id string) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.decayed(a.hits[id])
+}
+
+// Searches returns the number of searches recorded
+func (a *AccessStats) Searches() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.searches
+}
+
+// Hottest returns up to n of the IDs for which include is true with at
+// least min decayed hits, most hit first. Vectors whose hits decayed to
+// almost nothing are forgotten.
+func (a *AccessStats) Hottest(n int, min float64, include func(id string) bool) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	type hit struct {
+		id   string
+		hits float64
+	}
+	var hot []hit
+	for id, count := range a.hits {
+		hits := a.decayed(count)
+		if hits < minTrackedHits {
+			delete(a.hits, id)
+			continue
+		}
+		if hits >= min && include(id) {
+			hot = append(hot, hit{id, hits})
+		}
+	}
+
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].hits != hot[j].hits {
+			return hot[i].hits > hot[j].hits
+		}
+		return hot[i].id < hot[j].id
+	})
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	ids := make([]string, len(hot))
+	for i, h := range hot {
+		ids[i] = h.id
+	}
+	return ids
+}
+
+// snapshot returns the decayed hit counts, for saving them with an index
+func (a *AccessStats) snapshot() map[string]float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	hits := make(map[string]float64, len(a.hits))
+	for id, count := range a.hits {
+		hits[id] = a.decayed(count)
+	}
+	return hits
+}
+
+// restore adds saved hit counts of vectors without hits of their own
+func (a *AccessStats) restore(hits map[string]float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for id, count := range hits {
+		if _, ok := a.hits[id]; !ok {
+			a.hits[id] = accessCount{hits: count, at: a.searches}
+		}
+	}
+}
+
+// decayed returns count as of the latest search (caller must hold a.mu)
+func (a *AccessStats) decayed(count accessCount) float64 {
+	if count.hits == 0 || count.at == a.searches {
+		return count.hits
+	}
+	return count.hits * math.Exp2(-float64(a.searches-count.at)/a.halfLife)
+}
@@ -0,0 +1,851 @@
+package tiered
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ken/vector_database/internal/concurrency"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/quantized"
+)
+
+var (
+	// ErrVectorNotFound is returned when a vector with the specified ID is not found
+	ErrVectorNotFound = errs.ErrVectorNotFound
+
+	// ErrVectorAlreadyExists is returned when attempting to add a vector with an ID that already exists
+	ErrVectorAlreadyExists = errs.ErrVectorAlreadyExists
+
+	// ErrInvalidK is returned when k is less than 1
+	ErrInvalidK = errs.New(errs.InvalidArgument, "k must be greater than 0")
+
+	// ErrNoVectors is returned when the index is empty
+	ErrNoVectors = errs.New(errs.FailedPrecondition, "index contains no vectors")
+
+	// ErrMetricRequired is returned when a distance metric is required but not set
+	ErrMetricRequired = errs.New(errs.InvalidArgument, "distance metric is required")
+)
+
+// kmeansIterations bounds the refinement of the centroids when the index is built
+const kmeansIterations = 8
+
+// kmeansSamplesPerCluster bounds the vectors the centroids are trained on
+const kmeansSamplesPerCluster = 64
+
+// assignChunk is the fewest vectors assigned to centroids per goroutine
+const assignChunk = 256
+
+// Source provides full-precision vectors, e.g. a storage.VectorStore
+type Source interface {
+	Get(id string) (*vector.Vector, error)
+}
+
+// Options controls tiering
+type Options struct {
+	Clusters    int          // Centroids routing searches of cold vectors (0 = square root of the vector count)
+	Probes      int          // Clusters scanned per search
+	Candidates  int          // Cold candidates rescored at full precision (at least k)
+	HotSize     int          // Most vectors kept uncompressed
+	MinHits     float64      // Decayed search hits a vector needs to be hot
+	RetierEvery int          // Searches between moves of vectors between the tiers
+	Access      *AccessStats // Hits shared with rebuilt indexes (nil = the index's own)
+}
+
+// DefaultOptions returns options that keep up to 10000 vectors hot and
+// probe 8 clusters for cold ones
+func DefaultOptions() *Options {
+	return &Options{
+		Probes:      8,
+		Candidates:  100,
+		HotSize:     10000,
+		MinHits:     2,
+		RetierEvery: 100,
+	}
+}
+
+// Stats describes the tiers of an index
+type Stats struct {
+	Hot        int   `json:"hot"`        // Vectors kept uncompressed
+	Cold       int   `json:"cold"`       // Vectors kept only as codes
+	Clusters   int   `json:"clusters"`   // Centroids routing cold searches
+	Promotions int64 `json:"promotions"` // Vectors moved to the hot tier
+	Demotions  int64 `json:"demotions"`  // Vectors moved to the cold tier
+	HotHits    int64 `json:"hot_hits"`   // Results served from the hot tier
+	ColdHits   int64 `json:"cold_hits"`  // Results served from the cold tier
+}
+
+// Index keeps vectors in two tiers. Every vector is scalar-quantized to one
+// byte per dimension and filed under its nearest centroid; searches scan the
+// centroids, which are few enough to keep in memory, then the codes of the
+// nearest clusters, and rescore the best candidates from the source. The
+// vectors searches return most often are also kept uncompressed in the hot
+// tier, which every search scans exactly. Vectors move between the tiers
+// every Options.RetierEvery searches, as their access stats say.
+type Index struct {
+	source    Source
+	metric    distance.Metric
+	opts      Options
+	access    *AccessStats
+	quantizer *quantized.ScalarQuantizer
+	codes     map[string][]byte         // Cold tier: code of every vector
+	cluster   map[string]int            // Cluster of every vector
+	centroids []*vector.Vector          // Centroid of each cluster
+	members   []map[string]struct{}     // IDs of each cluster
+	hot       map[string]*vector.Vector // Hot tier: uncompressed vectors
+	full      map[string]*vector.Vector // Full vectors when no source is set
+	mu        sync.RWMutex
+
+	searches   int64 // Searches since the index was created (atomic)
+	promotions int64 // Protected by mu
+	demotions  int64 // Protected by mu
+	hotHits    int64 // Atomic
+	coldHits   int64 // Atomic
+}
+
+// memorySource serves full-precision vectors kept by the index itself
+type memorySource map[string]*vector.Vector
+
+func (m memorySource) Get(id string) (*vector.Vector, error) {
+	v, ok := m[id]
+	if !ok {
+		return nil, ErrVectorNotFound
+	}
+	return v, nil
+}
+
+// NewIndex creates a tiered index that reads full-precision vectors from
+// source. If source is nil, they are kept in memory alongside the codes,
+// which saves no memory but still speeds up searches of the cold tier.
+func NewIndex(source Source, metric distance.Metric, options *Options) *Index {
+	opts := DefaultOptions()
+	if options != nil {
+		opts = options
+	}
+	access := opts.Access
+	if access == nil {
+		access = NewAccessStats(0)
+	}
+
+	idx := &Index{source: source, metric: metric, opts: *opts, access: access}
+	idx.reset(&quantized.ScalarQuantizer{})
+	return idx
+}
+
+// reset empties the index (caller must hold idx.mu)
+func (idx *Index) reset(quantizer *quantized.ScalarQuantizer) {
+	idx.quantizer = quantizer
+	idx.codes = make(map[string][]byte)
+	idx.cluster = make(map[string]int)
+	idx.centroids = nil
+	idx.members = nil
+	idx.hot = make(map[string]*vector.Vector)
+	idx.full = make(map[string]*vector.Vector)
+}
+
+// Name returns the name of the index
+func (idx *Index) Name() string {
+	return "tiered"
+}
+
+// Build trains the quantizer and the centroids on a set of vectors and
+// makes the most searched of them hot
+func (idx *Index) Build(vectors []*vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.metric == nil {
+		return ErrMetricRequired
+	}
+	idx.reset(quantized.TrainScalarQuantizer(vectors))
+
+	byID := make(map[string]*vector.Vector, len(vectors))
+	for _, vec := range vectors {
+		code, err := idx.quantizer.Encode(vec)
+		if err != nil {
+			return err
+		}
+		idx.codes[vec.ID] = code
+		byID[vec.ID] = vec
+		if idx.source == nil {
+			idx.full[vec.ID] = vec.Copy()
+		}
+	}
+
+	centroids, err := kmeans(vectors, idx.clusterTarget(len(vectors)), idx.metric)
+	if err != nil {
+		return err
+	}
+	idx.centroids = centroids
+	idx.members = make([]map[string]struct{}, len(centroids))
+	for i := range idx.members {
+		idx.members[i] = make(map[string]struct{})
+	}
+	clusters := make([]int, len(vectors))
+	if _, err := assign(centroids, vectors, idx.metric, clusters); err != nil {
+		return err
+	}
+	for i, vec := range vectors {
+		idx.file(vec.ID, clusters[i])
+	}
+
+	// The vectors built from are at hand, so no source is read
+	for _, id := range idx.access.Hottest(idx.opts.HotSize, idx.opts.MinHits, idx.contains) {
+		idx.hot[id] = byID[id].Copy()
+	}
+	return nil
+}
+
+// clusterTarget returns the number of clusters for n vectors
+func (idx *Index) clusterTarget(n int) int {
+	target := idx.opts.Clusters
+	if target <= 0 {
+		target = int(math.Ceil(math.Sqrt(float64(n))))
+	}
+	if target > n {
+		target = n
+	}
+	return target
+}
+
+// contains reports whether id is in the index (caller must hold idx.mu)
+func (idx *Index) contains(id string) bool {
+	_, ok := idx.codes[id]
+	return ok
+}
+
+// file adds id to cluster c (caller must hold idx.mu)
+func (idx *Index) file(id string, c int) {
+	idx.cluster[id] = c
+	idx.members[c][id] = struct{}{}
+}
+
+// Add encodes a vector into the cold tier. The quantizer's ranges are
+// extended to the vector's values if they fall outside them, and added
+// vectors become centroids of their own until the index has as many
+// clusters as it would be built with.
+func (idx *Index) Add(vec *vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.contains(vec.ID) {
+		return ErrVectorAlreadyExists
+	}
+	if idx.metric == nil {
+		return ErrMetricRequired
+	}
+	quantizer, err := idx.quantizer.Extend(vec, idx.codes)
+	if err != nil {
+		return err
+	}
+	idx.quantizer = quantizer
+
+	code, err := idx.quantizer.Encode(vec)
+	if err != nil {
+		return err
+	}
+
+	c := len(idx.centroids)
+	if c < idx.clusterTarget(len(idx.codes)+1) {
+		idx.centroids = append(idx.centroids, vec.Copy())
+		idx.members = append(idx.members, make(map[string]struct{}))
+	} else if c, err = nearestCentroid(idx.centroids, vec, idx.metric); err != nil {
+		return err
+	}
+
+	idx.codes[vec.ID] = code
+	idx.file(vec.ID, c)
+	if idx.source == nil {
+		idx.full[vec.ID] = vec.Copy()
+	}
+	return nil
+}
+
+// Delete removes a vector from both tiers
+func (idx *Index) Delete(id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if !idx.contains(id) {
+		return ErrVectorNotFound
+	}
+	delete(idx.members[idx.cluster[id]], id)
+	delete(idx.cluster, id)
+	delete(idx.codes, id)
+	delete(idx.hot, id)
+	delete(idx.full, id)
+	return nil
+}
+
+// Search performs an approximate k-nearest neighbor search
+func (idx *Index) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a search tuned by opts and records the returned
+// vectors in the access stats
+func (idx *Index) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
+	idx.mu.RLock()
+	results, err := idx.search(query, k, opts)
+	idx.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	idx.access.Record(ids)
+	if every := int64(idx.opts.RetierEvery); every > 0 && atomic.AddInt64(&idx.searches, 1)%every == 0 {
+		idx.Retier()
+	}
+	return results, nil
+}
+
+// search scans the hot tier exactly and the probed clusters of the cold
+// tier approximately (caller must hold idx.mu)
+func (idx *Index) search(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
+	if len(idx.codes) == 0 {
+		return nil, ErrNoVectors
+	}
+	if k < 1 {
+		return nil, ErrInvalidK
+	}
+	if idx.metric == nil {
+		return nil, ErrMetricRequired
+	}
+	if query.Dimension != idx.quantizer.Dimension() {
+		return nil, vector.ErrInvalidDimension
+	}
+	stats := opts.Stats
+
+	results := make(index.SearchResults, 0, len(idx.hot)+k)
+	for id, vec := range idx.hot {
+		dist, err := idx.metric.Distance(query, vec)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, index.SearchResult{ID: id, Distance: dist})
+		if stats != nil {
+			stats.DistanceComputations++
+			stats.Visited++
+			stats.Reached(id)
+		}
+	}
+
+	candidates, err := idx.coldCandidates(query, k, stats)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exact distances of the cold candidates from the source
+	source := idx.source
+	if source == nil {
+		source = memorySource(idx.full)
+	}
+	cold := make(map[string]*vector.Vector, len(candidates))
+	for _, candidate := range candidates {
+		full, err := source.Get(candidate.ID)
+		if err != nil {
+			// Removed from the source since the index was built
+			continue
+		}
+		dist, err := idx.metric.Distance(query, full)
+		if err != nil {
+			return nil, err
+		}
+		if stats != nil {
+			stats.DistanceComputations++
+		}
+		results = append(results, index.SearchResult{ID: candidate.ID, Distance: dist})
+		cold[candidate.ID] = full
+	}
+
+	results.Sort()
+	if k < len(results) {
+		results = results[:k]
+	}
+	for i := range results {
+		vec, hot := idx.hot[results[i].ID]
+		if hot {
+			atomic.AddInt64(&idx.hotHits, 1)
+		} else {
+			vec = cold[results[i].ID]
+			atomic.AddInt64(&idx.coldHits, 1)
+		}
+		if !opts.OmitVectors {
+			results[i].Vector = vec.Copy()
+		}
+	}
+	return results, nil
+}
+
+// coldCandidates returns the cold vectors of the clusters nearest to the
+// query with the smallest approximate distances (caller must hold idx.mu)
+func (idx *Index) coldCandidates(query *vector.Vector, k int, stats *index.SearchStats) (index.SearchResults, error) {
+	// Route the query to the clusters with the nearest centroids
+	type route struct {
+		cluster  int
+		distance float32
+	}
+	routes := make([]route, 0, len(idx.centroids))
+	for c, centroid := range idx.centroids {
+		if len(idx.members[c]) == 0 {
+			continue
+		}
+		dist, err := idx.metric.Distance(query, centroid)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route{c, dist})
+		if stats != nil {
+			stats.DistanceComputations++
+		}
+	}
+	sort.SliceStable(routes, func(i, j int) bool { return routes[i].distance < routes[j].distance })
+	probes := idx.opts.Probes
+	if probes < 1 {
+		probes = 1
+	}
+	if probes < len(routes) {
+		routes = routes[:probes]
+	}
+
+	// Decode each code into a scratch vector instead of allocating per candidate
+	scratch := vector.NewVector("", make([]float32, idx.quantizer.Dimension()))
+	var candidates index.SearchResults
+	for _, route := range routes {
+		for id := range idx.members[route.cluster] {
+			if _, hot := idx.hot[id]; hot {
+				continue
+			}
+			idx.quantizer.Decode(idx.codes[id], scratch.Values)
+			dist, err := idx.metric.Distance(query, scratch)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, index.SearchResult{ID: id, Distance: dist})
+			if stats != nil {
+				stats.DistanceComputations++
+				stats.Visited++
+				stats.Reached(id)
+			}
+		}
+	}
+
+	candidates.Sort()
+	limit := idx.opts.Candidates
+	if limit < k {
+		limit = k
+	}
+	if limit < len(candidates) {
+		candidates = candidates[:limit]
+	}
+	return candidates, nil
+}
+
+// Retier moves the vectors with the most search hits into the hot tier and
+// the rest out of it. Searches call it every Options.RetierEvery searches.
+func (idx *Index) Retier() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	want := idx.access.Hottest(idx.opts.HotSize, idx.opts.MinHits, idx.contains)
+	keep := make(map[string]bool, len(want))
+	for _, id := range want {
+		keep[id] = true
+	}
+	for id := range idx.hot {
+		if !keep[id] {
+			delete(idx.hot, id)
+			idx.demotions++
+		}
+	}
+
+	source := idx.source
+	if source == nil {
+		source = memorySource(idx.full)
+	}
+	for _, id := range want {
+		if _, ok := idx.hot[id]; ok {
+			continue
+		}
+		full, err := source.Get(id)
+		if err != nil {
+			// Stays cold until the index is rebuilt without it
+			continue
+		}
+		idx.hot[id] = full.Copy()
+		idx.promotions++
+	}
+}
+
+// Stats describes the tiers of the index
+func (idx *Index) Stats() Stats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return Stats{
+		Hot:        len(idx.hot),
+		Cold:       len(idx.codes) - len(idx.hot),
+		Clusters:   len(idx.centroids),
+		Promotions: idx.promotions,
+		Demotions:  idx.demotions,
+		HotHits:    atomic.LoadInt64(&idx.hotHits),
+		ColdHits:   atomic.LoadInt64(&idx.coldHits),
+	}
+}
+
+// Size returns the number of vectors in the index
+func (idx *Index) Size() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.codes)
+}
+
+// GetIDs returns all vector IDs in the index
+func (idx *Index) GetIDs() []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := make([]string, 0, len(idx.codes))
+	for id := range idx.codes {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// fileKind names tiered indexes in index files
+const fileKind = "tiered"
+
+// fileV1 is the payload of tiered index files of payload version 1
+type fileV1 struct {
+	Codes     map[string][]byte
+	Cluster   map[string]int
+	Centroids [][]float32
+	Min       []float32 // Scalar quantizer ranges
+	Scale     []float32
+	Hot       map[string][]float32
+	Full      map[string][]float32
+	Hits      map[string]float64
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f fileV1) EncodePayload(e *index.Encoder) {
+	e.Uint32(uint32(len(f.Codes)))
+	for _, id := range index.SortedKeys(f.Codes) {
+		e.String(id)
+		e.ByteSlice(f.Codes[id])
+	}
+	e.Uint32(uint32(len(f.Cluster)))
+	for _, id := range index.SortedKeys(f.Cluster) {
+		e.String(id)
+		e.Int(f.Cluster[id])
+	}
+	e.Uint32(uint32(len(f.Centroids)))
+	for _, centroid := range f.Centroids {
+		e.Float32s(centroid)
+	}
+	e.Float32s(f.Min)
+	e.Float32s(f.Scale)
+	encodeValues(e, f.Hot)
+	encodeValues(e, f.Full)
+	e.Uint32(uint32(len(f.Hits)))
+	for _, id := range index.SortedKeys(f.Hits) {
+		e.String(id)
+		e.Float64(f.Hits[id])
+	}
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *fileV1) DecodePayload(d *index.Decoder) {
+	n := d.Len(8)
+	f.Codes = make(map[string][]byte, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		id := d.String()
+		f.Codes[id] = d.ByteSlice()
+	}
+	n = d.Len(12)
+	f.Cluster = make(map[string]int, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		id := d.String()
+		f.Cluster[id] = d.Int()
+	}
+	f.Centroids = make([][]float32, d.Len(4))
+	for i := range f.Centroids {
+		f.Centroids[i] = d.Float32s()
+	}
+	f.Min = d.Float32s()
+	f.Scale = d.Float32s()
+	f.Hot = decodeValues(d)
+	f.Full = decodeValues(d)
+	n = d.Len(12)
+	f.Hits = make(map[string]float64, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		id := d.String()
+		f.Hits[id] = d.Float64()
+	}
+}
+
+// encodeValues writes vector values by ID
+func encodeValues(e *index.Encoder, values map[string][]float32) {
+	e.Uint32(uint32(len(values)))
+	for _, id := range index.SortedKeys(values) {
+		e.String(id)
+		e.Float32s(values[id])
+	}
+}
+
+// decodeValues reads vector values written by encodeValues
+func decodeValues(d *index.Decoder) map[string][]float32 {
+	n := d.Len(8)
+	values := make(map[string][]float32, n)
+	for i := 0; i < n && d.Err() == nil; i++ {
+		id := d.String()
+		values[id] = d.Float32s()
+	}
+	return values
+}
+
+// Save persists the index and the access stats to the specified path in the
+// index file format. Full-precision cold vectors are expected to be
+// available from the source after loading.
+func (idx *Index) Save(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	data := fileV1{
+		Codes:     idx.codes,
+		Cluster:   idx.cluster,
+		Centroids: make([][]float32, len(idx.centroids)),
+		Min:       idx.quantizer.Min,
+		Scale:     idx.quantizer.Scale,
+		Hot:       valuesOf(idx.hot),
+		Full:      valuesOf(idx.full),
+		Hits:      idx.access.snapshot(),
+	}
+	for i, centroid := range idx.centroids {
+		data.Centroids[i] = centroid.Values
+	}
+	header := index.FileHeader{Kind: fileKind, PayloadVersion: 1, Vectors: len(idx.codes), Dimension: idx.quantizer.Dimension()}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
+	}
+	return index.WriteFile(path, header, data)
+}
+
+// Load loads the index from the specified path. Saved hits are added to the
+// access stats for vectors that have none yet.
+func (idx *Index) Load(path string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var data fileV1
+	var metricName string
+	header, payload, err := index.ReadFile(path, fileKind)
+	switch {
+	case errors.Is(err, index.ErrNotIndexFile):
+		if data, metricName, err = loadV0(path); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case header.PayloadVersion == 1:
+		if err := index.DecodePayload(header, payload, &data); err != nil {
+			return err
+		}
+		metricName = header.Metric
+	default:
+		return fmt.Errorf("%w: tiered payload version %d", index.ErrFileVersion, header.PayloadVersion)
+	}
+
+	// Set the metric if it's not already set
+	if idx.metric == nil && metricName != "" {
+		metric, err := distance.GetMetric(distance.MetricType(metricName))
+		if err != nil {
+			return err
+		}
+		idx.metric = metric
+	}
+
+	idx.reset(&quantized.ScalarQuantizer{Min: data.Min, Scale: data.Scale})
+	idx.codes = data.Codes
+	if idx.codes == nil {
+		idx.codes = make(map[string][]byte)
+	}
+	idx.centroids = make([]*vector.Vector, len(data.Centroids))
+	idx.members = make([]map[string]struct{}, len(data.Centroids))
+	for i, values := range data.Centroids {
+		idx.centroids[i] = vector.NewVector("", values)
+		idx.members[i] = make(map[string]struct{})
+	}
+	for id, c := range data.Cluster {
+		if c < 0 || c >= len(idx.members) {
+			return fmt.Errorf("vector %s is filed under missing cluster %d", id, c)
+		}
+		idx.file(id, c)
+	}
+	for id, values := range data.Hot {
+		idx.hot[id] = vector.NewVector(id, values)
+	}
+	for id, values := range data.Full {
+		idx.full[id] = vector.NewVector(id, values)
+	}
+	idx.access.restore(data.Hits)
+	return nil
+}
+
+// loadV0 reads a file saved as plain gob, before the index file format
+// existed
+func loadV0(path string) (fileV1, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fileV1{}, "", err
+	}
+	defer file.Close()
+
+	var data struct {
+		Codes     map[string][]byte
+		Cluster   map[string]int
+		Centroids [][]float32
+		Quantizer quantized.ScalarQuantizer
+		Hot       map[string][]float32
+		Full      map[string][]float32
+		Hits      map[string]float64
+		Metric    string
+	}
+	if err := gob.NewDecoder(file).Decode(&data); err != nil {
+		return fileV1{}, "", err
+	}
+	return fileV1{
+		Codes:     data.Codes,
+		Cluster:   data.Cluster,
+		Centroids: data.Centroids,
+		Min:       data.Quantizer.Min,
+		Scale:     data.Quantizer.Scale,
+		Hot:       data.Hot,
+		Full:      data.Full,
+		Hits:      data.Hits,
+	}, data.Metric, nil
+}
+
+// valuesOf returns the values of vectors by ID
+func valuesOf(vectors map[string]*vector.Vector) map[string][]float32 {
+	values := make(map[string][]float32, len(vectors))
+	for id, vec := range vectors {
+		values[id] = vec.Values
+	}
+	return values
+}
+
+// SetMetric sets the distance metric used by the index
+func (idx *Index) SetMetric(metric distance.Metric) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.metric = metric
+}
+
+// kmeans trains k centroids on a sample of vectors, starting from vectors
+// spread evenly over the input so that builds are reproducible
+func kmeans(vectors []*vector.Vector, k int, metric distance.Metric) ([]*vector.Vector, error) {
+	if k == 0 {
+		return nil, nil
+	}
+	sample := vectors
+	if limit := k * kmeansSamplesPerCluster; len(sample) > limit {
+		sample = make([]*vector.Vector, limit)
+		for i := range sample {
+			sample[i] = vectors[i*len(vectors)/limit]
+		}
+	}
+
+	centroids := make([]*vector.Vector, k)
+	for i := range centroids {
+		centroids[i] = sample[i*len(sample)/k].Copy()
+	}
+
+	dim := centroids[0].Dimension
+	assignment := make([]int, len(sample))
+	for i := range assignment {
+		assignment[i] = -1
+	}
+	for iteration := 0; iteration < kmeansIterations; iteration++ {
+		changed, err := assign(centroids, sample, metric, assignment)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			break
+		}
+
+		// Move every centroid to the mean of its vectors; empty clusters
+		// keep theirs
+		sums := make([][]float64, k)
+		counts := make([]int, k)
+		for i, vec := range sample {
+			c := assignment[i]
+			if sums[c] == nil {
+				sums[c] = make([]float64, dim)
+			}
+			for d, value := range vec.Values {
+				sums[c][d] += float64(value)
+			}
+			counts[c]++
+		}
+		for c, sum := range sums {
+			if counts[c] == 0 {
+				continue
+			}
+			for d := range sum {
+				centroids[c].Values[d] = float32(sum[d] / float64(counts[c]))
+			}
+		}
+	}
+	return centroids, nil
+}
+
+// assign sets assignment[i] to the centroid nearest to vectors[i], in
+// parallel, and reports whether any assignment changed
+func assign(centroids, vectors []*vector.Vector, metric distance.Metric, assignment []int) (bool, error) {
+	var changed atomic.Bool
+	err := concurrency.ForEachChunk(len(vectors), assignChunk, func(start, end int) error {
+		for i := start; i < end; i++ {
+			c, err := nearestCentroid(centroids, vectors[i], metric)
+			if err != nil {
+				return err
+			}
+			if c != assignment[i] {
+				assignment[i] = c
+				changed.Store(true)
+			}
+		}
+		return nil
+	})
+	return changed.Load(), err
+}
+
+// nearestCentroid returns the index of the centroid nearest to vec
+func nearestCentroid(centroids []*vector.Vector, vec *vector.Vector, metric distance.Metric) (int, error) {
+	nearest, best := 0, float32(math.Inf(1))
+	for c, centroid := range centroids {
+		dist, err := metric.Distance(vec, centroid)
+		if err != nil {
+			return 0, err
+		}
+		if dist < best {
+			nearest, best = c, dist
+		}
+	}
+	return nearest, nil
+}
@@ -0,0 +1,247 @@
+package tiered
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index/flat"
+)
+
+// source serves vectors by ID and counts the reads
+type source struct {
+	vectors map[string]*vector.Vector
+	reads   int
+}
+
+func (s *source) Get(id string) (*vector.Vector, error) {
+	s.reads++
+	v, ok := s.vectors[id]
+	if !ok {
+		return nil, ErrVectorNotFound
+	}
+	return v, nil
+}
+
+// clustered returns n vectors in 10 clusters and a source serving them
+func clustered(t *testing.T, n int) ([]*vector.Vector, *source) {
+	t.Helper()
+	gen, err := vector.NewClusterGenerator(16, 10, 0.1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	vectors := make([]*vector.Vector, n)
+	src := &source{vectors: make(map[string]*vector.Vector, n)}
+	for i := range vectors {
+		vectors[i], _ = gen.Next(fmt.Sprintf("v%04d", i))
+		src.vectors[vectors[i].ID] = vectors[i]
+	}
+	return vectors, src
+}
+
+func TestTieredSearch(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	vectors, src := clustered(t, 1000)
+	idx := NewIndex(src, metric, &Options{Probes: 3, Candidates: 50})
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	exact := flat.NewFlatIndex(metric)
+	exact.Build(vectors)
+
+	if stats := idx.Stats(); stats.Clusters != 32 || stats.Cold != 1000 || stats.Hot != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Clustered data is found by probing the few nearest clusters
+	found, total := 0, 0
+	for _, query := range vectors[:50] {
+		results, err := idx.Search(query, 10)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		want, _ := exact.Search(query, 10)
+		if results[0].ID != query.ID || results[0].Distance != 0 || results[0].Vector == nil {
+			t.Errorf("Expected %s first with its exact distance, got %+v", query.ID, results[0])
+		}
+		ids := make(map[string]bool)
+		for _, r := range results {
+			ids[r.ID] = true
+		}
+		for _, r := range want {
+			total++
+			if ids[r.ID] {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(total); recall < 0.9 {
+		t.Errorf("Expected a recall of at least 0.9, got %.2f", recall)
+	}
+
+	if _, err := idx.Search(vector.NewVector("q", []float32{1}), 1); err != vector.ErrInvalidDimension {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+	if _, err := idx.Search(vectors[0], 0); err != ErrInvalidK {
+		t.Errorf("Expected ErrInvalidK, got %v", err)
+	}
+}
+
+func TestTiering(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	vectors, src := clustered(t, 200)
+	access := NewAccessStats(0)
+	opts := &Options{Probes: 1, Candidates: 10, HotSize: 3, MinHits: 2, RetierEvery: 5, Access: access}
+	idx := NewIndex(src, metric, opts)
+	if err := idx.Build(vectors); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+
+	// Five searches for one vector promote the 3 vectors found most
+	for i := 0; i < 5; i++ {
+		idx.Search(vectors[7], 3)
+	}
+	stats := idx.Stats()
+	if stats.Hot != 3 || stats.Promotions != 3 || stats.ColdHits != 15 {
+		t.Errorf("Expected 3 promotions after 15 cold hits, got %+v", stats)
+	}
+
+	// Hot vectors are served without reading the source
+	reads := src.reads
+	results, _ := idx.Search(vectors[7], 1)
+	if results[0].ID != vectors[7].ID || idx.Stats().HotHits != 1 {
+		t.Errorf("Expected %s from the hot tier, got %+v (%+v)", vectors[7].ID, results, idx.Stats())
+	}
+	if src.reads-reads > 10 {
+		t.Errorf("Expected at most the 10 cold candidates to be read, got %d reads", src.reads-reads)
+	}
+
+	// A rebuilt index starts with the hot vectors of the shared stats
+	rebuilt := NewIndex(src, metric, opts)
+	rebuilt.Build(vectors)
+	if stats := rebuilt.Stats(); stats.Hot != 3 || stats.Promotions != 0 {
+		t.Errorf("Expected the rebuilt index to start with 3 hot vectors, got %+v", stats)
+	}
+
+	// Searching elsewhere cools them down
+	for i := 0; i < 20; i++ {
+		idx.Search(vectors[100], 3)
+	}
+	if stats := idx.Stats(); stats.Demotions == 0 {
+		t.Errorf("Expected vectors to be demoted, got %+v", stats)
+	}
+
+	if err := idx.Delete(vectors[100].ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := idx.Delete(vectors[100].ID); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+	if results, _ := idx.Search(vectors[100], 1); results[0].ID == vectors[100].ID {
+		t.Errorf("Expected the deleted vector not to be found")
+	}
+}
+
+func TestTieredAdd(t *testing.T) {
+	idx := NewIndex(nil, &distance.EuclideanDistance{}, nil)
+	for i := 0; i < 9; i++ {
+		if err := idx.Add(vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 0})); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := idx.Add(vector.NewVector("v0", []float32{0, 0})); err != ErrVectorAlreadyExists {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	// Without a source the index keeps full vectors, so distances are exact
+	results, err := idx.Search(vector.NewVector("q", []float32{8, 0}), 2)
+	if err != nil || len(results) != 2 || results[0].ID != "v8" || results[0].Distance != 0 {
+		t.Errorf("Expected v8 at distance 0, got %+v (%v)", results, err)
+	}
+	if stats := idx.Stats(); stats.Clusters != 3 {
+		t.Errorf("Expected 3 clusters for 9 vectors, got %+v", stats)
+	}
+}
+
+func TestTieredAddRecall(t *testing.T) {
+	src := &source{vectors: make(map[string]*vector.Vector)}
+	idx := NewIndex(src, &distance.EuclideanDistance{}, &Options{Probes: 1, Candidates: 1})
+	for i := 0; i < 50; i++ {
+		vec := vector.NewVector(fmt.Sprintf("v%02d", i), []float32{float32(i), float32(i)})
+		src.vectors[vec.ID] = vec
+		if err := idx.Add(vec); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	// The codes of an index grown by Add rank the cold candidates, so the
+	// one candidate rescored is the nearest vector of the probed cluster
+	for _, i := range []int{0, 17, 40, 49} {
+		want := fmt.Sprintf("v%02d", i)
+		results, err := idx.Search(vector.NewVector("q", []float32{float32(i), float32(i)}), 1)
+		if err != nil || len(results) != 1 || results[0].ID != want || results[0].Distance != 0 {
+			t.Errorf("Expected %s at distance 0, got %+v (%v)", want, results, err)
+		}
+	}
+}
+
+func TestTieredSaveLoad(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	vectors, src := clustered(t, 100)
+	opts := &Options{Probes: 2, Candidates: 20, HotSize: 5, MinHits: 1, RetierEvery: 1}
+	idx := NewIndex(src, metric, opts)
+	idx.Build(vectors)
+	idx.Search(vectors[3], 5)
+
+	path := filepath.Join(t.TempDir(), "tiered.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	access := NewAccessStats(0)
+	loaded := NewIndex(src, nil, &Options{Probes: 2, Candidates: 20, HotSize: 5, MinHits: 1, Access: access})
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Size() != 100 || loaded.Stats() != (Stats{Hot: 5, Cold: 95, Clusters: 10}) {
+		t.Errorf("Unexpected loaded index: %d vectors, %+v", loaded.Size(), loaded.Stats())
+	}
+	if access.Hits(vectors[3].ID) != 1 {
+		t.Errorf("Expected the saved hits to be restored, got %f", access.Hits(vectors[3].ID))
+	}
+	want, _ := idx.Search(vectors[42], 3)
+	got, err := loaded.Search(vectors[42], 3)
+	if err != nil || len(got) != 3 || got[0].ID != want[0].ID || got[2].ID != want[2].ID {
+		t.Errorf("Expected %+v from the loaded index, got %+v (%v)", want, got, err)
+	}
+}
+
+func TestAccessStats(t *testing.T) {
+	access := NewAccessStats(2)
+	access.Record([]string{"a", "b"})
+	access.Record([]string{"a"})
+	// The first hit decayed for one search
+	want := 1 + math.Exp2(-0.5)
+	if hits := access.Hits("a"); math.Abs(hits-want) > 1e-9 {
+		t.Errorf("Expected %f hits, got %f", want, hits)
+	}
+
+	// Two searches later the hits count half
+	access.Record(nil)
+	access.Record(nil)
+	if hits := access.Hits("a"); math.Abs(hits-want/2) > 1e-9 {
+		t.Errorf("Expected the hits to halve, got %f", hits)
+	}
+	if hot := access.Hottest(5, 0.5, func(string) bool { return true }); len(hot) != 1 || hot[0] != "a" {
+		t.Errorf("Expected only a to be hot, got %v", hot)
+	}
+	if hot := access.Hottest(5, 0, func(id string) bool { return id != "a" }); len(hot) != 1 || hot[0] != "b" {
+		t.Errorf("Expected the filter to leave b, got %v", hot)
+	}
+	if access.Searches() != 4 {
+		t.Errorf("Expected 4 searches, got %d", access.Searches())
+	}
+}
@@ -0,0 +1,286 @@
+package twostage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/index"
+)
+
+var (
+	// ErrMetricRequired is returned when a distance metric is required but not set
+	ErrMetricRequired = errs.New(errs.InvalidArgument, "distance metric is required")
+)
+
+// Source provides full-precision vectors for rescoring, e.g. a storage.VectorStore
+type Source interface {
+	Get(id string) (*vector.Vector, error)
+}
+
+// Options controls two-stage search
+type Options struct {
+	Candidates int // Number of coarse candidates rescored exactly (at least k)
+}
+
+// DefaultOptions returns options that rescore 100 candidates
+func DefaultOptions() *Options {
+	return &Options{
+		Candidates: 100,
+	}
+}
+
+// Index runs a search in two stages: the coarse index (e.g. a quantized or
+// compressed index) scans for the top candidates, then their exact distances
+// are recomputed from full-precision vectors before the top k are returned.
+type Index struct {
+	coarse  index.Index
+	source  Source
+	metric  distance.Metric
+	opts    Options
+	vectors map[string]*vector.Vector // Full vectors when no source is set
+	mu      sync.RWMutex
+}
+
+// memorySource serves full-precision vectors kept by the index itself
+type memorySource map[string]*vector.Vector
+
+func (m memorySource) Get(id string) (*vector.Vector, error) {
+	v, ok := m[id]
+	if !ok {
+		return nil, fmt.Errorf("vector not found: %s", id)
+	}
+	return v, nil
+}
+
+// NewIndex wraps a coarse index with exact rescoring. If source is nil, the
+// full-precision vectors are kept in memory alongside the coarse index.
+func NewIndex(coarse index.Index, source Source, metric distance.Metric, options *Options) *Index {
+	opts := DefaultOptions()
+	if options != nil {
+		opts = options
+	}
+
+	return &Index{
+		coarse:  coarse,
+		source:  source,
+		metric:  metric,
+		opts:    *opts,
+		vectors: make(map[string]*vector.Vector),
+	}
+}
+
+// Name returns the name of the index
+func (idx *Index) Name() string {
+	return fmt.Sprintf("twostage(%s)", idx.coarse.Name())
+}
+
+// Build constructs the coarse index from a set of vectors
+func (idx *Index) Build(vectors []*vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.vectors = make(map[string]*vector.Vector)
+	if idx.source == nil {
+		for _, vec := range vectors {
+			idx.vectors[vec.ID] = vec.Copy()
+		}
+	}
+
+	return idx.coarse.Build(vectors)
+}
+
+// Add adds a vector to the index
+func (idx *Index) Add(vec *vector.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.coarse.Add(vec); err != nil {
+		return err
+	}
+	if idx.source == nil {
+		idx.vectors[vec.ID] = vec.Copy()
+	}
+	return nil
+}
+
+// Delete removes a vector from the index
+func (idx *Index) Delete(id string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if err := idx.coarse.Delete(id); err != nil {
+		return err
+	}
+	delete(idx.vectors, id)
+	return nil
+}
+
+// Search finds candidates with the coarse index and returns the k nearest by
+// exact distance
+func (idx *Index) Search(query *vector.Vector, k int) (index.SearchResults, error) {
+	return idx.SearchWithOptions(query, k, index.SearchOptions{})
+}
+
+// SearchWithOptions performs a search tuned by opts
+func (idx *Index) SearchWithOptions(query *vector.Vector, k int, opts index.SearchOptions) (index.SearchResults, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.metric == nil {
+		return nil, ErrMetricRequired
+	}
+
+	// Stage 1: coarse scan for the top candidates
+	candidates := idx.opts.Candidates
+	if candidates < k {
+		candidates = k
+	}
+	// Exact vectors come from the source, not the coarse approximations
+	results, err := index.SearchWithOptions(idx.coarse, query, candidates, index.SearchOptions{OmitVectors: true, EfSearch: opts.EfSearch, Stats: opts.Stats})
+	if err != nil {
+		return nil, err
+	}
+
+	source := idx.source
+	if source == nil {
+		source = memorySource(idx.vectors)
+	}
+
+	// Stage 2: exact distances from full-precision vectors
+	rescored := make(index.SearchResults, 0, len(results))
+	for _, result := range results {
+		full, err := source.Get(result.ID)
+		if err != nil {
+			// Removed from the source since the coarse index was built
+			continue
+		}
+
+		dist, err := idx.metric.Distance(query, full)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Stats != nil {
+			opts.Stats.DistanceComputations++
+		}
+		rescored = append(rescored, index.SearchResult{ID: result.ID, Distance: dist})
+		if !opts.OmitVectors {
+			rescored[len(rescored)-1].Vector = full.Copy()
+		}
+	}
+
+	rescored.Sort()
+	if k < len(rescored) {
+		rescored = rescored[:k]
+	}
+	return rescored, nil
+}
+
+// Size returns the number of vectors in the index
+func (idx *Index) Size() int {
+	return idx.coarse.Size()
+}
+
+// GetIDs returns all vector IDs in the index
+func (idx *Index) GetIDs() []string {
+	return idx.coarse.GetIDs()
+}
+
+// vectorsKind names the full-precision vectors of an index without a
+// source in index files
+const vectorsKind = "twostage-vectors"
+
+// vectorsPath returns the path of the file holding the full-precision
+// vectors of the index saved to path
+func vectorsPath(path string) string {
+	return path + ".vectors"
+}
+
+// vectorsV1 is the payload of two-stage vector files of payload version 1
+type vectorsV1 struct {
+	Vectors []index.VectorRecord // In ID order
+}
+
+// EncodePayload implements index.PayloadEncoder
+func (f vectorsV1) EncodePayload(e *index.Encoder) {
+	e.Uint32(uint32(len(f.Vectors)))
+	for _, record := range f.Vectors {
+		e.Vector(record)
+	}
+}
+
+// DecodePayload implements index.PayloadDecoder
+func (f *vectorsV1) DecodePayload(d *index.Decoder) {
+	f.Vectors = make([]index.VectorRecord, d.Len(4))
+	for i := range f.Vectors {
+		f.Vectors[i] = d.Vector()
+	}
+}
+
+// Save persists the coarse index to the specified path. Without a source,
+// the full-precision vectors are saved next to it, to path + ".vectors";
+// with one, they are expected to be available from it after loading.
+func (idx *Index) Save(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if err := idx.coarse.Save(path); err != nil {
+		return err
+	}
+	if idx.source != nil {
+		return nil
+	}
+
+	data := vectorsV1{Vectors: make([]index.VectorRecord, 0, len(idx.vectors))}
+	header := index.FileHeader{Kind: vectorsKind, PayloadVersion: 1, Vectors: len(idx.vectors)}
+	for _, id := range index.SortedKeys(idx.vectors) {
+		data.Vectors = append(data.Vectors, index.NewVectorRecord(idx.vectors[id]))
+		header.Dimension = idx.vectors[id].Dimension
+	}
+	if idx.metric != nil {
+		header.Metric = string(idx.metric.Name())
+	}
+	return index.WriteFile(vectorsPath(path), header, data)
+}
+
+// Load loads the coarse index from the specified path, and without a
+// source the full-precision vectors saved next to it
+func (idx *Index) Load(path string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	vectors := make(map[string]*vector.Vector)
+	if idx.source == nil {
+		header, payload, err := index.ReadFile(vectorsPath(path), vectorsKind)
+		if err != nil {
+			return fmt.Errorf("failed to load full-precision vectors: %w", err)
+		}
+		if header.PayloadVersion != 1 {
+			return fmt.Errorf("%w: two-stage vectors payload version %d", index.ErrFileVersion, header.PayloadVersion)
+		}
+		var data vectorsV1
+		if err := index.DecodePayload(header, payload, &data); err != nil {
+			return err
+		}
+		for _, record := range data.Vectors {
+			vectors[record.ID] = record.Vector()
+		}
+	}
+
+	if err := idx.coarse.Load(path); err != nil {
+		return err
+	}
+	idx.vectors = vectors
+	return nil
+}
+
+// SetMetric sets the distance metric used by the index
+func (idx *Index) SetMetric(metric distance.Metric) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.metric = metric
+	idx.coarse.SetMetric(metric)
+}
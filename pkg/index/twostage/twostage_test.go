@@ -0,0 +1,113 @@
+package twostage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index/quantized"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// testVectors returns two vectors that quantize to the same code but differ
+// at full precision
+func testVectors() []*vector.Vector {
+	return []*vector.Vector{
+		vector.NewVector("min", []float32{0.0}),
+		vector.NewVector("near", []float32{0.501}),
+		vector.NewVector("exact", []float32{0.5}),
+		vector.NewVector("max", []float32{255.0}),
+	}
+}
+
+func TestTwoStageWithStore(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for _, v := range testVectors() {
+		store.Insert(v)
+	}
+
+	metric := &distance.EuclideanDistance{}
+	idx := NewIndex(quantized.NewQuantizedIndex(metric), store, metric, &Options{Candidates: 3})
+	if err := idx.Build(testVectors()); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+
+	query := vector.NewVector("query", []float32{0.5})
+	results, err := idx.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// The coarse stage cannot tell near and exact apart; rescoring can
+	if len(results) != 1 || results[0].ID != "exact" || results[0].Distance != 0 {
+		t.Errorf("Expected exact with distance 0, got %v", results)
+	}
+
+	// Vectors deleted from the store are dropped from the results
+	store.Delete("exact")
+	results, err = idx.Search(query, 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != "near" {
+		t.Errorf("Expected near after deleting exact, got %v", results)
+	}
+}
+
+func TestTwoStageInMemory(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	idx := NewIndex(quantized.NewQuantizedIndex(metric), nil, metric, nil)
+	if err := idx.Build(testVectors()); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	if err := idx.Add(vector.NewVector("added", []float32{0.4999})); err != nil {
+		t.Fatalf("Failed to add vector: %v", err)
+	}
+
+	results, err := idx.Search(vector.NewVector("query", []float32{0.5}), 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "exact" || results[1].ID != "added" {
+		t.Errorf("Expected exact and added, got %v", results)
+	}
+	if idx.Size() != 5 {
+		t.Errorf("Expected 5 vectors, got %d", idx.Size())
+	}
+}
+
+func TestTwoStageSaveLoad(t *testing.T) {
+	metric := &distance.EuclideanDistance{}
+	idx := NewIndex(quantized.NewQuantizedIndex(metric), nil, metric, nil)
+	if err := idx.Build(testVectors()); err != nil {
+		t.Fatalf("Failed to build index: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "twostage.idx")
+	if err := idx.Save(path); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+
+	// Without a source the full vectors are saved with the coarse index
+	loaded := NewIndex(quantized.NewQuantizedIndex(metric), nil, metric, nil)
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	results, err := loaded.Search(vector.NewVector("query", []float32{0.5}), 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if loaded.Size() != 4 || len(results) != 2 || results[0].ID != "exact" || results[0].Distance != 0 || results[1].ID != "near" {
+		t.Errorf("Expected exact and near from 4 vectors, got %v (%d vectors)", results, loaded.Size())
+	}
+
+	// A missing vector file fails the load rather than every search
+	if err := os.Remove(vectorsPath(path)); err != nil {
+		t.Fatalf("Failed to remove vectors: %v", err)
+	}
+	if err := NewIndex(quantized.NewQuantizedIndex(metric), nil, metric, nil).Load(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package interchange
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/ipc"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+)
+
+// arrowWriter writes the Arrow IPC file format
+type arrowWriter struct {
+	file   *os.File
+	writer *ipc.FileWriter
+}
+
+func newArrowWriter(path string, schema *arrow.Schema) (*arrowWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create arrow file: %w", err)
+	}
+
+	writer, err := ipc.NewFileWriter(file, ipc.WithSchema(schema), ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to create arrow writer: %w", err)
+	}
+
+	return &arrowWriter{file: file, writer: writer}, nil
+}
+
+func (w *arrowWriter) Write(rec arrow.Record) error {
+	return w.writer.Write(rec)
+}
+
+func (w *arrowWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// arrowReader reads the Arrow IPC file format, or the streaming format if
+// the file has no IPC file footer
+type arrowReader struct {
+	file   *os.File
+	reader *ipc.FileReader // Set for the file format
+	stream *ipc.Reader     // Set for the streaming format
+	next   int
+}
+
+func openArrowReader(path string) (*arrowReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open arrow file: %w", err)
+	}
+
+	reader, err := ipc.NewFileReader(file, ipc.WithAllocator(memory.DefaultAllocator))
+	if err == nil {
+		return &arrowReader{file: file, reader: reader}, nil
+	}
+
+	// Fall back to the streaming format
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := ipc.NewReader(file, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read arrow file: %w", err)
+	}
+	return &arrowReader{file: file, stream: stream}, nil
+}
+
+func (r *arrowReader) Next() (arrow.Record, error) {
+	if r.stream != nil {
+		if r.stream.Next() {
+			return r.stream.Record(), nil
+		}
+		if err := r.stream.Err(); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	if r.next >= r.reader.NumRecords() {
+		return nil, io.EOF
+	}
+	rec, err := r.reader.Record(r.next)
+	if err != nil {
+		return nil, err
+	}
+	r.next++
+	return rec, nil
+}
+
+func (r *arrowReader) Close() error {
+	if r.stream != nil {
+		r.stream.Release()
+	} else {
+		r.reader.Close()
+	}
+	return r.file.Close()
+}
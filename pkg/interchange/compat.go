@@ -0,0 +1,501 @@
+package interchange
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// Source identifies the export format of another vector database
+type Source string
+
+const (
+	// SourceQdrant is a JSON dump of Qdrant points, as returned by the scroll
+	// API: an array of points, a {"points": [...]} or {"result": {"points":
+	// [...]}} envelope, or one point per line
+	SourceQdrant Source = "qdrant"
+
+	// SourceChroma is a Parquet export of a Chroma collection with id,
+	// embedding, document and metadata columns
+	SourceChroma Source = "chroma"
+
+	// SourcePgvector is the text output of COPY ... TO for a pgvector table
+	SourcePgvector Source = "pgvector"
+)
+
+// MetadataKeyDocument is the metadata key holding the source document of
+// vectors imported from Chroma
+const MetadataKeyDocument = "document"
+
+var (
+	// ErrUnknownSource is returned for an unsupported source database
+	ErrUnknownSource = errors.New("unknown import source")
+
+	// ErrAmbiguousVector is returned when a point has several named vectors
+	// and none was selected
+	ErrAmbiguousVector = errors.New("point has multiple named vectors")
+)
+
+// CompatOptions configures imports from other vector databases
+type CompatOptions struct {
+	ImportOptions
+
+	// VectorName selects one of several named vectors of Qdrant points
+	VectorName string
+
+	// Columns names the columns of pgvector COPY output, in order. The "id"
+	// column becomes the vector ID, "embedding" (or "vector") the values and a
+	// "metadata" JSON object is flattened into metadata; other columns are
+	// kept as metadata under their name. Defaults to id, embedding, metadata.
+	Columns []string
+}
+
+// DefaultCompatOptions returns default compatibility import options
+func DefaultCompatOptions() *CompatOptions {
+	return &CompatOptions{
+		Columns: []string{"id", "embedding", "metadata"},
+	}
+}
+
+// ParseSource parses the name of a source database
+func ParseSource(name string) (Source, error) {
+	switch Source(strings.ToLower(name)) {
+	case SourceQdrant:
+		return SourceQdrant, nil
+	case SourceChroma:
+		return SourceChroma, nil
+	case SourcePgvector, "postgres":
+		return SourcePgvector, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownSource, name)
+	}
+}
+
+// ImportFrom reads the export of another vector database into a store.
+// Vectors whose IDs already exist are overwritten.
+func ImportFrom(store storage.VectorStore, path string, source Source, opts *CompatOptions) (*ImportStats, error) {
+	if opts == nil {
+		opts = DefaultCompatOptions()
+	}
+
+	switch source {
+	case SourceQdrant:
+		return importQdrant(store, path, opts)
+	case SourceChroma:
+		return importChroma(store, path, opts)
+	case SourcePgvector:
+		return importPgvector(store, path, opts)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSource, source)
+	}
+}
+
+// qdrantPoint is a point as exported by Qdrant
+type qdrantPoint struct {
+	ID      json.RawMessage        `json:"id"`
+	Vector  json.RawMessage        `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+func importQdrant(store storage.VectorStore, path string, opts *CompatOptions) (*ImportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open qdrant export: %w", err)
+	}
+	defer f.Close()
+
+	stats := &ImportStats{}
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return stats, fmt.Errorf("failed to parse qdrant export: %w", err)
+		}
+
+		points, err := qdrantPoints(raw)
+		if err != nil {
+			return stats, err
+		}
+
+		vectors := make([]*vector.Vector, 0, len(points))
+		for _, p := range points {
+			v, err := p.toVector(opts.VectorName)
+			if err != nil {
+				return stats, err
+			}
+			vectors = append(vectors, v)
+		}
+		if err := storeVectors(store, vectors, stats, &opts.ImportOptions); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// qdrantPoints unwraps the points of one top-level JSON value
+func qdrantPoints(raw json.RawMessage) ([]qdrantPoint, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var points []qdrantPoint
+		if err := json.Unmarshal(raw, &points); err != nil {
+			return nil, fmt.Errorf("failed to parse qdrant points: %w", err)
+		}
+		return points, nil
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse qdrant export: %w", err)
+	}
+	if result, ok := envelope["result"]; ok {
+		return qdrantPoints(result)
+	}
+	if points, ok := envelope["points"]; ok {
+		return qdrantPoints(points)
+	}
+
+	var point qdrantPoint
+	if err := json.Unmarshal(raw, &point); err != nil {
+		return nil, fmt.Errorf("failed to parse qdrant point: %w", err)
+	}
+	return []qdrantPoint{point}, nil
+}
+
+func (p *qdrantPoint) toVector(vectorName string) (*vector.Vector, error) {
+	// IDs are unsigned integers or UUID strings
+	var id string
+	if err := json.Unmarshal(p.ID, &id); err != nil {
+		var num json.Number
+		if err := json.Unmarshal(p.ID, &num); err != nil || num == "" {
+			return nil, fmt.Errorf("%w: invalid qdrant point id %s", ErrInvalidSchema, p.ID)
+		}
+		id = num.String()
+	}
+
+	values, err := qdrantValues(p.Vector, vectorName)
+	if err != nil {
+		return nil, fmt.Errorf("point %s: %w", id, err)
+	}
+
+	v := vector.NewVector(id, values)
+	flattenPayload("", p.Payload, v.Metadata)
+	return v, nil
+}
+
+// qdrantValues decodes a plain vector or picks one of several named vectors
+func qdrantValues(raw json.RawMessage, vectorName string) ([]float32, error) {
+	var values []float32
+	if err := json.Unmarshal(raw, &values); err == nil {
+		if values == nil {
+			return nil, fmt.Errorf("%w: missing vector", ErrInvalidSchema)
+		}
+		return values, nil
+	}
+
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return nil, fmt.Errorf("%w: invalid vector", ErrInvalidSchema)
+	}
+
+	if vectorName == "" {
+		if len(named) != 1 {
+			names := make([]string, 0, len(named))
+			for name := range named {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%w: %v", ErrAmbiguousVector, names)
+		}
+		for name := range named {
+			vectorName = name
+		}
+	}
+
+	selected, ok := named[vectorName]
+	if !ok {
+		return nil, fmt.Errorf("%w: no vector named %q", ErrInvalidSchema, vectorName)
+	}
+	if err := json.Unmarshal(selected, &values); err != nil {
+		// Sparse and multi-vectors have no dense representation
+		return nil, fmt.Errorf("%w: vector %q is not a dense vector", ErrInvalidSchema, vectorName)
+	}
+	return values, nil
+}
+
+// flattenPayload converts a JSON payload to string metadata. Nested objects
+// become dotted keys, strings are kept as-is and other values (numbers,
+// booleans, arrays) are stored as JSON.
+func flattenPayload(prefix string, payload map[string]interface{}, metadata map[string]string) {
+	for key, value := range payload {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case nil:
+		case string:
+			metadata[key] = v
+		case map[string]interface{}:
+			flattenPayload(key, v, metadata)
+		default:
+			encoded, err := json.Marshal(v)
+			if err == nil {
+				metadata[key] = string(encoded)
+			}
+		}
+	}
+}
+
+func importChroma(store storage.VectorStore, path string, opts *CompatOptions) (*ImportStats, error) {
+	r, err := openParquetReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	stats := &ImportStats{}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read record batch: %w", err)
+		}
+
+		vectors, err := chromaVectors(rec)
+		if err != nil {
+			return stats, err
+		}
+		if err := storeVectors(store, vectors, stats, &opts.ImportOptions); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// chromaVectors converts a record batch of a Chroma export. The metadata
+// column holds a JSON object per row or a struct column.
+func chromaVectors(rec arrow.Record) ([]*vector.Vector, error) {
+	schema := rec.Schema()
+
+	vectorColumn := "embedding"
+	if !schema.HasField(vectorColumn) {
+		vectorColumn = "embeddings"
+	}
+	vectors, err := recordVectors(rec, "id", vectorColumn)
+	if err != nil {
+		return nil, err
+	}
+
+	if idx := schema.FieldIndices(MetadataKeyDocument); len(idx) > 0 {
+		docs := rec.Column(idx[0])
+		for i, v := range vectors {
+			if docs.IsValid(i) {
+				v.Metadata[MetadataKeyDocument] = docs.ValueStr(i)
+			}
+		}
+	}
+
+	idx := schema.FieldIndices(ColumnMetadata)
+	if len(idx) == 0 {
+		return vectors, nil
+	}
+
+	switch meta := rec.Column(idx[0]).(type) {
+	case *array.Struct:
+		fields := meta.DataType().(*arrow.StructType).Fields()
+		for i, v := range vectors {
+			for f, field := range fields {
+				if column := meta.Field(f); meta.IsValid(i) && column.IsValid(i) {
+					v.Metadata[field.Name] = column.ValueStr(i)
+				}
+			}
+		}
+	case array.StringLike:
+		for i, v := range vectors {
+			if meta.IsNull(i) || meta.ValueStr(i) == "" {
+				continue
+			}
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(meta.ValueStr(i)), &payload); err != nil {
+				return nil, fmt.Errorf("%w: invalid metadata JSON for %s: %v", ErrInvalidSchema, v.ID, err)
+			}
+			flattenPayload("", payload, v.Metadata)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q must be a JSON string or struct column", ErrInvalidSchema, ColumnMetadata)
+	}
+
+	return vectors, nil
+}
+
+func importPgvector(store storage.VectorStore, path string, opts *CompatOptions) (*ImportStats, error) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultCompatOptions().Columns
+	}
+
+	idCol, vecCol := -1, -1
+	for i, name := range columns {
+		switch name {
+		case "id":
+			idCol = i
+		case "embedding", "vector":
+			vecCol = i
+		}
+	}
+	if idCol == -1 || vecCol == -1 {
+		return nil, fmt.Errorf("%w: columns must include id and embedding, got %v", ErrInvalidSchema, columns)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pgvector export: %w", err)
+	}
+	defer f.Close()
+
+	stats := &ImportStats{}
+	batch := make([]*vector.Vector, 0, batchSize)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || text == `\.` {
+			continue
+		}
+
+		fields := strings.Split(text, "\t")
+		if len(fields) != len(columns) {
+			return stats, fmt.Errorf("%w: line %d has %d columns, expected %d", ErrInvalidSchema, line, len(fields), len(columns))
+		}
+
+		v, err := pgvectorRow(columns, fields, idCol, vecCol)
+		if err != nil {
+			return stats, fmt.Errorf("line %d: %w", line, err)
+		}
+		batch = append(batch, v)
+
+		if len(batch) >= batchSize {
+			if err := storeVectors(store, batch, stats, &opts.ImportOptions); err != nil {
+				return stats, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read pgvector export: %w", err)
+	}
+
+	if err := storeVectors(store, batch, stats, &opts.ImportOptions); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
+
+// pgvectorRow converts the fields of one COPY row to a vector
+func pgvectorRow(columns, fields []string, idCol, vecCol int) (*vector.Vector, error) {
+	if fields[idCol] == `\N` || fields[vecCol] == `\N` {
+		return nil, fmt.Errorf("%w: null id or embedding", ErrInvalidSchema)
+	}
+
+	values, err := parsePgvector(copyUnescape(fields[vecCol]))
+	if err != nil {
+		return nil, err
+	}
+	v := vector.NewVector(copyUnescape(fields[idCol]), values)
+
+	for i, name := range columns {
+		if i == idCol || i == vecCol || fields[i] == `\N` {
+			continue
+		}
+		value := copyUnescape(fields[i])
+
+		if name == ColumnMetadata {
+			var payload map[string]interface{}
+			if err := json.Unmarshal([]byte(value), &payload); err != nil {
+				return nil, fmt.Errorf("%w: invalid metadata JSON: %v", ErrInvalidSchema, err)
+			}
+			flattenPayload("", payload, v.Metadata)
+			continue
+		}
+		v.Metadata[name] = value
+	}
+
+	return v, nil
+}
+
+// parsePgvector parses the text form of a vector or halfvec, e.g. [1,2.5,3]
+func parsePgvector(text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("%w: invalid vector %q", ErrInvalidSchema, text)
+	}
+	text = strings.TrimSpace(text[1 : len(text)-1])
+	if text == "" {
+		return nil, fmt.Errorf("%w: empty vector", ErrInvalidSchema)
+	}
+
+	parts := strings.Split(text, ",")
+	values := make([]float32, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid vector component %q", ErrInvalidSchema, part)
+		}
+		values[i] = float32(value)
+	}
+	return values, nil
+}
+
+// copyUnescape reverses the backslash escapes of the COPY text format
+func copyUnescape(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		if c != '\\' || i+1 == len(field) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch field[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'v':
+			b.WriteByte('\v')
+		default:
+			b.WriteByte(field[i])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,178 @@
+package interchange
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/apache/arrow/go/v16/parquet/pqarrow"
+
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// writeFile writes a test fixture and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestImportQdrant(t *testing.T) {
+	exports := map[string]string{
+		"scroll": `{"result": {"points": [
+			{"id": 1, "vector": [1, 2, 3], "payload": {"city": "Berlin", "count": 3, "geo": {"lat": 52.5}}},
+			{"id": "5c56c793-69f3-4fbf-87e6-c4bf54c28c26", "vector": [4, 5, 6], "payload": null}
+		]}, "status": "ok"}`,
+		"jsonl": `{"id": 1, "vector": [1, 2, 3], "payload": {"city": "Berlin", "count": 3, "geo": {"lat": 52.5}}}
+{"id": "5c56c793-69f3-4fbf-87e6-c4bf54c28c26", "vector": [4, 5, 6]}`,
+	}
+
+	for name, content := range exports {
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewMemoryStore()
+			stats, err := ImportFrom(store, writeFile(t, "points.json", content), SourceQdrant, nil)
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if stats.Inserted != 2 {
+				t.Errorf("Expected 2 vectors inserted, got %+v", stats)
+			}
+
+			v, err := store.Get("1")
+			if err != nil {
+				t.Fatalf("Failed to get point 1: %v", err)
+			}
+			want := map[string]string{"city": "Berlin", "count": "3", "geo.lat": "52.5"}
+			if fmt.Sprint(v.Metadata) != fmt.Sprint(want) {
+				t.Errorf("Expected metadata %v, got %v", want, v.Metadata)
+			}
+			if _, err := store.Get("5c56c793-69f3-4fbf-87e6-c4bf54c28c26"); err != nil {
+				t.Errorf("Failed to get UUID point: %v", err)
+			}
+		})
+	}
+}
+
+func TestImportQdrantNamedVectors(t *testing.T) {
+	path := writeFile(t, "points.json", `[{"id": 7, "vector": {"text": [1, 2], "image": [3, 4, 5]}}]`)
+
+	if _, err := ImportFrom(storage.NewMemoryStore(), path, SourceQdrant, nil); !errors.Is(err, ErrAmbiguousVector) {
+		t.Errorf("Expected ErrAmbiguousVector, got %v", err)
+	}
+
+	store := storage.NewMemoryStore()
+	if _, err := ImportFrom(store, path, SourceQdrant, &CompatOptions{VectorName: "image"}); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if v, _ := store.Get("7"); v == nil || v.Dimension != 3 {
+		t.Errorf("Expected the 3-dimensional image vector, got %v", v)
+	}
+}
+
+func TestImportPgvector(t *testing.T) {
+	// COPY items (id, embedding, metadata, body) TO STDOUT
+	content := "a\t[1,2,3]\t{\"tags\": [\"x\"], \"lang\": \"en\"}\tline one\\nline two\n" +
+		"b\t[4.5,5,6]\t\\N\t\\N\n" +
+		"\\.\n"
+	path := writeFile(t, "items.copy", content)
+
+	store := storage.NewMemoryStore()
+	opts := &CompatOptions{Columns: []string{"id", "embedding", "metadata", "body"}}
+	stats, err := ImportFrom(store, path, SourcePgvector, opts)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Inserted != 2 {
+		t.Errorf("Expected 2 vectors inserted, got %+v", stats)
+	}
+
+	a, _ := store.Get("a")
+	if a == nil || a.Metadata["lang"] != "en" || a.Metadata["tags"] != `["x"]` || a.Metadata["body"] != "line one\nline two" {
+		t.Errorf("Unexpected vector a: %v", a)
+	}
+	b, _ := store.Get("b")
+	if b == nil || b.Values[0] != 4.5 || len(b.Metadata) != 0 {
+		t.Errorf("Unexpected vector b: %v", b)
+	}
+
+	// Rows must match the column list
+	bad := writeFile(t, "bad.copy", "a\t[1,2]\n")
+	if _, err := ImportFrom(storage.NewMemoryStore(), bad, SourcePgvector, nil); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Expected ErrInvalidSchema, got %v", err)
+	}
+}
+
+func TestImportChroma(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String},
+		{Name: "embedding", Type: arrow.ListOf(arrow.PrimitiveTypes.Float64)},
+		{Name: "document", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "metadata", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.StringBuilder).AppendValues([]string{"doc1", "doc2"}, nil)
+	lists := builder.Field(1).(*array.ListBuilder)
+	values := lists.ValueBuilder().(*array.Float64Builder)
+	lists.Append(true)
+	values.AppendValues([]float64{0.1, 0.2}, nil)
+	lists.Append(true)
+	values.AppendValues([]float64{0.3, 0.4}, nil)
+	builder.Field(2).(*array.StringBuilder).AppendValues([]string{"hello world", ""}, []bool{true, false})
+	builder.Field(3).(*array.StringBuilder).AppendValues([]string{`{"source": "web", "page": 2}`, ""}, []bool{true, false})
+
+	rec := builder.NewRecord()
+	defer rec.Release()
+
+	path := filepath.Join(t.TempDir(), "chroma.parquet")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	w, err := pqarrow.NewFileWriter(schema, f, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("Failed to create writer: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Failed to write record: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close writer: %v", err)
+	}
+
+	store := storage.NewMemoryStore()
+	stats, err := ImportFrom(store, path, SourceChroma, nil)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Inserted != 2 {
+		t.Errorf("Expected 2 vectors inserted, got %+v", stats)
+	}
+
+	doc1, _ := store.Get("doc1")
+	want := map[string]string{MetadataKeyDocument: "hello world", "page": "2", "source": "web"}
+	if doc1 == nil || fmt.Sprint(doc1.Metadata) != fmt.Sprint(want) {
+		t.Errorf("Expected metadata %v, got %v", want, doc1)
+	}
+	doc2, _ := store.Get("doc2")
+	if doc2 == nil || len(doc2.Metadata) != 0 || doc2.Dimension != 2 {
+		t.Errorf("Unexpected doc2: %v", doc2)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	if source, err := ParseSource("Postgres"); err != nil || source != SourcePgvector {
+		t.Errorf("Expected pgvector, got %s (err = %v)", source, err)
+	}
+	if _, err := ParseSource("milvus"); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("Expected ErrUnknownSource, got %v", err)
+	}
+}
@@ -0,0 +1,615 @@
+package interchange
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+
+	"github.com/ken/vector_database/internal/concurrency"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// Format identifies a columnar interchange format
+type Format string
+
+const (
+	// FormatArrow is the Arrow IPC file format (also known as Feather v2)
+	FormatArrow Format = "arrow"
+
+	// FormatParquet is Apache Parquet
+	FormatParquet Format = "parquet"
+)
+
+const (
+	// ColumnID holds vector IDs (utf8)
+	ColumnID = "id"
+
+	// ColumnVector holds vector values (fixed_size_list<float32>, or a list in Parquet)
+	ColumnVector = "vector"
+
+	// ColumnMetadata holds metadata as a struct with one utf8 field per key
+	ColumnMetadata = "metadata"
+
+	// batchSize is the number of rows per exported record batch
+	batchSize = 1024
+
+	// decodeChunk is the fewest rows of an imported record batch decoded
+	// per goroutine
+	decodeChunk = 512
+)
+
+var (
+	// ErrUnknownFormat is returned when a format cannot be determined
+	ErrUnknownFormat = errors.New("unknown interchange format")
+
+	// ErrMixedDimensions is returned when exported vectors differ in dimension
+	ErrMixedDimensions = errors.New("vectors have different dimensions")
+
+	// ErrInvalidSchema is returned when an imported file lacks the expected columns
+	ErrInvalidSchema = errors.New("invalid interchange schema")
+
+	// ErrUnknownConflictPolicy is returned for an unsupported duplicate-ID policy
+	ErrUnknownConflictPolicy = errors.New("unknown conflict policy")
+)
+
+// ConflictPolicy decides what an import does with a vector whose ID is
+// already in the store, whether from an earlier import or earlier in the
+// same file
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the stored vector (the default)
+	ConflictOverwrite ConflictPolicy = "overwrite"
+
+	// ConflictSkip keeps the stored vector and drops the imported one
+	ConflictSkip ConflictPolicy = "skip"
+
+	// ConflictFail stops the import with storage.ErrVectorAlreadyExists
+	ConflictFail ConflictPolicy = "fail"
+
+	// ConflictRename stores the imported vector under the ID with the first
+	// free suffix -1, -2, ...
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ParseConflictPolicy parses a policy name. An empty name is ConflictOverwrite.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(name)); policy {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkip, ConflictFail, ConflictRename:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownConflictPolicy, name)
+	}
+}
+
+// DetectFormat derives the format from a file extension
+func DetectFormat(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".arrow", ".ipc", ".feather":
+		return FormatArrow, nil
+	case ".parquet", ".pq":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, path)
+	}
+}
+
+// ParseFormat parses a format name, detecting it from the path when empty
+func ParseFormat(name, path string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return DetectFormat(path)
+	case "arrow", "ipc", "feather":
+		return FormatArrow, nil
+	case "parquet":
+		return FormatParquet, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFormat, name)
+	}
+}
+
+// recordWriter writes record batches to a file
+type recordWriter interface {
+	Write(rec arrow.Record) error
+	Close() error
+}
+
+// recordReader reads record batches from a file. Next returns io.EOF after
+// the last batch; records are only valid until the next call.
+type recordReader interface {
+	Next() (arrow.Record, error)
+	Close() error
+}
+
+// createWriter creates a writer for the given format
+func createWriter(path string, format Format, schema *arrow.Schema) (recordWriter, error) {
+	switch format {
+	case FormatArrow:
+		return newArrowWriter(path, schema)
+	case FormatParquet:
+		return newParquetWriter(path, schema)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// openReader opens a reader for the given format
+func openReader(path string, format Format) (recordReader, error) {
+	switch format {
+	case FormatArrow:
+		return openArrowReader(path)
+	case FormatParquet:
+		return openParquetReader(path)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+// NewSchema returns the interchange schema for vectors of the given
+// dimension. The metadata column is omitted when there are no keys.
+func NewSchema(dimension int, metadataKeys []string) *arrow.Schema {
+	fields := []arrow.Field{
+		{Name: ColumnID, Type: arrow.BinaryTypes.String},
+		{Name: ColumnVector, Type: arrow.FixedSizeListOfNonNullable(int32(dimension), arrow.PrimitiveTypes.Float32)},
+	}
+
+	if len(metadataKeys) > 0 {
+		keyFields := make([]arrow.Field, len(metadataKeys))
+		for i, key := range metadataKeys {
+			keyFields[i] = arrow.Field{Name: key, Type: arrow.BinaryTypes.String, Nullable: true}
+		}
+		fields = append(fields, arrow.Field{Name: ColumnMetadata, Type: arrow.StructOf(keyFields...), Nullable: true})
+	}
+
+	return arrow.NewSchema(fields, nil)
+}
+
+// NewRecord builds a record batch with the given schema from vectors. The
+// caller must release the record.
+func NewRecord(schema *arrow.Schema, vectors []*vector.Vector) (arrow.Record, error) {
+	mem := memory.DefaultAllocator
+	listType := schema.Field(1).Type.(*arrow.FixedSizeListType)
+	dimension := int(listType.Len())
+
+	ids := array.NewStringBuilder(mem)
+	defer ids.Release()
+	values := array.NewFloat32Builder(mem)
+	defer values.Release()
+
+	var meta *array.StructBuilder
+	var metaType *arrow.StructType
+	if schema.NumFields() > 2 {
+		metaType = schema.Field(2).Type.(*arrow.StructType)
+		meta = array.NewStructBuilder(mem, metaType)
+		defer meta.Release()
+	}
+
+	for _, v := range vectors {
+		if v.Dimension != dimension {
+			return nil, fmt.Errorf("%w: %s has %d, expected %d", ErrMixedDimensions, v.ID, v.Dimension, dimension)
+		}
+
+		ids.Append(v.ID)
+		values.AppendValues(v.Values, nil)
+
+		if meta != nil {
+			meta.Append(true)
+			for i, field := range metaType.Fields() {
+				fb := meta.FieldBuilder(i).(*array.StringBuilder)
+				if value, ok := v.Metadata[field.Name]; ok {
+					fb.Append(value)
+				} else {
+					fb.AppendNull()
+				}
+			}
+		}
+	}
+
+	// The list builder always produces nullable items, so the vector column is
+	// assembled directly with the schema's non-nullable type
+	valueArr := values.NewArray()
+	defer valueArr.Release()
+	listData := array.NewData(listType, len(vectors), []*memory.Buffer{nil}, []arrow.ArrayData{valueArr.Data()}, 0, 0)
+	defer listData.Release()
+
+	columns := []arrow.Array{ids.NewArray(), array.NewFixedSizeListData(listData)}
+	if meta != nil {
+		columns = append(columns, meta.NewArray())
+	}
+	defer func() {
+		for _, column := range columns {
+			column.Release()
+		}
+	}()
+
+	return array.NewRecord(schema, columns, int64(len(vectors))), nil
+}
+
+// VectorsFromRecord converts a record batch to vectors. The vector column may
+// be a fixed-size, regular or large list of float32 or float64 values, as
+// written by pandas, polars or VectoDB itself.
+func VectorsFromRecord(rec arrow.Record) ([]*vector.Vector, error) {
+	vectors, err := recordVectors(rec, ColumnID, ColumnVector)
+	if err != nil {
+		return nil, err
+	}
+
+	metaIdx := rec.Schema().FieldIndices(ColumnMetadata)
+	if len(metaIdx) == 0 {
+		return vectors, nil
+	}
+	meta, ok := rec.Column(metaIdx[0]).(*array.Struct)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q must be a struct column", ErrInvalidSchema, ColumnMetadata)
+	}
+
+	fields := meta.DataType().(*arrow.StructType).Fields()
+	for i, v := range vectors {
+		if !meta.IsValid(i) {
+			continue
+		}
+		for f, field := range fields {
+			if column := meta.Field(f); column.IsValid(i) {
+				v.Metadata[field.Name] = column.ValueStr(i)
+			}
+		}
+	}
+
+	return vectors, nil
+}
+
+// recordVectors reads IDs and values from the named columns of a record
+// batch, leaving metadata empty
+func recordVectors(rec arrow.Record, idColumn, vectorColumn string) ([]*vector.Vector, error) {
+	schema := rec.Schema()
+
+	idIdx := schema.FieldIndices(idColumn)
+	vecIdx := schema.FieldIndices(vectorColumn)
+	if len(idIdx) == 0 || len(vecIdx) == 0 {
+		return nil, fmt.Errorf("%w: columns %q and %q are required", ErrInvalidSchema, idColumn, vectorColumn)
+	}
+
+	ids := rec.Column(idIdx[0])
+	switch ids.DataType().ID() {
+	case arrow.STRING, arrow.LARGE_STRING:
+	default:
+		return nil, fmt.Errorf("%w: %q must be a string column, got %s", ErrInvalidSchema, idColumn, ids.DataType())
+	}
+
+	lists, ok := rec.Column(vecIdx[0]).(array.ListLike)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q must be a list column, got %s", ErrInvalidSchema, vectorColumn, rec.Column(vecIdx[0]).DataType())
+	}
+	valueAt, err := floatAccessor(lists.ListValues())
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows are decoded in parallel; the arrays are only read
+	vectors := make([]*vector.Vector, rec.NumRows())
+	err = concurrency.ForEachChunk(len(vectors), decodeChunk, func(first, last int) error {
+		for i := first; i < last; i++ {
+			if ids.IsNull(i) || lists.IsNull(i) {
+				return fmt.Errorf("%w: row %d has a null id or vector", ErrInvalidSchema, i)
+			}
+
+			start, end := lists.ValueOffsets(i)
+			values := make([]float32, 0, end-start)
+			for j := start; j < end; j++ {
+				values = append(values, valueAt(int(j)))
+			}
+			vectors[i] = vector.NewVector(ids.ValueStr(i), values)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vectors, nil
+}
+
+// floatAccessor returns a function reading element i of a float array as float32
+func floatAccessor(values arrow.Array) (func(i int) float32, error) {
+	switch arr := values.(type) {
+	case *array.Float32:
+		return arr.Value, nil
+	case *array.Float64:
+		return func(i int) float32 { return float32(arr.Value(i)) }, nil
+	default:
+		return nil, fmt.Errorf("%w: vector values must be float32 or float64, got %s", ErrInvalidSchema, values.DataType())
+	}
+}
+
+// Export writes all vectors of a store to a file and returns the number of
+// vectors written. All vectors must have the same dimension.
+func Export(store storage.VectorStore, path string, format Format) (int, error) {
+	ids, err := store.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list vectors: %w", err)
+	}
+	sort.Strings(ids)
+	return exportIDs(store, ids, path, format)
+}
+
+// ExportChanges writes the vectors written after since to a file, in the
+// order they were written, and returns their number and the cursor to pass
+// as since next time. Deleted vectors are not reported.
+func ExportChanges(store storage.VectorStore, path string, format Format, since storage.ChangeCursor) (int, storage.ChangeCursor, error) {
+	changed, err := storage.Changes(store, since, 0)
+	if err != nil {
+		return 0, since, err
+	}
+	ids := make([]string, len(changed))
+	for i, v := range changed {
+		ids[i] = v.ID
+	}
+
+	written, err := exportIDs(store, ids, path, format)
+	if err != nil {
+		return written, since, err
+	}
+	return written, storage.CursorAfter(since, changed), nil
+}
+
+// exportIDs writes the vectors with the given IDs to a file in that order
+func exportIDs(store storage.VectorStore, ids []string, path string, format Format) (int, error) {
+	// First pass: the dimension and metadata keys determine the schema
+	dimension := -1
+	keySet := make(map[string]bool)
+	for _, id := range ids {
+		v, err := store.Get(id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		if dimension == -1 {
+			dimension = v.Dimension
+		} else if v.Dimension != dimension {
+			return 0, fmt.Errorf("%w: %s has %d, expected %d", ErrMixedDimensions, id, v.Dimension, dimension)
+		}
+		for key := range v.Metadata {
+			keySet[key] = true
+		}
+	}
+	if dimension == -1 {
+		// Arrow requires a positive list size, even for an empty file
+		dimension = 1
+	}
+
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	schema := NewSchema(dimension, keys)
+	w, err := createWriter(path, format, schema)
+	if err != nil {
+		return 0, err
+	}
+
+	// Second pass: write the vectors in record batches
+	written := 0
+	batch := make([]*vector.Vector, 0, batchSize)
+	flush := func() error {
+		rec, err := NewRecord(schema, batch)
+		if err != nil {
+			return err
+		}
+		defer rec.Release()
+
+		if err := w.Write(rec); err != nil {
+			return fmt.Errorf("failed to write record batch: %w", err)
+		}
+		written += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for _, id := range ids {
+		v, err := store.Get(id)
+		if err != nil {
+			w.Close()
+			return written, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		batch = append(batch, v)
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				w.Close()
+				return written, err
+			}
+		}
+	}
+	if len(batch) > 0 {
+		if err := flush(); err != nil {
+			w.Close()
+			return written, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return written, fmt.Errorf("failed to finish %s file: %w", format, err)
+	}
+	return written, nil
+}
+
+// ImportStats summarizes an import
+type ImportStats struct {
+	Inserted   int // New vectors, including renamed ones
+	Updated    int // Existing vectors that were overwritten
+	Skipped    int // Rows skipped because an earlier run imported them
+	Duplicates int // Rows dropped because their ID existed (ConflictSkip)
+	Renamed    int // Rows stored under a suffixed ID (ConflictRename)
+}
+
+// Rows returns the number of input rows processed, including skipped ones.
+// It is the position to resume an interrupted import from.
+func (s *ImportStats) Rows() int {
+	return s.Skipped + s.Inserted + s.Updated + s.Duplicates
+}
+
+// ImportOptions controls how an import runs
+type ImportOptions struct {
+	// Skip is the number of input rows imported by an earlier, interrupted
+	// run. They are read but not stored again.
+	Skip int
+
+	// DryRun counts the vectors that would be inserted or updated without
+	// writing to the store
+	DryRun bool
+
+	// OnConflict is what happens to vectors whose ID exists (default:
+	// ConflictOverwrite)
+	OnConflict ConflictPolicy
+
+	// Progress is called after every batch (optional)
+	Progress func(stats *ImportStats)
+}
+
+// Import reads vectors from a file into a store. Vectors whose IDs already
+// exist are handled by opts.OnConflict, by default overwritten. opts may be
+// nil.
+func Import(store storage.VectorStore, path string, format Format, opts *ImportOptions) (*ImportStats, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	r, err := openReader(path, format)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	stats := &ImportStats{}
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("failed to read record batch: %w", err)
+		}
+
+		vectors, err := VectorsFromRecord(rec)
+		if err != nil {
+			return stats, err
+		}
+		if err := storeVectors(store, vectors, stats, opts); err != nil {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// storeVectors inserts vectors, resolving duplicate IDs by opts.OnConflict,
+// and counts them in stats. Rows up to opts.Skip are only counted. When a
+// vector fails, progress is reported up to it, so a resumed import starts
+// with the failed row.
+func storeVectors(store storage.VectorStore, vectors []*vector.Vector, stats *ImportStats, opts *ImportOptions) error {
+	if skip := opts.Skip - stats.Skipped; skip > 0 {
+		if skip > len(vectors) {
+			skip = len(vectors)
+		}
+		stats.Skipped += skip
+		vectors = vectors[skip:]
+	}
+
+	for _, v := range vectors {
+		if err := storeVector(store, v, stats, opts); err != nil {
+			if opts.Progress != nil {
+				opts.Progress(stats)
+			}
+			return err
+		}
+	}
+
+	if opts.Progress != nil {
+		opts.Progress(stats)
+	}
+	return nil
+}
+
+// storeVector stores one imported vector and counts it in stats
+func storeVector(store storage.VectorStore, v *vector.Vector, stats *ImportStats, opts *ImportOptions) error {
+	var err error
+	if opts.DryRun {
+		err = dryInsert(store, v)
+	} else {
+		err = store.Insert(v)
+	}
+	if err == nil {
+		stats.Inserted++
+		return nil
+	}
+	if !errors.Is(err, storage.ErrVectorAlreadyExists) {
+		return fmt.Errorf("failed to insert vector %s: %w", v.ID, err)
+	}
+
+	switch opts.OnConflict {
+	case ConflictSkip:
+		stats.Duplicates++
+	case ConflictFail:
+		return fmt.Errorf("vector %s: %w", v.ID, storage.ErrVectorAlreadyExists)
+	case ConflictRename:
+		renamed, err := freeID(store, v.ID)
+		if err != nil {
+			return err
+		}
+		if !opts.DryRun {
+			copied := v.Copy()
+			copied.ID = renamed
+			if err := store.Insert(copied); err != nil {
+				return fmt.Errorf("failed to insert vector %s: %w", renamed, err)
+			}
+		}
+		stats.Inserted++
+		stats.Renamed++
+	default:
+		if !opts.DryRun {
+			if err := store.Update(v); err != nil {
+				return fmt.Errorf("failed to update vector %s: %w", v.ID, err)
+			}
+		}
+		stats.Updated++
+	}
+	return nil
+}
+
+// dryInsert returns the error Insert would return for v without changing
+// the store
+func dryInsert(store storage.VectorStore, v *vector.Vector) error {
+	_, err := store.Get(v.ID)
+	switch {
+	case err == nil:
+		return storage.ErrVectorAlreadyExists
+	case errors.Is(err, storage.ErrVectorNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// freeID returns id with the first suffix -1, -2, ... that is not in the store
+func freeID(store storage.VectorStore, id string) (string, error) {
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", id, n)
+		_, err := store.Get(candidate)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read vector %s: %w", candidate, err)
+		}
+	}
+}
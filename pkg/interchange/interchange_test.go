@@ -0,0 +1,242 @@
+package interchange
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// testStore returns a store with more vectors than fit in one record batch
+func testStore(t *testing.T) storage.VectorStore {
+	store := storage.NewMemoryStore()
+	for i := 0; i < batchSize+10; i++ {
+		v := vector.NewVector(fmt.Sprintf("vec%04d", i), []float32{float32(i), 0.5, -1.25})
+		if i%2 == 0 {
+			v.Metadata["category"] = "even"
+		}
+		if i == 3 {
+			v.Metadata["note"] = "a, b=c"
+		}
+		if err := store.Insert(v); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	return store
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"vectors.arrow", "vectors.parquet"} {
+		t.Run(name, func(t *testing.T) {
+			src := testStore(t)
+			path := filepath.Join(t.TempDir(), name)
+
+			format, err := DetectFormat(path)
+			if err != nil {
+				t.Fatalf("Failed to detect format: %v", err)
+			}
+
+			written, err := Export(src, path, format)
+			if err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			if written != batchSize+10 {
+				t.Errorf("Expected %d vectors written, got %d", batchSize+10, written)
+			}
+
+			dst := storage.NewMemoryStore()
+			dst.Insert(vector.NewVector("vec0001", []float32{9, 9, 9}))
+			stats, err := Import(dst, path, format, nil)
+			if err != nil {
+				t.Fatalf("Import failed: %v", err)
+			}
+			if stats.Inserted != batchSize+9 || stats.Updated != 1 {
+				t.Errorf("Unexpected import stats: %+v", stats)
+			}
+
+			for _, id := range []string{"vec0000", "vec0001", "vec0003", fmt.Sprintf("vec%04d", batchSize+9)} {
+				want, _ := src.Get(id)
+				got, err := dst.Get(id)
+				if err != nil {
+					t.Fatalf("Failed to get %s: %v", id, err)
+				}
+				if fmt.Sprint(got.Values) != fmt.Sprint(want.Values) || fmt.Sprint(got.Metadata) != fmt.Sprint(want.Metadata) {
+					t.Errorf("Vector %s: expected %v %v, got %v %v", id, want.Values, want.Metadata, got.Values, got.Metadata)
+				}
+			}
+		})
+	}
+}
+
+func TestImportResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.arrow")
+	if _, err := Export(testStore(t), path, FormatArrow); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// Continue an import that stopped after the first rows
+	skip := batchSize + 5
+	var positions []int
+	dst := storage.NewMemoryStore()
+	stats, err := Import(dst, path, FormatArrow, &ImportOptions{
+		Skip:     skip,
+		Progress: func(stats *ImportStats) { positions = append(positions, stats.Rows()) },
+	})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Skipped != skip || stats.Inserted != 5 || stats.Rows() != batchSize+10 {
+		t.Errorf("Unexpected import stats: %+v", stats)
+	}
+	if fmt.Sprint(positions) != fmt.Sprint([]int{batchSize, batchSize + 10}) {
+		t.Errorf("Unexpected progress positions: %v", positions)
+	}
+
+	if _, err := dst.Get("vec0000"); err == nil {
+		t.Error("Expected skipped rows not to be imported")
+	}
+	if _, err := dst.Get(fmt.Sprintf("vec%04d", skip)); err != nil {
+		t.Errorf("Expected the first row after the checkpoint to be imported: %v", err)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.parquet")
+	if _, err := Export(testStore(t), path, FormatParquet); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	dst := storage.NewMemoryStore()
+	dst.Insert(vector.NewVector("vec0001", []float32{9, 9, 9}))
+	stats, err := Import(dst, path, FormatParquet, &ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if stats.Inserted != batchSize+9 || stats.Updated != 1 {
+		t.Errorf("Unexpected import stats: %+v", stats)
+	}
+	if count, _ := dst.Count(); count != 1 {
+		t.Errorf("Dry run modified the store: %d vectors", count)
+	}
+}
+
+func TestImportConflictPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.arrow")
+	if _, err := Export(testStore(t), path, FormatArrow); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	existing := func() storage.VectorStore {
+		dst := storage.NewMemoryStore()
+		dst.Insert(vector.NewVector("vec0001", []float32{9, 9, 9}))
+		dst.Insert(vector.NewVector("vec0001-1", []float32{8, 8, 8}))
+		return dst
+	}
+	rows := batchSize + 10
+
+	tests := []struct {
+		policy ConflictPolicy
+		want   ImportStats
+		value  float32 // First value of vec0001 after the import
+	}{
+		{ConflictOverwrite, ImportStats{Inserted: rows - 1, Updated: 1}, 1},
+		{ConflictSkip, ImportStats{Inserted: rows - 1, Duplicates: 1}, 9},
+		{ConflictRename, ImportStats{Inserted: rows, Renamed: 1}, 9},
+	}
+	for _, tt := range tests {
+		dst := existing()
+		stats, err := Import(dst, path, FormatArrow, &ImportOptions{OnConflict: tt.policy})
+		if err != nil {
+			t.Fatalf("%s: Import failed: %v", tt.policy, err)
+		}
+		if *stats != tt.want || stats.Rows() != rows {
+			t.Errorf("%s: expected stats %+v, got %+v", tt.policy, tt.want, *stats)
+		}
+		if v, _ := dst.Get("vec0001"); v.Values[0] != tt.value {
+			t.Errorf("%s: expected vec0001 to start with %v, got %v", tt.policy, tt.value, v.Values)
+		}
+	}
+
+	// Renamed vectors take the first free suffix
+	dst := existing()
+	Import(dst, path, FormatArrow, &ImportOptions{OnConflict: ConflictRename})
+	if v, err := dst.Get("vec0001-2"); err != nil || v.Values[0] != 1 {
+		t.Errorf("Expected the imported vec0001 as vec0001-2, got %v, %v", v, err)
+	}
+
+	// Failing stops at the duplicate and reports progress up to it, so a
+	// resumed import starts with the failed row
+	position := -1
+	_, err := Import(existing(), path, FormatArrow, &ImportOptions{
+		OnConflict: ConflictFail,
+		Progress:   func(stats *ImportStats) { position = stats.Rows() },
+	})
+	if !errors.Is(err, storage.ErrVectorAlreadyExists) {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+	if position != 1 {
+		t.Errorf("Expected progress after 1 row, got %d", position)
+	}
+
+	if _, err := ParseConflictPolicy("merge"); !errors.Is(err, ErrUnknownConflictPolicy) {
+		t.Errorf("Expected ErrUnknownConflictPolicy, got %v", err)
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.Insert(vector.NewVector("a", []float32{1, 2}))
+	store.Insert(vector.NewVector("b", []float32{1, 2, 3}))
+
+	if _, err := Export(store, filepath.Join(t.TempDir(), "mixed.arrow"), FormatArrow); !errors.Is(err, ErrMixedDimensions) {
+		t.Errorf("Expected ErrMixedDimensions, got %v", err)
+	}
+	if _, err := DetectFormat("vectors.csv"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+	if format, err := ParseFormat("feather", "out.bin"); err != nil || format != FormatArrow {
+		t.Errorf("Expected arrow for feather, got %s (err = %v)", format, err)
+	}
+}
+
+func TestVectorsFromListColumn(t *testing.T) {
+	// pandas and polars write variable-length lists of float64
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: ColumnID, Type: arrow.BinaryTypes.LargeString},
+		{Name: ColumnVector, Type: arrow.ListOf(arrow.PrimitiveTypes.Float64)},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.LargeStringBuilder).AppendValues([]string{"a", "b"}, nil)
+	lists := builder.Field(1).(*array.ListBuilder)
+	values := lists.ValueBuilder().(*array.Float64Builder)
+	lists.Append(true)
+	values.AppendValues([]float64{1, 2}, nil)
+	lists.Append(true)
+	values.AppendValues([]float64{3, 4}, nil)
+
+	rec := builder.NewRecord()
+	defer rec.Release()
+
+	vectors, err := VectorsFromRecord(rec)
+	if err != nil {
+		t.Fatalf("Failed to convert record: %v", err)
+	}
+	if len(vectors) != 2 || vectors[1].ID != "b" || vectors[1].Values[1] != 4 {
+		t.Errorf("Unexpected vectors: %v", vectors)
+	}
+
+	// A missing vector column is rejected
+	idOnly := arrow.NewSchema([]arrow.Field{{Name: ColumnID, Type: arrow.BinaryTypes.String}}, nil)
+	empty := array.NewRecord(idOnly, []arrow.Array{array.NewStringBuilder(memory.DefaultAllocator).NewArray()}, 0)
+	if _, err := VectorsFromRecord(empty); !errors.Is(err, ErrInvalidSchema) {
+		t.Errorf("Expected ErrInvalidSchema, got %v", err)
+	}
+}
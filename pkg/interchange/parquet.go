@@ -0,0 +1,130 @@
+package interchange
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/apache/arrow/go/v16/arrow"
+	"github.com/apache/arrow/go/v16/arrow/array"
+	"github.com/apache/arrow/go/v16/arrow/memory"
+	"github.com/apache/arrow/go/v16/parquet"
+	"github.com/apache/arrow/go/v16/parquet/compress"
+	"github.com/apache/arrow/go/v16/parquet/file"
+	"github.com/apache/arrow/go/v16/parquet/pqarrow"
+)
+
+// parquetWriter writes Parquet files with Snappy compression. The vector
+// column is stored as a regular list, since pqarrow does not read back
+// fixed-size lists reliably and pandas and polars write lists anyway.
+type parquetWriter struct {
+	schema *arrow.Schema
+	writer *pqarrow.FileWriter
+}
+
+func newParquetWriter(path string, schema *arrow.Schema) (*parquetWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create parquet file: %w", err)
+	}
+
+	schema = listSchema(schema)
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	writer, err := pqarrow.NewFileWriter(schema, f, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+
+	return &parquetWriter{schema: schema, writer: writer}, nil
+}
+
+func (w *parquetWriter) Write(rec arrow.Record) error {
+	rec = listRecord(w.schema, rec)
+	defer rec.Release()
+	return w.writer.Write(rec)
+}
+
+// listSchema replaces the fixed-size vector type with a list type
+func listSchema(schema *arrow.Schema) *arrow.Schema {
+	fields := schema.Fields()
+	if listType, ok := fields[1].Type.(*arrow.FixedSizeListType); ok {
+		fields[1].Type = arrow.ListOfNonNullable(listType.Elem())
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// listRecord converts the fixed-size vector column of rec to the list type
+// of schema, sharing the value buffers. The caller must release the record.
+func listRecord(schema *arrow.Schema, rec arrow.Record) arrow.Record {
+	columns := make([]arrow.Array, rec.NumCols())
+	copy(columns, rec.Columns())
+
+	if fixed, ok := columns[1].(*array.FixedSizeList); ok {
+		n := fixed.Len()
+		size := int32(fixed.DataType().(*arrow.FixedSizeListType).Len())
+		offsets := make([]int32, n+1)
+		for i := range offsets {
+			offsets[i] = int32(fixed.Data().Offset()+i) * size
+		}
+
+		data := array.NewData(schema.Field(1).Type, n,
+			[]*memory.Buffer{nil, memory.NewBufferBytes(arrow.Int32Traits.CastToBytes(offsets))},
+			[]arrow.ArrayData{fixed.ListValues().Data()}, 0, 0)
+		defer data.Release()
+
+		list := array.NewListData(data)
+		defer list.Release()
+		columns[1] = list
+	}
+
+	return array.NewRecord(schema, columns, rec.NumRows())
+}
+
+// Close writes the footer and closes the underlying file
+func (w *parquetWriter) Close() error {
+	return w.writer.Close()
+}
+
+// parquetReader reads Parquet files batch by batch
+type parquetReader struct {
+	file    *file.Reader
+	records pqarrow.RecordReader
+}
+
+func openParquetReader(path string) (*parquetReader, error) {
+	f, err := file.OpenParquetFile(path, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parquet file: %w", err)
+	}
+
+	reader, err := pqarrow.NewFileReader(f, pqarrow.ArrowReadProperties{BatchSize: batchSize}, memory.DefaultAllocator)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read parquet file: %w", err)
+	}
+
+	records, err := reader.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read parquet file: %w", err)
+	}
+
+	return &parquetReader{file: f, records: records}, nil
+}
+
+func (r *parquetReader) Next() (arrow.Record, error) {
+	if r.records.Next() {
+		return r.records.Record(), nil
+	}
+	if err := r.records.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (r *parquetReader) Close() error {
+	r.records.Release()
+	return r.file.Close()
+}
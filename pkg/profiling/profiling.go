@@ -0,0 +1,164 @@
+// Package profiling records CPU and heap profiles of a running process, on
+// demand or continuously, for diagnosing performance in the field. Profiles
+// are in the pprof format and read with go tool pprof.
+package profiling
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StartCPU profiles the CPU into the file at path until the returned
+// function is called. Only one CPU profile can be recorded at a time.
+func StartCPU(path string) (func() error, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CPU profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to start CPU profile: %w", err)
+	}
+	return func() error {
+		pprof.StopCPUProfile()
+		return f.Close()
+	}, nil
+}
+
+// WriteHeap writes a profile of the live heap to the file at path
+func WriteHeap(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create heap profile: %w", err)
+	}
+	// Up-to-date statistics need a garbage collection
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write heap profile: %w", err)
+	}
+	return f.Close()
+}
+
+// Options configure continuous profiling
+type Options struct {
+	Dir      string        // Directory the profiles are written to
+	Interval time.Duration // How often profiles are taken (default: 5m)
+	Duration time.Duration // CPU time sampled per profile, at most Interval (default: 30s)
+	Keep     int           // Profiles of each kind kept; older ones are deleted (default: 10)
+}
+
+// Profiler takes a CPU and a heap profile every interval, so a slowdown
+// seen in production can be compared with the profiles from before it
+type Profiler struct {
+	opts   Options
+	logger *log.Logger
+	stop   chan struct{}
+	done   sync.WaitGroup
+}
+
+// Start starts taking profiles into opts.Dir in the background. Failures,
+// such as a CPU profile already being recorded through /debug/pprof, skip
+// the profile and are logged.
+func Start(opts Options, logger *log.Logger) (*Profiler, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Minute
+	}
+	if opts.Duration <= 0 {
+		opts.Duration = 30 * time.Second
+	}
+	if opts.Duration > opts.Interval {
+		opts.Duration = opts.Interval
+	}
+	if opts.Keep <= 0 {
+		opts.Keep = 10
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create profile directory: %w", err)
+	}
+
+	p := &Profiler{opts: opts, logger: logger, stop: make(chan struct{})}
+	p.done.Add(1)
+	go p.run()
+	return p, nil
+}
+
+// Stop stops taking profiles, finishing a CPU profile being recorded
+func (p *Profiler) Stop() {
+	close(p.stop)
+	p.done.Wait()
+}
+
+// run takes profiles until stopped
+func (p *Profiler) run() {
+	defer p.done.Done()
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.profile(); err != nil {
+			p.logger.Printf("Profiling: %v", err)
+		}
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// profile takes one CPU and one heap profile, named by the time they were
+// taken, and deletes the oldest
+func (p *Profiler) profile() error {
+	stamp := time.Now().UTC().Format("20060102T150405.000Z")
+	if err := WriteHeap(filepath.Join(p.opts.Dir, "heap-"+stamp+".pprof")); err != nil {
+		return err
+	}
+	if err := p.prune("heap-"); err != nil {
+		return err
+	}
+
+	stopCPU, err := StartCPU(filepath.Join(p.opts.Dir, "cpu-"+stamp+".pprof"))
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.stop:
+	case <-time.After(p.opts.Duration):
+	}
+	if err := stopCPU(); err != nil {
+		return err
+	}
+	return p.prune("cpu-")
+}
+
+// prune deletes all but the newest profiles whose names start with prefix
+func (p *Profiler) prune(prefix string) error {
+	entries, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), prefix) && strings.HasSuffix(entry.Name(), ".pprof") {
+			names = append(names, entry.Name())
+		}
+	}
+	// Time stamps sort in the order they were taken
+	sort.Strings(names)
+	for len(names) > p.opts.Keep {
+		if err := os.Remove(filepath.Join(p.opts.Dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package profiling
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartCPU(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu.out")
+	stop, err := StartCPU(path)
+	if err != nil {
+		t.Fatalf("Failed to start CPU profile: %v", err)
+	}
+	// Only one CPU profile is recorded at a time
+	if _, err := StartCPU(filepath.Join(t.TempDir(), "other.out")); err == nil {
+		t.Error("Expected a second CPU profile to fail")
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("Failed to stop CPU profile: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		t.Errorf("Expected a CPU profile: %v", err)
+	}
+
+	heap := filepath.Join(t.TempDir(), "heap.out")
+	if err := WriteHeap(heap); err != nil {
+		t.Fatalf("Failed to write heap profile: %v", err)
+	}
+	if info, err := os.Stat(heap); err != nil || info.Size() == 0 {
+		t.Errorf("Expected a heap profile: %v", err)
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "profiles")
+	p, err := Start(Options{Dir: dir, Interval: 20 * time.Millisecond, Duration: 10 * time.Millisecond, Keep: 2}, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("Failed to start profiler: %v", err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	p.Stop()
+
+	// Older profiles are deleted, keeping the newest of each kind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to list profiles: %v", err)
+	}
+	counts := map[string]int{}
+	for _, entry := range entries {
+		counts[strings.SplitN(entry.Name(), "-", 2)[0]]++
+	}
+	if counts["cpu"] != 2 || counts["heap"] != 2 {
+		t.Errorf("Expected 2 profiles of each kind, got %v", counts)
+	}
+}
@@ -0,0 +1,101 @@
+package progress
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ken/vector_database/pkg/fileutil"
+)
+
+// ErrSourceChanged is returned when a checkpoint belongs to a different
+// version of the job's input
+var ErrSourceChanged = errors.New("input changed since the checkpoint was written")
+
+// Checkpoint records how far a job got through its input
+type Checkpoint struct {
+	Job       string    `json:"job"`        // Name of the job, e.g. "import"
+	Source    string    `json:"source"`     // Input the position refers to
+	Size      int64     `json:"size"`       // Size of the input when the job started
+	ModTime   time.Time `json:"mod_time"`   // Modification time of the input when the job started
+	Position  int       `json:"position"`   // Rows of the input that are done
+	UpdatedAt time.Time `json:"updated_at"` // When the checkpoint was written
+}
+
+// NewCheckpoint creates a checkpoint at position 0 for a job reading the
+// file at source
+func NewCheckpoint(job, source string) (*Checkpoint, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", source, err)
+	}
+	return &Checkpoint{
+		Job:     job,
+		Source:  source,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UTC(),
+	}, nil
+}
+
+// Matches reports whether the checkpoint was written for the same job over
+// the same, unchanged input as other
+func (c *Checkpoint) Matches(other *Checkpoint) bool {
+	return c.Job == other.Job && c.Source == other.Source &&
+		c.Size == other.Size && c.ModTime.Equal(other.ModTime)
+}
+
+// LoadCheckpoint reads a checkpoint. It returns an error wrapping
+// os.ErrNotExist when there is none.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Checkpoint
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Resume loads the checkpoint at path for the job described by fresh. It
+// returns fresh when there is no checkpoint, and ErrSourceChanged when the
+// checkpoint belongs to a different input.
+func Resume(path string, fresh *Checkpoint) (*Checkpoint, error) {
+	saved, err := LoadCheckpoint(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !saved.Matches(fresh) {
+		return nil, ErrSourceChanged
+	}
+	return saved, nil
+}
+
+// Save writes the checkpoint atomically, so an interrupted write leaves the
+// previous checkpoint intact
+func (c *Checkpoint) Save(path string) error {
+	c.UpdatedAt = time.Now().UTC()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	if err := fileutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
+
+// RemoveCheckpoint deletes a checkpoint once its job has finished
+func RemoveCheckpoint(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package progress reports the progress of long-running jobs and stores
+// checkpoints so interrupted jobs can resume
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// barWidth is the number of characters of the bar itself
+	barWidth = 30
+
+	// refreshInterval limits how often the bar is redrawn
+	refreshInterval = 200 * time.Millisecond
+)
+
+// Bar draws a single-line progress bar with the rate and estimated time
+// remaining. A total of 0 means the total is unknown; only the count and
+// rate are shown then. Bar is safe for concurrent use.
+type Bar struct {
+	w      io.Writer
+	label  string
+	total  int
+	start  int // Work already done when the bar was created, e.g. when resuming
+	done   int
+	began  time.Time
+	drawn  time.Time
+	now    func() time.Time
+	closed bool
+	mu     sync.Mutex
+}
+
+// NewBar creates a progress bar writing to w
+func NewBar(w io.Writer, label string, total int) *Bar {
+	b := &Bar{w: w, label: label, total: total, now: time.Now}
+	b.began = b.now()
+	return b
+}
+
+// Resume starts the bar at work already done by an earlier run. The rate
+// and ETA only count work done by this run.
+func (b *Bar) Resume(done int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.start, b.done = done, done
+}
+
+// Add advances the bar by n
+func (b *Bar) Add(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done += n
+	b.redraw(false)
+}
+
+// Set moves the bar to done
+func (b *Bar) Set(done int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.done = done
+	b.redraw(false)
+}
+
+// SetTotal changes the total, e.g. once it becomes known
+func (b *Bar) SetTotal(total int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.total = total
+}
+
+// Finish draws the final state and ends the line
+func (b *Bar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.redraw(true)
+	fmt.Fprintln(b.w)
+	b.closed = true
+}
+
+// redraw writes the bar unless it was drawn recently
+func (b *Bar) redraw(force bool) {
+	if b.closed {
+		return
+	}
+	now := b.now()
+	if !force && now.Sub(b.drawn) < refreshInterval {
+		return
+	}
+	b.drawn = now
+	fmt.Fprintf(b.w, "\r%s\033[K", b.String())
+}
+
+// String formats the current state of the bar
+func (b *Bar) String() string {
+	elapsed := b.now().Sub(b.began)
+	rate := 0.0
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		rate = float64(b.done-b.start) / seconds
+	}
+
+	var s strings.Builder
+	if b.label != "" {
+		s.WriteString(b.label)
+		s.WriteString(" ")
+	}
+
+	if b.total <= 0 {
+		fmt.Fprintf(&s, "%d  %s/s  %s", b.done, formatRate(rate), FormatDuration(elapsed))
+		return s.String()
+	}
+
+	fraction := float64(b.done) / float64(b.total)
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * barWidth)
+	s.WriteString("[")
+	s.WriteString(strings.Repeat("=", filled))
+	if filled < barWidth {
+		s.WriteString(">")
+		s.WriteString(strings.Repeat(" ", barWidth-filled-1))
+	}
+	fmt.Fprintf(&s, "] %3.0f%% %d/%d  %s/s", fraction*100, b.done, b.total, formatRate(rate))
+
+	if remaining := b.total - b.done; remaining > 0 && rate > 0 {
+		eta := time.Duration(float64(remaining) / rate * float64(time.Second))
+		fmt.Fprintf(&s, "  ETA %s", FormatDuration(eta))
+	}
+	return s.String()
+}
+
+// formatRate formats a rate with at most one decimal
+func formatRate(rate float64) string {
+	if rate >= 100 {
+		return fmt.Sprintf("%.0f", rate)
+	}
+	return fmt.Sprintf("%.1f", rate)
+}
+
+// FormatDuration formats a duration as h:mm:ss or m:ss
+func FormatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds < 0 {
+		seconds = 0
+	}
+	h, m, s := seconds/3600, seconds/60%60, seconds%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -0,0 +1,118 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestBar creates a bar whose clock advances only when told to
+func newTestBar(total int) (*Bar, *bytes.Buffer, *time.Time) {
+	out := &bytes.Buffer{}
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := NewBar(out, "import", total)
+	b.now = func() time.Time { return clock }
+	b.began = clock
+	return b, out, &clock
+}
+
+func TestBar(t *testing.T) {
+	b, out, clock := newTestBar(100)
+
+	*clock = clock.Add(10 * time.Second)
+	b.Set(25)
+	want := "import [=======>                      ]  25% 25/100  2.5/s  ETA 0:30"
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected bar:\n got %q\nwant %q", got, want)
+	}
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Expected the bar to be drawn, got %q", out.String())
+	}
+
+	// Redraws are throttled
+	out.Reset()
+	b.Add(1)
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw within the refresh interval, got %q", out.String())
+	}
+
+	b.Set(100)
+	b.Finish()
+	if !strings.HasSuffix(out.String(), "100/100  10.0/s\033[K\n") {
+		t.Errorf("Unexpected final bar: %q", out.String())
+	}
+}
+
+func TestBarUnknownTotalAndResume(t *testing.T) {
+	b, _, clock := newTestBar(0)
+	b.Resume(1000)
+
+	*clock = clock.Add(2 * time.Second)
+	b.Set(1400)
+
+	// Only work done by this run counts towards the rate
+	if got, want := b.String(), "import 1400  200/s  0:02"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                                 "0:00",
+		65 * time.Second:                  "1:05",
+		2*time.Hour + 3*time.Minute + 4e9: "2:03:04",
+	} {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%s) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "points.jsonl")
+	if err := os.WriteFile(input, []byte("{}\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "checkpoints", "import.json")
+
+	fresh, err := NewCheckpoint("import", input)
+	if err != nil {
+		t.Fatalf("NewCheckpoint failed: %v", err)
+	}
+
+	// Without a saved checkpoint the job starts from the beginning
+	c, err := Resume(path, fresh)
+	if err != nil || c != fresh {
+		t.Fatalf("Expected the fresh checkpoint, got %+v, %v", c, err)
+	}
+
+	c.Position = 1
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	c, err = Resume(path, fresh)
+	if err != nil || c.Position != 1 {
+		t.Fatalf("Expected position 1, got %+v, %v", c, err)
+	}
+
+	// A changed input invalidates the checkpoint
+	if err := os.WriteFile(input, []byte("{}\n{}\n{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := NewCheckpoint("import", input)
+	if _, err := Resume(path, changed); !errors.Is(err, ErrSourceChanged) {
+		t.Errorf("Expected ErrSourceChanged, got %v", err)
+	}
+
+	if err := RemoveCheckpoint(path); err != nil {
+		t.Fatalf("RemoveCheckpoint failed: %v", err)
+	}
+	if _, err := LoadCheckpoint(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the checkpoint to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// systemPrompt instructs the LLM to stay grounded in the retrieved sources
+const systemPrompt = "You are a helpful assistant that answers questions from the provided sources."
+
+// ErrEmptyCompletion is returned when the LLM returns no choices
+var ErrEmptyCompletion = errors.New("llm returned no answer")
+
+// LLMOptions configures an OpenAI-compatible chat completions endpoint,
+// e.g. OpenAI, Ollama, vLLM or llama.cpp's server
+type LLMOptions struct {
+	Endpoint    string        // Full URL, e.g. http://localhost:11434/v1/chat/completions
+	Model       string        // Model name sent with each request
+	APIKey      string        // Sent as a bearer token when set
+	MaxTokens   int           // Maximum answer length; 0 = server default
+	Temperature float64       // Sampling temperature
+	Timeout     time.Duration // Request timeout; 0 = 60s
+}
+
+// LLMClient calls a chat completions endpoint
+type LLMClient struct {
+	opts   LLMOptions
+	client *http.Client
+}
+
+// NewLLMClient creates a client for the given endpoint
+func NewLLMClient(opts LLMOptions) (*LLMClient, error) {
+	if opts.Endpoint == "" {
+		return nil, errors.New("llm endpoint is required")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 60 * time.Second
+	}
+	return &LLMClient{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model,omitempty"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Complete sends a prompt and returns the answer
+func (c *LLMClient) Complete(ctx context.Context, prompt string) (string, error) {
+	body, err := json.Marshal(chatRequest{
+		Model: c.opts.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: systemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		MaxTokens:   c.opts.MaxTokens,
+		Temperature: c.opts.Temperature,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode llm request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create llm request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.opts.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.APIKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call llm: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read llm response: %w", err)
+	}
+
+	var parsed chatResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("llm returned status %d", resp.StatusCode)
+		}
+		return "", fmt.Errorf("failed to parse llm response: %w", err)
+	}
+	if parsed.Error != nil {
+		return "", fmt.Errorf("llm error: %s", parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("llm returned status %d", resp.StatusCode)
+	}
+	if len(parsed.Choices) == 0 {
+		return "", ErrEmptyCompletion
+	}
+
+	return parsed.Choices[0].Message.Content, nil
+}
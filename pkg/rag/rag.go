@@ -0,0 +1,169 @@
+// Package rag implements a retrieve-and-answer pipeline: a question is
+// embedded, the closest documents are retrieved from the store and the doc
+// store, and the passages are formatted into a context window for an LLM
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/storage"
+	"github.com/ken/vector_database/pkg/vectorstore"
+)
+
+// ErrNoPassages is returned when no document could be retrieved
+var ErrNoPassages = errors.New("no documents retrieved")
+
+// Passage is a retrieved document
+type Passage struct {
+	ID       string
+	Text     string
+	Distance float32
+}
+
+// Options configures retrieval and context formatting
+type Options struct {
+	K               int    // Number of documents to retrieve
+	MaxContextChars int    // Budget of the formatted context; 0 = unlimited
+	DocsDir         string // Directory of documents stored by the embed command
+}
+
+// DefaultOptions returns default RAG options
+func DefaultOptions() *Options {
+	return &Options{
+		K:               4,
+		MaxContextChars: 4000,
+		DocsDir:         "docs",
+	}
+}
+
+// Pipeline retrieves documents for questions and optionally answers them
+type Pipeline struct {
+	texts *vectorstore.VectorStore
+	llm   *LLMClient
+	opts  *Options
+}
+
+// NewPipeline creates a pipeline over a store. llm may be nil to only
+// retrieve and format the context.
+func NewPipeline(store storage.VectorStore, embedder vectorstore.Embedder, metric distance.Metric, llm *LLMClient, opts *Options) *Pipeline {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	return &Pipeline{
+		texts: vectorstore.New(store, embedder, metric, nil),
+		llm:   llm,
+		opts:  opts,
+	}
+}
+
+// Retrieve returns the documents closest to the question. Texts are read
+// from the doc store, falling back to the text metadata of documents added
+// through /texts; vectors without any text are skipped.
+func (p *Pipeline) Retrieve(question string) ([]Passage, error) {
+	results, err := p.texts.SimilaritySearchWithScore(question, p.opts.K, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	passages := make([]Passage, 0, len(results))
+	for _, result := range results {
+		text := result.PageContent
+		doc, err := embedding.LoadDocument(p.opts.DocsDir, result.ID)
+		switch {
+		case err == nil:
+			text = doc.Text()
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, err
+		}
+
+		if text == "" {
+			continue
+		}
+		passages = append(passages, Passage{ID: result.ID, Text: text, Distance: result.Score})
+	}
+
+	if len(passages) == 0 {
+		return nil, ErrNoPassages
+	}
+	return passages, nil
+}
+
+// BuildContext formats passages as numbered sources. Passages are truncated
+// once the character budget is used up.
+func BuildContext(passages []Passage, maxChars int) string {
+	var b strings.Builder
+	for i, passage := range passages {
+		header := fmt.Sprintf("[%d] %s\n", i+1, passage.ID)
+		text := strings.TrimSpace(passage.Text)
+
+		if maxChars > 0 {
+			remaining := maxChars - b.Len() - len(header)
+			if remaining <= 0 {
+				break
+			}
+			if len(text) > remaining {
+				text = truncate(text, remaining)
+			}
+		}
+
+		b.WriteString(header)
+		b.WriteString(text)
+		b.WriteString("\n\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// truncate shortens text to at most n bytes without splitting a character
+func truncate(text string, n int) string {
+	for n > 0 && n < len(text) && !isRuneStart(text[n]) {
+		n--
+	}
+	return text[:n] + "..."
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// Prompt returns the user prompt for a question and its sources
+func Prompt(question, sources string) string {
+	return fmt.Sprintf("Answer the question using only the sources below. Cite sources by their number, e.g. [1]. "+
+		"If the sources do not contain the answer, say so.\n\nSources:\n%s\n\nQuestion: %s", sources, question)
+}
+
+// Answer is the result of a question
+type Answer struct {
+	Passages []Passage
+	Context  string
+	Prompt   string
+	Text     string // Empty when no LLM is configured
+}
+
+// Ask retrieves documents for the question and, if an LLM is configured,
+// asks it to answer from them
+func (p *Pipeline) Ask(ctx context.Context, question string) (*Answer, error) {
+	passages, err := p.Retrieve(question)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := BuildContext(passages, p.opts.MaxContextChars)
+	answer := &Answer{
+		Passages: passages,
+		Context:  sources,
+		Prompt:   Prompt(question, sources),
+	}
+
+	if p.llm != nil {
+		if answer.Text, err = p.llm.Complete(ctx, answer.Prompt); err != nil {
+			return answer, err
+		}
+	}
+	return answer, nil
+}
@@ -0,0 +1,141 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// prefixEmbedder embeds a text as the counts of the letters x and y
+type prefixEmbedder struct{}
+
+func (prefixEmbedder) EmbedDocuments(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i], _ = prefixEmbedder{}.EmbedQuery(text)
+	}
+	return out, nil
+}
+
+func (prefixEmbedder) EmbedQuery(text string) ([]float32, error) {
+	return []float32{float32(strings.Count(text, "x")), float32(strings.Count(text, "y"))}, nil
+}
+
+// newTestPipeline stores two documents in the doc store and one with only
+// text metadata
+func newTestPipeline(t *testing.T, llm *LLMClient) *Pipeline {
+	docsDir := t.TempDir()
+	store := storage.NewMemoryStore()
+
+	for _, doc := range []*embedding.Document{
+		embedding.NewTextDocument("docx", "xxxx about x"),
+		embedding.NewJSONDocument("docy", map[string]interface{}{"title": "yyyy"}),
+	} {
+		data, _ := doc.ToJSON()
+		if err := os.WriteFile(filepath.Join(docsDir, doc.ID+".json"), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+		values, _ := prefixEmbedder{}.EmbedQuery(doc.Text())
+		store.Insert(vector.NewVector(doc.ID, values))
+	}
+
+	added := vector.NewVector("note", []float32{3, 1})
+	added.Metadata["text"] = "mostly x"
+	store.Insert(added)
+
+	// Vectors without any text are skipped
+	store.Insert(vector.NewVector("bare", []float32{5, 0}))
+
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	return NewPipeline(store, prefixEmbedder{}, metric, llm, &Options{K: 3, MaxContextChars: 1000, DocsDir: docsDir})
+}
+
+func TestRetrieve(t *testing.T) {
+	p := newTestPipeline(t, nil)
+
+	passages, err := p.Retrieve("xxxx")
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if len(passages) != 2 || passages[0].ID != "docx" || passages[1].ID != "note" {
+		t.Fatalf("Unexpected passages: %+v", passages)
+	}
+	if passages[0].Text != "xxxx about x" || passages[1].Text != "mostly x" {
+		t.Errorf("Unexpected passage texts: %+v", passages)
+	}
+
+	answer, err := p.Ask(context.Background(), "yyyy")
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if !strings.HasPrefix(answer.Context, "[1] docy\n{\"title\":\"yyyy\"}") || answer.Text != "" {
+		t.Errorf("Unexpected answer: %+v", answer)
+	}
+}
+
+func TestBuildContext(t *testing.T) {
+	passages := []Passage{{ID: "a", Text: strings.Repeat("a", 50)}, {ID: "b", Text: "never included"}}
+
+	got := BuildContext(passages, 20)
+	if got != "[1] a\n"+strings.Repeat("a", 14)+"..." {
+		t.Errorf("Unexpected context: %q", got)
+	}
+	if got := BuildContext(passages, 0); !strings.Contains(got, "[2] b\nnever included") {
+		t.Errorf("Expected all passages without a budget, got %q", got)
+	}
+}
+
+func TestAskWithLLM(t *testing.T) {
+	var received chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": {"message": "bad key"}}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "It is about x [1]."}}]}`))
+	}))
+	defer server.Close()
+
+	llm, err := NewLLMClient(LLMOptions{Endpoint: server.URL, Model: "test-model", APIKey: "secret"})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+
+	answer, err := newTestPipeline(t, llm).Ask(context.Background(), "what about xxxx?")
+	if err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if answer.Text != "It is about x [1]." {
+		t.Errorf("Unexpected answer: %q", answer.Text)
+	}
+	if received.Model != "test-model" || len(received.Messages) != 2 || !strings.Contains(received.Messages[1].Content, "[1] docx") {
+		t.Errorf("Unexpected request: %+v", received)
+	}
+
+	// Endpoint errors are reported
+	bad, _ := NewLLMClient(LLMOptions{Endpoint: server.URL})
+	if _, err := bad.Complete(context.Background(), "hi"); err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("Expected the endpoint error, got %v", err)
+	}
+}
+
+func TestRetrieveEmptyStore(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	p := NewPipeline(storage.NewMemoryStore(), prefixEmbedder{}, metric, nil, nil)
+	if _, err := p.Retrieve("x"); !errors.Is(err, ErrNoPassages) {
+		t.Errorf("Expected ErrNoPassages, got %v", err)
+	}
+}
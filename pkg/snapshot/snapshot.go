@@ -0,0 +1,482 @@
+// Package snapshot takes consistent point-in-time copies of a vector store
+// and its indexes. Every file of a snapshot carries the snapshot's epoch,
+// which is also recorded in a shared manifest together with the file
+// checksums, so a restore detects files from different snapshots.
+package snapshot
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// manifestFile lists the files of a snapshot
+	manifestFile = "manifest.json"
+
+	// manifestVersion is the current manifest format version
+	manifestVersion = 1
+
+	// vectorsMagic identifies a snapshot vectors file
+	vectorsMagic = "VSNP"
+
+	// vectorsVersion is the current vectors file encoding version
+	vectorsVersion = 1
+)
+
+// Kinds of snapshot files
+const (
+	KindVectors = "vectors"
+	KindIndex   = "index"
+)
+
+var (
+	// ErrSnapshotNotFound is returned when a snapshot directory has no manifest
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+
+	// ErrEpochMismatch is returned when a snapshot file belongs to another epoch
+	ErrEpochMismatch = errors.New("snapshot epoch mismatch")
+
+	// ErrChecksumMismatch is returned when a snapshot file was modified
+	ErrChecksumMismatch = errors.New("snapshot checksum mismatch")
+
+	// ErrCorruptSnapshot is returned when a snapshot file cannot be decoded
+	ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+	// ErrIndexNotInSnapshot is returned when restoring an index the snapshot lacks
+	ErrIndexNotInSnapshot = errors.New("index not in snapshot")
+)
+
+// File describes one file of a snapshot
+type File struct {
+	Name   string `json:"name"` // "vectors" or the index name
+	Kind   string `json:"kind"` // vectors or index
+	Path   string `json:"path"` // Relative to the snapshot directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a snapshot
+type Manifest struct {
+	Version   int       `json:"version"`
+	Epoch     uint64    `json:"epoch"`
+	CreatedAt time.Time `json:"created_at"`
+	Vectors   int       `json:"vectors"`
+	Files     []File    `json:"files"`
+
+	dir string
+}
+
+// Dir returns the directory holding the snapshot
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// Dir returns the directory of the snapshot with the given epoch under root
+func Dir(root string, epoch uint64) string {
+	return filepath.Join(root, fmt.Sprintf("%08d", epoch))
+}
+
+// Create snapshots the store and indexes into a new directory under root.
+// Writes to the store are held back while its vectors are read and the
+// indexes are saved, and buffered writes are flushed first, so the files
+// agree with each other. Pass indexes that are kept in sync with the store;
+// the map key names the index in the snapshot.
+func Create(root string, store storage.VectorStore, indexes map[string]index.Index) (*Manifest, error) {
+	names := make([]string, 0, len(indexes))
+	for name := range indexes {
+		if name == "" || name == KindVectors || strings.ContainsAny(name, `/\.`) {
+			return nil, fmt.Errorf("invalid index name: %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	epoch, err := nextEpoch(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the snapshot next to its final place and publish it by renaming
+	tmp := filepath.Join(root, fmt.Sprintf(".tmp-%08d", epoch))
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, fmt.Errorf("failed to clear %s: %w", tmp, err)
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest := &Manifest{
+		Version:   manifestVersion,
+		Epoch:     epoch,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	vectors, err := capture(store, indexes, names, tmp, epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	vectorsPath := fmt.Sprintf("%s-%08d.snap", KindVectors, epoch)
+	if err := writeVectors(filepath.Join(tmp, vectorsPath), epoch, vectors); err != nil {
+		return nil, err
+	}
+	manifest.Vectors = len(vectors)
+
+	files := []File{{Name: KindVectors, Kind: KindVectors, Path: vectorsPath}}
+	for _, name := range names {
+		files = append(files, File{Name: name, Kind: KindIndex, Path: indexPath(name, epoch)})
+	}
+	for _, f := range files {
+		f.Size, f.SHA256, err = checksum(filepath.Join(tmp, f.Path))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, f)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, manifestFile), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	manifest.dir = Dir(root, epoch)
+	if err := os.Rename(tmp, manifest.dir); err != nil {
+		return nil, fmt.Errorf("failed to publish snapshot: %w", err)
+	}
+	return manifest, nil
+}
+
+// capture reads every vector and saves the indexes while writes are held back
+func capture(store storage.VectorStore, indexes map[string]index.Index, names []string, dir string, epoch uint64) ([]*vector.Vector, error) {
+	resume := storage.QuiesceStore(store)
+	defer resume()
+
+	if err := storage.FlushStore(store); err != nil {
+		return nil, fmt.Errorf("failed to flush store: %w", err)
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+	sort.Strings(ids)
+
+	vectors := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		v, err := store.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		vectors = append(vectors, v)
+	}
+
+	for _, name := range names {
+		if err := indexes[name].Save(filepath.Join(dir, indexPath(name, epoch))); err != nil {
+			return nil, fmt.Errorf("failed to save index %s: %w", name, err)
+		}
+	}
+	return vectors, nil
+}
+
+// Open reads the manifest of the snapshot in dir without verifying its files
+func Open(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotNotFound, dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrCorruptSnapshot, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, fmt.Errorf("%w: unsupported manifest version %d", ErrCorruptSnapshot, manifest.Version)
+	}
+	manifest.dir = dir
+	return &manifest, nil
+}
+
+// List returns the snapshots under root, oldest first
+func List(root string) ([]*Manifest, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var manifests []*Manifest
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		manifest, err := Open(filepath.Join(root, entry.Name()))
+		if errors.Is(err, ErrSnapshotNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Epoch < manifests[j].Epoch })
+	return manifests, nil
+}
+
+// Verify checks that every file of the snapshot in dir is present, unchanged
+// and from the manifest's epoch
+func Verify(dir string) (*Manifest, error) {
+	manifest, err := Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	if name := filepath.Base(dir); name != filepath.Base(Dir("", manifest.Epoch)) {
+		return nil, fmt.Errorf("%w: directory %s holds epoch %d", ErrEpochMismatch, name, manifest.Epoch)
+	}
+
+	hasVectors := false
+	for _, f := range manifest.Files {
+		if fileEpoch(f.Path) != manifest.Epoch {
+			return nil, fmt.Errorf("%w: %s is not from epoch %d", ErrEpochMismatch, f.Path, manifest.Epoch)
+		}
+
+		size, sum, err := checksum(filepath.Join(dir, f.Path))
+		if err != nil {
+			return nil, err
+		}
+		if size != f.Size || sum != f.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, f.Path)
+		}
+
+		if f.Kind == KindVectors {
+			hasVectors = true
+			if _, err := readVectors(filepath.Join(dir, f.Path), manifest.Epoch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !hasVectors {
+		return nil, fmt.Errorf("%w: manifest lists no vectors file", ErrCorruptSnapshot)
+	}
+	return manifest, nil
+}
+
+// Restore verifies the snapshot in dir and makes the store and indexes match
+// it: vectors are inserted or overwritten and vectors missing from the
+// snapshot are deleted. Nothing should write to the store while it runs.
+func Restore(dir string, store storage.VectorStore, indexes map[string]index.Index) (*Manifest, error) {
+	manifest, err := Verify(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]File, len(manifest.Files))
+	for _, f := range manifest.Files {
+		files[f.Name] = f
+	}
+	for name := range indexes {
+		if f, ok := files[name]; !ok || f.Kind != KindIndex {
+			return nil, fmt.Errorf("%w: %s", ErrIndexNotInSnapshot, name)
+		}
+	}
+
+	vectors, err := readVectors(filepath.Join(dir, files[KindVectors].Path), manifest.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(vectors))
+	for _, v := range vectors {
+		keep[v.ID] = true
+		err := store.Insert(v)
+		if errors.Is(err, storage.ErrVectorAlreadyExists) {
+			err = store.Update(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore vector %s: %w", v.ID, err)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+	for _, id := range ids {
+		if keep[id] {
+			continue
+		}
+		if err := store.Delete(id); err != nil && !errors.Is(err, storage.ErrVectorNotFound) {
+			return nil, fmt.Errorf("failed to delete vector %s: %w", id, err)
+		}
+	}
+	if err := storage.FlushStore(store); err != nil {
+		return nil, fmt.Errorf("failed to flush store: %w", err)
+	}
+
+	for name, idx := range indexes {
+		if err := idx.Load(filepath.Join(dir, files[name].Path)); err != nil {
+			return nil, fmt.Errorf("failed to load index %s: %w", name, err)
+		}
+	}
+	return manifest, nil
+}
+
+// nextEpoch returns the epoch after the newest snapshot under root
+func nextEpoch(root string) (uint64, error) {
+	manifests, err := List(root)
+	if err != nil {
+		return 0, err
+	}
+	if len(manifests) == 0 {
+		return 1, nil
+	}
+	return manifests[len(manifests)-1].Epoch + 1, nil
+}
+
+// indexPath returns the file name of an index in the snapshot of an epoch
+func indexPath(name string, epoch uint64) string {
+	return fmt.Sprintf("%s-%08d.idx", name, epoch)
+}
+
+// fileEpoch parses the epoch from a snapshot file name, or returns 0
+func fileEpoch(path string) uint64 {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	i := strings.LastIndex(base, "-")
+	if i < 0 {
+		return 0
+	}
+	epoch, err := strconv.ParseUint(base[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return epoch
+}
+
+// checksum returns the size and SHA-256 of a file
+func checksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read snapshot file: %w", err)
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeVectors writes vectors to a file headed by the magic, the encoding
+// version, the epoch and the vector count, followed by one length-prefixed
+// encoded vector each
+func writeVectors(path string, epoch uint64, vectors []*vector.Vector) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create vectors file: %w", err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	header := make([]byte, 0, 20)
+	header = append(header, vectorsMagic...)
+	header = binary.LittleEndian.AppendUint32(header, vectorsVersion)
+	header = binary.LittleEndian.AppendUint64(header, epoch)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(vectors)))
+	w.Write(header)
+
+	var size [4]byte
+	for _, v := range vectors {
+		data := v.Encode()
+		binary.LittleEndian.PutUint32(size[:], uint32(len(data)))
+		w.Write(size[:])
+		w.Write(data)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write vectors file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync vectors file: %w", err)
+	}
+	return nil
+}
+
+// readVectors reads a vectors file and checks that it belongs to epoch
+func readVectors(path string, epoch uint64) ([]*vector.Vector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vectors file: %w", err)
+	}
+
+	if len(data) < 20 || string(data[:4]) != vectorsMagic {
+		return nil, fmt.Errorf("%w: %s is not a vectors file", ErrCorruptSnapshot, path)
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != vectorsVersion {
+		return nil, fmt.Errorf("%w: unsupported vectors file version %d", ErrCorruptSnapshot, version)
+	}
+	if fileEpoch := binary.LittleEndian.Uint64(data[8:]); fileEpoch != epoch {
+		return nil, fmt.Errorf("%w: vectors file is from epoch %d, manifest from %d", ErrEpochMismatch, fileEpoch, epoch)
+	}
+
+	count := int(binary.LittleEndian.Uint32(data[16:]))
+	vectors := make([]*vector.Vector, 0, count)
+	data = data[20:]
+	for i := 0; i < count; i++ {
+		if len(data) < 4 {
+			return nil, fmt.Errorf("%w: vectors file is truncated", ErrCorruptSnapshot)
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if len(data) < 4+size {
+			return nil, fmt.Errorf("%w: vectors file is truncated", ErrCorruptSnapshot)
+		}
+		v, err := vector.Decode(data[4 : 4+size])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		vectors = append(vectors, v)
+		data = data[4+size:]
+	}
+	return vectors, nil
+}
+
+// Load verifies the snapshot in dir and returns its vectors in a read-only
+// memory store. Nothing is written to dir, so any number of processes can
+// serve the same snapshot.
+func Load(dir string) (storage.VectorStore, *Manifest, error) {
+	store := storage.NewMemoryStore()
+	manifest, err := Restore(dir, store, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return storage.NewReadOnlyStore(store), manifest, nil
+}
@@ -0,0 +1,165 @@
+package snapshot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+func newStore(t *testing.T, ids ...string) (storage.VectorStore, *flat.FlatIndex) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+	idx := flat.NewFlatIndex(metric)
+	for i, id := range ids {
+		v := vector.NewVectorWithMetadata(id, []float32{float32(i), 1}, map[string]string{"n": id})
+		if err := store.Insert(v); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+		idx.Add(v)
+	}
+	return store, idx
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	root := t.TempDir()
+	store, idx := newStore(t, "a", "b", "c")
+
+	manifest, err := Create(root, store, map[string]index.Index{"flat": idx})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if manifest.Epoch != 1 || manifest.Vectors != 3 || len(manifest.Files) != 2 {
+		t.Fatalf("Unexpected manifest: %+v", manifest)
+	}
+
+	second, err := Create(root, store, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if second.Epoch != 2 {
+		t.Errorf("Expected epoch 2, got %d", second.Epoch)
+	}
+
+	manifests, err := List(root)
+	if err != nil || len(manifests) != 2 || manifests[0].Epoch != 1 {
+		t.Fatalf("List() = %v, %v", manifests, err)
+	}
+
+	// Change the store, then restore the first snapshot
+	store.Delete("a")
+	store.Insert(vector.NewVector("d", []float32{9, 9}))
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	restored := flat.NewFlatIndex(metric)
+
+	if _, err := Restore(manifest.Dir(), store, map[string]index.Index{"flat": restored}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	ids, _ := store.List()
+	if len(ids) != 3 {
+		t.Errorf("Expected 3 vectors after restore, got %v", ids)
+	}
+	if v, err := store.Get("a"); err != nil || v.Metadata["n"] != "a" {
+		t.Errorf("Expected vector a to be restored, got %v, %v", v, err)
+	}
+	if restored.Size() != 3 {
+		t.Errorf("Expected the restored index to hold 3 vectors, got %d", restored.Size())
+	}
+
+	// Restoring an index the snapshot lacks fails before touching the store
+	_, err = Restore(second.Dir(), store, map[string]index.Index{"flat": restored})
+	if !errors.Is(err, ErrIndexNotInSnapshot) {
+		t.Errorf("Expected ErrIndexNotInSnapshot, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	store, _ := newStore(t, "a", "b")
+	manifest, err := Create(root, store, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	loaded, _, err := Load(manifest.Dir())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if v, err := loaded.Get("b"); err != nil || v.Metadata["n"] != "b" {
+		t.Errorf("Expected b, got %v (%v)", v, err)
+	}
+	if err := loaded.Delete("a"); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if !storage.IsReadOnly(loaded) {
+		t.Error("Expected the loaded store to be read-only")
+	}
+}
+
+func TestVerifyDetectsMixedEpochs(t *testing.T) {
+	root := t.TempDir()
+	store, _ := newStore(t, "a", "b")
+
+	first, err := Create(root, store, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	store.Insert(vector.NewVector("c", []float32{3, 3}))
+	second, err := Create(root, store, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := Verify(first.Dir()); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// A vectors file copied over from another snapshot keeps its own epoch
+	data, _ := os.ReadFile(filepath.Join(second.Dir(), second.Files[0].Path))
+	os.WriteFile(filepath.Join(first.Dir(), first.Files[0].Path), data, 0644)
+	if _, err := Verify(first.Dir()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Expected ErrChecksumMismatch, got %v", err)
+	}
+
+	// A manifest copied into another snapshot's directory is caught by its epoch
+	manifest, _ := os.ReadFile(filepath.Join(second.Dir(), manifestFile))
+	os.WriteFile(filepath.Join(first.Dir(), manifestFile), manifest, 0644)
+	if _, err := Verify(first.Dir()); !errors.Is(err, ErrEpochMismatch) {
+		t.Errorf("Expected ErrEpochMismatch, got %v", err)
+	}
+}
+
+func TestCreateQuiescesWrites(t *testing.T) {
+	store, _ := newStore(t, "a")
+	gated := storage.NewGatedStore(store)
+	observable := storage.NewObservableStore(gated)
+
+	resume := storage.QuiesceStore(observable)
+	done := make(chan error)
+	go func() { done <- observable.Insert(vector.NewVector("b", []float32{1, 1})) }()
+
+	select {
+	case <-done:
+		t.Fatal("Insert completed while writes were held back")
+	case <-time.After(50 * time.Millisecond):
+	}
+	resume()
+	if err := <-done; err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	manifest, err := Create(t.TempDir(), observable, nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if manifest.Vectors != 2 {
+		t.Errorf("Expected 2 vectors, got %d", manifest.Vectors)
+	}
+}
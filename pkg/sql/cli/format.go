@@ -0,0 +1,243 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ken/vector_database/pkg/sql/executor"
+)
+
+// maxColumnWidth is the widest a table column gets unless full vectors are
+// printed
+const maxColumnWidth = 50
+
+// Output formats of FormatOptions
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// FormatOptions control how result sets are printed
+type FormatOptions struct {
+	Format      string // FormatTable or FormatJSON
+	Precision   int    // Digits after the decimal point; negative prints the fewest that read back as the same number
+	Scientific  bool   // Print floats as d.ddde±dd
+	FullVectors bool   // Print every value of vectors and long values in tables instead of shortening them
+}
+
+// DefaultFormatOptions returns the options FormatResult uses: tables with
+// floats as short as possible
+func DefaultFormatOptions() FormatOptions {
+	return FormatOptions{Format: FormatTable, Precision: -1}
+}
+
+// Validate checks the output format
+func (o FormatOptions) Validate() error {
+	switch o.Format {
+	case "", FormatTable, FormatJSON:
+	default:
+		return fmt.Errorf("unsupported output format: %s (use table or json)", o.Format)
+	}
+	return nil
+}
+
+// float formats a number with the precision and notation of the options
+func (o FormatOptions) float(f float64, bitSize int) string {
+	format := byte('f')
+	if o.Scientific {
+		format = 'e'
+	} else if o.Precision < 0 {
+		format = 'g'
+	}
+	return strconv.FormatFloat(f, format, o.Precision, bitSize)
+}
+
+// Value formats a result value. Vectors are printed in full.
+func (o FormatOptions) Value(v interface{}) string {
+	switch v := v.(type) {
+	case float32:
+		return o.float(float64(v), 32)
+	case float64:
+		return o.float(v, 64)
+	case []float32:
+		return o.vector(v, -1)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// vector formats a vector in at most width characters, or in full if width
+// is negative. Values that do not fit are left out and counted, so a
+// shortened vector never ends in a partial number.
+func (o FormatOptions) vector(values []float32, width int) string {
+	parts := make([]string, len(values))
+	for i, val := range values {
+		parts[i] = o.float(float64(val), 32)
+	}
+	full := "[" + strings.Join(parts, " ") + "]"
+	if width < 0 || len(full) <= width {
+		return full
+	}
+
+	// Keep the values that fit together with the count of the others
+	more := func(kept int) string { return fmt.Sprintf("… +%d]", len(parts)-kept) }
+	kept, length := 0, len("[")
+	for kept < len(parts) && length+len(parts[kept])+1+utf8.RuneCountInString(more(kept+1)) <= width {
+		length += len(parts[kept]) + 1
+		kept++
+	}
+	if kept == 0 {
+		return "[" + more(0)
+	}
+	return "[" + strings.Join(parts[:kept], " ") + " " + more(kept)
+}
+
+// cell formats a value for a table column of at most width characters
+func (o FormatOptions) cell(v interface{}, width int) string {
+	if o.FullVectors {
+		return o.Value(v)
+	}
+	if values, ok := v.([]float32); ok {
+		return o.vector(values, width)
+	}
+	s := o.Value(v)
+	if len(s) > width {
+		s = s[:width-3] + "..."
+	}
+	return s
+}
+
+// FormatResult formats a result set as a string table with the default
+// options
+func FormatResult(result *executor.ResultSet) string {
+	return formatTable(result, DefaultFormatOptions())
+}
+
+// Format formats a result set as a table or as JSON
+func Format(result *executor.ResultSet, opts FormatOptions) (string, error) {
+	if err := opts.Validate(); err != nil {
+		return "", err
+	}
+	if opts.Format == FormatJSON {
+		return formatJSON(result, opts)
+	}
+	return formatTable(result, opts), nil
+}
+
+// formatTable formats a result set as a string table
+func formatTable(result *executor.ResultSet, opts FormatOptions) string {
+	if result == nil || len(result.Columns) == 0 {
+		return "No results."
+	}
+
+	// Format the cells, limiting the width to avoid very long columns
+	colWidths := make([]int, len(result.Columns))
+	cells := make([][]string, len(result.Rows))
+	for i, col := range result.Columns {
+		colWidths[i] = len(col.Name)
+	}
+	for r, row := range result.Rows {
+		cells[r] = make([]string, len(result.Columns))
+		for i := range result.Columns {
+			if i >= len(row) {
+				// Empty value for missing columns
+				cells[r][i] = "NULL"
+			} else {
+				cells[r][i] = opts.cell(row[i], maxColumnWidth)
+			}
+			colWidths[i] = max(colWidths[i], len([]rune(cells[r][i])))
+		}
+	}
+
+	var sb strings.Builder
+	writeRow := func(values []string) {
+		for i, val := range values {
+			sb.WriteString(val + strings.Repeat(" ", colWidths[i]-len([]rune(val))))
+			if i < len(values)-1 {
+				sb.WriteString(" | ")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	// Write header
+	header := make([]string, len(result.Columns))
+	for i, col := range result.Columns {
+		header[i] = col.Name
+	}
+	writeRow(header)
+
+	// Write separator
+	for i, width := range colWidths {
+		sb.WriteString(strings.Repeat("-", width))
+		if i < len(colWidths)-1 {
+			sb.WriteString("-+-")
+		}
+	}
+	sb.WriteString("\n")
+
+	for _, row := range cells {
+		writeRow(row)
+	}
+
+	// Write row count
+	sb.WriteString(fmt.Sprintf("\n%d row(s) returned\n", len(result.Rows)))
+
+	return sb.String()
+}
+
+// formatJSON formats a result set as a JSON object with the column names and
+// the rows. Floats are JSON numbers with the precision of the options.
+func formatJSON(result *executor.ResultSet, opts FormatOptions) (string, error) {
+	out := struct {
+		Columns []string        `json:"columns"`
+		Rows    [][]interface{} `json:"rows"`
+	}{Columns: []string{}, Rows: [][]interface{}{}}
+	if result != nil {
+		for _, col := range result.Columns {
+			out.Columns = append(out.Columns, col.Name)
+		}
+		for _, row := range result.Rows {
+			values := make([]interface{}, len(row))
+			for i, val := range row {
+				values[i] = opts.jsonValue(val)
+			}
+			out.Rows = append(out.Rows, values)
+		}
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode result: %w", err)
+	}
+	return string(data), nil
+}
+
+// jsonValue converts floats to JSON numbers formatted with the options
+func (o FormatOptions) jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case float32:
+		return o.jsonFloat(float64(v), 32)
+	case float64:
+		return o.jsonFloat(v, 64)
+	case []float32:
+		values := make([]interface{}, len(v))
+		for i, val := range v {
+			values[i] = o.jsonFloat(float64(val), 32)
+		}
+		return values
+	}
+	return v
+}
+
+// jsonFloat returns f as a JSON number, or as a string for NaN and the
+// infinities, which JSON cannot represent
+func (o FormatOptions) jsonFloat(f float64, bitSize int) interface{} {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return o.float(f, bitSize)
+	}
+	return json.Number(o.float(f, bitSize))
+}
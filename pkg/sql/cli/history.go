@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/fileutil"
+)
+
+// MaxHistory is the number of statements a History keeps
+const MaxHistory = 1000
+
+// History records the statements executed in the SQL shell in a file, one
+// per line, so they outlive the session
+type History struct {
+	path    string
+	entries []string
+}
+
+// LoadHistory reads the history kept at path, which need not exist yet.
+// Files that grew past MaxHistory statements are trimmed to the latest ones.
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[len(h.entries)-MaxHistory:]
+		if err := fileutil.WriteFile(path, []byte(strings.Join(h.entries, "\n")+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to trim history: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// Add appends a statement to the history, joining its lines. Repeating the
+// latest statement does not add it again.
+func (h *History) Add(statement string) error {
+	statement = strings.TrimSpace(strings.ReplaceAll(statement, "\n", " "))
+	if statement == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == statement) {
+		return nil
+	}
+	h.entries = append(h.entries, statement)
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[1:]
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, statement); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the statements in the history, oldest first
+func (h *History) Entries() []string {
+	return append([]string(nil), h.entries...)
+}
+
+// Last returns the latest statement, or "" if the history is empty
+func (h *History) Last() string {
+	if len(h.entries) == 0 {
+		return ""
+	}
+	return h.entries[len(h.entries)-1]
+}
+
+// SavedQueries are statements stored under a name in a JSON file, so they
+// can be run again in later sessions
+type SavedQueries struct {
+	path    string
+	queries map[string]string
+}
+
+// LoadSavedQueries reads the saved queries kept at path, which need not
+// exist yet
+func LoadSavedQueries(path string) (*SavedQueries, error) {
+	q := &SavedQueries{path: path, queries: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved queries: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.queries); err != nil {
+		return nil, fmt.Errorf("failed to parse saved queries %s: %w", path, err)
+	}
+	return q, nil
+}
+
+// Get returns the query saved under name
+func (q *SavedQueries) Get(name string) (string, bool) {
+	query, ok := q.queries[name]
+	return query, ok
+}
+
+// Names returns the names of the saved queries in order
+func (q *SavedQueries) Names() []string {
+	names := make([]string, 0, len(q.queries))
+	for name := range q.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save stores a query under name, replacing any query saved under it
+func (q *SavedQueries) Save(name, query string) error {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid query name %q", name)
+	}
+	q.queries[name] = query
+	return q.write()
+}
+
+// Delete removes the query saved under name
+func (q *SavedQueries) Delete(name string) error {
+	if _, ok := q.queries[name]; !ok {
+		return fmt.Errorf("no query saved as %q", name)
+	}
+	delete(q.queries, name)
+	return q.write()
+}
+
+// write stores the queries, replacing the file atomically
+func (q *SavedQueries) write() error {
+	data, err := json.MarshalIndent(q.queries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode saved queries: %w", err)
+	}
+	if err := fileutil.WriteFile(q.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write saved queries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Params are the values of the :name placeholders of a query, as SQL
+// literals. They implement flag.Value, so -param name=value can be repeated.
+type Params map[string]string
+
+// String lists the parameters
+func (p Params) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + p[name]
+	}
+	return strings.Join(names, ",")
+}
+
+// Set parses name=value. Numbers and vectors such as [1.0, 2.0] are
+// substituted as they are and anything else as a string. name=@path reads
+// the value from a JSON file holding a number, a string, an array of
+// numbers or an object with one under "vector", "embedding" or "values".
+func (p Params) Set(spec string) error {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || !isParamName(name) {
+		return fmt.Errorf("parameter must be name=value with a name of letters, digits and _, got %q", spec)
+	}
+
+	var literal string
+	var err error
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		literal, err = fileLiteral(path)
+	} else {
+		literal, err = valueLiteral(value)
+	}
+	if err != nil {
+		return fmt.Errorf("parameter %s: %w", name, err)
+	}
+	p[name] = literal
+	return nil
+}
+
+// isParamName reports whether name can follow the colon of a placeholder
+func isParamName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isParamByte(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isParamByte reports whether c can be part of a parameter name. Names
+// start with a letter or _.
+func isParamByte(c byte, first bool) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || !first && c >= '0' && c <= '9'
+}
+
+// valueLiteral returns the literal of a value given on the command line
+func valueLiteral(value string) (string, error) {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		var values []float64
+		if err := json.Unmarshal([]byte(value), &values); err != nil {
+			return "", fmt.Errorf("invalid vector %s: %w", value, err)
+		}
+		return vectorLiteral(values), nil
+	}
+	return stringLiteral(value), nil
+}
+
+// fileLiteral returns the literal of the value in a JSON file
+func fileLiteral(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", fmt.Errorf("invalid JSON in %s: %w", path, err)
+	}
+	if object, ok := value.(map[string]interface{}); ok {
+		for _, key := range []string{"vector", "embedding", "values"} {
+			if v, ok := object[key]; ok {
+				value = v
+				break
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		return stringLiteral(v), nil
+	case []interface{}:
+		values := make([]float64, len(v))
+		for i, x := range v {
+			f, ok := x.(float64)
+			if !ok {
+				return "", fmt.Errorf("%s: element %d of the vector is not a number", path, i)
+			}
+			values[i] = f
+		}
+		return vectorLiteral(values), nil
+	}
+	return "", fmt.Errorf("%s must hold a number, a string or a vector", path)
+}
+
+// vectorLiteral formats values as a vector literal such as [1, 2.5]
+func vectorLiteral(values []float64) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// stringLiteral quotes s as a SQL string, escaping its quotes
+func stringLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// Substitute replaces the :name placeholders of query with their values.
+// Placeholders inside strings, quoted identifiers and comments are left
+// alone. Placeholders without a value and values without a placeholder are
+// errors, so typos do not go unnoticed.
+func Substitute(query string, params Params) (string, error) {
+	var sb strings.Builder
+	used := make(map[string]bool, len(params))
+	for i := 0; i < len(query); {
+		if end := skipQuoted(query, i); end > i {
+			sb.WriteString(query[i:end])
+			i = end
+			continue
+		}
+		if query[i] != ':' {
+			sb.WriteByte(query[i])
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(query) && isParamByte(query[end], end == i+1) {
+			end++
+		}
+		name := query[i+1 : end]
+		if name == "" {
+			sb.WriteByte(':')
+			i++
+			continue
+		}
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("no value for :%s: pass -param %s=...", name, name)
+		}
+		used[name] = true
+		sb.WriteString(value)
+		i = end
+	}
+
+	for name := range params {
+		if !used[name] {
+			return "", fmt.Errorf("parameter %s is not used by the query", name)
+		}
+	}
+	return sb.String(), nil
+}
+
+// skipQuoted returns the end of the string, quoted identifier or comment
+// starting at i, or i if none does
+func skipQuoted(query string, i int) int {
+	switch {
+	case query[i] == '\'' || query[i] == '"':
+		quote := query[i]
+		for j := i + 1; j < len(query); j++ {
+			if query[j] == '\\' && j+1 < len(query) && query[j+1] == quote {
+				j++
+			} else if query[j] == quote {
+				return j + 1
+			}
+		}
+		return len(query)
+	case strings.HasPrefix(query[i:], "--"):
+		if end := strings.IndexByte(query[i:], '\n'); end >= 0 {
+			return i + end
+		}
+		return len(query)
+	case strings.HasPrefix(query[i:], "/*"):
+		if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+			return i + 2 + end + 2
+		}
+		return len(query)
+	}
+	return i
+}
+
+// SplitStatements splits a script into its statements, which end with a
+// semicolon outside strings and comments. Statements keep their semicolon;
+// those of only comments are dropped.
+func SplitStatements(script string) []string {
+	var statements []string
+	start := 0
+	code := false // The statement has more than whitespace and comments
+	for i := 0; i < len(script); {
+		if end := skipQuoted(script, i); end > i {
+			code = code || script[i] == '\'' || script[i] == '"'
+			i = end
+			continue
+		}
+		if script[i] == ';' {
+			if code {
+				statements = append(statements, strings.TrimSpace(script[start:i+1]))
+			}
+			start, code = i+1, false
+		} else if !strings.ContainsRune(" \t\r\n", rune(script[i])) {
+			code = true
+		}
+		i++
+	}
+	if code {
+		statements = append(statements, strings.TrimSpace(script[start:]))
+	}
+	return statements
+}
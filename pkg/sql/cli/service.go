@@ -2,10 +2,16 @@ package cli
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
+	"github.com/ken/vector_database/pkg/audit"
 	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/index/twostage"
 	"github.com/ken/vector_database/pkg/sql/executor"
 	"github.com/ken/vector_database/pkg/sql/parser"
 	"github.com/ken/vector_database/pkg/sql/planner"
@@ -18,42 +24,300 @@ type SQLService struct {
 	executor   *executor.QueryExecutor
 	planner    *planner.QueryPlanner
 	indexType  executor.IndexType
+	hnswConfig *hnsw.HNSWConfig
 	metric     distance.Metric
+	metrics    map[string]distance.Metric
+	models     *embedding.Registry
+	adapter    storage.VectorAdapter
+	truncation *matryoshka.Options
+	twoStage   *twostage.Options
+	tiering    *tiered.Options
+	dryRun     bool
+	audit      *audit.Log
+	actor      string
+	indexes    *executor.IndexCache
+	results    *executor.ResultCache
+	plans      *executor.PlanCache
+	memory     *executor.MemoryAccountant
+	settings   *executor.Settings // Changed with SET GLOBAL, possibly shared with other services
+	session    *executor.Settings // Changed with SET
+	docsDir    string
+	catalog    *executor.Catalog
 	verbose    bool
+	format     FormatOptions
 }
 
-// NewSQLService creates a new SQL service
+// NewSQLService creates a new SQL service. Indexes built for nearest-neighbor
+// searches are cached in memory until the next write. The service is a
+// session: SET changes its settings only.
 func NewSQLService(store storage.VectorStore, indexType executor.IndexType, metric distance.Metric) *SQLService {
+	indexes := executor.NewIndexCache("")
+	settings := executor.NewSettings()
+	session := executor.NewSettings()
+	qe := executor.NewQueryExecutor(store, indexType, metric)
+	qe.SetIndexCache(indexes)
+	qe.SetSettings(settings)
+	qe.SetSession(session)
+	catalog, _ := executor.OpenCatalog("")
+	qe.SetCatalog(catalog)
+
 	return &SQLService{
 		store:     store,
-		executor:  executor.NewQueryExecutor(store, indexType, metric),
+		executor:  qe,
 		planner:   planner.NewQueryPlanner(),
 		indexType: indexType,
 		metric:    metric,
+		indexes:   indexes,
+		settings:  settings,
+		session:   session,
+		catalog:   catalog,
 		verbose:   false,
+		format:    DefaultFormatOptions(),
+	}
+}
+
+// SetFormat sets how Execute prints results
+func (s *SQLService) SetFormat(opts FormatOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
 	}
+	s.format = opts
+	return nil
 }
 
-// SetVerbose sets the verbose flag
+// SetVerbose sets the verbose flag. SET verbose overrides it for the session.
 func (s *SQLService) SetVerbose(verbose bool) {
 	s.verbose = verbose
 }
 
+// isVerbose reports whether queries are executed verbosely
+func (s *SQLService) isVerbose() bool {
+	if value, ok := s.executor.Setting(executor.SettingVerbose); ok {
+		return value == "true"
+	}
+	return s.verbose
+}
+
+// Collection returns the collection chosen with USE, or "" if none was
+func (s *SQLService) Collection() string {
+	collection, _ := s.executor.Setting(executor.SettingCollection)
+	return collection
+}
+
+// Session returns the settings changed with SET in this session
+func (s *SQLService) Session() map[string]string {
+	return s.session.All()
+}
+
 // SetIndexType sets the index type
 func (s *SQLService) SetIndexType(indexType executor.IndexType) {
 	s.indexType = indexType
 	s.executor = executor.NewQueryExecutor(s.store, indexType, s.metric)
+	s.executor.SetHNSWConfig(s.hnswConfig)
+	for collection, metric := range s.metrics {
+		s.executor.SetCollectionMetric(collection, metric)
+	}
+	s.executor.SetModelRegistry(s.models)
+	s.executor.SetVectorAdapter(s.adapter)
+	s.executor.SetTruncation(s.truncation)
+	s.executor.SetTwoStage(s.twoStage)
+	s.executor.SetTiering(s.tiering)
+	s.executor.SetDryRun(s.dryRun)
+	s.executor.SetAuditLog(s.audit, s.actor)
+	s.executor.SetIndexCache(s.indexes)
+	s.executor.SetSettings(s.settings)
+	s.executor.SetSession(s.session)
+	s.executor.SetDocsDir(s.docsDir)
+	s.executor.SetCatalog(s.catalog)
+	s.executor.SetPlanCache(s.plans)
+	s.executor.SetMemoryAccountant(s.memory)
+	s.setResultCache()
 }
 
 // SetMetric sets the distance metric
 func (s *SQLService) SetMetric(metric distance.Metric) {
 	s.metric = metric
 	s.executor = executor.NewQueryExecutor(s.store, s.indexType, metric)
+	s.executor.SetHNSWConfig(s.hnswConfig)
+	for collection, metric := range s.metrics {
+		s.executor.SetCollectionMetric(collection, metric)
+	}
+	s.executor.SetModelRegistry(s.models)
+	s.executor.SetVectorAdapter(s.adapter)
+	s.executor.SetTruncation(s.truncation)
+	s.executor.SetTwoStage(s.twoStage)
+	s.executor.SetTiering(s.tiering)
+	s.executor.SetDryRun(s.dryRun)
+	s.executor.SetAuditLog(s.audit, s.actor)
+	s.executor.SetIndexCache(s.indexes)
+	s.executor.SetSettings(s.settings)
+	s.executor.SetSession(s.session)
+	s.executor.SetDocsDir(s.docsDir)
+	s.executor.SetCatalog(s.catalog)
+	s.executor.SetPlanCache(s.plans)
+	s.executor.SetMemoryAccountant(s.memory)
+	s.setResultCache()
+}
+
+// SetHNSWConfig sets the parameters of HNSW indexes. Nil uses the defaults.
+func (s *SQLService) SetHNSWConfig(cfg *hnsw.HNSWConfig) {
+	s.hnswConfig = cfg
+	s.executor.SetHNSWConfig(cfg)
+}
+
+// SetCollectionMetric records the metric a collection is searched with.
+// Queries naming another metric for it are rejected.
+func (s *SQLService) SetCollectionMetric(collection string, metric distance.Metric) {
+	if s.metrics == nil {
+		s.metrics = make(map[string]distance.Metric)
+	}
+	if metric == nil {
+		delete(s.metrics, collection)
+	} else {
+		s.metrics[collection] = metric
+	}
+	s.executor.SetCollectionMetric(collection, metric)
+}
+
+// SetModelRegistry sets the embedding model registry used by EMBEDDING()
+func (s *SQLService) SetModelRegistry(models *embedding.Registry) {
+	s.models = models
+	s.executor.SetModelRegistry(models)
+}
+
+// SetVectorAdapter sets the adapter for vectors of other dimensions
+func (s *SQLService) SetVectorAdapter(adapter storage.VectorAdapter) {
+	s.adapter = adapter
+	s.executor.SetVectorAdapter(adapter)
+}
+
+// SetTruncation enables search on a truncated prefix of the vector dimensions
+func (s *SQLService) SetTruncation(opts *matryoshka.Options) {
+	s.truncation = opts
+	s.executor.SetTruncation(opts)
+}
+
+// SetTwoStage enables quantized scanning with exact rescoring for flat indexes
+func (s *SQLService) SetTwoStage(opts *twostage.Options) {
+	s.twoStage = opts
+	s.executor.SetTwoStage(opts)
+}
+
+// SetTiering sets the options of tiered indexes
+func (s *SQLService) SetTiering(opts *tiered.Options) {
+	s.tiering = opts
+	s.executor.SetTiering(opts)
+}
+
+// SetDryRun makes INSERT, DELETE and DROP report what they would change
+// without modifying the store
+func (s *SQLService) SetDryRun(dryRun bool) {
+	s.dryRun = dryRun
+	s.executor.SetDryRun(dryRun)
+}
+
+// SetAuditLog records modifying statements in the audit log under actor
+func (s *SQLService) SetAuditLog(log *audit.Log, actor string) {
+	s.audit = log
+	s.actor = actor
+	s.executor.SetAuditLog(log, actor)
+}
+
+// SetDocsDir sets the directory of the documents stored by the embed
+// command, which JOIN docs reads
+func (s *SQLService) SetDocsDir(dir string) {
+	s.docsDir = dir
+	s.executor.SetDocsDir(dir)
+}
+
+// SetCatalog replaces the catalog of views, e.g. with one persisted in the
+// data directory
+func (s *SQLService) SetCatalog(catalog *executor.Catalog) {
+	s.catalog = catalog
+	s.executor.SetCatalog(catalog)
+}
+
+// SetIndexCache replaces the cache of built indexes, e.g. with one that
+// persists them in the data directory
+func (s *SQLService) SetIndexCache(cache *executor.IndexCache) {
+	s.indexes = cache
+	s.executor.SetIndexCache(cache)
+}
+
+// SetSettings shares the settings changed with SET GLOBAL with other
+// services
+func (s *SQLService) SetSettings(settings *executor.Settings) {
+	s.settings = settings
+	s.executor.SetSettings(settings)
+}
+
+// SetResultCache reuses the results of SELECT statements until the store
+// changes. The store must report an epoch (see storage.StoreEpoch) for
+// results to be cached.
+func (s *SQLService) SetResultCache(cache *executor.ResultCache) {
+	s.results = cache
+	s.executor.SetResultCache(cache)
+}
+
+// SetPlanCache reuses the parses of statements that differ from earlier
+// ones only in their literals
+func (s *SQLService) SetPlanCache(cache *executor.PlanCache) {
+	s.plans = cache
+	s.executor.SetPlanCache(cache)
+}
+
+// SetMemoryAccountant aborts queries that allocate more memory than the
+// budgets of accountant. Nil leaves queries unlimited.
+func (s *SQLService) SetMemoryAccountant(accountant *executor.MemoryAccountant) {
+	s.memory = accountant
+	s.executor.SetMemoryAccountant(accountant)
+}
+
+// setResultCache hands the result cache to a new executor. Its results may
+// have been computed with the old index type or metric, so they are dropped.
+func (s *SQLService) setResultCache() {
+	if s.results != nil {
+		s.results.Clear()
+		s.executor.SetResultCache(s.results)
+	}
+}
+
+// IndexCache returns the cache of built indexes. Invalidate it after
+// writing to the store without going through the service.
+func (s *SQLService) IndexCache() *executor.IndexCache {
+	return s.indexes
+}
+
+// RebuildIndex builds a new index for a collection while queries keep using
+// the current one, then swaps it in. Its index type and HNSW parameters
+// become the service's settings.
+func (s *SQLService) RebuildIndex(opts executor.RebuildOptions) (*executor.IndexInfo, error) {
+	info, err := s.executor.RebuildIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+	s.indexType = info.Type
+	if opts.HNSW != nil {
+		s.hnswConfig = opts.HNSW
+	}
+	return info, nil
+}
+
+// SearchIndex returns the index selected by opts for unfiltered
+// nearest-neighbor searches, building it if needed
+func (s *SQLService) SearchIndex(opts executor.RebuildOptions) (index.Index, error) {
+	return s.executor.SearchIndex(opts)
+}
+
+// IndexStats returns the graph statistics of a collection's HNSW index
+func (s *SQLService) IndexStats(collection string) (*hnsw.GraphStats, error) {
+	return s.executor.IndexStats(collection, nil)
 }
 
 // Execute executes a SQL query and returns the formatted result
 func (s *SQLService) Execute(query string) (string, error) {
-	if s.verbose {
+	verbose := s.isVerbose()
+	if verbose {
 		fmt.Println("Query:", query)
 	}
 
@@ -67,7 +331,7 @@ func (s *SQLService) Execute(query string) (string, error) {
 	}
 
 	// Create execution plan (for debugging)
-	if s.verbose {
+	if verbose {
 		plan, err := s.planner.CreatePlan(ast)
 		if err != nil {
 			fmt.Println("Error creating plan:", err)
@@ -78,105 +342,32 @@ func (s *SQLService) Execute(query string) (string, error) {
 	}
 
 	// Execute the query
-	result, err := s.executor.ExecuteQuery(query)
+	result, err := s.Query(query)
 	if err != nil {
-		return "", fmt.Errorf("execution error: %w", err)
+		return "", err
 	}
 
 	// Format the result
-	output := formatResult(result)
+	output, err := Format(result, s.format)
+	if err != nil {
+		return "", err
+	}
 
 	// Calculate execution time
 	executionTime := time.Since(startTime)
 	
-	if s.verbose {
+	if verbose {
 		output += fmt.Sprintf("\nExecution time: %v\n", executionTime)
 	}
 
 	return output, nil
 }
 
-// formatResult formats a result set as a string table
-func formatResult(result *executor.ResultSet) string {
-	if result == nil || len(result.Columns) == 0 {
-		return "No results."
-	}
-
-	// Calculate column widths
-	colWidths := make([]int, len(result.Columns))
-	for i, col := range result.Columns {
-		colWidths[i] = len(col.Name)
-		
-		// Check row values for wider content
-		for _, row := range result.Rows {
-			if i < len(row) {
-				valStr := fmt.Sprintf("%v", row[i])
-				if len(valStr) > colWidths[i] {
-					// Limit the width to avoid very long columns
-					colWidths[i] = min(len(valStr), 50)
-				}
-			}
-		}
-	}
-
-	var sb strings.Builder
-	
-	// Write header
-	for i, col := range result.Columns {
-		format := fmt.Sprintf("%%-%ds", colWidths[i])
-		sb.WriteString(fmt.Sprintf(format, col.Name))
-		if i < len(result.Columns)-1 {
-			sb.WriteString(" | ")
-		}
-	}
-	sb.WriteString("\n")
-	
-	// Write separator
-	for i, width := range colWidths {
-		sb.WriteString(strings.Repeat("-", width))
-		if i < len(colWidths)-1 {
-			sb.WriteString("-+-")
-		}
-	}
-	sb.WriteString("\n")
-	
-	// Write rows
-	for _, row := range result.Rows {
-		for i := 0; i < len(result.Columns); i++ {
-			if i < len(row) {
-				val := row[i]
-				valStr := fmt.Sprintf("%v", val)
-				
-				// Truncate long values
-				if len(valStr) > colWidths[i] {
-					valStr = valStr[:colWidths[i]-3] + "..."
-				}
-				
-				format := fmt.Sprintf("%%-%ds", colWidths[i])
-				sb.WriteString(fmt.Sprintf(format, valStr))
-			} else {
-				// Empty value for missing columns
-				format := fmt.Sprintf("%%-%ds", colWidths[i])
-				sb.WriteString(fmt.Sprintf(format, "NULL"))
-			}
-			
-			if i < len(result.Columns)-1 {
-				sb.WriteString(" | ")
-			}
-		}
-		sb.WriteString("\n")
+// Query executes a SQL query and returns the raw result set
+func (s *SQLService) Query(query string) (*executor.ResultSet, error) {
+	result, err := s.executor.ExecuteQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("execution error: %w", err)
 	}
-	
-	// Write row count
-	sb.WriteString(fmt.Sprintf("\n%d row(s) returned\n", len(result.Rows)))
-	
-	return sb.String()
+	return result, nil
 }
-
-// min returns the minimum of two integers
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
-} 
\ No newline at end of file
@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"strings"
+
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// ColumnHits is the column holding how many searches returned a vector
+	ColumnHits = "hits"
+
+	// ColumnLastReturnedAt is the column holding when a search last
+	// returned a vector
+	ColumnLastReturnedAt = "last_returned_at"
+)
+
+// isAccessColumn reports whether column names an access stat
+func isAccessColumn(column string) bool {
+	switch strings.ToLower(column) {
+	case ColumnHits, ColumnLastReturnedAt:
+		return true
+	}
+	return false
+}
+
+// accessColumn returns the access stat of the vector with the given ID that
+// column names, and false if it names none. Stores that track no access
+// have no hits.
+func (qe *QueryExecutor) accessColumn(column, id string) (interface{}, bool) {
+	if !isAccessColumn(column) {
+		return nil, false
+	}
+	stats, _ := storage.VectorAccess(qe.store, id)
+	if strings.EqualFold(column, ColumnHits) {
+		return int(stats.Hits), true
+	}
+	return formatTimestamp(stats.LastReturned), true
+}
+
+// accessOrderKey returns the access stat column names as a number, for
+// ORDER BY. Vectors never returned sort first.
+func (qe *QueryExecutor) accessOrderKey(column, id string) float64 {
+	stats, _ := storage.VectorAccess(qe.store, id)
+	if strings.EqualFold(column, ColumnHits) {
+		return float64(stats.Hits)
+	}
+	if stats.LastReturned.IsZero() {
+		return 0
+	}
+	return float64(stats.LastReturned.UnixNano()) / 1e9
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// boost is a BOOST clause of a search: rows matching the condition have
+// amount subtracted from their distance, or their distance multiplied by it
+type boost struct {
+	condition *parser.Node
+	multiply  bool
+	amount    float32
+}
+
+// searchBoosts returns the BOOST clauses of a NEAREST TO clause, in the
+// order they are applied
+func searchBoosts(nearestNode *parser.Node) ([]boost, error) {
+	var boosts []boost
+	for _, child := range nearestNode.Children {
+		if child.Type != parser.NodeBoost {
+			continue
+		}
+		amount, err := strconv.ParseFloat(child.Children[1].Value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid BOOST amount %s", ErrInvalidArgument, child.Children[1].Value)
+		}
+		b := boost{condition: child.Children[0], multiply: child.Value == "*", amount: float32(amount)}
+		if b.multiply && amount < 0 {
+			return nil, fmt.Errorf("%w: BOOST factor %s is negative", ErrInvalidArgument, child.Children[1].Value)
+		}
+		boosts = append(boosts, b)
+	}
+	return boosts, nil
+}
+
+// applyBoosts adjusts the distance of each result by the boosts whose
+// condition its metadata matches, and sorts the results by the adjusted
+// distance. Results with equal distances keep their order.
+func (qe *QueryExecutor) applyBoosts(results index.SearchResults, boosts []boost, collectionName string) error {
+	if len(boosts) == 0 {
+		return nil
+	}
+	for i := range results {
+		vec, err := storage.GetMeta(qe.store, results[i].ID)
+		if err != nil {
+			return err
+		}
+		for _, b := range boosts {
+			match, err := qe.evaluateWhereCondition(b.condition, vec, collectionName)
+			if err != nil {
+				return fmt.Errorf("BOOST: %w", err)
+			}
+			if !match {
+				continue
+			}
+			if b.multiply {
+				results[i].Distance *= b.amount
+			} else {
+				results[i].Distance -= b.amount
+			}
+		}
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Distance < results[b].Distance
+	})
+	return nil
+}
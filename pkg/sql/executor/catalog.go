@@ -0,0 +1,397 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/fileutil"
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+var (
+	// ErrViewExists is returned when creating a view under a taken name
+	ErrViewExists = errs.New(errs.AlreadyExists, "view already exists")
+
+	// ErrViewNotFound is returned when dropping a view that does not exist
+	ErrViewNotFound = errs.New(errs.NotFound, "view not found")
+
+	// ErrMacroExists is returned when creating a macro under a taken name
+	ErrMacroExists = errs.New(errs.AlreadyExists, "macro already exists")
+
+	// ErrMacroNotFound is returned when dropping a macro that does not exist
+	ErrMacroNotFound = errs.New(errs.NotFound, "macro not found")
+
+	// ErrRuleExists is returned when creating a rule under a taken name
+	ErrRuleExists = errs.New(errs.AlreadyExists, "rule already exists")
+
+	// ErrRuleNotFound is returned when dropping a rule that does not exist
+	ErrRuleNotFound = errs.New(errs.NotFound, "rule not found")
+)
+
+// View is a SELECT stored under a name, which queries can read FROM
+type View struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// Macro is a condition stored under a name, which conditions can use in
+// its place
+type Macro struct {
+	Name      string `json:"name"`
+	Condition string `json:"condition"`
+}
+
+// Rule rewrites the SELECTs of a table, or of every table if Table is "*":
+// Where is added to their WHERE and Limit caps their LIMIT
+type Rule struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	Where string `json:"where,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// catalogFile is the content of the catalog's file
+type catalogFile struct {
+	Views  []View  `json:"views"`
+	Macros []Macro `json:"macros,omitempty"`
+	Rules  []Rule  `json:"rules,omitempty"`
+}
+
+// Catalog holds the views, macros and rewrite rules created with CREATE
+// VIEW, MACRO and RULE. They are kept in a JSON file, so they outlive the
+// session that created them.
+type Catalog struct {
+	mu     sync.RWMutex
+	path   string // Empty keeps the catalog in memory
+	views  map[string]string
+	macros map[string]string
+	rules  map[string]Rule
+}
+
+// OpenCatalog reads the catalog kept at path, which need not exist yet. An
+// empty path keeps the catalog in memory only.
+func OpenCatalog(path string) (*Catalog, error) {
+	c := &Catalog{path: path, views: make(map[string]string), macros: make(map[string]string), rules: make(map[string]Rule)}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read catalog: %w", err)
+	}
+	// Catalogs written before macros and rules are a list of views
+	var file catalogFile
+	if err := json.Unmarshal(data, &file.Views); err != nil {
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog %s: %w", path, err)
+		}
+	}
+	for _, v := range file.Views {
+		c.views[v.Name] = v.Query
+	}
+	for _, m := range file.Macros {
+		c.macros[m.Name] = m.Condition
+	}
+	for _, r := range file.Rules {
+		c.rules[r.Name] = r
+	}
+	return c, nil
+}
+
+// View returns the query of a view
+func (c *Catalog) View(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	query, ok := c.views[name]
+	return query, ok
+}
+
+// Views returns the views in order of name
+func (c *Catalog) Views() []View {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	views := make([]View, 0, len(c.views))
+	for name, query := range c.views {
+		views = append(views, View{Name: name, Query: query})
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Name < views[j].Name })
+	return views
+}
+
+// CreateView stores a query under name
+func (c *Catalog) CreateView(name, query string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.views[name]; ok {
+		return fmt.Errorf("%w: %s", ErrViewExists, name)
+	}
+	c.views[name] = query
+	if err := c.write(); err != nil {
+		delete(c.views, name)
+		return err
+	}
+	return nil
+}
+
+// DropView removes a view
+func (c *Catalog) DropView(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	query, ok := c.views[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrViewNotFound, name)
+	}
+	delete(c.views, name)
+	if err := c.write(); err != nil {
+		c.views[name] = query
+		return err
+	}
+	return nil
+}
+
+// Macro returns the condition of a macro
+func (c *Catalog) Macro(name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	condition, ok := c.macros[name]
+	return condition, ok
+}
+
+// Macros returns the macros in order of name
+func (c *Catalog) Macros() []Macro {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	macros := make([]Macro, 0, len(c.macros))
+	for name, condition := range c.macros {
+		macros = append(macros, Macro{Name: name, Condition: condition})
+	}
+	sort.Slice(macros, func(i, j int) bool { return macros[i].Name < macros[j].Name })
+	return macros
+}
+
+// CreateMacro stores a condition under name
+func (c *Catalog) CreateMacro(name, condition string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.macros[name]; ok {
+		return fmt.Errorf("%w: %s", ErrMacroExists, name)
+	}
+	c.macros[name] = condition
+	if err := c.write(); err != nil {
+		delete(c.macros, name)
+		return err
+	}
+	return nil
+}
+
+// DropMacro removes a macro
+func (c *Catalog) DropMacro(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	condition, ok := c.macros[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrMacroNotFound, name)
+	}
+	delete(c.macros, name)
+	if err := c.write(); err != nil {
+		c.macros[name] = condition
+		return err
+	}
+	return nil
+}
+
+// Rules returns the rules in order of name
+func (c *Catalog) Rules() []Rule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	rules := make([]Rule, 0, len(c.rules))
+	for _, rule := range c.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// CreateRule stores a rule
+func (c *Catalog) CreateRule(rule Rule) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.rules[rule.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrRuleExists, rule.Name)
+	}
+	c.rules[rule.Name] = rule
+	if err := c.write(); err != nil {
+		delete(c.rules, rule.Name)
+		return err
+	}
+	return nil
+}
+
+// DropRule removes a rule
+func (c *Catalog) DropRule(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rule, ok := c.rules[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	delete(c.rules, name)
+	if err := c.write(); err != nil {
+		c.rules[name] = rule
+		return err
+	}
+	return nil
+}
+
+// write stores the catalog, replacing the file atomically
+func (c *Catalog) write() error {
+	if c.path == "" {
+		return nil
+	}
+	file := catalogFile{Views: make([]View, 0, len(c.views))}
+	for name, query := range c.views {
+		file.Views = append(file.Views, View{Name: name, Query: query})
+	}
+	sort.Slice(file.Views, func(i, j int) bool { return file.Views[i].Name < file.Views[j].Name })
+	for name, condition := range c.macros {
+		file.Macros = append(file.Macros, Macro{Name: name, Condition: condition})
+	}
+	sort.Slice(file.Macros, func(i, j int) bool { return file.Macros[i].Name < file.Macros[j].Name })
+	for _, rule := range c.rules {
+		file.Rules = append(file.Rules, rule)
+	}
+	sort.Slice(file.Rules, func(i, j int) bool { return file.Rules[i].Name < file.Rules[j].Name })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+	if err := fileutil.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write catalog: %w", err)
+	}
+	return nil
+}
+
+// SetCatalog sets the catalog of views, macros and rules. Nil disables
+// them.
+func (qe *QueryExecutor) SetCatalog(catalog *Catalog) {
+	qe.catalog = catalog
+	qe.settingsChanged()
+}
+
+// executeCreateView executes CREATE VIEW. Views filter a collection, so
+// they may only have columns, FROM and WHERE.
+func (qe *QueryExecutor) executeCreateView(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: CREATE VIEW needs a catalog", ErrUnsupportedOperation)
+	}
+	hasFrom := false
+	for _, child := range node.Children[0].Children {
+		switch child.Type {
+		case parser.NodeFrom:
+			hasFrom = true
+		case parser.NodeWhere, parser.NodeIdentifier, parser.NodeAlias:
+		default:
+			return nil, fmt.Errorf("%w: views can only select columns FROM a collection WHERE a condition holds", ErrUnsupportedOperation)
+		}
+	}
+	if !hasFrom {
+		return nil, fmt.Errorf("%w: CREATE VIEW %s needs a FROM clause", ErrInvalidQuery, node.Value)
+	}
+	if _, ok := qe.catalog.View(fromTable(node.Children[0])); ok {
+		return nil, fmt.Errorf("%w: views cannot read FROM other views", ErrUnsupportedOperation)
+	}
+
+	if err := qe.catalog.CreateView(node.Value, node.Children[1].Value); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Created view '%s'", node.Value)), nil
+}
+
+// executeDropView executes DROP VIEW
+func (qe *QueryExecutor) executeDropView(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: %s", ErrViewNotFound, node.Value)
+	}
+	if err := qe.catalog.DropView(node.Value); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Dropped view '%s'", node.Value)), nil
+}
+
+// fromTable returns the table a SELECT reads FROM, or "" if it has no FROM
+func fromTable(node *parser.Node) string {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeFrom && len(child.Children) > 0 {
+			return child.Children[0].Value
+		}
+	}
+	return ""
+}
+
+// expandView rewrites a SELECT FROM a view into one FROM the view's
+// collection whose WHERE also holds the view's condition. SELECT * selects
+// the view's columns. SELECTs of collections are returned as they are.
+func (qe *QueryExecutor) expandView(node *parser.Node) (*parser.Node, error) {
+	if qe.catalog == nil {
+		return node, nil
+	}
+	name := fromTable(node)
+	query, ok := qe.catalog.View(name)
+	if !ok {
+		return node, nil
+	}
+	view, err := parser.Parse(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid view %s: %w", name, err)
+	}
+
+	var viewColumns []*parser.Node
+	var viewFrom, viewWhere *parser.Node
+	for _, child := range view.Children {
+		switch child.Type {
+		case parser.NodeFrom:
+			viewFrom = child
+		case parser.NodeWhere:
+			viewWhere = child
+		case parser.NodeIdentifier, parser.NodeAlias:
+			viewColumns = append(viewColumns, child)
+		}
+	}
+
+	star := false
+	expanded := &parser.Node{Type: node.Type, Value: node.Value}
+	for _, child := range node.Children {
+		switch {
+		case child.Type == parser.NodeIdentifier && child.Value == "*":
+			if star {
+				continue
+			}
+			star = true
+			expanded.Children = append(expanded.Children, viewColumns...)
+		case child.Type == parser.NodeFrom:
+			// The view's collection, under the alias of the view
+			table := &parser.Node{Type: parser.NodeTable, Value: viewFrom.Children[0].Value, Children: child.Children[0].Children}
+			expanded.Children = append(expanded.Children, &parser.Node{Type: parser.NodeFrom, Children: []*parser.Node{table}})
+		case child.Type == parser.NodeWhere && viewWhere != nil:
+			condition := &parser.Node{Type: parser.NodeBinaryOp, Value: "AND", Children: []*parser.Node{viewWhere.Children[0], child.Children[0]}}
+			expanded.Children = append(expanded.Children, &parser.Node{Type: parser.NodeWhere, Children: []*parser.Node{condition}})
+			viewWhere = nil
+		default:
+			expanded.Children = append(expanded.Children, child)
+		}
+	}
+	if viewWhere != nil {
+		expanded.Children = append(expanded.Children, viewWhere)
+	}
+	return expanded, nil
+}
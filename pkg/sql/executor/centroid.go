@@ -0,0 +1,106 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// FunctionCentroid is the mean of a group of vectors: CENTROID() of every
+// vector, or CENTROID(metadata.key = 'value') of the vectors with a metadata
+// value. Stores that maintain centroids keep them current as vectors are
+// written, so only the first query of a group reads its vectors.
+const FunctionCentroid = "CENTROID"
+
+// isCentroid reports whether node is a CENTROID() call
+func isCentroid(node *parser.Node) bool {
+	return node.Type == parser.NodeFunction && strings.ToUpper(node.Value) == FunctionCentroid
+}
+
+// selectsCentroids reports whether a SELECT projects a CENTROID() call
+func selectsCentroids(node *parser.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeAlias && len(child.Children) > 0 {
+			child = child.Children[0]
+		}
+		if isCentroid(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// centroidGroup returns the group of vectors a CENTROID() call averages
+func centroidGroup(node *parser.Node) (storage.CentroidGroup, error) {
+	switch len(node.Children) {
+	case 0:
+		return storage.CentroidGroup{}, nil
+	case 1:
+		cond := node.Children[0]
+		if cond.Type == parser.NodeBinaryOp && cond.Value == "=" && len(cond.Children) == 2 {
+			field, value := cond.Children[0], cond.Children[1]
+			if field.Type != parser.NodeIdentifier {
+				field, value = value, field
+			}
+			key, ok := strings.CutPrefix(field.Value, "metadata.")
+			if field.Type == parser.NodeIdentifier && ok && key != "" && value.Type == parser.NodeLiteral {
+				return storage.CentroidGroup{Key: key, Value: strings.Trim(value.Value, "'\"")}, nil
+			}
+		}
+	}
+	return storage.CentroidGroup{}, fmt.Errorf("%w: CENTROID() takes no argument or a condition metadata.key = 'value'", ErrInvalidArgument)
+}
+
+// streamCentroids executes a SELECT of CENTROID() calls, writing one row
+// with the centroid of each group, or NULL for an empty group. The group
+// is given by the call, so the SELECT cannot have other columns or clauses
+// other than FROM.
+func (qe *QueryExecutor) streamCentroids(node *parser.Node, stream *Stream) error {
+	var columns []Column
+	var row Row
+	for _, child := range node.Children {
+		name := ""
+		switch child.Type {
+		case parser.NodeFrom, parser.NodeHint:
+			continue
+		case parser.NodeAlias:
+			name = child.Value
+			if len(child.Children) > 0 {
+				child = child.Children[0]
+			}
+		case parser.NodeWhere, parser.NodeNearestTo, parser.NodeOrderBy, parser.NodeGroupBy, parser.NodeLimit:
+			return fmt.Errorf("%w: CENTROID() takes its group as an argument and cannot be combined with WHERE, NEAREST TO, ORDER BY, GROUP BY or LIMIT", ErrInvalidQuery)
+		}
+		if !isCentroid(child) {
+			return fmt.Errorf("%w: CENTROID() cannot be selected with other columns", ErrInvalidQuery)
+		}
+
+		group, err := centroidGroup(child)
+		if err != nil {
+			return err
+		}
+		centroid, err := storage.GroupCentroid(qe.store, group)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = FunctionCentroid + "()"
+			if group.Key != "" {
+				name = fmt.Sprintf("%s(metadata.%s = '%s')", FunctionCentroid, group.Key, group.Value)
+			}
+		}
+		columns = append(columns, Column{Name: name, Type: "vector"})
+		if centroid.Values == nil {
+			row = append(row, nil)
+		} else {
+			row = append(row, centroid.Values)
+		}
+	}
+
+	if err := stream.Columns(columns); err != nil {
+		return err
+	}
+	return stream.Row(row)
+}
@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// collapseCandidates is how many times more candidates than rows a search
+// with GROUP BY fetches at first. Twice as many are fetched again until the
+// groups fill the limit.
+const collapseCandidates = 4
+
+// groupColumn returns the metadata column of a GROUP BY clause, or "" for a
+// nil clause
+func groupColumn(groupNode *parser.Node) (string, error) {
+	if groupNode == nil {
+		return "", nil
+	}
+	column := groupNode.Children[0].Value
+	if !strings.HasPrefix(strings.ToLower(column), "metadata.") || len(column) == len("metadata.") {
+		return "", fmt.Errorf("%w: cannot GROUP BY %s; group by a metadata key such as metadata.%s", ErrInvalidQuery, column, embedding.MetadataKeyParent)
+	}
+	return column, nil
+}
+
+// collapse keeps the first result of each group of results sharing the
+// value of a metadata column, e.g. the nearest chunk of each document.
+// Results without a value form groups of their own.
+func (qe *QueryExecutor) collapse(results index.SearchResults, column string) (index.SearchResults, error) {
+	key := column[len("metadata."):]
+	seen := make(map[string]bool, len(results))
+	collapsed := make(index.SearchResults, 0, len(results))
+	for _, result := range results {
+		vec, err := storage.GetMeta(qe.store, result.ID)
+		if err != nil {
+			return nil, err
+		}
+		if group, ok := vec.Metadata[key]; ok && group != "" {
+			if seen[group] {
+				continue
+			}
+			seen[group] = true
+		}
+		collapsed = append(collapsed, result)
+	}
+	return collapsed, nil
+}
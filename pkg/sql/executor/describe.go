@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// describeColumns are the columns of DESCRIBE
+var describeColumns = []Column{
+	{Name: "column", Type: "string"},
+	{Name: "type", Type: "string"},
+	{Name: "required", Type: "bool"},
+}
+
+// builtinColumns are the columns every collection has, before its metadata
+var builtinColumns = []Row{
+	{"id", "string", true},
+	{"vector", "vector", true},
+	{"dimension", "int", true},
+	{ColumnCreatedAt, "time", false},
+	{ColumnUpdatedAt, "time", false},
+	{ColumnHits, "int", false},
+	{ColumnLastReturnedAt, "time", false},
+}
+
+// executeDescribe executes DESCRIBE, which lists the columns of a
+// collection followed by the metadata fields its schema declares
+func (qe *QueryExecutor) executeDescribe(node *parser.Node) (*ResultSet, error) {
+	collection := node.Value
+	if collection == "" {
+		var ok bool
+		if collection, ok = qe.setting(SettingCollection); !ok {
+			return nil, fmt.Errorf("%w: DESCRIBE needs a collection name or one chosen with USE", ErrInvalidQuery)
+		}
+	}
+
+	rows := append([]Row{}, builtinColumns...)
+	if schema := storage.CollectionSchema(qe.store, collection); schema != nil {
+		for _, f := range schema.Fields {
+			rows = append(rows, Row{"metadata." + f.Name, string(f.Type), f.Required})
+		}
+	}
+	return &ResultSet{Columns: describeColumns, Rows: rows}, nil
+}
@@ -1,36 +1,55 @@
 package executor
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/ken/vector_database/pkg/audit"
 	"github.com/ken/vector_database/pkg/core/distance"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/errs"
 	"github.com/ken/vector_database/pkg/index"
 	"github.com/ken/vector_database/pkg/index/flat"
 	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/matryoshka"
+	"github.com/ken/vector_database/pkg/index/quantized"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/index/twostage"
 	"github.com/ken/vector_database/pkg/sql/parser"
 	"github.com/ken/vector_database/pkg/storage"
 )
 
 var (
 	// ErrUnsupportedOperation is returned when an unsupported operation is requested
-	ErrUnsupportedOperation = errors.New("unsupported operation")
+	ErrUnsupportedOperation = errs.New(errs.Unimplemented, "unsupported operation")
 
 	// ErrInvalidQuery is returned when the query is invalid
-	ErrInvalidQuery = errors.New("invalid query")
+	ErrInvalidQuery = errs.New(errs.InvalidArgument, "invalid query")
 
 	// ErrInvalidArgument is returned when an argument is invalid
-	ErrInvalidArgument = errors.New("invalid argument")
+	ErrInvalidArgument = errs.New(errs.InvalidArgument, "invalid argument")
 
 	// ErrCollectionNotFound is returned when a collection is not found
-	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionNotFound = errs.New(errs.NotFound, "collection not found")
 
 	// ErrCollectionAlreadyExists is returned when a collection already exists
-	ErrCollectionAlreadyExists = errors.New("collection already exists")
+	ErrCollectionAlreadyExists = errs.New(errs.AlreadyExists, "collection already exists")
+
+	// ErrConfirmationRequired is returned for a DROP COLLECTION without CONFIRM
+	ErrConfirmationRequired = errs.New(errs.FailedPrecondition, "DROP COLLECTION deletes every vector; add CONFIRM to proceed")
+
+	// ErrDropDisabled is returned for DROP COLLECTION when drops are disabled
+	ErrDropDisabled = errs.New(errs.PermissionDenied, "DROP COLLECTION is disabled")
+
+	// ErrMetricMismatch is returned when a search asks for another metric
+	// than the one a collection is indexed with
+	ErrMetricMismatch = errs.New(errs.FailedPrecondition, "metric does not match the collection")
 )
 
 // IndexType represents the type of index to use
@@ -42,13 +61,38 @@ const (
 
 	// IndexTypeHNSW represents an HNSW index
 	IndexTypeHNSW IndexType = "hnsw"
+
+	// IndexTypeTiered represents an index with hot uncompressed vectors and
+	// cold quantized ones
+	IndexTypeTiered IndexType = "tiered"
 )
 
 // QueryExecutor executes SQL queries
 type QueryExecutor struct {
 	store      storage.VectorStore
+	mu         sync.RWMutex // Guards indexType, hnswConfig and metrics
 	indexType  IndexType
+	hnswConfig *hnsw.HNSWConfig
 	metric     distance.Metric
+	metrics    map[string]distance.Metric // Metric of each collection with one set
+	models     *embedding.Registry
+	adapter    storage.VectorAdapter
+	truncation *matryoshka.Options
+	twoStage   *twostage.Options
+	tiering    *tiered.Options
+	dryRun     bool
+	denyDrop   bool
+	readOnly   bool
+	audit      *audit.Log
+	actor      string
+	indexes    *IndexCache
+	results    *ResultCache
+	plans      *PlanCache
+	memory     *MemoryAccountant // Budgets of SELECTs; nil when unlimited
+	settings   *Settings // Changed with SET GLOBAL
+	session    *Settings // Changed with SET; nil when the executor serves no session
+	docsDir    string    // Documents of JOIN docs
+	catalog    *Catalog  // Views; nil when there are none
 }
 
 // NewQueryExecutor creates a new query executor
@@ -57,7 +101,245 @@ func NewQueryExecutor(store storage.VectorStore, indexType IndexType, metric dis
 		store:     store,
 		indexType: indexType,
 		metric:    metric,
+		settings:  NewSettings(),
+		readOnly:  storage.IsReadOnly(store),
+	}
+}
+
+// SetModelRegistry sets the embedding model registry used by EMBEDDING()
+func (qe *QueryExecutor) SetModelRegistry(models *embedding.Registry) {
+	qe.models = models
+	qe.settingsChanged()
+}
+
+// SetVectorAdapter sets the adapter that maps inserted and query vectors of
+// other dimensions into the collection's dimension
+func (qe *QueryExecutor) SetVectorAdapter(adapter storage.VectorAdapter) {
+	qe.adapter = adapter
+	qe.settingsChanged()
+}
+
+// SetTruncation enables Matryoshka-style search on a truncated prefix of the
+// vector dimensions. Nil searches on the full vectors.
+func (qe *QueryExecutor) SetTruncation(opts *matryoshka.Options) {
+	qe.truncation = opts
+	qe.settingsChanged()
+}
+
+// SetTwoStage enables two-stage search for flat indexes: a scan over
+// quantized vectors followed by exact rescoring from the store. Nil disables it.
+func (qe *QueryExecutor) SetTwoStage(opts *twostage.Options) {
+	qe.twoStage = opts
+	qe.settingsChanged()
+}
+
+// SetTiering sets the options of tiered indexes. Nil uses the defaults,
+// with access stats of each index's own.
+func (qe *QueryExecutor) SetTiering(opts *tiered.Options) {
+	qe.tiering = opts
+	qe.settingsChanged()
+}
+
+// SetDryRun makes INSERT, DELETE and DROP report what they would change
+// without modifying the store
+func (qe *QueryExecutor) SetDryRun(dryRun bool) {
+	qe.dryRun = dryRun
+}
+
+// SetAllowDrop enables or disables DROP COLLECTION. Drops are allowed by
+// default; servers disable them unless configured otherwise.
+func (qe *QueryExecutor) SetAllowDrop(allow bool) {
+	qe.denyDrop = !allow
+}
+
+// SetReadOnly rejects statements that write to the store or the catalog
+// with storage.ErrReadOnly. Queries, EXPLAIN, DESCRIBE, SET and USE still
+// run. Executors over a read-only store start read-only.
+func (qe *QueryExecutor) SetReadOnly(readOnly bool) {
+	qe.readOnly = readOnly
+}
+
+// SetAuditLog records every INSERT, DELETE and DROP in the audit log,
+// attributed to actor unless ExecuteQueryAs names another. Nil disables it.
+func (qe *QueryExecutor) SetAuditLog(log *audit.Log, actor string) {
+	qe.audit = log
+	qe.actor = actor
+}
+
+// SetHNSWConfig sets the parameters of HNSW indexes. Nil uses the defaults.
+func (qe *QueryExecutor) SetHNSWConfig(cfg *hnsw.HNSWConfig) {
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	qe.hnswConfig = cfg
+	qe.settingsChanged()
+}
+
+// SetCollectionMetric records the metric a collection's vectors are meant to
+// be compared with. Searches of the collection default to it and reject
+// USING clauses naming another metric. Nil forgets the collection's metric.
+func (qe *QueryExecutor) SetCollectionMetric(collection string, metric distance.Metric) {
+	qe.mu.Lock()
+	defer qe.mu.Unlock()
+	qe.settingsChanged()
+	if metric == nil {
+		delete(qe.metrics, collection)
+		return
+	}
+	if qe.metrics == nil {
+		qe.metrics = make(map[string]distance.Metric)
+	}
+	qe.metrics[collection] = metric
+}
+
+// searchMetric resolves the metric of a search of collection. An empty
+// requested metric selects the collection's metric, or the executor's when
+// the collection has none. The default_metric setting overrides the
+// executor's metric.
+func (qe *QueryExecutor) searchMetric(collection string, requested distance.Metric) (distance.Metric, error) {
+	qe.mu.RLock()
+	recorded := qe.metrics[collection]
+	qe.mu.RUnlock()
+
+	switch {
+	case requested == nil && recorded != nil:
+		return recorded, nil
+	case requested == nil:
+		if name, ok := qe.setting(SettingDefaultMetric); ok {
+			return distance.GetMetric(distance.MetricType(name))
+		}
+		return qe.metric, nil
+	case recorded != nil && recorded.Name() != requested.Name():
+		return nil, fmt.Errorf("%w: %s is indexed with %s, not %s", ErrMetricMismatch, collection, recorded.Name(), requested.Name())
+	default:
+		return requested, nil
+	}
+}
+
+// indexSpec returns what new indexes for a collection and metric are built
+// with, read once per query so a concurrent RebuildIndex swaps it atomically
+func (qe *QueryExecutor) indexSpec(collection string, metric distance.Metric) indexSpec {
+	qe.mu.RLock()
+	defer qe.mu.RUnlock()
+	return indexSpec{collection: collection, metric: metric, indexType: qe.indexType, hnsw: qe.hnswConfig}
+}
+
+// SetIndexCache reuses indexes of unfiltered nearest-neighbor searches
+// across queries. Nil builds a fresh index for every query.
+func (qe *QueryExecutor) SetIndexCache(cache *IndexCache) {
+	qe.indexes = cache
+}
+
+// SetSettings replaces the global settings, e.g. with ones shared by the
+// executors of several sessions
+func (qe *QueryExecutor) SetSettings(settings *Settings) {
+	qe.settings = settings
+}
+
+// SetSession gives the executor a session whose settings override the
+// global ones. Without a session, SET only accepts GLOBAL.
+func (qe *QueryExecutor) SetSession(session *Settings) {
+	qe.session = session
+}
+
+// SetResultCache reuses the results of SELECT statements until the store
+// changes. Nil disables result caching.
+func (qe *QueryExecutor) SetResultCache(cache *ResultCache) {
+	qe.results = cache
+}
+
+// SetPlanCache reuses the parses of statements that differ from earlier
+// ones only in their literals. Nil parses every statement.
+func (qe *QueryExecutor) SetPlanCache(cache *PlanCache) {
+	qe.plans = cache
+}
+
+// SetMemoryAccountant accounts the memory SELECTs allocate against the
+// budgets of accountant, aborting those that exceed them. Nil leaves
+// queries unlimited.
+func (qe *QueryExecutor) SetMemoryAccountant(accountant *MemoryAccountant) {
+	qe.memory = accountant
+}
+
+// parse parses a statement, from the plan cache if there is one
+func (qe *QueryExecutor) parse(query string) (*parser.Node, error) {
+	if qe.plans != nil {
+		return qe.plans.parse(query)
+	}
+	return parser.Parse(query)
+}
+
+// settingsChanged drops cached results, which may have been computed with
+// other search settings
+func (qe *QueryExecutor) settingsChanged() {
+	if qe.results != nil {
+		qe.results.Clear()
+	}
+}
+
+// adaptVector passes a vector through the configured adapter, if any
+func (qe *QueryExecutor) adaptVector(v *vector.Vector) (*vector.Vector, error) {
+	if qe.adapter == nil {
+		return v, nil
+	}
+	return qe.adapter.Adapt(v)
+}
+
+// modelRegistry returns the model registry, creating a default one on first use
+func (qe *QueryExecutor) modelRegistry() *embedding.Registry {
+	if qe.models == nil {
+		qe.models = embedding.NewRegistry()
+	}
+	return qe.models
+}
+
+// evaluateEmbedding evaluates EMBEDDING('text' [, 'model']) using the model
+// of the given collection and returns the vector and the provider model name.
+// Queries may name any registered model of the collection's dimension; the
+// model name is then empty, as stored vectors were embedded with another.
+func (qe *QueryExecutor) evaluateEmbedding(node *parser.Node, collectionName string, query bool) ([]float32, string, error) {
+	if node.Value != "EMBEDDING" {
+		return nil, "", fmt.Errorf("%w: function %s cannot produce a vector", ErrUnsupportedOperation, node.Value)
 	}
+	if len(node.Children) < 1 || len(node.Children) > 2 {
+		return nil, "", fmt.Errorf("%w: EMBEDDING() takes a text and an optional model name", ErrInvalidArgument)
+	}
+	
+	args := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		if child.Type != parser.NodeLiteral && child.Type != parser.NodeIdentifier {
+			return nil, "", fmt.Errorf("%w: EMBEDDING() arguments must be strings", ErrInvalidArgument)
+		}
+		args[i] = strings.Trim(child.Value, "'\"")
+	}
+	
+	requested := ""
+	if len(args) > 1 {
+		requested = args[1]
+	}
+	
+	// Use the collection's model; an explicit model must match it unless it
+	// only embeds a query
+	var service *embedding.Service
+	var err error
+	override := false
+	if query {
+		service, override, err = qe.modelRegistry().ServiceForQuery(collectionName, requested)
+	} else {
+		service, err = qe.modelRegistry().ServiceForCollection(collectionName, requested)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	
+	doc := embedding.NewTextDocument("_query_", args[0])
+	if err := service.ProcessDocument(doc); err != nil {
+		return nil, "", fmt.Errorf("failed to embed text: %w", err)
+	}
+	
+	if override {
+		return doc.Vector, "", nil
+	}
+	return doc.Vector, service.ModelName(), nil
 }
 
 // Column represents a column in a result set
@@ -71,42 +353,257 @@ type Row []interface{}
 
 // ResultSet represents the result of a query
 type ResultSet struct {
-	Columns []Column
-	Rows    []Row
+	Columns  []Column
+	Rows     []Row
+	Affected int // Vectors changed by INSERT, DELETE or DROP
+}
+
+// Stream receives the result of a query as it is produced: the columns
+// first, then the rows one at a time. An error returned by either stops the
+// query and is returned by StreamQueryAs.
+type Stream struct {
+	Columns func(columns []Column) error
+	Row     func(row Row) error
 }
 
 // ExecuteQuery executes a SQL query
 func (qe *QueryExecutor) ExecuteQuery(query string) (*ResultSet, error) {
+	return qe.ExecuteQueryAs(qe.actor, query)
+}
+
+// ExecuteQueryAs executes a SQL query on behalf of actor, who is named in
+// the audit log for statements that modify the store
+func (qe *QueryExecutor) ExecuteQueryAs(actor, query string) (*ResultSet, error) {
+	return qe.ExecuteQueryContext(context.Background(), actor, query)
+}
+
+// ExecuteQueryContext executes a SQL query on behalf of actor like
+// ExecuteQueryAs. Scans, inserts and deletes read and write the store with
+// ctx, and stop with its error once it is done.
+func (qe *QueryExecutor) ExecuteQueryContext(ctx context.Context, actor, query string) (*ResultSet, error) {
 	// Parse the query
-	ast, err := parser.Parse(query)
+	ast, err := qe.parse(query)
 	if err != nil {
 		return nil, fmt.Errorf("parse error: %w", err)
 	}
 
+	if statement := writeStatement(ast); qe.readOnly && statement != "" {
+		return nil, fmt.Errorf("%w: cannot execute %s", storage.ErrReadOnly, statement)
+	}
+
 	// Execute the query based on its type
 	switch ast.Type {
 	case parser.NodeSelect:
-		return qe.executeSelect(ast)
+		return qe.cachedSelect(ctx, query, ast)
 	case parser.NodeInsert:
-		return qe.executeInsert(ast)
+		result, err := qe.executeInsert(ctx, ast)
+		qe.written(actor, audit.OpInsert, query, result, err)
+		return result, err
 	case parser.NodeDelete:
-		return qe.executeDelete(ast)
+		result, err := qe.executeDelete(ctx, ast)
+		qe.written(actor, audit.OpDelete, query, result, err)
+		return result, err
 	case parser.NodeCreate:
 		return qe.executeCreate(ast)
+	case parser.NodeSet:
+		return qe.executeSet(ast)
+	case parser.NodeUse:
+		return qe.executeUse(ast)
+	case parser.NodeExplain:
+		return qe.executeExplain(ctx, ast)
+	case parser.NodeDescribe:
+		return qe.executeDescribe(ast)
+	case parser.NodeCreateView:
+		return qe.executeCreateView(ast)
+	case parser.NodeDropView:
+		return qe.executeDropView(ast)
+	case parser.NodeCreateMacro:
+		return qe.executeCreateMacro(ast)
+	case parser.NodeDropMacro:
+		return qe.executeDropMacro(ast)
+	case parser.NodeCreateRule:
+		return qe.executeCreateRule(ast)
+	case parser.NodeDropRule:
+		return qe.executeDropRule(ast)
 	case parser.NodeDrop:
-		return qe.executeDrop(ast)
+		result, err := qe.executeDrop(ctx, ast)
+		qe.written(actor, audit.OpDrop, query, result, err)
+		return result, err
 	default:
 		return nil, ErrUnsupportedOperation
 	}
 }
 
-// executeSelect executes a SELECT query
-func (qe *QueryExecutor) executeSelect(node *parser.Node) (*ResultSet, error) {
+// writeStatement returns the name of a statement that changes the store or
+// the catalog, or "" for one that does not
+func writeStatement(ast *parser.Node) string {
+	switch ast.Type {
+	case parser.NodeInsert:
+		return "INSERT"
+	case parser.NodeDelete:
+		return "DELETE"
+	case parser.NodeCreate:
+		return "CREATE COLLECTION"
+	case parser.NodeCreateView:
+		return "CREATE VIEW"
+	case parser.NodeDropView:
+		return "DROP VIEW"
+	case parser.NodeCreateMacro:
+		return "CREATE MACRO"
+	case parser.NodeDropMacro:
+		return "DROP MACRO"
+	case parser.NodeCreateRule:
+		return "CREATE RULE"
+	case parser.NodeDropRule:
+		return "DROP RULE"
+	case parser.NodeDrop:
+		return "DROP COLLECTION"
+	}
+	return ""
+}
+
+// StreamQueryAs executes a SQL query on behalf of actor like ExecuteQueryAs,
+// but writes its result to stream. Plain SELECT scans write each row as soon
+// as it matches, so large results need not be held in memory; they bypass
+// the result cache. Other statements write their result when they finish.
+func (qe *QueryExecutor) StreamQueryAs(actor, query string, stream *Stream) error {
+	return qe.StreamQueryContext(context.Background(), actor, query, stream)
+}
+
+// StreamQueryContext streams a SQL query like StreamQueryAs, reading and
+// writing the store with ctx like ExecuteQueryContext
+func (qe *QueryExecutor) StreamQueryContext(ctx context.Context, actor, query string, stream *Stream) error {
+	ast, err := qe.parse(query)
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+	if ast.Type == parser.NodeSelect {
+		mem := qe.memory.begin()
+		defer mem.release()
+		return qe.streamSelect(ctx, ast, nil, mem, stream)
+	}
+
+	result, err := qe.ExecuteQueryContext(ctx, actor, query)
+	if err != nil {
+		return err
+	}
+	return writeResult(result, stream)
+}
+
+// cachedSelect executes a SELECT, answering from the result cache if the
+// same statement was executed since the store last changed
+func (qe *QueryExecutor) cachedSelect(ctx context.Context, query string, ast *parser.Node) (*ResultSet, error) {
+	// Recency changes as time passes, so SCORE() results are not reused
+	if qe.results == nil || hasScoreOrder(ast) || hasHint(ast, HintNoCache) {
+		return qe.executeSelect(ctx, ast, nil)
+	}
+	epoch, ok := storage.StoreEpoch(qe.store)
+	if !ok {
+		return qe.executeSelect(ctx, ast, nil)
+	}
+	key, err := parser.Normalize(query)
+	if err != nil {
+		return qe.executeSelect(ctx, ast, nil)
+	}
+	key += "\n" + qe.settingsKey()
+	if result, ok := qe.results.get(key, epoch); ok {
+		return result, nil
+	}
+
+	// The epoch is read before executing, so a write during the query
+	// leaves a result that is never served again
+	result, err := qe.executeSelect(ctx, ast, nil)
+	if err != nil {
+		return nil, err
+	}
+	qe.results.put(key, epoch, result)
+	return result, nil
+}
+
+// written invalidates cached indexes after a modifying statement and
+// records it in the audit log. Dry runs change nothing and are not recorded.
+func (qe *QueryExecutor) written(actor, operation, query string, result *ResultSet, err error) {
+	if qe.dryRun {
+		return
+	}
+	if qe.indexes != nil && err == nil && result.Affected > 0 {
+		qe.indexes.Invalidate()
+	}
+	if qe.audit == nil {
+		return
+	}
+
+	entry := audit.Entry{Actor: actor, Operation: operation, Statement: query}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Affected = result.Affected
+	}
+	qe.audit.Record(entry)
+}
+
+// executeSelect executes a SELECT query. Nearest-neighbor searches record
+// their work in trace if it is not nil.
+func (qe *QueryExecutor) executeSelect(ctx context.Context, node *parser.Node, trace *searchTrace) (*ResultSet, error) {
+	mem := qe.memory.begin()
+	defer mem.release()
+
+	result := &ResultSet{Rows: []Row{}}
+	err := qe.streamSelect(ctx, node, trace, mem, &Stream{
+		Columns: func(columns []Column) error {
+			result.Columns = columns
+			return nil
+		},
+		Row: func(row Row) error {
+			if err := mem.reserve(rowMemory(row), "result rows"); err != nil {
+				return err
+			}
+			result.Rows = append(result.Rows, row)
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// streamSelect executes a SELECT query, writing rows to stream as they are
+// produced. Rows of a plain scan are written as soon as they match; ORDER
+// BY, COUNT(*) and nearest-neighbor searches need every match first. The
+// memory they hold is accounted in mem.
+func (qe *QueryExecutor) streamSelect(ctx context.Context, node *parser.Node, trace *searchTrace, mem *queryMemory, stream *Stream) error {
+	// A JOIN selects from the vectors, then fills in the joined columns
+	for _, child := range node.Children {
+		if child.Type == parser.NodeJoin {
+			var err error
+			if node, stream, err = qe.joinDocs(node, child, stream); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	
+	// Views read FROM their collection, and macros and rules apply
+	node, err := qe.rewrite(node)
+	if err != nil {
+		return err
+	}
+	if selectsCentroids(node) {
+		return qe.streamCentroids(node, stream)
+	}
+	hints, err := selectHints(node)
+	if err != nil {
+		return err
+	}
+	
 	// Find the FROM node
 	var fromNode *parser.Node
 	var nearestNode *parser.Node
 	var whereNode *parser.Node
 	var limitNode *parser.Node
+	var orderNode *parser.Node
+	var groupNode *parser.Node
 	
 	for _, child := range node.Children {
 		switch child.Type {
@@ -118,21 +615,27 @@ func (qe *QueryExecutor) executeSelect(node *parser.Node) (*ResultSet, error) {
 			whereNode = child
 		case parser.NodeLimit:
 			limitNode = child
+		case parser.NodeOrderBy:
+			orderNode = child
+		case parser.NodeGroupBy:
+			groupNode = child
 		}
 	}
-	
-	// We need at least a FROM clause
-	if fromNode == nil {
-		return nil, fmt.Errorf("%w: missing FROM clause", ErrInvalidQuery)
+	if groupNode != nil && nearestNode == nil {
+		return fmt.Errorf("%w: GROUP BY needs NEAREST TO", ErrInvalidQuery)
 	}
 	
-	// Get the collection name
-	if len(fromNode.Children) == 0 || fromNode.Children[0].Type != parser.NodeTable {
-		return nil, fmt.Errorf("%w: invalid FROM clause", ErrInvalidQuery)
+	// Without FROM, the collection chosen with USE is read
+	collectionName, ok := qe.setting(SettingCollection)
+	if fromNode != nil {
+		if len(fromNode.Children) == 0 || fromNode.Children[0].Type != parser.NodeTable {
+			return fmt.Errorf("%w: invalid FROM clause", ErrInvalidQuery)
+		}
+		collectionName = fromNode.Children[0].Value
+	} else if !ok {
+		return fmt.Errorf("%w: missing FROM clause and no collection chosen with USE", ErrInvalidQuery)
 	}
 	
-	collectionName := fromNode.Children[0].Value
-	
 	// Prepare result columns
 	columns := []Column{}
 	for _, child := range node.Children {
@@ -169,86 +672,166 @@ func (qe *QueryExecutor) executeSelect(node *parser.Node) (*ResultSet, error) {
 	if limitNode != nil {
 		limitVal, err := strconv.Atoi(limitNode.Value)
 		if err != nil {
-			return nil, fmt.Errorf("%w: invalid LIMIT value", ErrInvalidQuery)
+			return fmt.Errorf("%w: invalid LIMIT value", ErrInvalidQuery)
 		}
 		limit = limitVal
 	}
 	
 	// Handle nearest neighbor search
 	if nearestNode != nil {
-		return qe.executeNearestSearch(nearestNode, collectionName, columns, limit)
+		result, err := qe.executeNearestSearch(ctx, nearestNode, whereNode, orderNode, groupNode, collectionName, columns, limit, hints, trace, mem)
+		if err != nil {
+			return err
+		}
+		return writeResult(result, stream)
 	}
 	
 	// Handle normal select
-	// Get all vectors from the store
-	ids, err := qe.store.List()
+	// Get the vectors the WHERE clause can match from the store
+	ids, err := qe.candidateIDs(ctx, whereNode)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	
-	// Apply WHERE filter if present
-	if whereNode != nil {
-		filteredIDs := []string{}
+	if err := mem.reserve(idsMemory(ids), "candidate IDs"); err != nil {
+		return err
+	}
+	if err := stream.Columns(columns); err != nil {
+		return err
+	}
+
+	// WHERE only reads IDs and metadata, so the values are never loaded
+	store := storage.WithContext(qe.store)
+	matches := func(id string) (bool, error) {
+		if whereNode == nil {
+			return true, ctx.Err()
+		}
+		vec, err := store.GetCtx(ctx, id, storage.GetOptions{MetadataOnly: true})
+		if err != nil {
+			// Skip vectors that can't be retrieved
+			return false, ctx.Err()
+		}
+		return qe.evaluateWhereCondition(whereNode.Children[0], vec, collectionName)
+	}
+
+	// Values are only read from the store if the vector column is projected
+	opts := storage.GetOptions{MetadataOnly: true}
+	for _, col := range columns {
+		if col.Name == "vector" {
+			opts.MetadataOnly = false
+		}
+	}
+	writeRow := func(id string) error {
+		vec, err := store.GetCtx(ctx, id, opts)
+		if err != nil {
+			return ctx.Err()
+		}
+
+		row := Row{}
+		for _, col := range columns {
+			if col.Name == "id" {
+				row = append(row, id)
+			} else if col.Name == "vector" {
+				row = append(row, vec.Values)
+			} else if col.Name == "dimension" {
+				row = append(row, vec.Dimension)
+			} else if value, ok := qe.accessColumn(col.Name, id); ok {
+				row = append(row, value)
+			} else if t, ok := timestampColumn(col.Name, vec); ok {
+				row = append(row, formatTimestamp(t))
+			} else {
+				// By default, return the ID
+				row = append(row, id)
+			}
+		}
+		return stream.Row(row)
+	}
+
+	// Candidates are in ID order, so without ORDER BY or COUNT(*) every
+	// match is written at once
+	if orderNode == nil && !isCountQuery {
+		matched := 0
 		for _, id := range ids {
-			vec, err := qe.store.Get(id)
-			if err != nil {
-				// Skip vectors that can't be retrieved
-				continue
+			if limit > 0 && matched >= limit {
+				break
 			}
-			
-			matches, err := qe.evaluateWhereCondition(whereNode.Children[0], vec, collectionName)
+			ok, err := matches(id)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			
-			if matches {
-				filteredIDs = append(filteredIDs, id)
+			if !ok {
+				continue
+			}
+			matched++
+			if err := writeRow(id); err != nil {
+				return err
 			}
 		}
-		ids = filteredIDs
+		return nil
 	}
-	
+
+	filteredIDs := []string{}
+	for _, id := range ids {
+		ok, err := matches(id)
+		if err != nil {
+			return err
+		}
+		if ok {
+			filteredIDs = append(filteredIDs, id)
+		}
+	}
+	ids = filteredIDs
+
+	// Rows are in ID order unless ORDER BY sorts them otherwise
+	if orderNode != nil {
+		results := make(index.SearchResults, len(ids))
+		for i, id := range ids {
+			results[i] = index.SearchResult{ID: id}
+		}
+		if err := qe.orderResults(results, orderNode, false); err != nil {
+			return err
+		}
+		for i, result := range results {
+			ids[i] = result.ID
+		}
+	}
+
 	// Apply limit if needed
 	if limit > 0 && limit < len(ids) {
 		ids = ids[:limit]
 	}
-	
-	// Create result set
-	rows := []Row{}
-	
+
 	if isCountQuery {
 		// For COUNT(*), just return the count
-		rows = append(rows, Row{len(ids)})
-	} else {
-		// Otherwise, return the requested columns
-		for _, id := range ids {
-			vec, err := qe.store.Get(id)
-			if err != nil {
-				continue
-			}
-			
-			row := Row{}
-			for _, col := range columns {
-				if col.Name == "id" {
-					row = append(row, id)
-				} else if col.Name == "vector" {
-					row = append(row, fmt.Sprintf("%v", vec.Values))
-				} else if col.Name == "dimension" {
-					row = append(row, vec.Dimension)
-				} else {
-					// By default, return the ID
-					row = append(row, id)
-				}
-			}
-			rows = append(rows, row)
+		return stream.Row(Row{len(ids)})
+	}
+	for _, id := range ids {
+		if err := writeRow(id); err != nil {
+			return err
 		}
 	}
-	
-	return &ResultSet{Columns: columns, Rows: rows}, nil
+	return nil
 }
 
-// executeNearestSearch executes a nearest neighbor search
-func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collectionName string, columns []Column, limit int) (*ResultSet, error) {
+// writeResult writes a complete result set to stream
+func writeResult(result *ResultSet, stream *Stream) error {
+	if err := stream.Columns(result.Columns); err != nil {
+		return err
+	}
+	for _, row := range result.Rows {
+		if err := stream.Row(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// executeNearestSearch executes a nearest neighbor search. Only vectors
+// matching the optional WHERE clause are searched. Results are ordered by
+// distance unless ORDER BY sorts them otherwise. With GROUP BY, only the
+// first row of each group is kept, and more candidates are searched until
+// the groups fill the limit. Hints override the index type and the index
+// cache. Indexes built for the query are accounted in mem.
+func (qe *QueryExecutor) executeNearestSearch(ctx context.Context, nearestNode, whereNode, orderNode, groupNode *parser.Node, collectionName string, columns []Column, limit int, hints queryHints, trace *searchTrace, mem *queryMemory) (*ResultSet, error) {
 	// Get the query vector
 	if len(nearestNode.Children) == 0 {
 		return nil, fmt.Errorf("%w: missing query vector", ErrInvalidQuery)
@@ -256,8 +839,17 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 	
 	queryNode := nearestNode.Children[0]
 	var queryVec *vector.Vector
+	queryModel := ""
 	
-	if queryNode.Type == parser.NodeIdentifier {
+	if queryNode.Type == parser.NodeFunction {
+		// Embed the query text with the collection's model
+		values, model, err := qe.evaluateEmbedding(queryNode, collectionName, true)
+		if err != nil {
+			return nil, err
+		}
+		queryVec = vector.NewVector("query", values)
+		queryModel = model
+	} else if queryNode.Type == parser.NodeIdentifier {
 		// Get the vector from the store
 		vecID := queryNode.Value
 		vec, err := qe.store.Get(vecID)
@@ -279,7 +871,7 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 			}
 			val, err := strconv.ParseFloat(part, 32)
 			if err != nil {
-				return nil, fmt.Errorf("invalid vector value: %s", part)
+				return nil, fmt.Errorf("%w: invalid vector value: %s", ErrInvalidArgument, part)
 			}
 			values = append(values, float32(val))
 		}
@@ -289,59 +881,118 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 		return nil, fmt.Errorf("%w: invalid query vector", ErrInvalidQuery)
 	}
 	
+	// Project queries from other models into the collection's dimension
+	queryVec, err := qe.adaptVector(queryVec)
+	if err != nil {
+		return nil, err
+	}
+	
 	// Get the metric to use
-	metric := qe.metric
+	var requested distance.Metric
 	if len(nearestNode.Children) > 1 && nearestNode.Children[1].Type == parser.NodeMetric {
 		metricName := nearestNode.Children[1].Value
 		// Remove quotes if present
 		metricName = strings.Trim(metricName, "'\"")
 		
-		newMetric, err := distance.GetMetric(distance.MetricType(metricName))
+		requested, err = distance.GetMetric(distance.MetricType(metricName))
 		if err != nil {
-			return nil, fmt.Errorf("invalid metric: %w", err)
+			return nil, fmt.Errorf("%w: invalid metric: %v", ErrInvalidArgument, err)
 		}
-		metric = newMetric
+	}
+	metric, err := qe.searchMetric(collectionName, requested)
+	if err != nil {
+		return nil, err
 	}
 	
 	// Set default limit if not specified
 	if limit < 0 {
 		limit = 10 // Default to 10 results
 	}
-	
-	// Get all vectors from the store
-	ids, err := qe.store.List()
+	score, err := qe.scoreOrder(orderNode)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupColumn(groupNode)
+	if err != nil {
+		return nil, err
+	}
+	boosts, err := searchBoosts(nearestNode)
 	if err != nil {
 		return nil, err
 	}
+	searchLimit := limit
+	if score != nil || isExpressionOrder(orderNode) || len(boosts) > 0 {
+		searchLimit = limit * scoreCandidates
+	}
+	if group != "" {
+		searchLimit *= collapseCandidates
+	}
 	
-	vectors := make([]*vector.Vector, 0, len(ids))
-	for _, id := range ids {
-		vec, err := qe.store.Get(id)
-		if err != nil {
-			continue
-		}
-		vectors = append(vectors, vec)
+	spec := qe.indexSpec(collectionName, metric)
+	if hints.indexType != "" {
+		spec.indexType = hints.indexType
 	}
 	
-	// Create and build the index
+	// Unfiltered searches reuse the cached index
 	var idx index.Index
-	switch qe.indexType {
-	case IndexTypeFlat:
-		idx = flat.NewFlatIndex(metric)
-	case IndexTypeHNSW:
-		idx = hnsw.NewHNSWIndex(metric, nil)
-	default:
-		return nil, fmt.Errorf("unsupported index type: %s", qe.indexType)
+	filtered := 0
+	if whereNode == nil && qe.indexes != nil && !hints.noCache {
+		idx, err = qe.cachedSearchIndex(spec, queryModel)
+	} else {
+		idx, filtered, err = qe.buildSearchIndex(ctx, whereNode, spec, queryModel, mem)
+	}
+	if err != nil {
+		return nil, err
 	}
 	
-	if err := idx.Build(vectors); err != nil {
-		return nil, fmt.Errorf("failed to build index: %w", err)
+	// Vectors are only copied into results if a column needs them
+	opts := index.SearchOptions{OmitVectors: true, EfSearch: qe.efSearch()}
+	for _, col := range columns {
+		if col.Name == "vector" || col.Name == "dimension" {
+			opts.OmitVectors = false
+		}
+	}
+	if trace != nil {
+		trace.searched = true
+		trace.filtered = filtered
+		opts.Stats = &trace.stats
 	}
 	
-	// Perform the search
-	results, err := idx.Search(queryVec, limit)
-	if err != nil {
-		return nil, fmt.Errorf("search failed: %w", err)
+	// Perform the search. Nothing to search or nothing asked for is no match.
+	var results index.SearchResults
+	var scores map[string]float64
+	for limit > 0 && idx.Size() > 0 {
+		results, err = index.SearchWithOptions(idx, queryVec, searchLimit, opts)
+		if err != nil {
+			return nil, fmt.Errorf("search failed: %w", err)
+		}
+		candidates := len(results)
+		if err := qe.applyBoosts(results, boosts, collectionName); err != nil {
+			return nil, err
+		}
+		if score != nil {
+			if scores, err = qe.rankByScore(results, score, metric.Name(), orderNode.Value == "DESC"); err != nil {
+				return nil, err
+			}
+		} else if err := qe.orderResults(results, orderNode, true); err != nil {
+			return nil, err
+		}
+		if group == "" {
+			break
+		}
+		
+		// Search more candidates until the groups fill the limit or every
+		// vector was a candidate
+		if results, err = qe.collapse(results, group); err != nil {
+			return nil, err
+		}
+		if len(results) >= limit || candidates < searchLimit || searchLimit >= idx.Size() {
+			break
+		}
+		searchLimit *= 2
+	}
+	if len(results) > limit {
+		results = results[:limit]
 	}
 	
 	// Add "distance" column if not already present
@@ -359,11 +1010,16 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 	
 	// Create result set
 	rows := []Row{}
+	found := make([]string, 0, len(results))
 	for _, result := range results {
 		// Skip the query vector itself if it's in the results
 		if result.ID == queryVec.ID {
 			continue
 		}
+		if trace != nil {
+			trace.results = append(trace.results, result)
+		}
+		found = append(found, result.ID)
 		
 		row := Row{}
 		for _, col := range columns {
@@ -372,10 +1028,26 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 				row = append(row, result.ID)
 			case "distance":
 				row = append(row, result.Distance)
+			case ColumnScore:
+				if scores != nil {
+					row = append(row, float32(scores[result.ID]))
+				} else {
+					row = append(row, result.Distance)
+				}
 			case "vector":
-				row = append(row, fmt.Sprintf("%v", result.Vector.Values))
+				row = append(row, result.Vector.Values)
 			case "dimension":
 				row = append(row, result.Vector.Dimension)
+			case ColumnCreatedAt, ColumnUpdatedAt:
+				// Index vectors may predate their timestamps, so the store is read
+				var t time.Time
+				if vec, err := storage.GetMeta(qe.store, result.ID); err == nil {
+					t, _ = timestampColumn(col.Name, vec)
+				}
+				row = append(row, formatTimestamp(t))
+			case ColumnHits, ColumnLastReturnedAt:
+				value, _ := qe.accessColumn(col.Name, result.ID)
+				row = append(row, value)
 			default:
 				// By default, return the ID
 				row = append(row, result.ID)
@@ -384,16 +1056,315 @@ func (qe *QueryExecutor) executeNearestSearch(nearestNode *parser.Node, collecti
 		rows = append(rows, row)
 	}
 	
+	// Quotas that evict the least searched vectors keep these
+	storage.RecordSearch(qe.store, found)
 	return &ResultSet{Columns: columns, Rows: rows}, nil
 }
 
+// buildSearchIndex builds an index over the vectors matching the WHERE
+// clause, checking that they were embedded with the query's model. It also
+// returns how many vectors the clause excluded. The candidates and the
+// vectors loaded to build the index are accounted in mem.
+func (qe *QueryExecutor) buildSearchIndex(ctx context.Context, whereNode *parser.Node, spec indexSpec, queryModel string, mem *queryMemory) (index.Index, int, error) {
+	collectionName := spec.collection
+	// Get the vectors the WHERE clause can match from the store
+	ids, err := qe.candidateIDs(ctx, whereNode)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := mem.reserve(idsMemory(ids), "candidate IDs"); err != nil {
+		return nil, 0, err
+	}
+	
+	vectors := make([]*vector.Vector, 0, len(ids))
+	filtered := 0
+	store := storage.WithContext(qe.store)
+	for _, id := range ids {
+		vec, err := store.GetCtx(ctx, id, storage.GetOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			continue
+		}
+		
+		if whereNode != nil {
+			matches, err := qe.evaluateWhereCondition(whereNode.Children[0], vec, collectionName)
+			if err != nil {
+				return nil, 0, err
+			}
+			if !matches {
+				filtered++
+				continue
+			}
+		}
+		
+		// Embedded queries must use the model the vectors were built with
+		if queryModel != "" {
+			if err := qe.modelRegistry().CheckVector(collectionName, vec); err != nil {
+				return nil, 0, err
+			}
+		}
+		if err := mem.reserve(vectorMemory(vec), "vectors of the index"); err != nil {
+			return nil, 0, err
+		}
+		vectors = append(vectors, vec)
+	}
+	
+	idx, err := qe.newSearchIndex(spec)
+	if err != nil {
+		return nil, 0, err
+	}
+	
+	if err := idx.Build(vectors); err != nil {
+		return nil, 0, fmt.Errorf("failed to build index: %w", err)
+	}
+	return idx, filtered, nil
+}
+
+// newSearchIndex creates an empty index for spec with the configured search
+// options
+func (qe *QueryExecutor) newSearchIndex(spec indexSpec) (index.Index, error) {
+	metric := spec.metric
+	var idx index.Index
+	switch spec.indexType {
+	case IndexTypeFlat:
+		if qe.twoStage != nil {
+			// Rescore from the store unless the index only sees truncated vectors
+			var source twostage.Source = qe.store
+			if qe.truncation != nil {
+				source = nil
+			}
+			idx = twostage.NewIndex(quantized.NewQuantizedIndex(metric), source, metric, qe.twoStage)
+		} else {
+			idx = flat.NewFlatIndex(metric)
+		}
+	case IndexTypeHNSW:
+		idx = hnsw.NewHNSWIndex(metric, spec.hnsw)
+	case IndexTypeTiered:
+		// Cold vectors are rescored from the store, as with two-stage search
+		var source tiered.Source = qe.store
+		if qe.truncation != nil {
+			source = nil
+		}
+		idx = tiered.NewIndex(source, metric, qe.tiering)
+	default:
+		return nil, fmt.Errorf("%w: unsupported index type: %s", ErrInvalidArgument, spec.indexType)
+	}
+	
+	// Search on truncated prefixes and rescore at full precision if enabled
+	if qe.truncation != nil {
+		truncated, err := matryoshka.NewIndex(idx, metric, qe.truncation)
+		if err != nil {
+			return nil, err
+		}
+		idx = truncated
+	}
+	return idx, nil
+}
+
+// cachedSearchIndex returns the cached index of spec over all vectors,
+// building it on first use
+func (qe *QueryExecutor) cachedSearchIndex(spec indexSpec, queryModel string) (index.Index, error) {
+	cached, err := qe.indexes.get(qe.indexKey(spec), qe.store, func() (index.Index, error) {
+		return qe.newSearchIndex(spec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	
+	// Embedded queries must use the model the vectors were built with
+	if queryModel != "" {
+		for _, vec := range cached.models {
+			if err := qe.modelRegistry().CheckVector(spec.collection, vec); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cached.index, nil
+}
+
+// indexKey returns the cache key of spec, including the search options
+// that change how indexes are built
+func (qe *QueryExecutor) indexKey(spec indexSpec) indexKey {
+	variant := ""
+	if qe.truncation != nil {
+		variant += fmt.Sprintf("truncation=%+v;", *qe.truncation)
+	}
+	if qe.twoStage != nil && spec.indexType == IndexTypeFlat {
+		variant += fmt.Sprintf("twostage=%+v;", *qe.twoStage)
+	}
+	if spec.hnsw != nil && spec.indexType == IndexTypeHNSW {
+		variant += fmt.Sprintf("hnsw=%+v;", *spec.hnsw)
+	}
+	if t := qe.tiering; t != nil && spec.indexType == IndexTypeTiered {
+		variant += fmt.Sprintf("tiered=%d/%d/%d/%d/%g/%d;", t.Clusters, t.Probes, t.Candidates, t.HotSize, t.MinHits, t.RetierEvery)
+	}
+	
+	return indexKey{
+		collection: spec.collection,
+		metric:     spec.metric.Name(),
+		indexType:  spec.indexType,
+		variant:    variant,
+	}
+}
+
+// RebuildOptions selects the index of RebuildIndex, SearchIndex or
+// InstallIndex. Zero fields keep the executor's current settings.
+type RebuildOptions struct {
+	Collection string
+	Metric     distance.Metric
+	IndexType  IndexType
+	HNSW       *hnsw.HNSWConfig
+}
+
+// RebuildIndex builds a new index for unfiltered nearest-neighbor searches
+// from the store while queries keep using the current one, then swaps it in
+// and makes its index type and HNSW parameters the executor's settings.
+// It requires an index cache.
+func (qe *QueryExecutor) RebuildIndex(opts RebuildOptions) (*IndexInfo, error) {
+	if qe.indexes == nil {
+		return nil, fmt.Errorf("%w: index rebuilds need an index cache", ErrUnsupportedOperation)
+	}
+	spec, err := qe.rebuildSpec(opts)
+	if err != nil {
+		return nil, err
+	}
+	
+	info, err := qe.indexes.rebuild(qe.indexKey(spec), qe.store, func() (index.Index, error) {
+		return qe.newSearchIndex(spec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	qe.useIndex(spec)
+	return info, nil
+}
+
+// InstallIndex creates the index selected by opts, fills it with load
+// instead of building it, and swaps it in like RebuildIndex. It serves
+// indexes built on another machine, which must have been built from the
+// vectors of the store. It requires an index cache.
+func (qe *QueryExecutor) InstallIndex(opts RebuildOptions, load func(index.Index) error) (*IndexInfo, error) {
+	if qe.indexes == nil {
+		return nil, fmt.Errorf("%w: installing indexes needs an index cache", ErrUnsupportedOperation)
+	}
+	spec, err := qe.rebuildSpec(opts)
+	if err != nil {
+		return nil, err
+	}
+	
+	info, err := qe.indexes.install(qe.indexKey(spec), qe.store, func() (index.Index, error) {
+		return qe.newSearchIndex(spec)
+	}, load)
+	if err != nil {
+		return nil, err
+	}
+	qe.useIndex(spec)
+	return info, nil
+}
+
+// SearchIndex returns the index selected by opts for unfiltered
+// nearest-neighbor searches, loading or building it over the store if it is
+// not cached
+func (qe *QueryExecutor) SearchIndex(opts RebuildOptions) (index.Index, error) {
+	spec, err := qe.rebuildSpec(opts)
+	if err != nil {
+		return nil, err
+	}
+	
+	if qe.indexes != nil {
+		cached, err := qe.indexes.get(qe.indexKey(spec), qe.store, func() (index.Index, error) {
+			return qe.newSearchIndex(spec)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return cached.index, nil
+	}
+	
+	vectors, err := allVectors(qe.store)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := qe.newSearchIndex(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Build(vectors); err != nil {
+		return nil, fmt.Errorf("failed to build index: %w", err)
+	}
+	return idx, nil
+}
+
+// rebuildSpec returns the spec of the index selected by opts
+func (qe *QueryExecutor) rebuildSpec(opts RebuildOptions) (indexSpec, error) {
+	if opts.Collection == "" {
+		return indexSpec{}, fmt.Errorf("%w: missing collection name", ErrInvalidArgument)
+	}
+	
+	metric, err := qe.searchMetric(opts.Collection, opts.Metric)
+	if err != nil {
+		return indexSpec{}, err
+	}
+	spec := qe.indexSpec(opts.Collection, metric)
+	if opts.IndexType != "" {
+		spec.indexType = opts.IndexType
+	}
+	if opts.HNSW != nil {
+		spec.hnsw = opts.HNSW
+	}
+	if spec.indexType != IndexTypeFlat && spec.indexType != IndexTypeHNSW && spec.indexType != IndexTypeTiered {
+		return indexSpec{}, fmt.Errorf("%w: unsupported index type: %s", ErrInvalidArgument, spec.indexType)
+	}
+	return spec, nil
+}
+
+// useIndex makes queries from here on look up the index of spec
+func (qe *QueryExecutor) useIndex(spec indexSpec) {
+	qe.mu.Lock()
+	qe.indexType = spec.indexType
+	qe.hnswConfig = spec.hnsw
+	qe.mu.Unlock()
+	qe.settingsChanged()
+}
+
+// IndexStats returns the graph statistics of the HNSW index for unfiltered
+// nearest-neighbor searches of a collection, building it if needed. The
+// HNSW index is examined even while searches use another index type.
+func (qe *QueryExecutor) IndexStats(collection string, metric distance.Metric) (*hnsw.GraphStats, error) {
+	idx, err := qe.SearchIndex(RebuildOptions{Collection: collection, Metric: metric, IndexType: IndexTypeHNSW})
+	if err != nil {
+		return nil, err
+	}
+	
+	// Look through wrappers such as truncated search
+	for {
+		switch i := idx.(type) {
+		case *hnsw.HNSWIndex:
+			stats, err := i.GraphStats()
+			if err != nil {
+				return nil, err
+			}
+			return &stats, nil
+		case interface{ Unwrap() index.Index }:
+			idx = i.Unwrap()
+		default:
+			return nil, fmt.Errorf("%w: %s has no graph statistics", ErrUnsupportedOperation, idx.Name())
+		}
+	}
+}
+
 // executeInsert executes an INSERT query
-func (qe *QueryExecutor) executeInsert(node *parser.Node) (*ResultSet, error) {
+func (qe *QueryExecutor) executeInsert(ctx context.Context, node *parser.Node) (*ResultSet, error) {
 	// Get the collection name
 	if len(node.Children) == 0 || node.Children[0].Type != parser.NodeTable {
 		return nil, fmt.Errorf("%w: missing collection name", ErrInvalidQuery)
 	}
 	
+	collectionName := node.Children[0].Value
+	embeddedModel := ""
+	
 	// Get the columns and values
 	var columnsNode *parser.Node
 	var valuesNode *parser.Node
@@ -449,12 +1420,19 @@ func (qe *QueryExecutor) executeInsert(node *parser.Node) (*ResultSet, error) {
 				part = strings.TrimSpace(part)
 				val, err := strconv.ParseFloat(part, 32)
 				if err != nil {
-					return nil, fmt.Errorf("invalid vector value: %s", part)
+					return nil, fmt.Errorf("%w: invalid vector value: %s", ErrInvalidArgument, part)
 				}
 				vectorValues = append(vectorValues, float32(val))
 			}
 			
 			values[columnName] = vectorValues
+		case parser.NodeFunction:
+			vectorValues, model, err := qe.evaluateEmbedding(valueNode, collectionName, false)
+			if err != nil {
+				return nil, err
+			}
+			values[columnName] = vectorValues
+			embeddedModel = model
 		default:
 			values[columnName] = valueNode.Value
 		}
@@ -481,7 +1459,7 @@ func (qe *QueryExecutor) executeInsert(node *parser.Node) (*ResultSet, error) {
 					part = strings.TrimSpace(part)
 					val, err := strconv.ParseFloat(part, 32)
 					if err != nil {
-						return nil, fmt.Errorf("invalid vector value: %s", part)
+						return nil, fmt.Errorf("%w: invalid vector value: %s", ErrInvalidArgument, part)
 					}
 					vectorValues = append(vectorValues, float32(val))
 				}
@@ -497,26 +1475,37 @@ func (qe *QueryExecutor) executeInsert(node *parser.Node) (*ResultSet, error) {
 		return nil, fmt.Errorf("%w: missing vector values", ErrInvalidQuery)
 	}
 	
-	// Create and store the vector
+	// Create and store the vector, recording the model of embedded values
 	vec := vector.NewVector(id, vectorValues)
-	err := qe.store.Insert(vec)
+	if embeddedModel != "" {
+		vec.Metadata[embedding.MetadataKeyModel] = embeddedModel
+	}
+	vec, err := qe.adaptVector(vec)
+	if err != nil {
+		return nil, err
+	}
+	
+	if qe.dryRun {
+		// Report the conflict the insert would run into
+		if _, err := storage.WithContext(qe.store).GetCtx(ctx, id, storage.GetOptions{MetadataOnly: true}); err == nil {
+			return nil, fmt.Errorf("failed to insert vector: %w", storage.ErrVectorAlreadyExists)
+		}
+		return messageResult(fmt.Sprintf("Would insert 1 vector with ID '%s' (dry run)", id)), nil
+	}
+	
+	err = storage.WithContext(qe.store).InsertCtx(ctx, vec)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert vector: %w", err)
 	}
 	
 	// Create result set
-	return &ResultSet{
-		Columns: []Column{
-			{Name: "result", Type: "string"},
-		},
-		Rows: []Row{
-			{fmt.Sprintf("Inserted 1 vector with ID '%s'", id)},
-		},
-	}, nil
+	result := messageResult(fmt.Sprintf("Inserted 1 vector with ID '%s'", id))
+	result.Affected = 1
+	return result, nil
 }
 
 // executeDelete executes a DELETE query
-func (qe *QueryExecutor) executeDelete(node *parser.Node) (*ResultSet, error) {
+func (qe *QueryExecutor) executeDelete(ctx context.Context, node *parser.Node) (*ResultSet, error) {
 	// Get the collection name
 	if len(node.Children) == 0 || node.Children[0].Type != parser.NodeTable {
 		return nil, fmt.Errorf("%w: missing collection name", ErrInvalidQuery)
@@ -536,17 +1525,21 @@ func (qe *QueryExecutor) executeDelete(node *parser.Node) (*ResultSet, error) {
 		return nil, fmt.Errorf("%w: DELETE requires a WHERE clause", ErrInvalidQuery)
 	}
 	
-	// Get all vectors
-	ids, err := qe.store.List()
+	// Get the vectors the WHERE clause can match
+	ids, err := qe.candidateIDs(ctx, whereNode)
 	if err != nil {
 		return nil, err
 	}
 	
 	// Filter vectors based on WHERE clause
-	deletedCount := 0
+	store := storage.WithContext(qe.store)
+	matched := make([]string, 0)
 	for _, id := range ids {
-		vec, err := qe.store.Get(id)
+		vec, err := store.GetCtx(ctx, id, storage.GetOptions{})
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			continue
 		}
 		
@@ -556,23 +1549,78 @@ func (qe *QueryExecutor) executeDelete(node *parser.Node) (*ResultSet, error) {
 		}
 		
 		if matches {
-			err = qe.store.Delete(id)
-			if err != nil {
-				continue
-			}
-			deletedCount++
+			matched = append(matched, id)
 		}
 	}
 	
-	// Create result set
+	if qe.dryRun {
+		if returningCount(node) {
+			return countResult(len(matched)), nil
+		}
+		return messageResult(fmt.Sprintf("Would delete %d vectors (dry run)", len(matched))), nil
+	}
+	
+	deletedCount, err := qe.deleteVectors(ctx, matched)
+	if err != nil {
+		return nil, err
+	}
+	result := messageResult(fmt.Sprintf("Deleted %d vectors", deletedCount))
+	if returningCount(node) {
+		result = countResult(deletedCount)
+	}
+	result.Affected = deletedCount
+	return result, nil
+}
+
+// deleteVectors deletes vectors by ID and returns how many were deleted. It
+// stops once ctx is done.
+func (qe *QueryExecutor) deleteVectors(ctx context.Context, ids []string) (int, error) {
+	store := storage.WithContext(qe.store)
+	deleted := 0
+	for _, id := range ids {
+		if err := store.DeleteCtx(ctx, id); err != nil {
+			if ctx.Err() != nil {
+				return deleted, ctx.Err()
+			}
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// returningCount reports whether a statement ends with RETURNING COUNT
+func returningCount(node *parser.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeIdentifier && child.Value == "returning" {
+			return true
+		}
+	}
+	return false
+}
+
+// countResult returns a single count row, the result of RETURNING COUNT
+func countResult(count int) *ResultSet {
+	return &ResultSet{
+		Columns: []Column{
+			{Name: "count", Type: "int"},
+		},
+		Rows: []Row{
+			{count},
+		},
+	}
+}
+
+// messageResult returns a single result message
+func messageResult(message string) *ResultSet {
 	return &ResultSet{
 		Columns: []Column{
 			{Name: "result", Type: "string"},
 		},
 		Rows: []Row{
-			{fmt.Sprintf("Deleted %d vectors", deletedCount)},
+			{message},
 		},
-	}, nil
+	}
 }
 
 // executeCreate executes a CREATE COLLECTION query
@@ -591,7 +1639,7 @@ func (qe *QueryExecutor) executeCreate(node *parser.Node) (*ResultSet, error) {
 			if len(child.Children) > 0 && child.Children[0].Type == parser.NodeLiteral {
 				_, err := strconv.Atoi(child.Children[0].Value)
 				if err != nil {
-					return nil, fmt.Errorf("invalid dimension: %w", err)
+					return nil, fmt.Errorf("%w: invalid dimension: %v", ErrInvalidArgument, err)
 				}
 				// Dimension will be used in future implementation
 			}
@@ -613,7 +1661,7 @@ func (qe *QueryExecutor) executeCreate(node *parser.Node) (*ResultSet, error) {
 }
 
 // executeDrop executes a DROP COLLECTION query
-func (qe *QueryExecutor) executeDrop(node *parser.Node) (*ResultSet, error) {
+func (qe *QueryExecutor) executeDrop(ctx context.Context, node *parser.Node) (*ResultSet, error) {
 	// Get the collection name
 	if len(node.Children) == 0 || node.Children[0].Type != parser.NodeTable {
 		return nil, fmt.Errorf("%w: missing collection name", ErrInvalidQuery)
@@ -621,40 +1669,61 @@ func (qe *QueryExecutor) executeDrop(node *parser.Node) (*ResultSet, error) {
 	
 	collectionName := node.Children[0].Value
 	
+	if qe.denyDrop {
+		return nil, ErrDropDisabled
+	}
+	
+	// Dry runs only preview the drop and need no confirmation
+	confirmed := false
+	for _, child := range node.Children {
+		if child.Type == parser.NodeIdentifier && child.Value == "confirm" {
+			confirmed = true
+		}
+	}
+	if !confirmed && !qe.dryRun {
+		return nil, ErrConfirmationRequired
+	}
+	
 	// For now, dropping a collection would mean clearing all vectors
 	// This would be implemented differently when we have a multi-collection architecture
 	
 	// Get all vectors
-	ids, err := qe.store.List()
+	ids, err := storage.WithContext(qe.store).ListCtx(ctx, storage.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 	
-	// Delete all vectors
-	deletedCount := 0
-	for _, id := range ids {
-		err = qe.store.Delete(id)
-		if err != nil {
-			continue
+	if qe.dryRun {
+		if returningCount(node) {
+			return countResult(len(ids)), nil
 		}
-		deletedCount++
+		return messageResult(fmt.Sprintf("Would drop '%s' (%d vectors; dry run)", collectionName, len(ids))), nil
 	}
 	
-	// Create result set
-	return &ResultSet{
-		Columns: []Column{
-			{Name: "result", Type: "string"},
-		},
-		Rows: []Row{
-			{fmt.Sprintf("Dropped collection '%s' (%d vectors deleted)", collectionName, deletedCount)},
-		},
-	}, nil
+	// Delete all vectors
+	deletedCount, err := qe.deleteVectors(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := messageResult(fmt.Sprintf("Dropped collection '%s' (%d vectors deleted)", collectionName, deletedCount))
+	if returningCount(node) {
+		result = countResult(deletedCount)
+	}
+	result.Affected = deletedCount
+	return result, nil
 }
 
 // evaluateWhereCondition evaluates a WHERE condition for a vector
 func (qe *QueryExecutor) evaluateWhereCondition(condNode *parser.Node, vec *vector.Vector, collectionName string) (bool, error) {
 	switch condNode.Type {
 	case parser.NodeBinaryOp:
+		if match, ok, err := evaluateTimestampCondition(condNode, vec); ok {
+			return match, err
+		}
+		if match, ok, err := evaluateGeoCondition(condNode, vec); ok {
+			return match, err
+		}
+		
 		switch strings.ToUpper(condNode.Value) {
 		case "AND":
 			left, err := qe.evaluateWhereCondition(condNode.Children[0], vec, collectionName)
@@ -731,7 +1800,7 @@ func (qe *QueryExecutor) evaluateWhereCondition(condNode *parser.Node, vec *vect
 					// Compile and match the regex
 					regex, err := regexp.Compile(regexPattern)
 					if err != nil {
-						return false, fmt.Errorf("invalid LIKE pattern: %w", err)
+						return false, fmt.Errorf("%w: invalid LIKE pattern: %v", ErrInvalidArgument, err)
 					}
 					
 					return regex.MatchString(vec.ID), nil
@@ -749,21 +1818,60 @@ func (qe *QueryExecutor) evaluateWhereCondition(condNode *parser.Node, vec *vect
 					// Compile and match the regex
 					regex, err := regexp.Compile(regexPattern)
 					if err != nil {
-						return false, fmt.Errorf("invalid LIKE pattern: %w", err)
+						return false, fmt.Errorf("%w: invalid LIKE pattern: %v", ErrInvalidArgument, err)
 					}
 					
 					actualValue, exists := vec.Metadata[metadataKey]
 					return exists && regex.MatchString(actualValue), nil
 				}
 			}
-			return false, fmt.Errorf("LIKE operator currently only supports ID and metadata columns")
+			return false, fmt.Errorf("%w: LIKE operator currently only supports ID and metadata columns", ErrUnsupportedOperation)
 		}
 		
-		return false, fmt.Errorf("unsupported operator: %s", condNode.Value)
+		return false, fmt.Errorf("%w: operator %s", ErrUnsupportedOperation, condNode.Value)
 		
 	default:
-		return false, fmt.Errorf("unsupported node type in WHERE clause: %v", condNode.Type)
+		return false, fmt.Errorf("%w: incomplete or unsupported WHERE condition", ErrInvalidQuery)
+	}
+}
+
+// candidateIDs returns the IDs of the vectors a WHERE clause can match in
+// order. A
+// clause requiring an ID prefix with id LIKE 'prefix%' only lists the IDs
+// with that prefix; the clause still has to be evaluated on each of them.
+func (qe *QueryExecutor) candidateIDs(ctx context.Context, whereNode *parser.Node) ([]string, error) {
+	opts := storage.ListOptions{}
+	if whereNode != nil && len(whereNode.Children) > 0 {
+		opts.Prefix = idPrefix(whereNode.Children[0])
+	}
+	return storage.WithContext(qe.store).ListCtx(ctx, opts)
+}
+
+// idPrefix returns the prefix every ID matching a condition starts with, or
+// "" if the condition does not require one. It is found in id LIKE patterns
+// up to their first wildcard, on their own or in an AND.
+func idPrefix(condNode *parser.Node) string {
+	if condNode.Type != parser.NodeBinaryOp || len(condNode.Children) != 2 {
+		return ""
+	}
+	switch strings.ToUpper(condNode.Value) {
+	case "AND":
+		if prefix := idPrefix(condNode.Children[0]); prefix != "" {
+			return prefix
+		}
+		return idPrefix(condNode.Children[1])
+	case "LIKE":
+		left, right := condNode.Children[0], condNode.Children[1]
+		if left.Type != parser.NodeIdentifier || strings.ToLower(left.Value) != "id" || right.Type != parser.NodeLiteral {
+			return ""
+		}
+		pattern := strings.Trim(right.Value, "'\"")
+		if i := strings.IndexAny(pattern, "%_"); i >= 0 {
+			return pattern[:i]
+		}
+		return pattern
 	}
+	return ""
 }
 
 // convertLikeToRegex converts a SQL LIKE pattern to a Go regex pattern
@@ -0,0 +1,101 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/sql/planner"
+)
+
+// searchTrace collects what EXPLAIN ANALYZE reports about a search
+type searchTrace struct {
+	searched bool                // Whether a nearest-neighbor search ran
+	filtered int                 // Vectors the WHERE clause excluded before searching
+	stats    index.SearchStats   // Work of the search
+	results  index.SearchResults // Results in the order returned
+}
+
+// explainColumns are the columns of EXPLAIN ANALYZE. The first counters are
+// the work done when the result was first reached, the total_ ones the work
+// of the whole search.
+var explainColumns = []Column{
+	{Name: "id", Type: "string"},
+	{Name: "distance", Type: "float"},
+	{Name: "distance_computations", Type: "int"},
+	{Name: "hops", Type: "int"},
+	{Name: "visited", Type: "int"},
+	{Name: "total_distance_computations", Type: "int"},
+	{Name: "total_hops", Type: "int"},
+	{Name: "total_visited", Type: "int"},
+	{Name: "filter_pruned", Type: "bool"},
+}
+
+// executeExplain executes EXPLAIN, which shows the plan of a SELECT, and
+// EXPLAIN ANALYZE, which runs a nearest-neighbor search and reports the work
+// it took to find each result
+func (qe *QueryExecutor) executeExplain(ctx context.Context, node *parser.Node) (*ResultSet, error) {
+	if len(node.Children) != 1 {
+		return nil, fmt.Errorf("%w: EXPLAIN needs a SELECT", ErrInvalidQuery)
+	}
+	statement := node.Children[0]
+	if node.Value != "ANALYZE" {
+		return qe.explainPlan(statement)
+	}
+
+	trace := &searchTrace{}
+	if _, err := qe.executeSelect(ctx, statement, trace); err != nil {
+		return nil, err
+	}
+	if !trace.searched {
+		return nil, fmt.Errorf("%w: EXPLAIN ANALYZE needs a SELECT with NEAREST TO", ErrInvalidQuery)
+	}
+
+	total := trace.stats.SearchCounters
+	rows := make([]Row, 0, len(trace.results))
+	for _, result := range trace.results {
+		found := trace.stats.Found[result.ID]
+		rows = append(rows, Row{
+			result.ID, result.Distance,
+			found.DistanceComputations, found.Hops, found.Visited,
+			total.DistanceComputations, total.Hops, total.Visited,
+			trace.filtered > 0,
+		})
+	}
+	return &ResultSet{Columns: explainColumns, Rows: rows}, nil
+}
+
+// explainPlan returns the plan of a SELECT, one line per row
+func (qe *QueryExecutor) explainPlan(statement *parser.Node) (*ResultSet, error) {
+	statement, err := qe.rewrite(statement)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := selectHints(statement); err != nil {
+		return nil, err
+	}
+
+	// The planner needs the collection that USE chose for SELECTs without FROM
+	hasFrom := false
+	for _, child := range statement.Children {
+		hasFrom = hasFrom || child.Type == parser.NodeFrom
+	}
+	if collection, ok := qe.setting(SettingCollection); ok && !hasFrom {
+		from := &parser.Node{Type: parser.NodeFrom, Children: []*parser.Node{{Type: parser.NodeTable, Value: collection}}}
+		statement = &parser.Node{Type: statement.Type, Value: statement.Value, Children: append(append([]*parser.Node(nil), statement.Children...), from)}
+	}
+
+	qp := planner.NewQueryPlanner()
+	plan, err := qp.CreatePlan(statement)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+
+	rows := []Row{}
+	for _, line := range strings.Split(strings.TrimRight(qp.DisplayPlan(plan), "\n"), "\n") {
+		rows = append(rows, Row{line})
+	}
+	return &ResultSet{Columns: []Column{{Name: "plan", Type: "string"}}, Rows: rows}, nil
+}
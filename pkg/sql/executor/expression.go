@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// arithmeticOperators are the operators of ORDER BY expressions
+var arithmeticOperators = map[string]bool{"+": true, "-": true, "*": true, "/": true, "%": true}
+
+// isExpressionOrder reports whether an ORDER BY clause orders by an
+// arithmetic expression rather than a column or SCORE()
+func isExpressionOrder(orderNode *parser.Node) bool {
+	if orderNode == nil || len(orderNode.Children) == 0 {
+		return false
+	}
+	key := orderNode.Children[0]
+	return key.Type == parser.NodeBinaryOp || key.Type == parser.NodeLiteral
+}
+
+// expressionRow is the row an expression is evaluated over. Its vector is
+// only read if the expression needs more than the distance.
+type expressionRow struct {
+	result   index.SearchResult
+	searched bool
+	vec      *vector.Vector
+}
+
+// meta returns the vector of the row without its values
+func (row *expressionRow) meta(store storage.VectorStore) (*vector.Vector, error) {
+	if row.vec == nil {
+		vec, err := storage.GetMeta(store, row.result.ID)
+		if err != nil {
+			return nil, err
+		}
+		row.vec = vec
+	}
+	return row.vec, nil
+}
+
+// evaluateArithmetic evaluates an expression of numbers, + - * / % and the
+// columns distance, dimension, created_at and updated_at (in Unix seconds)
+// and metadata.<key>. Missing or non-numeric values count as 0.
+func (qe *QueryExecutor) evaluateArithmetic(node *parser.Node, row *expressionRow) (float64, error) {
+	switch node.Type {
+	case parser.NodeLiteral:
+		f, err := strconv.ParseFloat(strings.Trim(node.Value, "'\""), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: expected a number in ORDER BY, got %s", ErrInvalidArgument, node.Value)
+		}
+		return f, nil
+
+	case parser.NodeIdentifier:
+		return qe.arithmeticColumn(node.Value, row)
+
+	case parser.NodeBinaryOp:
+		if !arithmeticOperators[node.Value] {
+			break
+		}
+		left, err := qe.evaluateArithmetic(node.Children[0], row)
+		if err != nil {
+			return 0, err
+		}
+		if len(node.Children) == 1 {
+			if node.Value == "-" {
+				return -left, nil
+			}
+			if node.Value == "+" {
+				return left, nil
+			}
+			break
+		}
+		right, err := qe.evaluateArithmetic(node.Children[1], row)
+		if err != nil {
+			return 0, err
+		}
+		switch node.Value {
+		case "+":
+			return left + right, nil
+		case "-":
+			return left - right, nil
+		case "*":
+			return left * right, nil
+		}
+		if right == 0 {
+			return 0, fmt.Errorf("%w: division by zero in ORDER BY", ErrInvalidArgument)
+		}
+		if node.Value == "/" {
+			return left / right, nil
+		}
+		return math.Mod(left, right), nil
+	}
+	return 0, fmt.Errorf("%w: ORDER BY expressions support numbers, columns and + - * / %%, not %s", ErrUnsupportedOperation, node.Value)
+}
+
+// arithmeticColumn returns the value of a column in an ORDER BY expression
+func (qe *QueryExecutor) arithmeticColumn(column string, row *expressionRow) (float64, error) {
+	if strings.EqualFold(column, "distance") {
+		if !row.searched {
+			return 0, fmt.Errorf("%w: ORDER BY distance needs NEAREST TO", ErrInvalidQuery)
+		}
+		return float64(row.result.Distance), nil
+	}
+	if isAccessColumn(column) {
+		return qe.accessOrderKey(column, row.result.ID), nil
+	}
+	if !strings.EqualFold(column, "dimension") && !isTimestampColumn(column) && !strings.HasPrefix(strings.ToLower(column), "metadata.") {
+		return 0, fmt.Errorf("%w: cannot ORDER BY %s", ErrInvalidQuery, column)
+	}
+
+	vec, err := row.meta(qe.store)
+	if err != nil {
+		return 0, err
+	}
+	if strings.EqualFold(column, "dimension") {
+		return float64(vec.Dimension), nil
+	}
+	if t, ok := timestampColumn(column, vec); ok {
+		if t.IsZero() {
+			return 0, nil
+		}
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+	f, err := strconv.ParseFloat(vec.Metadata[column[len("metadata."):]], 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, nil
+	}
+	return f, nil
+}
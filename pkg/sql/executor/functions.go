@@ -25,7 +25,7 @@ func (f *CountFunction) Name() string {
 
 func (f *CountFunction) Eval(args []interface{}) (interface{}, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("COUNT() requires 1 argument, got %d", len(args))
+		return nil, fmt.Errorf("%w: COUNT() requires 1 argument, got %d", ErrInvalidArgument, len(args))
 	}
 	
 	// For COUNT(*), we use a special case
@@ -44,18 +44,19 @@ func (f *CountFunction) Eval(args []interface{}) (interface{}, error) {
 
 // EmbeddingFunction implements EMBEDDING() function for text-to-vector conversion
 type EmbeddingFunction struct {
-	service *embedding.Service
+	registry *embedding.Registry
 }
 
 func NewEmbeddingFunction() (*EmbeddingFunction, error) {
-	service, err := embedding.NewService(nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create embedding service: %w", err)
-	}
-	
+	return NewEmbeddingFunctionWithRegistry(embedding.NewRegistry()), nil
+}
+
+// NewEmbeddingFunctionWithRegistry creates an EMBEDDING() function that
+// resolves model names through the given registry
+func NewEmbeddingFunctionWithRegistry(registry *embedding.Registry) *EmbeddingFunction {
 	return &EmbeddingFunction{
-		service: service,
-	}, nil
+		registry: registry,
+	}
 }
 
 func (f *EmbeddingFunction) Name() string {
@@ -63,21 +64,34 @@ func (f *EmbeddingFunction) Name() string {
 }
 
 func (f *EmbeddingFunction) Eval(args []interface{}) (interface{}, error) {
-	if len(args) < 1 {
-		return nil, fmt.Errorf("EMBEDDING() requires at least 1 argument, got %d", len(args))
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("%w: EMBEDDING() requires 1 or 2 arguments, got %d", ErrInvalidArgument, len(args))
 	}
 	
 	// First argument should be the text to embed
 	text, ok := args[0].(string)
 	if !ok {
-		return nil, fmt.Errorf("EMBEDDING() first argument must be a string, got %T", args[0])
+		return nil, fmt.Errorf("%w: EMBEDDING() first argument must be a string, got %T", ErrInvalidArgument, args[0])
+	}
+	
+	// Optional second argument is a logical model name from the registry
+	modelName := f.registry.Default()
+	if len(args) == 2 {
+		name, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: EMBEDDING() second argument must be a string, got %T", ErrInvalidArgument, args[1])
+		}
+		modelName = name
 	}
 	
-	// Optional second argument can be model name (not implemented yet)
+	service, err := f.registry.Service(modelName)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Create a document and embed it
 	doc := embedding.NewTextDocument("_query_", text)
-	if err := f.service.ProcessDocument(doc); err != nil {
+	if err := service.ProcessDocument(doc); err != nil {
 		return nil, fmt.Errorf("failed to embed text: %w", err)
 	}
 	
@@ -85,8 +99,8 @@ func (f *EmbeddingFunction) Eval(args []interface{}) (interface{}, error) {
 }
 
 func (f *EmbeddingFunction) Close() error {
-	if f.service != nil {
-		return f.service.Close()
+	if f.registry != nil {
+		return f.registry.Close()
 	}
 	return nil
 }
@@ -111,7 +125,7 @@ func GetFunction(name string) (SqlFunction, bool) {
 func EvaluateFunction(name string, args []interface{}) (interface{}, error) {
 	function, ok := GetFunction(name)
 	if !ok {
-		return nil, fmt.Errorf("unknown function: %s", name)
+		return nil, fmt.Errorf("%w: unknown function: %s", ErrUnsupportedOperation, name)
 	}
 	
 	return function.Eval(args)
@@ -0,0 +1,158 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+// FunctionGeoDist is the great-circle distance in kilometers between the
+// location in a vector's metadata and a point: GEO_DIST(metadata.loc, lat,
+// lon) for "lat,lon" values, or GEO_DIST(metadata.lat, metadata.lon, lat,
+// lon) for separate keys
+const FunctionGeoDist = "GEO_DIST"
+
+// flippedOperators are the comparisons with their operands swapped
+var flippedOperators = map[string]string{
+	"<": ">", "<=": ">=", ">": "<", ">=": "<=", "=": "=", "!=": "!=", "<>": "<>",
+}
+
+// isGeoDist reports whether node is a GEO_DIST() call
+func isGeoDist(node *parser.Node) bool {
+	return node.Type == parser.NodeFunction && strings.ToUpper(node.Value) == FunctionGeoDist
+}
+
+// evaluateGeoCondition evaluates comparisons of GEO_DIST() with a distance
+// such as 10km, 500m or 3mi; plain numbers are kilometers. ok is false for
+// other conditions. Vectors without a valid location never match.
+func evaluateGeoCondition(condNode *parser.Node, vec *vector.Vector) (match bool, ok bool, err error) {
+	if len(condNode.Children) != 2 {
+		return false, false, nil
+	}
+	op, fn, limitNode := condNode.Value, condNode.Children[0], condNode.Children[1]
+	if !isGeoDist(fn) {
+		op, fn, limitNode = flippedOperators[op], limitNode, fn
+		if !isGeoDist(fn) {
+			return false, false, nil
+		}
+	}
+	if op == "" {
+		return false, true, fmt.Errorf("%w: %s cannot compare %s()", ErrUnsupportedOperation, condNode.Value, FunctionGeoDist)
+	}
+
+	limit, err := parseDistanceLiteral(limitNode)
+	if err != nil {
+		return false, true, err
+	}
+	dist, found, err := geoDistance(fn, vec)
+	if err != nil || !found {
+		return false, true, err
+	}
+
+	switch op {
+	case "<":
+		return dist < limit, true, nil
+	case "<=":
+		return dist <= limit, true, nil
+	case ">":
+		return dist > limit, true, nil
+	case ">=":
+		return dist >= limit, true, nil
+	case "=":
+		return dist == limit, true, nil
+	default:
+		return dist != limit, true, nil
+	}
+}
+
+// geoDistance evaluates a GEO_DIST() call for a vector. found is false when
+// the vector has no valid location.
+func geoDistance(fn *parser.Node, vec *vector.Vector) (km float64, found bool, err error) {
+	args := fn.Children
+	if len(args) != 3 && len(args) != 4 {
+		return 0, false, fmt.Errorf("%w: %s() takes a location key or latitude and longitude keys, then a latitude and a longitude", ErrInvalidArgument, FunctionGeoDist)
+	}
+
+	keys := make([]string, len(args)-2)
+	for i := range keys {
+		key, ok := metadataKey(args[i])
+		if !ok {
+			return 0, false, fmt.Errorf("%w: %s() argument %d must be a metadata.<key> column", ErrInvalidArgument, FunctionGeoDist, i+1)
+		}
+		keys[i] = key
+	}
+	lat, err := numberLiteral(args[len(args)-2])
+	if err != nil {
+		return 0, false, err
+	}
+	lon, err := numberLiteral(args[len(args)-1])
+	if err != nil {
+		return 0, false, err
+	}
+	if err := distance.ValidGeoPoint(lat, lon); err != nil {
+		return 0, false, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+
+	var vecLat, vecLon float64
+	if len(keys) == 1 {
+		if vecLat, vecLon, err = distance.ParseGeoPoint(vec.Metadata[keys[0]]); err != nil {
+			return 0, false, nil
+		}
+	} else {
+		var latErr, lonErr error
+		vecLat, latErr = strconv.ParseFloat(vec.Metadata[keys[0]], 64)
+		vecLon, lonErr = strconv.ParseFloat(vec.Metadata[keys[1]], 64)
+		if latErr != nil || lonErr != nil || distance.ValidGeoPoint(vecLat, vecLon) != nil {
+			return 0, false, nil
+		}
+	}
+	return distance.HaversineKm(vecLat, vecLon, lat, lon), true, nil
+}
+
+// metadataKey returns the key of a metadata.<key> column
+func metadataKey(node *parser.Node) (string, bool) {
+	if node.Type != parser.NodeIdentifier || !strings.HasPrefix(strings.ToLower(node.Value), "metadata.") {
+		return "", false
+	}
+	return node.Value[len("metadata."):], true
+}
+
+// numberLiteral returns the value of a number, which may be negated
+func numberLiteral(node *parser.Node) (float64, error) {
+	sign := 1.0
+	if node.Type == parser.NodeBinaryOp && len(node.Children) == 1 && (node.Value == "-" || node.Value == "+") {
+		if node.Value == "-" {
+			sign = -1
+		}
+		node = node.Children[0]
+	}
+	if node.Type == parser.NodeLiteral {
+		if f, err := strconv.ParseFloat(strings.Trim(node.Value, "'\""), 64); err == nil {
+			return sign * f, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: expected a number, got %s", ErrInvalidArgument, node.Value)
+}
+
+// parseDistanceLiteral returns a distance such as 10km, 500m or 3mi in
+// kilometers. Numbers without a unit are kilometers.
+func parseDistanceLiteral(node *parser.Node) (float64, error) {
+	if node.Type == parser.NodeLiteral {
+		value := node.Value
+		scale := 1.0
+		for _, unit := range []string{"km", "mi", "m"} {
+			if strings.HasSuffix(value, unit) {
+				value, scale = strings.TrimSuffix(value, unit), parser.DistanceUnits[unit]
+				break
+			}
+		}
+		if d, err := strconv.ParseFloat(value, 64); err == nil && d >= 0 {
+			return d * scale, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: expected a distance such as 10km, 500m or 3mi, got %s", ErrInvalidArgument, node.Value)
+}
@@ -0,0 +1,63 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+const (
+	// HintIndex searches with the index type given as its argument, e.g.
+	// INDEX(flat), instead of the configured one
+	HintIndex = "INDEX"
+
+	// HintNoCache answers the query without the result and index caches
+	HintNoCache = "NO_CACHE"
+)
+
+// queryHints are the hints of a SELECT, in /*+ ... */ after SELECT
+type queryHints struct {
+	indexType IndexType
+	noCache   bool
+}
+
+// selectHints returns the hints of a SELECT. Unknown hints are errors rather
+// than ignored, so a typo does not silently change nothing.
+func selectHints(node *parser.Node) (queryHints, error) {
+	var hints queryHints
+	for _, child := range node.Children {
+		if child.Type != parser.NodeHint {
+			continue
+		}
+		switch child.Value {
+		case HintIndex:
+			if len(child.Children) != 1 {
+				return queryHints{}, fmt.Errorf("%w: %s takes one index type", ErrInvalidArgument, HintIndex)
+			}
+			indexType := IndexType(strings.ToLower(child.Children[0].Value))
+			if indexType != IndexTypeFlat && indexType != IndexTypeHNSW && indexType != IndexTypeTiered {
+				return queryHints{}, fmt.Errorf("%w: unsupported index type: %s", ErrInvalidArgument, indexType)
+			}
+			hints.indexType = indexType
+		case HintNoCache:
+			if len(child.Children) != 0 {
+				return queryHints{}, fmt.Errorf("%w: %s takes no arguments", ErrInvalidArgument, HintNoCache)
+			}
+			hints.noCache = true
+		default:
+			return queryHints{}, fmt.Errorf("%w: unknown hint %s", ErrInvalidArgument, child.Value)
+		}
+	}
+	return hints, nil
+}
+
+// hasHint reports whether a SELECT has the hint name
+func hasHint(node *parser.Node, name string) bool {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeHint && child.Value == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,420 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/fileutil"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/tiered"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// maxRebuildPasses bounds how often a rebuild starts over because the store
+// changed while it was building
+const maxRebuildPasses = 3
+
+var (
+	// ErrStoreChanged is returned when writes kept a rebuilt index stale
+	ErrStoreChanged = errs.New(errs.Aborted, "store changed during index rebuild")
+
+	// ErrIndexMismatch is returned when an installed index was not built
+	// from the vectors of the store
+	ErrIndexMismatch = errs.New(errs.FailedPrecondition, "index does not match the store")
+
+	// unsafeFileChars matches characters not used in index file names
+	unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+)
+
+// indexSpec describes an index to build
+type indexSpec struct {
+	collection string
+	metric     distance.Metric
+	indexType  IndexType
+	hnsw       *hnsw.HNSWConfig // Nil for the defaults
+}
+
+// indexKey identifies a cached index
+type indexKey struct {
+	collection string
+	metric     distance.MetricType
+	indexType  IndexType
+	variant    string // Truncation and two-stage settings the index was built with
+}
+
+// fileName returns the base name of the key's index file
+func (k indexKey) fileName() string {
+	name := fmt.Sprintf("%s-%s-%s", unsafeFileChars.ReplaceAllString(k.collection, "_"), k.metric, k.indexType)
+	if k.variant != "" {
+		sum := sha256.Sum256([]byte(k.variant))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+	return name
+}
+
+// info describes the key
+func (k indexKey) info() IndexInfo {
+	return IndexInfo{Collection: k.collection, Metric: string(k.metric), Type: k.indexType}
+}
+
+// indexMeta is stored next to a persisted index and tells whether the
+// index still matches the store
+type indexMeta struct {
+	Fingerprint string `json:"fingerprint"`
+	Vectors     int    `json:"vectors"`
+}
+
+// IndexInfo describes an index held by an IndexCache
+type IndexInfo struct {
+	Collection string    `json:"collection"`
+	Metric     string    `json:"metric"`
+	Type       IndexType `json:"type"`
+	Vectors    int       `json:"vectors"`
+	BuiltAt    time.Time `json:"built_at"`
+	Rebuilding bool      `json:"rebuilding"`
+
+	Tiers *tiered.Stats `json:"tiers,omitempty"` // Tiers of tiered indexes
+}
+
+// cachedIndex is a built index and one vector per embedding model recorded
+// in it, which stand in for all vectors when checking query models
+type cachedIndex struct {
+	index   index.Index
+	models  []*vector.Vector
+	vectors int
+	builtAt time.Time
+}
+
+// IndexCache keeps the indexes built for unfiltered nearest-neighbor
+// searches, keyed by collection, metric and index type, so repeated queries
+// do not rebuild them. Writes through the executor invalidate the cache;
+// callers that write to the store directly call Invalidate. With a
+// directory, indexes are also saved there and reused by later processes as
+// long as the store has not changed.
+type IndexCache struct {
+	mu         sync.Mutex
+	dir        string
+	indexes    map[indexKey]*cachedIndex
+	rebuilding map[indexKey]bool
+	generation uint64 // Incremented by Invalidate
+	readOnly   bool   // Persisted indexes are loaded but never saved
+}
+
+// NewIndexCache creates an index cache that persists indexes in dir. An
+// empty dir keeps them in memory only.
+func NewIndexCache(dir string) *IndexCache {
+	return &IndexCache{
+		dir:        dir,
+		indexes:    make(map[indexKey]*cachedIndex),
+		rebuilding: make(map[indexKey]bool),
+	}
+}
+
+// SetReadOnly makes the cache load the indexes persisted in its directory,
+// e.g. by the process that writes a shared data directory, without saving
+// the ones it builds
+func (c *IndexCache) SetReadOnly(readOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readOnly = readOnly
+}
+
+// Invalidate drops all cached indexes. Persisted indexes are checked
+// against the store before reuse and need no invalidation.
+func (c *IndexCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexes = make(map[indexKey]*cachedIndex)
+	c.generation++
+}
+
+// Len returns the number of indexes held in memory
+func (c *IndexCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.indexes)
+}
+
+// Indexes describes the indexes held in memory and those being rebuilt
+func (c *IndexCache) Indexes() []IndexInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	infos := make([]IndexInfo, 0, len(c.indexes))
+	for key, cached := range c.indexes {
+		info := key.info()
+		info.Vectors = cached.vectors
+		info.BuiltAt = cached.builtAt
+		info.Rebuilding = c.rebuilding[key]
+		if idx, ok := cached.index.(*tiered.Index); ok {
+			stats := idx.Stats()
+			info.Tiers = &stats
+		}
+		infos = append(infos, info)
+	}
+	for key := range c.rebuilding {
+		if _, ok := c.indexes[key]; !ok {
+			info := key.info()
+			info.Rebuilding = true
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		a, b := infos[i], infos[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		if a.Metric != b.Metric {
+			return a.Metric < b.Metric
+		}
+		return a.Type < b.Type
+	})
+	return infos
+}
+
+// get returns the cached index for key, loading it from disk or building it
+// over every vector in the store with newIndex
+func (c *IndexCache) get(key indexKey, store storage.VectorStore, newIndex func() (index.Index, error)) (*cachedIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.indexes[key]; ok {
+		return cached, nil
+	}
+
+	vectors, err := allVectors(store)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := newIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint := fingerprintVectors(vectors)
+	if !c.load(key, idx, fingerprint) {
+		if err := idx.Build(vectors); err != nil {
+			return nil, fmt.Errorf("failed to build index: %w", err)
+		}
+		// A failed save only costs a rebuild in the next process
+		_ = c.save(key, idx, indexMeta{Fingerprint: fingerprint, Vectors: len(vectors)})
+	}
+
+	cached := newCachedIndex(idx, vectors)
+	c.indexes[key] = cached
+	return cached, nil
+}
+
+// rebuild builds the index for key from the store without blocking
+// readers, who keep using the current index until the new one replaces it.
+// A build that overlaps a write is stale and starts over.
+func (c *IndexCache) rebuild(key indexKey, store storage.VectorStore, newIndex func() (index.Index, error)) (*IndexInfo, error) {
+	c.mu.Lock()
+	c.rebuilding[key] = true
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.rebuilding, key)
+		c.mu.Unlock()
+	}()
+
+	for pass := 0; pass < maxRebuildPasses; pass++ {
+		c.mu.Lock()
+		generation := c.generation
+		c.mu.Unlock()
+
+		vectors, err := allVectors(store)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := newIndex()
+		if err != nil {
+			return nil, err
+		}
+		if err := idx.Build(vectors); err != nil {
+			return nil, fmt.Errorf("failed to build index: %w", err)
+		}
+
+		c.mu.Lock()
+		if c.generation != generation {
+			c.mu.Unlock()
+			continue
+		}
+		cached := newCachedIndex(idx, vectors)
+		c.indexes[key] = cached
+		_ = c.save(key, idx, indexMeta{Fingerprint: fingerprintVectors(vectors), Vectors: len(vectors)})
+		c.mu.Unlock()
+
+		info := key.info()
+		info.Vectors = cached.vectors
+		info.BuiltAt = cached.builtAt
+		return &info, nil
+	}
+	return nil, ErrStoreChanged
+}
+
+// install loads the index for key with load instead of building it, e.g.
+// from a bundle built elsewhere, and swaps it in. The index must hold as
+// many vectors as the store.
+func (c *IndexCache) install(key indexKey, store storage.VectorStore, newIndex func() (index.Index, error), load func(index.Index) error) (*IndexInfo, error) {
+	vectors, err := allVectors(store)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := newIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err := load(idx); err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if idx.Size() != len(vectors) {
+		return nil, fmt.Errorf("%w: index holds %d vectors, store holds %d", ErrIndexMismatch, idx.Size(), len(vectors))
+	}
+
+	c.mu.Lock()
+	cached := newCachedIndex(idx, vectors)
+	c.indexes[key] = cached
+	c.mu.Unlock()
+
+	info := key.info()
+	info.Vectors = cached.vectors
+	info.BuiltAt = cached.builtAt
+	return &info, nil
+}
+
+// newCachedIndex wraps an index built from vectors
+func newCachedIndex(idx index.Index, vectors []*vector.Vector) *cachedIndex {
+	return &cachedIndex{
+		index:   idx,
+		models:  modelSamples(vectors),
+		vectors: len(vectors),
+		builtAt: time.Now().UTC(),
+	}
+}
+
+// load reads a persisted index if it was built from the same vectors
+func (c *IndexCache) load(key indexKey, idx index.Index, fingerprint string) bool {
+	if c.dir == "" {
+		return false
+	}
+
+	base := filepath.Join(c.dir, key.fileName())
+	data, err := os.ReadFile(base + ".json")
+	if err != nil {
+		return false
+	}
+	var meta indexMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Fingerprint != fingerprint {
+		return false
+	}
+	return idx.Load(base+".idx") == nil
+}
+
+// save persists an index and its metadata. The metadata is written last, so
+// an interrupted save is never mistaken for a valid index (caller must hold
+// c.mu).
+func (c *IndexCache) save(key indexKey, idx index.Index, meta indexMeta) error {
+	if c.dir == "" || c.readOnly {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	base := filepath.Join(c.dir, key.fileName())
+	os.Remove(base + ".json")
+	if err := idx.Save(base + ".idx"); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFile(base+".json", data, 0644)
+}
+
+// allVectors reads every vector in the store, ordered by ID
+func allVectors(store storage.VectorStore) ([]*vector.Vector, error) {
+	ids, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+
+	vectors := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		vec, err := store.Get(id)
+		if err != nil {
+			continue
+		}
+		vectors = append(vectors, vec)
+	}
+	return vectors, nil
+}
+
+// fingerprintVectors hashes the IDs, values and metadata of vectors ordered
+// by ID
+func fingerprintVectors(vectors []*vector.Vector) string {
+	hash := sha256.New()
+	var buf [4]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(s)))
+		hash.Write(buf[:])
+		hash.Write([]byte(s))
+	}
+
+	for _, v := range vectors {
+		writeString(v.ID)
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(v.Values)))
+		hash.Write(buf[:])
+		for _, val := range v.Values {
+			binary.LittleEndian.PutUint32(buf[:], math.Float32bits(val))
+			hash.Write(buf[:])
+		}
+
+		keys := make([]string, 0, len(v.Metadata))
+		for key := range v.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		binary.LittleEndian.PutUint32(buf[:], uint32(len(keys)))
+		hash.Write(buf[:])
+		for _, key := range keys {
+			writeString(key)
+			writeString(v.Metadata[key])
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// modelSamples returns the first vector recorded with each embedding model
+func modelSamples(vectors []*vector.Vector) []*vector.Vector {
+	seen := make(map[string]bool)
+	var samples []*vector.Vector
+	for _, v := range vectors {
+		model := v.Metadata[embedding.MetadataKeyModel]
+		if model != "" && !seen[model] {
+			seen[model] = true
+			samples = append(samples, v)
+		}
+	}
+	return samples
+}
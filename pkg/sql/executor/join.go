@@ -0,0 +1,204 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+// TableDocs is the table of the documents stored by the embed command,
+// which a SELECT can JOIN to its vectors by ID
+const TableDocs = "docs"
+
+// docColumns are the columns of the docs table besides metadata.<key>
+var docColumns = map[string]bool{
+	"id": true, "content": true, "content_type": true, "created_at": true, "updated_at": true, "version": true,
+}
+
+// SetDocsDir sets the directory of the documents stored by the embed
+// command, which JOIN docs reads. Empty disables JOIN.
+func (qe *QueryExecutor) SetDocsDir(dir string) {
+	qe.docsDir = dir
+	qe.settingsChanged()
+}
+
+// docColumn is a projected column of the docs table
+type docColumn struct {
+	position int    // Index among the columns of the result
+	field    string // Column of the docs table
+	name     string // Name in the result: the field unless aliased
+}
+
+// joinDocs rewrites a SELECT with JOIN docs d ON d.id = v.id into one over
+// the vectors alone that also selects their ID first, and wraps stream to
+// fill in the document columns of each row. Rows without a document are
+// left out.
+func (qe *QueryExecutor) joinDocs(node, joinNode *parser.Node, stream *Stream) (*parser.Node, *Stream, error) {
+	if !strings.EqualFold(joinNode.Value, TableDocs) {
+		return nil, nil, fmt.Errorf("%w: JOIN only supports the %s table of the document store, not %s", ErrUnsupportedOperation, TableDocs, joinNode.Value)
+	}
+	if qe.docsDir == "" {
+		return nil, nil, fmt.Errorf("%w: JOIN %s needs a document store", ErrUnsupportedOperation, TableDocs)
+	}
+
+	docPrefixes := tablePrefixes(joinNode.Children[0])
+	var vecPrefixes []string
+	for _, child := range node.Children {
+		if child.Type == parser.NodeFrom && len(child.Children) > 0 {
+			vecPrefixes = tablePrefixes(child.Children[0])
+		}
+	}
+	if !joinedOnID(joinNode.Children[1], docPrefixes, vecPrefixes) {
+		return nil, nil, fmt.Errorf("%w: JOIN %s must be ON %sid = <vectors>.id", ErrUnsupportedOperation, TableDocs, docPrefixes[len(docPrefixes)-1])
+	}
+
+	// The vectors are selected by the ID, then the columns of the query
+	rewritten := &parser.Node{Type: node.Type, Value: node.Value, Children: []*parser.Node{{Type: parser.NodeIdentifier, Value: "id"}}}
+	var docs []docColumn
+	position := 0
+	for _, child := range node.Children {
+		switch child.Type {
+		case parser.NodeJoin:
+			continue
+		case parser.NodeColumn:
+			if child.Value == "COUNT(*)" {
+				return nil, nil, fmt.Errorf("%w: COUNT(*) with JOIN", ErrUnsupportedOperation)
+			}
+			position++
+		case parser.NodeIdentifier, parser.NodeAlias:
+			column := child
+			if child.Type == parser.NodeAlias && len(child.Children) > 0 {
+				column = child.Children[0]
+			}
+			if field, ok := stripPrefix(column.Value, docPrefixes); ok && column.Type == parser.NodeIdentifier {
+				if !docColumns[strings.ToLower(field)] && !strings.HasPrefix(strings.ToLower(field), "metadata.") {
+					return nil, nil, fmt.Errorf("%w: %s has no column %s", ErrInvalidQuery, TableDocs, field)
+				}
+				name := field
+				if child.Type == parser.NodeAlias {
+					name = child.Value
+				}
+				docs = append(docs, docColumn{position: position, field: field, name: name})
+				rewritten.Children = append(rewritten.Children, child)
+				position++
+				continue
+			}
+			position++
+		}
+		stripped, err := stripTablePrefix(child, vecPrefixes, docPrefixes)
+		if err != nil {
+			return nil, nil, err
+		}
+		rewritten.Children = append(rewritten.Children, stripped)
+	}
+
+	joined := &Stream{
+		Columns: func(columns []Column) error {
+			columns = columns[1:]
+			for _, column := range docs {
+				columns[column.position].Name = column.name
+			}
+			return stream.Columns(columns)
+		},
+		Row: func(row Row) error {
+			id, _ := row[0].(string)
+			doc, err := embedding.LoadDocument(qe.docsDir, id)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			row = row[1:]
+			for _, column := range docs {
+				row[column.position] = documentColumn(doc, column.field)
+			}
+			return stream.Row(row)
+		},
+	}
+	return rewritten, joined, nil
+}
+
+// documentColumn returns the value of a column of the docs table
+func documentColumn(doc *embedding.Document, field string) interface{} {
+	switch strings.ToLower(field) {
+	case "id":
+		return doc.ID
+	case "content":
+		return doc.Text()
+	case "content_type":
+		return string(doc.ContentType)
+	case "created_at":
+		return formatTimestamp(doc.CreatedAt)
+	case "updated_at":
+		return formatTimestamp(doc.UpdatedAt)
+	case "version":
+		return doc.Version
+	}
+	value, _ := doc.GetMetadata(field[len("metadata."):])
+	return value
+}
+
+// tablePrefixes returns the prefixes that qualify the columns of a table:
+// its name and its alias, if it has one
+func tablePrefixes(table *parser.Node) []string {
+	prefixes := []string{table.Value + "."}
+	for _, child := range table.Children {
+		if child.Type == parser.NodeAlias {
+			prefixes = append(prefixes, child.Value+".")
+		}
+	}
+	return prefixes
+}
+
+// stripPrefix returns column without the first of prefixes it starts with
+func stripPrefix(column string, prefixes []string) (string, bool) {
+	for _, prefix := range prefixes {
+		if len(column) > len(prefix) && strings.EqualFold(column[:len(prefix)], prefix) {
+			return column[len(prefix):], true
+		}
+	}
+	return column, false
+}
+
+// joinedOnID reports whether condition is <docs>.id = <vectors>.id, in
+// either order. The ID of the vectors may be unqualified.
+func joinedOnID(condition *parser.Node, docPrefixes, vecPrefixes []string) bool {
+	if condition.Type != parser.NodeBinaryOp || condition.Value != "=" || len(condition.Children) != 2 {
+		return false
+	}
+	isID := func(node *parser.Node, prefixes []string, qualified bool) bool {
+		if node.Type != parser.NodeIdentifier {
+			return false
+		}
+		column, ok := stripPrefix(node.Value, prefixes)
+		return (ok || !qualified) && strings.EqualFold(column, "id")
+	}
+	left, right := condition.Children[0], condition.Children[1]
+	return (isID(left, docPrefixes, true) && isID(right, vecPrefixes, false)) ||
+		(isID(right, docPrefixes, true) && isID(left, vecPrefixes, false))
+}
+
+// stripTablePrefix returns a copy of node whose columns of the vectors are
+// unqualified. Columns of the docs table are only allowed in the column list.
+func stripTablePrefix(node *parser.Node, vecPrefixes, docPrefixes []string) (*parser.Node, error) {
+	copied := &parser.Node{Type: node.Type, Value: node.Value}
+	if node.Type == parser.NodeIdentifier {
+		if _, ok := stripPrefix(node.Value, docPrefixes); ok {
+			return nil, fmt.Errorf("%w: columns of %s can only be selected, got %s", ErrUnsupportedOperation, TableDocs, node.Value)
+		}
+		copied.Value, _ = stripPrefix(node.Value, vecPrefixes)
+	}
+	for _, child := range node.Children {
+		stripped, err := stripTablePrefix(child, vecPrefixes, docPrefixes)
+		if err != nil {
+			return nil, err
+		}
+		copied.Children = append(copied.Children, stripped)
+	}
+	return copied, nil
+}
@@ -0,0 +1,161 @@
+package executor
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrMemoryBudget is returned by queries aborted for needing more memory
+// than their budget, or than is left of the budget of all queries
+var ErrMemoryBudget = errs.New(errs.ResourceExhausted, "memory budget exceeded")
+
+const (
+	// stringBytes is what a string takes besides its bytes
+	stringBytes = 16
+
+	// vectorBytes is what a vector takes besides its values, ID and metadata
+	vectorBytes = 64
+
+	// valueBytes is what a column value other than a string or vector takes
+	valueBytes = 16
+)
+
+// MemoryStats describes the memory queries hold and how many were aborted
+type MemoryStats struct {
+	InUse        int64  `json:"in_use"`        // Bytes held by running queries
+	Peak         int64  `json:"peak"`          // Most bytes held at once
+	QueryBudget  int64  `json:"query_budget"`  // Bytes a query may hold, 0 if unlimited
+	GlobalBudget int64  `json:"global_budget"` // Bytes all queries may hold, 0 if unlimited
+	Aborted      uint64 `json:"aborted"`       // Queries aborted for exceeding a budget
+}
+
+// MemoryAccountant tracks the memory SELECT queries allocate for candidate
+// sets, result rows and the indexes built for filtered searches. A query
+// that would exceed its budget, or the budget of all running queries, is
+// aborted with ErrMemoryBudget instead of running the process out of
+// memory. Sizes are estimates, and indexes cached across queries are not
+// counted. One accountant can be shared by every executor of a process.
+type MemoryAccountant struct {
+	queryBudget  int64
+	globalBudget int64
+
+	mu      sync.Mutex
+	inUse   int64
+	peak    int64
+	aborted uint64
+}
+
+// NewMemoryAccountant creates an accountant giving each query up to
+// queryBudget bytes and all queries together up to globalBudget. Zero
+// leaves a budget unlimited.
+func NewMemoryAccountant(queryBudget, globalBudget int64) *MemoryAccountant {
+	return &MemoryAccountant{queryBudget: queryBudget, globalBudget: globalBudget}
+}
+
+// Stats returns the memory held by queries and the budgets
+func (a *MemoryAccountant) Stats() MemoryStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return MemoryStats{
+		InUse:        a.inUse,
+		Peak:         a.peak,
+		QueryBudget:  a.queryBudget,
+		GlobalBudget: a.globalBudget,
+		Aborted:      a.aborted,
+	}
+}
+
+// begin starts accounting the memory of a query. A nil accountant returns
+// a nil queryMemory, which accounts nothing.
+func (a *MemoryAccountant) begin() *queryMemory {
+	if a == nil {
+		return nil
+	}
+	return &queryMemory{accountant: a}
+}
+
+// queryMemory is the memory held by one query
+type queryMemory struct {
+	accountant *MemoryAccountant
+	used       int64
+}
+
+// reserve accounts bytes more for what the query allocates, or returns
+// ErrMemoryBudget if that exceeds a budget
+func (m *queryMemory) reserve(bytes int64, what string) error {
+	if m == nil {
+		return nil
+	}
+	a := m.accountant
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.queryBudget > 0 && m.used+bytes > a.queryBudget {
+		a.aborted++
+		return fmt.Errorf("%w: %s need more than the query budget of %s", ErrMemoryBudget, what, formatMemory(a.queryBudget))
+	}
+	if a.globalBudget > 0 && a.inUse+bytes > a.globalBudget {
+		a.aborted++
+		return fmt.Errorf("%w: %s need more than is left of the %s of all queries", ErrMemoryBudget, what, formatMemory(a.globalBudget))
+	}
+	m.used += bytes
+	a.inUse += bytes
+	if a.inUse > a.peak {
+		a.peak = a.inUse
+	}
+	return nil
+}
+
+// release gives back everything the query reserved, once it is done
+func (m *queryMemory) release() {
+	if m == nil {
+		return
+	}
+	a := m.accountant
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.inUse -= m.used
+	m.used = 0
+}
+
+// idsMemory estimates the memory of a candidate set of IDs
+func idsMemory(ids []string) int64 {
+	bytes := int64(0)
+	for _, id := range ids {
+		bytes += stringBytes + int64(len(id))
+	}
+	return bytes
+}
+
+// vectorMemory estimates the memory of a vector loaded from the store
+func vectorMemory(vec *vector.Vector) int64 {
+	bytes := vectorBytes + 4*int64(len(vec.Values)) + int64(len(vec.ID))
+	for key, value := range vec.Metadata {
+		bytes += 2*stringBytes + int64(len(key)+len(value))
+	}
+	return bytes
+}
+
+// rowMemory estimates the memory of a result row
+func rowMemory(row Row) int64 {
+	bytes := int64(0)
+	for _, value := range row {
+		switch v := value.(type) {
+		case string:
+			bytes += stringBytes + int64(len(v))
+		case []float32:
+			bytes += valueBytes + 4*int64(len(v))
+		default:
+			bytes += valueBytes
+		}
+	}
+	return bytes
+}
+
+// formatMemory formats a number of bytes in MB
+func formatMemory(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+}
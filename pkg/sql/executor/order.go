@@ -0,0 +1,121 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// orderKey is the value ORDER BY compares for a row. Numbers compare as
+// numbers and sort before everything else, which compares as strings.
+type orderKey struct {
+	str     string
+	num     float64
+	numeric bool
+}
+
+// less reports whether k sorts before other
+func (k orderKey) less(other orderKey) bool {
+	if k.numeric != other.numeric {
+		return k.numeric
+	}
+	if k.numeric {
+		return k.num < other.num
+	}
+	return k.str < other.str
+}
+
+// orderResults sorts rows by an ORDER BY clause. Rows with equal values keep
+// their order, which is by distance for searches and by ID otherwise, so the
+// result is the same on every run.
+func (qe *QueryExecutor) orderResults(results index.SearchResults, orderNode *parser.Node, searched bool) error {
+	if orderNode == nil || len(orderNode.Children) == 0 {
+		return nil
+	}
+	if orderNode.Children[0].Type == parser.NodeFunction {
+		return fmt.Errorf("%w: ORDER BY SCORE() needs NEAREST TO", ErrInvalidQuery)
+	}
+	column := orderNode.Children[0].Value
+	expression := isExpressionOrder(orderNode)
+
+	keys := make([]orderKey, len(results))
+	for i, result := range results {
+		if expression {
+			num, err := qe.evaluateArithmetic(orderNode.Children[0], &expressionRow{result: result, searched: searched})
+			if err != nil {
+				return err
+			}
+			keys[i] = orderKey{num: num, numeric: true}
+			continue
+		}
+		key, err := qe.orderKey(column, result, searched)
+		if err != nil {
+			return err
+		}
+		keys[i] = key
+	}
+
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+	desc := orderNode.Value == "DESC"
+	sort.SliceStable(order, func(a, b int) bool {
+		if desc {
+			return keys[order[b]].less(keys[order[a]])
+		}
+		return keys[order[a]].less(keys[order[b]])
+	})
+
+	sorted := make(index.SearchResults, len(results))
+	for i, j := range order {
+		sorted[i] = results[j]
+	}
+	copy(results, sorted)
+	return nil
+}
+
+// orderKey returns the value of column that a row is ordered by
+func (qe *QueryExecutor) orderKey(column string, result index.SearchResult, searched bool) (orderKey, error) {
+	switch strings.ToLower(column) {
+	case "id":
+		return orderKey{str: result.ID}, nil
+	case "distance":
+		if !searched {
+			return orderKey{}, fmt.Errorf("%w: ORDER BY distance needs NEAREST TO", ErrInvalidQuery)
+		}
+		return orderKey{num: float64(result.Distance), numeric: true}, nil
+	}
+	if isAccessColumn(column) {
+		return orderKey{num: qe.accessOrderKey(column, result.ID), numeric: true}, nil
+	}
+
+	if !strings.EqualFold(column, "dimension") && !isTimestampColumn(column) && !strings.HasPrefix(strings.ToLower(column), "metadata.") {
+		return orderKey{}, fmt.Errorf("%w: cannot ORDER BY %s", ErrInvalidQuery, column)
+	}
+	vec, err := storage.GetMeta(qe.store, result.ID)
+	if err != nil {
+		return orderKey{}, err
+	}
+	if strings.EqualFold(column, "dimension") {
+		return orderKey{num: float64(vec.Dimension), numeric: true}, nil
+	}
+	if t, ok := timestampColumn(column, vec); ok {
+		// Vectors without a timestamp sort first
+		var num float64
+		if !t.IsZero() {
+			num = float64(t.UnixNano())
+		}
+		return orderKey{num: num, numeric: true}, nil
+	}
+
+	// Metadata values that are numbers sort numerically
+	value := vec.Metadata[column[len("metadata."):]]
+	num, err := strconv.ParseFloat(value, 64)
+	return orderKey{str: value, num: num, numeric: err == nil}, nil
+}
@@ -0,0 +1,115 @@
+package executor
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+// cachedPlan is a parsed statement template and the key it was parsed for
+type cachedPlan struct {
+	key      string
+	template *parser.Template
+}
+
+// PlanCacheStats describes the hit rate of a PlanCache
+type PlanCacheStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // Hits of all lookups, 0 before the first
+	Entries int     `json:"entries"`
+}
+
+// PlanCache keeps the parses of recent statements, keyed by the statement
+// normalized with its literals parameterized out. Statements differing
+// only in their literals, as those of a templated query, skip parsing.
+// Plans depend on nothing but the statement, so they never go stale and
+// one cache can be shared by every executor.
+type PlanCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // Most recently used first
+	entries map[string]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// NewPlanCache creates a cache of up to size plans
+func NewPlanCache(size int) *PlanCache {
+	return &PlanCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Stats returns the cache's hits, misses and size
+func (c *PlanCache) Stats() PlanCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := PlanCacheStats{Hits: c.hits, Misses: c.misses, Entries: c.lru.Len()}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRate = float64(c.hits) / float64(lookups)
+	}
+	return stats
+}
+
+// get returns the template cached for key
+func (c *PlanCache) get(key string) (*parser.Template, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedPlan).template, true
+}
+
+// put caches the template of key, evicting the least recently used plan if
+// full
+func (c *PlanCache) put(key string, template *parser.Template) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+	if e, ok := c.entries[key]; ok {
+		e.Value = &cachedPlan{key: key, template: template}
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cachedPlan{key: key, template: template})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedPlan).key)
+	}
+}
+
+// parse parses query, reusing the plan of an earlier statement with the
+// same template. Statements that cannot be parameterized, or fail to parse,
+// are parsed as written, so their errors name their own literals.
+func (c *PlanCache) parse(query string) (*parser.Node, error) {
+	statement, err := parser.Parameterize(query)
+	if err != nil {
+		return parser.Parse(query)
+	}
+	template, ok := c.get(statement.Key)
+	if !ok {
+		if template, err = statement.Prepare(); err != nil {
+			return parser.Parse(query)
+		}
+		c.put(statement.Key, template)
+	}
+	ast, err := template.Bind(statement)
+	if err != nil {
+		return parser.Parse(query)
+	}
+	return ast, nil
+}
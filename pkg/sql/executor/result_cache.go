@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cachedResult is a SELECT result and the store epoch it was read at
+type cachedResult struct {
+	query  string
+	epoch  uint64
+	result *ResultSet
+}
+
+// ResultCacheStats describes the hit rate of a ResultCache
+type ResultCacheStats struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // Hits of all lookups, 0 before the first
+	Entries int     `json:"entries"`
+}
+
+// ResultCache keeps the results of recent SELECT statements, keyed by the
+// normalized statement and the epoch of the store they were read from. Any
+// write to the store advances its epoch, so stale results are never served.
+// Only stores that report an epoch (see storage.StoreEpoch) are cached.
+type ResultCache struct {
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // Most recently used first
+	entries map[string]*list.Element
+	hits    uint64
+	misses  uint64
+}
+
+// NewResultCache creates a cache of up to size results
+func NewResultCache(size int) *ResultCache {
+	return &ResultCache{
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Clear drops all cached results, e.g. after search settings changed
+func (c *ResultCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Stats returns the cache's hits, misses and size
+func (c *ResultCache) Stats() ResultCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := ResultCacheStats{Hits: c.hits, Misses: c.misses, Entries: c.lru.Len()}
+	if lookups := c.hits + c.misses; lookups > 0 {
+		stats.HitRate = float64(c.hits) / float64(lookups)
+	}
+	return stats
+}
+
+// get returns a copy of the result of query if it was read at epoch
+func (c *ResultCache) get(query string, epoch uint64) (*ResultSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[query]
+	if !ok || e.Value.(*cachedResult).epoch != epoch {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(e)
+	return copyResult(e.Value.(*cachedResult).result), true
+}
+
+// put caches the result of query read at epoch, evicting the least recently
+// used result if full
+func (c *ResultCache) put(query string, epoch uint64, result *ResultSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+	entry := &cachedResult{query: query, epoch: epoch, result: copyResult(result)}
+	if e, ok := c.entries[query]; ok {
+		e.Value = entry
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[query] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).query)
+	}
+}
+
+// copyResult copies a result set so callers cannot change cached rows
+func copyResult(result *ResultSet) *ResultSet {
+	rows := make([]Row, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = append(Row(nil), row...)
+	}
+	return &ResultSet{Columns: append([]Column(nil), result.Columns...), Rows: rows, Affected: result.Affected}
+}
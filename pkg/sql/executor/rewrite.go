@@ -0,0 +1,261 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+// maxMacroDepth bounds the expansion of macros used by other macros, so a
+// macro that uses itself is an error rather than a hang
+const maxMacroDepth = 16
+
+// executeCreateMacro executes CREATE MACRO
+func (qe *QueryExecutor) executeCreateMacro(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: CREATE MACRO needs a catalog", ErrUnsupportedOperation)
+	}
+	if err := qe.catalog.CreateMacro(node.Value, node.Children[1].Value); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Created macro '%s'", node.Value)), nil
+}
+
+// executeDropMacro executes DROP MACRO
+func (qe *QueryExecutor) executeDropMacro(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: %s", ErrMacroNotFound, node.Value)
+	}
+	if err := qe.catalog.DropMacro(node.Value); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Dropped macro '%s'", node.Value)), nil
+}
+
+// executeCreateRule executes CREATE RULE
+func (qe *QueryExecutor) executeCreateRule(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: CREATE RULE needs a catalog", ErrUnsupportedOperation)
+	}
+	rule := Rule{Name: node.Value, Table: node.Children[0].Value}
+	for _, child := range node.Children[1:] {
+		switch child.Type {
+		case parser.NodeWhere:
+			rule.Where = child.Children[1].Value
+		case parser.NodeLimit:
+			limit, err := strconv.Atoi(child.Value)
+			if err != nil || limit <= 0 {
+				return nil, fmt.Errorf("%w: rule LIMIT must be a positive integer", ErrInvalidArgument)
+			}
+			rule.Limit = limit
+		}
+	}
+	if err := qe.catalog.CreateRule(rule); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Created rule '%s'", node.Value)), nil
+}
+
+// executeDropRule executes DROP RULE
+func (qe *QueryExecutor) executeDropRule(node *parser.Node) (*ResultSet, error) {
+	if qe.catalog == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, node.Value)
+	}
+	if err := qe.catalog.DropRule(node.Value); err != nil {
+		return nil, err
+	}
+	qe.settingsChanged()
+	return messageResult(fmt.Sprintf("Dropped rule '%s'", node.Value)), nil
+}
+
+// rewrite applies the catalog to a parsed SELECT before it is planned: the
+// rules of the table it reads are applied, a view is expanded into its
+// collection, whose rules and the rules of every table are then applied,
+// and macros in its conditions are replaced by their conditions
+func (qe *QueryExecutor) rewrite(node *parser.Node) (*parser.Node, error) {
+	if qe.catalog == nil {
+		return node, nil
+	}
+	table := fromTable(node)
+	if table == "" {
+		table, _ = qe.setting(SettingCollection)
+	}
+
+	var err error
+	if _, ok := qe.catalog.View(table); ok {
+		if node, err = qe.applyRules(node, table, false); err != nil {
+			return nil, err
+		}
+		if node, err = qe.expandView(node); err != nil {
+			return nil, err
+		}
+		table = fromTable(node)
+	}
+	if node, err = qe.applyRules(node, table, true); err != nil {
+		return nil, err
+	}
+	return qe.expandMacros(node)
+}
+
+// applyRules applies the rules of table, and with all also the rules of
+// every table, to a SELECT: their conditions are added to its WHERE and
+// their limits cap its LIMIT. COUNT(*) and CENTROID() are not limited.
+func (qe *QueryExecutor) applyRules(node *parser.Node, table string, all bool) (*parser.Node, error) {
+	for _, rule := range qe.catalog.Rules() {
+		if !strings.EqualFold(rule.Table, table) && !(all && rule.Table == "*") {
+			continue
+		}
+		if rule.Where != "" {
+			condition, err := parseCondition(rule.Where)
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule %s: %w", rule.Name, err)
+			}
+			node = andWhere(node, condition)
+		}
+		if rule.Limit > 0 && !selectsCount(node) && !selectsCentroids(node) {
+			node = capLimit(node, rule.Limit)
+		}
+	}
+	return node, nil
+}
+
+// parseCondition parses the text of a stored condition
+func parseCondition(text string) (*parser.Node, error) {
+	statement, err := parser.Parse("SELECT id FROM vectors WHERE " + text)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range statement.Children {
+		if child.Type == parser.NodeWhere {
+			return child.Children[0], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no condition in %q", ErrInvalidQuery, text)
+}
+
+// andWhere returns a copy of a SELECT whose WHERE also holds condition
+func andWhere(node *parser.Node, condition *parser.Node) *parser.Node {
+	rewritten := &parser.Node{Type: node.Type, Value: node.Value}
+	added := false
+	for _, child := range node.Children {
+		if child.Type == parser.NodeWhere && !added {
+			both := &parser.Node{Type: parser.NodeBinaryOp, Value: "AND", Children: []*parser.Node{condition, child.Children[0]}}
+			child = &parser.Node{Type: parser.NodeWhere, Children: []*parser.Node{both}}
+			added = true
+		}
+		rewritten.Children = append(rewritten.Children, child)
+	}
+	if !added {
+		rewritten.Children = append(rewritten.Children, &parser.Node{Type: parser.NodeWhere, Children: []*parser.Node{condition}})
+	}
+	return rewritten
+}
+
+// capLimit returns a copy of a SELECT whose LIMIT is at most limit.
+// Searches without a LIMIT return 10 rows, and scans every row.
+func capLimit(node *parser.Node, limit int) *parser.Node {
+	current, search := -1, false
+	for _, child := range node.Children {
+		switch child.Type {
+		case parser.NodeLimit:
+			current, _ = strconv.Atoi(child.Value)
+		case parser.NodeNearestTo:
+			search = true
+		}
+	}
+	if current < 0 && search {
+		current = 10
+	}
+	if current >= 0 && current <= limit {
+		return node
+	}
+
+	capped := &parser.Node{Type: parser.NodeLimit, Value: strconv.Itoa(limit)}
+	rewritten := &parser.Node{Type: node.Type, Value: node.Value}
+	for _, child := range node.Children {
+		if child.Type != parser.NodeLimit {
+			rewritten.Children = append(rewritten.Children, child)
+		}
+	}
+	rewritten.Children = append(rewritten.Children, capped)
+	return rewritten
+}
+
+// selectsCount reports whether a SELECT projects COUNT(*)
+func selectsCount(node *parser.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeColumn && child.Value == "COUNT(*)" {
+			return true
+		}
+	}
+	return false
+}
+
+// expandMacros returns a copy of a SELECT whose WHERE and BOOST conditions
+// have each macro replaced by its condition
+func (qe *QueryExecutor) expandMacros(node *parser.Node) (*parser.Node, error) {
+	rewritten := &parser.Node{Type: node.Type, Value: node.Value, Children: make([]*parser.Node, len(node.Children))}
+	for i, child := range node.Children {
+		switch child.Type {
+		case parser.NodeWhere:
+			condition, err := qe.expandCondition(child.Children[0], 0)
+			if err != nil {
+				return nil, err
+			}
+			child = &parser.Node{Type: child.Type, Children: []*parser.Node{condition}}
+		case parser.NodeNearestTo:
+			nearest := &parser.Node{Type: child.Type, Value: child.Value}
+			for _, clause := range child.Children {
+				if clause.Type == parser.NodeBoost {
+					condition, err := qe.expandCondition(clause.Children[0], 0)
+					if err != nil {
+						return nil, err
+					}
+					clause = &parser.Node{Type: clause.Type, Value: clause.Value, Children: []*parser.Node{condition, clause.Children[1]}}
+				}
+				nearest.Children = append(nearest.Children, clause)
+			}
+			child = nearest
+		}
+		rewritten.Children[i] = child
+	}
+	return rewritten, nil
+}
+
+// expandCondition replaces the macros a condition uses, alone or combined
+// with AND, OR and !, by their conditions
+func (qe *QueryExecutor) expandCondition(condition *parser.Node, depth int) (*parser.Node, error) {
+	switch condition.Type {
+	case parser.NodeIdentifier:
+		text, ok := qe.catalog.Macro(condition.Value)
+		if !ok {
+			return condition, nil
+		}
+		if depth >= maxMacroDepth {
+			return nil, fmt.Errorf("%w: macro %s uses macros more than %d deep", ErrInvalidQuery, condition.Value, maxMacroDepth)
+		}
+		expanded, err := parseCondition(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid macro %s: %w", condition.Value, err)
+		}
+		return qe.expandCondition(expanded, depth+1)
+	case parser.NodeBinaryOp:
+		if condition.Value != "AND" && condition.Value != "OR" && condition.Value != "!" {
+			return condition, nil
+		}
+		expanded := &parser.Node{Type: condition.Type, Value: condition.Value, Children: make([]*parser.Node, len(condition.Children))}
+		for i, child := range condition.Children {
+			var err error
+			if expanded.Children[i], err = qe.expandCondition(child, depth); err != nil {
+				return nil, err
+			}
+		}
+		return expanded, nil
+	}
+	return condition, nil
+}
@@ -0,0 +1,151 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// ColumnScore is the SCORE() of a result ordered by one, or its distance
+	ColumnScore = "score"
+
+	// defaultHalfLife is how long recency takes to halve unless set
+	defaultHalfLife = 24 * time.Hour
+
+	// scoreCandidates is how many times the limit SCORE(), ORDER BY
+	// expressions and BOOST rerank, so vectors just beyond the nearest ones
+	// can move up
+	scoreCandidates = 4
+)
+
+// scoreSpec is a SCORE() of ORDER BY: a distance-like score blending
+// similarity with recency, where lower is better
+type scoreSpec struct {
+	weight   float64       // Share of recency in the score, 0 to 1
+	halfLife time.Duration // Age at which recency is 0.5
+	field    string        // Timestamp column recency is measured on
+}
+
+// parseHalfLife parses a duration such as 12h, 90m or 7d
+func parseHalfLife(value string) (time.Duration, error) {
+	value = strings.Trim(value, "'\"")
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n float64
+		n, err = strconv.ParseFloat(days, 64)
+		d = time.Duration(n * float64(24*time.Hour))
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("half-life must be a positive duration such as 12h or 7d, got %q", value)
+	}
+	return d, nil
+}
+
+// scoreOrder returns the SCORE() of an ORDER BY clause, or nil if it orders
+// by a column
+func (qe *QueryExecutor) scoreOrder(orderNode *parser.Node) (*scoreSpec, error) {
+	if orderNode == nil || len(orderNode.Children) == 0 || orderNode.Children[0].Type != parser.NodeFunction {
+		return nil, nil
+	}
+
+	spec := &scoreSpec{halfLife: defaultHalfLife, field: ColumnUpdatedAt}
+	if value, ok := qe.setting(SettingRecencyHalfLife); ok {
+		spec.halfLife, _ = parseHalfLife(value)
+	}
+	for _, option := range orderNode.Children[0].Children[1:] {
+		value := strings.Trim(option.Children[0].Value, "'\"")
+		switch option.Value {
+		case "recency":
+			w, err := strconv.ParseFloat(value, 64)
+			if err != nil || w < 0 || w > 1 {
+				return nil, fmt.Errorf("%w: recency weight must be between 0 and 1, got %s", ErrInvalidArgument, value)
+			}
+			spec.weight = w
+		case "half_life":
+			halfLife, err := parseHalfLife(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+			}
+			spec.halfLife = halfLife
+		case "field":
+			if !isTimestampColumn(value) && !strings.HasPrefix(strings.ToLower(value), "metadata.") {
+				return nil, fmt.Errorf("%w: recency is measured on created_at, updated_at or a metadata.<key> time, not %s", ErrInvalidArgument, value)
+			}
+			spec.field = value
+		default:
+			return nil, fmt.Errorf("%w: unknown SCORE option %s: use recency, half_life or field", ErrInvalidArgument, option.Value)
+		}
+	}
+	return spec, nil
+}
+
+// hasScoreOrder reports whether a SELECT is ordered by SCORE()
+func hasScoreOrder(node *parser.Node) bool {
+	for _, child := range node.Children {
+		if child.Type == parser.NodeOrderBy && len(child.Children) > 0 && child.Children[0].Type == parser.NodeFunction {
+			return true
+		}
+	}
+	return false
+}
+
+// recency returns 1 for a vector written now, halving every half-life. Vectors
+// without a time have no recency.
+func (s *scoreSpec) recency(vec *vector.Vector, now time.Time) float64 {
+	t, ok := timestampColumn(s.field, vec)
+	if !ok {
+		parsed, err := storage.ParseTime(vec.Metadata[s.field[len("metadata."):]])
+		if err != nil {
+			return 0
+		}
+		t = parsed
+	}
+	if t.IsZero() {
+		return 0
+	}
+	age := now.Sub(t)
+	if age < 0 {
+		age = 0
+	}
+	return math.Exp2(-float64(age) / float64(s.halfLife))
+}
+
+// rankByScore sorts search results by their score, best first unless desc,
+// and returns the score of each
+func (qe *QueryExecutor) rankByScore(results index.SearchResults, spec *scoreSpec, metric distance.MetricType, desc bool) (map[string]float64, error) {
+	now := time.Now()
+	scores := make(map[string]float64, len(results))
+	for _, result := range results {
+		recency := 0.0
+		if spec.weight > 0 {
+			vec, err := storage.GetMeta(qe.store, result.ID)
+			if err != nil {
+				return nil, err
+			}
+			recency = spec.recency(vec, now)
+		}
+		similarity := float64(distance.Similarity(metric, result.Distance))
+		scores[result.ID] = (1-spec.weight)*(1-similarity) + spec.weight*(1-recency)
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		if desc {
+			return scores[results[a].ID] > scores[results[b].ID]
+		}
+		return scores[results[a].ID] < scores[results[b].ID]
+	})
+	return scores, nil
+}
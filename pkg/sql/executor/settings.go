@@ -0,0 +1,214 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/sql/parser"
+)
+
+// Settings changed at runtime with SET
+const (
+	// SettingEfSearch is the HNSW candidate list size of searches
+	SettingEfSearch = "ef_search"
+
+	// SettingDefaultMetric is the metric of searches without USING whose
+	// collection has no metric of its own
+	SettingDefaultMetric = "default_metric"
+
+	// SettingCollection is the collection of SELECTs without FROM, set with USE
+	SettingCollection = "collection"
+
+	// SettingVerbose makes the CLI print execution times with results
+	SettingVerbose = "verbose"
+
+	// SettingRecencyHalfLife is the half-life of the recency of ORDER BY
+	// SCORE() without a half_life of its own
+	SettingRecencyHalfLife = "recency_half_life"
+)
+
+// settingParsers validate the value of each known setting and return it in
+// canonical form
+var settingParsers = map[string]func(string) (string, error){
+	SettingEfSearch: func(value string) (string, error) {
+		ef, err := strconv.Atoi(value)
+		if err != nil || ef < 1 {
+			return "", fmt.Errorf("%s must be a positive integer, got %q", SettingEfSearch, value)
+		}
+		return strconv.Itoa(ef), nil
+	},
+	SettingDefaultMetric: func(value string) (string, error) {
+		metric, err := distance.GetMetric(distance.MetricType(strings.ToLower(value)))
+		if err != nil {
+			return "", err
+		}
+		return string(metric.Name()), nil
+	},
+	SettingCollection: func(value string) (string, error) {
+		return value, nil
+	},
+	SettingRecencyHalfLife: func(value string) (string, error) {
+		halfLife, err := parseHalfLife(value)
+		if err != nil {
+			return "", err
+		}
+		return halfLife.String(), nil
+	},
+	SettingVerbose: func(value string) (string, error) {
+		switch strings.ToLower(value) {
+		case "on":
+			return "true", nil
+		case "off":
+			return "false", nil
+		}
+		verbose, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be on or off, got %q", SettingVerbose, value)
+		}
+		return strconv.FormatBool(verbose), nil
+	},
+}
+
+// Settings holds tunables changed at runtime with SET. Executors share one
+// Settings for SET GLOBAL; a session's own Settings take precedence over it.
+type Settings struct {
+	mu     sync.RWMutex
+	values map[string]string
+}
+
+// NewSettings creates an empty set of settings
+func NewSettings() *Settings {
+	return &Settings{values: make(map[string]string)}
+}
+
+// Set validates and stores a setting. An empty value removes it, so the
+// default applies again.
+func (s *Settings) Set(name, value string) error {
+	parse, ok := settingParsers[name]
+	if !ok {
+		return fmt.Errorf("%w: unknown setting %q", ErrInvalidArgument, name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if value == "" {
+		delete(s.values, name)
+		return nil
+	}
+	value, err := parse(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	s.values[name] = value
+	return nil
+}
+
+// Get returns a setting and whether it is set
+func (s *Settings) Get(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.values[name]
+	return value, ok
+}
+
+// All returns a copy of the settings that are set
+func (s *Settings) All() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := make(map[string]string, len(s.values))
+	for name, value := range s.values {
+		values[name] = value
+	}
+	return values
+}
+
+// setting returns a setting of the executor's session, or the global one
+func (qe *QueryExecutor) setting(name string) (string, bool) {
+	if qe.session != nil {
+		if value, ok := qe.session.Get(name); ok {
+			return value, true
+		}
+	}
+	return qe.settings.Get(name)
+}
+
+// settingsKey describes the settings in effect, so results computed with
+// other settings are told apart
+func (qe *QueryExecutor) settingsKey() string {
+	names := make([]string, 0, len(settingParsers))
+	for name := range settingParsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		if value, ok := qe.setting(name); ok {
+			fmt.Fprintf(&sb, "%s=%s;", name, value)
+		}
+	}
+	return sb.String()
+}
+
+// efSearch returns the ef_search setting, or 0 to use the index's
+func (qe *QueryExecutor) efSearch() int {
+	value, _ := qe.setting(SettingEfSearch)
+	ef, _ := strconv.Atoi(value)
+	return ef
+}
+
+// Setting returns a setting in effect for the executor and whether it is set
+func (qe *QueryExecutor) Setting(name string) (string, bool) {
+	return qe.setting(name)
+}
+
+// executeUse executes USE name, setting the session's collection
+func (qe *QueryExecutor) executeUse(node *parser.Node) (*ResultSet, error) {
+	if qe.session == nil {
+		return nil, fmt.Errorf("%w: no session to change; name the collection with FROM", ErrUnsupportedOperation)
+	}
+	if err := qe.session.Set(SettingCollection, node.Value); err != nil {
+		return nil, err
+	}
+	return &ResultSet{
+		Columns: []Column{{Name: "setting", Type: "string"}, {Name: "value", Type: "string"}},
+		Rows:    []Row{{SettingCollection, node.Value}},
+	}, nil
+}
+
+// executeSet executes SET [SESSION | GLOBAL] name = value. SET without a
+// scope changes the session. A value of DEFAULT removes the setting.
+func (qe *QueryExecutor) executeSet(node *parser.Node) (*ResultSet, error) {
+	if len(node.Children) != 2 {
+		return nil, fmt.Errorf("%w: SET needs a name and a value", ErrInvalidQuery)
+	}
+	name := node.Children[0].Value
+	value := strings.Trim(node.Children[1].Value, "'\"")
+	if node.Children[1].Type == parser.NodeIdentifier && strings.EqualFold(value, "DEFAULT") {
+		value = ""
+	}
+
+	settings := qe.settings
+	if node.Value != "GLOBAL" {
+		if qe.session == nil {
+			return nil, fmt.Errorf("%w: no session to change; use SET GLOBAL", ErrUnsupportedOperation)
+		}
+		settings = qe.session
+	}
+	if err := settings.Set(name, value); err != nil {
+		return nil, err
+	}
+
+	value, _ = qe.setting(name)
+	if value == "" {
+		value = "DEFAULT"
+	}
+	return &ResultSet{
+		Columns: []Column{{Name: "setting", Type: "string"}, {Name: "value", Type: "string"}},
+		Rows:    []Row{{name, value}},
+	}, nil
+}
@@ -0,0 +1,91 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+const (
+	// ColumnCreatedAt is the column holding when a vector was inserted
+	ColumnCreatedAt = "created_at"
+
+	// ColumnUpdatedAt is the column holding when a vector was last written
+	ColumnUpdatedAt = "updated_at"
+)
+
+// timestampColumn returns the timestamp of vec that column names, and false
+// if it names none
+func timestampColumn(column string, vec *vector.Vector) (time.Time, bool) {
+	switch strings.ToLower(column) {
+	case ColumnCreatedAt:
+		return vec.CreatedAt, true
+	case ColumnUpdatedAt:
+		return vec.UpdatedAt, true
+	}
+	return time.Time{}, false
+}
+
+// isTimestampColumn reports whether column names a timestamp
+func isTimestampColumn(column string) bool {
+	_, ok := timestampColumn(column, &vector.Vector{})
+	return ok
+}
+
+// formatTimestamp returns t in RFC 3339 format, or "" if it is unknown
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ParseTimestamp parses a date or time such as '2024-01-01' or
+// '2024-01-01T12:00:00Z'
+func ParseTimestamp(literal string) (time.Time, error) {
+	t, err := storage.ParseTime(literal)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidArgument, err)
+	}
+	return t, nil
+}
+
+// evaluateTimestampCondition evaluates a comparison of a timestamp column
+// with a literal. ok is false if the condition compares no timestamp.
+// Vectors written before timestamps were recorded match no comparison.
+func evaluateTimestampCondition(condNode *parser.Node, vec *vector.Vector) (match, ok bool, err error) {
+	if len(condNode.Children) != 2 || condNode.Children[0].Type != parser.NodeIdentifier || condNode.Children[1].Type != parser.NodeLiteral {
+		return false, false, nil
+	}
+	t, ok := timestampColumn(condNode.Children[0].Value, vec)
+	if !ok {
+		return false, false, nil
+	}
+
+	literal, err := ParseTimestamp(strings.Trim(condNode.Children[1].Value, "'\""))
+	if err != nil {
+		return false, true, err
+	}
+	if t.IsZero() {
+		return false, true, nil
+	}
+	switch condNode.Value {
+	case "=":
+		return t.Equal(literal), true, nil
+	case "!=", "<>":
+		return !t.Equal(literal), true, nil
+	case "<":
+		return t.Before(literal), true, nil
+	case "<=":
+		return !t.After(literal), true, nil
+	case ">":
+		return t.After(literal), true, nil
+	case ">=":
+		return !t.Before(literal), true, nil
+	}
+	return false, true, fmt.Errorf("%w: operator %s on %s", ErrUnsupportedOperation, condNode.Value, condNode.Children[0].Value)
+}
@@ -0,0 +1,132 @@
+package sql_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/sql/cli"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// fuzzSeeds cover every statement type and clause
+var fuzzSeeds = []string{
+	"SELECT id, dimension FROM vectors",
+	"SELECT * FROM vectors WHERE id = 'vec1'",
+	"SELECT COUNT(*) FROM vectors",
+	"SELECT id, distance FROM vectors NEAREST TO [1.0, 0.0, 0.0] USING cosine LIMIT 3",
+	"SELECT id FROM vectors NEAREST TO vec1 WHERE metadata.lang = 'fr' LIMIT 2",
+	"SELECT id FROM vectors NEAREST TO EMBEDDING('hello', 'minilm') LIMIT 1",
+	"SELECT id FROM vectors WHERE id LIKE 'vec%' AND metadata.k != 'v' OR dimension > 2",
+	"INSERT INTO vectors (id, vector, metadata) VALUES ('v9', [1.0, 2.0, 3.0], {\"k\": \"v\"})",
+	"INSERT INTO vectors (id, vector) VALUES ('v9', EMBEDDING('text')) RETURNING COUNT",
+	"UPDATE vectors SET metadata.k = 'v' WHERE id = 'vec1'",
+	"DELETE FROM vectors WHERE id = 'vec2' RETURNING COUNT",
+	"CREATE COLLECTION docs (DIMENSION 3)",
+	"DROP COLLECTION vectors CONFIRM",
+	"SET GLOBAL ef_search = 200",
+	"SET default_metric TO 'cosine'",
+	"USE vectors;",
+	"SELECT id FROM vectors WHERE dimension > 2 ORDER BY metadata.year DESC LIMIT 2",
+	"EXPLAIN ANALYZE SELECT id FROM vectors NEAREST TO [1.0,2.0] LIMIT 3",
+	"SELECT id FROM vectors -- comment\n WHERE id = \"quoted\" /* block */",
+	"SELECT id FROM vectors NEAREST TO [1e3, -2.5, .5] LIMIT -1",
+	"",
+	"[",
+	"'",
+}
+
+// typedErrors are the errors the SQL front end is expected to wrap
+var typedErrors = []error{
+	parser.ErrSyntax,
+	executor.ErrUnsupportedOperation,
+	executor.ErrInvalidQuery,
+	executor.ErrInvalidArgument,
+	executor.ErrCollectionNotFound,
+	executor.ErrCollectionAlreadyExists,
+	executor.ErrConfirmationRequired,
+	executor.ErrMetricMismatch,
+	vector.ErrInvalidDimension,
+	storage.ErrVectorNotFound,
+	storage.ErrVectorAlreadyExists,
+	embedding.ErrModelNotFound,
+	embedding.ErrModelMismatch,
+}
+
+// isTyped reports whether err wraps one of typedErrors
+func isTyped(err error) bool {
+	for _, target := range typedErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// addSeeds adds the fuzz seeds and every prefix of them
+func addSeeds(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		for i := 0; i <= len(seed); i += 7 {
+			f.Add(seed[:i])
+		}
+		f.Add(seed)
+	}
+}
+
+func FuzzTokenize(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, query string) {
+		tokens, err := parser.NewTokenizer(query).Tokenize()
+		if err != nil {
+			if !errors.Is(err, parser.ErrSyntax) {
+				t.Errorf("Tokenize(%q) returned an untyped error: %v", query, err)
+			}
+			return
+		}
+		if len(tokens) == 0 || tokens[len(tokens)-1].Type != parser.TokenEOF {
+			t.Errorf("Tokenize(%q) did not end with EOF: %v", query, tokens)
+		}
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, query string) {
+		node, err := parser.Parse(query)
+		if err != nil {
+			if !errors.Is(err, parser.ErrSyntax) {
+				t.Errorf("Parse(%q) returned an untyped error: %v", query, err)
+			}
+			return
+		}
+		if node == nil {
+			t.Errorf("Parse(%q) returned neither a statement nor an error", query)
+		}
+	})
+}
+
+// FuzzExecute checks that every statement that parses either executes or
+// fails with a typed error
+func FuzzExecute(f *testing.F) {
+	addSeeds(f)
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	f.Fuzz(func(t *testing.T, query string) {
+		if _, err := parser.Parse(query); err != nil {
+			return
+		}
+
+		sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+		result, err := sqlService.Query(query)
+		if err != nil {
+			if !isTyped(err) {
+				t.Errorf("Query(%q) returned an untyped error: %v", query, err)
+			}
+			return
+		}
+		cli.FormatResult(result)
+	})
+}
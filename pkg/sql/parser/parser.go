@@ -1,11 +1,25 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/ken/vector_database/pkg/errs"
 )
 
+// ErrSyntax is wrapped by every error returned for malformed SQL
+var ErrSyntax = errs.New(errs.InvalidArgument, "syntax error")
+
+// DistanceUnits are the units distance literals such as 10km may carry, in
+// kilometers
+var DistanceUnits = map[string]float64{
+	"m":  0.001,
+	"km": 1,
+	"mi": 1.609344,
+}
+
 // NodeType represents the type of an AST node
 type NodeType int
 
@@ -29,6 +43,22 @@ const (
 	NodeLiteral
 	NodeVector
 	NodeMetric
+	NodeFunction
+	NodeSet
+	NodeUse
+	NodeExplain
+	NodeOrderBy
+	NodeDescribe
+	NodeJoin
+	NodeCreateView
+	NodeDropView
+	NodeHint
+	NodeGroupBy
+	NodeBoost
+	NodeCreateMacro
+	NodeDropMacro
+	NodeCreateRule
+	NodeDropRule
 )
 
 // Node represents a node in the abstract syntax tree
@@ -46,9 +76,16 @@ type Parser struct {
 
 // NewParser creates a new parser
 func NewParser(tokens []Token) *Parser {
-	// Filter out comments and whitespace
+	// Filter out comments and whitespace. Hints only count right after
+	// SELECT and are comments anywhere else.
 	filteredTokens := make([]Token, 0, len(tokens))
 	for _, t := range tokens {
+		if t.Type == TokenHint {
+			n := len(filteredTokens)
+			if n == 0 || filteredTokens[n-1].Type != TokenKeyword || strings.ToUpper(filteredTokens[n-1].Value) != "SELECT" {
+				continue
+			}
+		}
 		if t.Type != TokenComment && t.Type != TokenWhitespace {
 			filteredTokens = append(filteredTokens, t)
 		}
@@ -62,6 +99,15 @@ func NewParser(tokens []Token) *Parser {
 
 // Parse parses the tokens into an AST
 func (p *Parser) Parse() (*Node, error) {
+	node, err := p.parseStatement()
+	if err != nil && !errors.Is(err, ErrSyntax) {
+		return nil, fmt.Errorf("%w: %v", ErrSyntax, err)
+	}
+	return node, err
+}
+
+// parseStatement parses the statement selected by its first keyword
+func (p *Parser) parseStatement() (*Node, error) {
 	if len(p.tokens) == 0 {
 		return nil, fmt.Errorf("no tokens to parse")
 	}
@@ -81,6 +127,14 @@ func (p *Parser) Parse() (*Node, error) {
 			return p.parseDrop()
 		case "UPDATE":
 			return p.parseUpdate()
+		case "SET":
+			return p.parseSet()
+		case "USE":
+			return p.parseUse()
+		case "EXPLAIN":
+			return p.parseExplain()
+		case "DESCRIBE":
+			return p.parseDescribe()
 		default:
 			return nil, fmt.Errorf("unexpected keyword: %s", p.peek().Value)
 		}
@@ -140,6 +194,15 @@ func (p *Parser) parseSelect() (*Node, error) {
 	if err != nil {
 		return nil, err
 	}
+	
+	// Parse optimizer hints
+	if p.check(TokenHint) {
+		hints, err := parseHints(p.advance().Value)
+		if err != nil {
+			return nil, err
+		}
+		selectNode.Children = append(selectNode.Children, hints...)
+	}
 
 	// Parse column list
 	for {
@@ -205,9 +268,11 @@ func (p *Parser) parseSelect() (*Node, error) {
 			return nil, err
 		}
 		
-		fromNode := &Node{Type: NodeFrom, Children: []*Node{
-			{Type: NodeTable, Value: table.Value},
-		}}
+		tableNode, err := p.parseTableAlias(table.Value)
+		if err != nil {
+			return nil, err
+		}
+		fromNode := &Node{Type: NodeFrom, Children: []*Node{tableNode}}
 		selectNode.Children = append(selectNode.Children, fromNode)
 	}
 
@@ -270,10 +335,29 @@ func (p *Parser) parseSelect() (*Node, error) {
 			
 			nearestNode.Children = append(nearestNode.Children, metricNode)
 		}
+
+		// Parse BOOST clauses, which adjust the distance of the matching rows
+		for (p.check(TokenIdentifier) || p.check(TokenKeyword)) && strings.EqualFold(p.peek().Value, "BOOST") {
+			p.advance()
+			boostNode, err := p.parseBoost()
+			if err != nil {
+				return nil, err
+			}
+			nearestNode.Children = append(nearestNode.Children, boostNode)
+		}
 		
 		selectNode.Children = append(selectNode.Children, nearestNode)
 	}
 	
+	// Parse JOIN clause
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "JOIN" {
+		joinNode, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		selectNode.Children = append(selectNode.Children, joinNode)
+	}
+	
 	// Parse WHERE clause
 	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "WHERE" {
 		p.advance()
@@ -288,6 +372,54 @@ func (p *Parser) parseSelect() (*Node, error) {
 		selectNode.Children = append(selectNode.Children, whereNode)
 	}
 
+	// Parse GROUP BY clause, which collapses search results to the nearest
+	// row of each group
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "GROUP" {
+		p.advance()
+		if _, err := p.consumeKeyword("BY", "expected BY after GROUP"); err != nil {
+			return nil, err
+		}
+		column, err := p.consume(TokenIdentifier, "expected column after GROUP BY")
+		if err != nil {
+			return nil, err
+		}
+		groupNode := &Node{Type: NodeGroupBy, Children: []*Node{{Type: NodeIdentifier, Value: column.Value}}}
+		selectNode.Children = append(selectNode.Children, groupNode)
+	}
+
+	// Parse ORDER BY clause
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "ORDER" {
+		p.advance()
+		
+		_, err := p.consumeKeyword("BY", "expected BY after ORDER")
+		if err != nil {
+			return nil, err
+		}
+		
+		// A column, SCORE(...) or an arithmetic expression such as
+		// distance * 0.8 + metadata.boost * -0.2
+		var key *Node
+		if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, "SCORE") &&
+			p.current+1 < len(p.tokens) && p.tokens[p.current+1].Value == "(" {
+			p.advance()
+			key, err = p.parseScore()
+		} else {
+			key, err = p.parseTerm()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid ORDER BY: %w", err)
+		}
+		
+		// Ascending unless DESC follows
+		direction := "ASC"
+		if p.check(TokenKeyword) && (strings.ToUpper(p.peek().Value) == "ASC" || strings.ToUpper(p.peek().Value) == "DESC") {
+			direction = strings.ToUpper(p.advance().Value)
+		}
+		
+		orderNode := &Node{Type: NodeOrderBy, Value: direction, Children: []*Node{key}}
+		selectNode.Children = append(selectNode.Children, orderNode)
+	}
+
 	// Parse LIMIT clause
 	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "LIMIT" {
 		p.advance()
@@ -310,6 +442,86 @@ func (p *Parser) parseSelect() (*Node, error) {
 	return selectNode, nil
 }
 
+// parseTableAlias parses the optional alias after a table name, as in FROM
+// vectors v or FROM vectors AS v. The alias is the child of the table.
+func (p *Parser) parseTableAlias(table string) (*Node, error) {
+	tableNode := &Node{Type: NodeTable, Value: table}
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "AS" {
+		p.advance()
+		if !p.check(TokenIdentifier) {
+			return nil, fmt.Errorf("expected alias of %s, got %s", table, p.peek().Value)
+		}
+	}
+	if p.check(TokenIdentifier) {
+		tableNode.Children = []*Node{{Type: NodeAlias, Value: p.advance().Value}}
+	}
+	return tableNode, nil
+}
+
+// parseJoin parses JOIN table [alias] ON condition. The table is the first
+// child of the join and the condition the second.
+func (p *Parser) parseJoin() (*Node, error) {
+	p.advance() // Consume JOIN
+
+	table, err := p.consume(TokenIdentifier, "expected table name after JOIN")
+	if err != nil {
+		return nil, err
+	}
+	tableNode, err := p.parseTableAlias(table.Value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeKeyword("ON", "expected ON after JOIN "+table.Value); err != nil {
+		return nil, err
+	}
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Type: NodeJoin, Value: table.Value, Children: []*Node{tableNode, condition}}, nil
+}
+
+// parseScore parses the arguments of SCORE(distance, name value, ...) in
+// ORDER BY, such as SCORE(distance, recency 0.2, half_life '7d'). Each
+// option is a child named after it whose child is its value.
+func (p *Parser) parseScore() (*Node, error) {
+	p.advance() // Consume (
+
+	first, err := p.consume(TokenIdentifier, "expected distance in SCORE(")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(first.Value, "distance") {
+		return nil, fmt.Errorf("expected distance in SCORE(, got %s", first.Value)
+	}
+	scoreNode := &Node{Type: NodeFunction, Value: "SCORE", Children: []*Node{{Type: NodeIdentifier, Value: "distance"}}}
+
+	for p.check(TokenPunctuation) && p.peek().Value == "," {
+		p.advance()
+		name, err := p.consume(TokenIdentifier, "expected SCORE option")
+		if err != nil {
+			return nil, err
+		}
+
+		var value *Node
+		switch token := p.peek(); token.Type {
+		case TokenNumber, TokenString:
+			value = &Node{Type: NodeLiteral, Value: p.advance().Value}
+		case TokenIdentifier:
+			value = &Node{Type: NodeIdentifier, Value: p.advance().Value}
+		default:
+			return nil, fmt.Errorf("expected value of %s, got %s", name.Value, token.Value)
+		}
+		scoreNode.Children = append(scoreNode.Children, &Node{Type: NodeIdentifier, Value: strings.ToLower(name.Value), Children: []*Node{value}})
+	}
+
+	if !p.check(TokenPunctuation) || p.peek().Value != ")" {
+		return nil, fmt.Errorf("expected ) to close SCORE(, got %s", p.peek().Value)
+	}
+	p.advance()
+	return scoreNode, nil
+}
+
 // parseInsert parses an INSERT statement
 func (p *Parser) parseInsert() (*Node, error) {
 	insertNode := &Node{Type: NodeInsert, Children: []*Node{}}
@@ -454,6 +666,15 @@ func (p *Parser) parseDelete() (*Node, error) {
 		deleteNode.Children = append(deleteNode.Children, whereNode)
 	}
 	
+	// Parse RETURNING COUNT (optional)
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	if returning != nil {
+		deleteNode.Children = append(deleteNode.Children, returning)
+	}
+	
 	// Consume optional semicolon
 	if p.check(TokenPunctuation) && p.peek().Value == ";" {
 		p.advance()
@@ -462,6 +683,21 @@ func (p *Parser) parseDelete() (*Node, error) {
 	return deleteNode, nil
 }
 
+// parseReturning parses an optional RETURNING COUNT clause. It returns nil
+// when there is none.
+func (p *Parser) parseReturning() (*Node, error) {
+	if !p.check(TokenKeyword) || strings.ToUpper(p.peek().Value) != "RETURNING" {
+		return nil, nil
+	}
+	p.advance()
+
+	if _, err := p.consumeKeyword("COUNT", "expected COUNT after RETURNING"); err != nil {
+		return nil, err
+	}
+
+	return &Node{Type: NodeIdentifier, Value: "returning", Children: []*Node{{Type: NodeColumn, Value: "count"}}}, nil
+}
+
 // parseCreate parses a CREATE statement
 func (p *Parser) parseCreate() (*Node, error) {
 	createNode := &Node{Type: NodeCreate, Children: []*Node{}}
@@ -472,8 +708,19 @@ func (p *Parser) parseCreate() (*Node, error) {
 		return nil, err
 	}
 	
+	// VIEW, MACRO and RULE are not keywords, so they remain usable as names
+	if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, "VIEW") {
+		return p.parseCreateView()
+	}
+	if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, "MACRO") {
+		return p.parseCreateMacro()
+	}
+	if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, "RULE") {
+		return p.parseCreateRule()
+	}
+	
 	// Consume COLLECTION
-	_, err = p.consumeKeyword("COLLECTION", "expected COLLECTION")
+	_, err = p.consumeKeyword("COLLECTION", "expected COLLECTION, VIEW, MACRO or RULE")
 	if err != nil {
 		return nil, err
 	}
@@ -526,6 +773,165 @@ func (p *Parser) parseCreate() (*Node, error) {
 	return createNode, nil
 }
 
+// parseCreateView parses CREATE VIEW name AS SELECT .... The parsed SELECT
+// is the first child and its text, to be stored, the second.
+func (p *Parser) parseCreateView() (*Node, error) {
+	p.advance() // Consume VIEW
+
+	name, err := p.consume(TokenIdentifier, "expected view name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeKeyword("AS", "expected AS after CREATE VIEW "+name.Value); err != nil {
+		return nil, err
+	}
+
+	start := p.current
+	selectNode, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	text := &Node{Type: NodeLiteral, Value: p.textSince(start)}
+	return &Node{Type: NodeCreateView, Value: name.Value, Children: []*Node{selectNode, text}}, nil
+}
+
+// textSince returns the text of the tokens from start to the current one,
+// to be stored. It keeps the spacing of the statement, collapsing
+// whitespace and comments to a space.
+func (p *Parser) textSince(start int) string {
+	var sb strings.Builder
+	end := -1
+	for _, t := range p.tokens[start:p.current] {
+		if t.Type == TokenPunctuation && t.Value == ";" {
+			continue
+		}
+		if end >= 0 && t.Pos > end {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(t.Value)
+		end = t.Pos + len(t.Value)
+	}
+	return sb.String()
+}
+
+// parseCreateMacro parses CREATE MACRO name AS condition. The parsed
+// condition is the first child and its text, to be stored, the second.
+func (p *Parser) parseCreateMacro() (*Node, error) {
+	p.advance() // Consume MACRO
+
+	name, err := p.consume(TokenIdentifier, "expected macro name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeKeyword("AS", "expected AS after CREATE MACRO "+name.Value); err != nil {
+		return nil, err
+	}
+	start := p.current
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	text := &Node{Type: NodeLiteral, Value: p.textSince(start)}
+	if p.check(TokenPunctuation) && p.peek().Value == ";" {
+		p.advance()
+	}
+	return &Node{Type: NodeCreateMacro, Value: name.Value, Children: []*Node{condition, text}}, nil
+}
+
+// parseCreateRule parses CREATE RULE name ON table|* [WHERE condition]
+// [LIMIT n]. The children are the table, then a WHERE node whose second
+// child is the condition's text and a LIMIT node, if given.
+func (p *Parser) parseCreateRule() (*Node, error) {
+	p.advance() // Consume RULE
+
+	name, err := p.consume(TokenIdentifier, "expected rule name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consumeKeyword("ON", "expected ON after CREATE RULE "+name.Value); err != nil {
+		return nil, err
+	}
+	table := &Node{Type: NodeTable}
+	if p.check(TokenOperator) && p.peek().Value == "*" {
+		table.Value = p.advance().Value
+	} else {
+		t, err := p.consume(TokenIdentifier, "expected table name or * after ON")
+		if err != nil {
+			return nil, err
+		}
+		table.Value = t.Value
+	}
+	ruleNode := &Node{Type: NodeCreateRule, Value: name.Value, Children: []*Node{table}}
+
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "WHERE" {
+		p.advance()
+		start := p.current
+		condition, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		text := &Node{Type: NodeLiteral, Value: p.textSince(start)}
+		ruleNode.Children = append(ruleNode.Children, &Node{Type: NodeWhere, Children: []*Node{condition, text}})
+	}
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "LIMIT" {
+		p.advance()
+		limit, err := p.consume(TokenNumber, "expected number for LIMIT")
+		if err != nil {
+			return nil, err
+		}
+		ruleNode.Children = append(ruleNode.Children, &Node{Type: NodeLimit, Value: limit.Value})
+	}
+	if len(ruleNode.Children) == 1 {
+		return nil, fmt.Errorf("CREATE RULE %s needs a WHERE condition or a LIMIT", name.Value)
+	}
+	if p.check(TokenPunctuation) && p.peek().Value == ";" {
+		p.advance()
+	}
+	return ruleNode, nil
+}
+
+// parseHints parses the hints of a /*+ ... */ comment, such as
+// INDEX(flat) NO_CACHE, into one NodeHint per hint. The hint name is upper
+// case and its arguments are identifier children.
+func parseHints(comment string) ([]*Node, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(comment, "/*+"), "*/")
+	tokens, err := NewTokenizer(body).Tokenize()
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid hint: %v", ErrSyntax, err)
+	}
+	
+	var hints []*Node
+	for i := 0; i < len(tokens) && tokens[i].Type != TokenEOF; i++ {
+		t := tokens[i]
+		if t.Type == TokenPunctuation && t.Value == "," {
+			continue
+		}
+		if t.Type != TokenIdentifier && t.Type != TokenKeyword {
+			return nil, fmt.Errorf("%w: expected hint name, got %s", ErrSyntax, t.Value)
+		}
+		hint := &Node{Type: NodeHint, Value: strings.ToUpper(t.Value)}
+		
+		// Arguments in parentheses
+		if i+1 < len(tokens) && tokens[i+1].Value == "(" {
+			for i += 2; ; i++ {
+				if i >= len(tokens) || tokens[i].Type == TokenEOF {
+					return nil, fmt.Errorf("%w: unclosed arguments of hint %s", ErrSyntax, hint.Value)
+				}
+				arg := tokens[i]
+				if arg.Value == ")" {
+					break
+				}
+				if arg.Value == "," {
+					continue
+				}
+				hint.Children = append(hint.Children, &Node{Type: NodeIdentifier, Value: arg.Value})
+			}
+		}
+		hints = append(hints, hint)
+	}
+	return hints, nil
+}
+
 // parseDrop parses a DROP statement
 func (p *Parser) parseDrop() (*Node, error) {
 	dropNode := &Node{Type: NodeDrop, Children: []*Node{}}
@@ -536,8 +942,33 @@ func (p *Parser) parseDrop() (*Node, error) {
 		return nil, err
 	}
 	
+	if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, "VIEW") {
+		p.advance()
+		name, err := p.consume(TokenIdentifier, "expected view name")
+		if err != nil {
+			return nil, err
+		}
+		if p.check(TokenPunctuation) && p.peek().Value == ";" {
+			p.advance()
+		}
+		return &Node{Type: NodeDropView, Value: name.Value}, nil
+	}
+	for kind, nodeType := range map[string]NodeType{"MACRO": NodeDropMacro, "RULE": NodeDropRule} {
+		if p.check(TokenIdentifier) && strings.EqualFold(p.peek().Value, kind) {
+			p.advance()
+			name, err := p.consume(TokenIdentifier, "expected "+strings.ToLower(kind)+" name")
+			if err != nil {
+				return nil, err
+			}
+			if p.check(TokenPunctuation) && p.peek().Value == ";" {
+				p.advance()
+			}
+			return &Node{Type: nodeType, Value: name.Value}, nil
+		}
+	}
+	
 	// Consume COLLECTION
-	_, err = p.consumeKeyword("COLLECTION", "expected COLLECTION")
+	_, err = p.consumeKeyword("COLLECTION", "expected COLLECTION, VIEW, MACRO or RULE")
 	if err != nil {
 		return nil, err
 	}
@@ -551,6 +982,21 @@ func (p *Parser) parseDrop() (*Node, error) {
 	tableNode := &Node{Type: NodeTable, Value: collection.Value}
 	dropNode.Children = append(dropNode.Children, tableNode)
 	
+	// Parse CONFIRM (required to actually drop, checked by the executor)
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "CONFIRM" {
+		p.advance()
+		dropNode.Children = append(dropNode.Children, &Node{Type: NodeIdentifier, Value: "confirm"})
+	}
+	
+	// Parse RETURNING COUNT (optional)
+	returning, err := p.parseReturning()
+	if err != nil {
+		return nil, err
+	}
+	if returning != nil {
+		dropNode.Children = append(dropNode.Children, returning)
+	}
+	
 	// Consume optional semicolon
 	if p.check(TokenPunctuation) && p.peek().Value == ";" {
 		p.advance()
@@ -644,6 +1090,124 @@ func (p *Parser) parseUpdate() (*Node, error) {
 	return updateNode, nil
 }
 
+// parseSet parses SET [SESSION | GLOBAL] name = value, also written with TO.
+// The node's value is the scope, empty if none was given; its children are
+// the setting's name and value.
+func (p *Parser) parseSet() (*Node, error) {
+	if _, err := p.consumeKeyword("SET", "expected SET"); err != nil {
+		return nil, err
+	}
+
+	// SESSION and GLOBAL are not keywords, so they remain usable as names
+	scope := ""
+	if p.check(TokenIdentifier) && p.current+1 < len(p.tokens) && p.tokens[p.current+1].Type == TokenIdentifier {
+		switch upper := strings.ToUpper(p.peek().Value); upper {
+		case "SESSION", "GLOBAL":
+			p.advance()
+			scope = upper
+		}
+	}
+
+	name, err := p.consume(TokenIdentifier, "expected setting name")
+	if err != nil {
+		return nil, err
+	}
+
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "TO" {
+		p.advance()
+	} else if p.check(TokenOperator) && p.peek().Value == "=" {
+		p.advance()
+	} else {
+		return nil, fmt.Errorf("expected = or TO, got %s", p.peek().Value)
+	}
+
+	// ON is a keyword but reads naturally as the value of a switch
+	var value *Node
+	if p.check(TokenKeyword) && strings.ToUpper(p.peek().Value) == "ON" {
+		value = &Node{Type: NodeIdentifier, Value: p.advance().Value}
+	} else {
+		value, err = p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		if value.Type != NodeLiteral && value.Type != NodeIdentifier {
+			return nil, fmt.Errorf("expected a number, string or name as the value of %s", name.Value)
+		}
+	}
+
+	// Consume optional semicolon
+	if p.check(TokenPunctuation) && p.peek().Value == ";" {
+		p.advance()
+	}
+
+	return &Node{Type: NodeSet, Value: scope, Children: []*Node{{Type: NodeIdentifier, Value: strings.ToLower(name.Value)}, value}}, nil
+}
+
+// parseUse parses USE name, which makes name the collection of statements
+// without FROM. The node's value is the collection's name.
+func (p *Parser) parseUse() (*Node, error) {
+	if _, err := p.consumeKeyword("USE", "expected USE"); err != nil {
+		return nil, err
+	}
+
+	collection, err := p.consume(TokenIdentifier, "expected collection name")
+	if err != nil {
+		return nil, err
+	}
+
+	// Consume optional semicolon
+	if p.check(TokenPunctuation) && p.peek().Value == ";" {
+		p.advance()
+	}
+
+	return &Node{Type: NodeUse, Value: collection.Value}, nil
+}
+
+// parseDescribe parses DESCRIBE [name], which lists the columns and
+// metadata fields of a collection. The node's value is the collection's
+// name, empty for the one chosen with USE.
+func (p *Parser) parseDescribe() (*Node, error) {
+	if _, err := p.consumeKeyword("DESCRIBE", "expected DESCRIBE"); err != nil {
+		return nil, err
+	}
+
+	collection := ""
+	if p.check(TokenIdentifier) {
+		collection = p.advance().Value
+	}
+
+	// Consume optional semicolon
+	if p.check(TokenPunctuation) && p.peek().Value == ";" {
+		p.advance()
+	}
+
+	return &Node{Type: NodeDescribe, Value: collection}, nil
+}
+
+// parseExplain parses EXPLAIN [ANALYZE] followed by a SELECT. The node's
+// value is ANALYZE if given; its child is the SELECT.
+func (p *Parser) parseExplain() (*Node, error) {
+	if _, err := p.consumeKeyword("EXPLAIN", "expected EXPLAIN"); err != nil {
+		return nil, err
+	}
+
+	// ANALYZE is not a keyword, so it remains usable as a name
+	analyze := ""
+	if p.check(TokenIdentifier) && strings.ToUpper(p.peek().Value) == "ANALYZE" {
+		p.advance()
+		analyze = "ANALYZE"
+	}
+
+	if !p.check(TokenKeyword) || strings.ToUpper(p.peek().Value) != "SELECT" {
+		return nil, fmt.Errorf("expected SELECT after EXPLAIN, got %s", p.peek().Value)
+	}
+	statement, err := p.parseSelect()
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Type: NodeExplain, Value: analyze, Children: []*Node{statement}}, nil
+}
+
 // parseExpression parses an expression
 func (p *Parser) parseExpression() (*Node, error) {
 	return p.parseLogicalOr()
@@ -745,6 +1309,38 @@ func (p *Parser) parseComparison() (*Node, error) {
 	return left, nil
 }
 
+// parseBoost parses the rest of a BOOST clause: a condition followed by BY
+// and an amount subtracted from the distance, or by * and a factor the
+// distance is multiplied with. The node's value is "-" or "*"; its children
+// are the condition and the amount.
+func (p *Parser) parseBoost() (*Node, error) {
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("invalid BOOST: %w", err)
+	}
+	if _, err := p.consumeKeyword("BY", "expected BY after BOOST condition"); err != nil {
+		return nil, err
+	}
+	op := "-"
+	if p.check(TokenOperator) && p.peek().Value == "*" {
+		p.advance()
+		op = "*"
+	}
+	sign := ""
+	if p.check(TokenOperator) && p.peek().Value == "-" {
+		p.advance()
+		sign = "-"
+	}
+	amount, err := p.consume(TokenNumber, "expected number after BOOST ... BY")
+	if err != nil {
+		return nil, err
+	}
+	return &Node{Type: NodeBoost, Value: op, Children: []*Node{
+		condition,
+		{Type: NodeLiteral, Value: sign + amount.Value},
+	}}, nil
+}
+
 // parseTerm parses a term expression
 func (p *Parser) parseTerm() (*Node, error) {
 	left, err := p.parseFactor()
@@ -826,6 +1422,12 @@ func (p *Parser) parsePrimary() (*Node, error) {
 	if p.check(TokenNumber) {
 		token := p.advance()
 		
+		// A distance unit after a number, as in 10km, makes it a distance
+		if unit := p.peek(); unit.Type == TokenIdentifier && DistanceUnits[strings.ToLower(unit.Value)] > 0 {
+			p.advance()
+			return &Node{Type: NodeLiteral, Value: token.Value + strings.ToLower(unit.Value)}, nil
+		}
+		
 		// Convert to float or int
 		if strings.Contains(token.Value, ".") {
 			_, err := strconv.ParseFloat(token.Value, 64)
@@ -895,10 +1497,16 @@ func (p *Parser) parsePrimary() (*Node, error) {
 	return p.parseIdentifier()
 }
 
-// parseIdentifier parses an identifier
+// parseIdentifier parses an identifier or a function call
 func (p *Parser) parseIdentifier() (*Node, error) {
 	if p.check(TokenIdentifier) {
 		token := p.advance()
+		
+		// An identifier followed by ( is a function call, e.g. EMBEDDING('text')
+		if p.check(TokenPunctuation) && p.peek().Value == "(" {
+			return p.parseFunctionCall(token.Value)
+		}
+		
 		return &Node{Type: NodeIdentifier, Value: token.Value}, nil
 	}
 	
@@ -911,6 +1519,42 @@ func (p *Parser) parseIdentifier() (*Node, error) {
 	return nil, fmt.Errorf("expected identifier, got %s", p.peek().Value)
 }
 
+// parseFunctionCall parses the argument list of a function call
+func (p *Parser) parseFunctionCall(name string) (*Node, error) {
+	// Consume (
+	p.advance()
+	
+	funcNode := &Node{Type: NodeFunction, Value: strings.ToUpper(name), Children: []*Node{}}
+	
+	// Handle empty argument list
+	if p.check(TokenPunctuation) && p.peek().Value == ")" {
+		p.advance()
+		return funcNode, nil
+	}
+	
+	for {
+		arg, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		funcNode.Children = append(funcNode.Children, arg)
+		
+		// Check for comma
+		if p.check(TokenPunctuation) && p.peek().Value == "," {
+			p.advance()
+		} else {
+			break
+		}
+	}
+	
+	if !p.check(TokenPunctuation) || p.peek().Value != ")" {
+		return nil, fmt.Errorf("expected ) to close %s(, got %s", name, p.peek().Value)
+	}
+	p.advance()
+	
+	return funcNode, nil
+}
+
 // Parse a SQL string into an AST
 func Parse(sql string) (*Node, error) {
 	// Tokenize the SQL
@@ -923,4 +1567,35 @@ func Parse(sql string) (*Node, error) {
 	// Parse the tokens
 	parser := NewParser(tokens)
 	return parser.Parse()
-} 
\ No newline at end of file
+} 
+// Normalize returns a canonical form of a SQL string that is equal for
+// statements differing only in whitespace, comments and keyword case
+func Normalize(sql string) (string, error) {
+	tokens, err := NewTokenizer(sql).Tokenize()
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		if part, ok := canonicalToken(t); ok {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// canonicalToken returns the form of a token in a normalized statement, or
+// false for tokens left out of it
+func canonicalToken(t Token) (string, bool) {
+	switch t.Type {
+	case TokenComment, TokenWhitespace, TokenEOF:
+		return "", false
+	case TokenHint:
+		return "/*+ " + strings.ToUpper(strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimPrefix(t.Value, "/*+"), "*/")), " ")) + " */", true
+	case TokenKeyword:
+		return strings.ToUpper(t.Value), true
+	default:
+		return t.Value, true
+	}
+}
@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotParameterized is returned by Prepare for statements whose literals
+// cannot be parameterized out, which are parsed with Parse instead
+var ErrNotParameterized = errors.New("statement cannot be parameterized")
+
+// numberPlaceholder is the first number standing in for the number literals
+// of a template. Placeholders all have the same width, so none is part of
+// another.
+const numberPlaceholder = 8000000000000000000
+
+// Statement is a tokenized SQL statement split into the template of its
+// text and its literals, so statements differing only in their literals,
+// such as the vector of a search, can share a parse
+type Statement struct {
+	// Key is the normalized statement with each string literal replaced by
+	// '?' and each number by ?
+	Key string
+
+	tokens   []Token
+	literals []int // Positions of the string and number literals in tokens
+}
+
+// Parameterize tokenizes sql and replaces its literals with parameters
+func Parameterize(sql string) (*Statement, error) {
+	tokens, err := NewTokenizer(sql).Tokenize()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Statement{tokens: tokens}
+	parts := make([]string, 0, len(tokens))
+	for i, t := range tokens {
+		switch t.Type {
+		case TokenString:
+			s.literals = append(s.literals, i)
+			parts = append(parts, "'?'")
+		case TokenNumber:
+			s.literals = append(s.literals, i)
+			parts = append(parts, "?")
+		default:
+			if part, ok := canonicalToken(t); ok {
+				parts = append(parts, part)
+			}
+		}
+	}
+	s.Key = strings.Join(parts, " ")
+	return s, nil
+}
+
+// Template is a statement parsed with placeholders for its literals
+type Template struct {
+	ast          *Node
+	placeholders []string // Placeholder of each literal, in order
+}
+
+// Prepare parses the statement with placeholders for its literals. The
+// template can be bound to the literals of any statement with the same
+// key. Statements with numbers the parser would reject, or whose text
+// is kept, as by CREATE VIEW, MACRO or RULE, return ErrNotParameterized.
+func (s *Statement) Prepare() (*Template, error) {
+	if !s.parameterizable() {
+		return nil, ErrNotParameterized
+	}
+
+	tokens := append([]Token(nil), s.tokens...)
+	placeholders := make([]string, len(s.literals))
+	for n, i := range s.literals {
+		if tokens[i].Type == TokenString {
+			placeholders[n] = fmt.Sprintf("'\x00%d\x00'", n)
+		} else {
+			placeholders[n] = strconv.Itoa(numberPlaceholder + n)
+		}
+		tokens[i].Value = placeholders[n]
+	}
+
+	ast, err := NewParser(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Template{ast: ast, placeholders: placeholders}, nil
+}
+
+// parameterizable reports whether every number literal is one the parser
+// accepts and the statement's text is not kept
+func (s *Statement) parameterizable() bool {
+	for _, t := range s.tokens {
+		if t.Type == TokenIdentifier && (strings.EqualFold(t.Value, "VIEW") || strings.EqualFold(t.Value, "MACRO") || strings.EqualFold(t.Value, "RULE")) {
+			return false
+		}
+	}
+	for _, i := range s.literals {
+		t := s.tokens[i]
+		if t.Type != TokenNumber {
+			continue
+		}
+		var err error
+		if strings.Contains(t.Value, ".") {
+			_, err = strconv.ParseFloat(t.Value, 64)
+		} else {
+			_, err = strconv.ParseInt(t.Value, 10, 64)
+		}
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Bind returns the AST of the template with the literals of s, which must
+// have the key the template was prepared from, in place of its placeholders.
+// Literals Prepare would not parameterize return ErrNotParameterized.
+func (t *Template) Bind(s *Statement) (*Node, error) {
+	if len(s.literals) != len(t.placeholders) {
+		return nil, fmt.Errorf("template of %d literals bound to %d", len(t.placeholders), len(s.literals))
+	}
+	if !s.parameterizable() {
+		return nil, ErrNotParameterized
+	}
+	pairs := make([]string, 0, 2*len(t.placeholders))
+	for n, i := range s.literals {
+		pairs = append(pairs, t.placeholders[n], s.tokens[i].Value)
+	}
+	return bindNode(t.ast, strings.NewReplacer(pairs...)), nil
+}
+
+// bindNode copies node, replacing the placeholders in its values
+func bindNode(node *Node, replacer *strings.Replacer) *Node {
+	bound := &Node{Type: node.Type, Value: replacer.Replace(node.Value)}
+	if node.Children != nil {
+		bound.Children = make([]*Node, len(node.Children))
+		for i, child := range node.Children {
+			bound.Children[i] = bindNode(child, replacer)
+		}
+	}
+	return bound
+}
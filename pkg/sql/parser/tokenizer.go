@@ -21,6 +21,7 @@ const (
 	TokenWhitespace
 	TokenComment
 	TokenError
+	TokenHint // Optimizer hints in a /*+ ... */ comment
 )
 
 // Token represents a lexical token
@@ -38,7 +39,8 @@ var Keywords = map[string]bool{
 	"TRUE": true, "FALSE": true, "COUNT": true, "NEAREST": true, "TO": true, "LIMIT": true,
 	"USING": true, "METRIC": true, "JOIN": true, "ON": true, "AS": true, "ORDER": true, "BY": true,
 	"ASC": true, "DESC": true, "GROUP": true, "HAVING": true, "DISTINCT": true, "UNION": true,
-	"ALL": true, "IN": true, "EXISTS": true, "LIKE": true,
+	"ALL": true, "IN": true, "EXISTS": true, "LIKE": true, "RETURNING": true, "CONFIRM": true,
+	"USE": true, "EXPLAIN": true, "DESCRIBE": true,
 }
 
 // Tokenizer breaks input into tokens
@@ -71,6 +73,11 @@ func (t *Tokenizer) Tokenize() ([]Token, error) {
 		state = state(t)
 	}
 
+	// Report lexical errors instead of parsing a truncated statement
+	if n := len(t.tokens); n > 0 && t.tokens[n-1].Type == TokenError {
+		return nil, fmt.Errorf("%w: %s at position %d", ErrSyntax, t.tokens[n-1].Value, t.tokens[n-1].Pos)
+	}
+
 	// Add EOF token
 	t.tokens = append(t.tokens, Token{
 		Type:  TokenEOF,
@@ -216,11 +223,13 @@ func lexComment(t *Tokenizer) stateFn {
 	return lexText
 }
 
-// lexMultiLineComment tokenizes multi-line comments
+// lexMultiLineComment tokenizes multi-line comments. Comments starting
+// with /*+ hold optimizer hints and are kept as a hint token.
 func lexMultiLineComment(t *Tokenizer) stateFn {
 	// Skip '/*'
 	t.next()
 	t.next()
+	hint := t.peek() == '+'
 
 	// Consume until end of comment or input
 	for {
@@ -232,6 +241,10 @@ func lexMultiLineComment(t *Tokenizer) stateFn {
 			return t.error("unclosed comment")
 		}
 	}
+	if hint {
+		t.emit(TokenHint)
+		return lexText
+	}
 	t.ignore() // ignore comments
 	return lexText
 }
@@ -310,6 +323,11 @@ func lexVectorLiteral(t *Tokenizer) stateFn {
 func lexIdentifier(t *Tokenizer) stateFn {
 	for isAlphaNumeric(t.peek()) {
 		t.next()
+
+		// Dotted paths such as metadata.category are a single identifier
+		if t.peek() == '.' && t.pos+1 < len(t.input) && (unicode.IsLetter(rune(t.input[t.pos+1])) || t.input[t.pos+1] == '_') {
+			t.next()
+		}
 	}
 	
 	// Check if it's a keyword
@@ -30,8 +30,12 @@ type PlanNode struct {
 	Condition    *parser.Node
 	Projection   []string
 	Limit        int
+	OrderBy      string // Column and direction of ORDER BY, e.g. "distance DESC"
+	GroupBy      string // Column search results are collapsed by, e.g. metadata.parent_id
+	Boosts       []string // BOOST clauses of a search, e.g. metadata.source = 'manual' BY 0.1
 	VectorQuery  string
 	DistanceFunc string
+	Hints        []string // Optimizer hints, e.g. INDEX(flat)
 }
 
 // QueryPlanner plans the execution of SQL queries
@@ -79,9 +83,14 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 	var whereNode *parser.Node
 	var nearestNode *parser.Node
 	var limitNode *parser.Node
+	orderBy := ""
+	groupBy := ""
+	var hints []string
 	
 	for _, child := range node.Children {
 		switch child.Type {
+		case parser.NodeHint:
+			hints = append(hints, displayHint(child))
 		case parser.NodeFrom:
 			fromNode = child
 		case parser.NodeWhere:
@@ -90,6 +99,14 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 			nearestNode = child
 		case parser.NodeLimit:
 			limitNode = child
+		case parser.NodeGroupBy:
+			groupBy = child.Children[0].Value
+		case parser.NodeOrderBy:
+			if child.Children[0].Type == parser.NodeBinaryOp {
+				orderBy = qp.displayCondition(child.Children[0]) + " " + child.Value
+			} else {
+				orderBy = child.Children[0].Value + " " + child.Value
+			}
 		}
 	}
 	
@@ -127,12 +144,25 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 		if len(nearestNode.Children) > 0 {
 			vectorNode := nearestNode.Children[0]
 			vectorQuery = vectorNode.Value
+			if vectorNode.Type == parser.NodeFunction {
+				vectorQuery = qp.displayCondition(vectorNode)
+			}
 		}
 		
 		// Extract distance function if specified
 		if len(nearestNode.Children) > 1 && nearestNode.Children[1].Type == parser.NodeMetric {
 			distanceFunc = strings.Trim(nearestNode.Children[1].Value, "'\"")
 		}
+		var boosts []string
+		for _, child := range nearestNode.Children {
+			if child.Type == parser.NodeBoost {
+				by := child.Children[1].Value
+				if child.Value == "*" {
+					by = "* " + by
+				}
+				boosts = append(boosts, qp.displayCondition(child.Children[0])+" BY "+by)
+			}
+		}
 		
 		return &PlanNode{
 			Type:         PlanTypeVectorSearch,
@@ -140,8 +170,12 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 			TableName:    tableName,
 			Projection:   projections,
 			Limit:        limit,
+			OrderBy:      orderBy,
+			GroupBy:      groupBy,
+			Boosts:       boosts,
 			VectorQuery:  vectorQuery,
 			DistanceFunc: distanceFunc,
+			Hints:        hints,
 		}, nil
 	}
 	
@@ -161,6 +195,8 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 					Condition:  whereExpr,
 					Projection: projections,
 					Limit:      limit,
+					OrderBy:    orderBy,
+					Hints:      hints,
 				}, nil
 			}
 		}
@@ -179,6 +215,8 @@ func (qp *QueryPlanner) createSelectPlan(node *parser.Node) (*PlanNode, error) {
 		Condition:  condition,
 		Projection: projections,
 		Limit:      limit,
+		OrderBy:    orderBy,
+		Hints:      hints,
 	}, nil
 }
 
@@ -300,6 +338,34 @@ func (qp *QueryPlanner) displayPlanNode(sb *strings.Builder, node *PlanNode, ind
 		sb.WriteString(fmt.Sprintf("Limit: %d\n", node.Limit))
 	}
 	
+	if node.OrderBy != "" {
+		for i := 0; i < indent+1; i++ {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(fmt.Sprintf("Order: %s\n", node.OrderBy))
+	}
+
+	if node.GroupBy != "" {
+		for i := 0; i < indent+1; i++ {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(fmt.Sprintf("Collapse: nearest row per %s\n", node.GroupBy))
+	}
+
+	for _, boost := range node.Boosts {
+		for i := 0; i < indent+1; i++ {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(fmt.Sprintf("Boost: %s\n", boost))
+	}
+	
+	if len(node.Hints) > 0 {
+		for i := 0; i < indent+1; i++ {
+			sb.WriteString("  ")
+		}
+		sb.WriteString(fmt.Sprintf("Hints: %s\n", strings.Join(node.Hints, " ")))
+	}
+	
 	if node.Type == PlanTypeVectorSearch {
 		for i := 0; i < indent+1; i++ {
 			sb.WriteString("  ")
@@ -318,6 +384,18 @@ func (qp *QueryPlanner) displayPlanNode(sb *strings.Builder, node *PlanNode, ind
 	}
 }
 
+// displayHint returns a hint as written, e.g. INDEX(flat)
+func displayHint(node *parser.Node) string {
+	if len(node.Children) == 0 {
+		return node.Value
+	}
+	args := make([]string, len(node.Children))
+	for i, arg := range node.Children {
+		args[i] = arg.Value
+	}
+	return node.Value + "(" + strings.Join(args, ", ") + ")"
+}
+
 // displayCondition returns a string representation of a condition
 func (qp *QueryPlanner) displayCondition(node *parser.Node) string {
 	if node == nil {
@@ -331,6 +409,9 @@ func (qp *QueryPlanner) displayCondition(node *parser.Node) string {
 			right := qp.displayCondition(node.Children[1])
 			return fmt.Sprintf("(%s %s %s)", left, node.Value, right)
 		}
+		if len(node.Children) == 1 {
+			return node.Value + qp.displayCondition(node.Children[0])
+		}
 		return node.Value
 		
 	case parser.NodeIdentifier:
@@ -339,6 +420,13 @@ func (qp *QueryPlanner) displayCondition(node *parser.Node) string {
 	case parser.NodeLiteral:
 		return fmt.Sprintf("'%s'", node.Value)
 		
+	case parser.NodeFunction:
+		args := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			args[i] = child.Value
+		}
+		return fmt.Sprintf("%s(%s)", node.Value, strings.Join(args, ", "))
+		
 	default:
 		return node.Value
 	}
@@ -1,11 +1,23 @@
 package sql_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/projection"
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/index/tiered"
 	"github.com/ken/vector_database/pkg/sql/cli"
 	"github.com/ken/vector_database/pkg/sql/executor"
 	"github.com/ken/vector_database/pkg/sql/parser"
@@ -74,11 +86,141 @@ func TestSQLParser(t *testing.T) {
 			nodeType: parser.NodeDrop,
 			wantErr:  false,
 		},
+		{
+			name:     "DROP CONFIRM",
+			query:    "DROP COLLECTION vectors CONFIRM RETURNING COUNT",
+			nodeType: parser.NodeDrop,
+			wantErr:  false,
+		},
+		{
+			name:     "SELECT with NEAREST TO EMBEDDING",
+			query:    "SELECT id FROM vectors NEAREST TO EMBEDDING('vector databases', 'minilm') LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:     "SELECT with metadata WHERE",
+			query:    "SELECT id FROM vectors NEAREST TO [1.0,2.0] WHERE metadata.lang = 'fr' LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:     "DELETE RETURNING COUNT",
+			query:    "DELETE FROM vectors WHERE id = 'vec1' RETURNING COUNT",
+			nodeType: parser.NodeDelete,
+			wantErr:  false,
+		},
+		{
+			name:     "SET",
+			query:    "SET ef_search = 200",
+			nodeType: parser.NodeSet,
+			wantErr:  false,
+		},
+		{
+			name:     "SET GLOBAL with TO",
+			query:    "SET GLOBAL default_metric TO 'cosine'",
+			nodeType: parser.NodeSet,
+			wantErr:  false,
+		},
+		{
+			name:    "SET without value",
+			query:   "SET ef_search =",
+			wantErr: true,
+		},
+		{
+			name:     "USE",
+			query:    "USE vectors;",
+			nodeType: parser.NodeUse,
+			wantErr:  false,
+		},
+		{
+			name:    "USE without collection",
+			query:   "USE",
+			wantErr: true,
+		},
+		{
+			name:     "EXPLAIN ANALYZE",
+			query:    "EXPLAIN ANALYZE SELECT id FROM vectors NEAREST TO [1.0,2.0] LIMIT 5",
+			nodeType: parser.NodeExplain,
+			wantErr:  false,
+		},
+		{
+			name:     "DESCRIBE",
+			query:    "DESCRIBE vectors;",
+			nodeType: parser.NodeDescribe,
+			wantErr:  false,
+		},
+		{
+			name:    "EXPLAIN DELETE",
+			query:   "EXPLAIN DELETE FROM vectors",
+			wantErr: true,
+		},
+		{
+			name:     "ORDER BY",
+			query:    "SELECT id FROM vectors NEAREST TO [1.0,2.0] ORDER BY id DESC LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:     "ORDER BY SCORE",
+			query:    "SELECT id FROM vectors NEAREST TO [1.0,2.0] ORDER BY SCORE(distance, recency 0.2, half_life '7d') LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:     "ORDER BY expression",
+			query:    "SELECT id FROM vectors NEAREST TO [1.0,2.0] ORDER BY distance * 0.8 + metadata.boost * -0.2 LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:     "JOIN",
+			query:    "SELECT v.id, d.content FROM vectors v NEAREST TO [1.0,2.0] JOIN docs d ON d.id = v.id LIMIT 5",
+			nodeType: parser.NodeSelect,
+			wantErr:  false,
+		},
+		{
+			name:    "JOIN without ON",
+			query:   "SELECT id FROM vectors JOIN docs d",
+			wantErr: true,
+		},
+		{
+			name:     "CREATE VIEW",
+			query:    "CREATE VIEW recent_docs AS SELECT id FROM vectors WHERE metadata.type = 'doc'",
+			nodeType: parser.NodeCreateView,
+			wantErr:  false,
+		},
+		{
+			name:     "DROP VIEW",
+			query:    "DROP VIEW recent_docs",
+			nodeType: parser.NodeDropView,
+			wantErr:  false,
+		},
+		{
+			name:    "CREATE VIEW without AS",
+			query:   "CREATE VIEW recent_docs SELECT id FROM vectors",
+			wantErr: true,
+		},
+		{
+			name:    "ORDER without BY",
+			query:   "SELECT id FROM vectors ORDER id",
+			wantErr: true,
+		},
+		{
+			name:    "RETURNING without COUNT",
+			query:   "DROP COLLECTION vectors RETURNING id",
+			wantErr: true,
+		},
 		{
 			name:    "Invalid query",
 			query:   "SELECT FROM WHERE",
 			wantErr: true,
 		},
+		{
+			name:    "Invalid character",
+			query:   "SELECT id FROM vectors WHERE id = 'vec1' #",
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,6 +286,12 @@ func TestSQLExecution(t *testing.T) {
 			want:    "3 row(s) returned",
 			wantErr: false,
 		},
+		{
+			name:    "SELECT with NEAREST TO and WHERE",
+			query:   "SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] WHERE id != 'vec1' LIMIT 10",
+			want:    "4 row(s) returned",
+			wantErr: false,
+		},
 		{
 			name:    "INSERT vector",
 			query:   "INSERT INTO vectors (id, vector) VALUES ('vec6', [6.0,6.0,6.0])",
@@ -187,49 +335,1825 @@ func TestSQLExecution(t *testing.T) {
 	}
 }
 
-// TestHNSWIndexSearch tests the SQL interface with HNSW index
-func TestHNSWIndexSearch(t *testing.T) {
-	// Create a memory store for testing
+// TestFormatOptions tests how the CLI formats vectors and distances
+func TestFormatOptions(t *testing.T) {
+	values := make([]float32, 20)
+	for i := range values {
+		values[i] = float32(i) + 0.125
+	}
+	result := &executor.ResultSet{
+		Columns: []executor.Column{{Name: "id"}, {Name: "distance"}, {Name: "vector"}},
+		Rows:    []executor.Row{{"vec1", float32(0.000123456), values}},
+	}
+
+	format := func(opts cli.FormatOptions) string {
+		out, err := cli.Format(result, opts)
+		if err != nil {
+			t.Fatalf("Format(%+v) error = %v", opts, err)
+		}
+		return out
+	}
+
+	// Long vectors are shortened to whole values and a count of the rest
+	table := format(cli.DefaultFormatOptions())
+	if !strings.Contains(table, "0.000123456") || !strings.Contains(table, "[0.125 1.125 2.125") || !strings.Contains(table, "… +") {
+		t.Errorf("Unexpected default table:\n%s", table)
+	}
+
+	opts := cli.DefaultFormatOptions()
+	opts.Precision = 2
+	opts.FullVectors = true
+	if table := format(opts); !strings.Contains(table, "0.00 ") || !strings.Contains(table, "18.12 19.12]") {
+		t.Errorf("Unexpected full table with precision 2:\n%s", table)
+	}
+
+	opts = cli.FormatOptions{Format: cli.FormatJSON, Precision: 1, Scientific: true}
+	var decoded struct {
+		Columns []string
+		Rows    [][]json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(format(opts)), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if got := string(decoded.Rows[0][1]); got != "1.2e-04" {
+		t.Errorf("Expected distance 1.2e-04, got %s", got)
+	}
+	if got := strings.Join(strings.Fields(string(decoded.Rows[0][2])), ""); !strings.HasPrefix(got, "[1.2e-01,") {
+		t.Errorf("Expected the vector as numbers, got %s", got)
+	}
+
+	if _, err := cli.Format(result, cli.FormatOptions{Format: "xml"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+// TestNearestMetadataFilter tests that WHERE restricts NEAREST TO candidates
+func TestNearestMetadataFilter(t *testing.T) {
 	store := createTestStore()
-	
-	// Create a SQL service with HNSW index
+	for _, id := range []string{"vec2", "vec3"} {
+		v, _ := store.Get(id)
+		v.Metadata["lang"] = "fr"
+		store.Update(v)
+	}
+
 	metric, _ := distance.GetMetric(distance.Euclidean)
-	sqlService := cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
-	
-	// Test query
-	query := "SELECT id, distance FROM vectors NEAREST TO [1.0, 0.0, 0.0] LIMIT 3"
-	result, err := sqlService.Execute(query)
-	
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+
+	result, err := sqlService.Execute("SELECT id, distance FROM vectors NEAREST TO [1.0, 0.0, 0.0] WHERE metadata.lang = 'fr' LIMIT 5")
 	if err != nil {
-		t.Errorf("Execute() error = %v, want nil for query: %s", err, query)
-		return
+		t.Fatalf("Execute() error = %v", err)
 	}
-	
-	if !strings.Contains(result, "vec1") {
-		t.Errorf("HNSW search did not find vec1 which should be closest to [1,0,0]. Result: %s", result)
+	if !strings.Contains(result, "2 row(s) returned") || strings.Contains(result, "vec1") {
+		t.Errorf("Expected only vec2 and vec3, got: %s", result)
 	}
-	
-	if !strings.Contains(result, "3 row(s) returned") {
-		t.Errorf("HNSW search did not return 3 results as requested. Result: %s", result)
+}
+
+func TestOrderBy(t *testing.T) {
+	store := createTestStore()
+	for id, year := range map[string]string{"vec1": "2021", "vec2": "1999", "vec3": "2021", "vec4": "305"} {
+		v, _ := store.Get(id)
+		v.Metadata["year"] = year
+		store.Update(v)
+	}
+
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+
+	ids := func(query string) string {
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", query, err)
+		}
+		ids := []string{}
+		for _, row := range result.Rows {
+			ids = append(ids, fmt.Sprint(row[0]))
+		}
+		return strings.Join(ids, ",")
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// Rows are in ID order by default
+		{"SELECT id FROM vectors", "vec1,vec2,vec3,vec4,vec5"},
+		{"SELECT id FROM vectors ORDER BY id DESC LIMIT 2", "vec5,vec4"},
+		// Numbers sort numerically before other values, equal values by ID.
+		// Vectors without the key sort as "", after every number.
+		{"SELECT id FROM vectors ORDER BY metadata.year", "vec4,vec2,vec1,vec3,vec5"},
+		{"SELECT id FROM vectors ORDER BY metadata.year DESC", "vec5,vec1,vec3,vec2,vec4"},
+		// vec2, vec3 and vec5 are equally distant from [1, 0, 0]
+		{"SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] LIMIT 5", "vec1,vec4,vec2,vec3,vec5"},
+		{"SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] ORDER BY distance DESC LIMIT 3", "vec2,vec4,vec1"},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.query); got != tt.want {
+			t.Errorf("Query(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	if _, err := sqlService.Query("SELECT id FROM vectors ORDER BY distance"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for ORDER BY distance without NEAREST TO, got %v", err)
 	}
 }
 
-// createTestStore creates a test memory store with sample vectors
-func createTestStore() storage.VectorStore {
-	store := storage.NewMemoryStore()
-	
-	// Add some test vectors
-	vectors := []*vector.Vector{
-		vector.NewVector("vec1", []float32{1.0, 0.0, 0.0}),
-		vector.NewVector("vec2", []float32{0.0, 1.0, 0.0}),
-		vector.NewVector("vec3", []float32{0.0, 0.0, 1.0}),
-		vector.NewVector("vec4", []float32{1.0, 1.0, 0.0}),
-		vector.NewVector("vec5", []float32{0.0, 1.0, 1.0}),
+func TestNearestVectorPayload(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeHNSW, metric)
+
+	// Vectors are only fetched for the columns that show them
+	for query, want := range map[string]interface{}{
+		"SELECT id, vector FROM vectors NEAREST TO [0.9, 0.0, 0.0] LIMIT 1":    "[1 0 0]",
+		"SELECT id, dimension FROM vectors NEAREST TO [0.9, 0.0, 0.0] LIMIT 1": 3,
+		"SELECT id FROM vectors NEAREST TO [0.9, 0.0, 0.0] LIMIT 1":            "vec1",
+	} {
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", query, err)
+		}
+		row := result.Rows[0]
+		if row[0] != "vec1" || (len(row) > 2 && fmt.Sprint(row[1]) != fmt.Sprint(want)) {
+			t.Errorf("Query(%q) = %v, want vec1 with %v", query, row, want)
+		}
 	}
-	
-	for _, vec := range vectors {
-		store.Insert(vec)
+}
+
+// countingStore counts the reads that load vector values
+type countingStore struct {
+	storage.VectorStore
+	gets int
+}
+
+func (s *countingStore) Get(id string) (*vector.Vector, error) {
+	s.gets++
+	return s.VectorStore.Get(id)
+}
+
+func (s *countingStore) GetMeta(id string) (*vector.Vector, error) {
+	return storage.GetMeta(s.VectorStore, id)
+}
+
+func TestSelectProjection(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := &countingStore{VectorStore: createTestStore()}
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+
+	// Values are only read from the store for the vector column
+	for query, wantGets := range map[string]int{
+		"SELECT id FROM vectors WHERE id LIKE 'vec%'":      0,
+		"SELECT id, dimension FROM vectors":                0,
+		"SELECT id, vector FROM vectors WHERE id = 'vec1'": 1,
+	} {
+		store.gets = 0
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", query, err)
+		}
+		if store.gets != wantGets {
+			t.Errorf("Query(%q) read %d vectors, want %d", query, store.gets, wantGets)
+		}
+		for _, row := range result.Rows {
+			if len(row) > 1 && row[1] != 3 && fmt.Sprint(row[1]) != "[1 0 0]" {
+				t.Errorf("Query(%q) returned row %v", query, row)
+			}
+		}
 	}
-	
-	return store
-} 
\ No newline at end of file
+}
+
+func TestStreamQuery(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := &countingStore{VectorStore: createTestStore()}
+	qe := executor.NewQueryExecutor(store, executor.IndexTypeFlat, metric)
+
+	// A stream that stops after two rows stops the scan
+	stop := errors.New("stop")
+	var columns []executor.Column
+	var rows []executor.Row
+	err := qe.StreamQueryAs("", "SELECT id, vector FROM vectors", &executor.Stream{
+		Columns: func(c []executor.Column) error {
+			columns = c
+			return nil
+		},
+		Row: func(row executor.Row) error {
+			rows = append(rows, row)
+			if len(rows) == 2 {
+				return stop
+			}
+			return nil
+		},
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("StreamQueryAs error = %v, want %v", err, stop)
+	}
+	if len(columns) != 2 || len(rows) != 2 || rows[1][0] != "vec2" || store.gets != 2 {
+		t.Errorf("Streamed %v %v reading %d vectors", columns, rows, store.gets)
+	}
+
+	// Other statements write their result when done
+	rows = nil
+	err = qe.StreamQueryAs("", "SELECT id, distance FROM vectors NEAREST TO [1,0,0] LIMIT 3", &executor.Stream{
+		Columns: func([]executor.Column) error { return nil },
+		Row: func(row executor.Row) error {
+			rows = append(rows, row)
+			return nil
+		},
+	})
+	if err != nil || len(rows) != 3 || rows[0][0] != "vec1" {
+		t.Errorf("Streamed %v, %v", rows, err)
+	}
+}
+
+func TestPrefixDelete(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := &countingStore{VectorStore: createTestStore()}
+	for _, id := range []string{"session42:a", "session42:b", "session7:a"} {
+		store.Insert(vector.NewVector(id, []float32{1.0, 0.0, 0.0}))
+	}
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+
+	// Only the vectors with the ID prefix are read
+	result, err := sqlService.Query("DELETE FROM vectors WHERE id LIKE 'session42:%'")
+	if err != nil {
+		t.Fatalf("DELETE error = %v", err)
+	}
+	if result.Affected != 2 {
+		t.Errorf("DELETE affected %d rows, want 2", result.Affected)
+	}
+	if store.gets != 2 {
+		t.Errorf("DELETE read %d vectors, want 2", store.gets)
+	}
+
+	// Conditions without a prefix still see every vector
+	result, err = sqlService.Query("SELECT id FROM vectors WHERE id LIKE 'session%' OR id = 'vec1'")
+	if err != nil {
+		t.Fatalf("SELECT error = %v", err)
+	}
+	if len(result.Rows) != 2 {
+		t.Errorf("SELECT returned %v, want session7:a and vec1", result.Rows)
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	counting := &countingStore{VectorStore: createTestStore()}
+	store := storage.NewCachedStore(counting, 0)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+	cache := executor.NewResultCache(8)
+	sqlService.SetResultCache(cache)
+
+	query := func(q string) string {
+		result, err := sqlService.Query(q)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", q, err)
+		}
+		return fmt.Sprint(result.Rows)
+	}
+
+	// Statements differing in case and whitespace share a result
+	first := query("SELECT id, vector FROM vectors WHERE id = 'vec1'")
+	if got := query("select id, vector  from vectors\n where id = 'vec1'"); got != first {
+		t.Errorf("Expected the cached result %s, got %s", first, got)
+	}
+	if counting.gets != 1 {
+		t.Errorf("Expected 1 read of the store, got %d", counting.gets)
+	}
+
+	// Writes through the service or to the store make results stale
+	query("SELECT COUNT(*) FROM vectors")
+	query("INSERT INTO vectors (id, vector) VALUES ('vec6', [1.0, 2.0, 3.0])")
+	if got := query("SELECT COUNT(*) FROM vectors"); got != "[[6]]" {
+		t.Errorf("Expected 6 vectors after the insert, got %s", got)
+	}
+	store.Update(vector.NewVector("vec1", []float32{2.0, 0.0, 0.0}))
+	if got := query("SELECT id, vector FROM vectors WHERE id = 'vec1'"); got != "[[vec1 [2 0 0]]]" {
+		t.Errorf("Expected the updated vector, got %s", got)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+
+	// Stores without an epoch are never cached
+	plain := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+	plain.SetResultCache(executor.NewResultCache(8))
+	plain.Query("SELECT id FROM vectors")
+	plain.Query("DELETE FROM vectors WHERE id = 'vec1'")
+	if result, _ := plain.Query("SELECT id FROM vectors"); len(result.Rows) != 4 {
+		t.Errorf("Expected 4 vectors after the delete, got %v", result.Rows)
+	}
+}
+
+func TestSetStatements(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	global := executor.NewSettings()
+	session := cli.NewSQLService(createTestStore(), executor.IndexTypeHNSW, metric)
+	other := cli.NewSQLService(createTestStore(), executor.IndexTypeHNSW, metric)
+	session.SetSettings(global)
+	other.SetSettings(global)
+
+	query := func(s *cli.SQLService, q string) []executor.Row {
+		result, err := s.Query(q)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", q, err)
+		}
+		return result.Rows
+	}
+	distanceToVec1 := func(s *cli.SQLService) interface{} {
+		return query(s, "SELECT id, distance FROM vectors NEAREST TO [2.0, 0.0, 0.0] LIMIT 1")[0][1]
+	}
+
+	if rows := query(session, "SET ef_search = 200"); fmt.Sprint(rows) != "[[ef_search 200]]" {
+		t.Errorf("Unexpected SET result: %v", rows)
+	}
+
+	// Session settings only change the session
+	query(session, "set default_metric = 'COSINE'")
+	if got := distanceToVec1(session); got != float32(0) {
+		t.Errorf("Expected the cosine distance 0, got %v", got)
+	}
+	if got := distanceToVec1(other); got != float32(1) {
+		t.Errorf("Expected the other session to keep euclidean, got %v", got)
+	}
+
+	// Global settings apply to sessions that have not set their own
+	query(session, "SET default_metric = DEFAULT")
+	query(session, "SET GLOBAL default_metric = cosine")
+	if got := distanceToVec1(other); got != float32(0) {
+		t.Errorf("Expected the global cosine metric, got %v", got)
+	}
+	query(other, "SET default_metric TO euclidean")
+	if got := distanceToVec1(other); got != float32(1) {
+		t.Errorf("Expected the session to override the global metric, got %v", got)
+	}
+
+	for _, q := range []string{"SET ef_search = 0", "SET ef_search = 'many'", "SET default_metric = 'nope'", "SET unknown = 1"} {
+		if _, err := session.Query(q); !errors.Is(err, executor.ErrInvalidArgument) {
+			t.Errorf("Query(%q) error = %v, want ErrInvalidArgument", q, err)
+		}
+	}
+
+	// Executors without a session only take global settings
+	qe := executor.NewQueryExecutor(createTestStore(), executor.IndexTypeFlat, metric)
+	if _, err := qe.ExecuteQuery("SET ef_search = 10"); !errors.Is(err, executor.ErrUnsupportedOperation) {
+		t.Errorf("Expected ErrUnsupportedOperation without a session, got %v", err)
+	}
+	if _, err := qe.ExecuteQuery("SET GLOBAL ef_search = 10"); err != nil {
+		t.Errorf("SET GLOBAL error = %v", err)
+	}
+}
+
+func TestUseStatement(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	cosine, _ := distance.GetMetric(distance.Cosine)
+	session := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+	other := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+	session.SetCollectionMetric("vectors", cosine)
+	other.SetCollectionMetric("vectors", cosine)
+
+	if _, err := session.Query("SELECT id FROM vectors NEAREST TO [2.0, 0.0, 0.0] LIMIT 1"); err != nil {
+		t.Fatalf("SELECT error = %v", err)
+	}
+	if _, err := session.Query("SELECT id LIMIT 1"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery without FROM or USE, got %v", err)
+	}
+
+	result, err := session.Query("USE vectors")
+	if err != nil {
+		t.Fatalf("USE error = %v", err)
+	}
+	if fmt.Sprint(result.Rows) != "[[collection vectors]]" {
+		t.Errorf("Unexpected USE result: %v", result.Rows)
+	}
+	if session.Collection() != "vectors" || other.Collection() != "" {
+		t.Errorf("Expected USE to change only its session, got %q and %q", session.Collection(), other.Collection())
+	}
+
+	// SELECT without FROM reads the collection in use, with its metric
+	result, err = session.Query("SELECT id, distance NEAREST TO [2.0, 0.0, 0.0] LIMIT 1")
+	if err != nil {
+		t.Fatalf("SELECT without FROM error = %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != float32(0) {
+		t.Errorf("Expected the cosine distance 0, got %v", result.Rows)
+	}
+	if _, err := other.Query("SELECT id LIMIT 1"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected the other session to need FROM, got %v", err)
+	}
+
+	// Verbosity is a session setting too
+	if _, err := session.Query("SET verbose = on"); err != nil {
+		t.Fatalf("SET verbose error = %v", err)
+	}
+	if got := fmt.Sprint(session.Session()); got != "map[collection:vectors verbose:true]" {
+		t.Errorf("Unexpected session settings: %s", got)
+	}
+	if _, err := session.Query("SET verbose = maybe"); !errors.Is(err, executor.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument, got %v", err)
+	}
+
+	qe := executor.NewQueryExecutor(createTestStore(), executor.IndexTypeFlat, metric)
+	if _, err := qe.ExecuteQuery("USE vectors"); !errors.Is(err, executor.ErrUnsupportedOperation) {
+		t.Errorf("Expected ErrUnsupportedOperation without a session, got %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+
+	result, err := sqlService.Query("EXPLAIN ANALYZE SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] WHERE id != 'vec2' LIMIT 2")
+	if err != nil {
+		t.Fatalf("EXPLAIN ANALYZE error = %v", err)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][0] != "vec1" {
+		t.Fatalf("Unexpected EXPLAIN ANALYZE rows: %v", result.Rows)
+	}
+	row := map[string]interface{}{}
+	for i, col := range result.Columns {
+		row[col.Name] = result.Rows[0][i]
+	}
+	// The flat index scans the 4 vectors left by the filter
+	if row["total_distance_computations"] != 4 || row["total_hops"] != 0 || row["filter_pruned"] != true {
+		t.Errorf("Unexpected EXPLAIN ANALYZE row: %v", row)
+	}
+	if found := row["distance_computations"].(int); found < 1 || found > 4 {
+		t.Errorf("Expected vec1 to be found within 4 distances, got %d", found)
+	}
+
+	result, err = sqlService.Query("EXPLAIN SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] LIMIT 2")
+	if err != nil {
+		t.Fatalf("EXPLAIN error = %v", err)
+	}
+	if len(result.Rows) == 0 || !strings.HasPrefix(result.Rows[0][0].(string), "VECTOR_SEARCH") {
+		t.Errorf("Unexpected plan: %v", result.Rows)
+	}
+
+	if _, err := sqlService.Query("EXPLAIN ANALYZE SELECT id FROM vectors"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery without NEAREST TO, got %v", err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	store := createTestStore()
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+	sqlService.SetDryRun(true)
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{"DELETE FROM vectors WHERE id LIKE 'vec%' RETURNING COUNT", 5},
+		{"DELETE FROM vectors WHERE id = 'vec1'", "Would delete 1 vectors (dry run)"},
+		{"DROP COLLECTION vectors RETURNING COUNT", 5},
+		{"INSERT INTO vectors (id, vector) VALUES ('vec6', [1.0, 2.0, 3.0])", "Would insert 1 vector"},
+	}
+	for _, tt := range tests {
+		result, err := sqlService.Query(tt.query)
+		if err != nil {
+			t.Fatalf("Query(%q) error = %v", tt.query, err)
+		}
+		if len(result.Rows) != 1 || !strings.HasPrefix(fmt.Sprint(result.Rows[0][0]), fmt.Sprint(tt.want)) {
+			t.Errorf("Query(%q) = %v, want %v", tt.query, result.Rows, tt.want)
+		}
+	}
+
+	if count, _ := store.Count(); count != 5 {
+		t.Errorf("Dry run modified the store: %d vectors left", count)
+	}
+
+	// Without dry run RETURNING COUNT reports the deleted vectors
+	sqlService.SetDryRun(false)
+	result, err := sqlService.Query("DELETE FROM vectors WHERE id = 'vec1' RETURNING COUNT")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Columns[0].Name != "count" || result.Rows[0][0] != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if count, _ := store.Count(); count != 4 {
+		t.Errorf("Expected 4 vectors after the delete, got %d", count)
+	}
+}
+
+func TestDropRequiresConfirm(t *testing.T) {
+	store := createTestStore()
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+
+	if _, err := sqlService.Query("DROP COLLECTION vectors"); !errors.Is(err, executor.ErrConfirmationRequired) {
+		t.Fatalf("Expected ErrConfirmationRequired, got %v", err)
+	}
+	if count, _ := store.Count(); count != 5 {
+		t.Fatalf("DROP without CONFIRM modified the store: %d vectors left", count)
+	}
+
+	result, err := sqlService.Query("DROP COLLECTION vectors CONFIRM RETURNING COUNT")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Rows[0][0] != 5 {
+		t.Errorf("Expected 5 dropped vectors, got %v", result.Rows[0][0])
+	}
+	if count, _ := store.Count(); count != 0 {
+		t.Errorf("Expected an empty store after DROP, got %d vectors", count)
+	}
+}
+
+// TestHNSWIndexSearch tests the SQL interface with HNSW index
+func TestHNSWIndexSearch(t *testing.T) {
+	// Create a memory store for testing
+	store := createTestStore()
+	
+	// Create a SQL service with HNSW index
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
+	
+	// Test query
+	query := "SELECT id, distance FROM vectors NEAREST TO [1.0, 0.0, 0.0] LIMIT 3"
+	result, err := sqlService.Execute(query)
+	
+	if err != nil {
+		t.Errorf("Execute() error = %v, want nil for query: %s", err, query)
+		return
+	}
+	
+	if !strings.Contains(result, "vec1") {
+		t.Errorf("HNSW search did not find vec1 which should be closest to [1,0,0]. Result: %s", result)
+	}
+	
+	if !strings.Contains(result, "3 row(s) returned") {
+		t.Errorf("HNSW search did not return 3 results as requested. Result: %s", result)
+	}
+}
+
+// TestEmbeddingFunction tests EMBEDDING() with per-collection models
+func TestEmbeddingFunction(t *testing.T) {
+	store := storage.NewMemoryStore()
+	metric, _ := distance.GetMetric(distance.Cosine)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+	
+	models := embedding.NewRegistry()
+	defer models.Close()
+	models.Register("mpnet", embedding.ModelSpec{Model: "sentence-transformers/all-mpnet-base-v2"})
+	models.Register("clip", embedding.ModelSpec{Provider: embedding.ProviderCLIP, Model: "clip-vit", Endpoint: "http://localhost", Dimension: 512})
+	sqlService.SetModelRegistry(models)
+	
+	// Inserted embeddings record the collection's model
+	for _, query := range []string{
+		"INSERT INTO vectors (id, vector) VALUES ('doc1', EMBEDDING('vector databases'))",
+		"INSERT INTO vectors (id, vector) VALUES ('doc2', EMBEDDING('cooking recipes'))",
+	} {
+		if _, err := sqlService.Execute(query); err != nil {
+			t.Fatalf("Execute() error = %v for query: %s", err, query)
+		}
+	}
+	
+	ids, err := store.List()
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("Expected 2 vectors, got %v (err = %v)", ids, err)
+	}
+	v, err := store.Get(ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get inserted vector: %v", err)
+	}
+	if v.Dimension != 384 || v.Metadata[embedding.MetadataKeyModel] != "sentence-transformers/all-MiniLM-L6-v2" {
+		t.Errorf("Unexpected embedded vector: dimension %d, metadata %v", v.Dimension, v.Metadata)
+	}
+	
+	result, err := sqlService.Execute("SELECT id, distance FROM vectors NEAREST TO EMBEDDING('vector databases') LIMIT 1")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(result, "doc1") {
+		t.Errorf("Expected doc1 to be the nearest neighbor, result = %q", result)
+	}
+	
+	// Queries may be embedded with another model of the same dimension
+	if _, err := sqlService.Execute("SELECT id FROM vectors NEAREST TO EMBEDDING('vector databases', 'mpnet') LIMIT 1"); err != nil {
+		t.Errorf("Execute() with a model override error = %v", err)
+	}
+	_, err = sqlService.Execute("SELECT id FROM vectors NEAREST TO EMBEDDING('vector databases', 'clip') LIMIT 1")
+	if !errors.Is(err, vector.ErrInvalidDimension) {
+		t.Errorf("Expected ErrInvalidDimension, got %v", err)
+	}
+	
+	// Inserted embeddings must still use the collection's model
+	_, err = sqlService.Execute("INSERT INTO vectors (id, vector) VALUES ('doc3', EMBEDDING('sailing', 'mpnet'))")
+	if !errors.Is(err, embedding.ErrModelMismatch) {
+		t.Errorf("Expected ErrModelMismatch, got %v", err)
+	}
+	
+	// Rebinding the collection makes the stored vectors mismatch
+	models.Bind("vectors", "mpnet")
+	_, err = sqlService.Execute("SELECT id FROM vectors NEAREST TO EMBEDDING('vector databases') LIMIT 1")
+	if !errors.Is(err, embedding.ErrModelMismatch) {
+		t.Errorf("Expected ErrModelMismatch after rebinding, got %v", err)
+	}
+}
+
+// TestDimensionAdapter tests searching with vectors from a model of another dimension
+func TestDimensionAdapter(t *testing.T) {
+	store := createTestStore()
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+	
+	// Map 4-dimensional vectors onto the store's 3 dimensions by dropping the last one
+	adapters := projection.NewAdapters(3)
+	p, err := projection.NewMatrixProjection([][]float32{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}})
+	if err != nil {
+		t.Fatalf("Failed to create projection: %v", err)
+	}
+	adapters.Add(p)
+	sqlService.SetVectorAdapter(adapters)
+	
+	result, err := sqlService.Execute("SELECT id, distance FROM vectors NEAREST TO [1.0,0.1,0.0,9.0] LIMIT 1")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if !strings.Contains(result, "vec1") {
+		t.Errorf("Expected vec1 to be the nearest neighbor, result = %q", result)
+	}
+	
+	// Inserted vectors are stored in the collection's dimension
+	if _, err := sqlService.Execute("INSERT INTO vectors (id, vector) VALUES ('vec9', [2.0,2.0,2.0,2.0])"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	ids, _ := store.List()
+	if len(ids) != 6 {
+		t.Fatalf("Expected 6 vectors after insert, got %d", len(ids))
+	}
+	for _, id := range ids {
+		v, _ := store.Get(id)
+		if v.Dimension != 3 {
+			t.Errorf("Expected all vectors to have dimension 3, %s has %d", id, v.Dimension)
+		}
+	}
+}
+
+// createTestStore creates a test memory store with sample vectors
+func TestIndexCache(t *testing.T) {
+	store := createTestStore()
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	dir := t.TempDir()
+	sqlService := cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
+	sqlService.SetIndexCache(executor.NewIndexCache(dir))
+
+	nearest := func(service *cli.SQLService) string {
+		result, err := service.Query("SELECT id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1")
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		// INSERT keeps the quotes around IDs
+		return strings.Trim(fmt.Sprint(result.Rows[0][0]), "'")
+	}
+
+	if got := nearest(sqlService); got != "vec4" {
+		t.Errorf("Expected vec4, got %s", got)
+	}
+	if sqlService.IndexCache().Len() != 1 {
+		t.Fatalf("Expected one cached index, got %d", sqlService.IndexCache().Len())
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "vectors-euclidean-hnsw.*")); len(files) != 2 {
+		t.Errorf("Expected the index and its metadata to be saved, got %v", files)
+	}
+
+	// Filtered searches build their own index
+	if _, err := sqlService.Query("SELECT id FROM vectors NEAREST TO [2.0, 2.0, 0.0] WHERE id = 'vec1' LIMIT 1"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if sqlService.IndexCache().Len() != 1 {
+		t.Errorf("Expected filtered searches not to be cached")
+	}
+
+	// Writes through SQL invalidate the cache
+	if _, err := sqlService.Query("INSERT INTO vectors (id, vector) VALUES ('vec6', [2.0, 2.0, 0.0])"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if sqlService.IndexCache().Len() != 0 {
+		t.Errorf("Expected the insert to invalidate the cache")
+	}
+	if got := nearest(sqlService); got != "vec6" {
+		t.Errorf("Expected vec6, got %s", got)
+	}
+
+	// A new process reuses the saved index, unless the store changed
+	reopened := cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
+	reopened.SetIndexCache(executor.NewIndexCache(dir))
+	if got := nearest(reopened); got != "vec6" {
+		t.Errorf("Expected vec6 from the saved index, got %s", got)
+	}
+
+	store.Insert(vector.NewVector("vec7", []float32{2.0, 2.0, 0.1}))
+	store.Delete("'vec6'")
+	reopened = cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
+	reopened.SetIndexCache(executor.NewIndexCache(dir))
+	if got := nearest(reopened); got != "vec7" {
+		t.Errorf("Expected the stale saved index to be rebuilt, got %s", got)
+	}
+}
+
+func TestTieredIndexSearch(t *testing.T) {
+	store := createTestStore()
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeTiered, metric)
+	sqlService.SetIndexCache(executor.NewIndexCache(""))
+	sqlService.SetTiering(&tiered.Options{Probes: 1, Candidates: 5, HotSize: 1, MinHits: 1.5, RetierEvery: 2, Access: tiered.NewAccessStats(0)})
+
+	nearest := func() string {
+		result, err := sqlService.Query("SELECT id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1")
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		return strings.Trim(fmt.Sprint(result.Rows[0][0]), "'")
+	}
+	tiers := func() *tiered.Stats {
+		indexes := sqlService.IndexCache().Indexes()
+		if len(indexes) != 1 || indexes[0].Tiers == nil {
+			t.Fatalf("Expected one tiered index, got %+v", indexes)
+		}
+		return indexes[0].Tiers
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := nearest(); got != "vec4" {
+			t.Errorf("Expected vec4, got %s", got)
+		}
+	}
+	if stats := tiers(); stats.Hot != 1 || stats.Promotions != 1 || stats.Clusters != 3 {
+		t.Errorf("Expected vec4 to be promoted, got %+v", stats)
+	}
+
+	// The index rebuilt after a write keeps vec4 hot
+	if _, err := sqlService.Query("INSERT INTO vectors (id, vector) VALUES ('vec6', [5.0, 5.0, 5.0])"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got := nearest(); got != "vec4" {
+		t.Errorf("Expected vec4, got %s", got)
+	}
+	if stats := tiers(); stats.Hot != 1 || stats.HotHits != 1 || stats.Cold != 5 {
+		t.Errorf("Expected vec4 to be served hot after the rebuild, got %+v", stats)
+	}
+}
+
+func TestCollectionMetric(t *testing.T) {
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	cosine, _ := distance.GetMetric(distance.Cosine)
+	sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeHNSW, euclidean)
+	sqlService.SetCollectionMetric("docs", cosine)
+
+	// Searches default to the collection's metric
+	if _, err := sqlService.Query("SELECT id FROM docs NEAREST TO [2.0, 2.0, 0.0] LIMIT 1"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if indexes := sqlService.IndexCache().Indexes(); len(indexes) != 1 || indexes[0].Metric != "cosine" {
+		t.Errorf("Expected a cosine index for docs, got %+v", indexes)
+	}
+
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"SELECT id FROM docs NEAREST TO [2.0, 2.0, 0.0] USING cosine LIMIT 1", false},
+		{"SELECT id FROM docs NEAREST TO [2.0, 2.0, 0.0] USING euclidean LIMIT 1", true},
+		{"SELECT id FROM vectors NEAREST TO [2.0, 2.0, 0.0] USING cosine LIMIT 1", false},
+	}
+	for _, tt := range tests {
+		_, err := sqlService.Query(tt.query)
+		if tt.wantErr != errors.Is(err, executor.ErrMetricMismatch) {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+		}
+	}
+
+	// The collection keeps its metric when the default changes
+	sqlService.SetMetric(cosine)
+	if _, err := sqlService.Query("SELECT id FROM docs NEAREST TO [2.0, 2.0, 0.0] USING euclidean LIMIT 1"); !errors.Is(err, executor.ErrMetricMismatch) {
+		t.Errorf("Expected ErrMetricMismatch after SetMetric, got %v", err)
+	}
+	if _, err := sqlService.RebuildIndex(executor.RebuildOptions{Collection: "docs", Metric: euclidean}); !errors.Is(err, executor.ErrMetricMismatch) {
+		t.Errorf("Expected the rebuild to be rejected, got %v", err)
+	}
+}
+
+func TestTimestampColumns(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for i, id := range []string{"old", "new"} {
+		v := vector.NewVector(id, []float32{float32(i), 1.0})
+		v.CreatedAt = time.Date(2024, time.Month(1+i*5), 1, 0, 0, 0, 0, time.UTC)
+		if err := store.Insert(v); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT id FROM vectors WHERE created_at > '2024-03-01'", []string{"new"}},
+		{"SELECT id FROM vectors WHERE created_at <= '2024-01-01T00:00:00Z'", []string{"old"}},
+		{"SELECT id FROM vectors WHERE updated_at >= '2024-01-01' ORDER BY created_at DESC", []string{"new", "old"}},
+	}
+	for _, tt := range tests {
+		result, err := sqlService.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", tt.query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Updates keep the creation time and record when they happened
+	v, _ := store.Get("old")
+	v.Metadata["k"] = "v"
+	if err := store.Update(v); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	result, err := sqlService.Query("SELECT id, created_at, updated_at FROM vectors WHERE updated_at > '2025-01-01'")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != "2024-01-01T00:00:00Z" || result.Rows[0][2] == "" {
+		t.Errorf("Expected old with its creation time and an update time, got %v", result.Rows)
+	}
+
+	if _, err := sqlService.Query("SELECT id FROM vectors WHERE updated_at > 'yesterday'"); !errors.Is(err, executor.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for an invalid timestamp, got %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	store := storage.NewSchemaStore(storage.NewMemoryStore())
+	store.AddSchema(storage.Schema{Collection: "docs", Fields: []storage.SchemaField{
+		{Name: "category", Type: storage.FieldString, Required: true},
+		{Name: "year", Type: storage.FieldInt},
+	}})
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	result, err := sqlService.Query("DESCRIBE docs")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	last := result.Rows[len(result.Rows)-1]
+	if result.Rows[0][0] != "id" || last[0] != "metadata.year" || last[1] != "int" || last[2] != false {
+		t.Errorf("Unexpected description %v", result.Rows)
+	}
+	if result, _ := sqlService.Query("DESCRIBE vectors"); len(result.Rows) != 7 {
+		t.Errorf("Expected only the built-in columns without a schema, got %v", result.Rows)
+	}
+
+	// Inserts without the required field are rejected
+	if _, err := sqlService.Query("INSERT INTO docs (id, vector) VALUES ('d1', [1.0, 2.0])"); !errors.Is(err, storage.ErrSchemaViolation) {
+		t.Errorf("Expected ErrSchemaViolation, got %v", err)
+	}
+	if _, err := sqlService.Query("DESCRIBE"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery without a collection, got %v", err)
+	}
+}
+
+func TestGeoFilter(t *testing.T) {
+	store := storage.NewMemoryStore()
+	places := []struct {
+		id, loc string
+		values  []float32
+	}{
+		{"amsterdam-cafe", "52.3731,4.8922", []float32{1, 0}},
+		{"amsterdam-museum", "52.3600,4.8852", []float32{0, 1}},
+		{"haarlem-cafe", "52.3874,4.6462", []float32{1, 0.1}},
+		{"paris-cafe", "48.8566,2.3522", []float32{1, 0}},
+		{"sydney-cafe", "-33.8688,151.2093", []float32{1, 0}},
+		{"nowhere", "", []float32{1, 0}},
+	}
+	for _, p := range places {
+		v := vector.NewVector(p.id, p.values)
+		if p.loc != "" {
+			v.Metadata["loc"] = p.loc
+			lat, lon, _ := strings.Cut(p.loc, ",")
+			v.Metadata["lat"], v.Metadata["lon"] = lat, lon
+		}
+		store.Insert(v)
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, 52.37, 4.89) < 10km", []string{"amsterdam-cafe", "amsterdam-museum"}},
+		{"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, 52.37, 4.89) < 500 m", []string{"amsterdam-cafe"}},
+		{"SELECT id FROM vectors WHERE GEO_DIST(metadata.lat, metadata.lon, 52.37, 4.89) <= 20", []string{"amsterdam-cafe", "amsterdam-museum", "haarlem-cafe"}},
+		{"SELECT id FROM vectors WHERE 100mi < GEO_DIST(metadata.loc, -33.87, 151.21) AND id LIKE 'paris%'", []string{"paris-cafe"}},
+		{"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, -33.87, 151.21) < 1", []string{"sydney-cafe"}},
+		// Similar items near me
+		{"SELECT id FROM vectors NEAREST TO [1.0, 0.0] WHERE GEO_DIST(metadata.loc, 52.37, 4.89) < 25km LIMIT 2", []string{"amsterdam-cafe", "haarlem-cafe"}},
+	}
+	for _, tt := range tests {
+		result, err := sqlService.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", tt.query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		sort.Strings(got)
+		want := append([]string{}, tt.want...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, want)
+		}
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, 95, 4.89) < 10km",
+		"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, 52.37) < 10km",
+		"SELECT id FROM vectors WHERE GEO_DIST(metadata.loc, 52.37, 4.89) < 'far'",
+	} {
+		if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument, got %v", query, err)
+		}
+	}
+
+	// Vectors of coordinates can be searched by great-circle distance
+	coords := storage.NewMemoryStore()
+	coords.Insert(vector.NewVector("amsterdam", []float32{52.37, 4.89}))
+	coords.Insert(vector.NewVector("paris", []float32{48.86, 2.35}))
+	result, err := cli.NewSQLService(coords, executor.IndexTypeFlat, euclidean).Query("SELECT id, distance FROM vectors NEAREST TO [51.51, -0.13] USING haversine LIMIT 1")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "paris" {
+		t.Errorf("Expected Paris to be nearest to London, got %v", result.Rows)
+	}
+}
+
+func TestScoreOrder(t *testing.T) {
+	store := storage.NewMemoryStore()
+	now := time.Now().UTC()
+	for _, v := range []struct {
+		id     string
+		values []float32
+		age    time.Duration
+	}{
+		{"old-exact", []float32{1, 0}, 30 * 24 * time.Hour},
+		{"new-close", []float32{1, 0.2}, time.Hour},
+		{"new-far", []float32{0, 1}, 0},
+	} {
+		vec := vector.NewVector(v.id, v.values)
+		vec.CreatedAt = now.Add(-v.age)
+		vec.Metadata["published"] = vec.CreatedAt.Format(time.RFC3339)
+		store.Insert(vec)
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	ids := func(query string) []string {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		return got
+	}
+
+	// Without recency the score follows the distance
+	if got := ids("SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance) LIMIT 3"); !reflect.DeepEqual(got, []string{"old-exact", "new-close", "new-far"}) {
+		t.Errorf("Expected distance order, got %v", got)
+	}
+	// Recency lifts the close recent vector over the exact old one
+	if got := ids("SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, recency 0.2) LIMIT 2"); !reflect.DeepEqual(got, []string{"new-close", "old-exact"}) {
+		t.Errorf("Expected new-close first, got %v", got)
+	}
+	// Even from beyond the limit, and on a metadata time
+	if got := ids("SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, recency 0.9, half_life '1h', field metadata.published) LIMIT 1"); !reflect.DeepEqual(got, []string{"new-far"}) {
+		t.Errorf("Expected new-far first, got %v", got)
+	}
+
+	result, err := sqlService.Query("SELECT id, score FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, recency 0.5) DESC LIMIT 3")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(result.Rows) != 3 || result.Rows[0][1].(float32) < result.Rows[2][1].(float32) {
+		t.Errorf("Expected descending scores, got %v", result.Rows)
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, recency 2) LIMIT 1",
+		"SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, half_life 'soon') LIMIT 1",
+		"SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY SCORE(distance, boost 1) LIMIT 1",
+	} {
+		if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument, got %v", query, err)
+		}
+	}
+	if _, err := sqlService.Query("SELECT id FROM vectors ORDER BY SCORE(distance)"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery without NEAREST TO, got %v", err)
+	}
+}
+
+// churningStore invalidates an index cache on its first listings, like
+// writes landing while an index is rebuilt
+type churningStore struct {
+	storage.VectorStore
+	cache  *executor.IndexCache
+	writes int
+}
+
+func (s *churningStore) List() ([]string, error) {
+	if s.writes > 0 {
+		s.writes--
+		s.cache.Invalidate()
+	}
+	return s.VectorStore.List()
+}
+
+func TestIndexRebuild(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+
+	nearest := func() string {
+		result, err := sqlService.Query("SELECT id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1")
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		return fmt.Sprint(result.Rows[0][0])
+	}
+	if got := nearest(); got != "vec4" {
+		t.Fatalf("Expected vec4, got %s", got)
+	}
+
+	cfg := hnsw.NewHNSWConfig(8, 50, 20)
+	info, err := sqlService.RebuildIndex(executor.RebuildOptions{Collection: "vectors", IndexType: executor.IndexTypeHNSW, HNSW: &cfg})
+	if err != nil {
+		t.Fatalf("RebuildIndex() error = %v", err)
+	}
+	if info.Type != executor.IndexTypeHNSW || info.Vectors != 5 || info.Rebuilding {
+		t.Errorf("Unexpected index info: %+v", info)
+	}
+
+	// Queries from now on use the swapped-in index instead of building one
+	if got := nearest(); got != "vec4" {
+		t.Errorf("Expected vec4 from the rebuilt index, got %s", got)
+	}
+	indexes := sqlService.IndexCache().Indexes()
+	if len(indexes) != 2 || indexes[1].Type != executor.IndexTypeHNSW {
+		t.Errorf("Expected the flat and rebuilt hnsw indexes, got %+v", indexes)
+	}
+
+	if _, err := sqlService.RebuildIndex(executor.RebuildOptions{IndexType: executor.IndexTypeHNSW}); !errors.Is(err, executor.ErrInvalidArgument) {
+		t.Errorf("Expected a missing collection to be rejected, got %v", err)
+	}
+	if _, err := sqlService.RebuildIndex(executor.RebuildOptions{Collection: "vectors", IndexType: "ivf"}); !errors.Is(err, executor.ErrInvalidArgument) {
+		t.Errorf("Expected an unknown index type to be rejected, got %v", err)
+	}
+}
+
+func TestIndexRebuildRetriesAfterWrites(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	cache := executor.NewIndexCache("")
+	store := &churningStore{VectorStore: createTestStore(), cache: cache, writes: 1}
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, metric)
+	sqlService.SetIndexCache(cache)
+
+	// A write during the first pass makes it start over
+	if _, err := sqlService.RebuildIndex(executor.RebuildOptions{Collection: "vectors", IndexType: executor.IndexTypeHNSW}); err != nil {
+		t.Fatalf("RebuildIndex() error = %v", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected the rebuilt index to be cached, got %d", cache.Len())
+	}
+
+	// A store that never settles leaves the current index in place
+	store.writes = 10
+	_, err := sqlService.RebuildIndex(executor.RebuildOptions{Collection: "vectors", IndexType: executor.IndexTypeFlat})
+	if !errors.Is(err, executor.ErrStoreChanged) {
+		t.Errorf("Expected ErrStoreChanged, got %v", err)
+	}
+}
+
+func createTestStore() storage.VectorStore {
+	store := storage.NewMemoryStore()
+	
+	// Add some test vectors
+	vectors := []*vector.Vector{
+		vector.NewVector("vec1", []float32{1.0, 0.0, 0.0}),
+		vector.NewVector("vec2", []float32{0.0, 1.0, 0.0}),
+		vector.NewVector("vec3", []float32{0.0, 0.0, 1.0}),
+		vector.NewVector("vec4", []float32{1.0, 1.0, 0.0}),
+		vector.NewVector("vec5", []float32{0.0, 1.0, 1.0}),
+	}
+	
+	for _, vec := range vectors {
+		store.Insert(vec)
+	}
+	
+	return store
+} 
+
+func TestOrderByExpression(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for _, v := range []struct {
+		id     string
+		values []float32
+		boost  string
+	}{
+		{"a", []float32{1, 0}, "0"},
+		{"b", []float32{1, 0.5}, "10"},
+		{"c", []float32{0, 1}, "1"},
+		{"d", []float32{0.9, 0}, ""},
+	} {
+		vec := vector.NewVector(v.id, v.values)
+		if v.boost != "" {
+			vec.Metadata["boost"] = v.boost
+		}
+		store.Insert(vec)
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	ids := func(query string) []string {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		return got
+	}
+
+	// The boost lifts b over the nearer a and d
+	if got := ids("SELECT id FROM vectors NEAREST TO [1.0, 0.0] ORDER BY distance * 0.8 + metadata.boost * -0.2 LIMIT 2"); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("Expected boosted order, got %v", got)
+	}
+	// Without NEAREST TO, vectors without the key count as 0 and ties keep ID order
+	if got := ids("SELECT id FROM vectors ORDER BY -metadata.boost"); !reflect.DeepEqual(got, []string{"b", "c", "a", "d"}) {
+		t.Errorf("Expected negated boost order, got %v", got)
+	}
+	if got := ids("SELECT id FROM vectors ORDER BY (metadata.boost + 1) * 2 DESC LIMIT 1"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Expected b first, got %v", got)
+	}
+
+	if _, err := sqlService.Query("SELECT id FROM vectors ORDER BY distance * 2"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for distance without NEAREST TO, got %v", err)
+	}
+	if _, err := sqlService.Query("SELECT id FROM vectors ORDER BY metadata.boost / 0"); !errors.Is(err, executor.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument for division by zero, got %v", err)
+	}
+}
+
+func TestJoinDocs(t *testing.T) {
+	store := storage.NewMemoryStore()
+	docsDir := t.TempDir()
+	for _, v := range []struct {
+		id     string
+		values []float32
+		text   string
+	}{
+		{"a", []float32{1, 0}, "apples"},
+		{"b", []float32{0.9, 0.1}, ""},
+		{"c", []float32{0, 1}, "cherries"},
+	} {
+		vec := vector.NewVector(v.id, v.values)
+		vec.Metadata["lang"] = "en"
+		store.Insert(vec)
+		if v.text == "" {
+			continue
+		}
+		doc := embedding.NewDocument(v.id, v.text, embedding.ContentTypeText)
+		doc.SetMetadata("source", v.id+".txt")
+		data, err := doc.ToJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(embedding.DocumentPath(docsDir, v.id), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	query := "SELECT v.id, d.content FROM vectors v NEAREST TO [1.0, 0.0] JOIN docs d ON d.id = v.id LIMIT 3"
+	if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrUnsupportedOperation) {
+		t.Errorf("Expected ErrUnsupportedOperation without a document store, got %v", err)
+	}
+	sqlService.SetDocsDir(docsDir)
+
+	// b has no document, so it is left out
+	result, err := sqlService.Query(query)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	var names []string
+	for _, col := range result.Columns {
+		names = append(names, col.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"id", "content", "distance"}) {
+		t.Errorf("Expected columns id, content and distance, got %v", names)
+	}
+	if len(result.Rows) != 2 || result.Rows[0][0] != "a" || result.Rows[0][1] != "apples" || result.Rows[1][1] != "cherries" {
+		t.Errorf("Expected a and c with their texts, got %v", result.Rows)
+	}
+
+	// Scans join too, and the vector columns may be qualified anywhere
+	result, err = sqlService.Query("SELECT docs.metadata.source AS source FROM vectors AS v JOIN docs ON v.id = docs.id WHERE v.metadata.lang = 'en' ORDER BY v.id DESC")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Columns[0].Name != "source" || len(result.Rows) != 2 || result.Rows[0][0] != "c.txt" || result.Rows[1][0] != "a.txt" {
+		t.Errorf("Expected the sources of c and a, got %v %v", result.Columns, result.Rows)
+	}
+
+	for _, query := range []string{
+		"SELECT v.id FROM vectors v JOIN texts t ON t.id = v.id",
+		"SELECT v.id FROM vectors v JOIN docs d ON d.content = v.id",
+		"SELECT v.id FROM vectors v JOIN docs d ON d.id = v.id WHERE d.content = 'apples'",
+		"SELECT COUNT(*) FROM vectors v JOIN docs d ON d.id = v.id",
+	} {
+		if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrUnsupportedOperation) {
+			t.Errorf("%s: expected ErrUnsupportedOperation, got %v", query, err)
+		}
+	}
+}
+
+func TestViews(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for _, v := range []struct {
+		id     string
+		values []float32
+		kind   string
+		year   string
+	}{
+		{"a", []float32{1, 0}, "doc", "2020"},
+		{"b", []float32{0, 1}, "doc", "2024"},
+		{"c", []float32{1, 0.1}, "img", "2024"},
+	} {
+		vec := vector.NewVector(v.id, v.values)
+		vec.Metadata["type"] = v.kind
+		vec.Metadata["year"] = v.year
+		store.Insert(vec)
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+
+	ids := func(query string) []string {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		var got []string
+		for _, row := range result.Rows {
+			got = append(got, row[0].(string))
+		}
+		return got
+	}
+
+	if _, err := sqlService.Query("CREATE VIEW docs_only AS SELECT id, dimension FROM vectors WHERE metadata.type = 'doc';"); err != nil {
+		t.Fatalf("CREATE VIEW failed: %v", err)
+	}
+	if got := ids("SELECT id FROM docs_only"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Expected the docs, got %v", got)
+	}
+	if got := ids("SELECT id FROM docs_only WHERE metadata.year = '2024'"); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Expected the recent doc, got %v", got)
+	}
+	// c is nearer, but not a doc
+	if got := ids("SELECT id FROM docs_only d NEAREST TO [1.0, 0.2] LIMIT 1"); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Expected a, got %v", got)
+	}
+	result, err := sqlService.Query("SELECT * FROM docs_only LIMIT 1")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(result.Columns) != 2 || result.Columns[1].Name != "dimension" || result.Rows[0][1] != 2 {
+		t.Errorf("Expected SELECT * to select the view's columns, got %v %v", result.Columns, result.Rows)
+	}
+
+	if _, err := sqlService.Query("CREATE VIEW docs_only AS SELECT id FROM vectors"); !errors.Is(err, executor.ErrViewExists) {
+		t.Errorf("Expected ErrViewExists, got %v", err)
+	}
+	for _, query := range []string{
+		"CREATE VIEW searched AS SELECT id FROM vectors NEAREST TO [1.0, 0.0]",
+		"CREATE VIEW first AS SELECT id FROM vectors LIMIT 1",
+		"CREATE VIEW nested AS SELECT id FROM docs_only",
+	} {
+		if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrUnsupportedOperation) {
+			t.Errorf("%s: expected ErrUnsupportedOperation, got %v", query, err)
+		}
+	}
+
+	// Once dropped, the name is read as a collection again
+	if _, err := sqlService.Query("DROP VIEW docs_only"); err != nil {
+		t.Fatalf("DROP VIEW failed: %v", err)
+	}
+	if got := ids("SELECT id FROM docs_only"); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("Expected every vector, got %v", got)
+	}
+	if _, err := sqlService.Query("DROP VIEW docs_only"); !errors.Is(err, executor.ErrViewNotFound) {
+		t.Errorf("Expected ErrViewNotFound, got %v", err)
+	}
+}
+
+func TestQueryHints(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewCachedStore(createTestStore(), 0)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeHNSW, metric)
+	sqlService.SetIndexCache(executor.NewIndexCache(""))
+	results := executor.NewResultCache(8)
+	sqlService.SetResultCache(results)
+
+	nearest := func(query string) string {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		return strings.Trim(fmt.Sprint(result.Rows[0][0]), "'")
+	}
+
+	// INDEX overrides the configured index type for one query
+	if got := nearest("SELECT /*+ INDEX(flat) */ id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1"); got != "vec4" {
+		t.Errorf("Expected vec4, got %s", got)
+	}
+	indexes := sqlService.IndexCache().Indexes()
+	if len(indexes) != 1 || indexes[0].Type != executor.IndexTypeFlat {
+		t.Errorf("Expected a cached flat index, got %+v", indexes)
+	}
+
+	// NO_CACHE skips both the index and the result cache
+	for i := 0; i < 2; i++ {
+		if got := nearest("SELECT /*+ no_cache */ id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1"); got != "vec4" {
+			t.Errorf("Expected vec4, got %s", got)
+		}
+	}
+	if n := sqlService.IndexCache().Len(); n != 1 {
+		t.Errorf("Expected no index to be cached, got %d", n)
+	}
+	if stats := results.Stats(); stats.Hits != 0 || stats.Misses != 1 {
+		t.Errorf("Expected NO_CACHE queries not to use the result cache, got %+v", stats)
+	}
+
+	// Hints differ in the normalized statement, so cached results are not shared
+	plain, _ := parser.Normalize("SELECT id FROM vectors")
+	hinted, _ := parser.Normalize("select /*+ index(flat) */ id from vectors")
+	if plain == hinted || !strings.Contains(hinted, "/*+ INDEX(FLAT) */") {
+		t.Errorf("Unexpected normalized statements %q and %q", plain, hinted)
+	}
+
+	// Comments elsewhere are not hints
+	if got := nearest("SELECT id FROM vectors /*+ BOGUS */ NEAREST TO [2.0, 2.0, 0.0] LIMIT 1"); got != "vec4" {
+		t.Errorf("Expected vec4, got %s", got)
+	}
+	for _, query := range []string{
+		"SELECT /*+ BOGUS */ id FROM vectors",
+		"SELECT /*+ INDEX(ivf) */ id FROM vectors NEAREST TO [2.0, 2.0, 0.0]",
+		"SELECT /*+ INDEX */ id FROM vectors",
+		"EXPLAIN SELECT /*+ NO_CACHE(1) */ id FROM vectors",
+	} {
+		if _, err := sqlService.Query(query); !errors.Is(err, executor.ErrInvalidArgument) {
+			t.Errorf("%s: expected ErrInvalidArgument, got %v", query, err)
+		}
+	}
+
+	result, err := sqlService.Query("EXPLAIN SELECT /*+ INDEX(flat) NO_CACHE */ id FROM vectors NEAREST TO [2.0, 2.0, 0.0] LIMIT 1")
+	if err != nil {
+		t.Fatalf("EXPLAIN error = %v", err)
+	}
+	if !strings.Contains(fmt.Sprint(result.Rows), "Hints: INDEX(flat) NO_CACHE") {
+		t.Errorf("Expected the plan to show the hints, got %v", result.Rows)
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(createTestStore(), executor.IndexTypeFlat, metric)
+	plans := executor.NewPlanCache(8)
+	sqlService.SetPlanCache(plans)
+
+	rows := func(query string) string {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		return fmt.Sprint(result.Rows)
+	}
+
+	// Searches for other vectors reuse the plan, with their own literals
+	if got := rows("SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] LIMIT 1"); got != "[[vec1 0]]" {
+		t.Errorf("Expected vec1, got %s", got)
+	}
+	if got := rows("select id from vectors nearest to [0.0, 1.0, 0.0] limit 2"); got != "[[vec2 0] [vec4 1]]" {
+		t.Errorf("Expected vec2 and vec4, got %s", got)
+	}
+	if got := rows("SELECT id FROM vectors WHERE id = 'vec3'"); got != "[[vec3]]" {
+		t.Errorf("Expected vec3, got %s", got)
+	}
+	if got := rows("SELECT id FROM vectors WHERE id = 'vec5'"); got != "[[vec5]]" {
+		t.Errorf("Expected vec5, got %s", got)
+	}
+	if stats := plans.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Unexpected plan cache stats: %+v", stats)
+	}
+
+	// Strings and numbers are different parameters
+	first, _ := parser.Parameterize("SELECT id FROM vectors LIMIT 5")
+	second, _ := parser.Parameterize("SELECT id FROM vectors LIMIT '5'")
+	if first.Key != "SELECT id FROM vectors LIMIT ?" || first.Key == second.Key {
+		t.Errorf("Unexpected keys %q and %q", first.Key, second.Key)
+	}
+
+	// Literals the parser rejects are rejected with a cached plan too
+	rows("SELECT id FROM vectors LIMIT 5")
+	if _, err := sqlService.Query("SELECT id FROM vectors LIMIT '5'"); err == nil || !strings.Contains(err.Error(), "expected number for LIMIT") {
+		t.Errorf("Expected the string LIMIT to be rejected, got %v", err)
+	}
+	rows("SELECT id FROM vectors WHERE id = 1")
+	if _, err := sqlService.Query("SELECT id FROM vectors WHERE id = 99999999999999999999"); err == nil || !strings.Contains(err.Error(), "invalid number") {
+		t.Errorf("Expected the number to be rejected, got %v", err)
+	}
+
+	// Views keep the text of their SELECT as written, so they are parsed
+	entries := plans.Stats().Entries
+	rows("CREATE VIEW near AS SELECT id FROM vectors WHERE id = 'vec1' OR id = 'vec2'")
+	if got := rows("SELECT id FROM near"); got != "[[vec1] [vec2]]" {
+		t.Errorf("Expected vec1 and vec2, got %s", got)
+	}
+	if stats := plans.Stats(); stats.Entries != entries+1 {
+		t.Errorf("Expected only the SELECT to be cached, got %+v", stats)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	qe := executor.NewQueryExecutor(createTestStore(), executor.IndexTypeFlat, metric)
+
+	// 5 candidate IDs and 5 rows of an ID take about 200 bytes
+	memory := executor.NewMemoryAccountant(150, 0)
+	qe.SetMemoryAccountant(memory)
+	if _, err := qe.ExecuteQuery("SELECT id FROM vectors"); !errors.Is(err, executor.ErrMemoryBudget) || !strings.Contains(err.Error(), "result rows") {
+		t.Errorf("Expected the rows to exceed the budget, got %v", err)
+	}
+
+	// Streamed rows are not held
+	rows := 0
+	err := qe.StreamQueryAs("", "SELECT id FROM vectors", &executor.Stream{
+		Columns: func([]executor.Column) error { return nil },
+		Row: func(executor.Row) error {
+			rows++
+			return nil
+		},
+	})
+	if err != nil || rows != 5 {
+		t.Errorf("Expected 5 streamed rows, got %d, %v", rows, err)
+	}
+
+	// Filtered searches load the vectors to build their index
+	memory = executor.NewMemoryAccountant(300, 0)
+	qe.SetMemoryAccountant(memory)
+	if _, err := qe.ExecuteQuery("SELECT id FROM vectors"); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if _, err := qe.ExecuteQuery("SELECT id FROM vectors NEAREST TO [1.0, 0.0, 0.0] WHERE id != 'vec2' LIMIT 2"); !errors.Is(err, executor.ErrMemoryBudget) || !strings.Contains(err.Error(), "vectors of the index") {
+		t.Errorf("Expected the index to exceed the budget, got %v", err)
+	}
+	if stats := memory.Stats(); stats.InUse != 0 || stats.Peak < 200 || stats.Peak > 300 || stats.Aborted != 1 {
+		t.Errorf("Unexpected memory stats: %+v", stats)
+	}
+
+	// The global budget is shared by every running query
+	qe.SetMemoryAccountant(executor.NewMemoryAccountant(0, 50))
+	if _, err := qe.ExecuteQuery("SELECT id FROM vectors"); !errors.Is(err, executor.ErrMemoryBudget) || !strings.Contains(err.Error(), "all queries") {
+		t.Errorf("Expected the candidates to exceed the global budget, got %v", err)
+	}
+}
+
+func TestGroupBy(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+
+	// 20 chunks of a are nearer the query than b's only chunk
+	for i := 0; i < 20; i++ {
+		chunk := vector.NewVector(fmt.Sprintf("a#%02d", i), []float32{float32(i) * 0.01, 0, 0})
+		chunk.Metadata[embedding.MetadataKeyParent] = "a"
+		store.Insert(chunk)
+	}
+	chunk := vector.NewVector("b#00", []float32{1, 0, 0})
+	chunk.Metadata[embedding.MetadataKeyParent] = "b"
+	store.Insert(chunk)
+	store.Insert(vector.NewVector("c", []float32{2, 0, 0}))
+	store.Insert(vector.NewVector("d", []float32{3, 0, 0}))
+	qe := executor.NewQueryExecutor(store, executor.IndexTypeFlat, metric)
+
+	ids := func(query string) []string {
+		t.Helper()
+		result, err := qe.ExecuteQuery(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		var ids []string
+		for _, row := range result.Rows {
+			ids = append(ids, row[0].(string))
+		}
+		return ids
+	}
+
+	// The nearest chunk stands for its document, and more candidates are
+	// searched until the limit is filled; vectors without a parent are
+	// their own group
+	got := ids("SELECT id FROM vectors NEAREST TO [0.0, 0.0, 0.0] GROUP BY metadata.parent_id LIMIT 4")
+	if want := []string{"a#00", "b#00", "c", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	got = ids("SELECT id FROM vectors NEAREST TO [0.0, 0.0, 0.0] LIMIT 2")
+	if want := []string{"a#00", "a#01"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v without GROUP BY, got %v", want, got)
+	}
+
+	// Groups keep the row that sorts first
+	got = ids("SELECT id FROM vectors NEAREST TO [0.0, 0.0, 0.0] GROUP BY metadata.parent_id ORDER BY id DESC LIMIT 2")
+	if want := []string{"d", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	plan, err := qe.ExecuteQuery("EXPLAIN SELECT id FROM vectors NEAREST TO [0.0, 0.0, 0.0] GROUP BY metadata.parent_id LIMIT 4")
+	if err != nil || !strings.Contains(fmt.Sprint(plan.Rows), "Collapse: nearest row per metadata.parent_id") {
+		t.Errorf("Expected the collapse in the plan, got %v, %v", plan, err)
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM vectors GROUP BY metadata.parent_id",
+		"SELECT id FROM vectors NEAREST TO [0.0, 0.0, 0.0] GROUP BY dimension LIMIT 2",
+	} {
+		if _, err := qe.ExecuteQuery(query); !errors.Is(err, executor.ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", query, err)
+		}
+	}
+}
+
+func TestCentroid(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Cosine)
+	store := storage.NewCentroidStore(storage.NewMemoryStore())
+	for i, category := range []string{"news", "news", "sports"} {
+		v := vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 1})
+		v.Metadata["category"] = category
+		store.Insert(v)
+	}
+	qe := executor.NewQueryExecutor(store, executor.IndexTypeFlat, metric)
+
+	result, err := qe.ExecuteQuery("SELECT CENTROID(metadata.category = 'news') AS news, CENTROID('sports' = metadata.category), CENTROID()")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	names := []string{result.Columns[0].Name, result.Columns[1].Name, result.Columns[2].Name}
+	if want := []string{"news", "CENTROID(metadata.category = 'sports')", "CENTROID()"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected columns %v, got %v", want, names)
+	}
+	want := executor.Row{[]float32{0.5, 1}, []float32{2, 1}, []float32{1, 1}}
+	if len(result.Rows) != 1 || !reflect.DeepEqual(result.Rows[0], want) {
+		t.Errorf("Expected %v, got %v", want, result.Rows)
+	}
+
+	// Writes move the maintained centroids
+	if _, err := qe.ExecuteQuery("DELETE FROM vectors WHERE id = 'v0'"); err != nil {
+		t.Fatal(err)
+	}
+	result, err = qe.ExecuteQuery("SELECT CENTROID(metadata.category = 'news') FROM vectors")
+	if err != nil || !reflect.DeepEqual(result.Rows[0], executor.Row{[]float32{1, 1}}) {
+		t.Errorf("Expected the centroid without v0, got %v (err = %v)", result, err)
+	}
+	result, err = qe.ExecuteQuery("SELECT CENTROID(metadata.category = 'weather')")
+	if err != nil || !reflect.DeepEqual(result.Rows[0], executor.Row{nil}) {
+		t.Errorf("Expected NULL for an empty group, got %v (err = %v)", result, err)
+	}
+
+	for _, query := range []string{
+		"SELECT id, CENTROID() FROM vectors",
+		"SELECT CENTROID() FROM vectors WHERE metadata.category = 'news'",
+		"SELECT CENTROID(metadata.category > 'news')",
+		"SELECT CENTROID(id = 'v1')",
+	} {
+		if _, err := qe.ExecuteQuery(query); !errors.Is(err, executor.ErrInvalidQuery) && !errors.Is(err, executor.ErrInvalidArgument) {
+			t.Errorf("%s: expected an invalid query error, got %v", query, err)
+		}
+	}
+}
+
+func TestAccessStats(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewAccessStore(storage.NewMemoryStore(), 1)
+	for i := 0; i < 4; i++ {
+		store.Insert(vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 0}))
+	}
+	qe := executor.NewQueryExecutor(store, executor.IndexTypeFlat, metric)
+
+	for _, query := range []string{
+		"SELECT id FROM vectors NEAREST TO [3.1, 0] LIMIT 2",
+		"SELECT id FROM vectors NEAREST TO [2.9, 0] LIMIT 1",
+		"SELECT id FROM vectors NEAREST TO [0, 0] LIMIT 1",
+	} {
+		if _, err := qe.ExecuteQuery(query); err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+	}
+
+	result, err := qe.ExecuteQuery("SELECT id, hits, last_returned_at FROM vectors ORDER BY hits DESC LIMIT 3")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(result.Rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %v", result.Rows)
+	}
+	for i, want := range []executor.Row{{"v3", 2}, {"v0", 1}, {"v2", 1}} {
+		if result.Rows[i][0] != want[0] || result.Rows[i][1] != want[1] || result.Rows[i][2] == "" {
+			t.Errorf("Expected row %d to be %v with a time, got %v", i, want, result.Rows[i])
+		}
+	}
+
+	// Listing vectors is no search, so it counts no hits
+	result, err = qe.ExecuteQuery("SELECT id, hits, last_returned_at FROM vectors WHERE id = 'v1'")
+	if err != nil || !reflect.DeepEqual(result.Rows, []executor.Row{{"v1", 0, ""}}) {
+		t.Errorf("Expected no hits of v1, got %v (err = %v)", result, err)
+	}
+	result, err = qe.ExecuteQuery("SELECT id, hits FROM vectors NEAREST TO [1, 0] LIMIT 1")
+	if err != nil || len(result.Rows) != 1 || result.Rows[0][0] != "v1" || result.Rows[0][1] != 0 {
+		t.Errorf("Expected hits before the search itself, got %v (err = %v)", result, err)
+	}
+}
+
+func TestBoost(t *testing.T) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+	for i, source := range []string{"crawl", "manual", "crawl", "manual"} {
+		v := vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 0})
+		v.Metadata["source"] = source
+		v.Metadata["stale"] = fmt.Sprint(i == 0)
+		store.Insert(v)
+	}
+	qe := executor.NewQueryExecutor(store, executor.IndexTypeFlat, metric)
+	ids := func(query string) []interface{} {
+		t.Helper()
+		result, err := qe.ExecuteQuery(query)
+		if err != nil {
+			t.Fatalf("Query(%s) error = %v", query, err)
+		}
+		var ids []interface{}
+		for _, row := range result.Rows {
+			ids = append(ids, row[0])
+		}
+		return ids
+	}
+
+	if got := ids("SELECT id FROM vectors NEAREST TO [0, 0] LIMIT 2"); !reflect.DeepEqual(got, []interface{}{"v0", "v1"}) {
+		t.Errorf("Expected the nearest vectors without boosts, got %v", got)
+	}
+
+	// A boost subtracts from the distance, pulling in manual vectors from
+	// beyond the limit
+	got := ids("SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' BY 3.5 LIMIT 2")
+	if !reflect.DeepEqual(got, []interface{}{"v1", "v3"}) {
+		t.Errorf("Expected boosted manual vectors first, got %v", got)
+	}
+	result, err := qe.ExecuteQuery("SELECT id, distance FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' BY 3.5 LIMIT 1")
+	if err != nil || result.Rows[0][1] != float32(-2.5) {
+		t.Errorf("Expected the boosted distance -2.5, got %v (err = %v)", result, err)
+	}
+
+	// Negative amounts penalize, factors multiply and boosts apply in order
+	got = ids("SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'crawl' BY * 0.1 BOOST metadata.stale = 'true' BY -5 LIMIT 4")
+	if !reflect.DeepEqual(got, []interface{}{"v2", "v1", "v3", "v0"}) {
+		t.Errorf("Expected stale vectors last and crawled ones first, got %v", got)
+	}
+	got = ids("SELECT id FROM vectors NEAREST TO [0, 0] USING euclidean BOOST metadata.source = 'manual' AND id != 'v1' BY 3.5 LIMIT 1")
+	if !reflect.DeepEqual(got, []interface{}{"v3"}) {
+		t.Errorf("Expected a boost with a compound condition after USING, got %v", got)
+	}
+
+	plan, err := qe.ExecuteQuery("EXPLAIN SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' BY * 0.5 LIMIT 2")
+	if err != nil || !strings.Contains(fmt.Sprint(plan.Rows), "Boost: (metadata.source = ") || !strings.Contains(fmt.Sprint(plan.Rows), "BY * 0.5") {
+		t.Errorf("Expected the boost in the plan, got %v (err = %v)", plan, err)
+	}
+
+	for _, query := range []string{
+		"SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' LIMIT 2",
+		"SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' BY 'a lot' LIMIT 2",
+		"SELECT id FROM vectors NEAREST TO [0, 0] BOOST metadata.source = 'manual' BY * -2 LIMIT 2",
+	} {
+		if _, err := qe.ExecuteQuery(query); err == nil {
+			t.Errorf("Expected %s to fail", query)
+		}
+	}
+}
+
+func TestRewriteRules(t *testing.T) {
+	store := storage.NewMemoryStore()
+	for i, kind := range []string{"doc", "doc", "img", "doc", "draft"} {
+		vec := vector.NewVector(fmt.Sprintf("v%d", i), []float32{float32(i), 0})
+		vec.Metadata["type"] = kind
+		vec.Metadata["era"] = "new"
+		if i < 2 {
+			vec.Metadata["era"] = "old"
+		}
+		store.Insert(vec)
+	}
+	euclidean, _ := distance.GetMetric(distance.Euclidean)
+	sqlService := cli.NewSQLService(store, executor.IndexTypeFlat, euclidean)
+	exec := func(query string) *executor.ResultSet {
+		t.Helper()
+		result, err := sqlService.Query(query)
+		if err != nil {
+			t.Fatalf("%s: Query() error = %v", query, err)
+		}
+		return result
+	}
+	ids := func(query string) []string {
+		t.Helper()
+		var got []string
+		for _, row := range exec(query).Rows {
+			got = append(got, row[0].(string))
+		}
+		return got
+	}
+
+	// Macros stand for conditions, also in other macros and in BOOST
+	exec("CREATE MACRO recent AS metadata.era = 'new'")
+	exec("CREATE MACRO recent_docs AS recent AND metadata.type = 'doc'")
+	if got := ids("SELECT id FROM vectors WHERE recent_docs"); !reflect.DeepEqual(got, []string{"v3"}) {
+		t.Errorf("Expected recent docs, got %v", got)
+	}
+	if got := ids("SELECT id FROM vectors WHERE recent OR id = 'v0'"); !reflect.DeepEqual(got, []string{"v0", "v2", "v3", "v4"}) {
+		t.Errorf("Expected a macro combined with OR, got %v", got)
+	}
+	if got := ids("SELECT id FROM vectors NEAREST TO [0, 0] BOOST recent_docs BY 5 LIMIT 1"); !reflect.DeepEqual(got, []string{"v3"}) {
+		t.Errorf("Expected a macro in BOOST, got %v", got)
+	}
+
+	// Rules add their condition to the SELECTs of a table and cap their LIMIT
+	exec("CREATE RULE no_drafts ON vectors WHERE metadata.type != 'draft'")
+	exec("CREATE RULE cap ON * LIMIT 2")
+	if got := ids("SELECT id FROM vectors WHERE recent"); !reflect.DeepEqual(got, []string{"v2", "v3"}) {
+		t.Errorf("Expected no drafts, got %v", got)
+	}
+	if got := ids("SELECT id FROM vectors NEAREST TO [4, 0] LIMIT 100"); !reflect.DeepEqual(got, []string{"v3", "v2"}) {
+		t.Errorf("Expected a capped search without drafts, got %v", got)
+	}
+	if got := ids("SELECT id FROM vectors LIMIT 1"); !reflect.DeepEqual(got, []string{"v0"}) {
+		t.Errorf("Expected a lower LIMIT to be kept, got %v", got)
+	}
+	if count := exec("SELECT COUNT(*) FROM vectors").Rows[0][0]; count != 4 {
+		t.Errorf("Expected COUNT(*) of every row but drafts, got %v", count)
+	}
+
+	// Views get the rules of their name and of their collection
+	exec("CREATE VIEW docs AS SELECT id FROM vectors WHERE metadata.type = 'doc'")
+	exec("CREATE RULE old_docs ON docs WHERE metadata.era = 'old'")
+	if got := ids("SELECT id FROM docs"); !reflect.DeepEqual(got, []string{"v0", "v1"}) {
+		t.Errorf("Expected the view's old docs, got %v", got)
+	}
+	plan := fmt.Sprint(exec("EXPLAIN SELECT id FROM docs").Rows)
+	if !strings.Contains(plan, "Limit: 2") || !strings.Contains(plan, "draft") {
+		t.Errorf("Expected the rewritten statement in the plan, got %s", plan)
+	}
+
+	exec("DROP RULE cap")
+	exec("DROP RULE old_docs")
+	if got := ids("SELECT id FROM docs"); !reflect.DeepEqual(got, []string{"v0", "v1", "v3"}) {
+		t.Errorf("Expected dropped rules to no longer apply, got %v", got)
+	}
+	exec("DROP MACRO recent_docs")
+	if _, err := sqlService.Query("DROP MACRO recent_docs"); !errors.Is(err, executor.ErrMacroNotFound) {
+		t.Errorf("Expected ErrMacroNotFound, got %v", err)
+	}
+	if _, err := sqlService.Query("CREATE RULE no_drafts ON vectors LIMIT 5"); !errors.Is(err, executor.ErrRuleExists) {
+		t.Errorf("Expected ErrRuleExists, got %v", err)
+	}
+
+	// Macros that use themselves are rejected when used
+	exec("CREATE MACRO loop AS loop OR id = 'v0'")
+	if _, err := sqlService.Query("SELECT id FROM vectors WHERE loop"); !errors.Is(err, executor.ErrInvalidQuery) {
+		t.Errorf("Expected ErrInvalidQuery for a recursive macro, got %v", err)
+	}
+	for _, query := range []string{
+		"CREATE RULE nothing ON vectors",
+		"CREATE RULE zero ON vectors LIMIT 0",
+		"CREATE MACRO broken AS",
+	} {
+		if _, err := sqlService.Query(query); err == nil {
+			t.Errorf("Expected %s to fail", query)
+		}
+	}
+}
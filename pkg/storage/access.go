@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// AccessStats describes how often searches returned a vector
+type AccessStats struct {
+	Hits         uint64    `json:"hits"`          // Searches that returned the vector, estimated from the sampled ones
+	LastReturned time.Time `json:"last_returned"` // When a sampled search last returned it; zero if none has
+}
+
+// AccessSource is implemented by stores that track which vectors searches
+// return
+type AccessSource interface {
+	// AccessStats returns the access stats of the vector with the given ID
+	AccessStats(id string) AccessStats
+}
+
+// VectorAccess returns the access stats of a vector from the first store in
+// the wrapper chain that tracks them. ok is false if no store does.
+func VectorAccess(store VectorStore, id string) (stats AccessStats, ok bool) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if a, ok := s.(AccessSource); ok {
+			return a.AccessStats(id), true
+		}
+	}
+	return AccessStats{}, false
+}
+
+// AccessStore wraps a VectorStore and counts how often searches return each
+// of its vectors, for analytics of what content is served. Only every nth
+// search is recorded, and counts a hit for n, so busy servers pay for a
+// fraction of their searches. Stats are kept in memory since the store was
+// opened and forgotten when a vector is deleted through the wrapper.
+type AccessStore struct {
+	VectorStore
+
+	mu       sync.Mutex
+	every    uint64 // Searches per recorded one
+	searches uint64
+	stats    map[string]*AccessStats
+}
+
+// NewAccessStore creates a store that records the given share of searches,
+// between 0 and 1; a share of 0.1 records every 10th search
+func NewAccessStore(store VectorStore, sampleRate float64) *AccessStore {
+	every := uint64(1)
+	if sampleRate > 0 && sampleRate < 1 {
+		every = uint64(math.Round(1 / sampleRate))
+	}
+	return &AccessStore{VectorStore: store, every: every, stats: make(map[string]*AccessStats)}
+}
+
+// RecordSearch implements SearchRecorder
+func (s *AccessStore) RecordSearch(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.searches++
+	if s.searches%s.every != 0 {
+		return
+	}
+	now := time.Now().UTC()
+	for _, id := range ids {
+		stats, ok := s.stats[id]
+		if !ok {
+			stats = &AccessStats{}
+			s.stats[id] = stats
+		}
+		stats.Hits += s.every
+		stats.LastReturned = now
+	}
+}
+
+// AccessStats implements AccessSource
+func (s *AccessStore) AccessStats(id string) AccessStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stats, ok := s.stats[id]; ok {
+		return *stats
+	}
+	return AccessStats{}
+}
+
+// Delete removes the vector and forgets its stats
+func (s *AccessStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *AccessStore) DeleteCtx(ctx context.Context, id string) error {
+	if err := WithContext(s.VectorStore).DeleteCtx(ctx, id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.stats, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// InsertCtx implements ContextStore
+func (s *AccessStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	return WithContext(s.VectorStore).InsertCtx(ctx, v)
+}
+
+// GetCtx implements ContextStore
+func (s *AccessStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// UpdateCtx implements ContextStore
+func (s *AccessStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	return WithContext(s.VectorStore).UpdateCtx(ctx, v)
+}
+
+// ListCtx implements ContextStore
+func (s *AccessStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *AccessStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestAccessStore(t *testing.T) {
+	memory := NewMemoryStore()
+	memory.Insert(vector.NewVector("a", []float32{1, 2}))
+	memory.Insert(vector.NewVector("b", []float32{3, 4}))
+
+	// Searches reach every recorder of the chain, not just the quota
+	store := NewQuotaStore(NewAccessStore(memory, 1), Quota{MaxVectors: 10, Policy: EvictLeastSearched}, nil)
+	if _, ok := VectorAccess(memory, "a"); ok {
+		t.Error("Expected no access stats from a store that tracks none")
+	}
+
+	RecordSearch(store, []string{"a", "b"})
+	RecordSearch(store, []string{"a"})
+	a, ok := VectorAccess(store, "a")
+	if !ok || a.Hits != 2 || a.LastReturned.IsZero() {
+		t.Errorf("Expected 2 hits of a, got %+v", a)
+	}
+	if b, _ := VectorAccess(store, "b"); b.Hits != 1 {
+		t.Errorf("Expected 1 hit of b, got %+v", b)
+	}
+
+	// Deleted vectors are forgotten
+	if err := store.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ := VectorAccess(store, "a"); a.Hits != 0 || !a.LastReturned.IsZero() {
+		t.Errorf("Expected the stats of a deleted vector to be forgotten, got %+v", a)
+	}
+
+	// Sampled searches count for the searches skipped
+	sampled := NewAccessStore(memory, 0.25)
+	for i := 0; i < 7; i++ {
+		RecordSearch(sampled, []string{"b"})
+	}
+	if b := sampled.AccessStats("b"); b.Hits != 4 {
+		t.Errorf("Expected 1 of 7 searches sampled as 4 hits, got %+v", b)
+	}
+}
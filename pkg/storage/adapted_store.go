@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// VectorAdapter maps vectors into the dimension expected by a collection
+type VectorAdapter interface {
+	Adapt(v *vector.Vector) (*vector.Vector, error)
+}
+
+// AdaptedStore wraps a VectorStore and passes every inserted or updated
+// vector through an adapter, so vectors from models with a different
+// dimension are stored in the collection's dimension
+type AdaptedStore struct {
+	VectorStore
+
+	adapter VectorAdapter
+}
+
+// NewAdaptedStore wraps a store with a dimension adapter
+func NewAdaptedStore(store VectorStore, adapter VectorAdapter) *AdaptedStore {
+	return &AdaptedStore{
+		VectorStore: store,
+		adapter:     adapter,
+	}
+}
+
+// Adapter returns the adapter applied to written vectors
+func (s *AdaptedStore) Adapter() VectorAdapter {
+	return s.adapter
+}
+
+func (s *AdaptedStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *AdaptedStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	adapted, err := s.adapter.Adapt(v)
+	if err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).InsertCtx(ctx, adapted)
+}
+
+func (s *AdaptedStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *AdaptedStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	adapted, err := s.adapter.Adapt(v)
+	if err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).UpdateCtx(ctx, adapted)
+}
+
+// GetCtx implements ContextStore
+func (s *AdaptedStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// DeleteCtx implements ContextStore
+func (s *AdaptedStore) DeleteCtx(ctx context.Context, id string) error {
+	return WithContext(s.VectorStore).DeleteCtx(ctx, id)
+}
+
+// ListCtx implements ContextStore
+func (s *AdaptedStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *AdaptedStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// truncateAdapter keeps the first two components of longer vectors
+type truncateAdapter struct{}
+
+func (truncateAdapter) Adapt(v *vector.Vector) (*vector.Vector, error) {
+	if v.Dimension <= 2 {
+		return v, nil
+	}
+	return vector.NewVectorWithMetadata(v.ID, v.Values[:2], v.Metadata), nil
+}
+
+func TestAdaptedStore(t *testing.T) {
+	inner := NewMemoryStore()
+	store := NewAdaptedStore(inner, truncateAdapter{})
+
+	if err := store.Insert(vector.NewVector("v1", []float32{1.0, 2.0, 3.0})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := store.Update(vector.NewVector("v1", []float32{4.0, 5.0, 6.0, 7.0})); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+
+	v, err := inner.Get("v1")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if v.Dimension != 2 || v.Values[0] != 4.0 || v.Values[1] != 5.0 {
+		t.Errorf("Expected adapted vector [4 5], got %v", v.Values)
+	}
+}
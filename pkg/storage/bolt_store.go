@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltVectorsBucket is the bbolt bucket holding encoded vectors keyed by ID
+var boltVectorsBucket = []byte("vectors")
+
+// BoltStore is an implementation of VectorStore on top of the bbolt embedded
+// key-value store. Each write is a single ACID transaction with an fsync, so
+// the database survives crashes without the per-vector file overhead.
+type BoltStore struct {
+	db   *bolt.DB
+	path string
+}
+
+// NewBoltStore opens (or creates) a bbolt-backed vector store at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// bbolt holds an exclusive file lock; fail instead of blocking forever
+	// when another process has the database open
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltVectorsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bolt bucket: %w", err)
+	}
+
+	return &BoltStore{db: db, path: path}, nil
+}
+
+func (s *BoltStore) Insert(v *vector.Vector) error {
+	if err := ValidateID(v.ID); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltVectorsBucket)
+		if b.Get([]byte(v.ID)) != nil {
+			return ErrVectorAlreadyExists
+		}
+		return b.Put([]byte(v.ID), stampInsert(v).Encode())
+	})
+}
+
+func (s *BoltStore) Get(id string) (*vector.Vector, error) {
+	return s.get(id, vector.Decode)
+}
+
+// GetMeta implements MetaReader. The record is still read from the page,
+// but the values are not decoded or copied out.
+func (s *BoltStore) GetMeta(id string) (*vector.Vector, error) {
+	return s.get(id, vector.DecodeMeta)
+}
+
+// get reads a record and decodes it with decode
+func (s *BoltStore) get(id string, decode func([]byte) (*vector.Vector, error)) (*vector.Vector, error) {
+	var v *vector.Vector
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(boltVectorsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrVectorNotFound
+		}
+
+		// Decode copies out of the mmap'd page, so the result outlives the transaction
+		decoded, err := decode(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode vector %s: %w", id, err)
+		}
+		v = decoded
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (s *BoltStore) Update(v *vector.Vector) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltVectorsBucket)
+		data := b.Get([]byte(v.ID))
+		if data == nil {
+			return ErrVectorNotFound
+		}
+		old, err := vector.DecodeMeta(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode vector %s: %w", v.ID, err)
+		}
+		return b.Put([]byte(v.ID), stampUpdate(v, old.CreatedAt).Encode())
+	})
+}
+
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltVectorsBucket)
+		if b.Get([]byte(id)) == nil {
+			return ErrVectorNotFound
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+func (s *BoltStore) List() ([]string, error) {
+	ids := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltVectorsBucket).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ListPrefix implements PrefixLister by seeking to the prefix in the
+// sorted keys
+func (s *BoltStore) ListPrefix(prefix string) ([]string, error) {
+	ids := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltVectorsBucket).Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	return ids, nil
+}
+
+// ListRange implements RangeLister by seeking to start in the sorted keys
+func (s *BoltStore) ListRange(start, end string, limit int) ([]string, error) {
+	ids := []string{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltVectorsBucket).Cursor()
+		for k, _ := c.Seek([]byte(start)); k != nil && (end == "" || string(k) < end); k, _ = c.Next() {
+			if limit > 0 && len(ids) == limit {
+				break
+			}
+			ids = append(ids, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (s *BoltStore) Count() (int, error) {
+	var count int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(boltVectorsBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the path of the bolt database file
+func (s *BoltStore) Path() string {
+	return s.path
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.bolt")
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create bolt store: %v", err)
+	}
+
+	v1 := vector.NewVectorWithMetadata("v1", []float32{1.0, 2.0, 3.0}, map[string]string{"category": "image"})
+	if err := store.Insert(v1); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := store.Insert(v1); err != ErrVectorAlreadyExists {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	if err := store.Update(vector.NewVector("v1", []float32{4.0, 5.0, 6.0})); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	if err := store.Update(vector.NewVector("missing", []float32{1.0})); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	store.Insert(vector.NewVector("v2", []float32{7.0, 8.0, 9.0}))
+	if err := store.Delete("v2"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := store.Delete("v2"); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	// Test persistence across reopen
+	reopened, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen bolt store: %v", err)
+	}
+	defer reopened.Close()
+
+	count, _ := reopened.Count()
+	if count != 1 {
+		t.Errorf("Expected count 1 after reopen, got %d", count)
+	}
+	got, err := reopened.Get("v1")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if got.Values[0] != 4.0 || len(got.Metadata) != 0 {
+		t.Errorf("Expected updated vector, got %v %v", got.Values, got.Metadata)
+	}
+}
+
+func TestMigrateFileStoreToBolt(t *testing.T) {
+	src, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	src.Insert(vector.NewVectorWithMetadata("a", []float32{1.0, 2.0}, map[string]string{"k": "v"}))
+	src.Insert(vector.NewVector("b", []float32{3.0, 4.0}))
+
+	dst, err := NewBoltStore(filepath.Join(t.TempDir(), "vectors.bolt"))
+	if err != nil {
+		t.Fatalf("Failed to create bolt store: %v", err)
+	}
+	defer dst.Close()
+
+	// A stale copy in the destination is overwritten
+	dst.Insert(vector.NewVector("b", []float32{0.0, 0.0}))
+
+	stats, err := Migrate(src, dst, nil)
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if stats.Copied != 1 || stats.Updated != 1 {
+		t.Errorf("Expected 1 copied and 1 updated, got %+v", stats)
+	}
+
+	a, err := dst.Get("a")
+	if err != nil || a.Metadata["k"] != "v" {
+		t.Errorf("Expected migrated vector with metadata, got %+v (err %v)", a, err)
+	}
+	b, _ := dst.Get("b")
+	if b.Values[0] != 3.0 {
+		t.Errorf("Expected source values to win, got %v", b.Values)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/fileutil"
+)
+
+var (
+	// ErrObjectNotFound is returned when a key does not exist in a bucket
+	ErrObjectNotFound = errs.New(errs.NotFound, "object not found")
+
+	// ErrInvalidObjectKey is returned when a key cannot be mapped safely onto a bucket
+	ErrInvalidObjectKey = errs.New(errs.InvalidArgument, "invalid object key")
+)
+
+// Bucket is a minimal object-storage abstraction (S3, GCS, local directory)
+// used by ObjectStore. Keys are slash-separated paths. Requests end early
+// with the context's error once it is done.
+type Bucket interface {
+	// Get returns the contents of the object stored under key
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// Put stores data under key, replacing any existing object
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+
+	// List returns all keys starting with prefix, in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirBucket is a Bucket backed by a local directory. It is used as the
+// segment cache of ObjectStore and is handy for tests and single-node setups.
+// File operations cannot be interrupted, so the context is only checked
+// before each one.
+type DirBucket struct {
+	dir string
+}
+
+// NewDirBucket creates a bucket rooted at dir, creating the directory if needed
+func NewDirBucket(dir string) (*DirBucket, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bucket directory: %w", err)
+	}
+	return &DirBucket{dir: dir}, nil
+}
+
+// path maps a key onto a file path inside the bucket directory
+func (b *DirBucket) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidObjectKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidObjectKey, key)
+		}
+	}
+	return filepath.Join(b.dir, filepath.FromSlash(key)), nil
+}
+
+func (b *DirBucket) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := b.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrObjectNotFound
+	}
+	return data, err
+}
+
+func (b *DirBucket) Put(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create object directory: %w", err)
+	}
+
+	// Replace the file atomically so readers never see a partial object
+	if err := fileutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	return nil
+}
+
+func (b *DirBucket) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrObjectNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *DirBucket) List(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	err := filepath.WalkDir(b.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bucket directory: %w", err)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// Epocher is implemented by stores that count their writes, so results
+// computed from the store can be tagged with the state they were read from
+type Epocher interface {
+	// Epoch returns a number that changes after every successful write
+	Epoch() uint64
+}
+
+// StoreEpoch returns the epoch of a store or of the first store it wraps
+// that counts its writes. ok is false if no store in the chain does.
+func StoreEpoch(store VectorStore) (epoch uint64, ok bool) {
+	for ; store != nil; store = Unwrap(store) {
+		if e, ok := store.(Epocher); ok {
+			return e.Epoch(), true
+		}
+	}
+	return 0, false
+}
+
+// CacheStats describes the hit rate of a CachedStore
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// CachedStore wraps a VectorStore with an LRU cache of decoded vectors, so
+// repeated reads of hot vectors do not go back to disk. Writes through the
+// wrapper update the cache; writes that bypass it leave stale entries.
+type CachedStore struct {
+	VectorStore
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // Most recently used first
+	entries map[string]*list.Element
+	epoch   uint64
+	hits    uint64
+	misses  uint64
+}
+
+// NewCachedStore wraps a store with a cache of up to size vectors. A size of
+// zero caches nothing and only counts writes for Epoch.
+func NewCachedStore(store VectorStore, size int) *CachedStore {
+	return &CachedStore{
+		VectorStore: store,
+		size:        size,
+		lru:         list.New(),
+		entries:     make(map[string]*list.Element),
+	}
+}
+
+// Epoch implements Epocher
+func (s *CachedStore) Epoch() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.epoch
+}
+
+// Stats returns the cache's hits, misses and size
+func (s *CachedStore) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CacheStats{Hits: s.hits, Misses: s.misses, Entries: s.lru.Len()}
+}
+
+func (s *CachedStore) Get(id string) (*vector.Vector, error) {
+	return s.GetCtx(context.Background(), id, GetOptions{})
+}
+
+// GetCtx implements ContextStore. Metadata is answered from the cache if it
+// holds the vector, but reading it does not fill the cache.
+func (s *CachedStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	s.mu.Lock()
+	if e, ok := s.entries[id]; ok {
+		s.hits++
+		s.lru.MoveToFront(e)
+		v := e.Value.(*vector.Vector)
+		s.mu.Unlock()
+		if opts.MetadataOnly {
+			return v.Meta(), nil
+		}
+		return v.Copy(), nil
+	}
+	if opts.MetadataOnly {
+		s.mu.Unlock()
+		return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+	}
+	s.misses++
+	epoch := s.epoch
+	s.mu.Unlock()
+
+	v, err := WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A write since the read started may have changed the vector
+	s.mu.Lock()
+	if s.epoch == epoch {
+		s.add(v.Copy())
+	}
+	s.mu.Unlock()
+	return v, nil
+}
+
+// GetMeta implements MetaReader, answering from the cache if it holds the
+// vector
+func (s *CachedStore) GetMeta(id string) (*vector.Vector, error) {
+	return s.GetCtx(context.Background(), id, GetOptions{MetadataOnly: true})
+}
+
+func (s *CachedStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *CachedStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := WithContext(s.VectorStore).InsertCtx(ctx, v); err != nil {
+		return err
+	}
+	s.written(v.ID)
+	return nil
+}
+
+func (s *CachedStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *CachedStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	if err := WithContext(s.VectorStore).UpdateCtx(ctx, v); err != nil {
+		return err
+	}
+	s.written(v.ID)
+	return nil
+}
+
+func (s *CachedStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *CachedStore) DeleteCtx(ctx context.Context, id string) error {
+	if err := WithContext(s.VectorStore).DeleteCtx(ctx, id); err != nil {
+		return err
+	}
+	s.written(id)
+	return nil
+}
+
+// ListCtx implements ContextStore
+func (s *CachedStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *CachedStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// written drops the cached copy of a written vector and advances the epoch.
+// The next read caches the vector as the store returns it, e.g. after
+// dimension adaptation.
+func (s *CachedStore) written(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.epoch++
+	if e, ok := s.entries[id]; ok {
+		s.lru.Remove(e)
+		delete(s.entries, id)
+	}
+}
+
+// add caches a vector, evicting the least recently used one if full
+func (s *CachedStore) add(v *vector.Vector) {
+	if s.size <= 0 {
+		return
+	}
+	if e, ok := s.entries[v.ID]; ok {
+		e.Value = v
+		s.lru.MoveToFront(e)
+		return
+	}
+	s.entries[v.ID] = s.lru.PushFront(v)
+	if s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*vector.Vector).ID)
+	}
+}
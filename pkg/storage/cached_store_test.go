@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// countingStore counts the reads that reach the wrapped store
+type countingStore struct {
+	VectorStore
+	gets int
+}
+
+func (s *countingStore) Get(id string) (*vector.Vector, error) {
+	s.gets++
+	return s.VectorStore.Get(id)
+}
+
+func TestCachedStore(t *testing.T) {
+	inner := &countingStore{VectorStore: NewMemoryStore()}
+	store := NewCachedStore(inner, 2)
+
+	for _, id := range []string{"a", "b", "c"} {
+		if err := store.Insert(vector.NewVector(id, []float32{1.0, 2.0})); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+
+	// Repeated reads are served from the cache
+	for i := 0; i < 3; i++ {
+		if _, err := store.Get("a"); err != nil {
+			t.Fatalf("Failed to get vector: %v", err)
+		}
+	}
+	if inner.gets != 1 {
+		t.Errorf("Expected 1 read of the store, got %d", inner.gets)
+	}
+
+	// Cached vectors are copies
+	v, _ := store.Get("a")
+	v.Values[0] = 9.0
+	if v, _ := store.Get("a"); v.Values[0] != 1.0 {
+		t.Errorf("Expected the cached vector to be unchanged, got %v", v.Values)
+	}
+
+	// Reading b and c evicts a, the least recently used vector
+	store.Get("b")
+	store.Get("c")
+	inner.gets = 0
+	store.Get("a")
+	if inner.gets != 1 {
+		t.Errorf("Expected a to be evicted, got %d reads", inner.gets)
+	}
+	if stats := store.Stats(); stats.Entries != 2 || stats.Hits != 4 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// Writes replace the cached vector and advance the epoch
+	epoch, ok := StoreEpoch(NewGatedStore(store))
+	if !ok {
+		t.Fatal("Expected the cached store to report an epoch")
+	}
+	if err := store.Update(vector.NewVector("a", []float32{3.0, 4.0})); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	if v, _ := store.Get("a"); v.Values[0] != 3.0 {
+		t.Errorf("Expected the updated vector, got %v", v.Values)
+	}
+	if store.Epoch() == epoch {
+		t.Error("Expected the update to advance the epoch")
+	}
+
+	store.Delete("a")
+	if _, err := store.Get("a"); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	if _, ok := StoreEpoch(NewMemoryStore()); ok {
+		t.Error("Expected no epoch for a memory store")
+	}
+}
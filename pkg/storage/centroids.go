@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// CentroidGroup selects the vectors a centroid averages: every vector, or
+// those whose metadata Key has Value
+type CentroidGroup struct {
+	Key   string // Metadata key; empty for every vector
+	Value string
+}
+
+// String describes the group as a condition on metadata
+func (g CentroidGroup) String() string {
+	if g.Key == "" {
+		return "all vectors"
+	}
+	return fmt.Sprintf("metadata.%s = %q", g.Key, g.Value)
+}
+
+// matches reports whether v belongs to the group
+func (g CentroidGroup) matches(v *vector.Vector) bool {
+	return g.Key == "" || (v.Metadata != nil && v.Metadata[g.Key] == g.Value)
+}
+
+// Centroid is the mean of the vectors of a group
+type Centroid struct {
+	Values []float32 // Nil if the group is empty
+	Count  int       // Vectors averaged
+}
+
+// CentroidSource is implemented by stores that maintain the centroids of
+// groups of their vectors
+type CentroidSource interface {
+	// Centroid returns the centroid of the group's vectors
+	Centroid(group CentroidGroup) (*Centroid, error)
+}
+
+// GroupCentroid returns the centroid of a group from the first store in the
+// wrapper chain that maintains centroids, or by reading every vector of the
+// group if there is none. Groups whose vectors differ in dimension have no
+// centroid; the error wraps vector.ErrInvalidDimension.
+func GroupCentroid(store VectorStore, group CentroidGroup) (*Centroid, error) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if c, ok := s.(CentroidSource); ok {
+			return c.Centroid(group)
+		}
+	}
+	sums, err := sumGroup(store, group)
+	if err != nil {
+		return nil, err
+	}
+	return sums.centroid(group)
+}
+
+// centroidSums holds the running sums of a group's vectors, per dimension
+// so vectors of another dimension can leave the group again
+type centroidSums struct {
+	sums   map[int][]float64
+	counts map[int]int
+}
+
+func newCentroidSums() *centroidSums {
+	return &centroidSums{sums: make(map[int][]float64), counts: make(map[int]int)}
+}
+
+// add adds v to the sums, or subtracts it if sign is -1
+func (c *centroidSums) add(v *vector.Vector, sign float64) {
+	dim := len(v.Values)
+	sum, ok := c.sums[dim]
+	if !ok {
+		sum = make([]float64, dim)
+		c.sums[dim] = sum
+	}
+	for i, x := range v.Values {
+		sum[i] += sign * float64(x)
+	}
+	c.counts[dim] += int(sign)
+	if c.counts[dim] <= 0 {
+		delete(c.sums, dim)
+		delete(c.counts, dim)
+	}
+}
+
+// centroid returns the mean of the sums
+func (c *centroidSums) centroid(group CentroidGroup) (*Centroid, error) {
+	if len(c.sums) > 1 {
+		dims := make([]int, 0, len(c.sums))
+		for dim := range c.sums {
+			dims = append(dims, dim)
+		}
+		sort.Ints(dims)
+		return nil, fmt.Errorf("%w: the vectors of %s have dimensions %v", vector.ErrInvalidDimension, group, dims)
+	}
+	for dim, sum := range c.sums {
+		count := c.counts[dim]
+		values := make([]float32, dim)
+		for i, x := range sum {
+			values[i] = float32(x / float64(count))
+		}
+		return &Centroid{Values: values, Count: count}, nil
+	}
+	return &Centroid{}, nil
+}
+
+// sumGroup reads the vectors of a group from the store and sums them
+func sumGroup(store VectorStore, group CentroidGroup) (*centroidSums, error) {
+	ids, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	sums := newCentroidSums()
+	for _, id := range ids {
+		if group.Key != "" {
+			meta, err := GetMeta(store, id)
+			if errors.Is(err, ErrVectorNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !group.matches(meta) {
+				continue
+			}
+		}
+		v, err := store.Get(id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sums.add(v, 1)
+	}
+	return sums, nil
+}
+
+// CentroidStore wraps a VectorStore and maintains the centroids of groups of
+// its vectors. A group is read from the store the first time its centroid
+// is asked for; from then on every write through the CentroidStore updates
+// its running sums, so later centroids cost no reads. Updates and deletes
+// read the vector they replace while any group is maintained.
+type CentroidStore struct {
+	VectorStore
+	mu     sync.Mutex
+	groups map[CentroidGroup]*centroidSums
+}
+
+// NewCentroidStore creates a store that maintains centroids
+func NewCentroidStore(store VectorStore) *CentroidStore {
+	return &CentroidStore{VectorStore: store, groups: make(map[CentroidGroup]*centroidSums)}
+}
+
+// Centroid implements CentroidSource
+func (s *CentroidStore) Centroid(group CentroidGroup) (*Centroid, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums, ok := s.groups[group]
+	if !ok {
+		var err error
+		if sums, err = sumGroup(s.VectorStore, group); err != nil {
+			return nil, err
+		}
+		s.groups[group] = sums
+	}
+	return sums.centroid(group)
+}
+
+// track adds v to the sums of the groups it belongs to, or subtracts it if
+// sign is -1
+func (s *CentroidStore) track(v *vector.Vector, sign float64) {
+	for group, sums := range s.groups {
+		if group.matches(v) {
+			sums.add(v, sign)
+		}
+	}
+}
+
+// stored returns the vector with the given ID as the wrapped store holds
+// it, if any group needs it, and nil otherwise
+func (s *CentroidStore) stored(id string) (*vector.Vector, error) {
+	if len(s.groups) == 0 {
+		return nil, nil
+	}
+	v, err := s.VectorStore.Get(id)
+	if errors.Is(err, ErrVectorNotFound) {
+		return nil, nil
+	}
+	return v, err
+}
+
+// Insert adds v and adds it to the centroids of its groups
+func (s *CentroidStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *CentroidStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := WithContext(s.VectorStore).InsertCtx(ctx, v); err != nil {
+		return err
+	}
+	s.retrack(nil, v.ID)
+	return nil
+}
+
+// Update replaces the stored vector and moves it between the centroids of
+// its old and new groups
+func (s *CentroidStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *CentroidStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.stored(v.ID)
+	if err != nil {
+		return err
+	}
+	if err := WithContext(s.VectorStore).UpdateCtx(ctx, v); err != nil {
+		return err
+	}
+	s.retrack(old, v.ID)
+	return nil
+}
+
+// Delete removes the vector and takes it out of the centroids of its groups
+func (s *CentroidStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *CentroidStore) DeleteCtx(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, err := s.stored(id)
+	if err != nil {
+		return err
+	}
+	if err := WithContext(s.VectorStore).DeleteCtx(ctx, id); err != nil {
+		return err
+	}
+	if old != nil {
+		s.track(old, -1)
+	}
+	return nil
+}
+
+// GetCtx implements ContextStore
+func (s *CentroidStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// ListCtx implements ContextStore
+func (s *CentroidStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *CentroidStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// retrack replaces old in the centroids with the vector now stored under
+// id, which is read back so centroids average the values as stored, e.g.
+// after an adapter projected them
+func (s *CentroidStore) retrack(old *vector.Vector, id string) {
+	if len(s.groups) == 0 {
+		return
+	}
+	if old != nil {
+		s.track(old, -1)
+	}
+	v, err := s.VectorStore.Get(id)
+	if err != nil {
+		// The centroids can no longer be trusted
+		s.groups = make(map[CentroidGroup]*centroidSums)
+		return
+	}
+	s.track(v, 1)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestCentroidStore(t *testing.T) {
+	memory := NewMemoryStore()
+	news := vector.NewVector("a", []float32{1, 2})
+	news.Metadata["category"] = "news"
+	memory.Insert(news)
+	memory.Insert(vector.NewVector("b", []float32{3, 4}))
+
+	store := NewCentroidStore(memory)
+	newsGroup := CentroidGroup{Key: "category", Value: "news"}
+	check := func(group CentroidGroup, values []float32, count int) {
+		t.Helper()
+		c, err := GroupCentroid(store, group)
+		if err != nil {
+			t.Fatalf("Centroid of %s failed: %v", group, err)
+		}
+		if !reflect.DeepEqual(c.Values, values) || c.Count != count {
+			t.Errorf("Expected centroid %v of %d vectors for %s, got %v of %d", values, count, group, c.Values, c.Count)
+		}
+	}
+
+	// Groups are read from the store on first use
+	check(CentroidGroup{}, []float32{2, 3}, 2)
+	check(newsGroup, []float32{1, 2}, 1)
+	check(CentroidGroup{Key: "category", Value: "sports"}, nil, 0)
+
+	// Writes keep the maintained groups current
+	more := vector.NewVector("c", []float32{3, 6})
+	more.Metadata["category"] = "news"
+	if err := store.Insert(more); err != nil {
+		t.Fatal(err)
+	}
+	check(newsGroup, []float32{2, 4}, 2)
+	check(CentroidGroup{}, []float32{7.0 / 3, 4}, 3)
+
+	moved := vector.NewVector("a", []float32{5, 5})
+	moved.Metadata["category"] = "sports"
+	if err := store.Update(moved); err != nil {
+		t.Fatal(err)
+	}
+	check(newsGroup, []float32{3, 6}, 1)
+	check(CentroidGroup{Key: "category", Value: "sports"}, []float32{5, 5}, 1)
+
+	if err := store.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	check(newsGroup, nil, 0)
+	check(CentroidGroup{}, []float32{4, 4.5}, 2)
+
+	// Vectors of another dimension leave a group without a centroid
+	if err := store.Insert(vector.NewVector("d", []float32{1, 2, 3})); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GroupCentroid(store, CentroidGroup{}); !errors.Is(err, vector.ErrInvalidDimension) {
+		t.Errorf("Expected ErrInvalidDimension for mixed dimensions, got %v", err)
+	}
+	store.Delete("d")
+	check(CentroidGroup{}, []float32{4, 4.5}, 2)
+
+	// Stores that maintain no centroids have them computed
+	c, err := GroupCentroid(memory, CentroidGroup{})
+	if err != nil || !reflect.DeepEqual(c.Values, []float32{4, 4.5}) {
+		t.Errorf("Expected the centroid of the memory store, got %v (err = %v)", c, err)
+	}
+}
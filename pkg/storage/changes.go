@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrInvalidCursor is returned for a change cursor that cannot be parsed
+var ErrInvalidCursor = errs.New(errs.InvalidArgument, "invalid change cursor")
+
+// ChangeCursor is a position in the order vectors were last written in:
+// by update time, then by ID. The zero cursor is before every vector,
+// including those written before timestamps were recorded.
+type ChangeCursor struct {
+	Time time.Time // Update time of the last vector seen
+	ID   string    // ID of the last vector seen with that time
+}
+
+// String returns the cursor as an opaque token for ParseChangeCursor
+func (c ChangeCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(unixNano(c.Time), 10) + ":" + c.ID))
+}
+
+// ParseChangeCursor parses a token returned by ChangeCursor.String, or a
+// date or time to start at
+func ParseChangeCursor(token string) (ChangeCursor, error) {
+	if token == "" {
+		return ChangeCursor{}, nil
+	}
+	if t, err := ParseTime(token); err == nil {
+		return ChangeCursor{Time: t}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ChangeCursor{}, fmt.Errorf("%w: %q is neither a token nor a time", ErrInvalidCursor, token)
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil {
+		return ChangeCursor{}, fmt.Errorf("%w: %q is neither a token nor a time", ErrInvalidCursor, token)
+	}
+	return ChangeCursor{Time: fromUnixNano(n), ID: id}, nil
+}
+
+// after reports whether a vector written at t with the given ID comes after
+// the cursor
+func (c ChangeCursor) after(t time.Time, id string) bool {
+	if !t.Equal(c.Time) {
+		return t.After(c.Time)
+	}
+	return id > c.ID
+}
+
+// Changes returns the vectors written after cursor, without their values,
+// in the order they were written. At most limit are returned if limit is
+// positive; the cursor of the last one continues from there.
+//
+// Deleted vectors leave nothing behind, so they are not reported.
+func Changes(store VectorStore, cursor ChangeCursor, limit int) ([]*vector.Vector, error) {
+	ids, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	var changed []*vector.Vector
+	for _, id := range ids {
+		v, err := GetMeta(store, id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		if cursor.after(v.UpdatedAt, v.ID) {
+			changed = append(changed, v)
+		}
+	}
+
+	sort.Slice(changed, func(i, j int) bool {
+		if !changed[i].UpdatedAt.Equal(changed[j].UpdatedAt) {
+			return changed[i].UpdatedAt.Before(changed[j].UpdatedAt)
+		}
+		return changed[i].ID < changed[j].ID
+	})
+	if limit > 0 && len(changed) > limit {
+		changed = changed[:limit]
+	}
+	return changed, nil
+}
+
+// CursorAfter returns the cursor following the vectors returned by
+// Changes, or cursor itself if there were none
+func CursorAfter(cursor ChangeCursor, changed []*vector.Vector) ChangeCursor {
+	if len(changed) == 0 {
+		return cursor
+	}
+	last := changed[len(changed)-1]
+	return ChangeCursor{Time: last.UpdatedAt, ID: last.ID}
+}
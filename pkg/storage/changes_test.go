@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestChanges(t *testing.T) {
+	clock := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return clock }
+
+	store := NewMemoryStore()
+	ids := func(changed []*vector.Vector) string {
+		s := ""
+		for _, v := range changed {
+			s += v.ID
+		}
+		return s
+	}
+
+	// Vectors written at the same time are ordered by ID
+	store.Insert(vector.NewVector("b", []float32{1}))
+	store.Insert(vector.NewVector("a", []float32{1}))
+	clock = clock.Add(time.Second)
+	store.Insert(vector.NewVector("c", []float32{1}))
+
+	changed, err := Changes(store, ChangeCursor{}, 2)
+	if err != nil {
+		t.Fatalf("Changes failed: %v", err)
+	}
+	if ids(changed) != "ab" {
+		t.Errorf("Expected a, b first, got %s", ids(changed))
+	}
+	if len(changed) > 0 && changed[0].Values != nil {
+		t.Errorf("Expected changes without values, got %v", changed[0].Values)
+	}
+
+	// The token of the last change continues after it
+	token := CursorAfter(ChangeCursor{}, changed).String()
+	cursor, err := ParseChangeCursor(token)
+	if err != nil {
+		t.Fatalf("Failed to parse token %s: %v", token, err)
+	}
+	clock = clock.Add(time.Second)
+	store.Update(vector.NewVector("a", []float32{2}))
+
+	changed, _ = Changes(store, cursor, 0)
+	if ids(changed) != "ca" {
+		t.Errorf("Expected c and the updated a, got %s", ids(changed))
+	}
+	if next := CursorAfter(cursor, nil); next != cursor {
+		t.Errorf("Expected the cursor to stay put without changes, got %v", next)
+	}
+
+	// Times include the vectors written at that time
+	cursor, err = ParseChangeCursor("2024-01-31T12:00:00Z")
+	if err != nil {
+		t.Fatalf("Failed to parse time: %v", err)
+	}
+	changed, _ = Changes(store, cursor, 0)
+	if ids(changed) != "bca" {
+		t.Errorf("Expected b, c and a since the time, got %s", ids(changed))
+	}
+
+	if _, err := ParseChangeCursor("not a cursor!"); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
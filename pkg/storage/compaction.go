@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// compactionMinTierSize is the size of the segments of the smallest
+	// tier, which every smaller segment shares
+	compactionMinTierSize = 64 << 10
+
+	// compactionTierFactor is the ratio of the sizes of consecutive tiers:
+	// segments of 64 to 256 KB share a tier, as do segments of 256 KB to 1 MB
+	compactionTierFactor = 4
+)
+
+// CompactionPolicy configures the compaction of the segments of an
+// ObjectStore. Every write adds records to the newest segment and leaves
+// the records it replaces or deletes in older ones, so without compaction
+// segments only accumulate.
+type CompactionPolicy struct {
+	Interval          time.Duration // How often the segments are checked (default: 1m)
+	MinSegments       int           // Consecutive segments of a size tier merged together (default: 4)
+	MaxGarbageRatio   float64       // Share of dead records that rewrites every segment (default: 0.5)
+	MaxBytesPerSecond int64         // Segment bytes read and written per second (0 = unthrottled)
+}
+
+// DefaultCompactionPolicy returns the default compaction policy
+func DefaultCompactionPolicy() CompactionPolicy {
+	return CompactionPolicy{Interval: time.Minute, MinSegments: 4, MaxGarbageRatio: 0.5}
+}
+
+// withDefaults returns the policy with zero fields set to their default
+func (p CompactionPolicy) withDefaults() CompactionPolicy {
+	defaults := DefaultCompactionPolicy()
+	if p.Interval <= 0 {
+		p.Interval = defaults.Interval
+	}
+	if p.MinSegments < 2 {
+		p.MinSegments = defaults.MinSegments
+	}
+	if p.MaxGarbageRatio <= 0 {
+		p.MaxGarbageRatio = defaults.MaxGarbageRatio
+	}
+	return p
+}
+
+// CompactionStats reports the compactions of an ObjectStore
+type CompactionStats struct {
+	Compactions    int64     `json:"compactions"`     // Merges of segments
+	SegmentsMerged int64     `json:"segments_merged"` // Segments replaced by merges
+	RecordsDropped int64     `json:"records_dropped"` // Dead records left out of merged segments
+	BytesRead      int64     `json:"bytes_read"`
+	BytesWritten   int64     `json:"bytes_written"`
+	LastCompaction time.Time `json:"last_compaction"` // Zero until the first merge
+	Segments       int       `json:"segments"`        // Live segments now
+	GarbageRatio   float64   `json:"garbage_ratio"`   // Share of the records in segments that are dead
+}
+
+// segmentInfo is what an ObjectStore knows about a segment without reading it
+type segmentInfo struct {
+	size    int // Bytes
+	records int
+}
+
+// StartCompaction compacts the segments in the background as policy says,
+// until the store is closed. Calling it again replaces the policy.
+func (s *ObjectStore) StartCompaction(policy CompactionPolicy) {
+	s.stopCompaction()
+	policy = policy.withDefaults()
+	stop, done := make(chan struct{}), make(chan struct{})
+
+	s.mu.Lock()
+	s.compactionStop, s.compactionDone = stop, done
+	s.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// A failed pass leaves the segments as they were; the next
+				// tick tries again
+				s.Compact(policy)
+			}
+		}
+	}()
+}
+
+// stopCompaction stops background compaction and waits for a running pass
+func (s *ObjectStore) stopCompaction() {
+	s.mu.Lock()
+	stop, done := s.compactionStop, s.compactionDone
+	s.compactionStop, s.compactionDone = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Compact runs one compaction pass and returns the number of segments it
+// merged. If more than policy.MaxGarbageRatio of the records in segments
+// are dead, every segment is rewritten into one; otherwise the oldest run of
+// at least policy.MinSegments consecutive segments of a size tier is merged.
+// Only consecutive segments are merged, so replaying them keeps the order of
+// writes. Writes go on during a pass.
+func (s *ObjectStore) Compact(policy CompactionPolicy) (int, error) {
+	policy = policy.withDefaults()
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	segments := append([]string{}, s.manifest.Segments...)
+	start, end := s.pickCompaction(segments, policy)
+	s.mu.Unlock()
+	if end-start < 1 {
+		return 0, nil
+	}
+	return end - start, s.merge(segments[start:end], start == 0, policy.MaxBytesPerSecond)
+}
+
+// pickCompaction returns the range of segments to merge, empty if there is
+// none (caller must hold s.mu)
+func (s *ObjectStore) pickCompaction(segments []string, policy CompactionPolicy) (int, int) {
+	if ratio := s.garbageRatioLocked(); ratio > policy.MaxGarbageRatio {
+		return 0, len(segments)
+	}
+
+	tier := func(name string) int {
+		size := s.segments[name].size
+		if size < compactionMinTierSize {
+			return 0
+		}
+		return 1 + int(math.Log(float64(size)/compactionMinTierSize)/math.Log(compactionTierFactor))
+	}
+	for start := 0; start < len(segments); {
+		end := start + 1
+		for end < len(segments) && tier(segments[end]) == tier(segments[start]) {
+			end++
+		}
+		if end-start >= policy.MinSegments {
+			return start, end
+		}
+		start = end
+	}
+	return 0, 0
+}
+
+// garbageRatioLocked returns the share of the records in segments that a
+// later write replaced or deleted (caller must hold s.mu). Pending writes
+// count as live, so the ratio errs low.
+func (s *ObjectStore) garbageRatioLocked() float64 {
+	total := 0
+	for _, name := range s.manifest.Segments {
+		total += s.segments[name].records
+	}
+	live, _ := s.memStore.Count()
+	if total == 0 || live >= total {
+		return 0
+	}
+	return float64(total-live) / float64(total)
+}
+
+// merge replaces run, consecutive segments of the manifest, with one
+// segment holding the last write of each vector. Deletes are dropped when
+// run starts with the oldest segment, as nothing older can hold the vector.
+func (s *ObjectStore) merge(run []string, oldest bool, bytesPerSecond int64) error {
+	throttle := newThrottle(bytesPerSecond)
+	latest := make(map[string]segmentRecord)
+	ctx := context.Background()
+	read, records := 0, 0
+	for _, name := range run {
+		data, err := s.readSegment(ctx, name)
+		if err != nil {
+			return err
+		}
+		throttle.wait(len(data))
+		read += len(data)
+
+		segment, err := decodeSegment(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode segment %s: %w", name, err)
+		}
+		records += len(segment)
+		for _, rec := range segment {
+			latest[rec.id] = rec
+		}
+	}
+
+	kept := make([]segmentRecord, 0, len(latest))
+	for _, rec := range latest {
+		if rec.op == segmentOpDelete && oldest {
+			continue
+		}
+		kept = append(kept, rec)
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].id < kept[j].id })
+
+	// The merged segment takes a new name, so a failure before the manifest
+	// is written leaves only an unreferenced object
+	s.mu.Lock()
+	name := fmt.Sprintf("%s%08d.seg", segmentPrefix, s.manifest.NextSegment)
+	s.manifest.NextSegment++
+	s.mu.Unlock()
+
+	var data []byte
+	if len(kept) > 0 {
+		data = encodeSegment(kept)
+		throttle.wait(len(data))
+		if err := s.bucket.Put(ctx, name, data); err != nil {
+			return fmt.Errorf("failed to upload segment %s: %w", name, err)
+		}
+		if s.cache != nil {
+			_ = s.cache.Put(ctx, name, data)
+		}
+	}
+
+	if err := s.publishMerge(ctx, run, name, data, len(kept)); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.compaction.Compactions++
+	s.compaction.SegmentsMerged += int64(len(run))
+	s.compaction.RecordsDropped += int64(records - len(kept))
+	s.compaction.BytesRead += int64(read)
+	s.compaction.BytesWritten += int64(len(data))
+	s.compaction.LastCompaction = time.Now()
+	s.mu.Unlock()
+
+	// The merged segments are no longer referenced. Deleting them is best
+	// effort: a leftover only wastes space.
+	for _, old := range run {
+		_ = s.bucket.Delete(ctx, old)
+		if s.cache != nil {
+			_ = s.cache.Delete(ctx, old)
+		}
+	}
+	return nil
+}
+
+// publishMerge writes a manifest in which the merged segment, or nothing if
+// it is empty, replaces run
+func (s *ObjectStore) publishMerge(ctx context.Context, run []string, name string, data []byte, records int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Flushes only append segments, and merges hold compactMu, so run is
+	// still where it was
+	start := -1
+	for i, segment := range s.manifest.Segments {
+		if segment == run[0] {
+			start = i
+			break
+		}
+	}
+	if start < 0 || start+len(run) > len(s.manifest.Segments) {
+		return fmt.Errorf("segments %s to %s changed during compaction", run[0], run[len(run)-1])
+	}
+
+	segments := append([]string{}, s.manifest.Segments[:start]...)
+	if len(data) > 0 {
+		segments = append(segments, name)
+	}
+	segments = append(segments, s.manifest.Segments[start+len(run):]...)
+	next := objectManifest{Version: segmentVersion, Segments: segments, NextSegment: s.manifest.NextSegment}
+	manifestData, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := s.bucket.Put(ctx, manifestKey, manifestData); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	s.manifest = next
+	for _, old := range run {
+		delete(s.segments, old)
+	}
+	if len(data) > 0 {
+		s.segments[name] = segmentInfo{size: len(data), records: records}
+	}
+	return nil
+}
+
+// CompactionStats returns the compactions of the store so far
+func (s *ObjectStore) CompactionStats() CompactionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.compaction
+	stats.Segments = len(s.manifest.Segments)
+	stats.GarbageRatio = s.garbageRatioLocked()
+	return stats
+}
+
+// CompactionStatsOf returns the compaction stats of the ObjectStore store
+// wraps, and false if it wraps none
+func CompactionStatsOf(store VectorStore) (CompactionStats, bool) {
+	for ; store != nil; store = Unwrap(store) {
+		if s, ok := store.(*ObjectStore); ok {
+			return s.CompactionStats(), true
+		}
+	}
+	return CompactionStats{}, false
+}
+
+// throttle limits compaction IO to a number of bytes per second
+type throttle struct {
+	rate  int64
+	start time.Time
+	bytes int64
+}
+
+// newThrottle creates a throttle; a rate of 0 does not throttle
+func newThrottle(rate int64) *throttle {
+	return &throttle{rate: rate, start: time.Now()}
+}
+
+// wait sleeps until n more bytes fit in the rate
+func (t *throttle) wait(n int) {
+	if t.rate <= 0 {
+		return
+	}
+	t.bytes += int64(n)
+	due := t.start.Add(time.Duration(float64(t.bytes) / float64(t.rate) * float64(time.Second)))
+	if d := time.Until(due); d > 0 {
+		time.Sleep(d)
+	}
+}
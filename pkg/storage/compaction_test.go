@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// openCompactionStore opens an ObjectStore over bucket that writes a segment
+// for every Flush
+func openCompactionStore(t *testing.T, bucket Bucket) *ObjectStore {
+	t.Helper()
+	store, err := NewObjectStore(bucket, &ObjectStoreOptions{FlushThreshold: 1000})
+	if err != nil {
+		t.Fatalf("Failed to open object store: %v", err)
+	}
+	return store
+}
+
+// flushWrite checks a write and flushes it as a segment of its own
+func flushWrite(t *testing.T, store *ObjectStore, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+}
+
+func TestCompactTiers(t *testing.T) {
+	bucket, _ := NewDirBucket(t.TempDir())
+	store := openCompactionStore(t, bucket)
+
+	// One segment of a larger tier, then small ones that delete from it
+	for i := 0; i < 40; i++ {
+		store.Insert(vector.Random(fmt.Sprintf("v%02d", i), 512))
+	}
+	flushWrite(t, store, nil)
+	flushWrite(t, store, store.Delete("v00"))
+	for i := 1; i <= 3; i++ {
+		flushWrite(t, store, store.Insert(vector.NewVector(fmt.Sprintf("x%d", i), []float32{1, 2, 3, 4})))
+	}
+
+	merged, err := store.Compact(CompactionPolicy{MinSegments: 4})
+	if err != nil || merged != 4 {
+		t.Fatalf("Expected the 4 small segments to be merged, got %d (%v)", merged, err)
+	}
+	if merged, _ := store.Compact(CompactionPolicy{MinSegments: 4}); merged != 0 {
+		t.Errorf("Expected nothing left to merge, got %d segments", merged)
+	}
+	stats := store.CompactionStats()
+	if stats.Compactions != 1 || stats.SegmentsMerged != 4 || stats.Segments != 2 || stats.BytesRead == 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if keys, _ := bucket.List(context.Background(), segmentPrefix); len(keys) != 2 {
+		t.Errorf("Expected the merged segments to be deleted, got %v", keys)
+	}
+	store.Close()
+
+	// The merge kept the delete of a vector of the older segment
+	reopened := openCompactionStore(t, bucket)
+	defer reopened.Close()
+	if _, err := reopened.Get("v00"); err != ErrVectorNotFound {
+		t.Errorf("Expected v00 to stay deleted, got %v", err)
+	}
+	if count, _ := reopened.Count(); count != 42 {
+		t.Errorf("Expected 42 vectors, got %d", count)
+	}
+}
+
+func TestCompactGarbage(t *testing.T) {
+	bucket, _ := NewDirBucket(t.TempDir())
+	store := openCompactionStore(t, bucket)
+	for i := 0; i < 6; i++ {
+		flushWrite(t, store, store.Insert(vector.NewVector(fmt.Sprintf("v%d", i), []float32{1, 2})))
+	}
+	for i := 0; i < 4; i++ {
+		flushWrite(t, store, store.Delete(fmt.Sprintf("v%d", i)))
+	}
+	flushWrite(t, store, store.Update(vector.NewVector("v5", []float32{3, 4})))
+
+	// 11 records hold 2 live vectors, so every segment is rewritten
+	if ratio := store.CompactionStats().GarbageRatio; ratio < 0.8 {
+		t.Errorf("Expected a garbage ratio of 9/11, got %f", ratio)
+	}
+	merged, err := store.Compact(CompactionPolicy{MinSegments: 100})
+	if err != nil || merged != 11 {
+		t.Fatalf("Expected all 11 segments to be merged, got %d (%v)", merged, err)
+	}
+	stats := store.CompactionStats()
+	if stats.Segments != 1 || stats.RecordsDropped != 9 || stats.GarbageRatio != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	store.Close()
+
+	reopened := openCompactionStore(t, bucket)
+	defer reopened.Close()
+	if ids, _ := reopened.List(); len(ids) != 2 {
+		t.Errorf("Expected v4 and v5, got %v", ids)
+	}
+	if v, err := reopened.Get("v5"); err != nil || v.Values[0] != 3 {
+		t.Errorf("Expected the update of v5, got %v (%v)", v, err)
+	}
+}
+
+func TestStartCompaction(t *testing.T) {
+	bucket, _ := NewDirBucket(t.TempDir())
+	store := openCompactionStore(t, bucket)
+	for i := 0; i < 4; i++ {
+		flushWrite(t, store, store.Insert(vector.NewVector(fmt.Sprintf("v%d", i), []float32{1, 2})))
+	}
+
+	store.StartCompaction(CompactionPolicy{Interval: time.Millisecond, MinSegments: 4})
+	deadline := time.Now().Add(5 * time.Second)
+	for store.CompactionStats().Segments != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if stats, ok := CompactionStatsOf(NewCachedStore(store, 10)); !ok || stats.Segments != 1 {
+		t.Errorf("Expected background compaction to merge the segments, got %+v", stats)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	start := time.Now()
+	throttle := newThrottle(10000)
+	throttle.wait(300)
+	throttle.wait(300)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected 600 bytes at 10000 bytes/s to take 60ms, took %v", elapsed)
+	}
+	newThrottle(0).wait(1 << 30)
+}
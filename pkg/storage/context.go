@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// ContextStore is the revision of VectorStore whose operations take a
+// context, so backends that talk to a database or over the network can
+// honor deadlines and cancellation. WithContext adapts any VectorStore to it
+// and FromContext adapts it back, so code written against either interface
+// works with every store.
+type ContextStore interface {
+	// InsertCtx adds a new vector to the store
+	InsertCtx(ctx context.Context, v *vector.Vector) error
+
+	// GetCtx retrieves a vector by ID
+	GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error)
+
+	// UpdateCtx updates an existing vector
+	UpdateCtx(ctx context.Context, v *vector.Vector) error
+
+	// DeleteCtx removes a vector by ID
+	DeleteCtx(ctx context.Context, id string) error
+
+	// ListCtx returns vector IDs in order
+	ListCtx(ctx context.Context, opts ListOptions) ([]string, error)
+
+	// CountCtx returns the number of vectors in the store
+	CountCtx(ctx context.Context) (int, error)
+
+	// Close closes the store
+	Close() error
+}
+
+// GetOptions tunes GetCtx
+type GetOptions struct {
+	MetadataOnly bool // The vector's values may be left nil, as with GetMeta
+}
+
+// ListOptions selects the IDs returned by ListCtx. The zero value lists
+// every ID.
+type ListOptions struct {
+	Prefix string // Only IDs starting with Prefix
+	After  string // Only IDs after After, the last ID of the previous page
+	Limit  int    // At most Limit IDs; 0 means no limit
+}
+
+// WithContext returns store as a ContextStore. Stores that implement it are
+// returned as they are. Other stores are adapted: each call fails with the
+// context's error if it is already done, but cannot be interrupted once
+// it has started. The wrappers of this package, such as CachedStore,
+// implement ContextStore and pass the context on to the store they wrap.
+func WithContext(store VectorStore) ContextStore {
+	if s, ok := store.(ContextStore); ok {
+		return s
+	}
+	if s, ok := store.(*backgroundStore); ok {
+		return s.store
+	}
+	return &contextAdapter{store: store}
+}
+
+// FromContext returns store as a VectorStore whose operations run with
+// context.Background(), for code written against VectorStore
+func FromContext(store ContextStore) VectorStore {
+	if s, ok := store.(VectorStore); ok {
+		return s
+	}
+	if s, ok := store.(*contextAdapter); ok {
+		return s.store
+	}
+	return &backgroundStore{store: store}
+}
+
+// contextAdapter adapts a VectorStore to ContextStore
+type contextAdapter struct {
+	store VectorStore
+}
+
+func (s *contextAdapter) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Insert(v)
+}
+
+func (s *contextAdapter) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.MetadataOnly {
+		return GetMeta(s.store, id)
+	}
+	return s.store.Get(id)
+}
+
+func (s *contextAdapter) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Update(v)
+}
+
+func (s *contextAdapter) DeleteCtx(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.store.Delete(id)
+}
+
+func (s *contextAdapter) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ListAfter(s.store, opts.Prefix, opts.After, opts.Limit)
+}
+
+func (s *contextAdapter) CountCtx(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.store.Count()
+}
+
+func (s *contextAdapter) Close() error {
+	return s.store.Close()
+}
+
+// backgroundStore adapts a ContextStore to VectorStore
+type backgroundStore struct {
+	store ContextStore
+}
+
+func (s *backgroundStore) Insert(v *vector.Vector) error {
+	return s.store.InsertCtx(context.Background(), v)
+}
+
+func (s *backgroundStore) Get(id string) (*vector.Vector, error) {
+	return s.store.GetCtx(context.Background(), id, GetOptions{})
+}
+
+// GetMeta implements MetaReader
+func (s *backgroundStore) GetMeta(id string) (*vector.Vector, error) {
+	return s.store.GetCtx(context.Background(), id, GetOptions{MetadataOnly: true})
+}
+
+func (s *backgroundStore) Update(v *vector.Vector) error {
+	return s.store.UpdateCtx(context.Background(), v)
+}
+
+func (s *backgroundStore) Delete(id string) error {
+	return s.store.DeleteCtx(context.Background(), id)
+}
+
+func (s *backgroundStore) List() ([]string, error) {
+	return s.store.ListCtx(context.Background(), ListOptions{})
+}
+
+// ListPrefix implements PrefixLister
+func (s *backgroundStore) ListPrefix(prefix string) ([]string, error) {
+	return s.store.ListCtx(context.Background(), ListOptions{Prefix: prefix})
+}
+
+func (s *backgroundStore) Count() (int, error) {
+	return s.store.CountCtx(context.Background())
+}
+
+func (s *backgroundStore) Close() error {
+	return s.store.Close()
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestContextStore(t *testing.T) {
+	sqlite, err := NewSQLiteStore(filepath.Join(t.TempDir(), "vectors.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlite.Close()
+
+	wrapped, err := NewSQLiteStore(filepath.Join(t.TempDir(), "wrapped.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrapped.Close()
+	bucket, _ := NewDirBucket(t.TempDir())
+	object, err := NewObjectStore(bucket, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]ContextStore{
+		"sqlite":  WithContext(sqlite),
+		"adapted": WithContext(NewMemoryStore()),
+		"wrapped": WithContext(NewCachedStore(NewGatedStore(wrapped), 10)),
+		"object":  WithContext(object),
+	}
+	if _, ok := stores["sqlite"].(*SQLiteStore); !ok {
+		t.Errorf("Expected SQLiteStore to implement ContextStore, got %T", stores["sqlite"])
+	}
+
+	for name, store := range stores {
+		ctx := context.Background()
+		for _, id := range []string{"a/1", "a/2", "a/3", "b/1"} {
+			v := vector.NewVectorWithMetadata(id, []float32{1, 2}, map[string]string{"k": id})
+			if err := store.InsertCtx(ctx, v); err != nil {
+				t.Fatalf("%s: InsertCtx failed: %v", name, err)
+			}
+		}
+
+		got, err := store.GetCtx(ctx, "a/2", GetOptions{MetadataOnly: true})
+		if err != nil || got.Dimension != 2 || got.Metadata["k"] != "a/2" {
+			t.Errorf("%s: unexpected vector %+v (%v)", name, got, err)
+		}
+		if _, err := store.GetCtx(ctx, "missing", GetOptions{}); !errors.Is(err, ErrVectorNotFound) {
+			t.Errorf("%s: expected ErrVectorNotFound, got %v", name, err)
+		}
+
+		for _, test := range []struct {
+			opts ListOptions
+			want []string
+		}{
+			{ListOptions{}, []string{"a/1", "a/2", "a/3", "b/1"}},
+			{ListOptions{Prefix: "a/", After: "a/1", Limit: 1}, []string{"a/2"}},
+			{ListOptions{Prefix: "a/", After: "a/2"}, []string{"a/3"}},
+		} {
+			ids, err := store.ListCtx(ctx, test.opts)
+			if err != nil || !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("%s: ListCtx(%+v) = %v (%v), want %v", name, test.opts, ids, err, test.want)
+			}
+		}
+
+		// A cancelled context stops the operation before it changes anything
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := store.DeleteCtx(cancelled, "a/1"); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, err)
+		}
+		if err := store.InsertCtx(cancelled, vector.NewVector("c", []float32{1})); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: expected context.Canceled, got %v", name, err)
+		}
+		if count, err := store.CountCtx(ctx); err != nil || count != 4 {
+			t.Errorf("%s: expected 4 vectors, got %d (%v)", name, count, err)
+		}
+	}
+}
+
+// ctxOnlyStore is a backend written against ContextStore alone
+type ctxOnlyStore struct {
+	ContextStore
+}
+
+func TestFromContext(t *testing.T) {
+	memory := NewMemoryStore()
+	if FromContext(WithContext(memory)) != VectorStore(memory) {
+		t.Error("Expected FromContext to undo WithContext")
+	}
+
+	store := FromContext(ctxOnlyStore{WithContext(memory)})
+	if err := store.Insert(vector.NewVectorWithMetadata("p/1", []float32{1}, map[string]string{"k": "v"})); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := ListPrefix(store, "p/"); err != nil || len(ids) != 1 {
+		t.Errorf("Expected p/1, got %v (%v)", ids, err)
+	}
+	if v, err := GetMeta(store, "p/1"); err != nil || v.Metadata["k"] != "v" {
+		t.Errorf("Expected metadata, got %+v (%v)", v, err)
+	}
+}
+
+// ctxKey marks the contexts a test passes in
+type ctxKey struct{}
+
+// ctxRecorder is a backend that records whether the contexts of its calls
+// are the marked ones
+type ctxRecorder struct {
+	ContextStore
+	unmarked []string
+}
+
+func (s *ctxRecorder) check(ctx context.Context, call string) {
+	if ctx.Value(ctxKey{}) == nil {
+		s.unmarked = append(s.unmarked, call)
+	}
+}
+
+func (s *ctxRecorder) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	s.check(ctx, "insert")
+	return s.ContextStore.InsertCtx(ctx, v)
+}
+
+func (s *ctxRecorder) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	s.check(ctx, "update")
+	return s.ContextStore.UpdateCtx(ctx, v)
+}
+
+func (s *ctxRecorder) DeleteCtx(ctx context.Context, id string) error {
+	s.check(ctx, "delete")
+	return s.ContextStore.DeleteCtx(ctx, id)
+}
+
+func (s *ctxRecorder) CountCtx(ctx context.Context) (int, error) {
+	s.check(ctx, "count")
+	return s.ContextStore.CountCtx(ctx)
+}
+
+func TestWrappersPassContext(t *testing.T) {
+	recorder := &ctxRecorder{ContextStore: WithContext(NewMemoryStore())}
+	var store VectorStore = FromContext(recorder)
+	store = NewQuotaStore(store, Quota{MaxVectors: 10}, nil)
+	store = NewSchemaStore(store)
+	store = NewDimensionStore(store)
+	store = NewFiniteStore(store, FiniteReject)
+	store = NewCentroidStore(store)
+	store = NewAccessStore(store, 1)
+	store = NewObservableStore(store)
+	store = NewGatedStore(store)
+	store = NewCachedStore(store, 10)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, true)
+	wrapped := WithContext(store)
+	if err := wrapped.InsertCtx(ctx, vector.NewVector("a", []float32{1, 2})); err != nil {
+		t.Fatalf("InsertCtx failed: %v", err)
+	}
+	if err := wrapped.UpdateCtx(ctx, vector.NewVector("a", []float32{3, 4})); err != nil {
+		t.Fatalf("UpdateCtx failed: %v", err)
+	}
+	if count, err := wrapped.CountCtx(ctx); err != nil || count != 1 {
+		t.Errorf("Expected 1 vector, got %d (%v)", count, err)
+	}
+	if err := wrapped.DeleteCtx(ctx, "a"); err != nil {
+		t.Fatalf("DeleteCtx failed: %v", err)
+	}
+	if len(recorder.unmarked) > 0 {
+		t.Errorf("Expected every call to reach the backend with its context, got %v without", recorder.unmarked)
+	}
+
+	for _, wrapper := range []VectorStore{NewReadOnlyStore(store), NewAdaptedStore(store, nil)} {
+		if _, ok := wrapper.(ContextStore); !ok {
+			t.Errorf("Expected %T to implement ContextStore", wrapper)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// DimensionError describes a vector whose dimension differs from the
+// vectors already stored in its collection. It wraps
+// vector.ErrInvalidDimension.
+type DimensionError struct {
+	Collection string // Empty for vectors outside every collection
+	ID         string // Vector written
+	Expected   int    // Dimension of the stored vectors
+	Got        int    // Dimension of the written vector
+}
+
+func (e *DimensionError) Error() string {
+	scope := "the stored vectors"
+	if e.Collection != "" {
+		scope = "the vectors of collection " + e.Collection
+	}
+	return fmt.Sprintf("%v: vector %s has dimension %d, but %s have dimension %d", vector.ErrInvalidDimension, e.ID, e.Got, scope, e.Expected)
+}
+
+// Unwrap returns vector.ErrInvalidDimension
+func (e *DimensionError) Unwrap() error {
+	return vector.ErrInvalidDimension
+}
+
+// dimensionScope is a collection whose vectors share a dimension
+type dimensionScope struct {
+	collection string
+	prefix     string
+	dimension  int // Last dimension seen, 0 until a vector is written
+}
+
+// DimensionStore wraps a VectorStore and rejects writes of vectors whose
+// dimension differs from the vectors stored before them, which searches
+// could not compare. The vectors of each collection added with
+// AddCollection are checked among themselves, other vectors among
+// themselves. A collection takes the dimension of the vectors it holds, or
+// of the first vector written to it once it is empty.
+type DimensionStore struct {
+	VectorStore
+	mu     sync.Mutex
+	scopes []*dimensionScope // Longest prefix first, ending with the whole store
+}
+
+// NewDimensionStore creates a store that checks the dimension of writes
+func NewDimensionStore(store VectorStore) *DimensionStore {
+	return &DimensionStore{VectorStore: store, scopes: []*dimensionScope{{}}}
+}
+
+// AddCollection checks the vectors whose IDs start with prefix among
+// themselves. An empty prefix names the vectors outside other collections.
+func (s *DimensionStore) AddCollection(collection, prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if prefix == "" {
+		s.scopes[len(s.scopes)-1].collection = collection
+		return
+	}
+	s.scopes = append(s.scopes, &dimensionScope{collection: collection, prefix: prefix})
+	sort.SliceStable(s.scopes, func(i, j int) bool { return len(s.scopes[i].prefix) > len(s.scopes[j].prefix) })
+}
+
+// scope returns the collection of id, the one with the longest prefix
+func (s *DimensionStore) scope(id string) *dimensionScope {
+	for _, scope := range s.scopes {
+		if strings.HasPrefix(id, scope.prefix) {
+			return scope
+		}
+	}
+	return s.scopes[len(s.scopes)-1]
+}
+
+// check returns a *DimensionError if v, as its adapter stores it, does not
+// match the vectors of its collection
+func (s *DimensionStore) check(v *vector.Vector) error {
+	if adapter := storeAdapter(s.VectorStore); adapter != nil {
+		adapted, err := adapter.Adapt(v)
+		if err != nil {
+			return err
+		}
+		v = adapted
+	}
+
+	scope := s.scope(v.ID)
+	if scope.dimension == v.Dimension {
+		return nil
+	}
+
+	// The vectors seen last may have been deleted or replaced since
+	dimension, err := s.storedDimension(scope, v.ID)
+	if err != nil {
+		return err
+	}
+	if dimension != 0 && dimension != v.Dimension {
+		scope.dimension = dimension
+		return &DimensionError{Collection: scope.collection, ID: v.ID, Expected: dimension, Got: v.Dimension}
+	}
+	scope.dimension = v.Dimension
+	return nil
+}
+
+// storedDimension returns the dimension of a vector of scope other than
+// the one with ID except, or 0 if there is none
+func (s *DimensionStore) storedDimension(scope *dimensionScope, except string) (int, error) {
+	ids, err := ListPrefix(s.VectorStore, scope.prefix)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if id == except || s.scope(id) != scope {
+			continue
+		}
+		v, err := GetMeta(s.VectorStore, id)
+		if errors.Is(err, ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return v.Dimension, nil
+	}
+	return 0, nil
+}
+
+// Insert checks the dimension of v and adds it
+func (s *DimensionStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *DimensionStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(v); err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).InsertCtx(ctx, v)
+}
+
+// Update checks the dimension of v and replaces the stored vector
+func (s *DimensionStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *DimensionStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(v); err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).UpdateCtx(ctx, v)
+}
+
+// GetCtx implements ContextStore
+func (s *DimensionStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// DeleteCtx implements ContextStore
+func (s *DimensionStore) DeleteCtx(ctx context.Context, id string) error {
+	return WithContext(s.VectorStore).DeleteCtx(ctx, id)
+}
+
+// ListCtx implements ContextStore
+func (s *DimensionStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *DimensionStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// storeAdapter returns the adapter of the first AdaptedStore store wraps,
+// or nil if there is none
+func storeAdapter(store VectorStore) VectorAdapter {
+	for ; store != nil; store = Unwrap(store) {
+		if s, ok := store.(*AdaptedStore); ok {
+			return s.adapter
+		}
+	}
+	return nil
+}
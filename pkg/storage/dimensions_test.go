@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+func TestDimensionStore(t *testing.T) {
+	memory := NewMemoryStore()
+	memory.Insert(vector.NewVector("old", []float32{1, 2, 3}))
+
+	store := NewDimensionStore(memory)
+	store.AddCollection("images", "img:")
+
+	// Vectors outside the collection match the stored ones
+	if err := store.Insert(vector.NewVector("a", []float32{1, 2, 3})); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	err := store.Insert(vector.NewVector("b", []float32{1, 2}))
+	var dimErr *DimensionError
+	if !errors.As(err, &dimErr) || dimErr.Expected != 3 || dimErr.Got != 2 || dimErr.Collection != "" {
+		t.Fatalf("Expected a DimensionError of 3 and 2, got %v", err)
+	}
+	if !errors.Is(err, vector.ErrInvalidDimension) || errs.CodeOf(err) != errs.DimensionMismatch {
+		t.Errorf("Expected the error to be a dimension mismatch, got %v", err)
+	}
+	if err := store.Update(vector.NewVector("a", []float32{1})); err == nil {
+		t.Error("Expected an update to another dimension to fail")
+	}
+
+	// The collection takes the dimension of its first vector
+	if err := store.Insert(vector.NewVector("img:1", []float32{1, 2})); err != nil {
+		t.Fatalf("Insert into the collection failed: %v", err)
+	}
+	err = store.Insert(vector.NewVector("img:2", []float32{1, 2, 3}))
+	if !errors.As(err, &dimErr) || dimErr.Collection != "images" || dimErr.Expected != 2 {
+		t.Errorf("Expected a DimensionError of images, got %v", err)
+	}
+
+	// An emptied collection takes a new dimension, as does its only vector
+	if err := store.Update(vector.NewVector("img:1", []float32{1, 2, 3, 4})); err != nil {
+		t.Errorf("Expected the only vector of a collection to change dimension, got %v", err)
+	}
+	store.Delete("img:1")
+	if err := store.Insert(vector.NewVector("img:3", []float32{1})); err != nil {
+		t.Errorf("Expected an emptied collection to accept a new dimension, got %v", err)
+	}
+	if count, _ := memory.Count(); count != 3 {
+		t.Errorf("Expected rejected vectors not to be stored, got %d vectors", count)
+	}
+}
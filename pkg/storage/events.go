@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// EventType identifies the kind of change described by an Event
+type EventType string
+
+const (
+	// EventInsert is emitted after a vector was inserted
+	EventInsert EventType = "insert"
+
+	// EventUpdate is emitted after a vector was updated
+	EventUpdate EventType = "update"
+
+	// EventDelete is emitted after a vector was deleted
+	EventDelete EventType = "delete"
+)
+
+// Event describes a single committed change to a store
+type Event struct {
+	Seq    uint64         `json:"seq"`              // Monotonically increasing per store; gaps mean dropped events
+	Type   EventType      `json:"type"`             // insert, update or delete
+	ID     string         `json:"id"`               // ID of the affected vector
+	Vector *vector.Vector `json:"vector,omitempty"` // New state of the vector (nil for deletes)
+	Time   time.Time      `json:"time"`             // When the change was committed
+}
+
+// EventHandler is called synchronously for every committed change. Handlers
+// must not write to the store they are subscribed to.
+type EventHandler func(Event)
+
+// ObservableStore wraps a VectorStore and notifies subscribers about every
+// successful write. Handlers run on the writing goroutine after the change
+// was committed, so they should return quickly; use Events for consumers that
+// may block.
+type ObservableStore struct {
+	VectorStore
+
+	emitMu   sync.Mutex // Serializes delivery so handlers see events in Seq order
+	mu       sync.RWMutex
+	seq      uint64
+	nextID   int
+	handlers map[int]EventHandler
+}
+
+// NewObservableStore wraps a store with change notifications
+func NewObservableStore(store VectorStore) *ObservableStore {
+	return &ObservableStore{
+		VectorStore: store,
+		handlers:    make(map[int]EventHandler),
+	}
+}
+
+// Subscribe registers a handler for all events and returns a function that
+// removes it again
+func (s *ObservableStore) Subscribe(handler EventHandler) func() {
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	s.handlers[id] = handler
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.handlers, id)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// OnInsert registers a handler for inserted vectors
+func (s *ObservableStore) OnInsert(fn func(v *vector.Vector)) func() {
+	return s.Subscribe(func(e Event) {
+		if e.Type == EventInsert {
+			fn(e.Vector)
+		}
+	})
+}
+
+// OnUpdate registers a handler for updated vectors
+func (s *ObservableStore) OnUpdate(fn func(v *vector.Vector)) func() {
+	return s.Subscribe(func(e Event) {
+		if e.Type == EventUpdate {
+			fn(e.Vector)
+		}
+	})
+}
+
+// OnDelete registers a handler for deleted vector IDs
+func (s *ObservableStore) OnDelete(fn func(id string)) func() {
+	return s.Subscribe(func(e Event) {
+		if e.Type == EventDelete {
+			fn(e.ID)
+		}
+	})
+}
+
+// Events returns a channel receiving all future events and a function that
+// cancels the subscription and closes the channel. Events are dropped rather
+// than blocking writers when the buffer is full; receivers can detect this
+// from gaps in Event.Seq.
+func (s *ObservableStore) Events(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	var mu sync.Mutex
+	closed := false
+	unsubscribe := s.Subscribe(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+
+	return ch, func() {
+		unsubscribe()
+		mu.Lock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+		mu.Unlock()
+	}
+}
+
+// Epoch implements Epocher with the sequence number of the last event
+func (s *ObservableStore) Epoch() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seq
+}
+
+// emit delivers an event to all current handlers
+func (s *ObservableStore) emit(eventType EventType, id string, v *vector.Vector) {
+	s.emitMu.Lock()
+	defer s.emitMu.Unlock()
+
+	s.mu.Lock()
+	s.seq++
+	event := Event{Seq: s.seq, Type: eventType, ID: id, Time: time.Now().UTC()}
+	handlers := make([]EventHandler, 0, len(s.handlers))
+	for _, h := range s.handlers {
+		handlers = append(handlers, h)
+	}
+	s.mu.Unlock()
+
+	for _, h := range handlers {
+		// Each handler gets its own copy, so it can change neither the
+		// caller's vector nor what the other handlers see
+		if v != nil {
+			event.Vector = v.Copy()
+		}
+		h(event)
+	}
+}
+
+func (s *ObservableStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *ObservableStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := WithContext(s.VectorStore).InsertCtx(ctx, v); err != nil {
+		return err
+	}
+	s.emit(EventInsert, v.ID, v)
+	return nil
+}
+
+func (s *ObservableStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *ObservableStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	if err := WithContext(s.VectorStore).UpdateCtx(ctx, v); err != nil {
+		return err
+	}
+	s.emit(EventUpdate, v.ID, v)
+	return nil
+}
+
+func (s *ObservableStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *ObservableStore) DeleteCtx(ctx context.Context, id string) error {
+	if err := WithContext(s.VectorStore).DeleteCtx(ctx, id); err != nil {
+		return err
+	}
+	s.emit(EventDelete, id, nil)
+	return nil
+}
+
+// GetCtx implements ContextStore
+func (s *ObservableStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// ListCtx implements ContextStore
+func (s *ObservableStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *ObservableStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
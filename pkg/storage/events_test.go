@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestObservableStoreHooks(t *testing.T) {
+	store := NewObservableStore(NewMemoryStore())
+
+	var inserted, updated, deleted []string
+	store.OnInsert(func(v *vector.Vector) { inserted = append(inserted, v.ID) })
+	store.OnUpdate(func(v *vector.Vector) { updated = append(updated, v.ID) })
+	unsubscribe := store.OnDelete(func(id string) { deleted = append(deleted, id) })
+
+	store.Insert(vector.NewVector("v1", []float32{1.0, 2.0}))
+	store.Update(vector.NewVector("v1", []float32{3.0, 4.0}))
+	store.Delete("v1")
+
+	// Failed writes must not emit events
+	store.Delete("v1")
+	store.Update(vector.NewVector("missing", []float32{1.0}))
+
+	if len(inserted) != 1 || len(updated) != 1 || len(deleted) != 1 {
+		t.Errorf("Expected one event of each type, got %v %v %v", inserted, updated, deleted)
+	}
+
+	unsubscribe()
+	store.Insert(vector.NewVector("v2", []float32{1.0, 2.0}))
+	store.Delete("v2")
+	if len(deleted) != 1 {
+		t.Errorf("Expected no events after unsubscribe, got %v", deleted)
+	}
+
+	// A handler changing its vector affects neither the caller nor other handlers
+	var seen float32
+	store.OnInsert(func(v *vector.Vector) { v.Values[0] = 9 })
+	store.OnInsert(func(v *vector.Vector) { seen = v.Values[0] })
+	v3 := vector.NewVector("v3", []float32{1.0, 2.0})
+	store.Insert(v3)
+	if seen != 1 || v3.Values[0] != 1 {
+		t.Errorf("Expected each handler to get its own copy, got %v and %v", seen, v3.Values[0])
+	}
+}
+
+func TestObservableStoreEvents(t *testing.T) {
+	store := NewObservableStore(NewMemoryStore())
+
+	events, cancel := store.Events(1)
+
+	store.Insert(vector.NewVector("v1", []float32{1.0}))
+	// The buffer is full, so this event is dropped instead of blocking
+	store.Insert(vector.NewVector("v2", []float32{1.0}))
+	store.Delete("v1")
+
+	first := <-events
+	if first.Type != EventInsert || first.ID != "v1" || first.Seq != 1 {
+		t.Errorf("Unexpected first event: %+v", first)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("Expected channel to be closed after cancel")
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// FinitePolicy says what a write of a vector with NaN or infinite values does
+type FinitePolicy string
+
+const (
+	// FiniteReject fails the write with vector.ErrNonFinite
+	FiniteReject FinitePolicy = "reject"
+
+	// FiniteZero stores the vector with its NaN and infinite values set to 0
+	FiniteZero FinitePolicy = "zero"
+
+	// FiniteAllow stores the vector unchanged
+	FiniteAllow FinitePolicy = "allow"
+)
+
+// ParseFinitePolicy returns the policy with the given name; an empty name
+// is FiniteReject
+func ParseFinitePolicy(name string) (FinitePolicy, error) {
+	switch policy := FinitePolicy(strings.ToLower(name)); policy {
+	case "":
+		return FiniteReject, nil
+	case FiniteReject, FiniteZero, FiniteAllow:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown non-finite policy %q: use reject, zero or allow", name)
+	}
+}
+
+// FiniteStore wraps a VectorStore and keeps NaN and infinite values out of
+// it, by rejecting the vectors that have them or by zeroing the values.
+// Vectors read back are not checked.
+type FiniteStore struct {
+	VectorStore
+	policy FinitePolicy
+}
+
+// NewFiniteStore creates a store that applies policy to the values written
+func NewFiniteStore(store VectorStore, policy FinitePolicy) *FiniteStore {
+	return &FiniteStore{VectorStore: store, policy: policy}
+}
+
+// sanitize returns v, or a copy of it with the values zeroed, or an error
+// if the policy rejects it
+func (s *FiniteStore) sanitize(v *vector.Vector) (*vector.Vector, error) {
+	if s.policy == FiniteAllow {
+		return v, nil
+	}
+	err := v.CheckFinite()
+	if err == nil {
+		return v, nil
+	}
+	if s.policy != FiniteZero {
+		return nil, err
+	}
+	// The caller's vector is left as it was
+	zeroed := v.Copy()
+	zeroed.ZeroNonFinite()
+	return zeroed, nil
+}
+
+// Insert adds v once its values are checked
+func (s *FiniteStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *FiniteStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	v, err := s.sanitize(v)
+	if err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).InsertCtx(ctx, v)
+}
+
+// Update replaces the stored vector once the values of v are checked
+func (s *FiniteStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *FiniteStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	v, err := s.sanitize(v)
+	if err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).UpdateCtx(ctx, v)
+}
+
+// GetCtx implements ContextStore
+func (s *FiniteStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// DeleteCtx implements ContextStore
+func (s *FiniteStore) DeleteCtx(ctx context.Context, id string) error {
+	return WithContext(s.VectorStore).DeleteCtx(ctx, id)
+}
+
+// ListCtx implements ContextStore
+func (s *FiniteStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *FiniteStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
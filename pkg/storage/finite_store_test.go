@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+func TestFiniteStore(t *testing.T) {
+	nan := float32(math.NaN())
+
+	rejecting := NewFiniteStore(NewMemoryStore(), FiniteReject)
+	err := rejecting.Insert(vector.NewVector("a", []float32{1, nan}))
+	if !errors.Is(err, vector.ErrNonFinite) || errs.CodeOf(err) != errs.InvalidArgument {
+		t.Errorf("Expected ErrNonFinite, got %v", err)
+	}
+	if count, _ := rejecting.Count(); count != 0 {
+		t.Errorf("Expected the vector not to be stored, got %d vectors", count)
+	}
+
+	zeroing := NewFiniteStore(NewMemoryStore(), FiniteZero)
+	v := vector.NewVector("a", []float32{1, nan})
+	if err := zeroing.Insert(v); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if v.CheckFinite() == nil {
+		t.Error("Expected the caller's vector to be left unchanged")
+	}
+	stored, err := zeroing.Get("a")
+	if err != nil || stored.Values[0] != 1 || stored.Values[1] != 0 {
+		t.Errorf("Expected [1 0], got %v (%v)", stored, err)
+	}
+	if err := zeroing.Update(vector.NewVector("a", []float32{float32(math.Inf(1)), 2})); err != nil {
+		t.Errorf("Update failed: %v", err)
+	}
+
+	for name, want := range map[string]FinitePolicy{"": FiniteReject, "Zero": FiniteZero, "allow": FiniteAllow} {
+		if policy, err := ParseFinitePolicy(name); err != nil || policy != want {
+			t.Errorf("ParseFinitePolicy(%q) = %q (%v), want %q", name, policy, err, want)
+		}
+	}
+	if _, err := ParseFinitePolicy("clamp"); err == nil {
+		t.Error("Expected an unknown policy to fail")
+	}
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// Quiescer is implemented by stores that can briefly hold back writes
+type Quiescer interface {
+	// Quiesce waits for in-flight writes and blocks new ones until the
+	// returned resume function is called
+	Quiesce() (resume func())
+}
+
+// Flusher is implemented by stores that buffer writes
+type Flusher interface {
+	// Flush persists all buffered writes
+	Flush() error
+}
+
+// GatedStore wraps a VectorStore with a gate that holds back writes while a
+// snapshot is taken, so the snapshot sees a store that does not change
+// under it. Reads are never blocked.
+type GatedStore struct {
+	VectorStore
+
+	gate sync.RWMutex
+}
+
+// NewGatedStore wraps a store with a write gate
+func NewGatedStore(store VectorStore) *GatedStore {
+	return &GatedStore{VectorStore: store}
+}
+
+// Quiesce implements Quiescer
+func (s *GatedStore) Quiesce() func() {
+	s.gate.Lock()
+	return s.gate.Unlock
+}
+
+func (s *GatedStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *GatedStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	s.gate.RLock()
+	defer s.gate.RUnlock()
+	return WithContext(s.VectorStore).InsertCtx(ctx, v)
+}
+
+func (s *GatedStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *GatedStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	s.gate.RLock()
+	defer s.gate.RUnlock()
+	return WithContext(s.VectorStore).UpdateCtx(ctx, v)
+}
+
+func (s *GatedStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *GatedStore) DeleteCtx(ctx context.Context, id string) error {
+	s.gate.RLock()
+	defer s.gate.RUnlock()
+	return WithContext(s.VectorStore).DeleteCtx(ctx, id)
+}
+
+// GetCtx implements ContextStore
+func (s *GatedStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// ListCtx implements ContextStore
+func (s *GatedStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *GatedStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// Unwrap returns the store wrapped by one of the wrappers of this package,
+// or nil for any other store
+func Unwrap(store VectorStore) VectorStore {
+	switch s := store.(type) {
+	case *GatedStore:
+		return s.VectorStore
+	case *ObservableStore:
+		return s.VectorStore
+	case *AdaptedStore:
+		return s.VectorStore
+	case *CachedStore:
+		return s.VectorStore
+	case *QuotaStore:
+		return s.VectorStore
+	case *SchemaStore:
+		return s.VectorStore
+	case *DimensionStore:
+		return s.VectorStore
+	case *FiniteStore:
+		return s.VectorStore
+	case *ReadOnlyStore:
+		return s.VectorStore
+	case *CentroidStore:
+		return s.VectorStore
+	case *AccessStore:
+		return s.VectorStore
+	default:
+		return nil
+	}
+}
+
+// FlushStore flushes the buffered writes of a store or of the first store
+// it wraps that buffers writes. Stores that write through need no flush.
+func FlushStore(store VectorStore) error {
+	for ; store != nil; store = Unwrap(store) {
+		if f, ok := store.(Flusher); ok {
+			return f.Flush()
+		}
+	}
+	return nil
+}
+
+// QuiesceStore holds back the writes of a store, or of the first store it
+// wraps that supports it, until resume is called. For stores without a gate
+// resume does nothing.
+func QuiesceStore(store VectorStore) (resume func()) {
+	for ; store != nil; store = Unwrap(store) {
+		if q, ok := store.(Quiescer); ok {
+			return q.Quiesce()
+		}
+	}
+	return func() {}
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// idIndex keeps IDs sorted so prefix and range lookups take a binary search
+// instead of a scan of every ID
+type idIndex struct {
+	ids []string
+}
+
+// search returns the position of the first ID not less than id
+func (x *idIndex) search(id string) int {
+	return sort.SearchStrings(x.ids, id)
+}
+
+// add inserts id unless it is already indexed
+func (x *idIndex) add(id string) {
+	i := x.search(id)
+	if i < len(x.ids) && x.ids[i] == id {
+		return
+	}
+	x.ids = append(x.ids, "")
+	copy(x.ids[i+1:], x.ids[i:])
+	x.ids[i] = id
+}
+
+// remove deletes id if it is indexed
+func (x *idIndex) remove(id string) {
+	i := x.search(id)
+	if i < len(x.ids) && x.ids[i] == id {
+		x.ids = append(x.ids[:i], x.ids[i+1:]...)
+	}
+}
+
+// prefix returns the IDs starting with prefix in order
+func (x *idIndex) prefix(prefix string) []string {
+	ids := []string{}
+	for i := x.search(prefix); i < len(x.ids) && strings.HasPrefix(x.ids[i], prefix); i++ {
+		ids = append(ids, x.ids[i])
+	}
+	return ids
+}
+
+// between returns the IDs from start up to but excluding end in order, at
+// most limit of them. An empty end and a limit of 0 mean no bound.
+func (x *idIndex) between(start, end string, limit int) []string {
+	ids := []string{}
+	for i := x.search(start); i < len(x.ids) && (end == "" || x.ids[i] < end); i++ {
+		if limit > 0 && len(ids) == limit {
+			break
+		}
+		ids = append(ids, x.ids[i])
+	}
+	return ids
+}
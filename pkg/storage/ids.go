@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// MaxIDLength is the longest vector ID in bytes
+const MaxIDLength = 1024
+
+// maxFileNameLength is the longest file name IDFileName returns before
+// falling back to a hash, leaving room for an extension within the 255
+// bytes file systems allow
+const maxFileNameLength = 200
+
+// ErrInvalidID is returned when a vector ID is empty, too long, not UTF-8 or
+// contains control characters
+var ErrInvalidID = errs.New(errs.InvalidArgument, "invalid vector ID")
+
+// windowsReservedNames cannot be used as file names on Windows, with or
+// without an extension
+var windowsReservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// ValidateID checks that id can be stored. Any UTF-8 text is allowed except
+// control characters, so IDs like "docs/guide.md" or "日本語" work with every
+// store.
+func ValidateID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("%w: empty", ErrInvalidID)
+	case len(id) > MaxIDLength:
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidID, MaxIDLength)
+	case !utf8.ValidString(id):
+		return fmt.Errorf("%w: %q is not UTF-8", ErrInvalidID, id)
+	case strings.IndexFunc(id, unicode.IsControl) >= 0:
+		return fmt.Errorf("%w: %q contains control characters", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// IDFileName returns a file name for id, without an extension, that is
+// valid on every platform and cannot leave its directory. IDs made of
+// lowercase letters, digits, '-', '_' and inner dots are used as they are,
+// other bytes are percent-encoded, so distinct IDs get distinct names even
+// on case-insensitive file systems. Names that would be too long are
+// replaced by a hash of the ID.
+func IDFileName(id string) string {
+	var sb strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' && i > 0 && i < len(id)-1 {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	name := sb.String()
+
+	if base, _, _ := strings.Cut(name, "."); windowsReservedNames[base] {
+		name = fmt.Sprintf("%%%02X", name[0]) + name[1:]
+	}
+	if name == "" || len(name) > maxFileNameLength {
+		sum := sha256.Sum256([]byte(id))
+		name = "~" + hex.EncodeToString(sum[:])
+	}
+	return name
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestValidateID(t *testing.T) {
+	for _, id := range []string{"v1", "docs/guide.md", "../up", "日本語", "a b", strings.Repeat("x", MaxIDLength)} {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("ValidateID(%q) = %v, want nil", id, err)
+		}
+	}
+	for _, id := range []string{"", "a\x00b", "line\nbreak", "\xff", strings.Repeat("x", MaxIDLength+1)} {
+		if err := ValidateID(id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("ValidateID(%q) = %v, want ErrInvalidID", id, err)
+		}
+	}
+}
+
+func TestIDFileName(t *testing.T) {
+	tests := map[string]string{
+		"v1":            "v1",
+		"doc.v2":        "doc.v2",
+		"Doc":           "%44oc",
+		"docs/guide.md": "docs%2Fguide.md",
+		"..":            "%2E%2E",
+		".hidden":       "%2Ehidden",
+		"trailing.":     "trailing%2E",
+		"con":           "%63on",
+		"nul.txt":       "%6Eul.txt",
+		"50%":           "50%25",
+		"é":             "%C3%A9",
+	}
+	for id, want := range tests {
+		if got := IDFileName(id); got != want {
+			t.Errorf("IDFileName(%q) = %q, want %q", id, got, want)
+		}
+	}
+
+	long := IDFileName(strings.Repeat("é", 100))
+	if !strings.HasPrefix(long, "~") || len(long) > maxFileNameLength {
+		t.Errorf("Expected a hashed name for a long ID, got %q", long)
+	}
+
+	// Names differ even where case does not count
+	seen := make(map[string]string)
+	for _, id := range []string{"a", "A", "%41", "%61", "a.", "a%2E", "~x"} {
+		name := strings.ToLower(IDFileName(id))
+		if other, ok := seen[name]; ok {
+			t.Errorf("IDs %q and %q share the file name %q", id, other, name)
+		}
+		seen[name] = id
+	}
+}
+
+func TestFileStoreUnsafeIDs(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "vectors")
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	ids := []string{"../escape", "docs/guide.md", "CON", "Doc", "doc", "日本語", strings.Repeat("long", 100)}
+	for _, id := range ids {
+		if err := store.Insert(vector.NewVector(id, []float32{1, 2})); err != nil {
+			t.Fatalf("Failed to insert %q: %v", id, err)
+		}
+	}
+	if err := store.Insert(vector.NewVector("bad\x00id", []float32{1})); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("Expected ErrInvalidID, got %v", err)
+	}
+
+	// Nothing is written outside the store's directory
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Errorf("Expected only the store directory in %s, got %v", root, entries)
+	}
+
+	// A legacy file named after its ID is updated and deleted in place
+	legacy := vector.NewVector("Legacy", []float32{3, 4})
+	if err := os.WriteFile(filepath.Join(dir, "Legacy.vec"), legacy.Encode(), 0644); err != nil {
+		t.Fatalf("Failed to write legacy file: %v", err)
+	}
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	for _, id := range append(ids, "Legacy") {
+		if _, err := reopened.Get(id); err != nil {
+			t.Errorf("Failed to get %q after reopening: %v", id, err)
+		}
+	}
+	legacy.Values = []float32{5, 6}
+	if err := reopened.Update(legacy); err != nil {
+		t.Fatalf("Failed to update legacy vector: %v", err)
+	}
+	if err := reopened.Delete("Legacy"); err != nil {
+		t.Fatalf("Failed to delete legacy vector: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Legacy.vec")); !os.IsNotExist(err) {
+		t.Errorf("Expected the legacy file to be deleted, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != len(ids) {
+		t.Errorf("Expected %d files, got %d", len(ids), len(entries))
+	}
+}
+
+func TestFileStoreSkipsTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	if err := store.Insert(vector.NewVector("v1", []float32{1, 2})); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+
+	// A write that died before its rename leaves a partial temporary file
+	if err := os.WriteFile(filepath.Join(dir, ".v2.vec.123.tmp"), []byte{1, 2}, 0644); err != nil {
+		t.Fatalf("Failed to write temporary file: %v", err)
+	}
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	ids, err := reopened.List()
+	if err != nil {
+		t.Fatalf("Failed to list vectors: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "v1" {
+		t.Errorf("Expected [v1], got %v", ids)
+	}
+}
+
+func TestFileStoreCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	data := vector.NewVector("v1", []float32{1, 2, 3}).Encode()
+	if err := os.WriteFile(filepath.Join(dir, "v1.vec"), data[:len(data)-6], 0644); err != nil {
+		t.Fatalf("Failed to write truncated file: %v", err)
+	}
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	if _, err := store.Get("v1"); !errors.Is(err, vector.ErrCorrupt) {
+		t.Errorf("Expected vector.ErrCorrupt, got %v", err)
+	}
+}
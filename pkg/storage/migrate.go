@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// maxMigrationPasses bounds how often Migrate rescans the source for
+// vectors written while the copy was running
+const maxMigrationPasses = 5
+
+// ErrMigrationIncomplete is returned when the source is still changing after
+// the last pass of a migration
+var ErrMigrationIncomplete = errs.New(errs.Aborted, "source kept changing during the migration")
+
+// MigrationStats summarizes the result of a Migrate call
+type MigrationStats struct {
+	Copied  int // Vectors inserted into the destination
+	Updated int // Vectors that already existed in the destination and were overwritten
+	Deleted int // Copied vectors removed from the destination after they were deleted from the source
+	Passes  int // Number of passes over the source
+}
+
+// Migrate copies every vector from src into dst. The source is only read, so
+// it can keep serving requests while the copy runs; follow-up passes copy
+// the vectors inserted or updated in the source during a pass, as their
+// UpdatedAt says, and delete from dst the copied vectors deleted from the
+// source. Migrate returns once a pass finds nothing left to do, or fails
+// with ErrMigrationIncomplete if the source is still changing after
+// maxMigrationPasses. The optional progress callback receives the number of
+// vectors processed and the total of the current pass.
+func Migrate(src, dst VectorStore, progress func(done, total int)) (*MigrationStats, error) {
+	stats := &MigrationStats{}
+	migrated := make(map[string]time.Time) // UpdatedAt of every vector copied
+
+	for {
+		ids, err := src.List()
+		if err != nil {
+			return stats, fmt.Errorf("failed to list source vectors: %w", err)
+		}
+
+		// Copy what previous passes have not seen or have copied since
+		listed := make(map[string]bool, len(ids))
+		todo := make([]string, 0, len(ids))
+		for _, id := range ids {
+			listed[id] = true
+			updated, ok := migrated[id]
+			if !ok {
+				todo = append(todo, id)
+				continue
+			}
+			v, err := GetMeta(src, id)
+			if errors.Is(err, ErrVectorNotFound) {
+				// Deleted since it was listed; the next pass removes it
+				continue
+			}
+			if err != nil {
+				return stats, fmt.Errorf("failed to read vector %s: %w", id, err)
+			}
+			if !v.UpdatedAt.Equal(updated) {
+				todo = append(todo, id)
+			}
+		}
+		var deleted []string
+		for id := range migrated {
+			if !listed[id] {
+				deleted = append(deleted, id)
+			}
+		}
+		if len(todo) == 0 && len(deleted) == 0 {
+			return stats, nil
+		}
+		if stats.Passes == maxMigrationPasses {
+			return stats, fmt.Errorf("%w: %d vectors left after %d passes", ErrMigrationIncomplete, len(todo)+len(deleted), stats.Passes)
+		}
+		stats.Passes++
+
+		for _, id := range deleted {
+			if err := dst.Delete(id); err != nil && !errors.Is(err, ErrVectorNotFound) {
+				return stats, fmt.Errorf("failed to delete vector %s: %w", id, err)
+			}
+			delete(migrated, id)
+			stats.Deleted++
+		}
+
+		for i, id := range todo {
+			v, err := src.Get(id)
+			if errors.Is(err, ErrVectorNotFound) {
+				// Deleted from the source after it was listed
+				continue
+			}
+			if err != nil {
+				return stats, fmt.Errorf("failed to read vector %s: %w", id, err)
+			}
+
+			err = dst.Insert(v)
+			if errors.Is(err, ErrVectorAlreadyExists) {
+				// Re-running a migration overwrites with the source copy
+				if err = dst.Update(v); err == nil {
+					stats.Updated++
+				}
+			} else if err == nil {
+				stats.Copied++
+			}
+			if err != nil {
+				return stats, fmt.Errorf("failed to write vector %s: %w", id, err)
+			}
+
+			migrated[id] = v.UpdatedAt
+			if progress != nil {
+				progress(i+1, len(todo))
+			}
+		}
+	}
+}
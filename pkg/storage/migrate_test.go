@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestMigrateOnline(t *testing.T) {
+	// Every write is stamped a second after the previous one
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	src, dst := NewMemoryStore(), NewMemoryStore()
+	src.Insert(vector.NewVector("a", []float32{1, 1}))
+	src.Insert(vector.NewVector("b", []float32{2, 2}))
+	src.Insert(vector.NewVector("c", []float32{3, 3}))
+
+	// The source keeps serving writes while the first pass runs: a is
+	// updated after it was copied, b deleted after it was copied, and c
+	// updated before it is copied
+	first := true
+	stats, err := Migrate(src, dst, func(done, total int) {
+		if !first {
+			return
+		}
+		switch done {
+		case 1:
+			src.Update(vector.NewVector("a", []float32{10, 10}))
+		case 2:
+			src.Delete("b")
+			src.Update(vector.NewVector("c", []float32{30, 30}))
+			first = false
+		}
+	})
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	if stats.Copied != 3 || stats.Updated != 1 || stats.Deleted != 1 || stats.Passes != 2 {
+		t.Errorf("Expected 3 copied, 1 updated and 1 deleted in 2 passes, got %+v", stats)
+	}
+
+	for id, want := range map[string]float32{"a": 10, "c": 30} {
+		v, err := dst.Get(id)
+		if err != nil || v.Values[0] != want {
+			t.Errorf("Expected %s to have the source values, got %+v (%v)", id, v, err)
+		}
+	}
+	if _, err := dst.Get("b"); !errors.Is(err, ErrVectorNotFound) {
+		t.Errorf("Expected b to be deleted from the destination, got %v", err)
+	}
+}
+
+func TestMigrateIncomplete(t *testing.T) {
+	src, dst := NewMemoryStore(), NewMemoryStore()
+	src.Insert(vector.NewVector("v0", []float32{1}))
+
+	// A source that never stops changing fails rather than migrating part of it
+	n := 0
+	stats, err := Migrate(src, dst, func(done, total int) {
+		n++
+		src.Insert(vector.NewVector(fmt.Sprintf("v%d", n), []float32{1}))
+	})
+	if !errors.Is(err, ErrMigrationIncomplete) {
+		t.Fatalf("Expected ErrMigrationIncomplete, got %v", err)
+	}
+	if stats.Passes != maxMigrationPasses {
+		t.Errorf("Expected %d passes, got %+v", maxMigrationPasses, stats)
+	}
+}
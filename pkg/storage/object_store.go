@@ -0,0 +1,422 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+const (
+	// manifestKey is the object that lists the live segments of an ObjectStore
+	manifestKey = "manifest.json"
+
+	// segmentPrefix is the key prefix under which segments are stored
+	segmentPrefix = "segments/"
+
+	// segmentMagic identifies a segment file
+	segmentMagic = "VSEG"
+
+	// segmentVersion is the current segment encoding version. Version 2
+	// appends a CRC32 of the segment; version 1 segments are still read.
+	segmentVersion = 2
+)
+
+const (
+	segmentOpPut    byte = 1
+	segmentOpDelete byte = 2
+)
+
+var (
+	// ErrCorruptSegment is returned when a segment cannot be decoded
+	ErrCorruptSegment = errs.New(errs.DataLoss, "corrupt segment")
+)
+
+// ObjectStoreOptions holds the configuration for an ObjectStore
+type ObjectStoreOptions struct {
+	CacheDir       string // Local directory used to cache immutable segments (empty disables caching)
+	FlushThreshold int    // Number of pending writes that triggers a segment upload (default: 256)
+}
+
+// DefaultObjectStoreOptions returns the default ObjectStore options
+func DefaultObjectStoreOptions() *ObjectStoreOptions {
+	return &ObjectStoreOptions{
+		FlushThreshold: 256,
+	}
+}
+
+// objectManifest lists the segments that make up the store, oldest first
+type objectManifest struct {
+	Version     int      `json:"version"`
+	Segments    []string `json:"segments"`
+	NextSegment int      `json:"next_segment"`
+}
+
+// segmentRecord is a single write recorded in a segment
+type segmentRecord struct {
+	op     byte
+	id     string
+	vector *vector.Vector
+}
+
+// ObjectStore is an implementation of VectorStore on top of object storage.
+// Writes are batched into immutable segment objects that are listed in a
+// manifest; opening the store replays the segments in order. Segments are
+// cached locally so restarts only download what is missing, and compacted
+// by Compact or StartCompaction so deleted and replaced vectors give their
+// space back. It implements ContextStore: the context of a write reaches the
+// bucket when the write uploads a segment.
+type ObjectStore struct {
+	bucket   Bucket
+	cache    *DirBucket
+	options  ObjectStoreOptions
+	memStore *MemoryStore
+	mu       sync.Mutex // Serializes writes, pending records and the manifest
+	manifest objectManifest
+	pending  []segmentRecord
+	segments map[string]segmentInfo // Sizes of the segments of the manifest
+
+	compactMu      sync.Mutex // Serializes compaction passes
+	compaction     CompactionStats
+	compactionStop chan struct{} // Closed to stop background compaction
+	compactionDone chan struct{} // Closed once background compaction stopped
+}
+
+// NewObjectStore opens a vector store persisted in the given bucket
+func NewObjectStore(bucket Bucket, options *ObjectStoreOptions) (*ObjectStore, error) {
+	opts := DefaultObjectStoreOptions()
+	if options != nil {
+		opts = options
+	}
+	if opts.FlushThreshold < 1 {
+		opts.FlushThreshold = 1
+	}
+
+	s := &ObjectStore{
+		bucket:   bucket,
+		options:  *opts,
+		memStore: NewMemoryStore(),
+		manifest: objectManifest{Version: segmentVersion},
+		segments: make(map[string]segmentInfo),
+	}
+
+	if opts.CacheDir != "" {
+		cache, err := NewDirBucket(opts.CacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create segment cache: %w", err)
+		}
+		s.cache = cache
+	}
+
+	if err := s.load(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// load reads the manifest and replays all segments into memory
+func (s *ObjectStore) load(ctx context.Context) error {
+	data, err := s.bucket.Get(ctx, manifestKey)
+	if errors.Is(err, ErrObjectNotFound) {
+		// Fresh store
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	for _, name := range s.manifest.Segments {
+		segment, err := s.readSegment(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		records, err := decodeSegment(segment)
+		if err != nil {
+			return fmt.Errorf("failed to decode segment %s: %w", name, err)
+		}
+		s.segments[name] = segmentInfo{size: len(segment), records: len(records)}
+
+		for _, rec := range records {
+			switch rec.op {
+			case segmentOpPut:
+				s.memStore.put(rec.vector)
+			case segmentOpDelete:
+				s.memStore.remove(rec.id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readSegment fetches a segment, preferring the local cache
+func (s *ObjectStore) readSegment(ctx context.Context, name string) ([]byte, error) {
+	if s.cache != nil {
+		if data, err := s.cache.Get(ctx, name); err == nil {
+			return data, nil
+		}
+	}
+
+	data, err := s.bucket.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download segment %s: %w", name, err)
+	}
+
+	if s.cache != nil {
+		// Caching is best effort; the bucket remains the source of truth
+		_ = s.cache.Put(ctx, name, data)
+	}
+
+	return data, nil
+}
+
+// record queues a write and uploads a segment once the threshold is reached
+func (s *ObjectStore) record(ctx context.Context, rec segmentRecord) error {
+	s.pending = append(s.pending, rec)
+	if len(s.pending) >= s.options.FlushThreshold {
+		return s.flushLocked(ctx)
+	}
+	return nil
+}
+
+// Flush uploads all pending writes as a new segment
+func (s *ObjectStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.flushLocked(context.Background())
+}
+
+// flushLocked uploads pending writes (caller must hold s.mu)
+func (s *ObjectStore) flushLocked(ctx context.Context) error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s%08d.seg", segmentPrefix, s.manifest.NextSegment)
+	data := encodeSegment(s.pending)
+
+	if err := s.bucket.Put(ctx, name, data); err != nil {
+		return fmt.Errorf("failed to upload segment %s: %w", name, err)
+	}
+	if s.cache != nil {
+		_ = s.cache.Put(ctx, name, data)
+	}
+
+	// Publish the segment by writing a new manifest. If this fails the
+	// uploaded segment is simply unreferenced and will be retried.
+	next := objectManifest{
+		Version:     segmentVersion,
+		Segments:    append(append([]string{}, s.manifest.Segments...), name),
+		NextSegment: s.manifest.NextSegment + 1,
+	}
+	manifestData, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := s.bucket.Put(ctx, manifestKey, manifestData); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	s.manifest = next
+	s.segments[name] = segmentInfo{size: len(data), records: len(s.pending)}
+	s.pending = nil
+	return nil
+}
+
+func (s *ObjectStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *ObjectStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.memStore.insert(v)
+	if err != nil {
+		return err
+	}
+
+	return s.record(ctx, segmentRecord{op: segmentOpPut, id: v.ID, vector: stored.Copy()})
+}
+
+func (s *ObjectStore) Get(id string) (*vector.Vector, error) {
+	return s.memStore.Get(id)
+}
+
+// GetCtx implements ContextStore. Vectors are read from memory.
+func (s *ObjectStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.memStore).GetCtx(ctx, id, opts)
+}
+
+// GetMeta implements MetaReader
+func (s *ObjectStore) GetMeta(id string) (*vector.Vector, error) {
+	return s.memStore.GetMeta(id)
+}
+
+func (s *ObjectStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *ObjectStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.memStore.update(v)
+	if err != nil {
+		return err
+	}
+
+	return s.record(ctx, segmentRecord{op: segmentOpPut, id: v.ID, vector: stored.Copy()})
+}
+
+func (s *ObjectStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *ObjectStore) DeleteCtx(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.memStore.Delete(id); err != nil {
+		return err
+	}
+
+	return s.record(ctx, segmentRecord{op: segmentOpDelete, id: id})
+}
+
+func (s *ObjectStore) List() ([]string, error) {
+	return s.memStore.List()
+}
+
+// ListCtx implements ContextStore
+func (s *ObjectStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.memStore).ListCtx(ctx, opts)
+}
+
+// ListPrefix implements PrefixLister
+func (s *ObjectStore) ListPrefix(prefix string) ([]string, error) {
+	return s.memStore.ListPrefix(prefix)
+}
+
+// ListRange implements RangeLister
+func (s *ObjectStore) ListRange(start, end string, limit int) ([]string, error) {
+	return s.memStore.ListRange(start, end, limit)
+}
+
+func (s *ObjectStore) Count() (int, error) {
+	return s.memStore.Count()
+}
+
+// CountCtx implements ContextStore
+func (s *ObjectStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.memStore).CountCtx(ctx)
+}
+
+// Close stops background compaction and flushes any pending writes to the
+// bucket
+func (s *ObjectStore) Close() error {
+	s.stopCompaction()
+	return s.Flush()
+}
+
+// encodeSegment serializes records into the segment format:
+// magic | version | record count | (op | payload length | payload)* | crc32
+func encodeSegment(records []segmentRecord) []byte {
+	buf := make([]byte, 0, 64*len(records)+12)
+	buf = append(buf, segmentMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, segmentVersion)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(records)))
+
+	for _, rec := range records {
+		var payload []byte
+		if rec.op == segmentOpPut {
+			payload = rec.vector.Encode()
+		} else {
+			payload = []byte(rec.id)
+		}
+
+		buf = append(buf, rec.op)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+		buf = append(buf, payload...)
+	}
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeSegment parses a segment produced by encodeSegment
+func decodeSegment(data []byte) ([]segmentRecord, error) {
+	if len(data) < 12 || string(data[:4]) != segmentMagic {
+		return nil, ErrCorruptSegment
+	}
+	switch version := binary.LittleEndian.Uint32(data[4:8]); version {
+	case 1:
+	case segmentVersion:
+		end := len(data) - 4
+		if end < 12 || crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+			return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptSegment)
+		}
+		data = data[:end]
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorruptSegment, version)
+	}
+
+	// The count is not trusted for the allocation: each record takes at
+	// least its op and payload length
+	count := binary.LittleEndian.Uint32(data[8:12])
+	records := make([]segmentRecord, 0, min(int(count), (len(data)-12)/5))
+	offset := 12
+
+	for i := uint32(0); i < count; i++ {
+		if offset+5 > len(data) {
+			return nil, ErrCorruptSegment
+		}
+		op := data[offset]
+		length := int(binary.LittleEndian.Uint32(data[offset+1 : offset+5]))
+		offset += 5
+		if offset+length > len(data) {
+			return nil, ErrCorruptSegment
+		}
+		payload := data[offset : offset+length]
+		offset += length
+
+		switch op {
+		case segmentOpPut:
+			v, err := vector.Decode(payload)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorruptSegment, err)
+			}
+			records = append(records, segmentRecord{op: op, id: v.ID, vector: v})
+		case segmentOpDelete:
+			records = append(records, segmentRecord{op: op, id: string(payload)})
+		default:
+			return nil, fmt.Errorf("%w: unknown op %d", ErrCorruptSegment, op)
+		}
+	}
+
+	return records, nil
+}
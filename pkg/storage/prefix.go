@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrInvalidPrefix is returned when a prefix operation is given an empty or
+// unchanged prefix
+var ErrInvalidPrefix = errs.New(errs.InvalidArgument, "invalid prefix")
+
+// PrefixLister is implemented by stores that can find the IDs starting with
+// a prefix without reading every vector
+type PrefixLister interface {
+	// ListPrefix returns the IDs that start with prefix in order
+	ListPrefix(prefix string) ([]string, error)
+}
+
+// RangeLister is implemented by stores that keep their IDs sorted, so a
+// range of them can be read without listing every ID
+type RangeLister interface {
+	// ListRange returns the IDs from start up to but excluding end in order,
+	// at most limit of them. An empty end and a limit of 0 mean no bound.
+	ListRange(start, end string, limit int) ([]string, error)
+}
+
+// ListPrefix returns the IDs that start with prefix in order through the
+// first store in the wrapper chain that implements PrefixLister. Other stores
+// fall back to filtering List.
+func ListPrefix(store VectorStore, prefix string) ([]string, error) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if l, ok := s.(PrefixLister); ok {
+			return l.ListPrefix(prefix)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	matched := []string{}
+	for _, id := range ids {
+		if strings.HasPrefix(id, prefix) {
+			matched = append(matched, id)
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// ListRange returns the IDs from start up to but excluding end in order, at
+// most limit of them, through the first store in the wrapper chain that
+// implements RangeLister. Other stores fall back to sorting List. An empty
+// end and a limit of 0 mean no bound.
+func ListRange(store VectorStore, start, end string, limit int) ([]string, error) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if l, ok := s.(RangeLister); ok {
+			return l.ListRange(start, end, limit)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	x := idIndex{ids: ids}
+	return x.between(start, end, limit), nil
+}
+
+// ListAfter returns a page of at most limit IDs in order, starting after the
+// ID after, which is the last ID of the previous page or "" for the first
+// page. Only IDs starting with prefix are listed.
+func ListAfter(store VectorStore, prefix, after string, limit int) ([]string, error) {
+	start, end := afterRange(prefix, after)
+	return ListRange(store, start, end, limit)
+}
+
+// afterRange returns the range of IDs that start with prefix and come after
+// the ID after, for ListRange
+func afterRange(prefix, after string) (string, string) {
+	start := prefix
+	if after >= start {
+		start = after + "\x00"
+	}
+	end, _ := prefixEnd(prefix)
+	return start, end
+}
+
+// RenamePrefix moves every vector whose ID starts with from to the ID with
+// to in its place, e.g. session42/a to archive/session42/a, and returns how
+// many were moved. It fails with ErrVectorAlreadyExists before changing
+// anything if a new ID is taken by a vector that is not moved itself.
+// Writes go through store, so wrappers see them as deletes and inserts.
+func RenamePrefix(store VectorStore, from, to string) (int, error) {
+	if from == "" || from == to {
+		return 0, fmt.Errorf("%w: cannot rename %q to %q", ErrInvalidPrefix, from, to)
+	}
+
+	ids, err := ListPrefix(store, from)
+	if err != nil {
+		return 0, err
+	}
+	moving := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		moving[id] = true
+	}
+
+	vectors := make([]*vector.Vector, 0, len(ids))
+	overlap := false // Whether some new IDs are old IDs of moved vectors
+	for _, id := range ids {
+		newID := to + strings.TrimPrefix(id, from)
+		if moving[newID] {
+			overlap = true
+		} else if _, err := store.Get(newID); err == nil {
+			return 0, fmt.Errorf("%w: %s", ErrVectorAlreadyExists, newID)
+		} else if !errors.Is(err, ErrVectorNotFound) {
+			return 0, err
+		}
+
+		v, err := store.Get(id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		v.ID = newID
+		vectors = append(vectors, v)
+	}
+
+	// Each vector is inserted under its new ID before the old one is
+	// deleted, so a failure leaves no vector missing. New IDs that are
+	// still taken by moved vectors have to be freed first.
+	if overlap {
+		for _, id := range ids {
+			if err := store.Delete(id); err != nil {
+				return 0, fmt.Errorf("failed to delete vector %s: %w", id, err)
+			}
+		}
+	}
+	for i, v := range vectors {
+		if err := store.Insert(v); err != nil {
+			return i, fmt.Errorf("failed to insert vector %s: %w", v.ID, err)
+		}
+		if !overlap {
+			if err := store.Delete(ids[i]); err != nil {
+				return i, fmt.Errorf("failed to delete vector %s: %w", ids[i], err)
+			}
+		}
+	}
+	return len(vectors), nil
+}
+
+// prefixEnd returns the smallest string greater than every string starting
+// with prefix, or false if there is none
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
+		}
+	}
+	return "", false
+}
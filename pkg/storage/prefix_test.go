@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestRenamePrefix(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]func() (VectorStore, error){
+		"memory": func() (VectorStore, error) { return NewMemoryStore(), nil },
+		"file":   func() (VectorStore, error) { return NewFileStore(filepath.Join(dir, "file")) },
+		"bolt":   func() (VectorStore, error) { return NewBoltStore(filepath.Join(dir, "vectors.bolt")) },
+		"sqlite": func() (VectorStore, error) { return NewSQLiteStore(filepath.Join(dir, "vectors.db")) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+
+			for _, id := range []string{"s1:a", "s1:b", "s10:a", "s2:a", "s"} {
+				if err := store.Insert(vector.NewVectorWithMetadata(id, []float32{1, 2}, map[string]string{"id": id})); err != nil {
+					t.Fatalf("Failed to insert vector %s: %v", id, err)
+				}
+			}
+
+			list := func(prefix string) string {
+				t.Helper()
+				ids, err := ListPrefix(NewGatedStore(store), prefix)
+				if err != nil {
+					t.Fatalf("Failed to list prefix %s: %v", prefix, err)
+				}
+				sort.Strings(ids)
+				return strings.Join(ids, ",")
+			}
+			if got := list("s1:"); got != "s1:a,s1:b" {
+				t.Errorf("Expected s1:a,s1:b, got %s", got)
+			}
+			if got := list("s1"); got != "s10:a,s1:a,s1:b" {
+				t.Errorf("Expected s10:a,s1:a,s1:b, got %s", got)
+			}
+			if got := list("x"); got != "" {
+				t.Errorf("Expected no IDs, got %s", got)
+			}
+
+			// A taken ID fails the rename before anything moves
+			if _, err := RenamePrefix(store, "s1:", "s2:"); !errors.Is(err, ErrVectorAlreadyExists) {
+				t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+			}
+			if got := list("s1:"); got != "s1:a,s1:b" {
+				t.Errorf("Expected the failed rename to keep s1:a,s1:b, got %s", got)
+			}
+			if _, err := RenamePrefix(store, "", "x"); !errors.Is(err, ErrInvalidPrefix) {
+				t.Errorf("Expected ErrInvalidPrefix, got %v", err)
+			}
+
+			n, err := RenamePrefix(store, "s1:", "archive:s1:")
+			if err != nil {
+				t.Fatalf("Failed to rename prefix: %v", err)
+			}
+			if n != 2 {
+				t.Errorf("Expected 2 renamed vectors, got %d", n)
+			}
+			if got := list("archive:"); got != "archive:s1:a,archive:s1:b" {
+				t.Errorf("Expected archive:s1:a,archive:s1:b, got %s", got)
+			}
+			if got := list("s1:"); got != "" {
+				t.Errorf("Expected no vectors left under s1:, got %s", got)
+			}
+			v, err := store.Get("archive:s1:b")
+			if err != nil {
+				t.Fatalf("Failed to get renamed vector: %v", err)
+			}
+			if v.Metadata["id"] != "s1:b" || v.Dimension != 2 {
+				t.Errorf("Expected the renamed vector to keep its data, got %+v", v)
+			}
+
+			// New IDs may be old IDs of vectors that move themselves
+			if _, err := RenamePrefix(store, "s", "s:"); err != nil {
+				t.Fatalf("Failed to rename overlapping prefix: %v", err)
+			}
+			if got := list("s"); got != "s:,s:10:a,s:2:a" {
+				t.Errorf("Expected s:,s:10:a,s:2:a, got %s", got)
+			}
+		})
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"abc", "abd", true},
+		{"ab\xff", "ac", true},
+		{"\xff\xff", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := prefixEnd(tt.prefix)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("prefixEnd(%q) = %q, %v; want %q, %v", tt.prefix, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestListRange(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]func() (VectorStore, error){
+		"memory": func() (VectorStore, error) { return NewMemoryStore(), nil },
+		"file":   func() (VectorStore, error) { return NewFileStore(filepath.Join(dir, "file")) },
+		"bolt":   func() (VectorStore, error) { return NewBoltStore(filepath.Join(dir, "vectors.bolt")) },
+		"sqlite": func() (VectorStore, error) { return NewSQLiteStore(filepath.Join(dir, "vectors.db")) },
+		// Stores without an ID index fall back to sorting List
+		"unindexed": func() (VectorStore, error) { return struct{ VectorStore }{NewMemoryStore()}, nil },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+
+			for _, id := range []string{"c", "a:2", "b", "a:1", "a:3", "d"} {
+				if err := store.Insert(vector.NewVector(id, []float32{1})); err != nil {
+					t.Fatalf("Failed to insert vector %s: %v", id, err)
+				}
+			}
+			if err := store.Delete("d"); err != nil {
+				t.Fatalf("Failed to delete vector: %v", err)
+			}
+
+			if ids, _ := store.List(); strings.Join(ids, ",") != "a:1,a:2,a:3,b,c" {
+				t.Errorf("Expected List in ID order, got %v", ids)
+			}
+
+			ids, err := ListRange(store, "a:2", "c", 0)
+			if err != nil {
+				t.Fatalf("Failed to list range: %v", err)
+			}
+			if got := strings.Join(ids, ","); got != "a:2,a:3,b" {
+				t.Errorf("Expected a:2,a:3,b, got %s", got)
+			}
+			if ids, _ = ListPrefix(store, "a:"); strings.Join(ids, ",") != "a:1,a:2,a:3" {
+				t.Errorf("Expected a:1,a:2,a:3 in order, got %v", ids)
+			}
+
+			// Pages continue after the last ID of the previous page
+			var pages []string
+			after := ""
+			for {
+				page, err := ListAfter(store, "", after, 2)
+				if err != nil {
+					t.Fatalf("Failed to list page: %v", err)
+				}
+				if len(page) == 0 {
+					break
+				}
+				pages = append(pages, strings.Join(page, ","))
+				after = page[len(page)-1]
+			}
+			if got := strings.Join(pages, "|"); got != "a:1,a:2|a:3,b|c" {
+				t.Errorf("Expected pages a:1,a:2|a:3,b|c, got %s", got)
+			}
+
+			page, err := ListAfter(store, "a:", "a:1", 0)
+			if err != nil {
+				t.Fatalf("Failed to list page: %v", err)
+			}
+			if got := strings.Join(page, ","); got != "a:2,a:3" {
+				t.Errorf("Expected a:2,a:3, got %s", got)
+			}
+		})
+	}
+}
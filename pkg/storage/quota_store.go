@@ -0,0 +1,528 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrQuotaExceeded is returned when a write would take a store over its quota
+var ErrQuotaExceeded = errs.New(errs.ResourceExhausted, "quota exceeded")
+
+// quotaMeasureInterval is how long a measurement of the bytes a store uses
+// is trusted before it is measured again
+const quotaMeasureInterval = time.Second
+
+// EvictionPolicy says what a write that would exceed a quota does
+type EvictionPolicy string
+
+const (
+	// EvictReject fails the write with ErrQuotaExceeded
+	EvictReject EvictionPolicy = "reject"
+
+	// EvictOldest deletes the vectors inserted longest ago until the write fits
+	EvictOldest EvictionPolicy = "evict_oldest"
+
+	// EvictLeastSearched deletes the vectors that searches returned least
+	// recently, or never, until the write fits
+	EvictLeastSearched EvictionPolicy = "evict_least_searched"
+)
+
+// ParseEvictionPolicy returns the policy with the given name; an empty name
+// is EvictReject
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(strings.ToLower(name)); policy {
+	case "":
+		return EvictReject, nil
+	case EvictReject, EvictOldest, EvictLeastSearched:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q: use reject, evict_oldest or evict_least_searched", name)
+	}
+}
+
+// Quota limits the size of a store. Zero fields are unlimited.
+type Quota struct {
+	MaxVectors int            // Vectors the store may hold
+	MaxBytes   int64          // Bytes the vectors may use, measured or by encoded size
+	Policy     EvictionPolicy // What a write over the quota does (default: EvictReject)
+}
+
+// SearchRecorder is implemented by stores that track which vectors
+// searches return
+type SearchRecorder interface {
+	// RecordSearch notes that a search returned the vectors with these IDs
+	RecordSearch(ids []string)
+}
+
+// RecordSearch passes the IDs a search returned to every store in the
+// wrapper chain that records searches
+func RecordSearch(store VectorStore, ids []string) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if r, ok := s.(SearchRecorder); ok {
+			r.RecordSearch(ids)
+		}
+	}
+}
+
+// QuotaStore wraps a VectorStore and keeps it, or the namespaces of IDs
+// with a given prefix, within quotas. Writes over a quota are rejected or
+// make room by evicting other vectors of the quota's namespace.
+//
+// The store-wide quota measures bytes with a callback, at most once a
+// second, counting writes in between by their encoded size. Without a
+// callback, and for namespaces, bytes are the encoded size of the vectors.
+// Vectors stored before the QuotaStore saw them count as older, and less
+// recently searched, than any it inserted.
+type QuotaStore struct {
+	VectorStore
+
+	mu     sync.Mutex // Serializes writes, so concurrent ones cannot overshoot
+	scopes []*quotaScope
+	clock  uint64
+}
+
+// quotaScope tracks the vectors of the namespace a quota applies to
+type quotaScope struct {
+	prefix string
+	quota  Quota
+	usage  func() (int64, error)
+
+	loaded   bool
+	stamps   map[string]uint64 // Insert time or, with EvictLeastSearched, last search
+	queue    stampQueue        // Eviction candidates, with stale stamps skipped
+	sizes    map[string]int64  // Encoded sizes, when bytes are not measured
+	bytes    int64
+	measured time.Time
+}
+
+// NewQuotaStore wraps a store with a store-wide quota. usage reports the
+// bytes the store uses; if it is nil, bytes are counted by the encoded size
+// of the vectors.
+func NewQuotaStore(store VectorStore, quota Quota, usage func() (int64, error)) *QuotaStore {
+	s := &QuotaStore{VectorStore: store}
+	if quota.MaxVectors > 0 || quota.MaxBytes > 0 {
+		s.scopes = append(s.scopes, &quotaScope{quota: quota, usage: usage})
+	}
+	return s
+}
+
+// AddQuota limits the vectors whose IDs start with prefix; an empty prefix
+// limits the whole store. Quotas are added before the store is written.
+func (s *QuotaStore) AddQuota(prefix string, quota Quota) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scopes = append(s.scopes, &quotaScope{prefix: prefix, quota: quota})
+}
+
+// Quota returns the store-wide quota of the store
+func (s *QuotaStore) Quota() Quota {
+	for _, scope := range s.scopes {
+		if scope.prefix == "" {
+			return scope.quota
+		}
+	}
+	return Quota{}
+}
+
+// tick returns the next stamp
+func (s *QuotaStore) tick() uint64 {
+	s.clock++
+	return s.clock
+}
+
+// load reads the IDs, and if needed the sizes, of the vectors the scopes
+// apply to the first time they are needed
+func (s *QuotaStore) load() error {
+	for _, scope := range s.scopes {
+		if scope.loaded {
+			continue
+		}
+		ids, err := ListPrefix(s.VectorStore, scope.prefix)
+		if err != nil {
+			return fmt.Errorf("failed to load quota of %q: %w", scope.prefix, err)
+		}
+		scope.stamps = make(map[string]uint64, len(ids))
+		if scope.countsSizes() {
+			scope.sizes = make(map[string]int64, len(ids))
+		}
+		for _, id := range ids {
+			if scope.sizes != nil {
+				v, err := s.VectorStore.Get(id)
+				if err != nil {
+					return fmt.Errorf("failed to load quota of %q: %w", scope.prefix, err)
+				}
+				scope.sizes[id] = int64(len(v.Encode()))
+				scope.bytes += scope.sizes[id]
+			}
+			scope.stamp(id, s.tick())
+		}
+		scope.loaded = true
+	}
+	return nil
+}
+
+// countsSizes reports whether the scope counts bytes by vector size
+func (q *quotaScope) countsSizes() bool {
+	return q.quota.MaxBytes > 0 && q.usage == nil
+}
+
+// evicts reports whether the scope makes room by evicting vectors
+func (q *quotaScope) evicts() bool {
+	return q.quota.Policy == EvictOldest || q.quota.Policy == EvictLeastSearched
+}
+
+// stamp records the insert or search time of a vector
+func (q *quotaScope) stamp(id string, stamp uint64) {
+	q.stamps[id] = stamp
+	if !q.evicts() {
+		return
+	}
+	heap.Push(&q.queue, stampEntry{id: id, stamp: stamp})
+
+	// Stale entries are dropped once they outnumber the live ones
+	if len(q.queue) > 2*len(q.stamps)+64 {
+		q.queue = q.queue[:0]
+		for id, stamp := range q.stamps {
+			q.queue = append(q.queue, stampEntry{id: id, stamp: stamp})
+		}
+		heap.Init(&q.queue)
+	}
+}
+
+// usedBytes returns the bytes in use, measuring them again if the last
+// measurement is stale
+func (q *quotaScope) usedBytes() (int64, error) {
+	if q.usage == nil || time.Since(q.measured) < quotaMeasureInterval {
+		return q.bytes, nil
+	}
+	bytes, err := q.usage()
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure store size: %w", err)
+	}
+	q.bytes, q.measured = bytes, time.Now()
+	return bytes, nil
+}
+
+// exceeded returns ErrQuotaExceeded if adding a vector (if add is set) and
+// growing by grow bytes would take the scope over its quota
+func (q *quotaScope) exceeded(add bool, grow int64) error {
+	if add && q.quota.MaxVectors > 0 && len(q.stamps) >= q.quota.MaxVectors {
+		return fmt.Errorf("%w: %d of %d vectors stored%s", ErrQuotaExceeded, len(q.stamps), q.quota.MaxVectors, q.describe())
+	}
+	if q.quota.MaxBytes <= 0 || grow <= 0 {
+		return nil
+	}
+	used, err := q.usedBytes()
+	if err != nil {
+		return err
+	}
+	if used+grow > q.quota.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes used%s", ErrQuotaExceeded, used, q.quota.MaxBytes, q.describe())
+	}
+	return nil
+}
+
+// describe names the namespace of a scope for errors
+func (q *quotaScope) describe() string {
+	if q.prefix == "" {
+		return ""
+	}
+	return fmt.Sprintf(" under %q", q.prefix)
+}
+
+// victim returns the vector to evict next, never keep, or "" if there is none
+func (q *quotaScope) victim(keep string) string {
+	var skipped []stampEntry
+	defer func() {
+		for _, entry := range skipped {
+			heap.Push(&q.queue, entry)
+		}
+	}()
+	for len(q.queue) > 0 {
+		entry := heap.Pop(&q.queue).(stampEntry)
+		if q.stamps[entry.id] != entry.stamp {
+			continue
+		}
+		if entry.id == keep {
+			skipped = append(skipped, entry)
+			continue
+		}
+		return entry.id
+	}
+	return ""
+}
+
+// matching returns the scopes whose namespace contains id
+func (s *QuotaStore) matching(id string) []*quotaScope {
+	var scopes []*quotaScope
+	for _, scope := range s.scopes {
+		if strings.HasPrefix(id, scope.prefix) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// makeRoom checks that adding the vector id (if add is set) and growing by
+// grow bytes fits the quotas of its namespaces, evicting other vectors where
+// the policy allows it. Rejecting quotas are checked before anything is
+// evicted.
+func (s *QuotaStore) makeRoom(id string, add bool, grow int64) error {
+	scopes := s.matching(id)
+	for _, scope := range scopes {
+		if !scope.evicts() {
+			if err := scope.exceeded(add, grow); err != nil {
+				return err
+			}
+		}
+	}
+	for _, scope := range scopes {
+		if !scope.evicts() {
+			continue
+		}
+		for {
+			err := scope.exceeded(add, grow)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrQuotaExceeded) {
+				return err
+			}
+			victim := scope.victim(id)
+			if victim == "" {
+				return err
+			}
+			if err := s.evict(victim); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// evict deletes a vector to make room for another
+func (s *QuotaStore) evict(id string) error {
+	v, err := s.VectorStore.Get(id)
+	if err != nil {
+		return fmt.Errorf("failed to evict %s: %w", id, err)
+	}
+	if err := s.VectorStore.Delete(id); err != nil {
+		return fmt.Errorf("failed to evict %s: %w", id, err)
+	}
+	s.forget(id, int64(len(v.Encode())))
+	return nil
+}
+
+// forget removes a deleted vector of the given size from its scopes
+func (s *QuotaStore) forget(id string, size int64) {
+	for _, scope := range s.matching(id) {
+		if _, ok := scope.stamps[id]; !ok {
+			continue
+		}
+		delete(scope.stamps, id)
+		freed := size
+		if scope.sizes != nil {
+			freed = scope.sizes[id]
+			delete(scope.sizes, id)
+		}
+		if scope.quota.MaxBytes > 0 {
+			scope.bytes -= freed
+		}
+	}
+}
+
+func (s *QuotaStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *QuotaStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	scopes := s.matching(v.ID)
+	for _, scope := range scopes {
+		if _, ok := scope.stamps[v.ID]; ok {
+			return ErrVectorAlreadyExists
+		}
+	}
+	size := int64(len(v.Encode()))
+	if err := s.makeRoom(v.ID, true, size); err != nil {
+		return err
+	}
+
+	if err := WithContext(s.VectorStore).InsertCtx(ctx, v); err != nil {
+		return err
+	}
+	stamp := s.tick()
+	for _, scope := range scopes {
+		scope.stamp(v.ID, stamp)
+		if scope.sizes != nil {
+			scope.sizes[v.ID] = size
+		}
+		if scope.quota.MaxBytes > 0 {
+			scope.bytes += size
+		}
+	}
+	return nil
+}
+
+func (s *QuotaStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *QuotaStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	// Only updates that grow a vector count against byte quotas
+	var grow int64
+	size := int64(len(v.Encode()))
+	scopes := s.matching(v.ID)
+	for _, scope := range scopes {
+		if scope.quota.MaxBytes > 0 {
+			old, err := WithContext(s.VectorStore).GetCtx(ctx, v.ID, GetOptions{})
+			if err != nil {
+				return err
+			}
+			grow = size - int64(len(old.Encode()))
+			break
+		}
+	}
+	if err := s.makeRoom(v.ID, false, grow); err != nil {
+		return err
+	}
+
+	if err := WithContext(s.VectorStore).UpdateCtx(ctx, v); err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if scope.sizes != nil {
+			scope.sizes[v.ID] = size
+		}
+		if scope.quota.MaxBytes > 0 {
+			scope.bytes += grow
+		}
+	}
+	return nil
+}
+
+func (s *QuotaStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *QuotaStore) DeleteCtx(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The size is only needed to account for store-wide measured bytes
+	var size int64
+	for _, scope := range s.matching(id) {
+		if scope.loaded && scope.usage != nil && scope.quota.MaxBytes > 0 {
+			if v, err := WithContext(s.VectorStore).GetCtx(ctx, id, GetOptions{}); err == nil {
+				size = int64(len(v.Encode()))
+			}
+			break
+		}
+	}
+	if err := WithContext(s.VectorStore).DeleteCtx(ctx, id); err != nil {
+		return err
+	}
+	s.forget(id, size)
+	return nil
+}
+
+// GetCtx implements ContextStore
+func (s *QuotaStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// ListCtx implements ContextStore
+func (s *QuotaStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *QuotaStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// RecordSearch makes the vectors a search returned the most recently
+// searched of their namespaces
+func (s *QuotaStore) RecordSearch(ids []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.load() != nil {
+		return
+	}
+	stamp := s.tick()
+	for _, id := range ids {
+		for _, scope := range s.matching(id) {
+			if _, ok := scope.stamps[id]; ok && scope.quota.Policy == EvictLeastSearched {
+				scope.stamp(id, stamp)
+			}
+		}
+	}
+}
+
+// stampEntry is an eviction candidate
+type stampEntry struct {
+	id    string
+	stamp uint64
+}
+
+// stampQueue is a min-heap of eviction candidates by stamp
+type stampQueue []stampEntry
+
+func (q stampQueue) Len() int            { return len(q) }
+func (q stampQueue) Less(i, j int) bool  { return q[i].stamp < q[j].stamp }
+func (q stampQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *stampQueue) Push(x interface{}) { *q = append(*q, x.(stampEntry)) }
+func (q *stampQueue) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// DirSize returns the bytes used by the files below dir. A missing
+// directory uses none.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestQuotaStore(t *testing.T) {
+	store := NewQuotaStore(NewMemoryStore(), Quota{MaxVectors: 2}, nil)
+	for _, id := range []string{"a", "b"} {
+		if err := store.Insert(vector.NewVector(id, []float32{1, 2})); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	if err := store.Insert(vector.NewVector("c", []float32{1, 2})); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// Updates and deletes are allowed, and deletes make room again
+	if err := store.Update(vector.NewVector("a", []float32{3, 4})); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	if err := store.Delete("b"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := store.Insert(vector.NewVector("c", []float32{1, 2})); err != nil {
+		t.Fatalf("Failed to insert vector after delete: %v", err)
+	}
+}
+
+func TestQuotaStoreBytes(t *testing.T) {
+	size := int64(len(vector.NewVector("a", []float32{1, 2}).Encode()))
+	measured := 0
+	store := NewQuotaStore(NewMemoryStore(), Quota{MaxBytes: 2 * size}, func() (int64, error) {
+		measured++
+		return 0, nil
+	})
+
+	// Writes between measurements are counted by their encoded size
+	for _, id := range []string{"a", "b"} {
+		if err := store.Insert(vector.NewVector(id, []float32{1, 2})); err != nil {
+			t.Fatalf("Failed to insert vector: %v", err)
+		}
+	}
+	if err := store.Insert(vector.NewVector("c", []float32{1, 2})); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected ErrQuotaExceeded, got %v", err)
+	}
+	if err := store.Update(vector.NewVector("a", []float32{1, 2, 3})); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Expected growing update to exceed the quota, got %v", err)
+	}
+	if measured != 1 {
+		t.Errorf("Expected 1 measurement, got %d", measured)
+	}
+
+	if _, ok := Unwrap(store).(*MemoryStore); !ok {
+		t.Errorf("Expected Unwrap to reach the memory store")
+	}
+}
+
+func TestQuotaStoreEviction(t *testing.T) {
+	insert := func(store *QuotaStore, ids ...string) {
+		t.Helper()
+		for _, id := range ids {
+			if err := store.Insert(vector.NewVector(id, []float32{1, 2})); err != nil {
+				t.Fatalf("Failed to insert %s: %v", id, err)
+			}
+		}
+	}
+	stored := func(store *QuotaStore) []string {
+		ids, _ := store.List()
+		sort.Strings(ids)
+		return ids
+	}
+
+	// Vectors stored before the quota store count as the oldest
+	inner := NewMemoryStore()
+	inner.Insert(vector.NewVector("z", []float32{1, 2}))
+	oldest := NewQuotaStore(inner, Quota{MaxVectors: 2, Policy: EvictOldest}, nil)
+	insert(oldest, "a", "b", "c")
+	if got := stored(oldest); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("Expected the oldest vectors to be evicted, got %v", got)
+	}
+
+	searched := NewQuotaStore(NewMemoryStore(), Quota{MaxVectors: 2, Policy: EvictLeastSearched}, nil)
+	insert(searched, "a", "b")
+	RecordSearch(NewGatedStore(searched), []string{"a"})
+	insert(searched, "c")
+	if got := stored(searched); !reflect.DeepEqual(got, []string{"a", "c"}) {
+		t.Errorf("Expected the least searched vector to be evicted, got %v", got)
+	}
+
+	// Namespaces are limited on their own, and rejecting quotas evict nothing
+	size := int64(len(vector.NewVector("tmp:1", []float32{1, 2}).Encode()))
+	namespaced := NewQuotaStore(NewMemoryStore(), Quota{}, nil)
+	namespaced.AddQuota("tmp:", Quota{MaxBytes: 2 * size, Policy: EvictOldest})
+	namespaced.AddQuota("", Quota{MaxVectors: 4})
+	insert(namespaced, "keep", "tmp:1", "tmp:2", "tmp:3")
+	if got := stored(namespaced); !reflect.DeepEqual(got, []string{"keep", "tmp:2", "tmp:3"}) {
+		t.Errorf("Expected only the namespace to be evicted from, got %v", got)
+	}
+	insert(namespaced, "other")
+	if err := namespaced.Insert(vector.NewVector("tmp:4", []float32{1, 2})); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the store-wide quota to reject the write, got %v", err)
+	}
+	if got := stored(namespaced); len(got) != 4 {
+		t.Errorf("Expected a rejected write to evict nothing, got %v", got)
+	}
+}
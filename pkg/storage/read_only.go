@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrReadOnly is returned for writes to a read-only store
+var ErrReadOnly = errs.New(errs.PermissionDenied, "store is read-only")
+
+// ReadOnlyStore wraps a VectorStore and rejects every write with
+// ErrReadOnly, e.g. for a replica serving data that another process owns
+type ReadOnlyStore struct {
+	VectorStore
+}
+
+// NewReadOnlyStore wraps a store so that it rejects writes
+func NewReadOnlyStore(store VectorStore) *ReadOnlyStore {
+	return &ReadOnlyStore{VectorStore: store}
+}
+
+func (s *ReadOnlyStore) Insert(v *vector.Vector) error {
+	return fmt.Errorf("%w: cannot insert %s", ErrReadOnly, v.ID)
+}
+
+func (s *ReadOnlyStore) Update(v *vector.Vector) error {
+	return fmt.Errorf("%w: cannot update %s", ErrReadOnly, v.ID)
+}
+
+func (s *ReadOnlyStore) Delete(id string) error {
+	return fmt.Errorf("%w: cannot delete %s", ErrReadOnly, id)
+}
+
+// InsertCtx implements ContextStore
+func (s *ReadOnlyStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	return s.Insert(v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *ReadOnlyStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	return s.Update(v)
+}
+
+// DeleteCtx implements ContextStore
+func (s *ReadOnlyStore) DeleteCtx(ctx context.Context, id string) error {
+	return s.Delete(id)
+}
+
+// GetCtx implements ContextStore
+func (s *ReadOnlyStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// ListCtx implements ContextStore
+func (s *ReadOnlyStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *ReadOnlyStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// NewReadOnlyFileStore opens the file store in baseDir for reading only.
+// Nothing is written to the directory, not even to create it, so several
+// processes can serve the same directory, e.g. on a shared volume. The
+// vectors are read once, on first use.
+func NewReadOnlyFileStore(baseDir string) (*FileStore, error) {
+	info, err := os.Stat(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read-only store: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("failed to open read-only store: %s is not a directory", baseDir)
+	}
+	s, err := newFileStore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	s.readOnly = true
+	return s, nil
+}
+
+// IsReadOnly reports whether store, or a store it wraps, rejects writes
+func IsReadOnly(store VectorStore) bool {
+	for ; store != nil; store = Unwrap(store) {
+		switch s := store.(type) {
+		case *ReadOnlyStore:
+			return true
+		case *FileStore:
+			return s.readOnly
+		}
+	}
+	return false
+}
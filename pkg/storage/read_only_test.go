@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+func TestReadOnlyFileStore(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Insert(vector.NewVector("a", []float32{1, 2}))
+
+	// Two replicas serve the same directory
+	for i := 0; i < 2; i++ {
+		replica, err := NewReadOnlyFileStore(dir)
+		if err != nil {
+			t.Fatalf("NewReadOnlyFileStore failed: %v", err)
+		}
+		if v, err := replica.Get("a"); err != nil || v.Values[1] != 2 {
+			t.Errorf("Expected a, got %v (%v)", v, err)
+		}
+		for _, err := range []error{
+			replica.Insert(vector.NewVector("b", []float32{1, 2})),
+			replica.Update(vector.NewVector("a", []float32{3, 4})),
+			replica.Delete("a"),
+		} {
+			if !errors.Is(err, ErrReadOnly) || errs.CodeOf(err) != errs.PermissionDenied {
+				t.Errorf("Expected ErrReadOnly, got %v", err)
+			}
+		}
+		if !IsReadOnly(NewCachedStore(replica, 10)) {
+			t.Error("Expected IsReadOnly to see through wrappers")
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected the replicas to write nothing, got %d files", len(entries))
+	}
+
+	if _, err := NewReadOnlyFileStore(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing directory to fail, not to be created")
+	}
+	if IsReadOnly(writer) || !IsReadOnly(NewReadOnlyStore(writer)) {
+		t.Error("Expected only the wrapped store to be read-only")
+	}
+}
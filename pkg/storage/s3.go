@@ -0,0 +1,323 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config holds the connection settings for an S3-compatible bucket.
+// Google Cloud Storage works through its S3-compatible XML API by using
+// https://storage.googleapis.com as the endpoint together with HMAC keys.
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.amazonaws.com or http://localhost:9000
+	Region          string // Signing region (default: us-east-1)
+	Bucket          string // Bucket name
+	Prefix          string // Optional key prefix inside the bucket
+	AccessKeyID     string // Falls back to AWS_ACCESS_KEY_ID
+	SecretAccessKey string // Falls back to AWS_SECRET_ACCESS_KEY
+	SessionToken    string // Falls back to AWS_SESSION_TOKEN
+	PathStyle       bool   // Use endpoint/bucket/key instead of bucket.endpoint/key
+}
+
+// S3Bucket is a Bucket backed by an S3-compatible object store.
+// Requests are signed with AWS Signature Version 4.
+type S3Bucket struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3Bucket creates a new S3-compatible bucket client
+func NewS3Bucket(config S3Config) (*S3Bucket, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket name is required")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3.amazonaws.com"
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.AccessKeyID == "" {
+		config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if config.SecretAccessKey == "" {
+		config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if config.SessionToken == "" {
+		config.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/")
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %s", config.Endpoint)
+	}
+
+	return &S3Bucket{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 60 * time.Second},
+		now:      time.Now,
+	}, nil
+}
+
+// objectKey applies the configured prefix to a key
+func (b *S3Bucket) objectKey(key string) string {
+	if b.config.Prefix == "" {
+		return key
+	}
+	return b.config.Prefix + "/" + key
+}
+
+// objectURL builds the request URL for a key (empty key addresses the bucket)
+func (b *S3Bucket) objectURL(key string, query url.Values) *url.URL {
+	u := *b.endpoint
+	if b.config.PathStyle {
+		u.Path = "/" + b.config.Bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = b.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = uriEncodePath(u.Path)
+	u.RawQuery = encodeQuery(query)
+	return &u
+}
+
+// do signs and sends a request, returning the response body for 2xx
+// responses. The request is canceled when ctx is done.
+func (b *S3Bucket) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	u := b.objectURL(key, query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	b.sign(req, body, b.now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read s3 response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrObjectNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+func (b *S3Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	return b.do(ctx, http.MethodGet, b.objectKey(key), nil, nil)
+}
+
+func (b *S3Bucket) Put(ctx context.Context, key string, data []byte) error {
+	_, err := b.do(ctx, http.MethodPut, b.objectKey(key), nil, data)
+	return err
+}
+
+func (b *S3Bucket) Delete(ctx context.Context, key string) error {
+	_, err := b.do(ctx, http.MethodDelete, b.objectKey(key), nil, nil)
+	return err
+}
+
+// listBucketResult is the subset of the ListObjectsV2 response we need
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (b *S3Bucket) List(ctx context.Context, prefix string) ([]string, error) {
+	fullPrefix := b.objectKey(prefix)
+	keys := []string{}
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", fullPrefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		data, err := b.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse s3 list response: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			key := obj.Key
+			if b.config.Prefix != "" {
+				key = strings.TrimPrefix(key, b.config.Prefix+"/")
+			}
+			keys = append(keys, key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (b *S3Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.config.SessionToken)
+	}
+
+	canonicalHeaders, signedHeaders := canonicalizeHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncodePath(req.URL.Path),
+		encodeQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+b.config.SecretAccessKey), date)
+	key = hmacSHA256(key, b.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.config.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalizeHeaders returns the canonical header block and signed header list
+func canonicalizeHeaders(req *http.Request) (string, string) {
+	names := make([]string, 0, len(req.Header))
+	values := make(map[string]string, len(req.Header))
+	for name, vals := range req.Header {
+		lower := strings.ToLower(name)
+		trimmed := make([]string, len(vals))
+		for i, v := range vals {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		names = append(names, lower)
+		values[lower] = strings.Join(trimmed, ",")
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + ":" + values[name] + "\n")
+	}
+	return sb.String(), strings.Join(names, ";")
+}
+
+// encodeQuery encodes query parameters in the canonical SigV4 form
+func encodeQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := []string{}
+	for _, k := range keys {
+		vals := append([]string(nil), query[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncodePath encodes a path, leaving the '/' separators intact
+func uriEncodePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+// uriEncode implements the SigV4 URI encoding rules
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9'),
+			c == '-' || c == '_' || c == '.' || c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			sb.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+)
+
+// ErrSchemaViolation is wrapped by every SchemaError
+var ErrSchemaViolation = errs.New(errs.InvalidArgument, "metadata does not match the schema")
+
+// FieldType is the type of a metadata field. Metadata values are stored as
+// strings; the type says which strings are valid.
+type FieldType string
+
+const (
+	// FieldString accepts any value
+	FieldString FieldType = "string"
+
+	// FieldInt accepts whole numbers such as "42" or "-7"
+	FieldInt FieldType = "int"
+
+	// FieldFloat accepts numbers such as "0.5" or "1e-3"
+	FieldFloat FieldType = "float"
+
+	// FieldBool accepts "true" and "false"
+	FieldBool FieldType = "bool"
+
+	// FieldTime accepts dates and times such as "2024-01-31" or RFC 3339
+	FieldTime FieldType = "time"
+
+	// FieldGeo accepts points as "latitude,longitude" in degrees, such as
+	// "52.37,4.89"
+	FieldGeo FieldType = "geo"
+)
+
+// ParseFieldType returns the field type with the given name
+func ParseFieldType(name string) (FieldType, error) {
+	switch t := FieldType(strings.ToLower(name)); t {
+	case FieldString, FieldInt, FieldFloat, FieldBool, FieldTime, FieldGeo:
+		return t, nil
+	case "":
+		return "", errors.New("missing field type: use string, int, float, bool, time or geo")
+	default:
+		return "", fmt.Errorf("unknown field type %q: use string, int, float, bool, time or geo", name)
+	}
+}
+
+// valid reports whether value is of type t
+func (t FieldType) valid(value string) bool {
+	var err error
+	switch t {
+	case FieldInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case FieldFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case FieldBool:
+		if value != "true" && value != "false" {
+			err = strconv.ErrSyntax
+		}
+	case FieldTime:
+		_, err = ParseTime(value)
+	case FieldGeo:
+		_, _, err = distance.ParseGeoPoint(value)
+	}
+	return err == nil
+}
+
+// SchemaField declares a metadata key
+type SchemaField struct {
+	Name     string
+	Type     FieldType
+	Required bool // Every vector must have a value
+}
+
+// Schema declares the metadata of the vectors of a collection: the vectors
+// whose IDs start with Prefix, or all of them. Keys it does not declare are
+// not checked.
+type Schema struct {
+	Collection string
+	Prefix     string
+	Fields     []SchemaField
+}
+
+// SchemaError describes metadata that does not match a schema
+type SchemaError struct {
+	Collection string
+	ID         string    // Vector written
+	Field      string    // Offending key
+	Type       FieldType // Declared type of the key
+	Value      string    // Offending value; empty if the key is missing
+	Missing    bool      // A required key has no value
+}
+
+func (e *SchemaError) Error() string {
+	if e.Missing {
+		return fmt.Sprintf("%v: vector %s lacks required field %q of collection %s", ErrSchemaViolation, e.ID, e.Field, e.Collection)
+	}
+	return fmt.Sprintf("%v: field %q of vector %s must be %s, got %q", ErrSchemaViolation, e.Field, e.ID, e.Type, e.Value)
+}
+
+// Unwrap makes errors.Is(err, ErrSchemaViolation) hold
+func (e *SchemaError) Unwrap() error {
+	return ErrSchemaViolation
+}
+
+// Check validates the fields of a schema
+func (s *Schema) Check() error {
+	seen := make(map[string]bool, len(s.Fields))
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("schema of %s has a field without a name", s.Collection)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("schema of %s declares field %q twice", s.Collection, f.Name)
+		}
+		seen[f.Name] = true
+		if _, err := ParseFieldType(string(f.Type)); err != nil {
+			return fmt.Errorf("field %q of %s: %w", f.Name, s.Collection, err)
+		}
+	}
+	return nil
+}
+
+// Validate returns a *SchemaError for the first field of v that does not
+// match the schema
+func (s *Schema) Validate(v *vector.Vector) error {
+	for _, f := range s.Fields {
+		value, ok := v.Metadata[f.Name]
+		if !ok {
+			if f.Required {
+				return &SchemaError{Collection: s.Collection, ID: v.ID, Field: f.Name, Type: f.Type, Missing: true}
+			}
+			continue
+		}
+		if !f.Type.valid(value) {
+			return &SchemaError{Collection: s.Collection, ID: v.ID, Field: f.Name, Type: f.Type, Value: value}
+		}
+	}
+	return nil
+}
+
+// SchemaStore wraps a VectorStore and rejects writes whose metadata does
+// not match the schema of the vector's collection
+type SchemaStore struct {
+	VectorStore
+	schemas []*Schema
+}
+
+// NewSchemaStore creates a store that validates writes against schemas
+func NewSchemaStore(store VectorStore) *SchemaStore {
+	return &SchemaStore{VectorStore: store}
+}
+
+// AddSchema enforces a schema on the writes of its collection. A vector in
+// the scope of several schemas must match all of them.
+func (s *SchemaStore) AddSchema(schema Schema) error {
+	if err := schema.Check(); err != nil {
+		return err
+	}
+	for _, other := range s.schemas {
+		if other.Collection == schema.Collection {
+			return fmt.Errorf("collection %s has a schema already", schema.Collection)
+		}
+	}
+	s.schemas = append(s.schemas, &schema)
+	return nil
+}
+
+// Schema returns the schema of a collection, or nil if it has none
+func (s *SchemaStore) Schema(collection string) *Schema {
+	for _, schema := range s.schemas {
+		if schema.Collection == collection {
+			return schema
+		}
+	}
+	return nil
+}
+
+// validate checks v against every schema whose scope it is in
+func (s *SchemaStore) validate(v *vector.Vector) error {
+	for _, schema := range s.schemas {
+		if !strings.HasPrefix(v.ID, schema.Prefix) {
+			continue
+		}
+		if err := schema.Validate(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert validates and adds a new vector
+func (s *SchemaStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *SchemaStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := s.validate(v); err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).InsertCtx(ctx, v)
+}
+
+// Update validates and replaces a vector
+func (s *SchemaStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *SchemaStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	if err := s.validate(v); err != nil {
+		return err
+	}
+	return WithContext(s.VectorStore).UpdateCtx(ctx, v)
+}
+
+// GetCtx implements ContextStore
+func (s *SchemaStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	return WithContext(s.VectorStore).GetCtx(ctx, id, opts)
+}
+
+// DeleteCtx implements ContextStore
+func (s *SchemaStore) DeleteCtx(ctx context.Context, id string) error {
+	return WithContext(s.VectorStore).DeleteCtx(ctx, id)
+}
+
+// ListCtx implements ContextStore
+func (s *SchemaStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	return WithContext(s.VectorStore).ListCtx(ctx, opts)
+}
+
+// CountCtx implements ContextStore
+func (s *SchemaStore) CountCtx(ctx context.Context) (int, error) {
+	return WithContext(s.VectorStore).CountCtx(ctx)
+}
+
+// CollectionSchema returns the schema of a collection enforced by store or
+// a store it wraps, or nil if there is none
+func CollectionSchema(store VectorStore, collection string) *Schema {
+	for ; store != nil; store = Unwrap(store) {
+		if s, ok := store.(*SchemaStore); ok {
+			return s.Schema(collection)
+		}
+	}
+	return nil
+}
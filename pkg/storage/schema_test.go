@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestSchemaStore(t *testing.T) {
+	store := NewSchemaStore(NewMemoryStore())
+	err := store.AddSchema(Schema{Collection: "docs", Prefix: "docs:", Fields: []SchemaField{
+		{Name: "category", Type: FieldString, Required: true},
+		{Name: "year", Type: FieldInt},
+		{Name: "published", Type: FieldTime},
+		{Name: "loc", Type: FieldGeo},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to add schema: %v", err)
+	}
+
+	doc := func(id string, metadata map[string]string) *vector.Vector {
+		return vector.NewVectorWithMetadata(id, []float32{1, 2}, metadata)
+	}
+
+	if err := store.Insert(doc("docs:1", map[string]string{"category": "news", "year": "2024", "published": "2024-01-31", "extra": "x"})); err != nil {
+		t.Errorf("Expected a matching vector to be inserted, got %v", err)
+	}
+	if err := store.Insert(doc("other:1", nil)); err != nil {
+		t.Errorf("Expected vectors of other collections to be unchecked, got %v", err)
+	}
+
+	var schemaErr *SchemaError
+	err = store.Insert(doc("docs:2", map[string]string{"year": "2024"}))
+	if !errors.As(err, &schemaErr) || !schemaErr.Missing || schemaErr.Field != "category" {
+		t.Errorf("Expected a missing category, got %v", err)
+	}
+	err = store.Update(doc("docs:1", map[string]string{"category": "news", "year": "soon"}))
+	if !errors.Is(err, ErrSchemaViolation) || !errors.As(err, &schemaErr) || schemaErr.Field != "year" || schemaErr.Value != "soon" {
+		t.Errorf("Expected an invalid year, got %v", err)
+	}
+	err = store.Insert(doc("docs:3", map[string]string{"category": "news", "loc": "91,4.9"}))
+	if !errors.As(err, &schemaErr) || schemaErr.Field != "loc" {
+		t.Errorf("Expected an invalid location, got %v", err)
+	}
+	if v, _ := store.Get("docs:1"); v.Metadata["year"] != "2024" {
+		t.Errorf("Expected the rejected update to leave the vector, got %v", v.Metadata)
+	}
+
+	if CollectionSchema(NewGatedStore(store), "docs") == nil || CollectionSchema(store, "other") != nil {
+		t.Error("Expected the schema of docs only")
+	}
+	if err := store.AddSchema(Schema{Collection: "bad", Fields: []SchemaField{{Name: "n", Type: "decimal"}}}); err == nil {
+		t.Error("Expected an unknown field type to be rejected")
+	}
+}
@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+
+	// Pure-Go SQLite driver, registered as "sqlite"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the tables used by SQLiteStore
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS vectors (
+	id         TEXT PRIMARY KEY,
+	dimension  INTEGER NOT NULL,
+	vals       BLOB NOT NULL,
+	created_at INTEGER NOT NULL DEFAULT 0,
+	updated_at INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS metadata (
+	vector_id TEXT NOT NULL,
+	key       TEXT NOT NULL,
+	value     TEXT NOT NULL,
+	PRIMARY KEY (vector_id, key)
+);
+`
+
+// SQLiteStore is an implementation of VectorStore that keeps vectors and
+// metadata in a single SQLite database file. Every write runs in its own
+// transaction, so a crash never leaves a partially written vector behind.
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+}
+
+// NewSQLiteStore opens (or creates) a SQLite-backed vector store at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+
+	// SQLite allows a single writer; serializing connections avoids SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{
+		"PRAGMA journal_mode = WAL",
+		"PRAGMA synchronous = NORMAL",
+		"PRAGMA busy_timeout = 5000",
+	} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to configure sqlite database: %w", err)
+		}
+	}
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema: %w", err)
+	}
+	if err := addTimestampColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db, path: path}, nil
+}
+
+func (s *SQLiteStore) Insert(v *vector.Vector) error {
+	return s.InsertCtx(context.Background(), v)
+}
+
+// InsertCtx implements ContextStore
+func (s *SQLiteStore) InsertCtx(ctx context.Context, v *vector.Vector) error {
+	if err := ValidateID(v.ID); err != nil {
+		return err
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		exists, err := vectorExists(ctx, tx, v.ID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrVectorAlreadyExists
+		}
+
+		v := stampInsert(v)
+		if _, err := tx.ExecContext(ctx, "INSERT INTO vectors (id, dimension, vals, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			v.ID, v.Dimension, encodeValues(v.Values), unixNano(v.CreatedAt), unixNano(v.UpdatedAt)); err != nil {
+			return fmt.Errorf("failed to insert vector: %w", err)
+		}
+
+		return insertMetadata(ctx, tx, v)
+	})
+}
+
+func (s *SQLiteStore) Get(id string) (*vector.Vector, error) {
+	return s.GetCtx(context.Background(), id, GetOptions{})
+}
+
+// GetCtx implements ContextStore. With MetadataOnly, the vals column is
+// not read.
+func (s *SQLiteStore) GetCtx(ctx context.Context, id string, opts GetOptions) (*vector.Vector, error) {
+	if opts.MetadataOnly {
+		return s.getMeta(ctx, id)
+	}
+
+	var dimension int
+	var blob []byte
+	var created, updated int64
+	err := s.db.QueryRowContext(ctx, "SELECT dimension, vals, created_at, updated_at FROM vectors WHERE id = ?", id).Scan(&dimension, &blob, &created, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVectorNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vector: %w", err)
+	}
+
+	values, err := decodeValues(blob, dimension)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := s.metadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	v := vector.NewVectorWithMetadata(id, values, metadata)
+	v.CreatedAt, v.UpdatedAt = fromUnixNano(created), fromUnixNano(updated)
+	return v, nil
+}
+
+// GetMeta implements MetaReader without reading the vals column
+func (s *SQLiteStore) GetMeta(id string) (*vector.Vector, error) {
+	return s.getMeta(context.Background(), id)
+}
+
+// getMeta reads a vector without its values
+func (s *SQLiteStore) getMeta(ctx context.Context, id string) (*vector.Vector, error) {
+	var dimension int
+	var created, updated int64
+	err := s.db.QueryRowContext(ctx, "SELECT dimension, created_at, updated_at FROM vectors WHERE id = ?", id).Scan(&dimension, &created, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVectorNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vector: %w", err)
+	}
+
+	metadata, err := s.metadata(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &vector.Vector{
+		ID:        id,
+		Dimension: dimension,
+		Metadata:  metadata,
+		CreatedAt: fromUnixNano(created),
+		UpdatedAt: fromUnixNano(updated),
+	}, nil
+}
+
+// metadata reads the metadata of a vector
+func (s *SQLiteStore) metadata(ctx context.Context, id string) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT key, value FROM metadata WHERE vector_id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to read metadata: %w", err)
+		}
+		metadata[key] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	return metadata, nil
+}
+
+func (s *SQLiteStore) Update(v *vector.Vector) error {
+	return s.UpdateCtx(context.Background(), v)
+}
+
+// UpdateCtx implements ContextStore
+func (s *SQLiteStore) UpdateCtx(ctx context.Context, v *vector.Vector) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		// The creation time is kept from the row
+		result, err := tx.ExecContext(ctx, "UPDATE vectors SET dimension = ?, vals = ?, updated_at = ? WHERE id = ?",
+			v.Dimension, encodeValues(v.Values), unixNano(now()), v.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update vector: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrVectorNotFound
+		}
+
+		// Replace the metadata wholesale, matching the other stores
+		if _, err := tx.ExecContext(ctx, "DELETE FROM metadata WHERE vector_id = ?", v.ID); err != nil {
+			return fmt.Errorf("failed to update metadata: %w", err)
+		}
+		return insertMetadata(ctx, tx, v)
+	})
+}
+
+func (s *SQLiteStore) Delete(id string) error {
+	return s.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx implements ContextStore
+func (s *SQLiteStore) DeleteCtx(ctx context.Context, id string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, "DELETE FROM vectors WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete vector: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrVectorNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM metadata WHERE vector_id = ?", id); err != nil {
+			return fmt.Errorf("failed to delete metadata: %w", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteStore) List() ([]string, error) {
+	return s.listRange(context.Background(), "", "", 0)
+}
+
+// ListCtx implements ContextStore with a range scan of the primary key
+func (s *SQLiteStore) ListCtx(ctx context.Context, opts ListOptions) ([]string, error) {
+	start, end := afterRange(opts.Prefix, opts.After)
+	return s.listRange(ctx, start, end, opts.Limit)
+}
+
+// ListPrefix implements PrefixLister with a range scan of the primary key
+func (s *SQLiteStore) ListPrefix(prefix string) ([]string, error) {
+	end, _ := prefixEnd(prefix)
+	return s.ListRange(prefix, end, 0)
+}
+
+// ListRange implements RangeLister with a range scan of the primary key
+func (s *SQLiteStore) ListRange(start, end string, limit int) ([]string, error) {
+	return s.listRange(context.Background(), start, end, limit)
+}
+
+// listRange lists the IDs from start up to but excluding end
+func (s *SQLiteStore) listRange(ctx context.Context, start, end string, limit int) ([]string, error) {
+	query, args := "SELECT id FROM vectors WHERE id >= ?", []interface{}{start}
+	if end != "" {
+		query, args = query+" AND id < ?", append(args, end)
+	}
+	query += " ORDER BY id"
+	if limit > 0 {
+		query, args = query+" LIMIT ?", append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to list vectors: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *SQLiteStore) Count() (int, error) {
+	return s.CountCtx(context.Background())
+}
+
+// CountCtx implements ContextStore
+func (s *SQLiteStore) CountCtx(ctx context.Context) (int, error) {
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM vectors").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count vectors: %w", err)
+	}
+	return count, nil
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the path of the SQLite database file
+func (s *SQLiteStore) Path() string {
+	return s.path
+}
+
+// withTx runs fn inside a transaction, committing only if fn succeeds.
+// Cancelling ctx rolls the transaction back.
+func (s *SQLiteStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// vectorExists checks whether a vector row exists
+func vectorExists(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+	var one int
+	err := tx.QueryRowContext(ctx, "SELECT 1 FROM vectors WHERE id = ?", id).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to look up vector: %w", err)
+	}
+	return true, nil
+}
+
+// insertMetadata writes all metadata entries of a vector
+func insertMetadata(ctx context.Context, tx *sql.Tx, v *vector.Vector) error {
+	for key, value := range v.Metadata {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO metadata (vector_id, key, value) VALUES (?, ?, ?)",
+			v.ID, key, value); err != nil {
+			return fmt.Errorf("failed to insert metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeValues packs vector components into a little-endian float32 blob
+func encodeValues(values []float32) []byte {
+	buf := make([]byte, 4*len(values))
+	for i, val := range values {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(val))
+	}
+	return buf
+}
+
+// decodeValues unpacks a blob produced by encodeValues
+func decodeValues(buf []byte, dimension int) ([]float32, error) {
+	if len(buf) != 4*dimension {
+		return nil, fmt.Errorf("corrupt vector blob: expected %d bytes, got %d", 4*dimension, len(buf))
+	}
+
+	values := make([]float32, dimension)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return values, nil
+}
+
+// addTimestampColumns adds the created_at and updated_at columns to
+// databases created before vectors had timestamps
+func addTimestampColumns(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info('vectors')")
+	if err != nil {
+		return fmt.Errorf("failed to read sqlite schema: %w", err)
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read sqlite schema: %w", err)
+		}
+		columns[name] = true
+	}
+	rows.Close()
+
+	for _, column := range []string{"created_at", "updated_at"} {
+		if columns[column] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE vectors ADD COLUMN " + column + " INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", column, err)
+		}
+	}
+	return nil
+}
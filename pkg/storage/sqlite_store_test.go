@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vectors.db")
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to create sqlite store: %v", err)
+	}
+
+	// Test Insert and duplicate detection
+	v1 := vector.NewVectorWithMetadata("v1", []float32{1.0, 2.0, 3.0}, map[string]string{"category": "image"})
+	if err := store.Insert(v1); err != nil {
+		t.Fatalf("Failed to insert vector: %v", err)
+	}
+	if err := store.Insert(v1); err != ErrVectorAlreadyExists {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	// Test Get
+	got, err := store.Get("v1")
+	if err != nil {
+		t.Fatalf("Failed to get vector: %v", err)
+	}
+	if got.Dimension != 3 || got.Values[2] != 3.0 || got.Metadata["category"] != "image" {
+		t.Errorf("Unexpected vector: %+v", got)
+	}
+	if _, err := store.Get("missing"); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	// Test Update replaces values and metadata
+	v1Updated := vector.NewVectorWithMetadata("v1", []float32{4.0, 5.0}, map[string]string{"color": "red"})
+	if err := store.Update(v1Updated); err != nil {
+		t.Fatalf("Failed to update vector: %v", err)
+	}
+	got, _ = store.Get("v1")
+	if got.Dimension != 2 || got.Values[0] != 4.0 {
+		t.Errorf("Expected updated values, got %v", got.Values)
+	}
+	if _, ok := got.Metadata["category"]; ok || got.Metadata["color"] != "red" {
+		t.Errorf("Expected metadata to be replaced, got %v", got.Metadata)
+	}
+	if err := store.Update(vector.NewVector("missing", []float32{1.0})); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	// Test List, Count and Delete
+	store.Insert(vector.NewVector("v2", []float32{7.0, 8.0, 9.0}))
+	ids, _ := store.List()
+	if len(ids) != 2 {
+		t.Errorf("Expected 2 IDs, got %v", ids)
+	}
+	if err := store.Delete("v2"); err != nil {
+		t.Fatalf("Failed to delete vector: %v", err)
+	}
+	if err := store.Delete("v2"); err != ErrVectorNotFound {
+		t.Errorf("Expected ErrVectorNotFound, got %v", err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Failed to close store: %v", err)
+	}
+
+	// Test persistence across reopen
+	reopened, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen sqlite store: %v", err)
+	}
+	defer reopened.Close()
+
+	count, _ := reopened.Count()
+	if count != 1 {
+		t.Errorf("Expected count 1 after reopen, got %d", count)
+	}
+	got, err = reopened.Get("v1")
+	if err != nil || got.Metadata["color"] != "red" {
+		t.Errorf("Expected persisted vector with metadata, got %+v (err %v)", got, err)
+	}
+}
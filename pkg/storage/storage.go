@@ -1,21 +1,22 @@
 package storage
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sync"
 
 	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/errs"
+	"github.com/ken/vector_database/pkg/fileutil"
 )
 
 var (
 	// ErrVectorNotFound is returned when a vector with the specified ID is not found
-	ErrVectorNotFound = errors.New("vector not found")
+	ErrVectorNotFound = errs.ErrVectorNotFound
 	
 	// ErrVectorAlreadyExists is returned when attempting to insert a vector with an ID that already exists
-	ErrVectorAlreadyExists = errors.New("vector already exists")
+	ErrVectorAlreadyExists = errs.ErrVectorAlreadyExists
 )
 
 // VectorStore defines the interface for vector storage operations
@@ -32,7 +33,7 @@ type VectorStore interface {
 	// Delete removes a vector by ID
 	Delete(id string) error
 	
-	// List returns all vector IDs
+	// List returns all vector IDs in order
 	List() ([]string, error)
 	
 	// Count returns the number of vectors in the store
@@ -42,10 +43,30 @@ type VectorStore interface {
 	Close() error
 }
 
+// MetaReader is implemented by stores that can read a vector's ID,
+// dimension and metadata without reading its values
+type MetaReader interface {
+	// GetMeta retrieves a vector by ID with nil Values
+	GetMeta(id string) (*vector.Vector, error)
+}
+
+// GetMeta reads the ID, dimension and metadata of a vector through the first
+// store in the wrapper chain that implements MetaReader. Other stores fall
+// back to Get, so callers must not rely on Values being nil.
+func GetMeta(store VectorStore, id string) (*vector.Vector, error) {
+	for s := store; s != nil; s = Unwrap(s) {
+		if r, ok := s.(MetaReader); ok {
+			return r.GetMeta(id)
+		}
+	}
+	return store.Get(id)
+}
+
 // MemoryStore is an in-memory implementation of VectorStore
 type MemoryStore struct {
 	mu      sync.RWMutex
 	vectors map[string]*vector.Vector
+	ids     idIndex // Sorted IDs of vectors
 }
 
 // NewMemoryStore creates a new in-memory vector store
@@ -56,16 +77,41 @@ func NewMemoryStore() *MemoryStore {
 }
 
 func (s *MemoryStore) Insert(v *vector.Vector) error {
+	_, err := s.insert(v)
+	return err
+}
+
+// insert stores a copy of v stamped with its creation time and returns the
+// copy, which the caller must not modify
+func (s *MemoryStore) insert(v *vector.Vector) (*vector.Vector, error) {
+	if err := ValidateID(v.ID); err != nil {
+		return nil, err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if _, exists := s.vectors[v.ID]; exists {
-		return ErrVectorAlreadyExists
+		return nil, ErrVectorAlreadyExists
 	}
 
 	// Store a copy to prevent modification of the original
-	s.vectors[v.ID] = v.Copy()
-	return nil
+	stored := stampInsert(v).Copy()
+	s.put(stored)
+	return stored, nil
+}
+
+// put stores v without copying it. The caller holds the lock or owns the store.
+func (s *MemoryStore) put(v *vector.Vector) {
+	s.vectors[v.ID] = v
+	s.ids.add(v.ID)
+}
+
+// remove deletes the vector with the given ID if it is stored. The caller
+// holds the lock or owns the store.
+func (s *MemoryStore) remove(id string) {
+	delete(s.vectors, id)
+	s.ids.remove(id)
 }
 
 func (s *MemoryStore) Get(id string) (*vector.Vector, error) {
@@ -81,16 +127,38 @@ func (s *MemoryStore) Get(id string) (*vector.Vector, error) {
 	return v.Copy(), nil
 }
 
+// GetMeta implements MetaReader
+func (s *MemoryStore) GetMeta(id string) (*vector.Vector, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, exists := s.vectors[id]
+	if !exists {
+		return nil, ErrVectorNotFound
+	}
+
+	return v.Meta(), nil
+}
+
 func (s *MemoryStore) Update(v *vector.Vector) error {
+	_, err := s.update(v)
+	return err
+}
+
+// update replaces a vector with a copy of v stamped with its update time
+// and returns the copy, which the caller must not modify
+func (s *MemoryStore) update(v *vector.Vector) (*vector.Vector, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if _, exists := s.vectors[v.ID]; !exists {
-		return ErrVectorNotFound
+	old, exists := s.vectors[v.ID]
+	if !exists {
+		return nil, ErrVectorNotFound
 	}
 
-	s.vectors[v.ID] = v.Copy()
-	return nil
+	stored := stampUpdate(v, old.CreatedAt).Copy()
+	s.vectors[v.ID] = stored
+	return stored, nil
 }
 
 func (s *MemoryStore) Delete(id string) error {
@@ -101,7 +169,7 @@ func (s *MemoryStore) Delete(id string) error {
 		return ErrVectorNotFound
 	}
 
-	delete(s.vectors, id)
+	s.remove(id)
 	return nil
 }
 
@@ -109,12 +177,23 @@ func (s *MemoryStore) List() ([]string, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	ids := make([]string, 0, len(s.vectors))
-	for id := range s.vectors {
-		ids = append(ids, id)
-	}
+	return append(make([]string, 0, len(s.ids.ids)), s.ids.ids...), nil
+}
+
+// ListPrefix implements PrefixLister
+func (s *MemoryStore) ListPrefix(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ids.prefix(prefix), nil
+}
 
-	return ids, nil
+// ListRange implements RangeLister
+func (s *MemoryStore) ListRange(start, end string, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.ids.between(start, end, limit), nil
 }
 
 func (s *MemoryStore) Count() (int, error) {
@@ -129,25 +208,44 @@ func (s *MemoryStore) Close() error {
 	return nil
 }
 
-// FileStore is a file-based implementation of VectorStore
+// FileStore is a file-based implementation of VectorStore. Each vector is
+// kept in a file named after its ID with IDFileName.
 type FileStore struct {
 	baseDir   string
 	memStore  *MemoryStore
 	mu        sync.RWMutex
 	isLoaded  bool
+	files     map[string]string // Names of the files vectors were loaded from
+	readOnly  bool              // Writes fail with ErrReadOnly
 }
 
 // NewFileStore creates a new file-based vector store
 func NewFileStore(baseDir string) (*FileStore, error) {
+	s, err := newFileStore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
 	// Ensure the directory exists
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
+	if err := os.MkdirAll(s.baseDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
+	return s, nil
+}
+
+// newFileStore creates a file store over baseDir without touching it
+func newFileStore(baseDir string) (*FileStore, error) {
+	// An absolute path lets the os package handle long paths on Windows
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve directory: %w", err)
+	}
 
 	return &FileStore{
 		baseDir:  baseDir,
 		memStore: NewMemoryStore(),
 		isLoaded: false,
+		files:    make(map[string]string),
 	}, nil
 }
 
@@ -167,6 +265,7 @@ func (s *FileStore) ensureLoaded() error {
 	}
 
 	for _, file := range files {
+		// Temporary files of unfinished writes end in .tmp and are skipped
 		if file.IsDir() || filepath.Ext(file.Name()) != ".vec" {
 			continue
 		}
@@ -184,8 +283,10 @@ func (s *FileStore) ensureLoaded() error {
 			return fmt.Errorf("failed to decode vector from file %s: %w", path, err)
 		}
 
-		// Store in memory
-		s.memStore.vectors[v.ID] = v
+		// Store in memory. Files written before IDs were encoded keep
+		// their names.
+		s.memStore.put(v)
+		s.files[v.ID] = file.Name()
 	}
 
 	s.isLoaded = true
@@ -193,17 +294,21 @@ func (s *FileStore) ensureLoaded() error {
 }
 
 func (s *FileStore) Insert(v *vector.Vector) error {
+	if s.readOnly {
+		return fmt.Errorf("%w: cannot insert %s", ErrReadOnly, v.ID)
+	}
 	if err := s.ensureLoaded(); err != nil {
 		return err
 	}
 
 	// Insert into memory first
-	if err := s.memStore.Insert(v); err != nil {
+	stored, err := s.memStore.insert(v)
+	if err != nil {
 		return err
 	}
 
 	// Write to disk
-	return s.saveVector(v)
+	return s.saveVector(stored)
 }
 
 func (s *FileStore) Get(id string) (*vector.Vector, error) {
@@ -214,21 +319,37 @@ func (s *FileStore) Get(id string) (*vector.Vector, error) {
 	return s.memStore.Get(id)
 }
 
+// GetMeta implements MetaReader
+func (s *FileStore) GetMeta(id string) (*vector.Vector, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	return s.memStore.GetMeta(id)
+}
+
 func (s *FileStore) Update(v *vector.Vector) error {
+	if s.readOnly {
+		return fmt.Errorf("%w: cannot update %s", ErrReadOnly, v.ID)
+	}
 	if err := s.ensureLoaded(); err != nil {
 		return err
 	}
 
 	// Update in memory
-	if err := s.memStore.Update(v); err != nil {
+	stored, err := s.memStore.update(v)
+	if err != nil {
 		return err
 	}
 
 	// Update on disk
-	return s.saveVector(v)
+	return s.saveVector(stored)
 }
 
 func (s *FileStore) Delete(id string) error {
+	if s.readOnly {
+		return fmt.Errorf("%w: cannot delete %s", ErrReadOnly, id)
+	}
 	if err := s.ensureLoaded(); err != nil {
 		return err
 	}
@@ -245,11 +366,13 @@ func (s *FileStore) Delete(id string) error {
 	}
 
 	// Delete from disk
-	path := filepath.Join(s.baseDir, id+".vec")
-	if err := os.Remove(path); err != nil {
+	if err := os.Remove(s.path(id)); err != nil {
 		return fmt.Errorf("failed to delete vector file: %w", err)
 	}
 
+	s.mu.Lock()
+	delete(s.files, id)
+	s.mu.Unlock()
 	return nil
 }
 
@@ -261,6 +384,24 @@ func (s *FileStore) List() ([]string, error) {
 	return s.memStore.List()
 }
 
+// ListPrefix implements PrefixLister
+func (s *FileStore) ListPrefix(prefix string) ([]string, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	return s.memStore.ListPrefix(prefix)
+}
+
+// ListRange implements RangeLister
+func (s *FileStore) ListRange(start, end string, limit int) ([]string, error) {
+	if err := s.ensureLoaded(); err != nil {
+		return nil, err
+	}
+
+	return s.memStore.ListRange(start, end, limit)
+}
+
 func (s *FileStore) Count() (int, error) {
 	if err := s.ensureLoaded(); err != nil {
 		return 0, err
@@ -277,15 +418,27 @@ func (s *FileStore) Close() error {
 // saveVector writes a vector to disk
 func (s *FileStore) saveVector(v *vector.Vector) error {
 	data := v.Encode()
-	path := filepath.Join(s.baseDir, v.ID+".vec")
+	path := s.path(v.ID)
 	
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := fileutil.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("failed to write vector to file: %w", err)
 	}
 	
 	return nil
 }
 
+// path returns the file a vector is kept in: the file it was loaded from, or
+// the one named after its ID
+func (s *FileStore) path(id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name, ok := s.files[id]; ok {
+		return filepath.Join(s.baseDir, name)
+	}
+	return filepath.Join(s.baseDir, IDFileName(id)+".vec")
+}
+
 // BaseDir returns the base directory of the file store
 func (s *FileStore) BaseDir() string {
 	return s.baseDir
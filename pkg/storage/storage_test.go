@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ken/vector_database/pkg/core/vector"
 )
@@ -255,4 +256,86 @@ func TestFileStore(t *testing.T) {
 			t.Errorf("Expected value at index %d to be %f, got %f", i, v2.Values[i], val)
 		}
 	}
-} 
\ No newline at end of file
+} 
+func TestGetMeta(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]func() (VectorStore, error){
+		"memory": func() (VectorStore, error) { return NewMemoryStore(), nil },
+		"file":   func() (VectorStore, error) { return NewFileStore(filepath.Join(dir, "file")) },
+		"bolt":   func() (VectorStore, error) { return NewBoltStore(filepath.Join(dir, "vectors.bolt")) },
+		"sqlite": func() (VectorStore, error) { return NewSQLiteStore(filepath.Join(dir, "vectors.db")) },
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+
+			v := vector.NewVectorWithMetadata("v1", []float32{1.0, 2.0, 3.0}, map[string]string{"lang": "en"})
+			if err := store.Insert(v); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+
+			// Wrappers pass the read through to the store
+			got, err := GetMeta(NewGatedStore(store), "v1")
+			if err != nil {
+				t.Fatalf("Failed to get metadata: %v", err)
+			}
+			if got.ID != "v1" || got.Dimension != 3 || got.Metadata["lang"] != "en" {
+				t.Errorf("Unexpected metadata: %+v", got)
+			}
+			if got.Values != nil {
+				t.Errorf("Expected no values, got %v", got.Values)
+			}
+
+			if _, err := GetMeta(store, "missing"); err != ErrVectorNotFound {
+				t.Errorf("Expected ErrVectorNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(orig func() time.Time) { now = orig }(now)
+	now = func() time.Time { return clock }
+
+	stores := map[string]func(dir string) (VectorStore, error){
+		"memory": func(string) (VectorStore, error) { return NewMemoryStore(), nil },
+		"file":   func(dir string) (VectorStore, error) { return NewFileStore(dir) },
+		"sqlite": func(dir string) (VectorStore, error) { return NewSQLiteStore(filepath.Join(dir, "db.sqlite")) },
+		"bolt":   func(dir string) (VectorStore, error) { return NewBoltStore(filepath.Join(dir, "db.bolt")) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := open(dir)
+			if err != nil {
+				t.Fatalf("Failed to open store: %v", err)
+			}
+			defer store.Close()
+
+			created := clock
+			if err := store.Insert(vector.NewVector("v1", []float32{1.0})); err != nil {
+				t.Fatalf("Failed to insert vector: %v", err)
+			}
+			clock = clock.Add(time.Hour)
+			if err := store.Update(vector.NewVector("v1", []float32{2.0})); err != nil {
+				t.Fatalf("Failed to update vector: %v", err)
+			}
+
+			for _, get := range []func(string) (*vector.Vector, error){store.Get, func(id string) (*vector.Vector, error) { return GetMeta(store, id) }} {
+				v, err := get("v1")
+				if err != nil {
+					t.Fatalf("Failed to get vector: %v", err)
+				}
+				if !v.CreatedAt.Equal(created) || !v.UpdatedAt.Equal(clock) {
+					t.Errorf("Expected created %v and updated %v, got %v and %v", created, clock, v.CreatedAt, v.UpdatedAt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ken/vector_database/pkg/core/vector"
+)
+
+// now returns the time writes are stamped with
+var now = func() time.Time { return time.Now().UTC() }
+
+// stampInsert returns a copy of v stamped as created now. Vectors that
+// carry timestamps already, such as restored ones, keep them.
+func stampInsert(v *vector.Vector) *vector.Vector {
+	stamped := *v
+	if stamped.CreatedAt.IsZero() {
+		stamped.CreatedAt = now()
+	}
+	if stamped.UpdatedAt.IsZero() {
+		stamped.UpdatedAt = stamped.CreatedAt
+	}
+	return &stamped
+}
+
+// stampUpdate returns a copy of v stamped as updated now, keeping the
+// creation time of the vector it replaces
+func stampUpdate(v *vector.Vector, created time.Time) *vector.Vector {
+	stamped := *v
+	stamped.CreatedAt = created
+	stamped.UpdatedAt = now()
+	return &stamped
+}
+
+// unixNano returns t in nanoseconds since the epoch, or 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano, returning times in UTC
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
+
+// timeLayouts are the formats ParseTime accepts, as UTC unless they name a
+// zone
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses a date or time such as "2024-01-31" or
+// "2024-01-31T12:00:00Z"
+func ParseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a date like 2024-01-31 or RFC 3339", s)
+}
@@ -0,0 +1,333 @@
+// Package vectodb embeds VectoDB in Go programs. It opens a data directory
+// like the CLI does and offers Insert, Search and Query methods, so
+// applications need neither the CLI nor SQL for the common cases:
+//
+//	db, err := vectodb.Open("./data", vectodb.WithIndex(vectodb.HNSW), vectodb.WithMetric(vectodb.Cosine))
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//	err = db.Insert("doc1", []float32{0.1, 0.2, 0.3}, map[string]string{"lang": "en"})
+//	results, err := db.Search([]float32{0.1, 0.2, 0.25}, 5)
+package vectodb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/index"
+	"github.com/ken/vector_database/pkg/index/flat"
+	"github.com/ken/vector_database/pkg/index/hnsw"
+	"github.com/ken/vector_database/pkg/sql/executor"
+	"github.com/ken/vector_database/pkg/sql/parser"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// IndexType selects the index that searches use
+type IndexType = executor.IndexType
+
+// Index types
+const (
+	// Flat compares the query with every vector, so results are exact
+	Flat = executor.IndexTypeFlat
+
+	// HNSW searches a graph of the vectors, trading some recall for speed
+	HNSW = executor.IndexTypeHNSW
+)
+
+// Metric names a distance metric
+type Metric = distance.MetricType
+
+// Distance metrics
+const (
+	Euclidean  = distance.Euclidean
+	Cosine     = distance.Cosine
+	DotProduct = distance.DotProduct
+	Manhattan  = distance.Manhattan
+	Haversine  = distance.Haversine
+)
+
+// ErrClosed is returned by the methods of a closed DB
+var ErrClosed = errors.New("database is closed")
+
+// ResultSet is the result of a SQL query
+type ResultSet = executor.ResultSet
+
+// Result is a vector found by Search
+type Result struct {
+	ID       string
+	Distance float32 // Lower is more similar
+	Metadata map[string]string
+}
+
+// options are set by the Options passed to Open
+type options struct {
+	indexType IndexType
+	metric    Metric
+	hnsw      *hnsw.HNSWConfig
+	store     storage.VectorStore
+}
+
+// Option configures a DB opened with Open
+type Option func(*options)
+
+// WithIndex sets the index searches use. The default is Flat.
+func WithIndex(indexType IndexType) Option {
+	return func(o *options) { o.indexType = indexType }
+}
+
+// WithMetric sets the distance metric. The default is Euclidean.
+func WithMetric(metric Metric) Option {
+	return func(o *options) { o.metric = metric }
+}
+
+// WithHNSW sets the parameters of HNSW indexes. Nil keeps the defaults.
+func WithHNSW(cfg *hnsw.HNSWConfig) Option {
+	return func(o *options) { o.hnsw = cfg }
+}
+
+// WithStore stores the vectors in store instead of files in the data
+// directory, e.g. storage.NewMemoryStore() for tests. The DB closes it.
+func WithStore(store storage.VectorStore) Option {
+	return func(o *options) { o.store = store }
+}
+
+// DB is an open database. Its methods are safe for concurrent use.
+type DB struct {
+	mu        sync.RWMutex
+	store     storage.VectorStore
+	metric    distance.Metric
+	indexType IndexType
+	hnsw      *hnsw.HNSWConfig
+	executor  *executor.QueryExecutor
+	indexes   *executor.IndexCache
+	index     index.Index // Built on the first Search, nil until then
+	closed    bool
+}
+
+// Open opens the database in dir, creating the directory if needed. Views
+// and persisted indexes are kept in dir as the CLI keeps them, so both can
+// open the same data directory, though not at the same time.
+func Open(dir string, opts ...Option) (*DB, error) {
+	o := options{indexType: Flat, metric: Euclidean}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.indexType != Flat && o.indexType != HNSW {
+		return nil, fmt.Errorf("unsupported index type: %s", o.indexType)
+	}
+	metric, err := distance.GetMetric(o.metric)
+	if err != nil {
+		return nil, fmt.Errorf("invalid distance metric: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	catalog, err := executor.OpenCatalog(filepath.Join(dir, "catalog.json"))
+	if err != nil {
+		return nil, err
+	}
+	store := o.store
+	if store == nil {
+		if store, err = storage.NewFileStore(dir); err != nil {
+			return nil, fmt.Errorf("failed to create vector store: %w", err)
+		}
+	}
+	store = storage.NewFiniteStore(store, storage.FiniteReject)
+
+	indexes := executor.NewIndexCache(filepath.Join(dir, "indexes"))
+	qe := executor.NewQueryExecutor(store, o.indexType, metric)
+	qe.SetHNSWConfig(o.hnsw)
+	qe.SetIndexCache(indexes)
+	qe.SetCatalog(catalog)
+
+	return &DB{
+		store:     store,
+		metric:    metric,
+		indexType: o.indexType,
+		hnsw:      o.hnsw,
+		executor:  qe,
+		indexes:   indexes,
+	}, nil
+}
+
+// Close closes the store. Later calls return ErrClosed.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	db.index = nil
+	return db.store.Close()
+}
+
+// Insert stores a vector under id. Inserting an existing id fails with
+// storage.ErrVectorAlreadyExists, values that are NaN or infinite with
+// vector.ErrNonFinite.
+func (db *DB) Insert(id string, values []float32, metadata map[string]string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+
+	vec := vector.NewVector(id, values)
+	for key, value := range metadata {
+		vec.Metadata[key] = value
+	}
+	if err := db.store.Insert(vec); err != nil {
+		return err
+	}
+	db.indexes.Invalidate()
+	if db.index != nil {
+		if err := db.index.Add(vec); err != nil {
+			// The next Search rebuilds the index from the store
+			db.index = nil
+		}
+	}
+	return nil
+}
+
+// Get returns the vector stored under id
+func (db *DB) Get(id string) (*vector.Vector, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return db.store.Get(id)
+}
+
+// Delete removes the vector stored under id
+func (db *DB) Delete(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrClosed
+	}
+
+	if err := db.store.Delete(id); err != nil {
+		return err
+	}
+	db.indexes.Invalidate()
+	if db.index != nil {
+		if err := db.index.Delete(id); err != nil {
+			db.index = nil
+		}
+	}
+	return nil
+}
+
+// Count returns the number of stored vectors
+func (db *DB) Count() (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrClosed
+	}
+	return db.store.Count()
+}
+
+// Search returns the k vectors closest to query, closest first. Use Query
+// with NEAREST TO and WHERE to search only vectors whose metadata matches.
+func (db *DB) Search(query []float32, k int) ([]Result, error) {
+	if k < 1 {
+		return nil, fmt.Errorf("k must be greater than 0, got %d", k)
+	}
+	idx, err := db.searchIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	found, err := index.SearchWithOptions(idx, vector.NewVector("query", query), k, index.SearchOptions{OmitVectors: true})
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+
+	results := make([]Result, 0, len(found))
+	for _, result := range found {
+		vec, err := storage.GetMeta(db.store, result.ID)
+		if errors.Is(err, storage.ErrVectorNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, Result{ID: result.ID, Distance: result.Distance, Metadata: vec.Metadata})
+	}
+	return results, nil
+}
+
+// searchIndex returns the index of Search, building it from the store on
+// first use
+func (db *DB) searchIndex() (index.Index, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.index != nil {
+		return db.index, nil
+	}
+
+	ids, err := db.store.List()
+	if err != nil {
+		return nil, err
+	}
+	vectors := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		vec, err := db.store.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		vectors = append(vectors, vec)
+	}
+
+	var idx index.Index
+	if db.indexType == HNSW {
+		idx = hnsw.NewHNSWIndex(db.metric, db.hnsw)
+	} else {
+		idx = flat.NewFlatIndex(db.metric)
+	}
+	if err := idx.Build(vectors); err != nil {
+		return nil, fmt.Errorf("failed to build index: %w", err)
+	}
+	db.index = idx
+	return idx, nil
+}
+
+// Query executes a SQL statement, such as
+// SELECT id, distance FROM vectors NEAREST TO [0.1, 0.2] WHERE metadata.lang = 'en' LIMIT 5
+func (db *DB) Query(query string) (*ResultSet, error) {
+	if node, err := parser.Parse(query); err == nil && node.Type == parser.NodeSelect {
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		if db.closed {
+			return nil, ErrClosed
+		}
+		return db.executor.ExecuteQuery(query)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	result, err := db.executor.ExecuteQuery(query)
+	// The statement may have written to the store, so Search rebuilds its index
+	db.index = nil
+	return result, err
+}
@@ -0,0 +1,101 @@
+package vectodb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+func TestOpenInsertSearch(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, WithIndex(HNSW), WithMetric(Euclidean))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	for id, values := range map[string][]float32{"a": {0, 0}, "b": {1, 0}, "c": {5, 5}} {
+		if err := db.Insert(id, values, map[string]string{"name": id}); err != nil {
+			t.Fatalf("Insert %s failed: %v", id, err)
+		}
+	}
+	if err := db.Insert("a", []float32{1, 1}, nil); !errors.Is(err, storage.ErrVectorAlreadyExists) {
+		t.Errorf("Expected ErrVectorAlreadyExists, got %v", err)
+	}
+
+	results, err := db.Search([]float32{0.9, 0}, 2)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "b" || results[1].ID != "a" || results[0].Metadata["name"] != "b" {
+		t.Errorf("Expected b then a, got %+v", results)
+	}
+
+	// Writes after the first search reach the index
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Insert("d", []float32{1, 0.1}, nil); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	results, err = db.Search([]float32{0.9, 0}, 1)
+	if err != nil || len(results) != 1 || results[0].ID != "d" {
+		t.Errorf("Expected d, got %+v (%v)", results, err)
+	}
+
+	// SQL sees the same vectors, and its writes reach Search
+	if _, err := db.Query("DELETE FROM vectors WHERE id = 'd'"); err != nil {
+		t.Fatalf("DELETE failed: %v", err)
+	}
+	rs, err := db.Query("SELECT id FROM vectors NEAREST TO [0.9, 0] LIMIT 1")
+	if err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if len(rs.Rows) != 1 || rs.Rows[0][0] != "a" {
+		t.Errorf("Expected a, got %v", rs.Rows)
+	}
+	if results, _ := db.Search([]float32{0.9, 0}, 1); len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("Expected a after the SQL delete, got %+v", results)
+	}
+
+	// The vectors are kept in the directory
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := db.Count(); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	db, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer db.Close()
+	if count, _ := db.Count(); count != 2 {
+		t.Errorf("Expected 2 vectors after reopening, got %d", count)
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	if _, err := Open(t.TempDir(), WithIndex("ivf")); err == nil {
+		t.Error("Expected an error for an unknown index type")
+	}
+	if _, err := Open(t.TempDir(), WithMetric("chebyshev")); err == nil {
+		t.Error("Expected an error for an unknown metric")
+	}
+
+	store := storage.NewMemoryStore()
+	db, err := Open(t.TempDir(), WithStore(store), WithMetric(Cosine))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer db.Close()
+	if err := db.Insert("x", []float32{1, 2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := store.Count(); count != 1 {
+		t.Errorf("Expected the vector in the given store, got %d vectors", count)
+	}
+	if _, err := db.Search([]float32{1, 2}, 0); err == nil {
+		t.Error("Expected an error for k = 0")
+	}
+}
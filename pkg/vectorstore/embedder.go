@@ -0,0 +1,141 @@
+package vectorstore
+
+import (
+	"fmt"
+
+	"github.com/ken/vector_database/pkg/embedding"
+)
+
+// ServiceEmbedder embeds texts with an embedding service
+type ServiceEmbedder struct {
+	Service *embedding.Service
+}
+
+// NewServiceEmbedder creates an embedder backed by an embedding service
+func NewServiceEmbedder(service *embedding.Service) *ServiceEmbedder {
+	return &ServiceEmbedder{Service: service}
+}
+
+// EmbedDocuments implements Embedder
+func (e *ServiceEmbedder) EmbedDocuments(texts []string) ([][]float32, error) {
+	return embedTexts(e.Service, texts)
+}
+
+// EmbedQuery implements Embedder
+func (e *ServiceEmbedder) EmbedQuery(text string) ([]float32, error) {
+	return embedText(e.Service, text)
+}
+
+// ModelName returns the model recorded on added documents
+func (e *ServiceEmbedder) ModelName() string {
+	return e.Service.ModelName()
+}
+
+// RegistryEmbedder embeds texts with the model a registry binds to a
+// collection, resolved on every call so rebinding takes effect immediately
+type RegistryEmbedder struct {
+	Registry   *embedding.Registry
+	Collection string
+}
+
+// NewRegistryEmbedder creates an embedder using the collection's model
+func NewRegistryEmbedder(models *embedding.Registry, collection string) *RegistryEmbedder {
+	return &RegistryEmbedder{Registry: models, Collection: collection}
+}
+
+// EmbedDocuments implements Embedder
+func (e *RegistryEmbedder) EmbedDocuments(texts []string) ([][]float32, error) {
+	service, err := e.Registry.ServiceForCollection(e.Collection, "")
+	if err != nil {
+		return nil, err
+	}
+	return embedTexts(service, texts)
+}
+
+// EmbedQuery implements Embedder
+func (e *RegistryEmbedder) EmbedQuery(text string) ([]float32, error) {
+	service, err := e.Registry.ServiceForCollection(e.Collection, "")
+	if err != nil {
+		return nil, err
+	}
+	return embedText(service, text)
+}
+
+// ModelName returns the model recorded on added documents
+func (e *RegistryEmbedder) ModelName() string {
+	service, err := e.Registry.ServiceForCollection(e.Collection, "")
+	if err != nil {
+		return ""
+	}
+	return service.ModelName()
+}
+
+// EmbedRouted implements RoutingEmbedder. Texts are embedded with the model
+// the collection routes their language to, in one batch per model.
+func (e *RegistryEmbedder) EmbedRouted(texts []string) ([][]float32, []map[string]string, error) {
+	embeddings := make([][]float32, len(texts))
+	metadatas := make([]map[string]string, len(texts))
+	batches := make(map[*embedding.Service][]int)
+	var order []*embedding.Service
+	for i, text := range texts {
+		service, language, err := e.Registry.ServiceForText(e.Collection, text)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := batches[service]; !ok {
+			order = append(order, service)
+		}
+		batches[service] = append(batches[service], i)
+		metadatas[i] = map[string]string{embedding.MetadataKeyModel: service.ModelName()}
+		if language != "" {
+			metadatas[i][embedding.MetadataKeyLanguage] = language
+		}
+	}
+
+	for _, service := range order {
+		indexes := batches[service]
+		batch := make([]string, len(indexes))
+		for j, i := range indexes {
+			batch[j] = texts[i]
+		}
+		vectors, err := embedTexts(service, batch)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(vectors) != len(batch) {
+			return nil, nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(batch))
+		}
+		for j, i := range indexes {
+			embeddings[i] = vectors[j]
+		}
+	}
+	return embeddings, metadatas, nil
+}
+
+// EmbedQueryRouted implements RoutingEmbedder. In a collection with language
+// routes the query is embedded with the model of its language and matches
+// the documents in that language, or those of the collection's model if its
+// language cannot be detected.
+func (e *RegistryEmbedder) EmbedQueryRouted(text string) ([]float32, map[string]string, error) {
+	service, language, err := e.Registry.ServiceForText(e.Collection, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	values, err := embedText(service, text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return values, e.Registry.RouteFilter(e.Collection, service, language), nil
+}
+
+func embedText(service *embedding.Service, text string) ([]float32, error) {
+	doc := embedding.NewTextDocument("", text)
+	if err := service.ProcessDocument(doc); err != nil {
+		return nil, err
+	}
+	return doc.Vector, nil
+}
+
+func embedTexts(service *embedding.Service, texts []string) ([][]float32, error) {
+	return service.EmbedTexts(texts)
+}
@@ -0,0 +1,336 @@
+// Package vectorstore adapts VectoDB to the "add_texts / similarity_search"
+// shape of the vector store abstraction used by RAG frameworks such as
+// LangChain and LlamaIndex, so VectoDB can serve as a retriever backend
+package vectorstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ken/vector_database/pkg/analysis"
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/core/vector"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// DefaultTextKey is the metadata key holding the text of a document
+const DefaultTextKey = "text"
+
+var (
+	// ErrLengthMismatch is returned when metadatas or ids do not match the texts
+	ErrLengthMismatch = errors.New("number of metadatas or ids does not match number of texts")
+
+	// ErrInvalidK is returned for a non-positive number of results
+	ErrInvalidK = errors.New("k must be positive")
+)
+
+// Embedder turns texts into vectors, like LangChain's Embeddings interface
+type Embedder interface {
+	// EmbedDocuments embeds texts that are added to the store
+	EmbedDocuments(texts []string) ([][]float32, error)
+
+	// EmbedQuery embeds a search query
+	EmbedQuery(text string) ([]float32, error)
+}
+
+// RoutingEmbedder is an Embedder that picks the model of every text, e.g. by
+// its language, so texts and queries are only compared when embedded alike
+type RoutingEmbedder interface {
+	Embedder
+
+	// EmbedRouted embeds texts that are added to the store, with the
+	// metadata recording the model and language of each
+	EmbedRouted(texts []string) ([][]float32, []map[string]string, error)
+
+	// EmbedQueryRouted embeds a search query, with the metadata filter that
+	// limits the search to the documents it can be compared with
+	EmbedQueryRouted(text string) ([]float32, map[string]string, error)
+}
+
+// Document is a text with metadata, like LangChain's Document
+type Document struct {
+	ID          string            `json:"id"`
+	PageContent string            `json:"page_content"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// ScoredDocument is a search result with its distance to the query (lower
+// is more similar)
+type ScoredDocument struct {
+	Document
+	Score     float32            `json:"score"`
+	Highlight *embedding.Snippet `json:"highlight,omitempty"` // Set by Highlight
+}
+
+// Options configures a VectorStore
+type Options struct {
+	// TextKey is the metadata key under which document texts are stored
+	TextKey string
+}
+
+// DefaultOptions returns default vector store options
+func DefaultOptions() *Options {
+	return &Options{
+		TextKey: DefaultTextKey,
+	}
+}
+
+// VectorStore stores texts with their embeddings in a VectoDB store
+type VectorStore struct {
+	store    storage.VectorStore
+	embedder Embedder
+	metric   distance.Metric
+	opts     *Options
+}
+
+// New creates a vector store adapter. Searches rank documents by metric.
+func New(store storage.VectorStore, embedder Embedder, metric distance.Metric, opts *Options) *VectorStore {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+	if opts.TextKey == "" {
+		opts.TextKey = DefaultTextKey
+	}
+
+	return &VectorStore{
+		store:    store,
+		embedder: embedder,
+		metric:   metric,
+		opts:     opts,
+	}
+}
+
+// AddTexts embeds and stores texts and returns their IDs. metadatas and ids
+// are optional; missing IDs are generated. Existing IDs are overwritten.
+func (s *VectorStore) AddTexts(texts []string, metadatas []map[string]string, ids []string) ([]string, error) {
+	if (metadatas != nil && len(metadatas) != len(texts)) || (ids != nil && len(ids) != len(texts)) {
+		return nil, ErrLengthMismatch
+	}
+	if len(texts) == 0 {
+		return []string{}, nil
+	}
+
+	var embeddings [][]float32
+	var routed []map[string]string
+	var err error
+	if router, ok := s.embedder.(RoutingEmbedder); ok {
+		embeddings, routed, err = router.EmbedRouted(texts)
+	} else {
+		embeddings, err = s.embedder.EmbedDocuments(texts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed texts: %w", err)
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(embeddings), len(texts))
+	}
+
+	added := make([]string, len(texts))
+	for i, text := range texts {
+		id := ""
+		if ids != nil {
+			id = ids[i]
+		}
+		if id == "" {
+			if id, err = newID(); err != nil {
+				return added[:i], err
+			}
+		}
+
+		v := vector.NewVector(id, embeddings[i])
+		if metadatas != nil {
+			for key, value := range metadatas[i] {
+				v.Metadata[key] = value
+			}
+		}
+		v.Metadata[s.opts.TextKey] = text
+		if named, ok := s.embedder.(interface{ ModelName() string }); ok && named.ModelName() != "" {
+			v.Metadata[embedding.MetadataKeyModel] = named.ModelName()
+		}
+		if routed != nil {
+			for key, value := range routed[i] {
+				v.Metadata[key] = value
+			}
+		}
+
+		err := s.store.Insert(v)
+		if errors.Is(err, storage.ErrVectorAlreadyExists) {
+			err = s.store.Update(v)
+		}
+		if err != nil {
+			return added[:i], fmt.Errorf("failed to store document %s: %w", id, err)
+		}
+		added[i] = id
+	}
+
+	return added, nil
+}
+
+// AddDocuments stores documents and returns their IDs
+func (s *VectorStore) AddDocuments(docs []Document) ([]string, error) {
+	texts := make([]string, len(docs))
+	metadatas := make([]map[string]string, len(docs))
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.PageContent
+		metadatas[i] = doc.Metadata
+		ids[i] = doc.ID
+	}
+	return s.AddTexts(texts, metadatas, ids)
+}
+
+// SimilaritySearch returns the k documents most similar to the query. Only
+// documents whose metadata contains every key/value of filter are considered.
+func (s *VectorStore) SimilaritySearch(query string, k int, filter map[string]string) ([]Document, error) {
+	scored, err := s.SimilaritySearchWithScore(query, k, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]Document, len(scored))
+	for i, result := range scored {
+		docs[i] = result.Document
+	}
+	return docs, nil
+}
+
+// SimilaritySearchWithScore is like SimilaritySearch but also returns distances
+func (s *VectorStore) SimilaritySearchWithScore(query string, k int, filter map[string]string) ([]ScoredDocument, error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+
+	router, ok := s.embedder.(RoutingEmbedder)
+	if !ok {
+		values, err := s.embedder.EmbedQuery(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		return s.SimilaritySearchByVector(values, k, filter)
+	}
+
+	values, routed, err := router.EmbedQueryRouted(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	// The caller's filter wins over the routed one
+	merged := make(map[string]string, len(filter)+len(routed))
+	for key, value := range routed {
+		merged[key] = value
+	}
+	for key, value := range filter {
+		merged[key] = value
+	}
+	return s.SimilaritySearchByVector(values, k, merged)
+}
+
+// SimilaritySearchByVector returns the k documents closest to an embedding
+func (s *VectorStore) SimilaritySearchByVector(values []float32, k int, filter map[string]string) ([]ScoredDocument, error) {
+	if k <= 0 {
+		return nil, ErrInvalidK
+	}
+
+	ids, err := s.store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vectors: %w", err)
+	}
+
+	// Collect the candidates that pass the filter and match the query dimension
+	query := vector.NewVector("query", values)
+	candidates := make([]*vector.Vector, 0, len(ids))
+	for _, id := range ids {
+		v, err := s.store.Get(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vector %s: %w", id, err)
+		}
+		if v.Dimension == query.Dimension && matches(v, filter) {
+			candidates = append(candidates, v)
+		}
+	}
+
+	batch, err := distance.NewDefaultBatchDistance(s.metric)
+	if err != nil {
+		return nil, err
+	}
+	distances := make([]float32, len(candidates))
+	if err := batch.Distances(query, candidates, distances); err != nil {
+		return nil, fmt.Errorf("failed to compute distances: %w", err)
+	}
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return distances[order[a]] < distances[order[b]]
+	})
+	if len(order) > k {
+		order = order[:k]
+	}
+
+	results := make([]ScoredDocument, len(order))
+	found := make([]string, len(order))
+	for i, idx := range order {
+		results[i] = ScoredDocument{Document: s.toDocument(candidates[idx]), Score: distances[idx]}
+		found[i] = candidates[idx].ID
+	}
+	storage.RecordSearch(s.store, found)
+	return results, nil
+}
+
+// Highlight sets the passage of each result's text that best matches the
+// query, of at most maxLen bytes, so a result list can show it without the
+// whole text. Words are matched as terms of analyzer, if not nil.
+func Highlight(results []ScoredDocument, query string, maxLen int, analyzer *analysis.Analyzer) {
+	for i := range results {
+		results[i].Highlight = embedding.Highlight(results[i].PageContent, query, maxLen, analyzer)
+	}
+}
+
+// Delete removes documents by ID. Missing IDs are ignored.
+func (s *VectorStore) Delete(ids []string) error {
+	for _, id := range ids {
+		if err := s.store.Delete(id); err != nil && !errors.Is(err, storage.ErrVectorNotFound) {
+			return fmt.Errorf("failed to delete document %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// toDocument splits the stored text from the rest of the metadata
+func (s *VectorStore) toDocument(v *vector.Vector) Document {
+	metadata := make(map[string]string, len(v.Metadata))
+	for key, value := range v.Metadata {
+		if key != s.opts.TextKey {
+			metadata[key] = value
+		}
+	}
+	return Document{ID: v.ID, PageContent: v.Metadata[s.opts.TextKey], Metadata: metadata}
+}
+
+// matches reports whether the vector's metadata contains the filter
+func matches(v *vector.Vector, filter map[string]string) bool {
+	for key, value := range filter {
+		if v.Metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// newID returns a random UUID (version 4) for documents added without an ID
+func newID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate document id: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
@@ -0,0 +1,173 @@
+package vectorstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ken/vector_database/pkg/core/distance"
+	"github.com/ken/vector_database/pkg/embedding"
+	"github.com/ken/vector_database/pkg/storage"
+)
+
+// letterEmbedder embeds texts as counts of the letters a, b and c
+type letterEmbedder struct{}
+
+func (letterEmbedder) EmbedDocuments(texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i], _ = letterEmbedder{}.EmbedQuery(text)
+	}
+	return embeddings, nil
+}
+
+func (letterEmbedder) EmbedQuery(text string) ([]float32, error) {
+	return []float32{
+		float32(strings.Count(text, "a")),
+		float32(strings.Count(text, "b")),
+		float32(strings.Count(text, "c")),
+	}, nil
+}
+
+func newTestStore(t *testing.T) (*VectorStore, storage.VectorStore) {
+	metric, _ := distance.GetMetric(distance.Euclidean)
+	store := storage.NewMemoryStore()
+	return New(store, letterEmbedder{}, metric, nil), store
+}
+
+func TestAddTextsAndSearch(t *testing.T) {
+	vs, store := newTestStore(t)
+
+	ids, err := vs.AddTexts(
+		[]string{"aaa", "bbb", "ccc", "aab"},
+		[]map[string]string{{"src": "x"}, {"src": "y"}, {"src": "x"}, {"src": "y"}},
+		[]string{"d1", "d2", "d3", ""},
+	)
+	if err != nil {
+		t.Fatalf("AddTexts failed: %v", err)
+	}
+	if len(ids) != 4 || ids[0] != "d1" || ids[3] == "" {
+		t.Fatalf("Unexpected ids: %v", ids)
+	}
+	if count, _ := store.Count(); count != 4 {
+		t.Errorf("Expected 4 stored vectors, got %d", count)
+	}
+
+	docs, err := vs.SimilaritySearch("aaaa", 2, nil)
+	if err != nil {
+		t.Fatalf("SimilaritySearch failed: %v", err)
+	}
+	if len(docs) != 2 || docs[0].ID != "d1" || docs[1].ID != ids[3] {
+		t.Fatalf("Unexpected results: %+v", docs)
+	}
+	if docs[0].PageContent != "aaa" || docs[0].Metadata["src"] != "x" {
+		t.Errorf("Unexpected document: %+v", docs[0])
+	}
+	if _, ok := docs[0].Metadata[DefaultTextKey]; ok {
+		t.Errorf("Text should not be repeated in metadata: %+v", docs[0].Metadata)
+	}
+
+	// The filter restricts the candidates
+	scored, err := vs.SimilaritySearchWithScore("aaaa", 5, map[string]string{"src": "y"})
+	if err != nil {
+		t.Fatalf("SimilaritySearchWithScore failed: %v", err)
+	}
+	if len(scored) != 2 || scored[0].ID != ids[3] || scored[0].Score > scored[1].Score {
+		t.Errorf("Unexpected filtered results: %+v", scored)
+	}
+
+	if err := vs.Delete([]string{"d1", "missing"}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if count, _ := store.Count(); count != 3 {
+		t.Errorf("Expected 3 stored vectors after delete, got %d", count)
+	}
+}
+
+func TestAddTextsErrors(t *testing.T) {
+	vs, _ := newTestStore(t)
+
+	if _, err := vs.AddTexts([]string{"a", "b"}, nil, []string{"only-one"}); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("Expected ErrLengthMismatch, got %v", err)
+	}
+	if _, err := vs.SimilaritySearch("a", 0, nil); !errors.Is(err, ErrInvalidK) {
+		t.Errorf("Expected ErrInvalidK, got %v", err)
+	}
+}
+
+func TestRegistryEmbedder(t *testing.T) {
+	models := embedding.NewRegistry()
+	defer models.Close()
+
+	metric, _ := distance.GetMetric(distance.Cosine)
+	store := storage.NewMemoryStore()
+	vs := New(store, NewRegistryEmbedder(models, "vectors"), metric, nil)
+
+	ids, err := vs.AddTexts([]string{"hello world"}, nil, nil)
+	if err != nil {
+		t.Fatalf("AddTexts failed: %v", err)
+	}
+
+	v, err := store.Get(ids[0])
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if v.Metadata[embedding.MetadataKeyModel] == "" || v.Metadata[DefaultTextKey] != "hello world" {
+		t.Errorf("Unexpected metadata: %v", v.Metadata)
+	}
+
+	docs, err := vs.SimilaritySearch("hello world", 1, nil)
+	if err != nil || len(docs) != 1 || docs[0].ID != ids[0] {
+		t.Errorf("Expected the added document, got %+v (err = %v)", docs, err)
+	}
+}
+
+func TestRegistryEmbedderRoutes(t *testing.T) {
+	models := embedding.NewRegistry()
+	defer models.Close()
+	if err := models.Register("multilingual", embedding.ModelSpec{Model: "sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Route("vectors", embedding.AnyLanguage, "multilingual"); err != nil {
+		t.Fatal(err)
+	}
+
+	metric, _ := distance.GetMetric(distance.Cosine)
+	store := storage.NewMemoryStore()
+	vs := New(store, NewRegistryEmbedder(models, "vectors"), metric, nil)
+
+	texts := []string{"The index is rebuilt at night", "Le chat est sur la table", "vector database"}
+	if _, err := vs.AddTexts(texts, nil, []string{"en", "fr", "unknown"}); err != nil {
+		t.Fatalf("AddTexts failed: %v", err)
+	}
+
+	// Every detected language is routed to the multilingual model, the rest
+	// use the collection's
+	want := map[string][2]string{
+		"en":      {"sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2", "en"},
+		"fr":      {"sentence-transformers/paraphrase-multilingual-MiniLM-L12-v2", "fr"},
+		"unknown": {"sentence-transformers/all-MiniLM-L6-v2", ""},
+	}
+	for id, w := range want {
+		v, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", id, err)
+		}
+		if v.Metadata[embedding.MetadataKeyModel] != w[0] || v.Metadata[embedding.MetadataKeyLanguage] != w[1] {
+			t.Errorf("%s: unexpected metadata %v", id, v.Metadata)
+		}
+	}
+
+	// Queries only match documents in their language, or of their model
+	cases := map[string]string{
+		"Où est le chat ?":         "fr",
+		"What is rebuilt at night": "en",
+		"database":                 "unknown",
+	}
+	for query, id := range cases {
+		docs, err := vs.SimilaritySearch(query, 3, nil)
+		if err != nil || len(docs) != 1 || docs[0].ID != id {
+			t.Errorf("%q: expected only %s, got %+v (err = %v)", query, id, docs, err)
+		}
+	}
+}